@@ -14,7 +14,9 @@ import (
 )
 
 var (
-	templatePath string // Custom template path, e.g., "python/custom-template"
+	templatePath     string // Custom template path, e.g., "python/custom-template"
+	templateRef      string // Registry template or git URL, e.g., "support-bot@1.2.0"
+	templateChecksum string // Expected checksum of the template files
 )
 
 var CreateCmd = &cobra.Command{
@@ -31,9 +33,16 @@ You will be guided through:
 
 Use --template-path to specify a custom template folder from:
   https://github.com/memodb-io/Acontext-Examples
+
+Use --template to use a community template, from the template registry
+as <name>[@version] or from any git repository as <repo>[//<folder>][@<ref>].
+Registry versions are verified against their published checksum, git
+templates against --checksum if given (see: acontext template checksum).
   
 Example:
   acontext create my-project --template-path "python/custom-template"
+  acontext create my-project --template support-bot@1.2.0
+  acontext create my-project --template "https://github.com/acme/kits//python/bot@v1.0.0" --checksum sha256:...
 `,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runCreate,
@@ -41,6 +50,9 @@ Example:
 
 func init() {
 	CreateCmd.Flags().StringVarP(&templatePath, "template-path", "t", "", "Custom template folder path from Acontext-Examples repository (e.g., python/custom-template)")
+	CreateCmd.Flags().StringVar(&templateRef, "template", "", "Registry template <name>[@version] or git template <repo>[//<folder>][@<ref>]")
+	CreateCmd.Flags().StringVar(&templateChecksum, "checksum", "", "Expected checksum of the template files (sha256:...)")
+	CreateCmd.MarkFlagsMutuallyExclusive("template-path", "template")
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
@@ -84,8 +96,15 @@ func runCreate(cmd *cobra.Command, args []string) error {
 
 	var templateConfig *template.Config
 
-	// 2. If custom template path is specified, use it directly
-	if templatePath != "" {
+	// 2. If a custom template is specified, use it directly
+	if templateRef != "" {
+		templateConfig, err = resolveTemplateRef(templateRef, templateChecksum)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Using template: %s\n", templateConfig.Description)
+		fmt.Println()
+	} else if templatePath != "" {
 		fmt.Printf("✓ Using custom template: %s\n", templatePath)
 		fmt.Println()
 		templateConfig = &template.Config{
@@ -201,6 +220,36 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// resolveTemplateRef resolves a --template reference, from a git repository or the template registry.
+// A checksum given by the user takes precedence over the one published in the registry.
+func resolveTemplateRef(ref, checksum string) (*template.Config, error) {
+	var cfg *template.Config
+	if template.IsRemoteRef(ref) {
+		var err error
+		if cfg, err = template.ParseRemote(ref); err != nil {
+			return nil, err
+		}
+	} else {
+		registry, err := config.GetRegistry()
+		if err != nil {
+			return nil, err
+		}
+		index, err := template.LoadRegistry(registry)
+		if err != nil {
+			return nil, err
+		}
+		name, version := template.ParseRegistryRef(ref)
+		if cfg, err = index.Resolve(name, version); err != nil {
+			return nil, err
+		}
+	}
+
+	if checksum != "" {
+		cfg.Checksum = checksum
+	}
+	return cfg, nil
+}
+
 // validateProjectName validates the project name
 func validateProjectName(name string) error {
 	if name == "" {
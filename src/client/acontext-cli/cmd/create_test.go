@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidateProjectName(t *testing.T) {
@@ -91,3 +94,25 @@ func TestValidateProjectName(t *testing.T) {
 	}
 }
 
+func TestResolveTemplateRef(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, os.WriteFile(registry, []byte(`{"templates": [{"name": "support-bot", "repo": "https://github.com/acme/kits", "path": "bot",
+		"versions": [{"version": "1.0.0", "ref": "v1.0.0", "checksum": "sha256:aaa"}]}]}`), 0644))
+	t.Setenv("ACONTEXT_TEMPLATE_REGISTRY", registry)
+
+	cfg, err := resolveTemplateRef("support-bot@1.0.0", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/acme/kits", cfg.Repo)
+	assert.Equal(t, "v1.0.0", cfg.Ref)
+	assert.Equal(t, "sha256:aaa", cfg.Checksum)
+
+	// a checksum given by the user wins
+	cfg, err = resolveTemplateRef("https://github.com/acme/kits//bot@v2", "sha256:bbb")
+	require.NoError(t, err)
+	assert.Equal(t, "bot", cfg.Path)
+	assert.Equal(t, "v2", cfg.Ref)
+	assert.Equal(t, "sha256:bbb", cfg.Checksum)
+
+	_, err = resolveTemplateRef("unknown", "")
+	assert.Error(t, err)
+}
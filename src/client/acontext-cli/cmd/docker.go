@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/memodb-io/Acontext/acontext-cli/internal/browser"
 	"github.com/memodb-io/Acontext/acontext-cli/internal/docker"
 	"github.com/spf13/cobra"
 )
@@ -25,14 +28,25 @@ This command helps you:
 }
 
 var (
-	detachedMode bool
+	detachedMode  bool
+	dockerProfile string
+	openBrowser   bool
+	readyTimeout  time.Duration
 )
 
 var dockerUpCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Start Docker services",
-	Long:  "Start all Docker Compose services (use -d to run in detached mode)",
-	RunE:  runDockerUp,
+	Long: `Start Docker Compose services (use -d to run in detached mode)
+
+Profiles select the services to run:
+  minimal  PostgreSQL, Redis and S3 storage only, to run the API and core from source
+  full     all services: storage, RabbitMQ, tracing, core workers, API and dashboard (default)
+  gpu      all services, with block embeddings computed on the host GPUs by a local embedding server
+`,
+	Example: `  acontext docker up -d
+  acontext docker up -d --profile minimal`,
+	RunE: runDockerUp,
 }
 
 var dockerDownCmd = &cobra.Command{
@@ -66,6 +80,9 @@ var dockerEnvCmd = &cobra.Command{
 
 func init() {
 	dockerUpCmd.Flags().BoolVarP(&detachedMode, "detach", "d", false, "Run containers in the background")
+	dockerUpCmd.Flags().StringVar(&dockerProfile, "profile", docker.ProfileFull, "Services to run: "+strings.Join(docker.ProfileNames(), ", "))
+	dockerUpCmd.Flags().BoolVar(&openBrowser, "open", false, "Open the dashboard in the browser once the stack is ready")
+	dockerUpCmd.Flags().DurationVar(&readyTimeout, "wait-timeout", 3*time.Minute, "How long to wait for the stack to be ready")
 	DockerCmd.AddCommand(dockerUpCmd)
 	DockerCmd.AddCommand(dockerDownCmd)
 	DockerCmd.AddCommand(dockerStatusCmd)
@@ -74,6 +91,11 @@ func init() {
 }
 
 func runDockerUp(cmd *cobra.Command, args []string) error {
+	profile, err := docker.GetProfile(dockerProfile)
+	if err != nil {
+		return err
+	}
+
 	projectDir, err := getProjectDir()
 	if err != nil {
 		return err
@@ -93,6 +115,17 @@ func runDockerUp(cmd *cobra.Command, args []string) error {
 		_ = os.Remove(composeFile) // Clean up temp file
 	}()
 
+	// The profile override hides the services it does not run, or adds services
+	overrideFile, err := docker.CreateTempComposeOverride(projectDir, profile)
+	if err != nil {
+		return fmt.Errorf("failed to create %s profile override: %w", profile.Name, err)
+	}
+	if overrideFile != "" {
+		defer func() {
+			_ = os.Remove(overrideFile)
+		}()
+	}
+
 	// Check if .env file exists
 	envFile := filepath.Join(projectDir, ".env")
 	if _, err := os.Stat(envFile); os.IsNotExist(err) {
@@ -106,23 +139,73 @@ func runDockerUp(cmd *cobra.Command, args []string) error {
 		}
 		fmt.Println("✅ Generated .env file")
 	}
+	env, err := docker.ReadEnvFile(envFile)
+	if err != nil {
+		return err
+	}
+
+	endpoints := docker.GetEndpoints(env, profile)
+
+	fmt.Printf("🚀 Starting Docker services (%s profile: %s)...\n", profile.Name, profile.Description)
+	if !detachedMode {
+		// Services run in the foreground until interrupted, the stack is reported ready alongside their logs
+		go func() {
+			if err := waitForStack(cmd.Context(), projectDir, composeFile, endpoints); err != nil {
+				fmt.Printf("⚠️  Warning: %v\n", err)
+			}
+		}()
+		if err := docker.Up(projectDir, []string{composeFile, overrideFile}, false); err != nil {
+			return fmt.Errorf("failed to start services: %w", err)
+		}
+		return nil
+	}
 
-	fmt.Println("🚀 Starting Docker services...")
-	if err := docker.Up(projectDir, composeFile, detachedMode); err != nil {
+	if err := docker.Up(projectDir, []string{composeFile, overrideFile}, true); err != nil {
 		return fmt.Errorf("failed to start services: %w", err)
 	}
+	if err := waitForStack(cmd.Context(), projectDir, composeFile, endpoints); err != nil {
+		fmt.Printf("⚠️  Warning: %v\n", err)
+		fmt.Println("   Services may still be starting. Check status with: acontext docker status")
+	}
+	return nil
+}
 
-	if detachedMode {
-		fmt.Println("⏳ Waiting for services to be healthy...")
-		if err := docker.WaitForHealth(projectDir, composeFile, 120*time.Second); err != nil {
-			fmt.Printf("⚠️  Warning: %v\n", err)
-			fmt.Println("   Services may still be starting. Check status with: acontext docker status")
-		} else {
-			fmt.Println()
-			fmt.Println("🎉 All services are running!")
+// waitForStack waits until the API answers /readyz, or the services are up when the profile runs no API,
+// then prints the endpoints of the stack and opens the dashboard when --open is set
+func waitForStack(ctx context.Context, projectDir string, composeFile string, endpoints docker.Endpoints) error {
+	if endpoints.API == "" {
+		if err := docker.WaitForHealth(projectDir, composeFile, readyTimeout); err != nil {
+			return err
 		}
+		fmt.Println()
+		fmt.Println("🎉 All services are running!")
+		return nil
 	}
 
+	fmt.Printf("⏳ Waiting for the API to be ready at %s/readyz...\n", endpoints.API)
+	if err := docker.WaitForReady(ctx, endpoints.API, readyTimeout, 2*time.Second); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("🎉 Acontext is ready!")
+	fmt.Printf("   API:       %s\n", endpoints.API)
+	fmt.Printf("   Swagger:   %s\n", endpoints.Swagger)
+	if endpoints.Dashboard != "" {
+		fmt.Printf("   Dashboard: %s\n", endpoints.Dashboard)
+	}
+	// Use ANSI color codes: \033[1m = bold, \033[93m = bright yellow, \033[0m = reset
+	fmt.Printf("  🔑 \033[1m\033[93mACONTEXT_API_KEY=\"%s\"\033[0m\n", endpoints.APIKey)
+
+	if openBrowser {
+		url := endpoints.Dashboard
+		if url == "" {
+			url = endpoints.Swagger
+		}
+		if err := browser.Open(url); err != nil {
+			fmt.Printf("⚠️  Warning: %v, open %s manually\n", err, url)
+		}
+	}
 	return nil
 }
 
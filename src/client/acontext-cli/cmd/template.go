@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/memodb-io/Acontext/acontext-cli/internal/template"
+	"github.com/spf13/cobra"
+)
+
+var TemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Tools for template authors",
+	Long: `Tools for publishing templates to the template registry.
+
+A registry index lists templates and their versions, each pinned to a git
+ref and the checksum of its files:
+
+  {"templates": [{"name": "support-bot", "repo": "https://github.com/acme/kits",
+    "path": "python/support-bot", "description": "...",
+    "versions": [{"version": "1.2.0", "ref": "v1.2.0", "checksum": "sha256:..."}]}]}
+`,
+}
+
+var templateChecksumCmd = &cobra.Command{
+	Use:   "checksum [dir]",
+	Short: "Print the checksum of a template folder",
+	Long: `Print the checksum of the files of a template folder, ignoring .git.
+
+Publish it in the registry or pass it to acontext create --checksum so
+that users get exactly the files you published.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		sum, err := template.TreeChecksum(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sum)
+		return nil
+	},
+}
+
+func init() {
+	TemplateCmd.AddCommand(templateChecksumCmd)
+}
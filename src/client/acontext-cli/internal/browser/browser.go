@@ -0,0 +1,28 @@
+package browser
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// command returns the command opening url in the default browser of goos
+func command(goos string, url string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		return "xdg-open", []string{url}
+	}
+}
+
+// Open opens url in the default browser without waiting for it
+func Open(url string) error {
+	name, args := command(runtime.GOOS, url)
+	if err := exec.Command(name, args...).Start(); err != nil {
+		return fmt.Errorf("failed to open browser: %w", err)
+	}
+	return nil
+}
@@ -27,10 +27,14 @@ type Preset struct {
 
 type TemplatesConfig struct {
 	Repo      string                               `yaml:"repo"`
+	Registry  string                               `yaml:"registry"`
 	Templates map[string]map[string]TemplateConfig `yaml:"templates"`
 	Presets   map[string][]Preset                  `yaml:"presets,omitempty"`
 }
 
+// registryEnv overrides the template registry, with a URL or the path of a local index
+const registryEnv = "ACONTEXT_TEMPLATE_REGISTRY"
+
 //go:embed templates.yaml
 var templatesYAML string
 
@@ -71,6 +75,21 @@ func GetTemplate(language, templateKey string) (*TemplateConfig, error) {
 	return &template, nil
 }
 
+// GetRegistry returns where the template registry index is read from
+func GetRegistry() (string, error) {
+	if registry := os.Getenv(registryEnv); registry != "" {
+		return registry, nil
+	}
+	config, err := LoadTemplatesConfig()
+	if err != nil {
+		return "", err
+	}
+	if config.Registry == "" {
+		return "", fmt.Errorf("no template registry configured, set %s", registryEnv)
+	}
+	return config.Registry, nil
+}
+
 // NeedsTemplateDiscovery checks if templates need to be discovered from repository
 func NeedsTemplateDiscovery(language string) (bool, error) {
 	config, err := LoadTemplatesConfig()
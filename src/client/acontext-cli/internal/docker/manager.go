@@ -13,9 +13,21 @@ import (
 // RunDockerCompose directly executes docker compose command
 // If composeFile is provided, use it as the compose file, otherwise use default docker-compose.yaml
 func RunDockerCompose(projectDir string, composeFile string, args ...string) error {
-	cmdArgs := []string{"compose"}
+	var composeFiles []string
 	if composeFile != "" {
-		cmdArgs = append(cmdArgs, "-f", composeFile)
+		composeFiles = []string{composeFile}
+	}
+	return RunDockerComposeFiles(projectDir, composeFiles, args...)
+}
+
+// RunDockerComposeFiles executes docker compose command with several compose files,
+// later files override earlier ones
+func RunDockerComposeFiles(projectDir string, composeFiles []string, args ...string) error {
+	cmdArgs := []string{"compose"}
+	for _, f := range composeFiles {
+		if f != "" {
+			cmdArgs = append(cmdArgs, "-f", f)
+		}
 	}
 	cmdArgs = append(cmdArgs, args...)
 	cmd := exec.Command("docker", cmdArgs...)
@@ -27,20 +39,20 @@ func RunDockerCompose(projectDir string, composeFile string, args ...string) err
 	return cmd.Run()
 }
 
-// Up starts Docker Compose services using a temporary compose file
+// Up starts Docker Compose services using temporary compose files, the compose file and the override of a profile
 // If detached is false, services run in foreground (no -d flag)
 // If detached is true, services run in background (with -d flag)
-func Up(projectDir string, composeFile string, detached bool) error {
+func Up(projectDir string, composeFiles []string, detached bool) error {
 	args := []string{"up"}
 	if detached {
 		args = append(args, "-d")
 	}
-	return RunDockerCompose(projectDir, composeFile, args...)
+	return RunDockerComposeFiles(projectDir, composeFiles, args...)
 }
 
-// Down stops Docker Compose services
+// Down stops Docker Compose services, including services added by the override of a profile
 func Down(projectDir string, composeFile string) error {
-	return RunDockerCompose(projectDir, composeFile, "down")
+	return RunDockerCompose(projectDir, composeFile, "down", "--remove-orphans")
 }
 
 // Status checks Docker Compose services status
@@ -0,0 +1,140 @@
+package docker
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles of acontext docker up
+const (
+	ProfileMinimal = "minimal"
+	ProfileFull    = "full"
+	ProfileGPU     = "gpu"
+)
+
+// disabledComposeProfile is never activated, services moved behind it are not started
+const disabledComposeProfile = "disabled"
+
+// Profile selects the services started by acontext docker up
+type Profile struct {
+	Name        string
+	Description string
+	// Disabled lists the services of docker-compose.yaml the profile does not start
+	Disabled []string
+	// Override is a compose file merged over docker-compose.yaml, e.g. to add services
+	Override string
+}
+
+//go:embed docker-compose.gpu.yaml
+var gpuOverrideContent string
+
+var profiles = []Profile{
+	{
+		Name:        ProfileMinimal,
+		Description: "PostgreSQL, Redis and S3 storage only, to run the API and core from source",
+		Disabled: []string{
+			"acontext-server-rabbitmq",
+			"acontext-server-jaeger",
+			"acontext-server-core",
+			"acontext-server-api",
+			"acontext-server-ui",
+		},
+	},
+	{
+		Name:        ProfileFull,
+		Description: "all services: storage, RabbitMQ, tracing, core workers, API and dashboard",
+	},
+	{
+		Name:        ProfileGPU,
+		Description: "all services, with block embeddings computed on the host GPUs by a local embedding server",
+		Override:    gpuOverrideContent,
+	},
+}
+
+// Profiles returns the available profiles
+func Profiles() []Profile {
+	return profiles
+}
+
+// ProfileNames returns the names of the available profiles
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// GetProfile returns the profile named name
+func GetProfile(name string) (Profile, error) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q, use one of: %s", name, strings.Join(ProfileNames(), ", "))
+}
+
+// OverrideContent returns the compose override of the profile, empty when it starts docker-compose.yaml as is
+func (p Profile) OverrideContent() (string, error) {
+	if len(p.Disabled) == 0 && p.Override == "" {
+		return "", nil
+	}
+
+	override := map[string]any{}
+	if p.Override != "" {
+		if err := yaml.Unmarshal([]byte(p.Override), &override); err != nil {
+			return "", fmt.Errorf("failed to parse %s profile override: %w", p.Name, err)
+		}
+	}
+	services, _ := override["services"].(map[string]any)
+	if services == nil {
+		services = map[string]any{}
+	}
+
+	disabled := append([]string(nil), p.Disabled...)
+	sort.Strings(disabled)
+	for _, name := range disabled {
+		service, _ := services[name].(map[string]any)
+		if service == nil {
+			service = map[string]any{}
+		}
+		service["profiles"] = []string{disabledComposeProfile}
+		services[name] = service
+	}
+	override["services"] = services
+
+	out, err := yaml.Marshal(override)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate %s profile override: %w", p.Name, err)
+	}
+	return string(out), nil
+}
+
+// CreateTempComposeOverride writes the compose override of the profile to a temporary file and returns its path,
+// or an empty path when the profile has no override
+func CreateTempComposeOverride(projectDir string, p Profile) (string, error) {
+	content, err := p.OverrideContent()
+	if err != nil || content == "" {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp(projectDir, ".docker-compose-"+p.Name+"-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		_ = tmpFile.Close()
+	}()
+
+	if _, err := tmpFile.WriteString(content); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	return tmpFile.Name(), nil
+}
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type composeFile struct {
+	Services map[string]struct {
+		Profiles    []string          `yaml:"profiles"`
+		Environment map[string]string `yaml:"environment"`
+		DependsOn   any               `yaml:"depends_on"` // a list or a map of conditions
+	} `yaml:"services"`
+}
+
+func parseCompose(t *testing.T, content string) composeFile {
+	var c composeFile
+	require.NoError(t, yaml.Unmarshal([]byte(content), &c))
+	return c
+}
+
+func TestGetProfile(t *testing.T) {
+	for _, name := range []string{ProfileMinimal, ProfileFull, ProfileGPU} {
+		p, err := GetProfile(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, p.Name)
+	}
+
+	_, err := GetProfile("tiny")
+	assert.ErrorContains(t, err, "minimal, full, gpu")
+}
+
+func TestProfileOverrideContent(t *testing.T) {
+	base := parseCompose(t, GetDockerComposeContent())
+
+	t.Run("full starts the compose file as is", func(t *testing.T) {
+		p, _ := GetProfile(ProfileFull)
+		content, err := p.OverrideContent()
+		require.NoError(t, err)
+		assert.Empty(t, content)
+	})
+
+	t.Run("minimal disables the services it does not run", func(t *testing.T) {
+		p, _ := GetProfile(ProfileMinimal)
+		content, err := p.OverrideContent()
+		require.NoError(t, err)
+
+		override := parseCompose(t, content)
+		assert.Len(t, override.Services, len(p.Disabled))
+		for _, name := range p.Disabled {
+			assert.Contains(t, base.Services, name)
+			assert.Equal(t, []string{disabledComposeProfile}, override.Services[name].Profiles)
+		}
+		assert.NotContains(t, override.Services, "acontext-server-pg")
+	})
+
+	t.Run("gpu adds the embedding server", func(t *testing.T) {
+		p, _ := GetProfile(ProfileGPU)
+		content, err := p.OverrideContent()
+		require.NoError(t, err)
+
+		override := parseCompose(t, content)
+		assert.Contains(t, override.Services, "acontext-server-embedding")
+		core := override.Services["acontext-server-core"]
+		assert.Equal(t, "http://acontext-server-embedding:80/v1", core.Environment["BLOCK_EMBEDDING_BASE_URL"])
+		assert.Contains(t, core.DependsOn.(map[string]any), "acontext-server-embedding")
+		assert.Contains(t, base.Services, "acontext-server-core")
+	})
+
+	t.Run("disabled services of an override", func(t *testing.T) {
+		p := Profile{Name: "custom", Disabled: []string{"acontext-server-core"}, Override: gpuOverrideContent}
+		content, err := p.OverrideContent()
+		require.NoError(t, err)
+
+		override := parseCompose(t, content)
+		core := override.Services["acontext-server-core"]
+		assert.Equal(t, []string{disabledComposeProfile}, core.Profiles)
+		assert.NotEmpty(t, core.Environment)
+	})
+}
+
+func TestCreateTempComposeOverride(t *testing.T) {
+	dir := t.TempDir()
+
+	full, _ := GetProfile(ProfileFull)
+	path, err := CreateTempComposeOverride(dir, full)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	minimal, _ := GetProfile(ProfileMinimal)
+	path, err = CreateTempComposeOverride(dir, minimal)
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+	assert.Equal(t, dir, filepath.Dir(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	expected, _ := minimal.OverrideContent()
+	assert.Equal(t, expected, string(data))
+}
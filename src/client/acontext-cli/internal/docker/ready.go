@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults of docker-compose.yaml used when .env does not override them
+const (
+	defaultAPIExportPort      = "8029"
+	defaultUIExportPort       = "3000"
+	defaultRootAPIBearerToken = "your-root-api-bearer-token"
+)
+
+// Endpoints are the URLs and API key of a started stack, the URLs are empty when the profile does not run the service
+type Endpoints struct {
+	API       string
+	Swagger   string
+	Dashboard string
+	APIKey    string
+}
+
+// ReadEnvFile reads the KEY=VALUE lines of a .env file, a missing file has no values
+func ReadEnvFile(path string) (map[string]string, error) {
+	env := map[string]string{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return env, nil
+}
+
+// GetEndpoints returns the endpoints of the services the profile runs, with the ports and token of env
+func GetEndpoints(env map[string]string, p Profile) Endpoints {
+	get := func(key, def string) string {
+		if v := env[key]; v != "" {
+			return v
+		}
+		return def
+	}
+
+	var e Endpoints
+	if !slices.Contains(p.Disabled, "acontext-server-api") {
+		e.API = "http://localhost:" + get("API_EXPORT_PORT", defaultAPIExportPort)
+		e.Swagger = e.API + "/swagger/index.html"
+		e.APIKey = "sk-ac-" + get("ROOT_API_BEARER_TOKEN", defaultRootAPIBearerToken)
+	}
+	if !slices.Contains(p.Disabled, "acontext-server-ui") {
+		e.Dashboard = "http://localhost:" + get("UI_EXPORT_PORT", defaultUIExportPort)
+	}
+	return e
+}
+
+// WaitForReady polls the /readyz endpoint of the API until it answers 200, the API is then
+// reachable and connected to its database
+func WaitForReady(ctx context.Context, apiURL string, timeout time.Duration, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"/readyz", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%s/readyz responded with status %d", apiURL, resp.StatusCode)
+		}
+		// a request cut by the deadline says less than the previous answer
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for the API to be ready: %w", lastErr)
+		}
+	}
+}
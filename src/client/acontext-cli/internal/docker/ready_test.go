@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(`# comment
+ROOT_API_BEARER_TOKEN=secret
+API_EXPORT_PORT = 9029
+export UI_EXPORT_PORT="3100"
+LLM_BASE_URL='https://api.example.com/v1?a=b'
+not a pair
+`), 0644))
+
+	env, err := ReadEnvFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ROOT_API_BEARER_TOKEN": "secret",
+		"API_EXPORT_PORT":       "9029",
+		"UI_EXPORT_PORT":        "3100",
+		"LLM_BASE_URL":          "https://api.example.com/v1?a=b",
+	}, env)
+
+	env, err = ReadEnvFile(filepath.Join(t.TempDir(), ".env"))
+	require.NoError(t, err)
+	assert.Empty(t, env)
+}
+
+func TestGetEndpoints(t *testing.T) {
+	full, _ := GetProfile(ProfileFull)
+	assert.Equal(t, Endpoints{
+		API:       "http://localhost:8029",
+		Swagger:   "http://localhost:8029/swagger/index.html",
+		Dashboard: "http://localhost:3000",
+		APIKey:    "sk-ac-your-root-api-bearer-token",
+	}, GetEndpoints(map[string]string{}, full))
+
+	env := map[string]string{"API_EXPORT_PORT": "9029", "UI_EXPORT_PORT": "3100", "ROOT_API_BEARER_TOKEN": "secret"}
+	e := GetEndpoints(env, full)
+	assert.Equal(t, "http://localhost:9029", e.API)
+	assert.Equal(t, "http://localhost:3100", e.Dashboard)
+	assert.Equal(t, "sk-ac-secret", e.APIKey)
+
+	minimal, _ := GetProfile(ProfileMinimal)
+	assert.Equal(t, Endpoints{}, GetEndpoints(env, minimal))
+}
+
+func TestWaitForReady(t *testing.T) {
+	t.Run("ready once the API answers 200", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/readyz", r.URL.Path)
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		require.NoError(t, WaitForReady(context.Background(), srv.URL, 5*time.Second, 10*time.Millisecond))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		err := WaitForReady(context.Background(), srv.URL, 50*time.Millisecond, 10*time.Millisecond)
+		assert.ErrorContains(t, err, "status 503")
+	})
+}
@@ -0,0 +1,177 @@
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spoolFileName = "telemetry.jsonl"
+	// errorFileName holds the last error of the background telemetry, for troubleshooting
+	errorFileName = "telemetry.err"
+	// maxSpoolEvents bounds the spool while offline, the oldest events are dropped first
+	maxSpoolEvents = 1000
+	// staleClaimAge is how long a claimed spool may wait before another run takes it over,
+	// e.g. when the run sending it was killed
+	staleClaimAge = time.Minute
+)
+
+var claimSeq atomic.Int64
+
+// spool is a JSON lines file of events waiting to be sent, shared by all runs of the CLI
+type spool struct {
+	dir string
+}
+
+// openSpool returns the spool in the user cache directory, or in ACONTEXT_TELEMETRY_DIR if set
+func openSpool() (*spool, error) {
+	dir := os.Getenv("ACONTEXT_TELEMETRY_DIR")
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find cache directory: %w", err)
+		}
+		dir = filepath.Join(cacheDir, "acontext")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create telemetry directory: %w", err)
+	}
+	return &spool{dir: dir}, nil
+}
+
+func (s *spool) path() string {
+	return filepath.Join(s.dir, spoolFileName)
+}
+
+// append adds events to the spool with a single write
+func (s *spool) append(events ...Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.path(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open telemetry spool: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write telemetry spool: %w", err)
+	}
+	return f.Close()
+}
+
+// claimName returns a file name no other run or claim uses
+func (s *spool) claimName() string {
+	return filepath.Join(s.dir, fmt.Sprintf("telemetry.%d.%d.%d.sending", os.Getpid(), time.Now().UnixNano(), claimSeq.Add(1)))
+}
+
+// claim moves the spool aside so that concurrent runs never send the same events,
+// taking over the claims of runs that stopped before sending them
+func (s *spool) claim() ([]Event, []string, error) {
+	var claimed []string
+
+	own := s.claimName()
+	if err := os.Rename(s.path(), own); err == nil {
+		claimed = append(claimed, own)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to claim telemetry spool: %w", err)
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(s.dir, "telemetry.*.sending"))
+	for _, path := range stale {
+		if path == own {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < staleClaimAge {
+			continue
+		}
+		// Only one run wins the rename
+		next := s.claimName()
+		if os.Rename(path, next) == nil {
+			claimed = append(claimed, next)
+		}
+	}
+
+	var events []Event
+	for _, path := range claimed {
+		events = append(events, readEvents(path)...)
+	}
+	return events, claimed, nil
+}
+
+// readEvents reads the events of a spool file, skipping lines that are not valid events
+func readEvents(path string) []Event {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.Command == "" {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// flush sends up to maxFlushEvents spooled events until one fails, the rest is put back in the spool.
+// Events the endpoint refuses are kept like those that could not be sent, the spool being bounded.
+func (s *spool) flush(ctx context.Context) error {
+	events, claimed, err := s.claim()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, path := range claimed {
+			_ = os.Remove(path)
+		}
+	}()
+
+	sent := 0
+	var sendErr error
+	for sent < min(len(events), maxFlushEvents) {
+		if sendErr = sendEvent(ctx, events[sent]); sendErr != nil {
+			break
+		}
+		sent++
+	}
+
+	rest := events[sent:]
+	if len(rest) == 0 {
+		return sendErr
+	}
+	if len(rest) > maxSpoolEvents {
+		rest = rest[len(rest)-maxSpoolEvents:]
+	}
+	if err := s.append(rest...); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// recordError replaces the last recorded error of the background telemetry
+func (s *spool) recordError(err error) {
+	line := fmt.Sprintf("%s %v\n", time.Now().UTC().Format(time.RFC3339), err)
+	_ = os.WriteFile(filepath.Join(s.dir, errorFileName), []byte(line), 0o600)
+}
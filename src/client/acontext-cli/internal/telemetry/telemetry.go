@@ -2,21 +2,47 @@ package telemetry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"os/exec"
 	"runtime"
-	"sync"
+	"strings"
 	"time"
 )
 
 const (
-	telemetryEndpoint = "https://telemetry.acontext.io/v1/events"
+	// flushTimeout bounds how long the background flush waits for the endpoint,
+	// events that could not be sent in time stay spooled for the next run
+	flushTimeout = 10 * time.Second
+	// maxFlushEvents is the number of spooled events sent by one flush
+	maxFlushEvents = 100
+	// FlushCommand is the hidden command the CLI runs in the background to send the spool
+	FlushCommand = "__telemetry-flush"
 )
 
+// telemetryEndpoint receives events
+var telemetryEndpoint = "https://telemetry.acontext.io/v1/events"
+
 // telemetryBearerToken is set at build time via ldflags
 var telemetryBearerToken = ""
 
+// startFlush starts the background flush of the spool, replaced in tests
+var startFlush = func() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, FlushCommand)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// The flush outlives the command that started it
+	return cmd.Process.Release()
+}
+
 // Event represents a telemetry event
 type Event struct {
 	Command   string `json:"command"`
@@ -29,56 +55,86 @@ type Event struct {
 	Arch      string `json:"arch"`
 }
 
-// SendEvent sends a telemetry event asynchronously
-func SendEvent(event Event) {
-	// Send in a goroutine to avoid blocking
-	go func() {
-		_ = sendEvent(event)
-		// Silently fail - telemetry should not affect user experience
-	}()
+// Enabled reports whether telemetry is on. It is off unless users opt in with
+// ACONTEXT_TELEMETRY=on (or 1/true/yes), and DO_NOT_TRACK=1 turns it off in any case.
+func Enabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("DO_NOT_TRACK"))) {
+	case "", "0", "false":
+	default:
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("ACONTEXT_TELEMETRY"))) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
 }
 
-// SendEventAsync sends a telemetry event asynchronously and returns a WaitGroup to wait for completion
-func SendEventAsync(event Event) *sync.WaitGroup {
-	var wg sync.WaitGroup
-	wg.Add(1)
-	// Send in a goroutine to avoid blocking
-	go func() {
-		defer wg.Done()
-		_ = sendEvent(event)
-		// Silently fail - telemetry should not affect user experience
-	}()
-	return &wg
-}
+// TrackCommand records a command execution in the local spool and starts a background
+// process sending it along with the events spooled by previous runs, so commands do not
+// wait on the network
+func TrackCommand(command string, success bool, err error, duration time.Duration, version string) {
+	if !Enabled() {
+		return
+	}
 
-// SendEventSync sends a telemetry event synchronously and waits for completion
-func SendEventSync(event Event) error {
-	return sendEvent(event)
+	s, spoolErr := openSpool()
+	if spoolErr != nil {
+		return
+	}
+	if spoolErr := s.append(newEvent(command, success, err, duration, version)); spoolErr != nil {
+		s.recordError(spoolErr)
+		return
+	}
+	if startErr := startFlush(); startErr != nil {
+		// The event is sent by the next run
+		s.recordError(fmt.Errorf("failed to start telemetry flush: %w", startErr))
+	}
 }
 
-// sendEvent actually sends the event to the telemetry endpoint
-func sendEvent(event Event) error {
-	// Set timestamp if not set
-	if event.Timestamp == "" {
-		event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+// Flush sends the spooled events, it is run by FlushCommand. Errors are recorded
+// next to the spool instead of being reported, the command having long returned.
+func Flush() {
+	if !Enabled() {
+		return
+	}
+	s, err := openSpool()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := s.flush(ctx); err != nil {
+		s.recordError(err)
 	}
+}
 
-	// Set system info if not set
-	if event.OS == "" {
-		event.OS = runtime.GOOS
+func newEvent(command string, success bool, err error, duration time.Duration, version string) Event {
+	event := Event{
+		Command:   command,
+		Success:   success,
+		Duration:  duration.Milliseconds(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Version:   version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
 	}
-	if event.Arch == "" {
-		event.Arch = runtime.GOARCH
+
+	if err != nil {
+		event.Error = err.Error()
 	}
 
-	// Marshal event to JSON
+	return event
+}
+
+// sendEvent sends an event to the telemetry endpoint
+func sendEvent(ctx context.Context, event Event) error {
 	jsonData, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", telemetryEndpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telemetryEndpoint, bytes.NewReader(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -91,13 +147,7 @@ func sendEvent(event Event) error {
 		req.Header.Set("Authorization", "Bearer "+telemetryBearerToken)
 	}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	// Send request
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -105,58 +155,8 @@ func sendEvent(event Event) error {
 		_ = resp.Body.Close()
 	}()
 
-	// Check response status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
-
 	return nil
 }
-
-// TrackCommand tracks a command execution
-func TrackCommand(command string, success bool, err error, duration time.Duration, version string) {
-	event := Event{
-		Command:  command,
-		Success:  success,
-		Duration: duration.Milliseconds(),
-		Version:  version,
-	}
-
-	if err != nil {
-		event.Error = err.Error()
-	}
-
-	SendEvent(event)
-}
-
-// TrackCommandAsync tracks a command execution asynchronously and returns a WaitGroup to wait for completion
-func TrackCommandAsync(command string, success bool, err error, duration time.Duration, version string) *sync.WaitGroup {
-	event := Event{
-		Command:  command,
-		Success:  success,
-		Duration: duration.Milliseconds(),
-		Version:  version,
-	}
-
-	if err != nil {
-		event.Error = err.Error()
-	}
-
-	return SendEventAsync(event)
-}
-
-// TrackCommandSync tracks a command execution synchronously and waits for completion
-func TrackCommandSync(command string, success bool, err error, duration time.Duration, version string) error {
-	event := Event{
-		Command:  command,
-		Success:  success,
-		Duration: duration.Milliseconds(),
-		Version:  version,
-	}
-
-	if err != nil {
-		event.Error = err.Error()
-	}
-
-	return SendEventSync(event)
-}
@@ -0,0 +1,213 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEndpoint struct {
+	mu     sync.Mutex
+	status int
+	events []Event
+}
+
+func newFakeEndpoint(t *testing.T, status int) (*fakeEndpoint, *httptest.Server) {
+	e := &fakeEndpoint{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.status < 300 {
+			e.events = append(e.events, event)
+		}
+		w.WriteHeader(e.status)
+	}))
+	t.Cleanup(srv.Close)
+
+	endpoint := telemetryEndpoint
+	telemetryEndpoint = srv.URL
+	t.Cleanup(func() { telemetryEndpoint = endpoint })
+	return e, srv
+}
+
+func testSpool(t *testing.T) *spool {
+	t.Setenv("ACONTEXT_TELEMETRY_DIR", t.TempDir())
+	s, err := openSpool()
+	require.NoError(t, err)
+	return s
+}
+
+func spooled(s *spool) []Event {
+	return readEvents(s.path())
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name       string
+		doNotTrack string
+		telemetry  string
+		expected   bool
+	}{
+		{"off by default", "", "", false},
+		{"opted in", "", "on", true},
+		{"opted in with 1", "", "1", true},
+		{"opted out", "", "off", false},
+		{"do not track wins", "1", "on", false},
+		{"do not track false", "false", "yes", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DO_NOT_TRACK", tt.doNotTrack)
+			t.Setenv("ACONTEXT_TELEMETRY", tt.telemetry)
+			assert.Equal(t, tt.expected, Enabled())
+		})
+	}
+}
+
+func TestSpoolFlush(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends spooled events", func(t *testing.T) {
+		e, _ := newFakeEndpoint(t, http.StatusAccepted)
+		s := testSpool(t)
+		for range maxFlushEvents + 20 {
+			require.NoError(t, s.append(newEvent("create", true, nil, time.Second, "v1.0.0")))
+		}
+
+		// a flush sends at most maxFlushEvents, the next one sends the rest
+		require.NoError(t, s.flush(ctx))
+		require.Len(t, e.events, maxFlushEvents)
+		assert.Equal(t, "create", e.events[0].Command)
+		assert.Len(t, spooled(s), 20)
+		require.NoError(t, s.flush(ctx))
+		assert.Len(t, e.events, maxFlushEvents+20)
+		assert.Empty(t, spooled(s))
+
+		matches, _ := filepath.Glob(filepath.Join(s.dir, "*"))
+		assert.Empty(t, matches)
+	})
+
+	t.Run("keeps events while offline", func(t *testing.T) {
+		e, srv := newFakeEndpoint(t, http.StatusAccepted)
+		srv.Close()
+		s := testSpool(t)
+		require.NoError(t, s.append(newEvent("docker.up", true, nil, 0, "v1.0.0")))
+
+		assert.Error(t, s.flush(ctx))
+		require.Len(t, spooled(s), 1)
+
+		e2, _ := newFakeEndpoint(t, http.StatusOK)
+		require.NoError(t, s.append(newEvent("docker.down", true, nil, 0, "v1.0.0")))
+		require.NoError(t, s.flush(ctx))
+		assert.Empty(t, e.events)
+		require.Len(t, e2.events, 2)
+		assert.Empty(t, spooled(s))
+	})
+
+	t.Run("keeps rejected events", func(t *testing.T) {
+		newFakeEndpoint(t, http.StatusBadRequest)
+		s := testSpool(t)
+		require.NoError(t, s.append(newEvent("create", false, assert.AnError, 0, "v1.0.0")))
+
+		assert.ErrorContains(t, s.flush(ctx), "400")
+		assert.Len(t, spooled(s), 1)
+	})
+
+	t.Run("bounds the spool", func(t *testing.T) {
+		newFakeEndpoint(t, http.StatusServiceUnavailable)
+		s := testSpool(t)
+		events := make([]Event, maxSpoolEvents+5)
+		for i := range events {
+			events[i] = newEvent("create", true, nil, time.Duration(i)*time.Millisecond, "v1.0.0")
+		}
+		require.NoError(t, s.append(events...))
+
+		assert.Error(t, s.flush(ctx))
+		kept := spooled(s)
+		require.Len(t, kept, maxSpoolEvents)
+		assert.Equal(t, events[5].Duration, kept[0].Duration)
+	})
+
+	t.Run("takes over stale claims", func(t *testing.T) {
+		e, _ := newFakeEndpoint(t, http.StatusOK)
+		s := testSpool(t)
+		require.NoError(t, s.append(newEvent("create", true, nil, 0, "v1.0.0")))
+		stale := filepath.Join(s.dir, "telemetry.1.1.1.sending")
+		require.NoError(t, os.Rename(s.path(), stale))
+
+		// a claim being sent by another run is left alone
+		require.NoError(t, s.flush(ctx))
+		assert.Empty(t, e.events)
+		assert.FileExists(t, stale)
+
+		old := time.Now().Add(-2 * staleClaimAge)
+		require.NoError(t, os.Chtimes(stale, old, old))
+		require.NoError(t, s.flush(ctx))
+		require.Len(t, e.events, 1)
+		assert.NoFileExists(t, stale)
+	})
+}
+
+func TestTrackCommand(t *testing.T) {
+	t.Setenv("DO_NOT_TRACK", "")
+	t.Setenv("ACONTEXT_TELEMETRY", "on")
+
+	flushes := 0
+	start := startFlush
+	startFlush = func() error {
+		flushes++
+		return nil
+	}
+	t.Cleanup(func() { startFlush = start })
+
+	t.Run("spools the event and flushes in the background", func(t *testing.T) {
+		e, _ := newFakeEndpoint(t, http.StatusOK)
+		s := testSpool(t)
+
+		TrackCommand("version", true, nil, time.Millisecond, "v1.0.0")
+		assert.Equal(t, 1, flushes)
+		assert.Empty(t, e.events)
+		require.Len(t, spooled(s), 1)
+
+		Flush()
+		require.Len(t, e.events, 1)
+		assert.Equal(t, "version", e.events[0].Command)
+		assert.Empty(t, spooled(s))
+	})
+
+	t.Run("records flush errors", func(t *testing.T) {
+		newFakeEndpoint(t, http.StatusUnauthorized)
+		s := testSpool(t)
+
+		TrackCommand("version", true, nil, time.Millisecond, "v1.0.0")
+		Flush()
+		recorded, err := os.ReadFile(filepath.Join(s.dir, errorFileName))
+		require.NoError(t, err)
+		assert.Contains(t, string(recorded), "401")
+		assert.Len(t, spooled(s), 1)
+	})
+
+	t.Run("not opted in", func(t *testing.T) {
+		e, _ := newFakeEndpoint(t, http.StatusOK)
+		s := testSpool(t)
+		t.Setenv("ACONTEXT_TELEMETRY", "")
+		flushes = 0
+
+		TrackCommand("version", true, nil, time.Millisecond, "v1.0.0")
+		Flush()
+		assert.Zero(t, flushes)
+		assert.Empty(t, e.events)
+		assert.Empty(t, spooled(s))
+	})
+}
@@ -18,6 +18,8 @@ type Config struct {
 	Repo        string
 	Path        string
 	Description string
+	Ref         string // tag, branch or commit to check out, the default branch if empty
+	Checksum    string // expected TreeChecksum of the template files, not verified if empty
 }
 
 // DownloadTemplate downloads template to target directory
@@ -27,6 +29,10 @@ func DownloadTemplate(template *Config, destDir string) error {
 
 // DownloadTemplateWithVars downloads template and replaces template variables
 func DownloadTemplateWithVars(template *Config, destDir string, vars map[string]string) error {
+	if err := validateGitInputs(template); err != nil {
+		return err
+	}
+
 	fmt.Println("📦 Downloading template...")
 
 	// 1. Create temporary directory
@@ -38,37 +44,30 @@ func DownloadTemplateWithVars(template *Config, destDir string, vars map[string]
 		_ = os.RemoveAll(tempDir)
 	}()
 
-	// 2. Sparse clone repository
-	cmd := exec.Command(
-		"git", "clone",
-		"--filter=blob:none",
-		"--sparse",
-		"--quiet",
-		template.Repo,
-		tempDir,
-	)
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
-	if err := cmd.Run(); err != nil {
+	// 2. Clone repository, sparse when the template is a folder of it
+	cloneArgs := []string{"clone", "--filter=blob:none", "--quiet"}
+	if template.Path != "" {
+		cloneArgs = append(cloneArgs, "--sparse")
+	}
+	if err := runGit("", append(cloneArgs, "--", template.Repo, tempDir)...); err != nil {
 		return fmt.Errorf("failed to clone repo: %w", err)
 	}
 
-	// 3. Enable sparse-checkout
-	cmd = exec.Command("git", "sparse-checkout", "init", "--cone")
-	cmd.Dir = tempDir
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to init sparse-checkout: %w", err)
+	// 3. Enable sparse-checkout and set checkout path
+	if template.Path != "" {
+		if err := runGit(tempDir, "sparse-checkout", "init", "--cone"); err != nil {
+			return fmt.Errorf("failed to init sparse-checkout: %w", err)
+		}
+		if err := runGit(tempDir, "sparse-checkout", "set", "--", template.Path); err != nil {
+			return fmt.Errorf("failed to set sparse-checkout: %w", err)
+		}
 	}
 
-	// 4. Set checkout path
-	cmd = exec.Command("git", "sparse-checkout", "set", template.Path)
-	cmd.Dir = tempDir
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set sparse-checkout: %w", err)
+	// 4. Check out the pinned version
+	if template.Ref != "" {
+		if err := runGit(tempDir, "checkout", "--quiet", template.Ref, "--"); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", template.Ref, err)
+		}
 	}
 
 	// 5. Extract template content
@@ -77,6 +76,13 @@ func DownloadTemplateWithVars(template *Config, destDir string, vars map[string]
 		return fmt.Errorf("template path not found: %s", template.Path)
 	}
 
+	if template.Checksum != "" {
+		if err := VerifyChecksum(srcDir, template.Checksum); err != nil {
+			return err
+		}
+		fmt.Println("🔒 Template checksum verified")
+	}
+
 	fmt.Println("📋 Copying template files...")
 	if err := copyDir(srcDir, destDir); err != nil {
 		return fmt.Errorf("failed to copy template: %w", err)
@@ -93,6 +99,37 @@ func DownloadTemplateWithVars(template *Config, destDir string, vars map[string]
 	return nil
 }
 
+// gitRefPattern matches the tags, branches and commits a template may be pinned to
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/+-]*$`)
+
+// validateGitInputs rejects template references git could read as options or that leave the repository,
+// they come from the command line and from registries
+func validateGitInputs(template *Config) error {
+	if template.Repo == "" || strings.HasPrefix(template.Repo, "-") {
+		return fmt.Errorf("invalid template repository: %q", template.Repo)
+	}
+	if template.Ref != "" && (!gitRefPattern.MatchString(template.Ref) || strings.Contains(template.Ref, "..")) {
+		return fmt.Errorf("invalid template version: %q", template.Ref)
+	}
+	if template.Path != "" {
+		for _, elem := range strings.Split(template.Path, "/") {
+			if elem == "" || elem == "." || elem == ".." || strings.HasPrefix(elem, "-") {
+				return fmt.Errorf("invalid template path: %q", template.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// runGit runs a git command in dir, discarding its output
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+	return cmd.Run()
+}
+
 func copyDir(src, dst string) error {
 	// Ensure target directory exists
 	if err := os.MkdirAll(dst, 0755); err != nil {
@@ -114,6 +151,10 @@ func copyDir(src, dst string) error {
 		destPath := filepath.Join(dst, relPath)
 
 		if info.IsDir() {
+			// Templates cloned whole come with the history of their repository
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
 			// Create directory in destination
 			return os.MkdirAll(destPath, info.Mode())
 		}
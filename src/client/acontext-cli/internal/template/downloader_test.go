@@ -181,3 +181,28 @@ version = "0.1.0"
 	require.NoError(t, err)
 	assert.Contains(t, string(packageJsonData), `"name": "my-new-project"`)
 }
+
+func TestValidateGitInputs(t *testing.T) {
+	valid := []Config{
+		{Repo: "https://github.com/acme/kits"},
+		{Repo: "git@github.com:acme/kits.git", Path: "python/bot", Ref: "v1.2.0"},
+		{Repo: "./kits", Ref: "release/1.x"},
+		{Repo: "https://github.com/acme/kits", Ref: "3f9c2a1"},
+	}
+	for _, cfg := range valid {
+		assert.NoError(t, validateGitInputs(&cfg), "%+v", cfg)
+	}
+
+	invalid := []Config{
+		{Repo: ""},
+		{Repo: "--upload-pack=touch /tmp/pwned"},
+		{Repo: "https://github.com/acme/kits", Ref: "--orphan=x"},
+		{Repo: "https://github.com/acme/kits", Ref: "main..dev"},
+		{Repo: "https://github.com/acme/kits", Ref: "v1 --force"},
+		{Repo: "https://github.com/acme/kits", Path: "../outside"},
+		{Repo: "https://github.com/acme/kits", Path: "python/--bot"},
+	}
+	for _, cfg := range invalid {
+		assert.Error(t, validateGitInputs(&cfg), "%+v", cfg)
+	}
+}
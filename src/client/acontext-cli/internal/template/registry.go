@@ -0,0 +1,108 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RegistryIndex lists the templates published to a registry
+type RegistryIndex struct {
+	Templates []RegistryTemplate `json:"templates"`
+}
+
+// RegistryTemplate is a template of a registry and its published versions, newest first
+type RegistryTemplate struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Repo        string            `json:"repo"`
+	Path        string            `json:"path"`
+	Versions    []RegistryVersion `json:"versions"`
+}
+
+// RegistryVersion pins a version of a template to a git ref and the checksum of its files
+type RegistryVersion struct {
+	Version  string `json:"version"`
+	Ref      string `json:"ref"`
+	Checksum string `json:"checksum"`
+}
+
+// LoadRegistry reads a registry index from an http(s) URL or a local file
+func LoadRegistry(location string) (*RegistryIndex, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err = fetchRegistry(location)
+	} else {
+		data, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template registry %s: %w", location, err)
+	}
+
+	var index RegistryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse template registry %s: %w", location, err)
+	}
+	return &index, nil
+}
+
+func fetchRegistry(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+}
+
+// Resolve returns the template config of name at version, the newest version if version is empty
+func (r *RegistryIndex) Resolve(name, version string) (*Config, error) {
+	for _, t := range r.Templates {
+		if t.Name != name {
+			continue
+		}
+		if len(t.Versions) == 0 {
+			return nil, fmt.Errorf("template %s has no published version", name)
+		}
+
+		v := t.Versions[0]
+		if version != "" {
+			found := false
+			for _, candidate := range t.Versions {
+				if candidate.Version == version || "v"+candidate.Version == version || candidate.Version == "v"+version {
+					v, found = candidate, true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("template %s has no version %s", name, version)
+			}
+		}
+
+		return &Config{
+			Repo:        t.Repo,
+			Path:        t.Path,
+			Description: fmt.Sprintf("%s %s", t.Name, v.Version),
+			Ref:         v.Ref,
+			Checksum:    v.Checksum,
+		}, nil
+	}
+	return nil, fmt.Errorf("template %s not found in registry", name)
+}
+
+// ParseRegistryRef splits a registry template reference name[@version]
+func ParseRegistryRef(ref string) (name, version string) {
+	name, version, _ = strings.Cut(ref, "@")
+	return name, version
+}
@@ -0,0 +1,88 @@
+package template
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistry = `{"templates": [{
+	"name": "support-bot",
+	"description": "Support bot",
+	"repo": "https://github.com/acme/kits",
+	"path": "python/support-bot",
+	"versions": [
+		{"version": "1.2.0", "ref": "v1.2.0", "checksum": "sha256:bbb"},
+		{"version": "1.1.0", "ref": "v1.1.0", "checksum": "sha256:aaa"}
+	]
+}]}`
+
+func TestLoadRegistry(t *testing.T) {
+	t.Run("local file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "registry.json")
+		require.NoError(t, os.WriteFile(path, []byte(testRegistry), 0644))
+
+		index, err := LoadRegistry(path)
+		require.NoError(t, err)
+		require.Len(t, index.Templates, 1)
+		assert.Equal(t, "support-bot", index.Templates[0].Name)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(testRegistry))
+		}))
+		defer srv.Close()
+
+		index, err := LoadRegistry(srv.URL)
+		require.NoError(t, err)
+		assert.Len(t, index.Templates, 1)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		_, err := LoadRegistry(srv.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestRegistryResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, os.WriteFile(path, []byte(testRegistry), 0644))
+	index, err := LoadRegistry(path)
+	require.NoError(t, err)
+
+	latest, err := index.Resolve("support-bot", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/acme/kits", latest.Repo)
+	assert.Equal(t, "python/support-bot", latest.Path)
+	assert.Equal(t, "v1.2.0", latest.Ref)
+	assert.Equal(t, "sha256:bbb", latest.Checksum)
+
+	pinned, err := index.Resolve("support-bot", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", pinned.Ref)
+	assert.Equal(t, "sha256:aaa", pinned.Checksum)
+
+	_, err = index.Resolve("support-bot", "2.0.0")
+	assert.ErrorContains(t, err, "no version 2.0.0")
+	_, err = index.Resolve("unknown", "")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestParseRegistryRef(t *testing.T) {
+	name, version := ParseRegistryRef("support-bot@1.2.0")
+	assert.Equal(t, "support-bot", name)
+	assert.Equal(t, "1.2.0", version)
+
+	name, version = ParseRegistryRef("support-bot")
+	assert.Equal(t, "support-bot", name)
+	assert.Empty(t, version)
+}
@@ -0,0 +1,121 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const checksumPrefix = "sha256:"
+
+// IsRemoteRef reports whether ref points at a git repository rather than a registry template
+func IsRemoteRef(ref string) bool {
+	return strings.Contains(ref, "://") ||
+		strings.HasPrefix(ref, "git@") ||
+		strings.HasPrefix(ref, "/") ||
+		strings.HasPrefix(ref, "./") ||
+		strings.HasPrefix(ref, "../")
+}
+
+// ParseRemote parses a template in a git repository, referenced as <repo>[//<folder>][@<ref>], e.g.
+//
+//	https://github.com/acme/agent-kits//python/support-bot@v1.2.0
+func ParseRemote(ref string) (*Config, error) {
+	cfg := &Config{}
+	rest := ref
+
+	// A ref follows the last @ of the last path element, so that git@host URLs keep theirs
+	if at := strings.LastIndex(rest, "@"); at > strings.LastIndex(rest, "/") && strings.Contains(rest[:at], "/") {
+		rest, cfg.Ref = rest[:at], rest[at+1:]
+		if cfg.Ref == "" {
+			return nil, fmt.Errorf("empty version in template reference: %s", ref)
+		}
+	}
+
+	schemeEnd := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		schemeEnd = i + len("://")
+	}
+	if i := strings.Index(rest[schemeEnd:], "//"); i >= 0 {
+		cfg.Path = strings.Trim(rest[schemeEnd+i+2:], "/")
+		rest = rest[:schemeEnd+i]
+	}
+	cfg.Repo = rest
+	if cfg.Repo == "" {
+		return nil, fmt.Errorf("empty repository in template reference: %s", ref)
+	}
+
+	cfg.Description = fmt.Sprintf("Template from %s", ref)
+	return cfg, nil
+}
+
+// TreeChecksum hashes the files of a template folder, their paths and contents, ignoring .git.
+// It is how registries and users pin the exact content of a template version.
+func TreeChecksum(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var sum string
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			sum = "link:" + target
+		} else {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			fh := sha256.New()
+			_, err = io.Copy(fh, f)
+			_ = f.Close()
+			if err != nil {
+				return err
+			}
+			sum = hex.EncodeToString(fh.Sum(nil))
+		}
+
+		// WalkDir visits files in lexical order, so the checksum does not depend on the file system
+		_, err = fmt.Fprintf(h, "%s\x00%s\n", filepath.ToSlash(rel), sum)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash template: %w", err)
+	}
+	return checksumPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChecksum fails unless the TreeChecksum of dir is expected
+func VerifyChecksum(dir, expected string) error {
+	if !strings.HasPrefix(expected, checksumPrefix) {
+		expected = checksumPrefix + expected
+	}
+	actual, err := TreeChecksum(dir)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("template checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
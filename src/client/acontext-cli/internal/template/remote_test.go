@@ -0,0 +1,147 @@
+package template
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "https repository",
+			ref:  "https://github.com/acme/kits",
+			want: Config{Repo: "https://github.com/acme/kits"},
+		},
+		{
+			name: "folder and version",
+			ref:  "https://github.com/acme/kits//python/support-bot@v1.2.0",
+			want: Config{Repo: "https://github.com/acme/kits", Path: "python/support-bot", Ref: "v1.2.0"},
+		},
+		{
+			name: "ssh repository keeps its user",
+			ref:  "git@github.com:acme/kits.git",
+			want: Config{Repo: "git@github.com:acme/kits.git"},
+		},
+		{
+			name: "ssh repository with folder and version",
+			ref:  "git@github.com:acme/kits.git//bot@abc123",
+			want: Config{Repo: "git@github.com:acme/kits.git", Path: "bot", Ref: "abc123"},
+		},
+		{
+			name: "local repository",
+			ref:  "/tmp/kits//bot",
+			want: Config{Repo: "/tmp/kits", Path: "bot"},
+		},
+		{
+			name:    "empty version",
+			ref:     "https://github.com/acme/kits@",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRemote(tt.ref)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Repo, got.Repo)
+			assert.Equal(t, tt.want.Path, got.Path)
+			assert.Equal(t, tt.want.Ref, got.Ref)
+		})
+	}
+}
+
+func TestIsRemoteRef(t *testing.T) {
+	assert.True(t, IsRemoteRef("https://github.com/acme/kits"))
+	assert.True(t, IsRemoteRef("git@github.com:acme/kits.git"))
+	assert.True(t, IsRemoteRef("./kits"))
+	assert.False(t, IsRemoteRef("support-bot@1.2.0"))
+}
+
+func TestTreeChecksum(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Kit\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.py"), []byte("print('hi')\n"), 0644))
+
+	sum, err := TreeChecksum(dir)
+	require.NoError(t, err)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, sum)
+
+	// .git is ignored
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644))
+	again, err := TreeChecksum(dir)
+	require.NoError(t, err)
+	assert.Equal(t, sum, again)
+	assert.NoError(t, VerifyChecksum(dir, sum))
+	assert.NoError(t, VerifyChecksum(dir, sum[len("sha256:"):]))
+
+	// renames and edits change it
+	require.NoError(t, os.Rename(filepath.Join(dir, "src", "main.py"), filepath.Join(dir, "src", "app.py")))
+	renamed, err := TreeChecksum(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, sum, renamed)
+	assert.ErrorContains(t, VerifyChecksum(dir, sum), "checksum mismatch")
+}
+
+func TestDownloadTemplatePinned(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// A repository with a template folder tagged v1 then changed
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	kit := filepath.Join(repo, "python", "bot")
+	require.NoError(t, os.MkdirAll(kit, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(kit, "main.py"), []byte("v1\n"), 0644))
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "v1")
+	git("tag", "v1")
+	v1, err := TreeChecksum(kit)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(kit, "main.py"), []byte("v2\n"), 0644))
+	git("commit", "--quiet", "-am", "v2")
+
+	t.Run("checks out the pinned version", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "app")
+		require.NoError(t, DownloadTemplate(&Config{Repo: repo, Path: "python/bot", Ref: "v1", Checksum: v1}, dest))
+		content, err := os.ReadFile(filepath.Join(dest, "main.py"))
+		require.NoError(t, err)
+		assert.Equal(t, "v1\n", string(content))
+	})
+
+	t.Run("rejects a checksum mismatch", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "app")
+		err := DownloadTemplate(&Config{Repo: repo, Path: "python/bot", Checksum: v1}, dest)
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.NoFileExists(t, filepath.Join(dest, "main.py"))
+	})
+
+	t.Run("whole repository without its history", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "app")
+		require.NoError(t, DownloadTemplate(&Config{Repo: repo}, dest))
+		assert.FileExists(t, filepath.Join(dest, "python", "bot", "main.py"))
+		assert.NoDirExists(t, filepath.Join(dest, ".git"))
+	})
+}
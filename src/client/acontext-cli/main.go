@@ -21,7 +21,7 @@ var version = "dev"
 
 func main() {
 	// Print logo on first run
-	if len(os.Args) > 1 && os.Args[1] != "--help" && os.Args[1] != "-h" {
+	if len(os.Args) > 1 && os.Args[1] != "--help" && os.Args[1] != "-h" && os.Args[1] != telemetry.FlushCommand {
 		fmt.Println(logo.Logo)
 	}
 
@@ -31,15 +31,16 @@ func main() {
 		if executedCmd == nil {
 			executedCmd = rootCmd
 		}
-		trackCommandAndWait(executedCmd, cmdErr, false)
+		trackCommand(executedCmd, cmdErr, false)
 		os.Exit(1)
 	}
 }
 
-// trackCommandAndWait tracks a command execution asynchronously and waits for completion
-func trackCommandAndWait(cmd *cobra.Command, err error, success bool) {
-	// Skip telemetry for dev version
-	if version == "dev" {
+// trackCommand spools the command execution for telemetry, a background process sends it
+// with the events left by previous runs
+func trackCommand(cmd *cobra.Command, err error, success bool) {
+	// Skip telemetry for dev version and for the flush itself
+	if version == "dev" || cmd == telemetryFlushCmd {
 		return
 	}
 
@@ -53,33 +54,13 @@ func trackCommandAndWait(cmd *cobra.Command, err error, success bool) {
 		duration = time.Since(startTime)
 	}
 
-	// Build command path
-	commandPath := buildCommandPath(cmd)
-
-	// Start async telemetry tracking and wait for completion
-	// This ensures telemetry is sent even for blocking commands
-	wg := telemetry.TrackCommandAsync(
-		commandPath,
+	telemetry.TrackCommand(
+		buildCommandPath(cmd),
 		success,
 		err,
 		duration,
 		version,
 	)
-
-	// Wait for telemetry to complete (with timeout to avoid hanging forever)
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	// Wait up to 5 seconds for telemetry to complete
-	select {
-	case <-done:
-		// Telemetry completed successfully
-	case <-time.After(5 * time.Second):
-		// Timeout - don't block forever
-	}
 }
 
 // buildCommandPath builds the full command path (e.g., "docker.up", "create")
@@ -120,7 +101,7 @@ Get started by running: acontext create
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
 		// Track successful command execution
 		// This is called after the command's Run/RunE completes successfully
-		trackCommandAndWait(cmd, nil, true)
+		trackCommand(cmd, nil, true)
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -142,6 +123,17 @@ func init() {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(cmd.CreateCmd)
 	rootCmd.AddCommand(cmd.DockerCmd)
+	rootCmd.AddCommand(cmd.TemplateCmd)
+	rootCmd.AddCommand(telemetryFlushCmd)
+}
+
+// telemetryFlushCmd sends the telemetry spool, it is started in the background by trackCommand
+var telemetryFlushCmd = &cobra.Command{
+	Use:    telemetry.FlushCommand,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		telemetry.Flush()
+	},
 }
 
 var versionCmd = &cobra.Command{
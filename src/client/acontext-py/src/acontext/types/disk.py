@@ -48,6 +48,7 @@ class GetArtifactResp(BaseModel):
 
     artifact: Artifact = Field(..., description="Artifact information")
     public_url: str | None = Field(None, description="Presigned URL for downloading the artifact")
+    expire_at: str | None = Field(None, description="Expiration time of public_url in ISO 8601 format")
     content: FileContent | None = Field(None, description="Parsed file content if available")
 
 
@@ -14,6 +14,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -26,10 +28,14 @@ import (
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/infra/cache"
 	dbpkg "github.com/memodb-io/Acontext/internal/infra/db"
+	"github.com/memodb-io/Acontext/internal/infra/incident"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
+	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
 	"github.com/memodb-io/Acontext/internal/router"
 	"github.com/memodb-io/Acontext/internal/telemetry"
+	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
 	"github.com/samber/do"
 	"go.uber.org/zap"
@@ -37,6 +43,9 @@ import (
 )
 
 func main() {
+	skipPreflight := flag.Bool("skip-preflight", false, "start without checking the database schema, S3 bucket and MQ exchanges")
+	flag.Parse()
+
 	// build dependency injection container
 	inj := bootstrap.BuildContainer()
 
@@ -50,6 +59,13 @@ func main() {
 		log.Sugar().Fatalw("failed to initialize tokenizer", "err", err)
 	}
 
+	// fail fast on a broken deployment rather than on the first request
+	if *skipPreflight {
+		log.Sugar().Warn("preflight checks skipped")
+	} else if err := bootstrap.Preflight(context.Background(), inj); err != nil {
+		log.Sugar().Fatalw("preflight checks failed, fix them or start with --skip-preflight", "err", err)
+	}
+
 	// Setup OpenTelemetry tracing (using configuration system)
 	tp, err := telemetry.SetupTracing(cfg)
 	if err != nil {
@@ -90,18 +106,440 @@ func main() {
 	artifactHandler := do.MustInvoke[*handler.ArtifactHandler](inj)
 	taskHandler := do.MustInvoke[*handler.TaskHandler](inj)
 	toolHandler := do.MustInvoke[*handler.ToolHandler](inj)
+	embeddingHandler := do.MustInvoke[*handler.EmbeddingHandler](inj)
+	chunkHandler := do.MustInvoke[*handler.ChunkHandler](inj)
+	subscriptionHandler := do.MustInvoke[*handler.SubscriptionHandler](inj)
+	freshnessHandler := do.MustInvoke[*handler.FreshnessHandler](inj)
+	syncRuleHandler := do.MustInvoke[*handler.SyncRuleHandler](inj)
+	assetHandler := do.MustInvoke[*handler.AssetHandler](inj)
+	partTransformHandler := do.MustInvoke[*handler.PartTransformHandler](inj)
+	windowPresetHandler := do.MustInvoke[*handler.WindowPresetHandler](inj)
+	retentionHandler := do.MustInvoke[*handler.RetentionHandler](inj)
+	annotationHandler := do.MustInvoke[*handler.AnnotationHandler](inj)
+	notificationHandler := do.MustInvoke[*handler.NotificationHandler](inj)
+	blockEventHandler := do.MustInvoke[*handler.BlockEventHandler](inj)
+	ingestAlertHandler := do.MustInvoke[*handler.IngestAlertHandler](inj)
+	quotaHandler := do.MustInvoke[*handler.QuotaHandler](inj)
+	rateLimitHandler := do.MustInvoke[*handler.RateLimitHandler](inj)
+	entityLimitHandler := do.MustInvoke[*handler.EntityLimitHandler](inj)
+	authGuard := do.MustInvoke[service.AuthGuardService](inj)
+	incidentReporter := do.MustInvoke[*incident.Reporter](inj)
+	networkAccessHandler := do.MustInvoke[*handler.NetworkAccessHandler](inj)
+	redactionHandler := do.MustInvoke[*handler.RedactionHandler](inj)
+	sessionConfigSchemaHandler := do.MustInvoke[*handler.SessionConfigSchemaHandler](inj)
+	presignPolicyHandler := do.MustInvoke[*handler.PresignPolicyHandler](inj)
+	applyHandler := do.MustInvoke[*handler.ApplyHandler](inj)
+	projectKeyHandler := do.MustInvoke[*handler.ProjectKeyHandler](inj)
+	toolCallHandler := do.MustInvoke[*handler.ToolCallHandler](inj)
+	adminHandler := do.MustInvoke[*handler.AdminHandler](inj)
+	deprecationHandler := do.MustInvoke[*handler.DeprecationHandler](inj)
+	debugHandler := do.MustInvoke[*handler.DebugHandler](inj)
+
+	// background workers stop with the server
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// fan out persisted session messages to websocket subscribers of this instance
+	messageConsumer, err := mq.NewBroadcastConsumer(
+		do.MustInvoke[*amqp.Connection](inj),
+		cfg.RabbitMQ.ExchangeName.SessionMessage,
+		cfg.RabbitMQ.RoutingKey.SessionMessageInsert,
+		log,
+		cfg,
+	)
+	if err != nil {
+		log.Sugar().Warnw("failed to start session message consumer, message subscriptions will not receive events", "err", err)
+	} else {
+		hub := do.MustInvoke[*service.MessageHub](inj)
+		go func() {
+			if err := messageConsumer.Handle(bgCtx, hub.HandleDelivery); err != nil && !errors.Is(err, context.Canceled) {
+				log.Sugar().Errorw("session message consumer stopped", "err", err)
+			}
+		}()
+	}
+
+	// copy session messages matching the sync rules of their space into pages, once across instances
+	syncConsumer, err := mq.NewBoundConsumer(
+		do.MustInvoke[*amqp.Connection](inj),
+		cfg.RabbitMQ.QueueName.SpaceSync,
+		cfg.RabbitMQ.ExchangeName.SessionMessage,
+		cfg.RabbitMQ.RoutingKey.SessionMessageInsert,
+		log,
+		cfg,
+	)
+	if err != nil {
+		log.Sugar().Warnw("failed to start space sync consumer, sync rules will not be applied", "err", err)
+	} else {
+		postIngestSvc := do.MustInvoke[service.PostIngestService](inj)
+		go func() {
+			err := syncConsumer.Handle(bgCtx, func(body []byte) error {
+				return postIngestSvc.HandleDelivery(bgCtx, service.ProcessorSpaceSync, body)
+			})
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Sugar().Errorw("space sync consumer stopped", "err", err)
+			}
+		}()
+	}
+
+	// keep rolling session summaries, only when an LLM provider is configured
+	if cfg.LLM.Provider != "" {
+		summaryConsumer, err := mq.NewBoundConsumer(
+			do.MustInvoke[*amqp.Connection](inj),
+			cfg.RabbitMQ.QueueName.SessionSummary,
+			cfg.RabbitMQ.ExchangeName.SessionMessage,
+			cfg.RabbitMQ.RoutingKey.SessionMessageInsert,
+			log,
+			cfg,
+		)
+		if err != nil {
+			log.Sugar().Warnw("failed to start session summary consumer, sessions will not be summarized", "err", err)
+		} else {
+			postIngestSvc := do.MustInvoke[service.PostIngestService](inj)
+			go func() {
+				err := summaryConsumer.Handle(bgCtx, func(body []byte) error {
+					return postIngestSvc.HandleDelivery(bgCtx, service.ProcessorSummary, body)
+				})
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Sugar().Errorw("session summary consumer stopped", "err", err)
+				}
+			}()
+		}
+	}
+
+	// embed new messages, only when message embedding is enabled
+	if cfg.Embedding.Messages {
+		embeddingConsumer, err := mq.NewBoundConsumer(
+			do.MustInvoke[*amqp.Connection](inj),
+			cfg.RabbitMQ.QueueName.MessageEmbedding,
+			cfg.RabbitMQ.ExchangeName.SessionMessage,
+			cfg.RabbitMQ.RoutingKey.SessionMessageInsert,
+			log,
+			cfg,
+		)
+		if err != nil {
+			log.Sugar().Warnw("failed to start message embedding consumer, messages will not be embedded", "err", err)
+		} else {
+			postIngestSvc := do.MustInvoke[service.PostIngestService](inj)
+			go func() {
+				err := embeddingConsumer.Handle(bgCtx, func(body []byte) error {
+					return postIngestSvc.HandleDelivery(bgCtx, service.ProcessorEmbedding, body)
+				})
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Sugar().Errorw("message embedding consumer stopped", "err", err)
+				}
+			}()
+		}
+	}
+
+	// label new messages, only when an LLM provider and labels are configured
+	if cfg.LLM.Provider != "" && len(cfg.Classify.Labels) > 0 {
+		classifyConsumer, err := mq.NewBoundConsumer(
+			do.MustInvoke[*amqp.Connection](inj),
+			cfg.RabbitMQ.QueueName.MessageClassify,
+			cfg.RabbitMQ.ExchangeName.SessionMessage,
+			cfg.RabbitMQ.RoutingKey.SessionMessageInsert,
+			log,
+			cfg,
+		)
+		if err != nil {
+			log.Sugar().Warnw("failed to start message classification consumer, messages will not be labeled", "err", err)
+		} else {
+			postIngestSvc := do.MustInvoke[service.PostIngestService](inj)
+			go func() {
+				err := classifyConsumer.Handle(bgCtx, func(body []byte) error {
+					return postIngestSvc.HandleDelivery(bgCtx, service.ProcessorClassify, body)
+				})
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Sugar().Errorw("message classification consumer stopped", "err", err)
+				}
+			}()
+		}
+	}
+
+	// post block events to the block webhooks of their project, once across instances
+	blockWebhookConsumer, err := mq.NewBoundConsumer(
+		do.MustInvoke[*amqp.Connection](inj),
+		cfg.RabbitMQ.QueueName.BlockWebhook,
+		cfg.RabbitMQ.ExchangeName.BlockEvent,
+		cfg.RabbitMQ.RoutingKey.BlockEventChange,
+		log,
+		cfg,
+	)
+	if err != nil {
+		log.Sugar().Warnw("failed to start block webhook consumer, block events will not be posted to webhooks", "err", err)
+	} else {
+		blockEventSvc := do.MustInvoke[service.BlockEventService](inj)
+		go func() {
+			err := blockWebhookConsumer.Handle(bgCtx, func(body []byte) error {
+				return blockEventSvc.HandleDelivery(bgCtx, body)
+			})
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Sugar().Errorw("block webhook consumer stopped", "err", err)
+			}
+		}()
+	}
+
+	// store scheduled messages at their delivery time, once across instances
+	scheduledConsumer, err := mq.NewConsumer(
+		do.MustInvoke[*amqp.Connection](inj),
+		cfg.RabbitMQ.QueueName.ScheduledMessage,
+		cfg.RabbitMQ.Prefetch,
+		log,
+		cfg,
+	)
+	if err != nil {
+		log.Sugar().Warnw("failed to start scheduled message consumer, scheduled messages will not be delivered", "err", err)
+	} else {
+		sessionSvc := do.MustInvoke[service.SessionService](inj)
+		go func() {
+			err := scheduledConsumer.Handle(bgCtx, func(body []byte) error {
+				return sessionSvc.HandleScheduledDelivery(bgCtx, body)
+			})
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Sugar().Errorw("scheduled message consumer stopped", "err", err)
+			}
+		}()
+	}
+
+	// periodically flag blocks and artifacts that were not verified within the max age
+	if cfg.Freshness.ScanIntervalSec > 0 {
+		freshnessSvc := do.MustInvoke[service.FreshnessService](inj)
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Freshness.ScanIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					out, err := freshnessSvc.Scan(bgCtx, service.ScanStaleInput{})
+					if err != nil {
+						log.Sugar().Errorw("freshness scan failed", "err", err)
+						continue
+					}
+					log.Sugar().Infow("freshness scan", "flagged", out.Flagged, "cutoff", out.Cutoff)
+				}
+			}
+		}()
+	}
+
+	// periodically purge the artifacts trashed for longer than the retention window and the expired uploads
+	if cfg.Artifact.PurgeIntervalSec > 0 {
+		artifactSvc := do.MustInvoke[service.ArtifactService](inj)
+		retention := time.Duration(cfg.Artifact.TrashRetentionDays) * 24 * time.Hour
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Artifact.PurgeIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					purged, err := artifactSvc.PurgeTrash(bgCtx, time.Now().Add(-retention))
+					if err != nil {
+						log.Sugar().Errorw("artifact trash purge failed", "err", err, "purged", purged)
+					} else if purged > 0 {
+						log.Sugar().Infow("artifact trash purge", "purged", purged)
+					}
+					// drop the direct uploads that were never finalized, with their parts and content
+					dropped, err := artifactSvc.PurgeExpiredUploads(bgCtx, time.Now())
+					if err != nil {
+						log.Sugar().Errorw("artifact upload purge failed", "err", err, "dropped", dropped)
+					} else if dropped > 0 {
+						log.Sugar().Infow("artifact upload purge", "dropped", dropped)
+					}
+				}
+			}
+		}()
+	}
+
+	// periodically check the content of completed multipart uploads and create their artifacts, from one instance at
+	// a time so the content of an upload is read once
+	if cfg.Artifact.CheckUploadsIntervalSec > 0 {
+		artifactSvc := do.MustInvoke[service.ArtifactService](inj)
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Artifact.CheckUploadsIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					unlock, ok, err := dbpkg.TryAdvisoryLock(bgCtx, db, service.ArtifactUploadCheckLockKey)
+					if err != nil {
+						log.Sugar().Errorw("artifact upload check lock failed", "err", err)
+						continue
+					}
+					if !ok {
+						continue
+					}
+					created, err := artifactSvc.CheckUploads(bgCtx)
+					unlock()
+					if err != nil {
+						log.Sugar().Errorw("artifact upload check failed", "err", err, "created", created)
+					} else if created > 0 {
+						log.Sugar().Infow("artifact upload check", "created", created)
+					}
+				}
+			}
+		}()
+	}
+
+	// periodically archive or delete the idle sessions of projects with a retention policy
+	if cfg.Retention.ReapIntervalSec > 0 {
+		retentionSvc := do.MustInvoke[service.RetentionService](inj)
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Retention.ReapIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					// another instance may be reaping, it would delete the same sessions
+					unlock, ok, err := dbpkg.TryAdvisoryLock(bgCtx, db, service.RetentionReapLockKey)
+					if err != nil {
+						log.Sugar().Errorw("session retention lock failed", "err", err)
+						continue
+					}
+					if !ok {
+						continue
+					}
+					out, err := retentionSvc.Reap(bgCtx, time.Now())
+					unlock()
+					if err != nil {
+						log.Sugar().Errorw("session retention failed", "err", err)
+						continue
+					}
+					if out.Archived > 0 || out.Deleted > 0 || out.Failed > 0 {
+						log.Sugar().Infow("session retention", "projects", out.Projects, "archived", out.Archived, "deleted", out.Deleted, "failed", out.Failed)
+					}
+				}
+			}
+		}()
+	}
+
+	// periodically compare the ingest of projects with ingest alerts against their baseline
+	if cfg.Alert.CheckIntervalSec > 0 {
+		ingestAlertSvc := do.MustInvoke[service.IngestAlertService](inj)
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Alert.CheckIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					// another instance may be checking, it would notify the same alerts
+					unlock, ok, err := dbpkg.TryAdvisoryLock(bgCtx, db, service.IngestAlertCheckLockKey)
+					if err != nil {
+						log.Sugar().Errorw("ingest alert check lock failed", "err", err)
+						continue
+					}
+					if !ok {
+						continue
+					}
+					out, err := ingestAlertSvc.Check(bgCtx, time.Now())
+					unlock()
+					if err != nil {
+						log.Sugar().Errorw("ingest alert check failed", "err", err)
+						continue
+					}
+					if out.Alerts > 0 {
+						log.Sugar().Infow("ingest alerts", "projects", out.Projects, "alerts", out.Alerts)
+					}
+				}
+			}
+		}()
+	}
+
+	// periodically publish the recorded block changes as block events, from one instance at a time so they keep their order
+	if cfg.BlockEvent.RelayIntervalSec > 0 {
+		blockEventSvc := do.MustInvoke[service.BlockEventService](inj)
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.BlockEvent.RelayIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					unlock, ok, err := dbpkg.TryAdvisoryLock(bgCtx, db, service.BlockEventRelayLockKey)
+					if err != nil {
+						log.Sugar().Errorw("block event relay lock failed", "err", err)
+						continue
+					}
+					if !ok {
+						continue
+					}
+					published, err := blockEventSvc.Relay(bgCtx)
+					unlock()
+					if err != nil {
+						log.Sugar().Errorw("block event relay failed", "err", err, "published", published)
+					}
+				}
+			}
+		}()
+	}
+
+	// periodically write the counted calls to deprecated endpoints, the rest is written on shutdown
+	deprecationSvc := do.MustInvoke[service.DeprecationService](inj)
+	if cfg.Deprecation.FlushIntervalSec > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Deprecation.FlushIntervalSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-bgCtx.Done():
+					return
+				case <-ticker.C:
+					if err := deprecationSvc.Flush(bgCtx); err != nil {
+						log.Sugar().Errorw("deprecated calls flush failed", "err", err)
+					}
+				}
+			}
+		}()
+	}
 
 	engine := router.NewRouter(router.RouterDeps{
-		Config:          cfg,
-		DB:              db,
-		Log:             log,
-		SpaceHandler:    spaceHandler,
-		BlockHandler:    blockHandler,
-		SessionHandler:  sessionHandler,
-		DiskHandler:     diskHandler,
-		ArtifactHandler: artifactHandler,
-		TaskHandler:     taskHandler,
-		ToolHandler:     toolHandler,
+		Config:                     cfg,
+		DB:                         db,
+		Log:                        log,
+		IncidentReporter:           incidentReporter,
+		AuthGuard:                  authGuard,
+		SpaceHandler:               spaceHandler,
+		BlockHandler:               blockHandler,
+		SessionHandler:             sessionHandler,
+		DiskHandler:                diskHandler,
+		ArtifactHandler:            artifactHandler,
+		TaskHandler:                taskHandler,
+		ToolHandler:                toolHandler,
+		ToolCallHandler:            toolCallHandler,
+		EmbeddingHandler:           embeddingHandler,
+		ChunkHandler:               chunkHandler,
+		SubscriptionHandler:        subscriptionHandler,
+		FreshnessHandler:           freshnessHandler,
+		SyncRuleHandler:            syncRuleHandler,
+		AssetHandler:               assetHandler,
+		PartTransformHandler:       partTransformHandler,
+		WindowPresetHandler:        windowPresetHandler,
+		RetentionHandler:           retentionHandler,
+		AnnotationHandler:          annotationHandler,
+		NotificationHandler:        notificationHandler,
+		BlockEventHandler:          blockEventHandler,
+		IngestAlertHandler:         ingestAlertHandler,
+		QuotaHandler:               quotaHandler,
+		RateLimitHandler:           rateLimitHandler,
+		EntityLimitHandler:         entityLimitHandler,
+		NetworkAccessHandler:       networkAccessHandler,
+		RedactionHandler:           redactionHandler,
+		SessionConfigSchemaHandler: sessionConfigSchemaHandler,
+		PresignPolicyHandler:       presignPolicyHandler,
+		ApplyHandler:               applyHandler,
+		ProjectKeyHandler:          projectKeyHandler,
+		AdminHandler:               adminHandler,
+		DeprecationHandler:         deprecationHandler,
+		DebugHandler:               debugHandler,
 	})
 
 	addr := fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port)
@@ -126,5 +564,8 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Sugar().Errorw("server shutdown", "err", err)
 	}
+	if err := deprecationSvc.Flush(ctx); err != nil {
+		log.Sugar().Errorw("deprecated calls flush failed", "err", err)
+	}
 	log.Sugar().Info("server exited")
 }
@@ -8,7 +8,10 @@ import (
 	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/infra/cache"
 	"github.com/memodb-io/Acontext/internal/infra/db"
+	"github.com/memodb-io/Acontext/internal/infra/envelope"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/infra/incident"
+	"github.com/memodb-io/Acontext/internal/infra/llm"
 	"github.com/memodb-io/Acontext/internal/infra/logger"
 	mq "github.com/memodb-io/Acontext/internal/infra/queue"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
@@ -46,21 +49,24 @@ func BuildContainer() *do.Injector {
 		}
 		// [optional] auto migrate
 		if cfg.Database.AutoMigrate {
-			_ = d.AutoMigrate(
-				&model.Project{},
-				&model.Space{},
-				&model.Session{},
-				&model.Task{},
-				&model.Message{},
-				&model.Block{},
-				&model.Disk{},
-				&model.Artifact{},
-				&model.AssetReference{},
-				&model.ToolReference{},
-				&model.ToolSOP{},
-				&model.ExperienceConfirmation{},
-				&model.Metric{},
-			)
+			_ = d.AutoMigrate(Models()...)
+			// the path of trashed artifacts can be reused, only live artifacts are unique now
+			if d.Migrator().HasIndex(&model.Artifact{}, "idx_disk_path_filename") {
+				_ = d.Migrator().DropIndex(&model.Artifact{}, "idx_disk_path_filename")
+			}
+			// sessions with messages stored before the session counters get them counted once
+			_ = d.Exec(`UPDATE sessions SET message_count = m.n, last_message_at = m.last, total_bytes = m.bytes
+				FROM (SELECT session_id, COUNT(*) AS n, MAX(created_at) AS last, SUM(size_b) AS bytes FROM messages
+					WHERE session_id IN (SELECT id FROM sessions WHERE last_message_at IS NULL) GROUP BY session_id) m
+				WHERE sessions.id = m.session_id`).Error
+			// message search matches substrings, a trigram index serves it when the pg_trgm extension can be created
+			if d.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error == nil {
+				_ = d.Exec("CREATE INDEX IF NOT EXISTS idx_messages_search_text_trgm ON messages USING gin (search_text gin_trgm_ops)").Error
+			}
+			// block search is full-text, an expression index on the document of the blocks serves it
+			_ = d.Exec("CREATE INDEX IF NOT EXISTS idx_blocks_search ON blocks USING gin ((" + repo.BlockSearchVector + "))").Error
+			// every change of a block, by the API, the core or a cascaded delete, is recorded for the block events
+			_ = d.Exec(repo.BlockEventTrigger).Error
 		}
 
 		// ensure default project exists
@@ -91,10 +97,46 @@ func BuildContainer() *do.Injector {
 		return mq.NewPublisher(conn, log, cfg)
 	})
 
+	// Session message hub, fed by the broadcast consumer started in main
+	do.Provide(inj, func(i *do.Injector) (*service.MessageHub, error) {
+		return service.NewMessageHub(do.MustInvoke[*zap.Logger](i)), nil
+	})
+
 	// S3
 	do.Provide(inj, func(i *do.Injector) (*blob.S3Deps, error) {
 		cfg := do.MustInvoke[*config.Config](i)
-		return blob.NewS3(context.Background(), cfg)
+		s3, err := blob.NewS3(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+		s3.Sealer = do.MustInvoke[*envelope.Sealer](i)
+		return s3, nil
+	})
+	// envelope encryption of message parts and assets, nil when disabled
+	do.Provide(inj, func(i *do.Injector) (*envelope.Sealer, error) {
+		return envelope.NewSealer(
+			context.Background(),
+			do.MustInvoke[*config.Config](i),
+			repo.NewDataKeyRepo(do.MustInvoke[*gorm.DB](i)),
+		)
+	})
+	// incident reporter, nil when no DSN is configured
+	do.Provide(inj, func(i *do.Injector) (*incident.Reporter, error) {
+		reporter, err := incident.NewReporter(do.MustInvoke[*config.Config](i), do.MustInvoke[*zap.Logger](i))
+		if err != nil {
+			do.MustInvoke[*zap.Logger](i).Sugar().Warnw("incident reporting disabled", "err", err)
+			return nil, nil
+		}
+		return reporter, nil
+	})
+	// LLM, nil when no provider is configured
+	do.Provide(inj, func(i *do.Injector) (llm.Client, error) {
+		client, err := llm.NewClient(do.MustInvoke[*config.Config](i))
+		if err != nil {
+			do.MustInvoke[*zap.Logger](i).Sugar().Warnw("llm client disabled", "err", err)
+			return nil, nil
+		}
+		return client, nil
 	})
 	// get presign expire duration
 	do.Provide(inj, func(i *do.Injector) (func() time.Duration, error) {
@@ -135,6 +177,9 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (repo.BlockRepo, error) {
 		return repo.NewBlockRepo(do.MustInvoke[*gorm.DB](i)), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (repo.BlockEventRepo, error) {
+		return repo.NewBlockEventRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
 	do.Provide(inj, func(i *do.Injector) (repo.DiskRepo, error) {
 		return repo.NewDiskRepo(
 			do.MustInvoke[*gorm.DB](i),
@@ -150,6 +195,54 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (repo.TaskRepo, error) {
 		return repo.NewTaskRepo(do.MustInvoke[*gorm.DB](i)), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (repo.EmbeddingRepo, error) {
+		return repo.NewEmbeddingRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.ProjectRepo, error) {
+		return repo.NewProjectRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.ChunkRepo, error) {
+		return repo.NewChunkRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.FreshnessRepo, error) {
+		return repo.NewFreshnessRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.NotificationRepo, error) {
+		return repo.NewNotificationRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.IngestRepo, error) {
+		return repo.NewIngestRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.ToolCallRepo, error) {
+		return repo.NewToolCallRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.AuthEventRepo, error) {
+		return repo.NewAuthEventRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.DeprecatedCallRepo, error) {
+		return repo.NewDeprecatedCallRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.QuotaRepo, error) {
+		return repo.NewQuotaRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.EntityLimitRepo, error) {
+		return repo.NewEntityLimitRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.CloneRepo, error) {
+		return repo.NewCloneRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.SyncRuleRepo, error) {
+		return repo.NewSyncRuleRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.ProcessingStatusRepo, error) {
+		return repo.NewProcessingStatusRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.AnnotationRepo, error) {
+		return repo.NewAnnotationRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.ApplyRepo, error) {
+		return repo.NewApplyRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
 
 	// Service
 	do.Provide(inj, func(i *do.Injector) (service.SpaceService, error) {
@@ -158,6 +251,7 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*mq.Publisher](i),
 			do.MustInvoke[*config.Config](i),
 			do.MustInvoke[*zap.Logger](i),
+			do.MustInvoke[service.EntityLimitService](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.SessionService, error) {
@@ -172,7 +266,13 @@ func BuildContainer() *do.Injector {
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.BlockService, error) {
-		return service.NewBlockService(do.MustInvoke[repo.BlockRepo](i)), nil
+		return service.NewBlockService(
+			do.MustInvoke[repo.BlockRepo](i),
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+			do.MustInvoke[service.EntityLimitService](i),
+		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.DiskService, error) {
 		return service.NewDiskService(do.MustInvoke[repo.DiskRepo](i)), nil
@@ -181,6 +281,7 @@ func BuildContainer() *do.Injector {
 		return service.NewArtifactService(
 			do.MustInvoke[repo.ArtifactRepo](i),
 			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[service.QuotaService](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.TaskService, error) {
@@ -189,6 +290,200 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*zap.Logger](i),
 		), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (service.EmbeddingService, error) {
+		return service.NewEmbeddingService(
+			do.MustInvoke[repo.EmbeddingRepo](i),
+			do.MustInvoke[service.SessionService](i),
+			do.MustInvoke[service.ArtifactService](i),
+			do.MustInvoke[service.DiskService](i),
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.PartTransformService, error) {
+		return service.NewPartTransformService(
+			do.MustInvoke[repo.ProjectRepo](i),
+			do.MustInvoke[*config.Config](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.WindowPresetService, error) {
+		return service.NewWindowPresetService(do.MustInvoke[repo.ProjectRepo](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.AnnotationService, error) {
+		return service.NewAnnotationService(
+			do.MustInvoke[repo.AnnotationRepo](i),
+			do.MustInvoke[service.SessionService](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.RetentionService, error) {
+		return service.NewRetentionService(
+			do.MustInvoke[repo.ProjectRepo](i),
+			do.MustInvoke[repo.SessionRepo](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.NotificationService, error) {
+		return service.NewNotificationService(
+			do.MustInvoke[repo.NotificationRepo](i),
+			do.MustInvoke[repo.ProjectRepo](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.BlockEventService, error) {
+		return service.NewBlockEventService(
+			do.MustInvoke[repo.BlockEventRepo](i),
+			do.MustInvoke[repo.ProjectRepo](i),
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.IngestAlertService, error) {
+		return service.NewIngestAlertService(
+			do.MustInvoke[repo.ProjectRepo](i),
+			do.MustInvoke[repo.IngestRepo](i),
+			do.MustInvoke[repo.NotificationRepo](i),
+			do.MustInvoke[service.NotificationService](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.AuthGuardService, error) {
+		return service.NewAuthGuardService(
+			do.MustInvoke[repo.AuthEventRepo](i),
+			do.MustInvoke[service.NotificationService](i),
+			do.MustInvoke[*redis.Client](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.DeprecationService, error) {
+		return service.NewDeprecationService(do.MustInvoke[repo.DeprecatedCallRepo](i), service.Deprecations), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.ToolCallService, error) {
+		return service.NewToolCallService(do.MustInvoke[repo.ToolCallRepo](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.ProjectKeyService, error) {
+		return service.NewProjectKeyService(do.MustInvoke[repo.ProjectRepo](i), do.MustInvoke[*config.Config](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.NetworkAccessService, error) {
+		return service.NewNetworkAccessService(do.MustInvoke[repo.ProjectRepo](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.RedactionService, error) {
+		return service.NewRedactionService(do.MustInvoke[repo.ProjectRepo](i), do.MustInvoke[*config.Config](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.SessionConfigSchemaService, error) {
+		return service.NewSessionConfigSchemaService(do.MustInvoke[repo.ProjectRepo](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.PresignPolicyService, error) {
+		return service.NewPresignPolicyService(do.MustInvoke[repo.ProjectRepo](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.ApplyService, error) {
+		return service.NewApplyService(
+			do.MustInvoke[repo.ApplyRepo](i),
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+			do.MustInvoke[service.EntityLimitService](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.RateLimitService, error) {
+		return service.NewRateLimitService(
+			do.MustInvoke[*redis.Client](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.EntityLimitService, error) {
+		return service.NewEntityLimitService(do.MustInvoke[repo.EntityLimitRepo](i), do.MustInvoke[*config.Config](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.QuotaService, error) {
+		return service.NewQuotaService(
+			do.MustInvoke[repo.QuotaRepo](i),
+			do.MustInvoke[*config.Config](i),
+		), nil
+	})
+
+	do.Provide(inj, func(i *do.Injector) (service.ChunkService, error) {
+		return service.NewChunkService(
+			do.MustInvoke[repo.ChunkRepo](i),
+			do.MustInvoke[repo.ArtifactRepo](i),
+			do.MustInvoke[repo.BlockRepo](i),
+			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.FreshnessService, error) {
+		return service.NewFreshnessService(
+			do.MustInvoke[repo.FreshnessRepo](i),
+			do.MustInvoke[*config.Config](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.SyncRuleService, error) {
+		return service.NewSyncRuleService(
+			do.MustInvoke[repo.SyncRuleRepo](i),
+			do.MustInvoke[service.SessionService](i),
+			do.MustInvoke[*zap.Logger](i),
+			do.MustInvoke[service.EntityLimitService](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.SummaryService, error) {
+		return service.NewSummaryService(
+			do.MustInvoke[repo.SessionRepo](i),
+			do.MustInvoke[service.SessionService](i),
+			do.MustInvoke[llm.Client](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.PostIngestService, error) {
+		processors := []service.MessageProcessor{
+			service.NewSyncRuleProcessor(do.MustInvoke[service.SyncRuleService](i)),
+		}
+		if do.MustInvoke[*config.Config](i).LLM.Provider != "" {
+			processors = append(processors, service.NewSummaryProcessor(
+				do.MustInvoke[service.SummaryService](i),
+				do.MustInvoke[service.SessionService](i),
+			))
+		}
+		if cfg := do.MustInvoke[*config.Config](i); cfg.Embedding.Messages {
+			processors = append(processors, service.NewEmbeddingProcessor(
+				do.MustInvoke[repo.EmbeddingRepo](i),
+				do.MustInvoke[service.SessionService](i),
+				do.MustInvoke[*httpclient.CoreClient](i),
+			))
+		}
+		if cfg := do.MustInvoke[*config.Config](i); cfg.LLM.Provider != "" && len(cfg.Classify.Labels) > 0 {
+			processors = append(processors, service.NewClassifyProcessor(
+				do.MustInvoke[repo.SessionRepo](i),
+				do.MustInvoke[service.SessionService](i),
+				do.MustInvoke[llm.Client](i),
+				cfg.Classify.Labels,
+			))
+		}
+		return service.NewPostIngestService(
+			do.MustInvoke[repo.ProcessingStatusRepo](i),
+			do.MustInvoke[*zap.Logger](i),
+			processors...,
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.CloneService, error) {
+		return service.NewCloneService(
+			do.MustInvoke[repo.CloneRepo](i),
+			do.MustInvoke[repo.SessionRepo](i),
+			do.MustInvoke[*blob.S3Deps](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.AssetService, error) {
+		return service.NewAssetService(
+			do.MustInvoke[repo.AssetReferenceRepo](i),
+			do.MustInvoke[*blob.S3Deps](i),
+		), nil
+	})
 
 	// Handler
 	do.Provide(inj, func(i *do.Injector) (*handler.SpaceHandler, error) {
@@ -201,19 +496,34 @@ func BuildContainer() *do.Injector {
 		return handler.NewSessionHandler(
 			do.MustInvoke[service.SessionService](i),
 			do.MustInvoke[*httpclient.CoreClient](i),
+			do.MustInvoke[*config.Config](i).Upload,
+			do.MustInvoke[service.PostIngestService](i),
+			do.MustInvoke[service.TaskService](i),
+			do.MustInvoke[service.QuotaService](i),
+			do.MustInvoke[service.EntityLimitService](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.SubscriptionHandler, error) {
+		return handler.NewSubscriptionHandler(
+			do.MustInvoke[service.SessionService](i),
+			do.MustInvoke[*service.MessageHub](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (*handler.BlockHandler, error) {
 		return handler.NewBlockHandler(
 			do.MustInvoke[service.BlockService](i),
 			do.MustInvoke[*httpclient.CoreClient](i),
+			do.MustInvoke[service.EntityLimitService](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (*handler.DiskHandler, error) {
 		return handler.NewDiskHandler(do.MustInvoke[service.DiskService](i)), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (*handler.ArtifactHandler, error) {
-		return handler.NewArtifactHandler(do.MustInvoke[service.ArtifactService](i)), nil
+		return handler.NewArtifactHandler(
+			do.MustInvoke[service.ArtifactService](i),
+			do.MustInvoke[*config.Config](i).Upload,
+		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (*handler.TaskHandler, error) {
 		return handler.NewTaskHandler(do.MustInvoke[service.TaskService](i)), nil
@@ -221,6 +531,121 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (*handler.ToolHandler, error) {
 		return handler.NewToolHandler(do.MustInvoke[*httpclient.CoreClient](i)), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (*handler.EmbeddingHandler, error) {
+		return handler.NewEmbeddingHandler(
+			do.MustInvoke[service.EmbeddingService](i),
+			do.MustInvoke[*httpclient.CoreClient](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.PartTransformHandler, error) {
+		return handler.NewPartTransformHandler(do.MustInvoke[service.PartTransformService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.WindowPresetHandler, error) {
+		return handler.NewWindowPresetHandler(do.MustInvoke[service.WindowPresetService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.AnnotationHandler, error) {
+		return handler.NewAnnotationHandler(do.MustInvoke[service.AnnotationService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.RetentionHandler, error) {
+		return handler.NewRetentionHandler(do.MustInvoke[service.RetentionService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.NotificationHandler, error) {
+		return handler.NewNotificationHandler(do.MustInvoke[service.NotificationService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.BlockEventHandler, error) {
+		return handler.NewBlockEventHandler(do.MustInvoke[service.BlockEventService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.IngestAlertHandler, error) {
+		return handler.NewIngestAlertHandler(do.MustInvoke[service.IngestAlertService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.NetworkAccessHandler, error) {
+		return handler.NewNetworkAccessHandler(do.MustInvoke[service.NetworkAccessService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.RedactionHandler, error) {
+		return handler.NewRedactionHandler(do.MustInvoke[service.RedactionService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.SessionConfigSchemaHandler, error) {
+		return handler.NewSessionConfigSchemaHandler(do.MustInvoke[service.SessionConfigSchemaService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.PresignPolicyHandler, error) {
+		return handler.NewPresignPolicyHandler(do.MustInvoke[service.PresignPolicyService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ApplyHandler, error) {
+		return handler.NewApplyHandler(do.MustInvoke[service.ApplyService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.RateLimitHandler, error) {
+		return handler.NewRateLimitHandler(do.MustInvoke[service.RateLimitService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.EntityLimitHandler, error) {
+		return handler.NewEntityLimitHandler(do.MustInvoke[service.EntityLimitService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ToolCallHandler, error) {
+		return handler.NewToolCallHandler(do.MustInvoke[service.ToolCallService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ProjectKeyHandler, error) {
+		return handler.NewProjectKeyHandler(do.MustInvoke[service.ProjectKeyService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.QuotaHandler, error) {
+		return handler.NewQuotaHandler(do.MustInvoke[service.QuotaService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ChunkHandler, error) {
+		return handler.NewChunkHandler(do.MustInvoke[service.ChunkService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.FreshnessHandler, error) {
+		return handler.NewFreshnessHandler(do.MustInvoke[service.FreshnessService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.SyncRuleHandler, error) {
+		return handler.NewSyncRuleHandler(do.MustInvoke[service.SyncRuleService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.AdminHandler, error) {
+		return handler.NewAdminHandler(do.MustInvoke[service.CloneService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.DeprecationHandler, error) {
+		return handler.NewDeprecationHandler(do.MustInvoke[service.DeprecationService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.DebugHandler, error) {
+		return handler.NewDebugHandler(), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.AssetHandler, error) {
+		return handler.NewAssetHandler(do.MustInvoke[service.AssetService](i)), nil
+	})
 
 	return inj
 }
+
+// Models are the models whose tables the database migrations create
+func Models() []any {
+	return []any{
+		&model.Project{},
+		&model.Space{},
+		&model.Session{},
+		&model.Task{},
+		&model.Message{},
+		&model.Block{},
+		&model.BlockReference{},
+		&model.BlockEventRow{},
+		&model.Disk{},
+		&model.Artifact{},
+		&model.ArtifactLease{},
+		&model.ArtifactUpload{},
+		&model.ArtifactUploadPart{},
+		&model.AssetReference{},
+		&model.ToolReference{},
+		&model.ToolSOP{},
+		&model.ExperienceConfirmation{},
+		&model.Metric{},
+		&model.Notification{},
+		&model.EmbeddingJob{},
+		&model.Chunk{},
+		&model.StaleItem{},
+		&model.SyncRule{},
+		&model.MessageProcessingStatus{},
+		&model.MessageEmbedding{},
+		&model.MessageAnnotation{},
+		&model.AuthEvent{},
+		&model.ToolCallLink{},
+		&model.ProjectDataKey{},
+		&model.SessionEvent{},
+		&model.DeprecatedCall{},
+	}
+}
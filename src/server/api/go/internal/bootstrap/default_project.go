@@ -31,21 +31,9 @@ func EnsureDefaultProjectExists(ctx context.Context, db *gorm.DB, cfg *config.Co
 
 	switch err {
 	case nil:
-		// Default project exists, update its secret
-		phc, err := secrets.HashSecret(secret, pepper)
-		if err != nil {
-			return err
-		}
-
-		updates := map[string]interface{}{
-			"secret_key_hmac":     lookup,
-			"secret_key_hash_phc": phc,
-		}
-
-		if uErr := db.WithContext(ctx).Model(&defaultProject).Updates(updates).Error; uErr != nil {
-			return uErr
-		}
-		log.Sugar().Infow("default project exists", "project", defaultProject.ID)
+		// Default project exists. Its key is only seeded on creation, a key rotated through the API must not be
+		// replaced by the configured one on restart.
+		log.Sugar().Infow("default project exists, its key is kept", "project", defaultProject.ID)
 		return nil
 
 	case gorm.ErrRecordNotFound:
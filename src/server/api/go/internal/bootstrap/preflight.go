@@ -0,0 +1,123 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do"
+	"gorm.io/gorm"
+)
+
+// preflightTimeout bounds each preflight check
+const preflightTimeout = 15 * time.Second
+
+// Preflight checks at boot that the database schema matches the models, that the S3 bucket is reachable
+// and writable, and that the MQ exchanges can be declared, so that a broken deployment fails at startup
+// with an actionable message instead of on the first request. It returns the failures of all the checks.
+func Preflight(ctx context.Context, inj *do.Injector) error {
+	cfg := do.MustInvoke[*config.Config](inj)
+
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"database schema", func(ctx context.Context) error {
+			return checkSchema(ctx, do.MustInvoke[*gorm.DB](inj))
+		}},
+		{"S3 bucket", func(ctx context.Context) error {
+			s3, err := do.Invoke[*blob.S3Deps](inj)
+			if err != nil {
+				return fmt.Errorf("%w; check s3.endpoint, s3.region and the S3 credentials", err)
+			}
+			if err := s3.Probe(ctx); err != nil {
+				return fmt.Errorf("%w; check that s3.bucket exists and the S3 credentials may write and delete objects in it", err)
+			}
+			return nil
+		}},
+		{"MQ exchanges", func(ctx context.Context) error {
+			conn, err := do.Invoke[*amqp.Connection](inj)
+			if err != nil {
+				return fmt.Errorf("%w; check rabbitmq.url", err)
+			}
+			return checkExchanges(conn, cfg.RabbitMQ.ExchangeName.SessionMessage, cfg.RabbitMQ.ExchangeName.Embedding)
+		}},
+	}
+
+	var errs []error
+	for _, c := range checks {
+		cctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		if err := c.run(cctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// checkSchema reports the tables and columns of the models missing from the database
+func checkSchema(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+	var missing []string
+	for _, m := range Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(table) {
+			missing = append(missing, "table "+table)
+			continue
+		}
+
+		columnTypes, err := db.Migrator().ColumnTypes(table)
+		if err != nil {
+			return fmt.Errorf("read columns of %s: %w", table, err)
+		}
+		columns := make(map[string]bool, len(columnTypes))
+		for _, ct := range columnTypes {
+			columns[ct.Name()] = true
+		}
+		var cols []string
+		for _, name := range stmt.Schema.DBNames {
+			if !columns[name] {
+				cols = append(cols, name)
+			}
+		}
+		if len(cols) > 0 {
+			sort.Strings(cols)
+			missing = append(missing, fmt.Sprintf("columns %s.%s", table, strings.Join(cols, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the database schema is older than this server, missing %s; enable database.autoMigrate or migrate the database",
+			strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// checkExchanges declares the exchanges the server publishes to, the way the publishers and consumers declare them
+func checkExchanges(conn *amqp.Connection, names ...string) error {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		// a failed declaration closes the channel, each exchange gets its own
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("open channel: %w", err)
+		}
+		err = ch.ExchangeDeclare(name, amqp.ExchangeDirect, true, false, false, false, nil)
+		_ = ch.Close()
+		if err != nil {
+			return fmt.Errorf("declare exchange %q: %w; check that the rabbitmq user may configure it and that no exchange of another type or durability exists under this name", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+var (
+	// ErrNoSuchUpload is returned for a multipart upload that was completed or aborted
+	ErrNoSuchUpload = errors.New("multipart upload does not exist")
+	// ErrInvalidParts is returned when the parts given to complete a multipart upload were not all uploaded
+	ErrInvalidParts = errors.New("parts of the multipart upload are missing or invalid")
+)
+
+// sniffBytes is how much of the start of an object DigestObject keeps to detect its type
+const sniffBytes = 512
+
+// CompletedPart is a part of a multipart upload, ETag is returned by S3 when the part is uploaded
+type CompletedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+// FindObject returns the metadata of an unsealed object under keyPrefix holding the content of sumHex, without MIME,
+// or nil if there is none
+func (u *S3Deps) FindObject(ctx context.Context, keyPrefix string, sumHex string) *model.Asset {
+	return u.findObject(ctx, keyPrefix, sumHex, false)
+}
+
+// PresignHeaders returns the headers a client must send with the request of a URL from PresignPut
+func (s *S3Deps) PresignHeaders(contentType, sumHex string) map[string]string {
+	headers := map[string]string{"Content-Type": contentType}
+	if checksum, err := checksumSHA256(sumHex); err == nil {
+		headers["x-amz-checksum-sha256"] = checksum
+	}
+	if s.SSE != nil {
+		headers["x-amz-server-side-encryption"] = string(*s.SSE)
+	}
+	return headers
+}
+
+// CreateMultipartUpload starts a multipart upload to key, it returns the ID of the upload
+func (s *S3Deps) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      &s.Bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	}
+	if s.SSE != nil {
+		input.ServerSideEncryption = *s.SSE
+	}
+	out, err := s.Client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("create multipart upload in S3: %w", err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// PresignUploadPart generates a pre-signed PUT URL uploading a part of a multipart upload, numbered from 1
+func (s *S3Deps) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expire time.Duration) (string, error) {
+	ps, err := s.Presigner.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     &s.Bucket,
+		Key:        &key,
+		UploadId:   &uploadID,
+		PartNumber: aws.Int32(partNumber),
+	}, func(po *s3.PresignOptions) {
+		po.Expires = expire
+	})
+	if err != nil {
+		return "", err
+	}
+	return ps.URL, nil
+}
+
+// UploadPart uploads a part of a multipart upload, numbered from 1, and returns its ETag
+func (s *S3Deps) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body []byte) (string, error) {
+	out, err := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        &s.Bucket,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    aws.Int32(partNumber),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("upload part to S3: %w", multipartErr(err))
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the object
+func (s *S3Deps) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	if len(parts) == 0 {
+		return errors.New("no part to complete the upload with")
+	}
+	completed := make([]s3types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = s3types.CompletedPart{
+			PartNumber: aws.Int32(p.PartNumber),
+			ETag:       aws.String(p.ETag),
+		}
+	}
+	_, err := s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.Bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload in S3: %w", multipartErr(err))
+	}
+	return nil
+}
+
+// AbortMultipartUpload drops a multipart upload and the parts uploaded so far
+func (s *S3Deps) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &s.Bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	if err != nil {
+		return fmt.Errorf("abort multipart upload in S3: %w", multipartErr(err))
+	}
+	return nil
+}
+
+// multipartErr tells the errors of a multipart upload the client caused from the failures of S3
+func multipartErr(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchUpload":
+		return fmt.Errorf("%w: %s", ErrNoSuchUpload, apiErr.ErrorMessage())
+	case "InvalidPart", "InvalidPartOrder", "EntityTooSmall":
+		return fmt.Errorf("%w: %s", ErrInvalidParts, apiErr.ErrorMessage())
+	}
+	return err
+}
+
+// checksumSHA256 converts a lowercase hex SHA256 to the base64 checksum of S3
+func checksumSHA256(sumHex string) (string, error) {
+	sum, err := hex.DecodeString(sumHex)
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 %q", sumHex)
+	}
+	return base64.StdEncoding.EncodeToString(sum), nil
+}
+
+// StatObject returns the metadata of an unsealed object without MIME and its first bytes to detect its type, or nil
+// if the object does not exist. The SHA256 is the checksum S3 verified on upload, empty when the object was uploaded
+// without one, in which case the object has to go through DigestObject.
+func (u *S3Deps) StatObject(ctx context.Context, key string) (*model.Asset, []byte, error) {
+	out, err := u.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       &u.Bucket,
+		Key:          &key,
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("head object in S3: %w", err)
+	}
+
+	asset := &model.Asset{
+		Bucket: u.Bucket,
+		S3Key:  key,
+		ETag:   cleanETag(aws.ToString(out.ETag)),
+		SizeB:  aws.ToInt64(out.ContentLength),
+	}
+	// A multipart object has a checksum of its parts, ending with -<parts>, not of its content
+	if checksum := aws.ToString(out.ChecksumSHA256); checksum != "" && !strings.Contains(checksum, "-") {
+		sum, err := base64.StdEncoding.DecodeString(checksum)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode S3 checksum: %w", err)
+		}
+		asset.SHA256 = hex.EncodeToString(sum)
+	}
+	if asset.SizeB == 0 {
+		return asset, nil, nil
+	}
+
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", sniffBytes-1)),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("get object from S3: %w", err)
+	}
+	defer result.Body.Close()
+	head, err := io.ReadAll(io.LimitReader(result.Body, sniffBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read object from S3: %w", err)
+	}
+	return asset, head, nil
+}
+
+// DigestObject streams an unsealed object to compute its SHA256. It returns its metadata without MIME and its
+// first bytes to detect its type, or nil if the object does not exist.
+func (u *S3Deps) DigestObject(ctx context.Context, key string) (*model.Asset, []byte, error) {
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var notFound *s3types.NoSuchKey
+		if errors.As(err, &notFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("get object from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	head := make([]byte, sniffBytes)
+	n, err := io.ReadFull(result.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("read object from S3: %w", err)
+	}
+	head = head[:n]
+
+	h := sha256.New()
+	h.Write(head)
+	rest, err := io.Copy(h, result.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read object from S3: %w", err)
+	}
+
+	return &model.Asset{
+		Bucket: u.Bucket,
+		S3Key:  key,
+		ETag:   cleanETag(aws.ToString(result.ETag)),
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		SizeB:  int64(n) + rest,
+	}, head, nil
+}
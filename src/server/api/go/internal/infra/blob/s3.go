@@ -20,9 +20,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithymw "github.com/aws/smithy-go/middleware"
 	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/envelope"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/timing"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/mimesniff"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 	"go.opentelemetry.io/otel"
 )
@@ -33,8 +38,61 @@ type S3Deps struct {
 	Presigner *s3.PresignClient
 	Bucket    string
 	SSE       *s3types.ServerSideEncryption
+
+	// RejectMIMEMismatch makes UploadFormFile fail with ErrMIMEMismatch instead of correcting the type
+	RejectMIMEMismatch bool
+
+	// Sealer seals the uploads of ForProject and opens sealed objects, nil when envelope encryption is disabled
+	Sealer *envelope.Sealer
+	// sealFor is the project whose data key seals uploads, see ForProject
+	sealFor uuid.UUID
+}
+
+// SealedSuffix ends the keys of objects sealed with envelope encryption
+const SealedSuffix = ".sealed"
+
+// ErrSealed is returned when presigning a sealed object, its content is only readable through the API
+var ErrSealed = errors.New("object is sealed and cannot be presigned")
+
+// ForProject returns S3Deps sealing what it uploads with the data key of the project,
+// or u itself when envelope encryption is disabled
+func (u *S3Deps) ForProject(projectID uuid.UUID) *S3Deps {
+	if u == nil || u.Sealer == nil {
+		return u
+	}
+	sealed := *u
+	sealed.sealFor = projectID
+	return &sealed
+}
+
+// Sealing reports whether envelope encryption is enabled
+func (u *S3Deps) Sealing() bool {
+	return u != nil && u.Sealer != nil
 }
 
+// open returns the content of an object, decrypting it when its key marks it as sealed
+func (u *S3Deps) open(ctx context.Context, key string, data []byte) ([]byte, error) {
+	if !strings.HasSuffix(key, SealedSuffix) {
+		return data, nil
+	}
+	if u.Sealer == nil {
+		return nil, envelope.ErrNotConfigured
+	}
+	return u.Sealer.Open(ctx, data)
+}
+
+// addTimingMiddleware adds the duration of each S3 call to the timing.S3 total of the request
+func addTimingMiddleware(stack *smithymw.Stack) error {
+	return stack.Initialize.Add(smithymw.InitializeMiddlewareFunc("AcontextTiming",
+		func(ctx context.Context, in smithymw.InitializeInput, next smithymw.InitializeHandler) (smithymw.InitializeOutput, smithymw.Metadata, error) {
+			defer timing.Track(ctx, timing.S3)()
+			return next.HandleInitialize(ctx, in)
+		}), smithymw.Before)
+}
+
+// ErrMIMEMismatch is returned when an uploaded file content contradicts its declared type
+var ErrMIMEMismatch = errors.New("file content does not match its declared type")
+
 func NewS3(ctx context.Context, cfg *config.Config) (*S3Deps, error) {
 	loadOpts := []func(*awsCfg.LoadOptions) error{
 		awsCfg.WithRegion(cfg.S3.Region),
@@ -56,6 +114,9 @@ func NewS3(ctx context.Context, cfg *config.Config) (*S3Deps, error) {
 		otelaws.AppendMiddlewares(&acfg.APIOptions)
 	}
 
+	// Time S3 calls of requests with debug timings
+	acfg.APIOptions = append(acfg.APIOptions, addTimingMiddleware)
+
 	// Helper function to normalize endpoint URL
 	normalizeEndpoint := func(endpoint string) string {
 		ep := strings.TrimSpace(endpoint)
@@ -123,15 +184,23 @@ func NewS3(ctx context.Context, cfg *config.Config) (*S3Deps, error) {
 		Presigner: presigner,
 		Bucket:    cfg.S3.Bucket,
 		SSE:       sse,
+
+		RejectMIMEMismatch: cfg.S3.RejectMIMEMismatch,
 	}, nil
 }
 
-// Generate a pre-signed PUT URL (recommended for direct uploading of large files)
-func (s *S3Deps) PresignPut(ctx context.Context, key, contentType string, expire time.Duration) (string, error) {
+// Generate a pre-signed PUT URL (recommended for direct uploading of large files).
+// S3 rejects a body whose SHA256 is not sumHex, lowercase hex.
+func (s *S3Deps) PresignPut(ctx context.Context, key, contentType, sumHex string, expire time.Duration) (string, error) {
+	checksum, err := checksumSHA256(sumHex)
+	if err != nil {
+		return "", err
+	}
 	params := &s3.PutObjectInput{
-		Bucket:      &s.Bucket,
-		Key:         &key,
-		ContentType: &contentType,
+		Bucket:         &s.Bucket,
+		Key:            &key,
+		ContentType:    &contentType,
+		ChecksumSHA256: &checksum,
 	}
 	if s.SSE != nil {
 		params.ServerSideEncryption = *s.SSE
@@ -150,6 +219,9 @@ func (s *S3Deps) PresignGet(ctx context.Context, key string, expire time.Duratio
 	if key == "" {
 		return "", errors.New("key is empty")
 	}
+	if strings.HasSuffix(key, SealedSuffix) {
+		return "", ErrSealed
+	}
 	ps, err := s.Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: &s.Bucket,
 		Key:    &key,
@@ -171,19 +243,14 @@ func cleanETag(etag string) string {
 	return strings.Trim(etag, `"`)
 }
 
-// uploadWithDedup performs content-addressed deduplicated upload.
-// It searches for existing objects under keyPrefix that contain the given sumHex in the key.
-// If found, returns its metadata; otherwise uploads the new content using date + sumHex + ext as key.
-func (u *S3Deps) uploadWithDedup(
-	ctx context.Context,
-	keyPrefix string,
-	sumHex string,
-	contentType string,
-	ext string,
-	size int64,
-	body io.Reader,
-	metadata map[string]string,
-) (*model.Asset, error) {
+// ObjectKey returns the content-addressed key of new content under keyPrefix, with the date of today
+func ObjectKey(keyPrefix string, sumHex string, ext string) string {
+	return fmt.Sprintf("%s/%s/%s%s", keyPrefix, time.Now().UTC().Format("2006/01/02"), sumHex, ext)
+}
+
+// findObject searches under keyPrefix for an object whose key contains sumHex, sealed or not as sealing.
+// It returns its metadata without MIME, or nil if there is none.
+func (u *S3Deps) findObject(ctx context.Context, keyPrefix string, sumHex string, sealing bool) *model.Asset {
 	// Check for existing object with pagination support
 	listInput := &s3.ListObjectsV2Input{
 		Bucket: &u.Bucket,
@@ -195,24 +262,24 @@ func (u *S3Deps) uploadWithDedup(
 		listInput.ContinuationToken = continuationToken
 		result, err := u.Client.ListObjectsV2(ctx, listInput)
 		if err != nil {
-			break
+			return nil
 		}
 
 		if result.Contents != nil {
 			for _, obj := range result.Contents {
-				if obj.Key != nil && strings.Contains(*obj.Key, sumHex) {
+				if obj.Key != nil && strings.Contains(*obj.Key, sumHex) && strings.HasSuffix(*obj.Key, SealedSuffix) == sealing {
 					if headResult, herr := u.Client.HeadObject(ctx, &s3.HeadObjectInput{
 						Bucket: &u.Bucket,
 						Key:    obj.Key,
 					}); herr == nil {
 						return &model.Asset{
-							Bucket: u.Bucket,
-							S3Key:  *obj.Key,
-							ETag:   cleanETag(*headResult.ETag),
-							SHA256: sumHex,
-							MIME:   contentType,
-							SizeB:  aws.ToInt64(headResult.ContentLength),
-						}, nil
+							Bucket:    u.Bucket,
+							S3Key:     *obj.Key,
+							ETag:      cleanETag(*headResult.ETag),
+							SHA256:    sumHex,
+							SizeB:     aws.ToInt64(headResult.ContentLength),
+							Encrypted: sealing,
+						}
 					}
 				}
 			}
@@ -220,20 +287,55 @@ func (u *S3Deps) uploadWithDedup(
 
 		// Check if there are more pages
 		if !aws.ToBool(result.IsTruncated) {
-			break
+			return nil
 		}
 		continuationToken = result.NextContinuationToken
 	}
+}
+
+// uploadWithDedup performs content-addressed deduplicated upload.
+// It searches for existing objects under keyPrefix that contain the given sumHex in the key.
+// If found, returns its metadata; otherwise uploads the new content using date + sumHex + ext as key.
+// Uploads of ForProject are sealed and only deduplicated with sealed objects.
+func (u *S3Deps) uploadWithDedup(
+	ctx context.Context,
+	keyPrefix string,
+	sumHex string,
+	contentType string,
+	ext string,
+	body []byte,
+	metadata map[string]string,
+) (*model.Asset, error) {
+	sealing := u.sealFor != uuid.Nil
+	size := int64(len(body))
+
+	if asset := u.findObject(ctx, keyPrefix, sumHex, sealing); asset != nil {
+		asset.MIME = contentType
+		if sealing {
+			asset.SizeB = size
+		}
+		return asset, nil
+	}
 
 	// No existing file found, upload new file with date prefix
-	datePrefix := time.Now().UTC().Format("2006/01/02")
-	key := fmt.Sprintf("%s/%s/%s%s", keyPrefix, datePrefix, sumHex, ext)
+	key := ObjectKey(keyPrefix, sumHex, ext)
+
+	storedType := contentType
+	if sealing {
+		sealed, err := u.Sealer.Seal(ctx, u.sealFor, body)
+		if err != nil {
+			return nil, fmt.Errorf("seal object: %w", err)
+		}
+		// Nothing about the content is stored in plaintext, file names included
+		body, key, storedType = sealed, key+SealedSuffix, "application/octet-stream"
+		metadata = map[string]string{"sha256": sumHex}
+	}
 
 	input := &s3.PutObjectInput{
 		Bucket:      aws.String(u.Bucket),
 		Key:         aws.String(key),
-		Body:        body,
-		ContentType: aws.String(contentType),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(storedType),
 		Metadata:    metadata,
 	}
 	if u.SSE != nil {
@@ -246,15 +348,34 @@ func (u *S3Deps) uploadWithDedup(
 	}
 
 	return &model.Asset{
-		Bucket: u.Bucket,
-		S3Key:  key,
-		ETag:   cleanETag(*out.ETag),
-		SHA256: sumHex,
-		MIME:   contentType,
-		SizeB:  size,
+		Bucket:    u.Bucket,
+		S3Key:     key,
+		ETag:      cleanETag(*out.ETag),
+		SHA256:    sumHex,
+		MIME:      contentType,
+		SizeB:     size,
+		Encrypted: sealing,
 	}, nil
 }
 
+// ResolveMIME returns the type to store for the content of the file name declared as declared, and the type
+// detected from the content. The declared type is trusted unless the content contradicts it, then the detected type
+// is stored, or ErrMIMEMismatch is returned when the server rejects mismatches.
+func (u *S3Deps) ResolveMIME(name string, declared string, content []byte) (contentType string, detected string, err error) {
+	detected = mimesniff.Detect(content)
+	contentType = declared
+	if contentType == "" || mimesniff.BaseType(contentType) == "application/octet-stream" {
+		contentType = detected
+	}
+	if !mimesniff.Compatible(declared, detected) {
+		if u.RejectMIMEMismatch {
+			return "", detected, fmt.Errorf("%w: %s is declared as %s but looks like %s", ErrMIMEMismatch, name, declared, detected)
+		}
+		contentType = detected
+	}
+	return contentType, detected, nil
+}
+
 // UploadFormFile uploads a file to S3 with automatic deduplication
 // It checks if a file with the same SHA256 already exists under the keyPrefix
 // If found, returns the existing file metadata; otherwise uploads the new file
@@ -278,21 +399,55 @@ func (u *S3Deps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multi
 	sumHex := hex.EncodeToString(h.Sum(nil))
 
 	ext := strings.ToLower(filepath.Ext(fh.Filename))
-	contentType := fh.Header.Get("Content-Type")
+	declared := fh.Header.Get("Content-Type")
+	contentType, detected, err := u.ResolveMIME(fh.Filename, declared, fileContent)
+	if err != nil {
+		return nil, err
+	}
+	// A content contradicting the declared type is stored with the extension of the detected type
+	if !mimesniff.Compatible(declared, detected) {
+		if detectedExt := mimesniff.Extension(detected); detectedExt != "" {
+			ext = detectedExt
+		}
+	}
 
-	return u.uploadWithDedup(
+	asset, err := u.uploadWithDedup(
 		ctx,
 		keyPrefix,
 		sumHex,
 		contentType,
 		ext,
-		int64(len(fileContent)),
-		bytes.NewReader(fileContent),
+		fileContent,
 		map[string]string{
 			"sha256": sumHex,
 			"name":   fh.Filename,
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+	asset.DeclaredMIME = declared
+	asset.DetectedMIME = detected
+	return asset, nil
+}
+
+// UploadBytes uploads data to S3 with automatic deduplication and returns metadata
+func (u *S3Deps) UploadBytes(ctx context.Context, keyPrefix string, data []byte, contentType string, ext string) (*model.Asset, error) {
+	h := sha256.New()
+	h.Write(data)
+	sumHex := hex.EncodeToString(h.Sum(nil))
+
+	return u.uploadWithDedup(
+		ctx,
+		keyPrefix,
+		sumHex,
+		contentType,
+		ext,
+		data,
+		map[string]string{
+			"sha256": sumHex,
+		},
+	)
 }
 
 // UploadJSON uploads JSON data to S3 and returns metadata
@@ -314,8 +469,7 @@ func (u *S3Deps) UploadJSON(ctx context.Context, keyPrefix string, data interfac
 		sumHex,
 		"application/json",
 		".json",
-		int64(len(jsonData)),
-		bytes.NewReader(jsonData),
+		jsonData,
 		map[string]string{
 			"sha256": sumHex,
 		},
@@ -340,8 +494,13 @@ func (u *S3Deps) DownloadJSON(ctx context.Context, key string, target interface{
 		return fmt.Errorf("read response body: %w", err)
 	}
 
+	data, err := u.open(ctx, key, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
 	// Unmarshal JSON
-	if err := sonic.Unmarshal(buf.Bytes(), target); err != nil {
+	if err := sonic.Unmarshal(data, target); err != nil {
 		return fmt.Errorf("unmarshal json: %w", err)
 	}
 
@@ -370,7 +529,83 @@ func (u *S3Deps) DownloadFile(ctx context.Context, key string) ([]byte, error) {
 		return nil, fmt.Errorf("read response body: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	return u.open(ctx, key, buf.Bytes())
+}
+
+// OpenFile opens a streaming reader over an object in S3, the caller must close it.
+// Sealed objects are downloaded and decrypted whole.
+func (u *S3Deps) OpenFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+	if strings.HasSuffix(key, SealedSuffix) {
+		data, err := u.DownloadFile(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object from S3: %w", err)
+	}
+	return result.Body, nil
+}
+
+// OpenFileRange opens a streaming reader over length bytes of an object from offset, the caller must close it.
+// Sealed objects are downloaded and decrypted whole, as in OpenFile.
+func (u *S3Deps) OpenFileRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("invalid range of %d bytes from %d", length, offset)
+	}
+	if strings.HasSuffix(key, SealedSuffix) {
+		data, err := u.DownloadFile(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if offset+length > int64(len(data)) {
+			return nil, fmt.Errorf("range of %d bytes from %d is beyond the %d bytes of the object", length, offset, len(data))
+		}
+		return io.NopCloser(bytes.NewReader(data[offset : offset+length])), nil
+	}
+
+	rng := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+		Range:  &rng,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object range from S3: %w", err)
+	}
+	return result.Body, nil
+}
+
+// CopyObject copies an object to dstKey within the bucket
+func (u *S3Deps) CopyObject(ctx context.Context, srcKey string, dstKey string) error {
+	if srcKey == "" || dstKey == "" {
+		return errors.New("key is empty")
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     &u.Bucket,
+		CopySource: aws.String(u.Bucket + "/" + url.PathEscape(srcKey)),
+		Key:        &dstKey,
+	}
+	if u.SSE != nil {
+		input.ServerSideEncryption = *u.SSE
+	}
+	if _, err := u.Client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("copy object in S3: %w", err)
+	}
+	return nil
 }
 
 // DeleteObject deletes an object from S3
@@ -432,3 +667,28 @@ func (u *S3Deps) DeleteObjects(ctx context.Context, keys []string) error {
 
 	return nil
 }
+
+// Probe checks that the bucket exists and that objects can be written to and deleted from it,
+// by uploading and deleting a small probe object
+func (u *S3Deps) Probe(ctx context.Context) error {
+	if _, err := u.Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &u.Bucket}); err != nil {
+		return fmt.Errorf("head bucket %q: %w", u.Bucket, err)
+	}
+
+	key := ".preflight/" + uuid.NewString()
+	input := &s3.PutObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+		Body:   bytes.NewReader([]byte("ok")),
+	}
+	if u.SSE != nil {
+		input.ServerSideEncryption = *u.SSE
+	}
+	if _, err := u.Client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("put object into bucket %q: %w", u.Bucket, err)
+	}
+	if err := u.DeleteObject(ctx, key); err != nil {
+		return fmt.Errorf("bucket %q: %w", u.Bucket, err)
+	}
+	return nil
+}
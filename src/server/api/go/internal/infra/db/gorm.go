@@ -26,6 +26,11 @@ func New(cfg *config.Config) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpen)
 	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdle)
 	sqlDB.SetConnMaxLifetime(1 * time.Hour)
+
+	// feeds the db_ms of debug timings, it costs nothing for requests that are not timed
+	if err := db.Use(timingPlugin{}); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
 
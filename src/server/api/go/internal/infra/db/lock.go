@@ -0,0 +1,21 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// TryAdvisoryLock takes the Postgres advisory lock key in a transaction of its own, so a periodic job runs on one
+// instance at a time. ok is false when another instance holds the lock, otherwise unlock releases it.
+func TryAdvisoryLock(ctx context.Context, gdb *gorm.DB, key int64) (unlock func(), ok bool, err error) {
+	tx := gdb.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, false, tx.Error
+	}
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", key).Scan(&ok).Error; err != nil || !ok {
+		tx.Rollback()
+		return nil, false, err
+	}
+	return func() { tx.Rollback() }, true, nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/pkg/timing"
+	"gorm.io/gorm"
+)
+
+const timingStartKey = "acontext:timing_start"
+
+// timingPlugin adds the duration of the statements of timed requests to their timing.DB total
+type timingPlugin struct{}
+
+func (timingPlugin) Name() string { return "acontext:timing" }
+
+func (timingPlugin) Initialize(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		if timing.FromContext(tx.Statement.Context) != nil {
+			tx.InstanceSet(timingStartKey, time.Now())
+		}
+	}
+	after := func(tx *gorm.DB) {
+		r := timing.FromContext(tx.Statement.Context)
+		if r == nil {
+			return
+		}
+		if start, ok := tx.InstanceGet(timingStartKey); ok {
+			r.Add(timing.DB, time.Since(start.(time.Time)))
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("timing:before_create", before),
+		cb.Create().After("gorm:create").Register("timing:after_create", after),
+		cb.Query().Before("gorm:query").Register("timing:before_query", before),
+		cb.Query().After("gorm:query").Register("timing:after_query", after),
+		cb.Update().Before("gorm:update").Register("timing:before_update", before),
+		cb.Update().After("gorm:update").Register("timing:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("timing:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("timing:after_delete", after),
+		cb.Row().Before("gorm:row").Register("timing:before_row", before),
+		cb.Row().After("gorm:row").Register("timing:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("timing:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("timing:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
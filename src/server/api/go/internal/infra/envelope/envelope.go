@@ -0,0 +1,218 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+// magic starts every sealed object, it is followed by the project ID, the nonce and the AES-256-GCM ciphertext.
+// The magic and the project ID are authenticated as additional data.
+var magic = []byte("ACENV1")
+
+const (
+	nonceLen  = 12
+	headerLen = 6 + 16 + nonceLen
+)
+
+var (
+	// ErrNotConfigured is returned when opening a sealed object without envelope encryption configured
+	ErrNotConfigured = errors.New("object is sealed but envelope encryption is not configured")
+	// ErrNotSealed is returned when opening an object that does not start like a sealed one
+	ErrNotSealed = errors.New("object is not sealed")
+)
+
+// KMS generates data keys and unwraps them with a master key the server never stores
+type KMS interface {
+	Name() string
+	// KeyID identifies the master key wrapping new data keys
+	KeyID() string
+	// GenerateDataKey returns a new 32 byte data key in plaintext and wrapped by the master key
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	// Decrypt unwraps a data key wrapped by the master key keyID
+	Decrypt(ctx context.Context, wrapped []byte, keyID string) ([]byte, error)
+}
+
+// DataKeyStore keeps the wrapped data key of each project
+type DataKeyStore interface {
+	Get(ctx context.Context, projectID uuid.UUID) (*model.ProjectDataKey, error)
+	Create(ctx context.Context, k *model.ProjectDataKey) (*model.ProjectDataKey, error)
+}
+
+// Sealer encrypts objects with the data key of their project, creating it on first use
+type Sealer struct {
+	kms   KMS
+	store DataKeyStore
+	ttl   time.Duration
+
+	// unwrapped data keys, so the KMS is called once per project and TTL
+	mu   sync.Mutex
+	keys map[uuid.UUID]cachedKey
+}
+
+type cachedKey struct {
+	aead  cipher.AEAD
+	until time.Time
+}
+
+// NewSealer returns the sealer of the configured KMS, or nil if envelope encryption is disabled
+func NewSealer(ctx context.Context, cfg *config.Config, store DataKeyStore) (*Sealer, error) {
+	if !cfg.Envelope.Enabled {
+		return nil, nil
+	}
+
+	var kms KMS
+	var err error
+	switch cfg.Envelope.KMS {
+	case "", KMSLocal:
+		kms, err = NewLocalKMS(cfg.Envelope.MasterKey)
+	case KMSAWS:
+		kms, err = NewAWSKMS(ctx, cfg)
+	default:
+		err = fmt.Errorf("unknown envelope kms %q", cfg.Envelope.KMS)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewSealerWithKMS(kms, store, time.Duration(cfg.Envelope.KeyCacheSec)*time.Second), nil
+}
+
+// NewSealerWithKMS returns a sealer keeping unwrapped data keys in memory for ttl
+func NewSealerWithKMS(kms KMS, store DataKeyStore, ttl time.Duration) *Sealer {
+	return &Sealer{kms: kms, store: store, ttl: ttl, keys: map[uuid.UUID]cachedKey{}}
+}
+
+// IsSealed reports whether data starts like a sealed object
+func IsSealed(data []byte) bool {
+	return len(data) >= headerLen && bytes.HasPrefix(data, magic)
+}
+
+// Seal encrypts plaintext with the data key of the project
+func (s *Sealer) Seal(ctx context.Context, projectID uuid.UUID, plaintext []byte) ([]byte, error) {
+	aead, err := s.aead(ctx, projectID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, headerLen, headerLen+len(plaintext)+aead.Overhead())
+	copy(out, magic)
+	copy(out[len(magic):], projectID[:])
+	nonce := out[headerLen-nonceLen : headerLen]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(out, nonce, plaintext, out[:headerLen-nonceLen]), nil
+}
+
+// Open decrypts an object sealed by Seal, with the data key of the project it was sealed for
+func (s *Sealer) Open(ctx context.Context, data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return nil, ErrNotSealed
+	}
+	if s == nil {
+		return nil, ErrNotConfigured
+	}
+
+	projectID, err := uuid.FromBytes(data[len(magic) : headerLen-nonceLen])
+	if err != nil {
+		return nil, fmt.Errorf("read sealed project id: %w", err)
+	}
+	aead, err := s.aead(ctx, projectID, false)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, data[headerLen-nonceLen:headerLen], data[headerLen:], data[:headerLen-nonceLen])
+	if err != nil {
+		return nil, fmt.Errorf("open sealed object: %w", err)
+	}
+	return plaintext, nil
+}
+
+// aead returns the cipher of the data key of the project, creating the key if create is set
+func (s *Sealer) aead(ctx context.Context, projectID uuid.UUID, create bool) (cipher.AEAD, error) {
+	now := time.Now()
+	s.mu.Lock()
+	if k, ok := s.keys[projectID]; ok && now.Before(k.until) {
+		s.mu.Unlock()
+		return k.aead, nil
+	}
+	s.mu.Unlock()
+
+	k, err := s.store.Get(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("get data key: %w", err)
+	}
+
+	var plaintext []byte
+	switch {
+	case k == nil && !create:
+		return nil, fmt.Errorf("project %s has no data key", projectID)
+	case k == nil:
+		var wrapped []byte
+		plaintext, wrapped, err = s.kms.GenerateDataKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("generate data key: %w", err)
+		}
+		k, err = s.store.Create(ctx, &model.ProjectDataKey{
+			ProjectID:  projectID,
+			KMS:        s.kms.Name(),
+			KeyID:      s.kms.KeyID(),
+			WrappedKey: wrapped,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("store data key: %w", err)
+		}
+		// Another request created the key first
+		if !bytes.Equal(k.WrappedKey, wrapped) {
+			plaintext = nil
+		}
+	}
+	if plaintext == nil {
+		if k.KMS != s.kms.Name() {
+			return nil, fmt.Errorf("data key of project %s was wrapped by the %s kms, not %s", projectID, k.KMS, s.kms.Name())
+		}
+		plaintext, err = s.kms.Decrypt(ctx, k.WrappedKey, k.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key: %w", err)
+		}
+	}
+
+	aead, err := newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if s.ttl > 0 {
+		s.mu.Lock()
+		s.sweep(now)
+		s.keys[projectID] = cachedKey{aead: aead, until: now.Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return aead, nil
+}
+
+// sweep drops expired data keys, called with mu held
+func (s *Sealer) sweep(now time.Time) {
+	for id, k := range s.keys {
+		if !now.Before(k.until) {
+			delete(s.keys, id)
+		}
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,131 @@
+package envelope
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsCfg "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+// Names of the supported KMS
+const (
+	KMSLocal = "local"
+	KMSAWS   = "aws"
+)
+
+const dataKeyLen = 32
+
+// localDataKeyAAD binds wrapped data keys to their use
+var localDataKeyAAD = []byte("acontext data key")
+
+// localKMS wraps data keys with a master key from the config, for deployments without a cloud KMS
+type localKMS struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// NewLocalKMS returns a KMS wrapping data keys with masterKey, the base64 of 32 random bytes
+func NewLocalKMS(masterKey string) (KMS, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(masterKey))
+	if err != nil {
+		return nil, fmt.Errorf("decode envelope master key: %w", err)
+	}
+	if len(key) != dataKeyLen {
+		return nil, fmt.Errorf("envelope master key must be %d bytes, got %d", dataKeyLen, len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	// The key ID tells master keys apart without revealing them
+	sum := sha256.Sum256(key)
+	return &localKMS{aead: aead, keyID: "local:" + hex.EncodeToString(sum[:8])}, nil
+}
+
+func (k *localKMS) Name() string  { return KMSLocal }
+func (k *localKMS) KeyID() string { return k.keyID }
+
+func (k *localKMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	key := make([]byte, dataKeyLen)
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return key, k.aead.Seal(nonce, nonce, key, localDataKeyAAD), nil
+}
+
+func (k *localKMS) Decrypt(ctx context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	if keyID != k.keyID {
+		return nil, fmt.Errorf("data key was wrapped by master key %s, not %s", keyID, k.keyID)
+	}
+	if len(wrapped) < nonceLen {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	return k.aead.Open(nil, wrapped[:nonceLen], wrapped[nonceLen:], localDataKeyAAD)
+}
+
+// awsKMS wraps data keys with a key of AWS KMS, using the default AWS credentials
+type awsKMS struct {
+	keyID  string
+	client *kms.Client
+}
+
+// NewAWSKMS returns a KMS wrapping data keys with the configured AWS KMS key
+func NewAWSKMS(ctx context.Context, cfg *config.Config) (KMS, error) {
+	if cfg.Envelope.KeyID == "" {
+		return nil, errors.New("envelope key id is empty")
+	}
+	region := cfg.Envelope.Region
+	if region == "" {
+		region = cfg.S3.Region
+	}
+	acfg, err := awsCfg.LoadDefaultConfig(ctx, awsCfg.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	client := kms.NewFromConfig(acfg, func(o *kms.Options) {
+		if cfg.Envelope.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Envelope.Endpoint)
+		}
+	})
+	return &awsKMS{keyID: cfg.Envelope.KeyID, client: client}, nil
+}
+
+func (k *awsKMS) Name() string  { return KMSAWS }
+func (k *awsKMS) KeyID() string { return k.keyID }
+
+func (k *awsKMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("kms generate data key: %w", err)
+	}
+	return out.Plaintext, out.CiphertextBlob, nil
+}
+
+func (k *awsKMS) Decrypt(ctx context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt: %w", err)
+	}
+	return out.Plaintext, nil
+}
@@ -168,6 +168,69 @@ func (c *CoreClient) InsertBlock(ctx context.Context, projectID, spaceID uuid.UU
 	return &result, nil
 }
 
+// EmbedRequest represents the request for embedding texts
+type EmbedRequest struct {
+	Texts []string `json:"texts"`
+	// Phase is "query" to embed search queries, documents are embedded by default
+	Phase string `json:"phase,omitempty"`
+}
+
+// EmbedResponse represents the response from embed endpoint
+type EmbedResponse struct {
+	Embeddings   [][]float32 `json:"embeddings"`
+	Model        string      `json:"model"`
+	PromptTokens int         `json:"prompt_tokens"`
+	TotalTokens  int         `json:"total_tokens"`
+}
+
+// Embed calls the embed endpoint, the texts are embedded with the model of the block embeddings
+func (c *CoreClient) Embed(ctx context.Context, projectID uuid.UUID, req EmbedRequest) (*EmbedResponse, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/project/%s/embed", c.BaseURL, projectID.String())
+
+	// Marshal request body
+	body, err := sonic.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	// Important: propagate trace context to downstream service
+	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.Logger.Error("embed request failed",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("body", string(respBody)))
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result EmbedResponse
+	if err := sonic.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	if len(result.Embeddings) != len(req.Texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(result.Embeddings), len(req.Texts))
+	}
+
+	return &result, nil
+}
+
 // FlagResponse represents the response with status and error message
 type FlagResponse struct {
 	Status int    `json:"status"`
@@ -0,0 +1,139 @@
+package incident
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"go.uber.org/zap"
+)
+
+// Incident is a panic recovered while serving a request
+type Incident struct {
+	ID      string // uuid returned to the client
+	Panic   string
+	Stack   string
+	Method  string
+	Path    string
+	TraceID string
+	At      time.Time
+}
+
+// Reporter sends incidents to the store endpoint of a Sentry-compatible error tracker
+type Reporter struct {
+	endpoint   string
+	auth       string
+	env        string
+	serverName string
+	client     *http.Client
+	log        *zap.Logger
+}
+
+// NewReporter returns the reporter of the configured DSN, or nil if none is configured.
+// A DSN looks like https://<public key>@<host>/<project id>.
+func NewReporter(cfg *config.Config, log *zap.Logger) (*Reporter, error) {
+	if cfg.Incidents.ReportDSN == "" {
+		return nil, nil
+	}
+	dsn, err := url.Parse(cfg.Incidents.ReportDSN)
+	if err != nil {
+		return nil, fmt.Errorf("parse incident report dsn: %w", err)
+	}
+	projectID := strings.Trim(dsn.Path, "/")
+	if dsn.User == nil || dsn.User.Username() == "" || projectID == "" || dsn.Host == "" {
+		return nil, fmt.Errorf("incident report dsn must look like https://<key>@<host>/<project id>")
+	}
+
+	timeout := time.Duration(cfg.Incidents.ReportTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	serverName, _ := os.Hostname()
+	return &Reporter{
+		endpoint:   fmt.Sprintf("%s://%s/api/%s/store/", dsn.Scheme, dsn.Host, projectID),
+		auth:       fmt.Sprintf("Sentry sentry_version=7, sentry_client=acontext-api/1.0, sentry_key=%s", dsn.User.Username()),
+		env:        cfg.App.Env,
+		serverName: serverName,
+		client:     &http.Client{Timeout: timeout},
+		log:        log,
+	}, nil
+}
+
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Transaction string            `json:"transaction"`
+	Request     eventRequest      `json:"request"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra"`
+}
+
+type eventRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// Report sends an incident in the background, failures are only logged
+func (r *Reporter) Report(inc Incident) {
+	if r == nil {
+		return
+	}
+	ev := event{
+		// event ids are uuids without dashes
+		EventID:     strings.ReplaceAll(inc.ID, "-", ""),
+		Timestamp:   inc.At.UTC().Format(time.RFC3339Nano),
+		Level:       "fatal",
+		Platform:    "go",
+		Logger:      "acontext-api",
+		ServerName:  r.serverName,
+		Environment: r.env,
+		Message:     "panic: " + inc.Panic,
+		Transaction: inc.Method + " " + inc.Path,
+		Request:     eventRequest{Method: inc.Method, URL: inc.Path},
+		Extra:       map[string]string{"stack": inc.Stack},
+	}
+	if inc.TraceID != "" {
+		ev.Tags = map[string]string{"trace_id": inc.TraceID}
+	}
+
+	go func() {
+		if err := r.send(context.Background(), ev); err != nil {
+			r.log.Warn("failed to report incident", zap.String("incident_id", inc.ID), zap.Error(err))
+		}
+	}()
+}
+
+func (r *Reporter) send(ctx context.Context, ev event) error {
+	body, err := sonic.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error tracker responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	openai "github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ProviderOpenAI talks to any API implementing OpenAI chat completions
+const ProviderOpenAI = "openai"
+
+// Client generates text with a language model
+type Client interface {
+	Complete(ctx context.Context, system string, prompt string) (string, error)
+}
+
+// NewClient returns the client of the configured provider, or nil if no provider is configured
+func NewClient(cfg *config.Config) (Client, error) {
+	switch strings.ToLower(cfg.LLM.Provider) {
+	case "":
+		return nil, nil
+	case ProviderOpenAI:
+		return NewOpenAIClient(cfg.LLM.BaseURL, cfg.LLM.APIKey, cfg.LLM.Model), nil
+	default:
+		return nil, fmt.Errorf("unsupported llm provider %q", cfg.LLM.Provider)
+	}
+}
+
+// OpenAIClient calls the chat completions endpoint of an OpenAI-compatible API
+type OpenAIClient struct {
+	client openai.Client
+	model  string
+}
+
+func NewOpenAIClient(baseURL, apiKey, model string) *OpenAIClient {
+	propagator := otel.GetTextMapPropagator()
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithRequestTimeout(120 * time.Second),
+		option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+			propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+			return next(req)
+		}),
+	}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(strings.TrimRight(baseURL, "/")+"/"))
+	}
+	return &OpenAIClient{
+		client: openai.NewClient(opts...),
+		model:  model,
+	}
+}
+
+func (c *OpenAIClient) Complete(ctx context.Context, system string, prompt string) (string, error) {
+	messages := []openai.ChatCompletionMessageParamUnion{}
+	if system != "" {
+		messages = append(messages, openai.SystemMessage(system))
+	}
+	messages = append(messages, openai.UserMessage(prompt))
+
+	completion, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model:    c.model,
+		Messages: messages,
+	})
+	if err != nil {
+		return "", fmt.Errorf("chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("response has no choices")
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
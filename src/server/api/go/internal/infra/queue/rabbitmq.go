@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/bits"
+	"sync"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/pkg/timing"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -46,6 +49,8 @@ type Publisher struct {
 	ch  *amqp.Channel
 	log *zap.Logger
 	cfg *config.Config
+
+	declared sync.Map // queues declared by PublishDelayedJSON
 }
 
 type Consumer struct {
@@ -69,6 +74,8 @@ func NewPublisher(conn *amqp.Connection, log *zap.Logger, cfg *config.Config) (*
 func (p *Publisher) Close() error { return p.ch.Close() }
 
 func (p *Publisher) PublishJSON(ctx context.Context, exchangeName string, routingKey string, body any) error {
+	defer timing.Track(ctx, timing.MQ)()
+
 	b, err := sonic.Marshal(body)
 	if err != nil {
 		return err
@@ -108,6 +115,47 @@ func (p *Publisher) PublishJSON(ctx context.Context, exchangeName string, routin
 	return nil
 }
 
+// maxDelayTier bounds the delay queues of PublishDelayedJSON to 2^maxDelayTier seconds, about a year
+const maxDelayTier = 25
+
+// PublishDelayedJSON publishes body to the queue queueName once delay has passed, without a delay plugin.
+// The message waits in a delay queue dead-lettering to queueName, one queue per power of two seconds, the longest not
+// exceeding delay. Every delay queue has a single TTL so it stays FIFO, a long delay never holds a shorter one back.
+// The consumer receives the message early unless delay is a power of two and must publish it again with the remaining delay,
+// each hop at least halves it.
+func (p *Publisher) PublishDelayedJSON(ctx context.Context, queueName string, body any, delay time.Duration) error {
+	if err := p.declareQueue(queueName, nil); err != nil {
+		return err
+	}
+	if delay < time.Second {
+		return p.PublishJSON(ctx, "", queueName, body)
+	}
+
+	tier := min(bits.Len64(uint64(delay/time.Second))-1, maxDelayTier)
+	ttl := int64(1) << tier
+	delayQueue := fmt.Sprintf("%s.delay.%ds", queueName, ttl)
+	if err := p.declareQueue(delayQueue, amqp.Table{
+		"x-message-ttl":             ttl * 1000,
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queueName,
+	}); err != nil {
+		return err
+	}
+	return p.PublishJSON(ctx, "", delayQueue, body)
+}
+
+// declareQueue declares a durable queue once per publisher
+func (p *Publisher) declareQueue(name string, args amqp.Table) error {
+	if _, ok := p.declared.Load(name); ok {
+		return nil
+	}
+	if _, err := p.ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		return fmt.Errorf("declare queue %s: %w", name, err)
+	}
+	p.declared.Store(name, struct{}{})
+	return nil
+}
+
 func NewConsumer(conn *amqp.Connection, queueName string, prefetch int, log *zap.Logger, cfg *config.Config) (*Consumer, error) {
 	ch, err := conn.Channel()
 	if err != nil {
@@ -126,6 +174,53 @@ func NewConsumer(conn *amqp.Connection, queueName string, prefetch int, log *zap
 	return &Consumer{ch: ch, q: q, log: log, cfg: cfg}, nil
 }
 
+// NewBroadcastConsumer declares a server-named, exclusive queue bound to the exchange, so every
+// API instance receives its own copy of each message routed with routingKey.
+func NewBroadcastConsumer(conn *amqp.Connection, exchangeName string, routingKey string, log *zap.Logger, cfg *config.Config) (*Consumer, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(cfg.RabbitMQ.Prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	// Same declaration as the core consumers, so it's idempotent whoever starts first
+	if err := ch.ExchangeDeclare(exchangeName, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.QueueBind(q.Name, routingKey, exchangeName, false, nil); err != nil {
+		return nil, err
+	}
+	return &Consumer{ch: ch, q: q, log: log, cfg: cfg}, nil
+}
+
+// NewBoundConsumer declares a durable queue bound to the exchange, shared by all API instances,
+// so each message routed with routingKey is handled once.
+func NewBoundConsumer(conn *amqp.Connection, queueName string, exchangeName string, routingKey string, log *zap.Logger, cfg *config.Config) (*Consumer, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(cfg.RabbitMQ.Prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	if err := ch.ExchangeDeclare(exchangeName, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return nil, err
+	}
+	q, err := ch.QueueDeclare(queueName, true, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.QueueBind(q.Name, routingKey, exchangeName, false, nil); err != nil {
+		return nil, err
+	}
+	return &Consumer{ch: ch, q: q, log: log, cfg: cfg}, nil
+}
+
 func (c *Consumer) Close() error { return c.ch.Close() }
 
 // Handle is a consumption helper function that will Nack and requeue when the handler returns an error.
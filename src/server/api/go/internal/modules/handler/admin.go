@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// AdminHandler serves the cross-project endpoints, authorized with the root admin token instead of a project key
+type AdminHandler struct {
+	cloneSvc service.CloneService
+}
+
+func NewAdminHandler(cloneSvc service.CloneService) *AdminHandler {
+	return &AdminHandler{cloneSvc: cloneSvc}
+}
+
+type CloneReq struct {
+	TargetProjectID string `form:"target_project_id" json:"target_project_id" binding:"required,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// CloneSpace godoc
+//
+//	@Summary		Clone space into another project
+//	@Description	Copy a space with its blocks and SOP steps into the target project. Tools used by SOP steps are matched by name in the target project and created when missing. Requires the root admin token.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string				true	"Space ID"	format(uuid)
+//	@Param			payload		body	handler.CloneReq	true	"Clone payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Space}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/admin/space/{space_id}/clone [post]
+func (h *AdminHandler) CloneSpace(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := CloneReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	space, err := h.cloneSvc.CloneSpace(c.Request.Context(), spaceID, uuid.MustParse(req.TargetProjectID))
+	if err != nil {
+		cloneErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: space})
+}
+
+// CloneSession godoc
+//
+//	@Summary		Clone session into another project
+//	@Description	Copy a session with all its messages, branches and files into the target project. The copy is not connected to a space. Requires the root admin token.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string				true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.CloneReq	true	"Clone payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/admin/session/{session_id}/clone [post]
+func (h *AdminHandler) CloneSession(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := CloneReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	session, err := h.cloneSvc.CloneSession(c.Request.Context(), sessionID, uuid.MustParse(req.TargetProjectID))
+	if err != nil {
+		cloneErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: session})
+}
+
+func cloneErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCloneSpaceNotFound), errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrCloneTargetProjectNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
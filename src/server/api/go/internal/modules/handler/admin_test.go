@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCloneService struct {
+	mock.Mock
+}
+
+func (m *MockCloneService) CloneSpace(ctx context.Context, spaceID uuid.UUID, targetProjectID uuid.UUID) (*model.Space, error) {
+	args := m.Called(ctx, spaceID, targetProjectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Space), args.Error(1)
+}
+
+func (m *MockCloneService) CloneSession(ctx context.Context, sessionID uuid.UUID, targetProjectID uuid.UUID) (*model.Session, error) {
+	args := m.Called(ctx, sessionID, targetProjectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func TestAdminHandler_CloneSession(t *testing.T) {
+	sessionID := uuid.New()
+	targetID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockCloneService)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"target_project_id":"` + targetID.String() + `"}`,
+			setup: func(svc *MockCloneService) {
+				svc.On("CloneSession", mock.Anything, sessionID, targetID).Return(&model.Session{ID: uuid.New(), ProjectID: targetID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid target project id",
+			body:           `{"target_project_id":"invalid"}`,
+			setup:          func(svc *MockCloneService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "target project not found",
+			body: `{"target_project_id":"` + targetID.String() + `"}`,
+			setup: func(svc *MockCloneService) {
+				svc.On("CloneSession", mock.Anything, sessionID, targetID).Return(nil, service.ErrCloneTargetProjectNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "service layer error",
+			body: `{"target_project_id":"` + targetID.String() + `"}`,
+			setup: func(svc *MockCloneService) {
+				svc.On("CloneSession", mock.Anything, sessionID, targetID).Return(nil, errors.New("copy failed"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockCloneService{}
+			tt.setup(mockService)
+			handler := NewAdminHandler(mockService)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/admin/session/:session_id/clone", handler.CloneSession)
+
+			req := httptest.NewRequest("POST", "/admin/session/"+sessionID.String()+"/clone", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_CloneSpace(t *testing.T) {
+	spaceID := uuid.New()
+	targetID := uuid.New()
+
+	mockService := &MockCloneService{}
+	mockService.On("CloneSpace", mock.Anything, spaceID, targetID).Return(nil, service.ErrCloneSpaceNotFound)
+	handler := NewAdminHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/space/:space_id/clone", handler.CloneSpace)
+
+	req := httptest.NewRequest("POST", "/admin/space/"+spaceID.String()+"/clone", strings.NewReader(`{"target_project_id":"`+targetID.String()+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type AnnotationHandler struct {
+	svc service.AnnotationService
+}
+
+func NewAnnotationHandler(s service.AnnotationService) *AnnotationHandler {
+	return &AnnotationHandler{svc: s}
+}
+
+type ExportAnnotationsReq struct {
+	SessionIDs []string `form:"session_ids" collection_format:"csv" json:"session_ids" binding:"omitempty,max=100,dive,uuid"`
+	SpaceID    string   `form:"space_id" json:"space_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Roles      []string `form:"roles,default=assistant" collection_format:"csv" json:"roles" binding:"omitempty,dive,oneof=user assistant system" example:"assistant"`
+	// Labeler exports the messages this labeler did not annotate yet, empty exports the messages without any annotation
+	Labeler          string `form:"labeler" json:"labeler" example:"scale-batch-12"`
+	IncludeAnnotated bool   `form:"include_annotated,default=false" json:"include_annotated" example:"false"`
+	ContextMessages  int    `form:"context_messages,default=4" json:"context_messages" binding:"min=0,max=50" example:"4"`
+	Limit            int    `form:"limit,default=100" json:"limit" binding:"min=1,max=1000" example:"100"`
+	Cursor           string `form:"cursor" json:"cursor"`
+}
+
+// ExportAnnotations godoc
+//
+//	@Summary		Export messages for labeling
+//	@Description	Export a labeling bundle: the messages of the project that need review, oldest first, each with its parts and the messages preceding it on its branch as context. By default the assistant messages without any annotation are exported; with labeler, the messages this labeler did not annotate yet. Page through large exports with next_cursor, then import the labels with POST /annotation/import.
+//	@Tags			annotation
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_ids			query	[]string	false	"Only messages of these sessions"	collectionFormat(csv)
+//	@Param			space_id			query	string		false	"Only messages of the sessions of this space"	format(uuid)
+//	@Param			roles				query	[]string	false	"Roles of the exported messages, default assistant"	collectionFormat(csv)	Enums(user,assistant,system)
+//	@Param			labeler				query	string		false	"Export the messages this labeler did not annotate yet"
+//	@Param			include_annotated	query	boolean		false	"Also export annotated messages, default false"
+//	@Param			context_messages	query	integer		false	"Preceding messages included as context, default 4, max 50"
+//	@Param			limit				query	integer		false	"Messages per bundle, default 100, max 1000"
+//	@Param			cursor				query	string		false	"Cursor of the next bundle"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.AnnotationBundle}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/annotation/export [get]
+func (h *AnnotationHandler) ExportAnnotations(c *gin.Context) {
+	req := ExportAnnotationsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	filter := repo.ReviewFilter{Roles: req.Roles, Labeler: req.Labeler, IncludeAnnotated: req.IncludeAnnotated}
+	for _, id := range req.SessionIDs {
+		filter.SessionIDs = append(filter.SessionIDs, uuid.MustParse(id))
+	}
+	if req.SpaceID != "" {
+		spaceID := uuid.MustParse(req.SpaceID)
+		filter.SpaceID = &spaceID
+	}
+
+	out, err := h.svc.Export(c.Request.Context(), service.ExportAnnotationsInput{
+		ProjectID:       project.ID,
+		Filter:          filter,
+		ContextMessages: req.ContextMessages,
+		Limit:           req.Limit,
+		Cursor:          req.Cursor,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type ImportAnnotationsReq struct {
+	// Labeler identifies the tool or team, its previous annotations of the same messages are replaced
+	Labeler     string                       `json:"labeler" binding:"required,max=128" example:"scale-batch-12"`
+	Annotations []service.ImportedAnnotation `json:"annotations" binding:"required,min=1,max=1000,dive"`
+}
+
+// ImportAnnotations godoc
+//
+//	@Summary		Import annotations
+//	@Description	Import up to 1000 completed annotations of a labeler, e.g. from an external labeling tool. A message keeps one annotation per labeler, importing again replaces it. Messages that are not in the project are listed in not_found.
+//	@Tags			annotation
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.ImportAnnotationsReq	true	"ImportAnnotations payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ImportAnnotationsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/annotation/import [post]
+func (h *AnnotationHandler) ImportAnnotations(c *gin.Context) {
+	req := ImportAnnotationsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Import(c.Request.Context(), service.ImportAnnotationsInput{
+		ProjectID:   project.ID,
+		Labeler:     req.Labeler,
+		Annotations: req.Annotations,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrAnnotationLabelerRequired) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type AnnotateMessageReq struct {
+	// Labeler identifies the reviewer, its previous annotation of the message is replaced
+	Labeler  string                 `json:"labeler" binding:"required,max=128" example:"alice@example.com"`
+	Reaction string                 `json:"reaction" binding:"omitempty,oneof=up down" example:"up" enums:"up,down"`
+	Label    string                 `json:"label" binding:"max=128" example:"helpful"`
+	Score    *float64               `json:"score" example:"0.8"`
+	Comment  string                 `json:"comment" binding:"max=10000" example:"Correct, but could be shorter."`
+	Data     map[string]interface{} `json:"data"`
+}
+
+// AnnotateMessage godoc
+//
+//	@Summary		Annotate message
+//	@Description	Store the feedback of a reviewer on a message: a thumbs up or down reaction, a label, a score, a free-text comment and structured data, at least one of reaction, label, score and comment. A message keeps one annotation per labeler, annotating again replaces it. The feedback of a session is totalled by GET /session/{session_id}/usage.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string						true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string						true	"Message ID"	format(uuid)
+//	@Param			payload		body	handler.AnnotateMessageReq	true	"AnnotateMessage payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.MessageAnnotation}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id}/annotations [post]
+func (h *AnnotationHandler) AnnotateMessage(c *gin.Context) {
+	req := AnnotateMessageReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, sessionID, messageID, ok := annotationTarget(c)
+	if !ok {
+		return
+	}
+
+	out, err := h.svc.Annotate(c.Request.Context(), service.AnnotateMessageInput{
+		ProjectID: project.ID,
+		SessionID: sessionID,
+		MessageID: messageID,
+		Labeler:   req.Labeler,
+		Reaction:  req.Reaction,
+		Label:     req.Label,
+		Score:     req.Score,
+		Comment:   req.Comment,
+		Data:      req.Data,
+	})
+	if err != nil {
+		respondAnnotationErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// ListMessageAnnotations godoc
+//
+//	@Summary		List message annotations
+//	@Description	List the annotations of a message, one per labeler, oldest first.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string	true	"Message ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.MessageAnnotation}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id}/annotations [get]
+func (h *AnnotationHandler) ListMessageAnnotations(c *gin.Context) {
+	project, sessionID, messageID, ok := annotationTarget(c)
+	if !ok {
+		return
+	}
+
+	out, err := h.svc.ListForMessage(c.Request.Context(), project.ID, sessionID, messageID)
+	if err != nil {
+		respondAnnotationErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type DeleteMessageAnnotationReq struct {
+	Labeler string `form:"labeler" json:"labeler" binding:"required" example:"alice@example.com"`
+}
+
+// DeleteMessageAnnotation godoc
+//
+//	@Summary		Delete message annotation
+//	@Description	Delete the annotation of a labeler on a message.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string	true	"Message ID"	format(uuid)
+//	@Param			labeler		query	string	true	"Labeler of the annotation"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id}/annotations [delete]
+func (h *AnnotationHandler) DeleteMessageAnnotation(c *gin.Context) {
+	req := DeleteMessageAnnotationReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, sessionID, messageID, ok := annotationTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.Remove(c.Request.Context(), project.ID, sessionID, messageID, req.Labeler); err != nil {
+		respondAnnotationErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// annotationTarget reads the project and the session and message path parameters, responding 400 when they are invalid
+func annotationTarget(c *gin.Context) (*model.Project, uuid.UUID, uuid.UUID, bool) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return nil, uuid.Nil, uuid.Nil, false
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return nil, uuid.Nil, uuid.Nil, false
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return nil, uuid.Nil, uuid.Nil, false
+	}
+	return project, sessionID, messageID, true
+}
+
+func respondAnnotationErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound), errors.Is(err, service.ErrAnnotationNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+	case errors.Is(err, service.ErrAnnotationLabelerRequired), errors.Is(err, service.ErrAnnotationEmpty):
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
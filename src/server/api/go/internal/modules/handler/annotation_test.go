@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAnnotationService struct {
+	mock.Mock
+}
+
+func (m *MockAnnotationService) Export(ctx context.Context, in service.ExportAnnotationsInput) (*service.AnnotationBundle, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AnnotationBundle), args.Error(1)
+}
+
+func (m *MockAnnotationService) Import(ctx context.Context, in service.ImportAnnotationsInput) (*service.ImportAnnotationsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ImportAnnotationsOutput), args.Error(1)
+}
+
+func (m *MockAnnotationService) Annotate(ctx context.Context, in service.AnnotateMessageInput) (*model.MessageAnnotation, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.MessageAnnotation), args.Error(1)
+}
+
+func (m *MockAnnotationService) ListForMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) ([]model.MessageAnnotation, error) {
+	args := m.Called(ctx, projectID, sessionID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.MessageAnnotation), args.Error(1)
+}
+
+func (m *MockAnnotationService) Remove(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, labeler string) error {
+	args := m.Called(ctx, projectID, sessionID, messageID, labeler)
+	return args.Error(0)
+}
+
+func setupAnnotationRouter(h *AnnotationHandler, projectID uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+	})
+	r.GET("/annotation/export", h.ExportAnnotations)
+	r.POST("/annotation/import", h.ImportAnnotations)
+	r.POST("/session/:session_id/messages/:message_id/annotations", h.AnnotateMessage)
+	r.DELETE("/session/:session_id/messages/:message_id/annotations", h.DeleteMessageAnnotation)
+	return r
+}
+
+func TestAnnotationHandler_ExportAnnotations(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockAnnotationService)
+		expectedStatus int
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Export", mock.Anything, mock.MatchedBy(func(in service.ExportAnnotationsInput) bool {
+					return in.ProjectID == projectID && in.Limit == 100 && in.ContextMessages == 4 &&
+						assert.ObjectsAreEqual([]string{"assistant"}, in.Filter.Roles) && !in.Filter.IncludeAnnotated
+				})).Return(&service.AnnotationBundle{Items: []service.AnnotationBundleItem{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "sessions of a labeler",
+			query: "?session_ids=" + sessionID.String() + "&labeler=team-a&context_messages=0",
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Export", mock.Anything, mock.MatchedBy(func(in service.ExportAnnotationsInput) bool {
+					return in.Filter.Labeler == "team-a" && in.ContextMessages == 0 &&
+						assert.ObjectsAreEqual([]uuid.UUID{sessionID}, in.Filter.SessionIDs)
+				})).Return(&service.AnnotationBundle{Items: []service.AnnotationBundleItem{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid session id",
+			query:          "?session_ids=abc",
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "limit too large",
+			query:          "?limit=5000",
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockAnnotationService{}
+			tt.setup(svc)
+			router := setupAnnotationRouter(NewAnnotationHandler(svc), projectID)
+
+			req := httptest.NewRequest("GET", "/annotation/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAnnotationHandler_ImportAnnotations(t *testing.T) {
+	projectID := uuid.New()
+	messageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockAnnotationService)
+		expectedStatus int
+	}{
+		{
+			name: "import",
+			body: `{"labeler":"team-a","annotations":[{"message_id":"` + messageID.String() + `","label":"good","score":1}]}`,
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Import", mock.Anything, mock.MatchedBy(func(in service.ImportAnnotationsInput) bool {
+					return in.ProjectID == projectID && in.Labeler == "team-a" && len(in.Annotations) == 1 && *in.Annotations[0].Score == 1
+				})).Return(&service.ImportAnnotationsOutput{Imported: 1, NotFound: []uuid.UUID{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing labeler",
+			body:           `{"annotations":[{"message_id":"` + messageID.String() + `","label":"good"}]}`,
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no annotations",
+			body:           `{"labeler":"team-a","annotations":[]}`,
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockAnnotationService{}
+			tt.setup(svc)
+			router := setupAnnotationRouter(NewAnnotationHandler(svc), projectID)
+
+			req := httptest.NewRequest("POST", "/annotation/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAnnotationHandler_AnnotateMessage(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	path := "/session/" + sessionID.String() + "/messages/" + messageID.String() + "/annotations"
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		setup          func(*MockAnnotationService)
+		expectedStatus int
+	}{
+		{
+			name: "thumbs up",
+			path: path,
+			body: `{"labeler":"alice","reaction":"up","comment":"nice"}`,
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Annotate", mock.Anything, mock.MatchedBy(func(in service.AnnotateMessageInput) bool {
+					return in.ProjectID == projectID && in.SessionID == sessionID && in.MessageID == messageID &&
+						in.Labeler == "alice" && in.Reaction == "up" && in.Comment == "nice"
+				})).Return(&model.MessageAnnotation{MessageID: messageID, Labeler: "alice", Reaction: "up"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid reaction",
+			path:           path,
+			body:           `{"labeler":"alice","reaction":"meh"}`,
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "empty annotation",
+			path: path,
+			body: `{"labeler":"alice"}`,
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Annotate", mock.Anything, mock.Anything).Return(nil, service.ErrAnnotationEmpty)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "message not in session",
+			path: path,
+			body: `{"labeler":"alice","label":"wrong"}`,
+			setup: func(svc *MockAnnotationService) {
+				svc.On("Annotate", mock.Anything, mock.Anything).Return(nil, service.ErrMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid message id",
+			path:           "/session/" + sessionID.String() + "/messages/abc/annotations",
+			body:           `{"labeler":"alice","reaction":"down"}`,
+			setup:          func(svc *MockAnnotationService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockAnnotationService{}
+			tt.setup(svc)
+			router := setupAnnotationRouter(NewAnnotationHandler(svc), projectID)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAnnotationHandler_DeleteMessageAnnotation(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	path := "/session/" + sessionID.String() + "/messages/" + messageID.String() + "/annotations"
+
+	svc := &MockAnnotationService{}
+	svc.On("Remove", mock.Anything, projectID, sessionID, messageID, "alice").Return(nil).Once()
+	svc.On("Remove", mock.Anything, projectID, sessionID, messageID, "bob").Return(service.ErrAnnotationNotFound).Once()
+	router := setupAnnotationRouter(NewAnnotationHandler(svc), projectID)
+
+	for labeler, status := range map[string]int{"alice": http.StatusOK, "bob": http.StatusNotFound, "": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", path+"?labeler="+labeler, nil))
+		assert.Equal(t, status, w.Code, labeler)
+	}
+	svc.AssertExpectations(t)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type ApplyHandler struct {
+	svc service.ApplyService
+}
+
+func NewApplyHandler(s service.ApplyService) *ApplyHandler {
+	return &ApplyHandler{svc: s}
+}
+
+type ApplyManifestReq struct {
+	DryRun bool `form:"dry_run" json:"dry_run" example:"false"`
+	Prune  bool `form:"prune" json:"prune" example:"false"`
+}
+
+// ApplyManifest godoc
+//
+//	@Summary		Apply project manifest
+//	@Description	Reconcile the project with a declarative manifest, written in YAML or JSON, of its spaces, the pages at the root of them with their blocks, its tool references and its notification webhook. Spaces and tools are matched by name and pages by title within their space: missing ones are created and the others updated to match. A list left out of the manifest leaves the resources of its kind as they are; with prune, the resources missing from a list are deleted. The blocks of a page, when listed, replace the current blocks of the page if they differ. With dry_run the changes are only returned. All changes are written in one transaction. A page with more blocks than the server hard limit of children is refused with 422.
+//	@Tags			project
+//	@Accept			plain
+//	@Produce		json
+//	@Param			dry_run	query	bool	false	"List the changes without making them"	example(true)
+//	@Param			prune	query	bool	false	"Delete the spaces, pages and tools missing from the lists of the manifest"	example(false)
+//	@Param			payload	body	model.ProjectManifest	true	"Project manifest, YAML or JSON"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ApplyManifestOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/apply [post]
+func (h *ApplyHandler) ApplyManifest(c *gin.Context) {
+	req := ApplyManifestReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, service.MaxManifestBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if len(raw) > service.MaxManifestBytes {
+		msg := fmt.Sprintf("manifest is larger than %d bytes", service.MaxManifestBytes)
+		c.JSON(http.StatusRequestEntityTooLarge, serializer.Err(http.StatusRequestEntityTooLarge, msg, nil))
+		return
+	}
+	manifest, err := service.ParseProjectManifest(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.Apply(c.Request.Context(), service.ApplyManifestInput{
+		Project:  project,
+		Manifest: manifest,
+		Prune:    req.Prune,
+		DryRun:   req.DryRun,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidManifest) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		if limitExceeded(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockApplyService struct {
+	mock.Mock
+}
+
+func (m *MockApplyService) Apply(ctx context.Context, in service.ApplyManifestInput) (*service.ApplyManifestOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ApplyManifestOutput), args.Error(1)
+}
+
+func TestApplyHandler_ApplyManifest(t *testing.T) {
+	dryRun := mock.MatchedBy(func(in service.ApplyManifestInput) bool {
+		return in.DryRun && !in.Prune && len(*in.Manifest.Spaces) == 1
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		setup      func(*MockApplyService)
+		wantStatus int
+	}{
+		{
+			name:  "dry run",
+			query: "?dry_run=true",
+			body:  "spaces:\n  - name: docs\n",
+			setup: func(svc *MockApplyService) {
+				svc.On("Apply", mock.Anything, dryRun).Return(&service.ApplyManifestOutput{DryRun: true}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown field",
+			body:       "spaces:\n  - name: docs\n    color: red\n",
+			setup:      func(svc *MockApplyService) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid manifest",
+			body: `{"spaces": [{"name": ""}]}`,
+			setup: func(svc *MockApplyService) {
+				svc.On("Apply", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: space name is required", service.ErrInvalidManifest))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			body:       "spaces: []\n#" + strings.Repeat("x", service.MaxManifestBytes),
+			setup:      func(svc *MockApplyService) {},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockApplyService{}
+			tt.setup(svc)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: uuid.New()})
+			})
+			router.POST("/project/apply", NewApplyHandler(svc).ApplyManifest)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/project/apply"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/yaml")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
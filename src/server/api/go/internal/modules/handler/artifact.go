@@ -3,36 +3,47 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/fileparser"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/path"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tabular"
 )
 
 type ArtifactHandler struct {
-	svc service.ArtifactService
+	svc    service.ArtifactService
+	upload config.UploadCfg
 }
 
-func NewArtifactHandler(s service.ArtifactService) *ArtifactHandler {
-	return &ArtifactHandler{svc: s}
+func NewArtifactHandler(s service.ArtifactService, upload config.UploadCfg) *ArtifactHandler {
+	return &ArtifactHandler{svc: s, upload: upload}
 }
 
 type CreateArtifactReq struct {
 	FilePath string `form:"file_path" json:"file_path"` // Optional, defaults to "/"
 	Meta     string `form:"meta" json:"meta"`
+	// LeaseHolder is required to write a path locked with AcquireArtifactLease
+	LeaseHolder string `form:"lease_holder" json:"lease_holder"`
 }
 
 // UpsertArtifact godoc
 //
 //	@Summary		Upsert artifact
-//	@Description	Upload a file and create or update an artifact record under a disk
+//	@Description	Upload a file and create or update an artifact record under a disk. The content type is detected from the file content; if it contradicts the declared type, the detected type is stored, or the upload is rejected with 415 when the server is configured to reject mismatches.
 //	@Tags			artifact
 //	@Accept			multipart/form-data
 //	@Produce		json
@@ -40,8 +51,16 @@ type CreateArtifactReq struct {
 //	@Param			file_path	formData	string	false	"File path in the disk storage (optional, defaults to '/')"
 //	@Param			file		formData	file	true	"File to upload"
 //	@Param			meta		formData	string	false	"Custom metadata as JSON string (optional, system metadata will be stored under '__artifact_info__' key)"
+//	@Param			lease_holder	formData	string	false	"Holder of the lease on the path, required when the path is locked. Returns 409 if another holder owns the lease."
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Artifact}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/disk/{disk_id}/artifact [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Upload a file to disk\nwith open('report.pdf', 'rb') as f:\n    artifact = client.disks.upload_artifact(\n        disk_id='disk-uuid',\n        file=f,\n        file_path='/documents/',\n        meta={'category': 'reports', 'year': 2024}\n    )\nprint(f\"Uploaded artifact: {artifact.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\nimport fs from 'fs';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Upload a file to disk\nconst fileBuffer = fs.readFileSync('report.pdf');\nconst artifact = await client.disks.uploadArtifact('disk-uuid', {\n  file: fileBuffer,\n  filePath: '/documents/',\n  meta: { category: 'reports', year: 2024 }\n});\nconsole.log(`Uploaded artifact: ${artifact.id}`);\n","label":"JavaScript"}]
 func (h *ArtifactHandler) UpsertArtifact(c *gin.Context) {
@@ -68,6 +87,10 @@ func (h *ArtifactHandler) UpsertArtifact(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("file is required", err))
 		return
 	}
+	if err := checkUploads(h.upload, []*multipart.FileHeader{file}); err != nil {
+		respondUploadErr(c, err)
+		return
+	}
 
 	// Parse FilePath to extract path and filename
 	filePath, _ := path.SplitFilePath(req.FilePath)
@@ -100,19 +123,515 @@ func (h *ArtifactHandler) UpsertArtifact(c *gin.Context) {
 	}
 
 	artifactRecord, err := h.svc.Create(c.Request.Context(), service.CreateArtifactInput{
+		ProjectID:   project.ID,
+		DiskID:      diskID,
+		Path:        filePath,
+		Filename:    actualFilename,
+		FileHeader:  file,
+		UserMeta:    userMeta,
+		LeaseHolder: req.LeaseHolder,
+	})
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: artifactRecord})
+}
+
+type PresignArtifactUploadReq struct {
+	FilePath    string                 `json:"file_path" binding:"required" example:"/videos/demo.mp4"` // File path including filename
+	ContentType string                 `json:"content_type" example:"video/mp4"`                        // Declared type, defaults to application/octet-stream
+	Size        int64                  `json:"size" binding:"required,min=1" example:"4294967296"`      // Size of the file in bytes
+	SHA256      string                 `json:"sha256" binding:"required,len=64,hexadecimal" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	Meta        map[string]interface{} `json:"meta"`
+	Expire      int                    `json:"expire" binding:"omitempty,min=1" example:"3600"` // Expire time in seconds of the URLs and the upload, 0 uses the default of the project
+	// LeaseHolder is required to write a path locked with AcquireArtifactLease
+	LeaseHolder string `json:"lease_holder"`
+}
+
+// PresignArtifactUpload godoc
+//
+//	@Summary		Presign artifact upload
+//	@Description	Start an upload of a large file straight to S3, then record it with the finalize endpoint. A file up to 64 MiB is uploaded with a PUT of its bytes to url with the given headers; a larger one is split in parts of upload.part_size bytes, each sent with a PUT to the URL of its part, and the ETag header of each response is passed to finalize. When S3 already stores the content, no URL is returned and the upload can be finalized right away. S3 rejects a single PUT whose content does not match the sha256, the size and sha256 of an upload in parts are checked after finalize; the declared type is checked like on upsert. The URLs and the upload expire after expire seconds, defaulting to the presign policy of the project or else to 3600 seconds. Returns 402 when the file would not fit in the storage quota, and 403 when envelope encryption is enabled, since the content would reach S3 unsealed.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string								true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.PresignArtifactUploadReq	true	"PresignArtifactUpload payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.ArtifactUploadTicket}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/presign_upload [post]
+func (h *ArtifactHandler) PresignArtifactUpload(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := PresignArtifactUploadReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	target, ok := h.uploadTarget(c, req.FilePath, req.ContentType, req.Size, req.Meta)
+	if !ok {
+		return
+	}
+
+	expire, err := service.PresignExpire(project, req.Expire, time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	target.Project, target.DiskID = project, diskID
+	target.SHA256 = strings.ToLower(req.SHA256)
+	target.LeaseHolder, target.Expire = req.LeaseHolder, expire
+	ticket, err := h.svc.PresignUpload(c.Request.Context(), target)
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: ticket})
+}
+
+type UploadedPartReq struct {
+	PartNumber int32  `json:"part_number" binding:"required,min=1,max=10000" example:"1"`
+	ETag       string `json:"etag" binding:"required" example:"\"9b2cf535f27731c974343645a3985328\""` // ETag header of the response to the PUT of the part
+}
+
+type FinalizeArtifactUploadReq struct {
+	// Parts are required for an upload in parts, in any order
+	Parts []UploadedPartReq `json:"parts" binding:"omitempty,max=10000,dive"`
+	// LeaseHolder is required to write a path locked with AcquireArtifactLease
+	LeaseHolder string `json:"lease_holder"`
+}
+
+// FinalizeArtifactUpload godoc
+//
+//	@Summary		Finalize artifact upload
+//	@Description	Record the artifact of an upload started with presign_upload, replacing the artifact at its path. The uploaded content must match the declared size and sha256, else it is dropped with the upload and 422 is returned. The content type is detected from the content as on upsert. An upload in parts is assembled and 202 is returned with the upload: its content is checked in the background, then the artifact is created and the upload is gone, or the content is dropped and the upload lists the failure, as a GET of the upload shows. Returns 409 while the content has not been uploaded, and 404 once the upload is finalized or expired.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string								true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			upload_id	path	string								true	"Upload ID"	Format(uuid)
+//	@Param			payload		body	handler.FinalizeArtifactUploadReq	true	"FinalizeArtifactUpload payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Artifact}
+//	@Success		202	{object}	serializer.Response{data=model.ArtifactUpload}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/presign_upload/{upload_id}/finalize [post]
+func (h *ArtifactHandler) FinalizeArtifactUpload(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := FinalizeArtifactUploadReq{}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	uploadID, err := uuid.Parse(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	parts := make([]blob.CompletedPart, len(req.Parts))
+	for i, p := range req.Parts {
+		parts[i] = blob.CompletedPart{PartNumber: p.PartNumber, ETag: p.ETag}
+	}
+	// S3 completes a multipart upload from its parts in ascending order
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	finalized, err := h.svc.FinalizeUpload(c.Request.Context(), service.FinalizeArtifactUploadInput{
+		ProjectID:   project.ID,
+		DiskID:      diskID,
+		UploadID:    uploadID,
+		Parts:       parts,
+		LeaseHolder: req.LeaseHolder,
+	})
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	respondFinalizedUpload(c, finalized)
+}
+
+// respondFinalizedUpload responds with the artifact of a finalized upload, or with 202 and the upload while its
+// content is checked
+func respondFinalizedUpload(c *gin.Context, finalized *service.FinalizedArtifactUpload) {
+	if finalized.Artifact == nil {
+		c.JSON(http.StatusAccepted, serializer.Response{Data: finalized.Upload})
+		return
+	}
+	c.JSON(http.StatusCreated, serializer.Response{Data: finalized.Artifact})
+}
+
+// uploadTarget validates where and what an upload writes, it responds with the error and returns false when invalid
+func (h *ArtifactHandler) uploadTarget(c *gin.Context, filePathParam, contentType string, size int64, meta map[string]interface{}) (service.ArtifactUploadInput, bool) {
+	filePath, filename := path.SplitFilePath(filePathParam)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return service.ArtifactUploadInput{}, false
+	}
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("file_path must end with a filename")))
+		return service.ArtifactUploadInput{}, false
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := checkDirectUpload(h.upload, filename, contentType, size); err != nil {
+		respondUploadErr(c, err)
+		return service.ArtifactUploadInput{}, false
+	}
+
+	// Validate that user meta doesn't contain system reserved keys
+	for _, reservedKey := range model.GetReservedKeys() {
+		if _, exists := meta[reservedKey]; exists {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("reserved key '%s' is not allowed in user meta", reservedKey)))
+			return service.ArtifactUploadInput{}, false
+		}
+	}
+
+	return service.ArtifactUploadInput{
+		Path:     filePath,
+		Filename: filename,
+		MIME:     contentType,
+		SizeB:    size,
+		UserMeta: meta,
+	}, true
+}
+
+// respondArtifactUploadErr responds with the status of an error of an upload
+func respondArtifactUploadErr(c *gin.Context, err error) {
+	var exceeded *service.QuotaExceededError
+	switch {
+	case errors.As(err, &exceeded):
+		abortQuotaErr(c, err)
+	case errors.Is(err, service.ErrArtifactUploadSealed):
+		c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, err.Error(), nil))
+	case errors.Is(err, service.ErrArtifactUploadNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+	case errors.Is(err, service.ErrArtifactLeased), errors.Is(err, service.ErrArtifactUploadIncomplete):
+		c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+	case errors.Is(err, service.ErrInvalidArtifactUpload):
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+	case errors.Is(err, service.ErrArtifactUploadMismatch):
+		c.JSON(http.StatusUnprocessableEntity, serializer.Err(http.StatusUnprocessableEntity, err.Error(), nil))
+	case errors.Is(err, blob.ErrMIMEMismatch):
+		c.JSON(http.StatusUnsupportedMediaType, serializer.Err(http.StatusUnsupportedMediaType, err.Error(), nil))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+// defaultUploadSessionTTL is how long an upload session stays open when the request sets no ttl_seconds
+const defaultUploadSessionTTL = 24 * time.Hour
+
+type CreateArtifactUploadSessionReq struct {
+	FilePath    string                 `json:"file_path" binding:"required" example:"/checkpoints/model.safetensors"` // File path including filename
+	ContentType string                 `json:"content_type" example:"application/octet-stream"`                       // Declared type, defaults to application/octet-stream
+	Size        int64                  `json:"size" binding:"required,min=1" example:"4294967296"`                    // Size of the file in bytes
+	SHA256      string                 `json:"sha256" binding:"required,len=64,hexadecimal" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	Meta        map[string]interface{} `json:"meta"`
+	TTLSeconds  int                    `json:"ttl_seconds" binding:"omitempty,min=60,max=604800" example:"86400"` // How long the session stays open, defaults to 86400
+	// LeaseHolder is required to write a path locked with AcquireArtifactLease
+	LeaseHolder string `json:"lease_holder"`
+}
+
+// CreateUploadSession godoc
+//
+//	@Summary		Create artifact upload session
+//	@Description	Start a resumable upload of a large file through the API. The file is sent in upload.part_size parts, the last one holding the rest, with a PUT of each part to the parts endpoint; a part that failed is sent again. The received parts are listed with a GET of the session, to resume after a network failure. The session is then completed into the artifact, its size and sha256 are checked then. When S3 already stores the content, part_count is 0 and the session can be completed right away. The session expires after ttl_seconds. Returns 402 when the file would not fit in the storage quota, and 403 when envelope encryption is enabled, since the parts would reach S3 unsealed.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string									true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.CreateArtifactUploadSessionReq	true	"CreateUploadSession payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.ArtifactUploadSession}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/uploads [post]
+func (h *ArtifactHandler) CreateUploadSession(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := CreateArtifactUploadSessionReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	target, ok := h.uploadTarget(c, req.FilePath, req.ContentType, req.Size, req.Meta)
+	if !ok {
+		return
+	}
+
+	ttl := defaultUploadSessionTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	target.Project, target.DiskID = project, diskID
+	target.SHA256 = strings.ToLower(req.SHA256)
+	target.LeaseHolder, target.Expire = req.LeaseHolder, ttl
+	session, err := h.svc.StartUploadSession(c.Request.Context(), target)
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: session})
+}
+
+// uploadSessionParams parses the disk and upload IDs of the path of an upload session endpoint
+func uploadSessionParams(c *gin.Context) (uuid.UUID, uuid.UUID, error) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	uploadID, err := uuid.Parse(c.Param("upload_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return diskID, uploadID, nil
+}
+
+// GetUploadSession godoc
+//
+//	@Summary		Get artifact upload session
+//	@Description	Get an upload session with the parts received so far, to resume it. Once completed, the upload has a completed_at while its content is checked, and a failure when the check dropped its content.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			upload_id	path	string	true	"Upload ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ArtifactUploadSession}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/uploads/{upload_id} [get]
+func (h *ArtifactHandler) GetUploadSession(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, uploadID, err := uploadSessionParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	session, err := h.svc.GetUploadSession(c.Request.Context(), project.ID, diskID, uploadID)
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: session})
+}
+
+// UploadArtifactPart godoc
+//
+//	@Summary		Upload artifact part
+//	@Description	Send a part of an upload session as the raw request body, replacing the part sent before with the same number. Every part but the last holds upload.part_size bytes.
+//	@Tags			artifact
+//	@Accept			application/octet-stream
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			upload_id	path	string	true	"Upload ID"	Format(uuid)
+//	@Param			part_number	path	int		true	"Part number, from 1"	minimum(1)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.ArtifactUploadPart}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/uploads/{upload_id}/parts/{part_number} [put]
+func (h *ArtifactHandler) UploadArtifactPart(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, uploadID, err := uploadSessionParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	partNumber, err := strconv.ParseInt(c.Param("part_number"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid part number", err))
+		return
+	}
+
+	part, err := h.svc.UploadPart(c.Request.Context(), service.UploadArtifactPartInput{
 		ProjectID:  project.ID,
 		DiskID:     diskID,
-		Path:       filePath,
-		Filename:   actualFilename,
-		FileHeader: file,
-		UserMeta:   userMeta,
+		UploadID:   uploadID,
+		PartNumber: int32(partNumber),
+		Body:       c.Request.Body,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		respondArtifactUploadErr(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, serializer.Response{Data: artifactRecord})
+	c.JSON(http.StatusOK, serializer.Response{Data: part})
+}
+
+type CompleteArtifactUploadSessionReq struct {
+	// LeaseHolder is required to write a path locked with AcquireArtifactLease
+	LeaseHolder string `json:"lease_holder"`
+}
+
+// CompleteUploadSession godoc
+//
+//	@Summary		Complete artifact upload session
+//	@Description	Assemble the parts of an upload session into the artifact, replacing the artifact at its path. Returns 409 with the missing part numbers while parts are missing. The parts are assembled and 202 is returned with the upload: its content is checked in the background against the declared size and sha256, then the artifact is created and the session is gone, or the content is dropped and the session lists the failure; completing it again then returns 422. The content type is detected from the content as on upsert. When S3 already stores the content, the artifact is created right away.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string										true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			upload_id	path	string										true	"Upload ID"	Format(uuid)
+//	@Param			payload		body	handler.CompleteArtifactUploadSessionReq	false	"CompleteUploadSession payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Artifact}
+//	@Success		202	{object}	serializer.Response{data=model.ArtifactUpload}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/uploads/{upload_id}/complete [post]
+func (h *ArtifactHandler) CompleteUploadSession(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := CompleteArtifactUploadSessionReq{}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, uploadID, err := uploadSessionParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	finalized, err := h.svc.CompleteUploadSession(c.Request.Context(), service.FinalizeArtifactUploadInput{
+		ProjectID:   project.ID,
+		DiskID:      diskID,
+		UploadID:    uploadID,
+		LeaseHolder: req.LeaseHolder,
+	})
+	if err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	respondFinalizedUpload(c, finalized)
+}
+
+// AbortUploadSession godoc
+//
+//	@Summary		Abort artifact upload session
+//	@Description	Drop an upload session with the parts received so far
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			upload_id	path	string	true	"Upload ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/uploads/{upload_id} [delete]
+func (h *ArtifactHandler) AbortUploadSession(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, uploadID, err := uploadSessionParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.AbortUpload(c.Request.Context(), project.ID, diskID, uploadID); err != nil {
+		respondArtifactUploadErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
 }
 
 type DeleteArtifactReq struct {
@@ -122,7 +641,7 @@ type DeleteArtifactReq struct {
 // DeleteArtifact godoc
 //
 //	@Summary		Delete artifact
-//	@Description	Delete an artifact by path and filename
+//	@Description	Delete an artifact by path and filename. The artifact is moved to the trash of the disk and can be restored until it is purged after the retention window.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
@@ -130,6 +649,9 @@ type DeleteArtifactReq struct {
 //	@Param			file_path	query	string	true	"File path including filename"	example:"/documents/report.pdf"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/disk/{disk_id}/artifact [delete]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete an artifact\nclient.disks.delete_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf'\n)\nprint('Artifact deleted successfully')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete an artifact\nawait client.disks.deleteArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf'\n});\nconsole.log('Artifact deleted successfully');\n","label":"JavaScript"}]
 func (h *ArtifactHandler) DeleteArtifact(c *gin.Context) {
@@ -172,19 +694,20 @@ type GetArtifactReq struct {
 	FilePath      string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
 	WithPublicURL bool   `form:"with_public_url,default=true" json:"with_public_url" example:"true"`
 	WithContent   bool   `form:"with_content,default=true" json:"with_content" example:"true"`
-	Expire        int    `form:"expire,default=3600" json:"expire" example:"3600"` // Expire time in seconds for presigned URL
+	Expire        int    `form:"expire" json:"expire" binding:"omitempty,min=1" example:"3600"` // Expire time in seconds for presigned URL, 0 uses the default of the project
 }
 
 type GetArtifactResp struct {
 	Artifact  *model.Artifact         `json:"artifact"`
 	PublicURL *string                 `json:"public_url,omitempty"`
+	ExpireAt  *time.Time              `json:"expire_at,omitempty"` // when public_url stops working
 	Content   *fileparser.FileContent `json:"content,omitempty"`
 }
 
 // GetArtifact godoc
 //
 //	@Summary		Get artifact
-//	@Description	Get artifact information by path and filename. Optionally include a presigned URL for downloading and parsed file content.
+//	@Description	Get artifact information by path and filename. Optionally include a presigned URL for downloading, with its expiry in expire_at, and parsed file content. The expiry defaults to the default_expire_sec of the presign policy of the project, or else to 3600 seconds; an expire above the max_expire_sec of the policy, or above 604800 seconds, is refused with 400.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
@@ -195,6 +718,9 @@ type GetArtifactResp struct {
 //	@Param			expire			query	int		false	"Expire time in seconds for presigned URL (default: 3600)"	example:"3600"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.GetArtifactResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/disk/{disk_id}/artifact [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get artifact information\nartifact_info = client.disks.get_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf',\n    with_public_url=True,\n    with_content=True,\n    expire=3600\n)\nprint(f\"Artifact: {artifact_info.artifact.filename}\")\nif artifact_info.public_url:\n    print(f\"Download URL: {artifact_info.public_url}\")\nif artifact_info.content:\n    print(f\"Content: {artifact_info.content.text[:100]}...\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get artifact information\nconst artifactInfo = await client.disks.getArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf',\n  withPublicUrl: true,\n  withContent: true,\n  expire: 3600\n});\nconsole.log(`Artifact: ${artifactInfo.artifact.filename}`);\nif (artifactInfo.publicUrl) {\n  console.log(`Download URL: ${artifactInfo.publicUrl}`);\n}\nif (artifactInfo.content) {\n  console.log(`Content: ${artifactInfo.content.text.substring(0, 100)}...`);\n}\n","label":"JavaScript"}]
 func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
@@ -204,6 +730,12 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 		return
 	}
 
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
 	diskID, err := uuid.Parse(c.Param("disk_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
@@ -219,6 +751,12 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 		return
 	}
 
+	expire, err := service.PresignExpire(project, req.Expire, time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	artifact, err := h.svc.GetByPath(c.Request.Context(), diskID, filePath, filename)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
@@ -229,12 +767,13 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 
 	// Generate presigned URL if requested
 	if req.WithPublicURL {
-		url, err := h.svc.GetPresignedURL(c.Request.Context(), artifact, time.Duration(req.Expire)*time.Second)
+		url, err := h.svc.GetPresignedURL(c.Request.Context(), artifact, expire)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 			return
 		}
-		resp.PublicURL = &url
+		expireAt := time.Now().Add(expire)
+		resp.PublicURL, resp.ExpireAt = &url, &expireAt
 	}
 
 	// Parse file content if requested
@@ -271,6 +810,9 @@ type UpdateArtifactResp struct {
 //	@Param			request	body	handler.UpdateArtifactReq	true	"Update artifact request"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.UpdateArtifactResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/disk/{disk_id}/artifact [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update artifact metadata\nartifact = client.disks.update_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf',\n    meta={'category': 'updated', 'reviewed': True, 'version': 2}\n)\nprint(f\"Updated artifact: {artifact.artifact.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update artifact metadata\nconst artifact = await client.disks.updateArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf',\n  meta: { category: 'updated', reviewed: true, version: 2 }\n});\nconsole.log(`Updated artifact: ${artifact.artifact.id}`);\n","label":"JavaScript"}]
 func (h *ArtifactHandler) UpdateArtifact(c *gin.Context) {
@@ -343,6 +885,9 @@ type ListArtifactsResp struct {
 //	@Param			path	query	string	false	"Path filter (optional, defaults to root '/')"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.ListArtifactsResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/disk/{disk_id}/artifact/ls [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List artifacts in a path\nresult = client.disks.list_artifacts(\n    disk_id='disk-uuid',\n    path='/documents/'\n)\nprint(f\"Found {len(result.artifacts)} artifacts\")\nfor artifact in result.artifacts:\n    print(f\"  - {artifact.path}{artifact.filename}\")\nprint(f\"Subdirectories: {', '.join(result.directories)}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List artifacts in a path\nconst result = await client.disks.listArtifacts('disk-uuid', {\n  path: '/documents/'\n});\nconsole.log(`Found ${result.artifacts.length} artifacts`);\nfor (const artifact of result.artifacts) {\n  console.log(`  - ${artifact.path}${artifact.filename}`);\n}\nconsole.log(`Subdirectories: ${result.directories.join(', ')}`);\n","label":"JavaScript"}]
 func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
@@ -394,3 +939,393 @@ func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
 		},
 	})
 }
+
+// ListTrash godoc
+//
+//	@Summary		List trashed artifacts
+//	@Description	List the deleted artifacts of a disk that can still be restored, most recently deleted first
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]service.TrashedArtifact}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/trash [get]
+func (h *ArtifactHandler) ListTrash(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	artifacts, err := h.svc.ListTrash(c.Request.Context(), diskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: artifacts})
+}
+
+// RestoreArtifact godoc
+//
+//	@Summary		Restore trashed artifact
+//	@Description	Restore a deleted artifact to its path. Returns 409 if another artifact was created at the same path meanwhile.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"				Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			artifact_id	path	string	true	"Trashed artifact ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Artifact}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/trash/{artifact_id}/restore [post]
+func (h *ArtifactHandler) RestoreArtifact(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	artifactID, err := uuid.Parse(c.Param("artifact_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	artifact, err := h.svc.Restore(c.Request.Context(), diskID, artifactID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTrashedArtifactNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrArtifactPathTaken):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: artifact})
+}
+
+// defaultArtifactLeaseTTL is used when acquiring a lease without ttl_seconds
+const defaultArtifactLeaseTTL = 60 * time.Second
+
+type AcquireArtifactLeaseReq struct {
+	FilePath   string `form:"file_path" json:"file_path" binding:"required" example:"/documents/report.pdf"`
+	Holder     string `form:"holder" json:"holder" binding:"required,max=255" example:"agent-1"`
+	TTLSeconds int    `form:"ttl_seconds" json:"ttl_seconds" binding:"omitempty,min=1,max=3600" example:"60"`
+}
+
+// AcquireArtifactLease godoc
+//
+//	@Summary		Lock artifact path
+//	@Description	Acquire a write lease on an artifact path for a holder, the path does not need to exist yet. While the lease is active, uploads to the path are rejected unless they carry the same lease_holder. Acquiring again as the same holder extends the lease. Returns 409 if another holder owns the lease.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string							true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.AcquireArtifactLeaseReq	true	"Lease request, ttl_seconds defaults to 60"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.ArtifactLease}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/lock [post]
+func (h *ArtifactHandler) AcquireArtifactLease(c *gin.Context) {
+	req := AcquireArtifactLeaseReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	ttl := defaultArtifactLeaseTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	lease, err := h.svc.AcquireLease(c.Request.Context(), service.AcquireArtifactLeaseInput{
+		DiskID:   diskID,
+		Path:     filePath,
+		Filename: filename,
+		Holder:   req.Holder,
+		TTL:      ttl,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrArtifactLeased) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: lease})
+}
+
+type ReleaseArtifactLeaseReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required" example:"/documents/report.pdf"`
+	Holder   string `form:"holder" json:"holder" binding:"required" example:"agent-1"`
+}
+
+// ReleaseArtifactLease godoc
+//
+//	@Summary		Unlock artifact path
+//	@Description	Release the write lease a holder owns on an artifact path. Returns 404 if the holder does not own a lease on the path.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"						Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			file_path	query	string	true	"File path including filename"	example:"/documents/report.pdf"
+//	@Param			holder		query	string	true	"Holder of the lease"			example:"agent-1"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/lock [delete]
+func (h *ArtifactHandler) ReleaseArtifactLease(c *gin.Context) {
+	req := ReleaseArtifactLeaseReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	if err := h.svc.ReleaseLease(c.Request.Context(), diskID, filePath, filename, req.Holder); err != nil {
+		if errors.Is(err, service.ErrArtifactLeaseNotHeld) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// dirPath validates a directory path, which starts and ends with '/'
+func dirPath(p string) error {
+	if dir, _ := path.SplitFilePath(p); dir != p {
+		return errors.New("both ends of the path must be '/'")
+	}
+	return path.ValidatePath(p)
+}
+
+type MoveArtifactDirReq struct {
+	From string `json:"from" binding:"required" example:"/docs/"`
+	To   string `json:"to" binding:"required" example:"/archive/docs/"`
+	// LeaseHolder is required when a path under from or to is locked with AcquireArtifactLease
+	LeaseHolder string `json:"lease_holder" example:"agent-1"`
+}
+
+// MoveDirectory godoc
+//
+//	@Summary		Move directory
+//	@Description	Rename or move a directory of the disk with all the artifacts under it, at any depth, in one transaction. The path in the system meta of the artifacts follows. Returns 404 if no artifact is under from, and 409 if a moved artifact would replace another artifact or another holder locks a path under from or to.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.MoveArtifactDirReq	true	"Directory paths, starting and ending with '/'"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ArtifactDirResult}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/dir/move [post]
+func (h *ArtifactHandler) MoveDirectory(c *gin.Context) {
+	req := MoveArtifactDirReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	for _, p := range []string{req.From, req.To} {
+		if err := dirPath(p); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+			return
+		}
+	}
+
+	result, err := h.svc.MoveDir(c.Request.Context(), service.MoveArtifactDirInput{
+		DiskID:      diskID,
+		From:        req.From,
+		To:          req.To,
+		LeaseHolder: req.LeaseHolder,
+	})
+	if err != nil {
+		respondArtifactDirErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: result})
+}
+
+type DeleteArtifactDirReq struct {
+	Path        string `form:"path" json:"path" binding:"required" example:"/docs/"`
+	LeaseHolder string `form:"lease_holder" json:"lease_holder" example:"agent-1"`
+}
+
+// DeleteDirectory godoc
+//
+//	@Summary		Delete directory
+//	@Description	Delete a directory of the disk with all the artifacts under it, at any depth, in one transaction. The artifacts are moved to the trash of the disk and can be restored one by one until they are purged. Returns 404 if no artifact is under the path, and 409 if another holder locks a path under it.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id			path	string	true	"Disk ID"										Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			path			query	string	true	"Directory path, starting and ending with '/'"	example:"/docs/"
+//	@Param			lease_holder	query	string	false	"Holder of the leases on paths under the directory"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ArtifactDirResult}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/dir [delete]
+func (h *ArtifactHandler) DeleteDirectory(c *gin.Context) {
+	req := DeleteArtifactDirReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := dirPath(req.Path); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	result, err := h.svc.DeleteDir(c.Request.Context(), diskID, req.Path, req.LeaseHolder)
+	if err != nil {
+		respondArtifactDirErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: result})
+}
+
+func respondArtifactDirErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidArtifactDir):
+		c.JSON(http.StatusBadRequest, serializer.ParamErr(err.Error(), nil))
+	case errors.Is(err, service.ErrArtifactDirNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+	case errors.Is(err, service.ErrArtifactPathTaken), errors.Is(err, service.ErrArtifactLeased):
+		c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+type QueryArtifactReq struct {
+	FilePath string        `json:"file_path" binding:"required" example:"/data/orders.csv"`
+	Query    tabular.Query `json:"query"`
+}
+
+// QueryArtifact godoc
+//
+//	@Summary		Query tabular artifact
+//	@Description	Filter, project, group and aggregate a CSV or JSONL artifact without downloading it. The file is streamed row by row, JSONL fields are addressed with dotted paths. Parquet and other formats are not supported and return 415, a query exceeding the scan, sort or group limits returns 422.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.QueryArtifactReq	true	"Query"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=tabular.Result}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/query [post]
+func (h *ArtifactHandler) QueryArtifact(c *gin.Context) {
+	req := QueryArtifactReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	artifact, err := h.svc.GetByPath(c.Request.Context(), diskID, filePath, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	result, err := h.svc.Query(c.Request.Context(), artifact, req.Query)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedQueryFormat):
+			c.JSON(http.StatusUnsupportedMediaType, serializer.Err(http.StatusUnsupportedMediaType, err.Error(), nil))
+		case errors.Is(err, tabular.ErrInvalidQuery), errors.Is(err, tabular.ErrInvalidData):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(err.Error(), nil))
+		case errors.Is(err, tabular.ErrLimitExceeded):
+			c.JSON(http.StatusUnprocessableEntity, serializer.Err(http.StatusUnprocessableEntity, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: result})
+}
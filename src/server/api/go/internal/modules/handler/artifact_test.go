@@ -8,15 +8,20 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/fileparser"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tabular"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/datatypes"
@@ -95,6 +100,127 @@ func (m *MockArtifactService) GetFileContent(ctx context.Context, artifact *mode
 	return args.Get(0).(*fileparser.FileContent), args.Error(1)
 }
 
+func (m *MockArtifactService) ListTrash(ctx context.Context, diskID uuid.UUID) ([]service.TrashedArtifact, error) {
+	args := m.Called(ctx, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]service.TrashedArtifact), args.Error(1)
+}
+
+func (m *MockArtifactService) Restore(ctx context.Context, diskID uuid.UUID, artifactID uuid.UUID) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, artifactID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) PurgeTrash(ctx context.Context, trashedBefore time.Time) (int, error) {
+	args := m.Called(ctx, trashedBefore)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockArtifactService) AcquireLease(ctx context.Context, in service.AcquireArtifactLeaseInput) (*model.ArtifactLease, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactLease), args.Error(1)
+}
+
+func (m *MockArtifactService) ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) error {
+	args := m.Called(ctx, diskID, path, filename, holder)
+	return args.Error(0)
+}
+
+func (m *MockArtifactService) MoveDir(ctx context.Context, in service.MoveArtifactDirInput) (*service.ArtifactDirResult, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactDirResult), args.Error(1)
+}
+
+func (m *MockArtifactService) DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, leaseHolder string) (*service.ArtifactDirResult, error) {
+	args := m.Called(ctx, diskID, dir, leaseHolder)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactDirResult), args.Error(1)
+}
+
+func (m *MockArtifactService) PresignUpload(ctx context.Context, in service.ArtifactUploadInput) (*service.ArtifactUploadTicket, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactUploadTicket), args.Error(1)
+}
+
+func (m *MockArtifactService) FinalizeUpload(ctx context.Context, in service.FinalizeArtifactUploadInput) (*service.FinalizedArtifactUpload, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.FinalizedArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactService) CheckUploads(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockArtifactService) PurgeExpiredUploads(ctx context.Context, expiredBefore time.Time) (int, error) {
+	args := m.Called(ctx, expiredBefore)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockArtifactService) StartUploadSession(ctx context.Context, in service.ArtifactUploadInput) (*service.ArtifactUploadSession, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactUploadSession), args.Error(1)
+}
+
+func (m *MockArtifactService) GetUploadSession(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) (*service.ArtifactUploadSession, error) {
+	args := m.Called(ctx, projectID, diskID, uploadID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactUploadSession), args.Error(1)
+}
+
+func (m *MockArtifactService) UploadPart(ctx context.Context, in service.UploadArtifactPartInput) (*model.ArtifactUploadPart, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactUploadPart), args.Error(1)
+}
+
+func (m *MockArtifactService) CompleteUploadSession(ctx context.Context, in service.FinalizeArtifactUploadInput) (*service.FinalizedArtifactUpload, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.FinalizedArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactService) AbortUpload(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, uploadID)
+	return args.Error(0)
+}
+
+func (m *MockArtifactService) Query(ctx context.Context, artifact *model.Artifact, q tabular.Query) (*tabular.Result, error) {
+	args := m.Called(ctx, artifact, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*tabular.Result), args.Error(1)
+}
+
 func TestArtifactHandler_UpsertArtifact(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -146,6 +272,17 @@ func TestArtifactHandler_UpsertArtifact(t *testing.T) {
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:        "content contradicts declared type",
+			diskID:      uuid.New().String(),
+			filePath:    "/test/test.txt",
+			fileContent: "\x89PNG\r\n\x1a\n",
+			fileName:    "test.txt",
+			mockSetup: func(m *MockArtifactService, diskIDStr string, projectID uuid.UUID) {
+				m.On("Create", mock.Anything, mock.Anything).Return((*model.Artifact)(nil), fmt.Errorf("upload file to S3: %w", blob.ErrMIMEMismatch))
+			},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,7 +291,7 @@ func TestArtifactHandler_UpsertArtifact(t *testing.T) {
 			projectID := uuid.New()
 			tt.mockSetup(mockService, tt.diskID, projectID)
 
-			handler := NewArtifactHandler(mockService)
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
 
 			// Create multipart form data
 			body := &bytes.Buffer{}
@@ -210,6 +347,467 @@ func TestArtifactHandler_UpsertArtifact(t *testing.T) {
 	}
 }
 
+func TestArtifactHandler_PresignArtifactUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	sum := "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "successful presign",
+			body: fmt.Sprintf(`{"file_path":"/videos/demo.mp4","content_type":"video/mp4","size":4294967296,"sha256":"%s","meta":{"source":"camera"}}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("PresignUpload", mock.Anything, service.ArtifactUploadInput{
+					Project:  project,
+					DiskID:   diskID,
+					Path:     "/videos/",
+					Filename: "demo.mp4",
+					MIME:     "video/mp4",
+					SizeB:    4294967296,
+					SHA256:   strings.ToLower(sum),
+					UserMeta: map[string]interface{}{"source": "camera"},
+					Expire:   time.Hour,
+				}).Return(&service.ArtifactUploadTicket{Upload: &model.ArtifactUpload{PartSize: 64 << 20}}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "no filename",
+			body:           fmt.Sprintf(`{"file_path":"/videos/","size":10,"sha256":"%s"}`, sum),
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid sha256",
+			body:           `{"file_path":"/videos/demo.mp4","size":10,"sha256":"abc"}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "reserved meta key",
+			body:           fmt.Sprintf(`{"file_path":"/videos/demo.mp4","size":10,"sha256":"%s","meta":{"__artifact_info__":{}}}`, sum),
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "file too large",
+			body:           fmt.Sprintf(`{"file_path":"/videos/demo.mp4","size":17179869185,"sha256":"%s"}`, sum),
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "over the storage quota",
+			body: fmt.Sprintf(`{"file_path":"/videos/demo.mp4","size":10,"sha256":"%s"}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("PresignUpload", mock.Anything, mock.Anything).
+					Return(nil, &service.QuotaExceededError{Quota: service.QuotaStorage, Limit: 100, Used: 95, Requested: 10})
+			},
+			expectedStatus: http.StatusPaymentRequired,
+		},
+		{
+			name: "path leased by another holder",
+			body: fmt.Sprintf(`{"file_path":"/videos/demo.mp4","size":10,"sha256":"%s"}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("PresignUpload", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactLeased)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "envelope encryption enabled",
+			body: fmt.Sprintf(`{"file_path":"/videos/demo.mp4","size":10,"sha256":"%s"}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("PresignUpload", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadSealed)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{MaxFileBytes: 32 << 20, MaxDirectBytes: 16 << 30})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/presign_upload", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.PresignArtifactUpload(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/presign_upload", diskID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_FinalizeArtifactUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "parts are sorted",
+			body: `{"parts":[{"part_number":2,"etag":"\"b\""},{"part_number":1,"etag":"\"a\""}]}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, service.FinalizeArtifactUploadInput{
+					ProjectID: project.ID,
+					DiskID:    diskID,
+					UploadID:  uploadID,
+					Parts:     []blob.CompletedPart{{PartNumber: 1, ETag: `"a"`}, {PartNumber: 2, ETag: `"b"`}},
+				}).Return(&service.FinalizedArtifactUpload{Upload: &model.ArtifactUpload{ID: uploadID, DiskID: diskID}}, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name: "single upload without body",
+			body: "",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, mock.Anything).Return(&service.FinalizedArtifactUpload{Artifact: &model.Artifact{DiskID: diskID}}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid part",
+			body:           `{"parts":[{"part_number":0,"etag":"a"}]}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "finalized or expired",
+			body: `{}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "not uploaded yet",
+			body: `{}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadIncomplete)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "content does not match",
+			body: `{}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadMismatch)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "type mismatch rejected",
+			body: `{}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, mock.Anything).Return(nil, blob.ErrMIMEMismatch)
+			},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/presign_upload/:upload_id/finalize", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.FinalizeArtifactUpload(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/presign_upload/%s/finalize", diskID, uploadID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_CreateUploadSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "session with the default ttl",
+			body: fmt.Sprintf(`{"file_path":"/checkpoints/model.bin","size":1073741824,"sha256":"%s"}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("StartUploadSession", mock.Anything, service.ArtifactUploadInput{
+					Project:  project,
+					DiskID:   diskID,
+					Path:     "/checkpoints/",
+					Filename: "model.bin",
+					MIME:     "application/octet-stream",
+					SizeB:    1073741824,
+					SHA256:   sum,
+					Expire:   defaultUploadSessionTTL,
+				}).Return(&service.ArtifactUploadSession{Upload: &model.ArtifactUpload{PartSize: 16 << 20}, PartCount: 64}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "session with a ttl",
+			body: fmt.Sprintf(`{"file_path":"/checkpoints/model.bin","size":1024,"sha256":"%s","ttl_seconds":3600}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("StartUploadSession", mock.Anything, mock.MatchedBy(func(in service.ArtifactUploadInput) bool {
+					return in.Expire == time.Hour
+				})).Return(&service.ArtifactUploadSession{Upload: &model.ArtifactUpload{}}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "ttl too short",
+			body:           fmt.Sprintf(`{"file_path":"/checkpoints/model.bin","size":1024,"sha256":"%s","ttl_seconds":1}`, sum),
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "path without filename",
+			body:           fmt.Sprintf(`{"file_path":"/checkpoints/","size":1024,"sha256":"%s"}`, sum),
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "over the storage quota",
+			body: fmt.Sprintf(`{"file_path":"/checkpoints/model.bin","size":1024,"sha256":"%s"}`, sum),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("StartUploadSession", mock.Anything, mock.Anything).Return(nil, &service.QuotaExceededError{Quota: service.QuotaStorage, Limit: 10, Requested: 1024})
+			},
+			expectedStatus: http.StatusPaymentRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/uploads", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.CreateUploadSession(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/uploads", diskID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_UploadArtifactPart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		partNumber     string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name:       "part uploaded",
+			partNumber: "3",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("UploadPart", mock.Anything, mock.MatchedBy(func(in service.UploadArtifactPartInput) bool {
+					return in.ProjectID == project.ID && in.DiskID == diskID && in.UploadID == uploadID && in.PartNumber == 3
+				})).Return(&model.ArtifactUploadPart{UploadID: uploadID, PartNumber: 3, ETag: `"c"`, SizeB: 5}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "part number not a number",
+			partNumber:     "last",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong part size",
+			partNumber: "1",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("UploadPart", mock.Anything, mock.Anything).Return(nil, service.ErrInvalidArtifactUpload)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "completed or expired",
+			partNumber: "1",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("UploadPart", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.PUT("/disk/:disk_id/artifact/uploads/:upload_id/parts/:part_number", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.UploadArtifactPart(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/disk/%s/artifact/uploads/%s/parts/%s", diskID, uploadID, tt.partNumber), strings.NewReader("bytes"))
+			req.Header.Set("Content-Type", "application/octet-stream")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_CompleteUploadSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "completed without body",
+			body: "",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CompleteUploadSession", mock.Anything, service.FinalizeArtifactUploadInput{
+					ProjectID: project.ID,
+					DiskID:    diskID,
+					UploadID:  uploadID,
+				}).Return(&service.FinalizedArtifactUpload{Upload: &model.ArtifactUpload{ID: uploadID, DiskID: diskID}}, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name: "parts missing",
+			body: `{"lease_holder":"agent-1"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CompleteUploadSession", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadIncomplete)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "content does not match",
+			body: `{}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CompleteUploadSession", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactUploadMismatch)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/uploads/:upload_id/complete", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.CompleteUploadSession(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/uploads/%s/complete", diskID, uploadID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+// uploadRepo is an ArtifactRepo that only holds one upload
+type uploadRepo struct {
+	repo.ArtifactRepo
+	upload *model.ArtifactUpload
+}
+
+func (r *uploadRepo) GetUpload(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.ArtifactUpload, error) {
+	if r.upload.DiskID != diskID || r.upload.ID != id {
+		return nil, nil
+	}
+	return r.upload, nil
+}
+
+func TestArtifactHandler_UploadSessionOfAnotherProject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upload := &model.ArtifactUpload{ID: uuid.New(), ProjectID: uuid.New(), DiskID: uuid.New(), SizeB: 5, MultipartID: "mp-1", PartSize: 5}
+	other := &model.Project{ID: uuid.New()}
+
+	handler := NewArtifactHandler(service.NewArtifactService(&uploadRepo{upload: upload}, nil, nil), config.UploadCfg{})
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("project", other) })
+	router.GET("/disk/:disk_id/artifact/uploads/:upload_id", handler.GetUploadSession)
+	router.PUT("/disk/:disk_id/artifact/uploads/:upload_id/parts/:part_number", handler.UploadArtifactPart)
+	router.POST("/disk/:disk_id/artifact/uploads/:upload_id/complete", handler.CompleteUploadSession)
+	router.DELETE("/disk/:disk_id/artifact/uploads/:upload_id", handler.AbortUploadSession)
+
+	base := fmt.Sprintf("/disk/%s/artifact/uploads/%s", upload.DiskID, upload.ID)
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, base},
+		{http.MethodPut, base + "/parts/1"},
+		{http.MethodPost, base + "/complete"},
+		{http.MethodDelete, base},
+	} {
+		t.Run(r.method, func(t *testing.T) {
+			req := httptest.NewRequest(r.method, r.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	}
+}
+
 func TestArtifactHandler_DeleteArtifact(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -238,7 +836,7 @@ func TestArtifactHandler_DeleteArtifact(t *testing.T) {
 			projectID := uuid.New()
 			tt.mockSetup(mockService, tt.diskID, tt.filePath, projectID)
 
-			handler := NewArtifactHandler(mockService)
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
 
 			// Create request with query parameters
 			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/disk/%s/artifact?file_path=%s", tt.diskID, tt.filePath), nil)
@@ -363,7 +961,7 @@ func TestArtifactHandler_UpdateArtifact(t *testing.T) {
 			mockService := new(MockArtifactService)
 			tt.mockSetup(mockService, tt.diskID)
 
-			handler := NewArtifactHandler(mockService)
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
 
 			// Create JSON request body
 			requestBody := map[string]string{
@@ -509,7 +1107,7 @@ func TestArtifactHandler_GetArtifact(t *testing.T) {
 			mockService := new(MockArtifactService)
 			tt.mockSetup(mockService, tt.diskID, tt.filePath)
 
-			handler := NewArtifactHandler(mockService)
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
 
 			// Create request with query parameters
 			url := fmt.Sprintf("/disk/%s/artifact?file_path=%s", tt.diskID, tt.filePath)
@@ -535,6 +1133,7 @@ func TestArtifactHandler_GetArtifact(t *testing.T) {
 			c.Params = []gin.Param{
 				{Key: "disk_id", Value: tt.diskID},
 			}
+			c.Set("project", &model.Project{ID: uuid.New()})
 
 			// Call handler
 			handler.GetArtifact(c)
@@ -556,9 +1155,380 @@ func TestArtifactHandler_GetArtifact(t *testing.T) {
 					json.Unmarshal(dataBytes, &respData)
 					assert.Contains(t, respData, "content")
 				}
+				if tt.withPublicURL {
+					dataBytes, _ := json.Marshal(response.Data)
+					var respData map[string]interface{}
+					json.Unmarshal(dataBytes, &respData)
+					assert.Contains(t, respData, "expire_at")
+				}
 			}
 
 			mockService.AssertExpectations(t)
 		})
 	}
 }
+
+func TestArtifactHandler_RestoreArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	artifactID := uuid.New()
+
+	tests := []struct {
+		name           string
+		artifactID     string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name:       "successful restore",
+			artifactID: artifactID.String(),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("Restore", mock.Anything, diskID, artifactID).Return(&model.Artifact{ID: artifactID, DiskID: diskID}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid artifact id",
+			artifactID:     "invalid",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not in the trash",
+			artifactID: artifactID.String(),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("Restore", mock.Anything, diskID, artifactID).Return(nil, service.ErrTrashedArtifactNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:       "path reused meanwhile",
+			artifactID: artifactID.String(),
+			mockSetup: func(m *MockArtifactService) {
+				m.On("Restore", mock.Anything, diskID, artifactID).Return(nil, service.ErrArtifactPathTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/trash/:artifact_id/restore", handler.RestoreArtifact)
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/trash/%s/restore", diskID, tt.artifactID), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_MoveDirectory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "successful move",
+			body: `{"from":"/docs/","to":"/archive/docs/","lease_holder":"agent-1"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDir", mock.Anything, service.MoveArtifactDirInput{DiskID: diskID, From: "/docs/", To: "/archive/docs/", LeaseHolder: "agent-1"}).
+					Return(&service.ArtifactDirResult{Path: "/archive/docs/", Artifacts: 4}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not a directory",
+			body:           `{"from":"/docs/report.pdf","to":"/archive/"}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "traversal",
+			body:           `{"from":"/docs/","to":"/../etc/"}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "into itself",
+			body: `{"from":"/docs/","to":"/docs/old/"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDir", mock.Anything, mock.Anything).Return(nil, service.ErrInvalidArtifactDir)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "empty directory",
+			body: `{"from":"/docs/","to":"/archive/"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDir", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactDirNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "artifact at the destination",
+			body: `{"from":"/docs/","to":"/archive/"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDir", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactPathTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/dir/move", handler.MoveDirectory)
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/dir/move", diskID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_DeleteDirectory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name:  "successful delete",
+			query: "?path=/docs/",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("DeleteDir", mock.Anything, diskID, "/docs/", "").Return(&service.ArtifactDirResult{Path: "/docs/", Artifacts: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing path",
+			query:          "",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "locked by another holder",
+			query: "?path=/docs/&lease_holder=agent-2",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("DeleteDir", mock.Anything, diskID, "/docs/", "agent-2").Return(nil, service.ErrArtifactLeased)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.DELETE("/disk/:disk_id/dir", handler.DeleteDirectory)
+
+			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/disk/%s/dir%s", diskID, tt.query), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_AcquireArtifactLease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "lease acquired with default ttl",
+			body: `{"file_path": "/docs/a.md", "holder": "agent-1"}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLease", mock.Anything, service.AcquireArtifactLeaseInput{
+					DiskID: diskID, Path: "/docs/", Filename: "a.md", Holder: "agent-1", TTL: time.Minute,
+				}).Return(&model.ArtifactLease{DiskID: diskID, Path: "/docs/", Filename: "a.md", Holder: "agent-1"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing holder",
+			body:           `{"file_path": "/docs/a.md"}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ttl too long",
+			body:           `{"file_path": "/docs/a.md", "holder": "agent-1", "ttl_seconds": 86400}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "held by another holder",
+			body: `{"file_path": "/docs/a.md", "holder": "agent-2", "ttl_seconds": 30}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLease", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactLeased)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/lock", handler.AcquireArtifactLease)
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/lock", diskID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_ReleaseArtifactLease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+
+	tests := []struct {
+		name           string
+		serviceErr     error
+		expectedStatus int
+	}{
+		{name: "lease released", expectedStatus: http.StatusOK},
+		{name: "lease not held", serviceErr: service.ErrArtifactLeaseNotHeld, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			mockService.On("ReleaseLease", mock.Anything, diskID, "/docs/", "a.md", "agent-1").Return(tt.serviceErr)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.DELETE("/disk/:disk_id/artifact/lock", handler.ReleaseArtifactLease)
+
+			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/disk/%s/artifact/lock?file_path=/docs/a.md&holder=agent-1", diskID), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_QueryArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	diskID := uuid.New()
+	artifact := &model.Artifact{ID: uuid.New(), DiskID: diskID, Path: "/data/", Filename: "orders.csv"}
+	query := tabular.Query{
+		Where: []tabular.Filter{{Column: "status", Op: "eq", Value: "paid"}},
+		Limit: 10,
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"file_path": "/data/orders.csv", "query": {"where": [{"column": "status", "op": "eq", "value": "paid"}], "limit": 10}}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/data/", "orders.csv").Return(artifact, nil)
+				m.On("Query", mock.Anything, artifact, query).Return(&tabular.Result{Columns: []string{"id"}, Rows: []map[string]interface{}{{"id": "1"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing file path",
+			body:           `{"query": {}}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unsupported format",
+			body: `{"file_path": "/data/orders.parquet", "query": {}}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/data/", "orders.parquet").Return(artifact, nil)
+				m.On("Query", mock.Anything, artifact, mock.Anything).Return(nil, service.ErrUnsupportedQueryFormat)
+			},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "invalid query",
+			body: `{"file_path": "/data/orders.csv", "query": {"group_by": ["status"]}}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/data/", "orders.csv").Return(artifact, nil)
+				m.On("Query", mock.Anything, artifact, mock.Anything).Return(nil, fmt.Errorf("%w: group_by requires aggregates", tabular.ErrInvalidQuery))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "limit exceeded",
+			body: `{"file_path": "/data/orders.csv", "query": {"order_by": [{"column": "id"}]}}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/data/", "orders.csv").Return(artifact, nil)
+				m.On("Query", mock.Anything, artifact, mock.Anything).Return(nil, tabular.ErrLimitExceeded)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, config.UploadCfg{})
+			router := gin.New()
+			router.POST("/disk/:disk_id/artifact/query", handler.QueryArtifact)
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact/query", diskID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
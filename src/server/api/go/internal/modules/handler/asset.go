@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type AssetHandler struct {
+	svc service.AssetService
+}
+
+func NewAssetHandler(s service.AssetService) *AssetHandler {
+	return &AssetHandler{svc: s}
+}
+
+type ListAssetsReq struct {
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// ListAssets godoc
+//
+//	@Summary		List project assets
+//	@Description	List the unique assets stored for the project, deduplicated by content, with their stored reference count and the sessions and disks that reference them
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit		query	integer	false	"Limit of assets to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	boolean	false	"Order by created_at descending if true, ascending if false (default false)"	example(false)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListAssetsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/assets [get]
+func (h *AssetHandler) ListAssets(c *gin.Context) {
+	req := ListAssetsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.List(c.Request.Context(), service.ListAssetsInput{
+		ProjectID: project.ID,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type AssetSHA256Req struct {
+	SHA256 string `uri:"sha256" binding:"required,len=64,hexadecimal" example:"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`
+}
+
+type GetAssetReq struct {
+	Expire   int  `form:"expire" json:"expire" binding:"omitempty,min=1" example:"3600"` // Expire time in seconds for presigned URL, 0 uses the default of the project
+	Redirect bool `form:"redirect,default=false" json:"redirect" example:"false"`
+}
+
+// GetAsset godoc
+//
+//	@Summary		Get asset by SHA256
+//	@Description	Resolve an asset of the project by its content hash to a presigned URL of the stored object, whichever session or disk stored it. With redirect=true the response is a 302 to the presigned URL, so clients can fetch and cache content by hash. Encrypted assets have no presigned URL, redirect=true then redirects to their content endpoint. An expire above the max_expire_sec of the presign policy of the project, or above 604800 seconds, is refused with 400.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			sha256		path	string	true	"Asset SHA256"
+//	@Param			expire		query	integer	false	"Expire time in seconds for the presigned URL, default 3600 or the default_expire_sec of the presign policy"	example(3600)
+//	@Param			redirect	query	boolean	false	"Redirect to the presigned URL instead of returning it"		example(false)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.AssetObject}
+//	@Success		302
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/assets/{sha256} [get]
+func (h *AssetHandler) GetAsset(c *gin.Context) {
+	uri := AssetSHA256Req{}
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	req := GetAssetReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	expire, err := service.PresignExpire(project, req.Expire, time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	obj, err := h.svc.Get(c.Request.Context(), project.ID, uri.SHA256, expire)
+	if err != nil {
+		if errors.Is(err, service.ErrAssetNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	// The content behind a hash never changes
+	c.Header("ETag", `"`+obj.SHA256+`"`)
+	if req.Redirect {
+		if obj.Encrypted {
+			c.Redirect(http.StatusTemporaryRedirect, c.Request.URL.Path+"/content")
+			return
+		}
+		c.Redirect(http.StatusFound, obj.PublicURL)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: obj})
+}
+
+// GetAssetContent godoc
+//
+//	@Summary		Get asset content
+//	@Description	Stream the content of an asset of the project by its content hash, decrypting it if it is encrypted at rest. This is how encrypted assets are fetched, they have no presigned URL. Downloads resume with a Range header of a single byte range, e.g. bytes=1048576-, answered with 206 and Content-Range; a range starting beyond the content is refused with 416. Several ranges, or an If-Range other than the ETag, get the whole content.
+//	@Tags			project
+//	@Produce		octet-stream
+//	@Param			sha256	path	string	true	"Asset SHA256"
+//	@Param			Range	header	string	false	"Byte range to return, e.g. bytes=0-1023"
+//	@Security		BearerAuth
+//	@Success		200	{file}		file
+//	@Success		206	{file}		file
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		416	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/assets/{sha256}/content [get]
+func (h *AssetHandler) GetAssetContent(c *gin.Context) {
+	uri := AssetSHA256Req{}
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	// The content behind a hash never changes
+	etag := `"` + uri.SHA256 + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Accept-Ranges", "bytes")
+
+	if header := c.GetHeader("Range"); header != "" && (c.GetHeader("If-Range") == "" || c.GetHeader("If-Range") == etag) {
+		obj, err := h.svc.Stat(c.Request.Context(), project.ID, uri.SHA256)
+		if err != nil {
+			respondAssetErr(c, err)
+			return
+		}
+		offset, length, ok, err := parseByteRange(header, obj.SizeB)
+		if err != nil {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", obj.SizeB))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, serializer.Err(http.StatusRequestedRangeNotSatisfiable, err.Error(), nil))
+			return
+		}
+		if ok {
+			body, err := h.svc.OpenRange(c.Request.Context(), project.ID, uri.SHA256, offset, length)
+			if err != nil {
+				respondAssetErr(c, err)
+				return
+			}
+			defer body.Close()
+
+			c.Header("ETag", etag)
+			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, obj.SizeB))
+			c.DataFromReader(http.StatusPartialContent, length, obj.MIME, body, nil)
+			return
+		}
+	}
+
+	body, obj, err := h.svc.Open(c.Request.Context(), project.ID, uri.SHA256)
+	if err != nil {
+		respondAssetErr(c, err)
+		return
+	}
+	defer body.Close()
+
+	c.Header("ETag", etag)
+	c.DataFromReader(http.StatusOK, obj.SizeB, obj.MIME, body, nil)
+}
+
+func respondAssetErr(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrAssetNotFound) {
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+}
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseByteRange resolves a Range header against the size of the content to the offset and length of the bytes to
+// return. ok is false when the whole content is returned instead: several ranges or a syntax that is not understood.
+func parseByteRange(header string, size int64) (offset, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	// bytes=-n asks for the last n bytes
+	if first == "" {
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		e, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || e < start {
+			return 0, 0, false, nil
+		}
+		end = min(e, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	return start, end - start + 1, true, nil
+}
+
+// DeleteAsset godoc
+//
+//	@Summary		Delete unreferenced asset
+//	@Description	Delete an asset and its stored object once its reference count dropped to zero and no session or disk references it anymore. Assets referenced in the last 10 minutes are kept. Returns 409 if the asset is still referenced.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			sha256	path	string	true	"Asset SHA256"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/assets/{sha256} [delete]
+func (h *AssetHandler) DeleteAsset(c *gin.Context) {
+	req := AssetSHA256Req{}
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := h.svc.Delete(c.Request.Context(), project.ID, req.SHA256); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAssetNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrAssetReferenced):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAssetService is a mock implementation of AssetService
+type MockAssetService struct {
+	mock.Mock
+}
+
+func (m *MockAssetService) List(ctx context.Context, in service.ListAssetsInput) (*service.ListAssetsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListAssetsOutput), args.Error(1)
+}
+
+func (m *MockAssetService) Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*service.AssetObject, error) {
+	args := m.Called(ctx, projectID, sha256, expire)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AssetObject), args.Error(1)
+}
+
+func (m *MockAssetService) Open(ctx context.Context, projectID uuid.UUID, sha256 string) (io.ReadCloser, *service.AssetObject, error) {
+	args := m.Called(ctx, projectID, sha256)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(io.ReadCloser), args.Get(1).(*service.AssetObject), args.Error(2)
+}
+
+func (m *MockAssetService) Stat(ctx context.Context, projectID uuid.UUID, sha256 string) (*service.AssetObject, error) {
+	args := m.Called(ctx, projectID, sha256)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AssetObject), args.Error(1)
+}
+
+func (m *MockAssetService) OpenRange(ctx context.Context, projectID uuid.UUID, sha256 string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, projectID, sha256, offset, length)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
+func (m *MockAssetService) Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error {
+	args := m.Called(ctx, projectID, sha256)
+	return args.Error(0)
+}
+
+func setupAssetRouter(h *AssetHandler, projectID uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+	})
+	router.GET("/project/assets", h.ListAssets)
+	router.GET("/project/assets/:sha256", h.GetAsset)
+	router.GET("/project/assets/:sha256/content", h.GetAssetContent)
+	router.DELETE("/project/assets/:sha256", h.DeleteAsset)
+	return router
+}
+
+func TestAssetHandler_ListAssets(t *testing.T) {
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockAssetService)
+		expectedStatus int
+	}{
+		{
+			name:  "success",
+			query: "?limit=10",
+			setup: func(svc *MockAssetService) {
+				svc.On("List", mock.Anything, service.ListAssetsInput{ProjectID: projectID, Limit: 10}).
+					Return(&service.ListAssetsOutput{Items: []service.ProjectAsset{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "limit too large",
+			query:          "?limit=1000",
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "service layer error",
+			query: "",
+			setup: func(svc *MockAssetService) {
+				svc.On("List", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+			router := setupAssetRouter(NewAssetHandler(mockService), projectID)
+
+			req := httptest.NewRequest("GET", "/project/assets"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssetHandler_GetAsset(t *testing.T) {
+	projectID := uuid.New()
+	sha := strings.Repeat("ab", 32)
+	obj := &service.AssetObject{SHA256: sha, PublicURL: "https://s3.example.com/assets/a.png?sig=1"}
+
+	tests := []struct {
+		name             string
+		path             string
+		setup            func(*MockAssetService)
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name: "presigned url",
+			path: "/project/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, time.Hour).Return(obj, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "redirect",
+			path: "/project/assets/" + sha + "?redirect=true&expire=60",
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, time.Minute).Return(obj, nil)
+			},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: obj.PublicURL,
+		},
+		{
+			name: "redirect of an encrypted asset",
+			path: "/project/assets/" + sha + "?redirect=true",
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, time.Hour).Return(&service.AssetObject{SHA256: sha, Encrypted: true}, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "/project/assets/" + sha + "/content",
+		},
+		{
+			name:           "expire beyond 7 days",
+			path:           "/project/assets/" + sha + "?expire=604801",
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid sha256",
+			path:           "/project/assets/not-a-hash",
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "not found",
+			path: "/project/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, time.Hour).Return(nil, service.ErrAssetNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+			router := setupAssetRouter(NewAssetHandler(mockService), projectID)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLocation != "" {
+				assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssetHandler_GetAssetContent(t *testing.T) {
+	projectID := uuid.New()
+	sha := strings.Repeat("ab", 32)
+
+	t.Run("streams the decrypted content", func(t *testing.T) {
+		svc := &MockAssetService{}
+		svc.On("Open", mock.Anything, projectID, sha).Return(
+			io.NopCloser(strings.NewReader("hello")),
+			&service.AssetObject{SHA256: sha, MIME: "text/plain", SizeB: 5, Encrypted: true},
+			nil,
+		)
+		router := setupAssetRouter(NewAssetHandler(svc), projectID)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/project/assets/"+sha+"/content", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "hello", w.Body.String())
+		assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		assert.Equal(t, `"`+sha+`"`, w.Header().Get("ETag"))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		svc := &MockAssetService{}
+		router := setupAssetRouter(NewAssetHandler(svc), projectID)
+
+		req := httptest.NewRequest("GET", "/project/assets/"+sha+"/content", nil)
+		req.Header.Set("If-None-Match", `"`+sha+`"`)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		svc := &MockAssetService{}
+		svc.On("Open", mock.Anything, projectID, sha).Return(nil, nil, service.ErrAssetNotFound)
+		router := setupAssetRouter(NewAssetHandler(svc), projectID)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/project/assets/"+sha+"/content", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("resumes from a range", func(t *testing.T) {
+		svc := &MockAssetService{}
+		svc.On("Stat", mock.Anything, projectID, sha).Return(&service.AssetObject{SHA256: sha, MIME: "text/plain", SizeB: 11}, nil)
+		svc.On("OpenRange", mock.Anything, projectID, sha, int64(6), int64(5)).Return(io.NopCloser(strings.NewReader("world")), nil)
+		router := setupAssetRouter(NewAssetHandler(svc), projectID)
+
+		req := httptest.NewRequest("GET", "/project/assets/"+sha+"/content", nil)
+		req.Header.Set("Range", "bytes=6-")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "world", w.Body.String())
+		assert.Equal(t, "bytes 6-10/11", w.Header().Get("Content-Range"))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("range beyond the content", func(t *testing.T) {
+		svc := &MockAssetService{}
+		svc.On("Stat", mock.Anything, projectID, sha).Return(&service.AssetObject{SHA256: sha, SizeB: 11}, nil)
+		router := setupAssetRouter(NewAssetHandler(svc), projectID)
+
+		req := httptest.NewRequest("GET", "/project/assets/"+sha+"/content", nil)
+		req.Header.Set("Range", "bytes=11-")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+		assert.Equal(t, "bytes */11", w.Header().Get("Content-Range"))
+		svc.AssertExpectations(t)
+	})
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header         string
+		offset, length int64
+		ok             bool
+		unsatisfiable  bool
+	}{
+		{header: "bytes=0-3", offset: 0, length: 4, ok: true},
+		{header: "bytes=4-", offset: 4, length: 6, ok: true},
+		{header: "bytes=8-100", offset: 8, length: 2, ok: true},
+		{header: "bytes=-3", offset: 7, length: 3, ok: true},
+		{header: "bytes=-30", offset: 0, length: 10, ok: true},
+		{header: "bytes=10-", unsatisfiable: true},
+		{header: "bytes=-0", unsatisfiable: true},
+		{header: "bytes=0-1,4-5"},
+		{header: "bytes=5-2"},
+		{header: "items=0-3"},
+		{header: "bytes=a-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			offset, length, ok, err := parseByteRange(tt.header, 10)
+			if tt.unsatisfiable {
+				assert.ErrorIs(t, err, errRangeNotSatisfiable)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.offset, offset)
+			assert.Equal(t, tt.length, length)
+		})
+	}
+}
+
+func TestAssetHandler_DeleteAsset(t *testing.T) {
+	projectID := uuid.New()
+	sha := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name           string
+		sha256         string
+		setup          func(*MockAssetService)
+		expectedStatus int
+	}{
+		{
+			name:   "success",
+			sha256: sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Delete", mock.Anything, projectID, sha).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid sha256",
+			sha256:         "not-a-hash",
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "not found",
+			sha256: sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Delete", mock.Anything, projectID, sha).Return(service.ErrAssetNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "still referenced",
+			sha256: sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Delete", mock.Anything, projectID, sha).Return(service.ErrAssetReferenced)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+			router := setupAssetRouter(NewAssetHandler(mockService), projectID)
+
+			req := httptest.NewRequest("DELETE", "/project/assets/"+tt.sha256, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package handler
 
 import (
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,15 +20,27 @@ import (
 type BlockHandler struct {
 	svc        service.BlockService
 	coreClient *httpclient.CoreClient
+	// limits bounds the children of a block, nil disables it
+	limits service.EntityLimitService
 }
 
-func NewBlockHandler(s service.BlockService, coreClient *httpclient.CoreClient) *BlockHandler {
+func NewBlockHandler(s service.BlockService, coreClient *httpclient.CoreClient, limits service.EntityLimitService) *BlockHandler {
 	return &BlockHandler{
 		svc:        s,
 		coreClient: coreClient,
+		limits:     limits,
 	}
 }
 
+// checkChildren applies the children limit of parentID to a write adding a child, see applyEntityLimit
+func (h *BlockHandler) checkChildren(c *gin.Context, parentID *uuid.UUID) bool {
+	if h.limits == nil || parentID == nil {
+		return true
+	}
+	usage, err := h.limits.CheckBlockChildren(c.Request.Context(), *parentID, 1)
+	return applyEntityLimit(c, usage, err)
+}
+
 type CreateBlockReq struct {
 	ParentID *uuid.UUID     `from:"parent_id" json:"parent_id"`
 	Type     string         `from:"type" json:"type" binding:"required" example:"text"`
@@ -36,7 +51,7 @@ type CreateBlockReq struct {
 // CreateBlock godoc
 //
 //	@Summary		Create block
-//	@Description	Create a new block (supports all types: page, folder, text, sop, etc.). For page and folder types, parent_id is optional. For other types, parent_id is required.
+//	@Description	Create a new block (supports all types: page, folder, text, sop, reference, code, table, todo, markdown). For page and folder types, parent_id is optional. For other types, parent_id is required and must be a page. The props of code, table, todo and markdown blocks are validated: code requires a language and takes the code, table requires columns, a list of {name, type} with type text, number or boolean, and takes rows, lists of a cell per column (at most 1000 rows), todo takes checked, a boolean, and text, markdown takes content. A reference block requires reference_block_id, the ID of another block or page of the space, and is listed in the backlinks of its target. Once the parent has as many children as the server soft limit the response carries an X-Acontext-Limit-Warning header, a parent at the hard limit refuses new children with 422.
 //	@Tags			block
 //	@Accept			json
 //	@Produce		json
@@ -44,6 +59,10 @@ type CreateBlockReq struct {
 //	@Param			payload		body	handler.CreateBlockReq	true	"CreateBlock payload"
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=httpclient.InsertBlockResponse}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Create a page\npage = client.blocks.create(\n    space_id='space-uuid',\n    block_type='page',\n    title='My Page'\n)\n\n# Create a text block under the page\ntext_block = client.blocks.create(\n    space_id='space-uuid',\n    parent_id=page['id'],\n    block_type='text',\n    title='Content',\n    props={\"text\": \"Block content here\"}\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Create a page\nconst page = await client.blocks.create('space-uuid', {\n  blockType: 'page',\n  title: 'My Page'\n});\n\n// Create a text block under the page\nconst textBlock = await client.blocks.create('space-uuid', {\n  parentId: page.id,\n  blockType: 'text',\n  title: 'Content',\n  props: { text: 'Block content here' }\n});\n","label":"JavaScript"}]
 func (h *BlockHandler) CreateBlock(c *gin.Context) {
@@ -83,9 +102,14 @@ func (h *BlockHandler) CreateBlock(c *gin.Context) {
 		Type:     req.Type,
 		Title:    req.Title,
 		ParentID: req.ParentID,
+		Props:    datatypes.NewJSONType(req.Props),
 	}
 
 	// 2. Validate basic block constraints
+	if err := service.ValidateBlockProps(tempBlock); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("props", err))
+		return
+	}
 	if err := tempBlock.Validate(); err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
@@ -110,6 +134,19 @@ func (h *BlockHandler) CreateBlock(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, serializer.ParamErr("parent_id", err))
 			return
 		}
+
+		if !h.checkChildren(c, req.ParentID) {
+			return
+		}
+	}
+
+	// 4. A reference must point at a block of the space
+	if target, ok := tempBlock.ReferenceBlockID(); ok {
+		ref, err := h.svc.GetBlockProperties(c.Request.Context(), target)
+		if err != nil || ref.SpaceID != spaceID {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("props", errors.New("referenced block not found")))
+			return
+		}
 	}
 
 	// Prepare request for Core service
@@ -141,6 +178,9 @@ func (h *BlockHandler) CreateBlock(c *gin.Context) {
 //	@Param			block_id	path	string	true	"Block ID"	Format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block/{block_id} [delete]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete a block\nclient.blocks.delete(space_id='space-uuid', block_id='block-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete a block\nawait client.blocks.delete('space-uuid', 'block-uuid');\n","label":"JavaScript"}]
 func (h *BlockHandler) DeleteBlock(c *gin.Context) {
@@ -167,7 +207,7 @@ func (h *BlockHandler) DeleteBlock(c *gin.Context) {
 // GetBlockProperties godoc
 //
 //	@Summary		Get block properties
-//	@Description	Get a block's properties by its ID (works for all block types: page, folder, text, sop, etc.)
+//	@Description	Get a block's properties by its ID (works for all block types: page, folder, text, sop, etc.). The ETag header is the version of the block, to update it with If-Match.
 //	@Tags			block
 //	@Accept			json
 //	@Produce		json
@@ -175,6 +215,9 @@ func (h *BlockHandler) DeleteBlock(c *gin.Context) {
 //	@Param			block_id	path	string	true	"Block ID"	Format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block/{block_id}/properties [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get block properties\nblock = client.blocks.get_properties(\n    space_id='space-uuid',\n    block_id='block-uuid'\n)\nprint(f\"{block.title}: {block.props}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get block properties\nconst block = await client.blocks.getProperties('space-uuid', 'block-uuid');\nconsole.log(`${block.title}: ${JSON.stringify(block.props)}`);\n","label":"JavaScript"}]
 func (h *BlockHandler) GetBlockProperties(c *gin.Context) {
@@ -190,26 +233,101 @@ func (h *BlockHandler) GetBlockProperties(c *gin.Context) {
 		return
 	}
 
+	if b.Version != 0 {
+		c.Header("ETag", blockETag(b.Version))
+	}
 	c.JSON(http.StatusOK, serializer.Response{Data: b})
 }
 
+func blockETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion parses the block version of an If-Match header, 0 when there is none or it is *
+func ifMatchVersion(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errors.New("If-Match must be a single strong ETag of the block")
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errors.New("If-Match must be a single strong ETag of the block")
+	}
+	return version, nil
+}
+
+type BulkGetBlocksReq struct {
+	BlockIDs []uuid.UUID `form:"block_ids" json:"block_ids" binding:"required,min=1,max=100"`
+}
+
+// BulkGetBlocks godoc
+//
+//	@Summary		Get blocks by IDs
+//	@Description	Get up to 100 blocks of a space in one request, e.g. to render the blocks referenced by a page. Blocks are returned in the order of the requested IDs, and IDs that are not blocks of the space are listed in missing.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string					true	"Space ID"	Format(uuid)
+//	@Param			payload		body	handler.BulkGetBlocksReq	true	"BulkGetBlocks payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.BulkGetBlocksOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/bulk_get [post]
+func (h *BlockHandler) BulkGetBlocks(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := BulkGetBlocksReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.BulkGet(c.Request.Context(), spaceID, req.BlockIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 type UpdateBlockPropertiesReq struct {
 	Title string         `form:"title" json:"title"`
 	Props map[string]any `form:"props" json:"props"`
+	// ExpectedVersion is the version of the block the update is based on, the update is refused once it changed
+	ExpectedVersion *int64 `form:"expected_version" json:"expected_version" binding:"omitempty,min=1" example:"1767225600000000"`
+}
+
+type UpdateBlockPropertiesResp struct {
+	Version int64 `json:"version" example:"1767225600000000"`
 }
 
 // UpdateBlockProperties godoc
 //
 //	@Summary		Update block properties
-//	@Description	Update a block's title and properties by its ID (works for all block types: page, folder, text, sop, etc.)
+//	@Description	Update a block's title and properties by its ID (works for all block types: page, folder, text, sop, etc.). The props of code, table, todo and markdown blocks are validated as on creation, invalid props are refused with 400. To not overwrite the edits of someone else, give the version of the block the update is based on, the version field or ETag of the block, as expected_version or in an If-Match header: once the block changed the update is refused with 409. The response holds the new version.
 //	@Tags			block
 //	@Accept			json
 //	@Produce		json
 //	@Param			space_id	path	string								true	"Space ID"	Format(uuid)
 //	@Param			block_id	path	string								true	"Block ID"	Format(uuid)
+//	@Param			If-Match	header	string								false	"ETag of the version of the block the update is based on"
 //	@Param			payload		body	handler.UpdateBlockPropertiesReq	true	"UpdateBlockProperties payload"
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response
+//	@Success		200	{object}	serializer.Response{data=handler.UpdateBlockPropertiesResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block/{block_id}/properties [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update block properties\nclient.blocks.update_properties(\n    space_id='space-uuid',\n    block_id='block-uuid',\n    title='Updated Title',\n    props={\"text\": \"Updated content\"}\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update block properties\nawait client.blocks.updateProperties('space-uuid', 'block-uuid', {\n  title: 'Updated Title',\n  props: { text: 'Updated content' }\n});\n","label":"JavaScript"}]
 func (h *BlockHandler) UpdateBlockProperties(c *gin.Context) {
@@ -230,17 +348,42 @@ func (h *BlockHandler) UpdateBlockProperties(c *gin.Context) {
 		return
 	}
 
+	version, err := ifMatchVersion(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("If-Match", err))
+		return
+	}
+	if req.ExpectedVersion != nil {
+		if version != 0 && version != *req.ExpectedVersion {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("expected_version", errors.New("expected_version and If-Match differ")))
+			return
+		}
+		version = *req.ExpectedVersion
+	}
+
 	b := model.Block{
-		ID:    blockID,
-		Title: req.Title,
-		Props: datatypes.NewJSONType(req.Props),
+		ID:      blockID,
+		Title:   req.Title,
+		Props:   datatypes.NewJSONType(req.Props),
+		Version: version,
 	}
 	if err := h.svc.UpdateBlockProperties(c.Request.Context(), &b); err != nil {
+		if errors.Is(err, service.ErrInvalidBlockProps) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("props", err))
+			return
+		}
+		if errors.Is(err, service.ErrBlockVersionConflict) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, serializer.Response{})
+	if b.Version != 0 {
+		c.Header("ETag", blockETag(b.Version))
+	}
+	c.JSON(http.StatusOK, serializer.Response{Data: UpdateBlockPropertiesResp{Version: b.Version}})
 }
 
 type ListBlocksReq struct {
@@ -256,10 +399,13 @@ type ListBlocksReq struct {
 //	@Accept			json
 //	@Produce		json
 //	@Param			space_id	path	string	true	"Space ID"		Format(uuid)
-//	@Param			type		query	string	false	"Block type"	Enums(page, folder, text, sop)
+//	@Param			type		query	string	false	"Block type"	Enums(page, folder, text, sop, code, table, todo, markdown)
 //	@Param			parent_id	query	string	false	"Parent ID"		Format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=[]model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List blocks\nblocks = client.blocks.list(\n    space_id='space-uuid',\n    parent_id='parent-uuid',\n    block_type='page'\n)\nfor block in blocks:\n    print(f\"{block.id}: {block.title}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List blocks\nconst blocks = await client.blocks.list('space-uuid', {\n  parentId: 'parent-uuid',\n  type: 'page'\n});\nfor (const block of blocks) {\n  console.log(`${block.id}: ${block.title}`);\n}\n","label":"JavaScript"}]
 func (h *BlockHandler) ListBlocks(c *gin.Context) {
@@ -296,6 +442,196 @@ func (h *BlockHandler) ListBlocks(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{Data: list})
 }
 
+type GetPageTreeReq struct {
+	Depth int `form:"depth,default=3" json:"depth" binding:"min=1,max=10" example:"3"`
+}
+
+// GetPageTree godoc
+//
+//	@Summary		Get page tree
+//	@Description	Get a page or folder with its descendants nested in children, depth levels deep, instead of listing the children of each level with GET /space/{space_id}/block. Children are in the order of that listing. Blocks at the last level with children of their own have has_more set, get their tree to go deeper.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"							Format(uuid)
+//	@Param			page_id		path	string	true	"Page or folder ID"					Format(uuid)
+//	@Param			depth		query	integer	false	"Levels of descendants, default 3. Max 10."	example(3)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.BlockTreeNode}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/page/{page_id}/tree [get]
+func (h *BlockHandler) GetPageTree(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	pageID, err := uuid.Parse(c.Param("page_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("page_id", err))
+		return
+	}
+
+	req := GetPageTreeReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	tree, err := h.svc.Tree(c.Request.Context(), spaceID, pageID, req.Depth)
+	if err != nil {
+		if errors.Is(err, service.ErrBlockNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: tree})
+}
+
+// GetPageBySlug godoc
+//
+//	@Summary		Get page by slug
+//	@Description	Get a page by its slug, the permalink made from its title when the page is created: lowercase letters and digits joined by dashes, with a -2, -3... suffix when another page of the space has it. The slug of a page is kept when the page is renamed or moved, so links built on it do not depend on the page ID.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			slug		path	string	true	"Page slug"	example(getting-started)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/page/by-slug/{slug} [get]
+func (h *BlockHandler) GetPageBySlug(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	page, err := h.svc.GetPageBySlug(c.Request.Context(), spaceID, c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, service.ErrBlockNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: page})
+}
+
+// GetBlockBacklinks godoc
+//
+//	@Summary		Get block backlinks
+//	@Description	List the reference blocks of the space pointing at a block or page, oldest first, so a graph of pages linked by reference blocks can be walked in both directions. The parent_id of a backlink is the page holding the reference.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			block_id	path	string	true	"Block ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/backlinks [get]
+func (h *BlockHandler) GetBlockBacklinks(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	backlinks, err := h.svc.Backlinks(c.Request.Context(), spaceID, blockID)
+	if err != nil {
+		if errors.Is(err, service.ErrBlockNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: backlinks})
+}
+
+type RenderPageReq struct {
+	Format string `form:"format,default=markdown" json:"format" binding:"oneof=markdown html" example:"markdown"`
+}
+
+// RenderPage godoc
+//
+//	@Summary		Render page
+//	@Description	Serialize a page and its content blocks that are not archived, in sort order, into a single Markdown or HTML document. A reference block is rendered as the content block it references, or as a link line when it references a page or folder; a reference whose target was deleted is rendered as broken. HTML is escaped: the content of markdown blocks is kept as preformatted text.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		text/markdown
+//	@Produce		text/html
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			page_id		path	string	true	"Page ID"	Format(uuid)
+//	@Param			format		query	string	false	"Document format, markdown by default"	Enums(markdown, html)
+//	@Security		BearerAuth
+//	@Success		200	{string}	string	"The rendered page"
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/page/{page_id}/render [get]
+func (h *BlockHandler) RenderPage(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	pageID, err := uuid.Parse(c.Param("page_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := RenderPageReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	doc, err := h.svc.RenderPage(c.Request.Context(), spaceID, pageID, req.Format)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBlockNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrNotAPage):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("page_id", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	contentType := "text/markdown; charset=utf-8"
+	if req.Format == service.PageRenderHTML {
+		contentType = "text/html; charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, []byte(doc))
+}
+
 type MoveBlockReq struct {
 	ParentID *uuid.UUID `form:"parent_id" json:"parent_id"`
 	Sort     *int64     `form:"sort" json:"sort"`
@@ -304,7 +640,7 @@ type MoveBlockReq struct {
 // MoveBlock godoc
 //
 //	@Summary		Move block
-//	@Description	Move block by updating its parent_id. Works for all block types (page, folder, text, sop, etc.). For page and folder types, parent_id can be null (root level).
+//	@Description	Move block by updating its parent_id. Works for all block types (page, folder, text, sop, etc.). For page and folder types, parent_id can be null (root level). The children limits of the new parent apply as in POST /space/{space_id}/block.
 //	@Tags			block
 //	@Accept			json
 //	@Produce		json
@@ -313,6 +649,10 @@ type MoveBlockReq struct {
 //	@Param			payload		body	handler.MoveBlockReq	true	"MoveBlock payload"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block/{block_id}/move [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Move block to a different parent\nclient.blocks.move(\n    space_id='space-uuid',\n    block_id='block-uuid',\n    parent_id='new-parent-uuid'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Move block to a different parent\nawait client.blocks.move('space-uuid', 'block-uuid', {\n  parentId: 'new-parent-uuid'\n});\n","label":"JavaScript"}]
 func (h *BlockHandler) MoveBlock(c *gin.Context) {
@@ -334,6 +674,10 @@ func (h *BlockHandler) MoveBlock(c *gin.Context) {
 		return
 	}
 
+	if !h.checkChildren(c, req.ParentID) {
+		return
+	}
+
 	// Use unified Move method - it handles special logic for folder path
 	if err := h.svc.Move(c.Request.Context(), blockID, req.ParentID, req.Sort); err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
@@ -343,6 +687,152 @@ func (h *BlockHandler) MoveBlock(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
+type DuplicateBlockReq struct {
+	Deep bool `form:"deep" json:"-" example:"true"`
+	// ParentID is the parent of the copy, the parent of the block when omitted
+	ParentID *uuid.UUID `form:"-" json:"parent_id"`
+}
+
+// DuplicateBlock godoc
+//
+//	@Summary		Duplicate block
+//	@Description	Copy a block to the end of the blocks of its parent, or of parent_id, and return the copy. With deep=true the descendants of the block, archived ones included, are copied too and keep their order under their copied parent. Copies get new IDs and the folder paths of copied folders follow their new parent; all copies are written in one transaction, at most 5000 blocks. A copy taking its parent, or a copied block, over the server hard limit of children is refused with 422.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string						true	"Space ID"	Format(uuid)
+//	@Param			block_id	path	string						true	"Block ID"	Format(uuid)
+//	@Param			deep		query	bool						false	"Copy the descendants of the block too"	example(true)
+//	@Param			payload		body	handler.DuplicateBlockReq	false	"DuplicateBlock payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/duplicate [post]
+func (h *BlockHandler) DuplicateBlock(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := DuplicateBlockReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	copied, err := h.svc.Duplicate(c.Request.Context(), service.DuplicateBlockInput{
+		SpaceID:  spaceID,
+		BlockID:  blockID,
+		ParentID: req.ParentID,
+		Deep:     req.Deep,
+	})
+	if err != nil {
+		switch {
+		case limitExceeded(c, err):
+		case errors.Is(err, service.ErrBlockNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrInvalidDuplicateParent), errors.Is(err, service.ErrDuplicateTooLarge):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: copied})
+}
+
+type CopyBlockToReq struct {
+	// SpaceID is the space the copy goes to, a space of the same project
+	SpaceID uuid.UUID `json:"space_id" binding:"required"`
+	// ParentID is the parent of the copy in that space, the root of the space when omitted
+	ParentID *uuid.UUID `json:"parent_id"`
+	Deep     bool       `json:"deep" example:"true"`
+}
+
+// CopyBlockTo godoc
+//
+//	@Summary		Copy block to another space
+//	@Description	Copy a block to the end of the blocks of parent_id in another space of the project, or to the root of that space, and return the copy, e.g. to promote curated pages from a scratch space to a shared one. With deep=true the descendants of the block, archived ones included, are copied too and keep their order under their copied parent. The parent must suit the type of the block as in POST /space/{space_id}/block. A reference block of the copy points at the copy of its target, and a reference to a block that is not copied along is refused with 400. Copies get new IDs; all copies are written in one transaction, at most 5000 blocks. A copy taking its parent, or a copied block, over the server hard limit of children is refused with 422.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string					true	"Space ID of the block"	Format(uuid)
+//	@Param			block_id	path	string					true	"Block ID"	Format(uuid)
+//	@Param			payload		body	handler.CopyBlockToReq	true	"CopyBlockTo payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/copy_to [post]
+func (h *BlockHandler) CopyBlockTo(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := CopyBlockToReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	copied, err := h.svc.Duplicate(c.Request.Context(), service.DuplicateBlockInput{
+		SpaceID:       spaceID,
+		BlockID:       blockID,
+		ParentID:      req.ParentID,
+		Deep:          req.Deep,
+		TargetSpaceID: req.SpaceID,
+		ProjectID:     project.ID,
+	})
+	if err != nil {
+		switch {
+		case limitExceeded(c, err):
+		case errors.Is(err, service.ErrBlockNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrInvalidDuplicateParent), errors.Is(err, service.ErrDuplicateTooLarge), errors.Is(err, service.ErrCopyReferenceOutside):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: copied})
+}
+
 type UpdateBlockSortReq struct {
 	Sort int64 `form:"sort" json:"sort"`
 }
@@ -359,6 +849,9 @@ type UpdateBlockSortReq struct {
 //	@Param			payload		body	handler.UpdateBlockSortReq	true	"UpdateBlockSort payload"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/block/{block_id}/sort [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update block sort order\nclient.blocks.update_sort(\n    space_id='space-uuid',\n    block_id='block-uuid',\n    sort=5\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update block sort order\nawait client.blocks.updateSort('space-uuid', 'block-uuid', {\n  sort: 5\n});\n","label":"JavaScript"}]
 func (h *BlockHandler) UpdateBlockSort(c *gin.Context) {
@@ -381,3 +874,58 @@ func (h *BlockHandler) UpdateBlockSort(c *gin.Context) {
 
 	c.JSON(http.StatusOK, serializer.Response{})
 }
+
+type ReorderChildrenReq struct {
+	// ChildIDs are all the children of the block, in their new order
+	ChildIDs []uuid.UUID `form:"child_ids" json:"child_ids" binding:"required,max=10000"`
+}
+
+// ReorderChildren godoc
+//
+//	@Summary		Reorder children
+//	@Description	Order all the children of a page or folder at once: child_ids lists every child of the block exactly once, archived ones included, and the children get the sorts 0, 1, 2... in this order in one transaction. Unlike moving children one by one with PUT /space/{space_id}/block/{block_id}/sort, siblings never collide on their sort. A list that misses a child, repeats one or has a block that is not a child is refused with 400.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string						true	"Space ID"	Format(uuid)
+//	@Param			page_id		path	string						true	"Page or folder ID"	Format(uuid)
+//	@Param			payload		body	handler.ReorderChildrenReq	true	"ReorderChildren payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/page/{page_id}/children/order [put]
+func (h *BlockHandler) ReorderChildren(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	pageID, err := uuid.Parse(c.Param("page_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := ReorderChildrenReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.ReorderChildren(c.Request.Context(), spaceID, pageID, req.ChildIDs); err != nil {
+		switch {
+		case errors.Is(err, service.ErrBlockNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrInvalidChildrenOrder):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("child_ids", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
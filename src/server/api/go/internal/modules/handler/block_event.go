@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type BlockEventHandler struct {
+	svc service.BlockEventService
+}
+
+func NewBlockEventHandler(s service.BlockEventService) *BlockEventHandler {
+	return &BlockEventHandler{svc: s}
+}
+
+type BlockWebhookResp struct {
+	URL string `json:"url"`
+}
+
+// GetBlockWebhook godoc
+//
+//	@Summary		Get block webhook
+//	@Description	Get the URL the block events of the project are posted to. An empty url means the events are only published to the message queue.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.BlockWebhookResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/block_webhook [get]
+func (h *BlockEventHandler) GetBlockWebhook(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: BlockWebhookResp{URL: h.svc.GetWebhook(c.Request.Context(), project)}})
+}
+
+type UpdateBlockWebhookReq struct {
+	// URL receives every block event as a JSON POST, empty removes the webhook
+	URL string `json:"url" binding:"max=2048" example:"https://hooks.example.com/acontext/blocks"`
+}
+
+// UpdateBlockWebhook godoc
+//
+//	@Summary		Update block webhook
+//	@Description	Replace the URL the block events of the project are posted to. An event is posted as JSON when a block or page is created, updated, moved or deleted, through the API, by the core, or along with its parent, with the block before and after the change: type is one of created, updated, moved and deleted, before is null for created and after is null for deleted. The changes a single write made to a block are one event, and every block whose position changes is moved. Each event is posted once, a failed delivery is not retried. An empty url removes the webhook.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateBlockWebhookReq	true	"UpdateBlockWebhook payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.BlockWebhookResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/block_webhook [put]
+func (h *BlockEventHandler) UpdateBlockWebhook(c *gin.Context) {
+	req := UpdateBlockWebhookReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	url, err := h.svc.UpdateWebhook(c.Request.Context(), project, req.URL)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBlockWebhook) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: BlockWebhookResp{URL: url}})
+}
@@ -13,8 +13,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/datatypes"
 )
 
 // MockBlockService is a mock implementation of BlockService
@@ -65,6 +67,56 @@ func (m *MockBlockService) UpdateSort(ctx context.Context, blockID uuid.UUID, so
 	return args.Error(0)
 }
 
+func (m *MockBlockService) BulkGet(ctx context.Context, spaceID uuid.UUID, blockIDs []uuid.UUID) (*service.BulkGetBlocksOutput, error) {
+	args := m.Called(ctx, spaceID, blockIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.BulkGetBlocksOutput), args.Error(1)
+}
+
+func (m *MockBlockService) Tree(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID, depth int) (*service.BlockTreeNode, error) {
+	args := m.Called(ctx, spaceID, blockID, depth)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.BlockTreeNode), args.Error(1)
+}
+
+func (m *MockBlockService) Duplicate(ctx context.Context, in service.DuplicateBlockInput) (*model.Block, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockBlockService) GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error) {
+	args := m.Called(ctx, spaceID, slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockBlockService) ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, childIDs []uuid.UUID) error {
+	args := m.Called(ctx, spaceID, parentID, childIDs)
+	return args.Error(0)
+}
+
+func (m *MockBlockService) Backlinks(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID, blockID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockBlockService) RenderPage(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID, format string) (string, error) {
+	args := m.Called(ctx, spaceID, pageID, format)
+	return args.String(0), args.Error(1)
+}
+
 func setupRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -155,7 +207,7 @@ func TestBlockHandler_CreateBlock_Page(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -231,7 +283,7 @@ func TestBlockHandler_DeleteBlock_Page(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -254,6 +306,7 @@ func TestBlockHandler_DeleteBlock_Page(t *testing.T) {
 func TestBlockHandler_CreateBlock_Text(t *testing.T) {
 	spaceID := uuid.New()
 	parentID := uuid.New()
+	targetID := uuid.New()
 
 	tests := []struct {
 		name           string
@@ -291,6 +344,48 @@ func TestBlockHandler_CreateBlock_Text(t *testing.T) {
 			setup:          func(svc *MockBlockService) {},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:         "code block without language",
+			spaceIDParam: spaceID.String(),
+			requestBody: CreateBlockReq{
+				ParentID: &parentID,
+				Type:     "code",
+				Title:    "build",
+				Props:    map[string]any{"code": "make build"},
+			},
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "table row with missing cells",
+			spaceIDParam: spaceID.String(),
+			requestBody: CreateBlockReq{
+				ParentID: &parentID,
+				Type:     "table",
+				Title:    "hosts",
+				Props: map[string]any{
+					"columns": []any{map[string]any{"name": "host"}, map[string]any{"name": "cpus", "type": "number"}},
+					"rows":    []any{[]any{"a"}},
+				},
+			},
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "reference to a block of another space",
+			spaceIDParam: spaceID.String(),
+			requestBody: CreateBlockReq{
+				ParentID: &parentID,
+				Type:     model.BlockTypeReference,
+				Title:    "see also",
+				Props:    map[string]any{"reference_block_id": targetID.String()},
+			},
+			setup: func(svc *MockBlockService) {
+				svc.On("GetBlockProperties", mock.Anything, parentID).Return(&model.Block{ID: parentID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+				svc.On("GetBlockProperties", mock.Anything, targetID).Return(&model.Block{ID: targetID, SpaceID: uuid.New(), Type: model.BlockTypePage}, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:         "title contains path separator",
 			spaceIDParam: spaceID.String(),
@@ -326,7 +421,7 @@ func TestBlockHandler_CreateBlock_Text(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -441,7 +536,7 @@ func TestBlockHandler_CreateBlock_Folder(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -517,7 +612,7 @@ func TestBlockHandler_DeleteBlock_Folder(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -593,7 +688,7 @@ func TestBlockHandler_ListBlocks_Folders(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -617,16 +712,21 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 	blockID := uuid.New()
 
 	type UpdateBlockPropertiesReq struct {
-		Title string         `json:"title"`
-		Props map[string]any `json:"props"`
+		Title           string         `json:"title"`
+		Props           map[string]any `json:"props"`
+		ExpectedVersion *int64         `json:"expected_version,omitempty"`
 	}
+	version := int64(1767225600000000)
+	otherVersion := version + 1
 
 	tests := []struct {
 		name           string
 		blockIDParam   string
 		requestBody    UpdateBlockPropertiesReq
+		ifMatch        string
 		setup          func(*MockBlockService)
 		expectedStatus int
+		expectedETag   string
 		skip           bool // Skip tests that require Core service
 	}{
 		{
@@ -643,6 +743,59 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:         "update at the version of If-Match",
+			blockIDParam: blockID.String(),
+			requestBody:  UpdateBlockPropertiesReq{Title: "Updated Title"},
+			ifMatch:      `"1767225600000000"`,
+			setup: func(svc *MockBlockService) {
+				svc.On("UpdateBlockProperties", mock.Anything, mock.MatchedBy(func(b *model.Block) bool {
+					return b.ID == blockID && b.Version == version
+				})).Run(func(args mock.Arguments) {
+					args.Get(1).(*model.Block).Version = otherVersion
+				}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"1767225600000001"`,
+		},
+		{
+			name:         "update at expected_version",
+			blockIDParam: blockID.String(),
+			requestBody:  UpdateBlockPropertiesReq{Title: "Updated Title", ExpectedVersion: &version},
+			ifMatch:      `"1767225600000000"`,
+			setup: func(svc *MockBlockService) {
+				svc.On("UpdateBlockProperties", mock.Anything, mock.MatchedBy(func(b *model.Block) bool {
+					return b.Version == version
+				})).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"1767225600000000"`,
+		},
+		{
+			name:         "block changed since the expected version",
+			blockIDParam: blockID.String(),
+			requestBody:  UpdateBlockPropertiesReq{Title: "Updated Title", ExpectedVersion: &version},
+			setup: func(svc *MockBlockService) {
+				svc.On("UpdateBlockProperties", mock.Anything, mock.Anything).Return(service.ErrBlockVersionConflict)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "expected_version and If-Match differ",
+			blockIDParam:   blockID.String(),
+			requestBody:    UpdateBlockPropertiesReq{Title: "Updated Title", ExpectedVersion: &otherVersion},
+			ifMatch:        `"1767225600000000"`,
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "weak If-Match",
+			blockIDParam:   blockID.String(),
+			requestBody:    UpdateBlockPropertiesReq{Title: "Updated Title"},
+			ifMatch:        `W/"1767225600000000"`,
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "invalid block ID",
 			blockIDParam:   "invalid-uuid",
@@ -670,6 +823,17 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:         "props invalid for the block type",
+			blockIDParam: blockID.String(),
+			requestBody: UpdateBlockPropertiesReq{
+				Props: map[string]any{"checked": "yes"},
+			},
+			setup: func(svc *MockBlockService) {
+				svc.On("UpdateBlockProperties", mock.Anything, mock.Anything).Return(service.ErrInvalidBlockProps)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -680,7 +844,7 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 			mockService := &MockBlockService{}
 			tt.setup(mockService)
 
-			handler := NewBlockHandler(mockService, getMockBlockCoreClient())
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
 			router := setupRouter()
 			// Add middleware to set project in context
 			router.Use(func(c *gin.Context) {
@@ -692,6 +856,527 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 			body, _ := sonic.Marshal(tt.requestBody)
 			req := httptest.NewRequest("PUT", "/space/"+uuid.New().String()+"/block/"+tt.blockIDParam+"/properties", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedETag, w.Header().Get("ETag"))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_BulkGetBlocks(t *testing.T) {
+	spaceID := uuid.New()
+	blockID := uuid.New()
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = uuid.New().String()
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    any
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name:        "success",
+			requestBody: map[string]any{"block_ids": []string{blockID.String()}},
+			setup: func(svc *MockBlockService) {
+				svc.On("BulkGet", mock.Anything, spaceID, []uuid.UUID{blockID}).Return(&service.BulkGetBlocksOutput{
+					Blocks:  []model.Block{{ID: blockID, SpaceID: spaceID, Type: model.BlockTypeText}},
+					Missing: []uuid.UUID{},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "empty ids",
+			requestBody:    map[string]any{"block_ids": []string{}},
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too many ids",
+			requestBody:    map[string]any{"block_ids": tooMany},
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid id",
+			requestBody:    map[string]any{"block_ids": []string{"invalid-uuid"}},
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "service layer error",
+			requestBody: map[string]any{"block_ids": []string{blockID.String()}},
+			setup: func(svc *MockBlockService) {
+				svc.On("BulkGet", mock.Anything, spaceID, []uuid.UUID{blockID}).Return(nil, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.POST("/space/:space_id/block/bulk_get", handler.BulkGetBlocks)
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/block/bulk_get", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_GetPageTree(t *testing.T) {
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	tree := &service.BlockTreeNode{
+		Block: &model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage},
+		Children: []*service.BlockTreeNode{
+			{Block: &model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeText}, Children: []*service.BlockTreeNode{}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name:  "default depth",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("Tree", mock.Anything, spaceID, pageID, 3).Return(tree, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "depth",
+			query: "?depth=1",
+			setup: func(svc *MockBlockService) {
+				svc.On("Tree", mock.Anything, spaceID, pageID, 1).Return(tree, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "depth too large",
+			query:          "?depth=11",
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "page not found",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("Tree", mock.Anything, spaceID, pageID, 3).Return(nil, service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.GET("/space/:space_id/page/:page_id/tree", handler.GetPageTree)
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/page/"+pageID.String()+"/tree"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data struct {
+						ID       uuid.UUID `json:"id"`
+						Children []struct {
+							ID uuid.UUID `json:"id"`
+						} `json:"children"`
+					} `json:"data"`
+				}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, pageID, resp.Data.ID)
+				if assert.Len(t, resp.Data.Children, 1) {
+					assert.Equal(t, tree.Children[0].ID, resp.Data.Children[0].ID)
+				}
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_GetPageBySlug(t *testing.T) {
+	spaceID := uuid.New()
+	slug := "getting-started"
+	page := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "Getting Started", Slug: &slug}
+
+	tests := []struct {
+		name           string
+		slug           string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name: "found",
+			slug: slug,
+			setup: func(svc *MockBlockService) {
+				svc.On("GetPageBySlug", mock.Anything, spaceID, slug).Return(page, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "not found",
+			slug: "missing",
+			setup: func(svc *MockBlockService) {
+				svc.On("GetPageBySlug", mock.Anything, spaceID, "missing").Return(nil, service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.GET("/space/:space_id/page/:page_id/tree", handler.GetPageTree)
+			router.GET("/space/:space_id/page/by-slug/:slug", handler.GetPageBySlug)
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/page/by-slug/"+tt.slug, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data struct {
+						ID   uuid.UUID `json:"id"`
+						Slug string    `json:"slug"`
+					} `json:"data"`
+				}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, page.ID, resp.Data.ID)
+				assert.Equal(t, slug, resp.Data.Slug)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_ReorderChildren(t *testing.T) {
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	order := []uuid.UUID{uuid.New(), uuid.New()}
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name: "reorder",
+			body: `{"child_ids":["` + order[0].String() + `","` + order[1].String() + `"]}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("ReorderChildren", mock.Anything, spaceID, pageID, order).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "order missing a child",
+			body: `{"child_ids":["` + order[0].String() + `"]}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("ReorderChildren", mock.Anything, spaceID, pageID, order[:1]).Return(service.ErrInvalidChildrenOrder)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "page not found",
+			body: `{"child_ids":[]}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("ReorderChildren", mock.Anything, spaceID, pageID, []uuid.UUID{}).Return(service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "without child_ids",
+			body:           `{}`,
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.PUT("/space/:space_id/page/:page_id/children/order", handler.ReorderChildren)
+
+			req := httptest.NewRequest("PUT", "/space/"+spaceID.String()+"/page/"+pageID.String()+"/children/order", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_GetBlockBacklinks(t *testing.T) {
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	otherPageID := uuid.New()
+	ref := model.Block{
+		ID:       uuid.New(),
+		SpaceID:  spaceID,
+		Type:     model.BlockTypeReference,
+		ParentID: &otherPageID,
+		Props:    datatypes.NewJSONType(map[string]any{"reference_block_id": pageID.String()}),
+	}
+
+	tests := []struct {
+		name           string
+		blockIDParam   string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name:         "backlinks",
+			blockIDParam: pageID.String(),
+			setup: func(svc *MockBlockService) {
+				svc.On("Backlinks", mock.Anything, spaceID, pageID).Return([]model.Block{ref}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:         "block not found",
+			blockIDParam: pageID.String(),
+			setup: func(svc *MockBlockService) {
+				svc.On("Backlinks", mock.Anything, spaceID, pageID).Return(nil, service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid block id",
+			blockIDParam:   "not-a-uuid",
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.GET("/space/:space_id/block/:block_id/backlinks", handler.GetBlockBacklinks)
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/block/"+tt.blockIDParam+"/backlinks", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data []struct {
+						ID       uuid.UUID `json:"id"`
+						ParentID uuid.UUID `json:"parent_id"`
+					} `json:"data"`
+				}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				if assert.Len(t, resp.Data, 1) {
+					assert.Equal(t, ref.ID, resp.Data[0].ID)
+					assert.Equal(t, otherPageID, resp.Data[0].ParentID)
+				}
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_DuplicateBlock(t *testing.T) {
+	spaceID := uuid.New()
+	blockID := uuid.New()
+	parentID := uuid.New()
+	copied := &model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &parentID, Type: model.BlockTypePage, Title: "intro"}
+
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name:  "shallow copy without body",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, service.DuplicateBlockInput{SpaceID: spaceID, BlockID: blockID}).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:  "deep copy under a parent",
+			query: "?deep=true",
+			body:  `{"parent_id":"` + parentID.String() + `"}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, service.DuplicateBlockInput{SpaceID: spaceID, BlockID: blockID, ParentID: &parentID, Deep: true}).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid parent_id",
+			query:          "",
+			body:           `{"parent_id":"not-a-uuid"}`,
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "invalid parent",
+			query: "?deep=true",
+			body:  `{"parent_id":"` + parentID.String() + `"}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, mock.Anything).Return(nil, service.ErrInvalidDuplicateParent)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "block not found",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, mock.Anything).Return(nil, service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.POST("/space/:space_id/block/:block_id/duplicate", handler.DuplicateBlock)
+
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/block/"+blockID.String()+"/duplicate"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				var resp struct {
+					Data struct {
+						ID uuid.UUID `json:"id"`
+					} `json:"data"`
+				}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, copied.ID, resp.Data.ID)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBlockHandler_CopyBlockTo(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	targetSpaceID := uuid.New()
+	blockID := uuid.New()
+	parentID := uuid.New()
+	copied := &model.Block{ID: uuid.New(), SpaceID: targetSpaceID, ParentID: &parentID, Type: model.BlockTypePage, Title: "intro"}
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockBlockService)
+		expectedStatus int
+	}{
+		{
+			name: "deep copy under a parent",
+			body: `{"space_id":"` + targetSpaceID.String() + `","parent_id":"` + parentID.String() + `","deep":true}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, service.DuplicateBlockInput{
+					SpaceID: spaceID, BlockID: blockID, ParentID: &parentID, Deep: true, TargetSpaceID: targetSpaceID, ProjectID: projectID,
+				}).Return(copied, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing space_id",
+			body:           `{"parent_id":"` + parentID.String() + `"}`,
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "reference outside of the copy",
+			body: `{"space_id":"` + targetSpaceID.String() + `","deep":true}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, mock.Anything).Return(nil, service.ErrCopyReferenceOutside)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "block not found",
+			body: `{"space_id":"` + targetSpaceID.String() + `"}`,
+			setup: func(svc *MockBlockService) {
+				svc.On("Duplicate", mock.Anything, mock.Anything).Return(nil, service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+			})
+			router.POST("/space/:space_id/block/:block_id/copy_to", handler.CopyBlockTo)
+
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/block/"+blockID.String()+"/copy_to", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
 			router.ServeHTTP(w, req)
@@ -701,3 +1386,78 @@ func TestBlockHandler_UpdateBlockProperties(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockHandler_RenderPage(t *testing.T) {
+	spaceID := uuid.New()
+	pageID := uuid.New()
+
+	tests := []struct {
+		name                string
+		query               string
+		setup               func(*MockBlockService)
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{
+			name:  "markdown by default",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("RenderPage", mock.Anything, spaceID, pageID, "markdown").Return("# Deploy\n\n", nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/markdown; charset=utf-8",
+		},
+		{
+			name:  "html",
+			query: "?format=html",
+			setup: func(svc *MockBlockService) {
+				svc.On("RenderPage", mock.Anything, spaceID, pageID, "html").Return("<!DOCTYPE html>", nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/html; charset=utf-8",
+		},
+		{
+			name:           "unknown format",
+			query:          "?format=pdf",
+			setup:          func(svc *MockBlockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "not a page",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("RenderPage", mock.Anything, spaceID, pageID, "markdown").Return("", service.ErrNotAPage)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "page not found",
+			query: "",
+			setup: func(svc *MockBlockService) {
+				svc.On("RenderPage", mock.Anything, spaceID, pageID, "markdown").Return("", service.ErrBlockNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockBlockService{}
+			tt.setup(mockService)
+
+			handler := NewBlockHandler(mockService, getMockBlockCoreClient(), nil)
+			router := setupRouter()
+			router.GET("/space/:space_id/page/:page_id/render", handler.RenderPage)
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/page/"+pageID.String()+"/render"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedContentType != "" {
+				assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
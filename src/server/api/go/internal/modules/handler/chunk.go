@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/chunker"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/path"
+)
+
+type ChunkHandler struct {
+	svc service.ChunkService
+}
+
+func NewChunkHandler(s service.ChunkService) *ChunkHandler {
+	return &ChunkHandler{svc: s}
+}
+
+// ChunkConfigReq overrides the server chunker defaults; all fields must be set together
+type ChunkConfigReq struct {
+	Strategy      string `form:"strategy" json:"strategy" binding:"omitempty,oneof=tokens headings" example:"headings" enums:"tokens,headings"`
+	MaxTokens     int    `form:"max_tokens" json:"max_tokens" binding:"omitempty,min=16,max=8192" example:"512"`
+	OverlapTokens int    `form:"overlap_tokens" json:"overlap_tokens" binding:"omitempty,min=0" example:"64"`
+}
+
+func (r ChunkConfigReq) toConfig() (*chunker.Config, error) {
+	if r.Strategy == "" && r.MaxTokens == 0 && r.OverlapTokens == 0 {
+		return nil, nil
+	}
+	cfg := &chunker.Config{
+		Strategy:      r.Strategy,
+		MaxTokens:     r.MaxTokens,
+		OverlapTokens: r.OverlapTokens,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type ChunkArtifactReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required" example:"/documents/report.md"` // File path including filename
+	ChunkConfigReq
+}
+
+// ChunkArtifact godoc
+//
+//	@Summary		Chunk artifact
+//	@Description	Split the parsed text of an artifact into retrievable chunks, replacing previous chunks of the artifact. The chunks are then (re-)embedded for search.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.ChunkArtifactReq	true	"ChunkArtifact payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Chunk}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/chunks [post]
+func (h *ChunkHandler) ChunkArtifact(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := ChunkArtifactReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	cfg, err := req.toConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid chunk config", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	chunks, err := h.svc.ChunkArtifact(c.Request.Context(), service.ChunkArtifactInput{
+		ProjectID: project.ID,
+		DiskID:    diskID,
+		Path:      filePath,
+		Filename:  filename,
+		Config:    cfg,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: chunks})
+}
+
+type ListArtifactChunksReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required" example:"/documents/report.md"` // File path including filename
+}
+
+// ListArtifactChunks godoc
+//
+//	@Summary		List artifact chunks
+//	@Description	List the chunks of an artifact in order
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"						Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			file_path	query	string	true	"File path including filename"	example:"/documents/report.md"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Chunk}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/chunks [get]
+func (h *ChunkHandler) ListArtifactChunks(c *gin.Context) {
+	req := ListArtifactChunksReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	chunks, err := h.svc.ListArtifactChunks(c.Request.Context(), diskID, filePath, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: chunks})
+}
+
+// ChunkBlock godoc
+//
+//	@Summary		Chunk block
+//	@Description	Split the content of a page (including its text and sop children) or a single text/sop block into retrievable chunks, replacing previous chunks of the block. The chunks are then (re-)embedded for search.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string					true	"Space ID"	Format(uuid)
+//	@Param			block_id	path	string					true	"Block ID"	Format(uuid)
+//	@Param			payload		body	handler.ChunkConfigReq	false	"Chunk config overrides"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Chunk}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/chunks [post]
+func (h *ChunkHandler) ChunkBlock(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := ChunkConfigReq{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+	}
+	cfg, err := req.toConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid chunk config", err))
+		return
+	}
+
+	chunks, err := h.svc.ChunkBlock(c.Request.Context(), service.ChunkBlockInput{
+		ProjectID: project.ID,
+		SpaceID:   spaceID,
+		BlockID:   blockID,
+		Config:    cfg,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: chunks})
+}
+
+// ListBlockChunks godoc
+//
+//	@Summary		List block chunks
+//	@Description	List the chunks of a page or text block in order
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			block_id	path	string	true	"Block ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Chunk}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/chunks [get]
+func (h *ChunkHandler) ListBlockChunks(c *gin.Context) {
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	chunks, err := h.svc.ListBlockChunks(c.Request.Context(), blockID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: chunks})
+}
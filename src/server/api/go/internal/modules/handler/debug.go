@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// maxRecentGCPauses bounds the GC pauses returned by Runtime, the runtime keeps the last 256
+const maxRecentGCPauses = 16
+
+// DebugHandler serves runtime diagnostics of the API server, authorized with the root admin token
+type DebugHandler struct {
+	started time.Time
+}
+
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{started: time.Now()}
+}
+
+type RuntimeStats struct {
+	GoVersion  string    `json:"go_version" example:"go1.24.0"`
+	UptimeSec  float64   `json:"uptime_sec"`
+	NumCPU     int       `json:"num_cpu"`
+	GOMAXPROCS int       `json:"gomaxprocs"`
+	Goroutines int       `json:"goroutines"`
+	Heap       HeapStats `json:"heap"`
+	GC         GCStats   `json:"gc"`
+}
+
+type HeapStats struct {
+	AllocBytes    uint64 `json:"alloc_bytes"`
+	InuseBytes    uint64 `json:"inuse_bytes"`
+	IdleBytes     uint64 `json:"idle_bytes"`
+	ReleasedBytes uint64 `json:"released_bytes"`
+	Objects       uint64 `json:"objects"`
+	// SysBytes is the memory obtained from the OS by the whole runtime, heap or not
+	SysBytes uint64 `json:"sys_bytes"`
+}
+
+type GCStats struct {
+	NumGC        uint32  `json:"num_gc"`
+	NextGCBytes  uint64  `json:"next_gc_bytes"`
+	PauseTotalMs float64 `json:"pause_total_ms"`
+	// RecentPausesMs are the pauses of the latest collections, newest first
+	RecentPausesMs []float64  `json:"recent_pauses_ms"`
+	LastGCAt       *time.Time `json:"last_gc_at"`
+	CPUFraction    float64    `json:"cpu_fraction"`
+}
+
+// Runtime returns the goroutine count, heap statistics and GC pauses of the API server instance answering the request.
+// It is served outside of the API at /debug/runtime next to the pprof endpoints, like them it requires the root admin token.
+func (h *DebugHandler) Runtime(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	out := RuntimeStats{
+		GoVersion:  runtime.Version(),
+		UptimeSec:  time.Since(h.started).Seconds(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		Heap: HeapStats{
+			AllocBytes:    m.HeapAlloc,
+			InuseBytes:    m.HeapInuse,
+			IdleBytes:     m.HeapIdle,
+			ReleasedBytes: m.HeapReleased,
+			Objects:       m.HeapObjects,
+			SysBytes:      m.Sys,
+		},
+		GC: GCStats{
+			NumGC:          m.NumGC,
+			NextGCBytes:    m.NextGC,
+			PauseTotalMs:   float64(m.PauseTotalNs) / 1e6,
+			RecentPausesMs: recentGCPauses(&m),
+			CPUFraction:    m.GCCPUFraction,
+		},
+	}
+	if m.LastGC > 0 {
+		last := time.Unix(0, int64(m.LastGC)).UTC()
+		out.GC.LastGCAt = &last
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// recentGCPauses returns the pauses of the latest collections, newest first, from the circular buffer of m
+func recentGCPauses(m *runtime.MemStats) []float64 {
+	n := min(int(m.NumGC), len(m.PauseNs), maxRecentGCPauses)
+	pauses := make([]float64, 0, n)
+	for i := range n {
+		idx := (int(m.NumGC) - 1 - i) % len(m.PauseNs)
+		pauses = append(pauses, float64(m.PauseNs[idx])/1e6)
+	}
+	return pauses
+}
+
+// Pprof serves the Go pprof endpoints under /debug/pprof/, the index lists the available profiles
+func (h *DebugHandler) Pprof(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		// named profiles, e.g. heap or goroutine, are resolved from the request path
+		pprof.Index(c.Writer, c.Request)
+	}
+}
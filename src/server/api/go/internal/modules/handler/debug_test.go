@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDebugRouter(h *DebugHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/debug/runtime", h.Runtime)
+	r.GET("/debug/pprof/*profile", h.Pprof)
+	return r
+}
+
+func TestDebugHandler_Runtime(t *testing.T) {
+	runtime.GC()
+	router := setupDebugRouter(NewDebugHandler())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/runtime", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data RuntimeStats `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Positive(t, resp.Data.Goroutines)
+	assert.Positive(t, resp.Data.Heap.AllocBytes)
+	assert.Positive(t, resp.Data.GC.NumGC)
+	assert.NotEmpty(t, resp.Data.GC.RecentPausesMs)
+	assert.NotNil(t, resp.Data.GC.LastGCAt)
+}
+
+func TestDebugHandler_Pprof(t *testing.T) {
+	router := setupDebugRouter(NewDebugHandler())
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestRecentGCPauses(t *testing.T) {
+	m := &runtime.MemStats{NumGC: 258}
+	// pauses of collections 257 and 258 wrap around the circular buffer
+	m.PauseNs[0] = 1e6
+	m.PauseNs[1] = 2e6
+	m.PauseNs[255] = 3e6
+
+	pauses := recentGCPauses(m)
+	require.Len(t, pauses, maxRecentGCPauses)
+	assert.Equal(t, []float64{2, 1, 3}, pauses[:3])
+
+	assert.Empty(t, recentGCPauses(&runtime.MemStats{}))
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// DeprecatedParamsHeader lists the deprecated query parameters a request used, the Deprecation header alone would
+// read as the whole endpoint being deprecated
+const DeprecatedParamsHeader = "X-Acontext-Deprecated-Params"
+
+type DeprecationHandler struct {
+	svc service.DeprecationService
+}
+
+func NewDeprecationHandler(s service.DeprecationService) *DeprecationHandler {
+	return &DeprecationHandler{svc: s}
+}
+
+// Announce answers requests to deprecated endpoints or with deprecated query parameters with the Deprecation, Sunset
+// and Link headers, and counts them for the project of the request. With several deprecations the earliest dates win.
+func (h *DeprecationHandler) Announce() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deprecations := h.svc.Match(c.Request.Method, c.FullPath(), c.Request.URL.Query())
+		if len(deprecations) == 0 {
+			c.Next()
+			return
+		}
+
+		var deprecatedAt time.Time
+		var sunset *time.Time
+		var params []string
+		for i, d := range deprecations {
+			if i == 0 || d.DeprecatedAt.Before(deprecatedAt) {
+				deprecatedAt = d.DeprecatedAt
+			}
+			if d.Sunset != nil && (sunset == nil || d.Sunset.Before(*sunset)) {
+				sunset = d.Sunset
+			}
+			if d.Link != "" {
+				c.Writer.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"; type="text/html"`)
+			}
+			if d.Param != "" {
+				params = append(params, d.Param)
+			}
+		}
+		c.Header("Deprecation", "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+		if sunset != nil {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if len(params) > 0 {
+			c.Header(DeprecatedParamsHeader, strings.Join(params, ", "))
+		}
+
+		if project, ok := c.Get("project"); ok {
+			now := time.Now()
+			for _, d := range deprecations {
+				h.svc.Record(project.(*model.Project).ID, d, now)
+			}
+		}
+		c.Next()
+	}
+}
+
+type GetDeprecationReportReq struct {
+	Days int `form:"days,default=30" json:"days" binding:"min=1,max=365" example:"30"`
+}
+
+// GetDeprecationReport godoc
+//
+//	@Summary		Get deprecation report
+//	@Description	List the deprecated endpoints and query parameters of the API with the projects that called them in the last days, most calls first, to reach out to integrators before a sunset. Calls are counted per UTC day. Requires the root admin token.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			days	query	integer	false	"Days of calls, default 30. Max 365."	example(30)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.DeprecationReport}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/admin/deprecations [get]
+func (h *DeprecationHandler) GetDeprecationReport(c *gin.Context) {
+	req := GetDeprecationReportReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	// today counts as the first day
+	since := time.Now().UTC().AddDate(0, 0, 1-req.Days)
+	report, err := h.svc.Report(c.Request.Context(), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: report})
+}
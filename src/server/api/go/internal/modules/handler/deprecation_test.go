@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDeprecationService struct {
+	mock.Mock
+}
+
+func (m *MockDeprecationService) Match(method, path string, query url.Values) []service.Deprecation {
+	args := m.Called(method, path, query)
+	return args.Get(0).([]service.Deprecation)
+}
+
+func (m *MockDeprecationService) Record(projectID uuid.UUID, d service.Deprecation, at time.Time) {
+	m.Called(projectID, d, at)
+}
+
+func (m *MockDeprecationService) Flush(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockDeprecationService) Report(ctx context.Context, since time.Time) (*service.DeprecationReport, error) {
+	args := m.Called(ctx, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.DeprecationReport), args.Error(1)
+}
+
+func TestDeprecationHandler_Announce(t *testing.T) {
+	projectID := uuid.New()
+	deprecatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	endpoint := service.Deprecation{Method: http.MethodGet, Path: "/session/:session_id/messages", DeprecatedAt: deprecatedAt, Sunset: &sunset, Link: "https://docs.acontext.io/migrations/messages"}
+	param := service.Deprecation{Method: http.MethodGet, Path: "/session/:session_id/messages", Param: "format", DeprecatedAt: deprecatedAt.AddDate(0, 1, 0)}
+
+	tests := []struct {
+		name         string
+		deprecations []service.Deprecation
+		wantHeaders  map[string]string
+	}{
+		{
+			name:         "not deprecated",
+			deprecations: nil,
+			wantHeaders:  map[string]string{"Deprecation": "", "Sunset": "", "Link": "", DeprecatedParamsHeader: ""},
+		},
+		{
+			name:         "deprecated endpoint",
+			deprecations: []service.Deprecation{endpoint},
+			wantHeaders: map[string]string{
+				"Deprecation":          "@1767225600",
+				"Sunset":               "Wed, 01 Jul 2026 00:00:00 GMT",
+				"Link":                 `<https://docs.acontext.io/migrations/messages>; rel="deprecation"; type="text/html"`,
+				DeprecatedParamsHeader: "",
+			},
+		},
+		{
+			name:         "deprecated parameter",
+			deprecations: []service.Deprecation{param},
+			wantHeaders:  map[string]string{"Deprecation": "@1769904000", "Sunset": "", "Link": "", DeprecatedParamsHeader: "format"},
+		},
+		{
+			name:         "earliest deprecation wins",
+			deprecations: []service.Deprecation{param, endpoint},
+			wantHeaders:  map[string]string{"Deprecation": "@1767225600", "Sunset": "Wed, 01 Jul 2026 00:00:00 GMT", DeprecatedParamsHeader: "format"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockDeprecationService{}
+			svc.On("Match", http.MethodGet, "/session/:session_id/messages", mock.Anything).Return(tt.deprecations)
+			for _, d := range tt.deprecations {
+				svc.On("Record", projectID, d, mock.Anything).Return()
+			}
+
+			router := setupRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+			})
+			router.Use(NewDeprecationHandler(svc).Announce())
+			router.GET("/session/:session_id/messages", func(c *gin.Context) {
+				c.JSON(http.StatusOK, serializer.Response{})
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+uuid.NewString()+"/messages?format=openai", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			for name, want := range tt.wantHeaders {
+				assert.Equal(t, want, w.Header().Get(name), name)
+			}
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeprecationHandler_GetDeprecationReport(t *testing.T) {
+	report := &service.DeprecationReport{Deprecations: []service.DeprecationUsage{{
+		Deprecation: service.Deprecation{Method: http.MethodGet, Path: "/api/v1/old"},
+		Key:         "GET /api/v1/old",
+		Calls:       3,
+		Projects:    []service.DeprecationProjectUsage{{ProjectID: uuid.New(), Calls: 3}},
+	}}}
+
+	tests := []struct {
+		name           string
+		query          string
+		wantDays       int
+		expectedStatus int
+	}{
+		{"default days", "", 30, http.StatusOK},
+		{"days", "?days=7", 7, http.StatusOK},
+		{"too many days", "?days=366", 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockDeprecationService{}
+			if tt.wantDays > 0 {
+				svc.On("Report", mock.Anything, mock.MatchedBy(func(since time.Time) bool {
+					// today counts as the first day
+					days := time.Since(since).Hours() / 24
+					return days > float64(tt.wantDays-2) && days < float64(tt.wantDays)
+				})).Return(report, nil)
+			}
+
+			router := setupRouter()
+			router.GET("/admin/deprecations", NewDeprecationHandler(svc).GetDeprecationReport)
+
+			req := httptest.NewRequest("GET", "/admin/deprecations"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data service.DeprecationReport `json:"data"`
+				}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				if assert.Len(t, resp.Data.Deprecations, 1) {
+					assert.Equal(t, "GET /api/v1/old", resp.Data.Deprecations[0].Key)
+					assert.Equal(t, int64(3), resp.Data.Deprecations[0].Calls)
+				}
+			}
+			svc.AssertExpectations(t)
+		})
+	}
+}
@@ -35,6 +35,14 @@ func (m *MockDiskService) Delete(ctx context.Context, projectID uuid.UUID, diskI
 	return args.Error(0)
 }
 
+func (m *MockDiskService) Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
 func (m *MockDiskService) List(ctx context.Context, in service.ListDisksInput) (*service.ListDisksOutput, error) {
 	args := m.Called(ctx, in)
 	if args.Get(0) == nil {
@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/path"
+)
+
+type EmbeddingHandler struct {
+	svc        service.EmbeddingService
+	coreClient *httpclient.CoreClient
+}
+
+func NewEmbeddingHandler(s service.EmbeddingService, coreClient *httpclient.CoreClient) *EmbeddingHandler {
+	return &EmbeddingHandler{svc: s, coreClient: coreClient}
+}
+
+// GetEmbeddingConfig godoc
+//
+//	@Summary		Get embedding config
+//	@Description	Get the embedding model and dimensions used by the project
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.EmbeddingConfig}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/embedding/config [get]
+func (h *EmbeddingHandler) GetEmbeddingConfig(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.GetConfig(c.Request.Context(), project)})
+}
+
+type UpdateEmbeddingConfigReq struct {
+	Provider   string `form:"provider" json:"provider" binding:"omitempty,oneof=openai jina" example:"openai"`
+	Model      string `form:"model" json:"model" binding:"required" example:"text-embedding-3-small"`
+	Dimensions int    `form:"dimensions" json:"dimensions" binding:"required,min=1,max=16000" example:"1536"`
+}
+
+// UpdateEmbeddingConfig godoc
+//
+//	@Summary		Update embedding config
+//	@Description	Update the embedding model and dimensions of the project. If the model or dimensions change, a re-embedding job is created and returned so its progress can be tracked.
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateEmbeddingConfigReq	true	"UpdateEmbeddingConfig payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.UpdateEmbeddingConfigOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/embedding/config [put]
+func (h *EmbeddingHandler) UpdateEmbeddingConfig(c *gin.Context) {
+	req := UpdateEmbeddingConfigReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.UpdateConfig(c.Request.Context(), service.UpdateEmbeddingConfigInput{
+		Project: project,
+		Config: model.EmbeddingConfig{
+			Provider:   req.Provider,
+			Model:      req.Model,
+			Dimensions: req.Dimensions,
+		},
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrEmbeddingJobInProgress) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type ListEmbeddingJobsReq struct {
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// ListEmbeddingJobs godoc
+//
+//	@Summary		List re-embedding jobs
+//	@Description	List the re-embedding jobs of the project with their progress
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit		query	integer	false	"Limit of jobs to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example:"false"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListEmbeddingJobsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/embedding/jobs [get]
+func (h *EmbeddingHandler) ListEmbeddingJobs(c *gin.Context) {
+	req := ListEmbeddingJobsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.ListJobs(c.Request.Context(), service.ListEmbeddingJobsInput{
+		ProjectID: project.ID,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetEmbeddingJob godoc
+//
+//	@Summary		Get re-embedding job
+//	@Description	Get a re-embedding job and its progress by ID
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Param			job_id	path	string	true	"Job ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.EmbeddingJob}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/embedding/jobs/{job_id} [get]
+func (h *EmbeddingHandler) GetEmbeddingJob(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	job, err := h.svc.GetJob(c.Request.Context(), project.ID, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: job})
+}
+
+// CancelEmbeddingJob godoc
+//
+//	@Summary		Cancel re-embedding job
+//	@Description	Cancel a pending or running re-embedding job
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Param			job_id	path	string	true	"Job ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.EmbeddingJob}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/embedding/jobs/{job_id}/cancel [post]
+func (h *EmbeddingHandler) CancelEmbeddingJob(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	job, err := h.svc.CancelJob(c.Request.Context(), project.ID, jobID)
+	if err != nil {
+		if errors.Is(err, service.ErrEmbeddingJobNotActive) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: job})
+}
+
+type EmbeddingInput struct {
+	Type string `json:"type" binding:"required,oneof=block message artifact" example:"block" enums:"block,message,artifact"`
+	// ID of the block or of the message
+	ID string `json:"id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// SessionID of the message
+	SessionID string `json:"session_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// DiskID and FilePath of the artifact
+	DiskID   string `json:"disk_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	FilePath string `json:"file_path" example:"/notes/plan.md"`
+}
+
+type CreateEmbeddingsReq struct {
+	Input []EmbeddingInput `json:"input" binding:"required,min=1,max=256,dive"`
+}
+
+// EmbeddingItem is an embedding in the format of the OpenAI embeddings API
+type EmbeddingItem struct {
+	Object    string    `json:"object" example:"embedding"`
+	Index     int       `json:"index" example:"0"`
+	Embedding []float32 `json:"embedding"`
+	// Source is stored for the embeddings of blocks, computed for the ones embedded for the request
+	Source string `json:"source" example:"stored" enums:"stored,computed"`
+}
+
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens" example:"12"`
+	TotalTokens  int `json:"total_tokens" example:"12"`
+}
+
+// CreateEmbeddingsResp is the body of the OpenAI embeddings API, it is not wrapped in serializer.Response
+type CreateEmbeddingsResp struct {
+	Object string          `json:"object" example:"list"`
+	Data   []EmbeddingItem `json:"data"`
+	Model  string          `json:"model" example:"text-embedding-3-small"`
+	Usage  EmbeddingUsage  `json:"usage"`
+}
+
+// CreateEmbeddings godoc
+//
+//	@Summary		Get embeddings of stored content
+//	@Description	Get the embeddings of blocks, messages and artifacts of the project, in the format of the OpenAI embeddings API, so rerankers can reuse them. Blocks return their stored embedding and must be embedded already; messages return the embedding stored at ingest when there is one. Other messages and artifacts are embedded on the fly with the model of the blocks, and count in usage. A message is given by id and session_id, an artifact by disk_id and file_path. The response is not wrapped in a data envelope.
+//	@Tags			embedding
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.CreateEmbeddingsReq	true	"CreateEmbeddings payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	handler.CreateEmbeddingsResp
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/embeddings [post]
+func (h *EmbeddingHandler) CreateEmbeddings(c *gin.Context) {
+	req := CreateEmbeddingsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sources := make([]service.EmbeddingSource, len(req.Input))
+	for i, in := range req.Input {
+		src, err := embeddingSource(in)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("input %d: %w", i, err)))
+			return
+		}
+		sources[i] = src
+	}
+
+	ctx := c.Request.Context()
+	lookups, err := h.svc.Lookup(ctx, project, sources)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmbeddingSourceNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrEmbeddingSourceNoText):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	resp := CreateEmbeddingsResp{
+		Object: "list",
+		Data:   make([]EmbeddingItem, len(lookups)),
+		Model:  h.svc.GetConfig(ctx, project).Model,
+	}
+	var texts []string
+	var pending []int
+	for i, l := range lookups {
+		resp.Data[i] = EmbeddingItem{Object: "embedding", Index: i, Embedding: l.Embedding, Source: "stored"}
+		if l.Embedding == nil {
+			texts = append(texts, l.Text)
+			pending = append(pending, i)
+		}
+	}
+	if len(texts) > 0 {
+		out, err := h.coreClient.Embed(ctx, project.ID, httpclient.EmbedRequest{Texts: texts})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "Failed to call core service", err))
+			return
+		}
+		for j, i := range pending {
+			resp.Data[i].Embedding, resp.Data[i].Source = out.Embeddings[j], "computed"
+		}
+		resp.Model = out.Model
+		resp.Usage = EmbeddingUsage{PromptTokens: out.PromptTokens, TotalTokens: out.TotalTokens}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// embeddingSource checks that an input carries the fields of its type
+func embeddingSource(in EmbeddingInput) (service.EmbeddingSource, error) {
+	src := service.EmbeddingSource{Type: in.Type}
+	switch in.Type {
+	case service.EmbeddingSourceBlock:
+		if in.ID == "" {
+			return src, errors.New("a block needs an id")
+		}
+		src.ID = uuid.MustParse(in.ID)
+	case service.EmbeddingSourceMessage:
+		if in.ID == "" || in.SessionID == "" {
+			return src, errors.New("a message needs an id and a session_id")
+		}
+		src.ID, src.SessionID = uuid.MustParse(in.ID), uuid.MustParse(in.SessionID)
+	case service.EmbeddingSourceArtifact:
+		if in.DiskID == "" || in.FilePath == "" {
+			return src, errors.New("an artifact needs a disk_id and a file_path")
+		}
+		src.DiskID = uuid.MustParse(in.DiskID)
+		src.Path, src.Filename = path.SplitFilePath(in.FilePath)
+		if err := path.ValidatePath(src.Path); err != nil {
+			return src, err
+		}
+	}
+	return src, nil
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+// MockEmbeddingService is a mock implementation of EmbeddingService
+type MockEmbeddingService struct {
+	mock.Mock
+}
+
+func (m *MockEmbeddingService) GetConfig(ctx context.Context, project *model.Project) *model.EmbeddingConfig {
+	args := m.Called(ctx, project)
+	return args.Get(0).(*model.EmbeddingConfig)
+}
+
+func (m *MockEmbeddingService) UpdateConfig(ctx context.Context, in service.UpdateEmbeddingConfigInput) (*service.UpdateEmbeddingConfigOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.UpdateEmbeddingConfigOutput), args.Error(1)
+}
+
+func (m *MockEmbeddingService) ListJobs(ctx context.Context, in service.ListEmbeddingJobsInput) (*service.ListEmbeddingJobsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListEmbeddingJobsOutput), args.Error(1)
+}
+
+func (m *MockEmbeddingService) GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	args := m.Called(ctx, projectID, jobID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.EmbeddingJob), args.Error(1)
+}
+
+func (m *MockEmbeddingService) CancelJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	args := m.Called(ctx, projectID, jobID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.EmbeddingJob), args.Error(1)
+}
+
+func (m *MockEmbeddingService) Lookup(ctx context.Context, project *model.Project, sources []service.EmbeddingSource) ([]service.EmbeddingLookup, error) {
+	args := m.Called(ctx, project, sources)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]service.EmbeddingLookup), args.Error(1)
+}
+
+func setupEmbeddingRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	return gin.New()
+}
+
+func TestEmbeddingHandler_UpdateEmbeddingConfig(t *testing.T) {
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		setup          func(*MockEmbeddingService)
+		expectedStatus int
+	}{
+		{
+			name:        "model change creates job",
+			requestBody: UpdateEmbeddingConfigReq{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("UpdateConfig", mock.Anything, mock.MatchedBy(func(in service.UpdateEmbeddingConfigInput) bool {
+					return in.Project.ID == projectID && in.Config.Model == "text-embedding-3-large"
+				})).Return(&service.UpdateEmbeddingConfigOutput{
+					Config: model.EmbeddingConfig{Provider: "openai", Model: "text-embedding-3-large", Dimensions: 3072},
+					Job:    &model.EmbeddingJob{ID: uuid.New(), Status: model.EmbeddingJobStatusPending},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing dimensions",
+			requestBody:    map[string]interface{}{"model": "text-embedding-3-large"},
+			setup:          func(svc *MockEmbeddingService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown provider",
+			requestBody:    UpdateEmbeddingConfigReq{Provider: "unknown", Model: "m", Dimensions: 8},
+			setup:          func(svc *MockEmbeddingService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "job already in progress",
+			requestBody: UpdateEmbeddingConfigReq{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("UpdateConfig", mock.Anything, mock.Anything).Return(nil, service.ErrEmbeddingJobInProgress)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:        "service layer error",
+			requestBody: UpdateEmbeddingConfigReq{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("UpdateConfig", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockEmbeddingService{}
+			tt.setup(mockService)
+
+			handler := NewEmbeddingHandler(mockService, nil)
+			router := setupEmbeddingRouter()
+			router.PUT("/embedding/config", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.UpdateEmbeddingConfig(c)
+			})
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("PUT", "/embedding/config", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmbeddingHandler_CancelEmbeddingJob(t *testing.T) {
+	projectID := uuid.New()
+	jobID := uuid.New()
+
+	tests := []struct {
+		name           string
+		jobIDParam     string
+		setup          func(*MockEmbeddingService)
+		expectedStatus int
+	}{
+		{
+			name:       "successful cancel",
+			jobIDParam: jobID.String(),
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("CancelJob", mock.Anything, projectID, jobID).Return(&model.EmbeddingJob{ID: jobID, Status: model.EmbeddingJobStatusCancelled}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid job id",
+			jobIDParam:     "invalid-uuid",
+			setup:          func(svc *MockEmbeddingService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "job not active",
+			jobIDParam: jobID.String(),
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("CancelJob", mock.Anything, projectID, jobID).Return(nil, service.ErrEmbeddingJobNotActive)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockEmbeddingService{}
+			tt.setup(mockService)
+
+			handler := NewEmbeddingHandler(mockService, nil)
+			router := setupEmbeddingRouter()
+			router.POST("/embedding/jobs/:job_id/cancel", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.CancelEmbeddingJob(c)
+			})
+
+			req := httptest.NewRequest("POST", "/embedding/jobs/"+tt.jobIDParam+"/cancel", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmbeddingHandler_CreateEmbeddings(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	blockID, messageID, sessionID := uuid.New(), uuid.New(), uuid.New()
+
+	// The core service embeds the texts the stored content has no embedding for
+	var embedded httpclient.EmbedRequest
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/project/"+project.ID.String()+"/embed", r.URL.Path)
+		_ = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&embedded)
+		_, _ = w.Write([]byte(`{"embeddings":[[0.5,0.5]],"model":"text-embedding-3-small","prompt_tokens":3,"total_tokens":3}`))
+	}))
+	defer core.Close()
+	coreClient := &httpclient.CoreClient{BaseURL: core.URL, HTTPClient: core.Client(), Logger: zap.NewNop(), Propagator: propagation.TraceContext{}}
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		setup          func(*MockEmbeddingService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "stored and computed",
+			requestBody: map[string]interface{}{"input": []map[string]interface{}{
+				{"type": "block", "id": blockID.String()},
+				{"type": "message", "id": messageID.String(), "session_id": sessionID.String()},
+			}},
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("Lookup", mock.Anything, project, []service.EmbeddingSource{
+					{Type: "block", ID: blockID},
+					{Type: "message", ID: messageID, SessionID: sessionID},
+				}).Return([]service.EmbeddingLookup{{Embedding: []float32{1, 0}}, {Text: "hello"}}, nil)
+				svc.On("GetConfig", mock.Anything, project).Return(&model.EmbeddingConfig{Model: "text-embedding-3-small"})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[1,0],"source":"stored"},{"object":"embedding","index":1,"embedding":[0.5,0.5],"source":"computed"}],"model":"text-embedding-3-small","usage":{"prompt_tokens":3,"total_tokens":3}}`,
+		},
+		{
+			name:           "message without session",
+			requestBody:    map[string]interface{}{"input": []map[string]interface{}{{"type": "message", "id": messageID.String()}}},
+			setup:          func(svc *MockEmbeddingService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown type",
+			requestBody:    map[string]interface{}{"input": []map[string]interface{}{{"type": "space", "id": blockID.String()}}},
+			setup:          func(svc *MockEmbeddingService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "block not embedded",
+			requestBody: map[string]interface{}{"input": []map[string]interface{}{{"type": "block", "id": blockID.String()}}},
+			setup: func(svc *MockEmbeddingService) {
+				svc.On("Lookup", mock.Anything, project, mock.Anything).Return(nil, service.ErrEmbeddingSourceNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockEmbeddingService{}
+			tt.setup(mockService)
+
+			handler := NewEmbeddingHandler(mockService, coreClient)
+			router := setupEmbeddingRouter()
+			router.POST("/embeddings", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.CreateEmbeddings(c)
+			})
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/embeddings", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				assert.Equal(t, []string{"hello"}, embedded.Texts)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// limitWarningHeader carries the usage of an entity once a write reaches its soft limit
+const limitWarningHeader = "X-Acontext-Limit-Warning"
+
+type EntityLimitHandler struct {
+	svc service.EntityLimitService
+}
+
+func NewEntityLimitHandler(s service.EntityLimitService) *EntityLimitHandler {
+	return &EntityLimitHandler{svc: s}
+}
+
+// EnforceSessionMessages refuses messages sent to a session at its hard limit and warns about the soft limit
+func (h *EntityLimitHandler) EnforceSessionMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// an invalid session id is refused by the handler
+		sessionID, err := uuid.Parse(c.Param("session_id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		usage, err := h.svc.CheckSessionMessages(c.Request.Context(), sessionID, 1)
+		if !applyEntityLimit(c, usage, err) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// applyEntityLimit sets the warning header of usage, or responds to a failed limit check and returns false
+func applyEntityLimit(c *gin.Context, usage *service.EntityLimit, err error) bool {
+	if err != nil {
+		if !limitExceeded(c, err) {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return false
+	}
+	if usage != nil {
+		c.Header(limitWarningHeader, fmt.Sprintf("%s; used=%d; soft=%d; hard=%d", usage.Limit, usage.Used, usage.Soft, usage.Hard))
+	}
+	return true
+}
+
+// limitExceeded responds 422 with the usage when err is a *service.LimitExceededError and returns true
+func limitExceeded(c *gin.Context, err error) bool {
+	var exceeded *service.LimitExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	res := serializer.Err(http.StatusUnprocessableEntity, exceeded.Error(), nil)
+	res.Data = exceeded
+	c.JSON(http.StatusUnprocessableEntity, res)
+	return true
+}
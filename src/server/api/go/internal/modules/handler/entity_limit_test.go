@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEntityLimitService struct {
+	mock.Mock
+}
+
+func (m *MockEntityLimitService) CheckSessionMessages(ctx context.Context, sessionID uuid.UUID, adding int64) (*service.EntityLimit, error) {
+	args := m.Called(ctx, sessionID, adding)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.EntityLimit), args.Error(1)
+}
+
+func (m *MockEntityLimitService) CheckBlockChildren(ctx context.Context, parentID uuid.UUID, adding int64) (*service.EntityLimit, error) {
+	args := m.Called(ctx, parentID, adding)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.EntityLimit), args.Error(1)
+}
+
+func (m *MockEntityLimitService) CheckNewBlockChildren(children map[uuid.UUID]int64) error {
+	args := m.Called(children)
+	return args.Error(0)
+}
+
+func TestEntityLimitHandler_EnforceSessionMessages(t *testing.T) {
+	sessionID := uuid.New()
+	usage := &service.EntityLimit{Limit: service.LimitMessagesPerSession, Used: 8, Soft: 8, Hard: 10}
+
+	tests := []struct {
+		name        string
+		usage       *service.EntityLimit
+		err         error
+		wantStatus  int
+		wantWarning string
+	}{
+		{"under the soft limit", nil, nil, http.StatusCreated, ""},
+		{"soft limit", usage, nil, http.StatusCreated, "messages_per_session; used=8; soft=8; hard=10"},
+		{"hard limit", nil, &service.LimitExceededError{EntityLimit: *usage, Requested: 1}, http.StatusUnprocessableEntity, ""},
+		{"count failure", nil, errors.New("db down"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockEntityLimitService{}
+			svc.On("CheckSessionMessages", mock.Anything, sessionID, int64(1)).Return(tt.usage, tt.err)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/session/:session_id/messages", NewEntityLimitHandler(svc).EnforceSessionMessages(), func(c *gin.Context) {
+				c.JSON(http.StatusCreated, serializer.Response{})
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages", nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantWarning, w.Header().Get(limitWarningHeader))
+			svc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// ListErrorCodes godoc
+//
+//	@Summary		List error codes
+//	@Description	List the error codes of the API with the HTTP status they are sent with. Error responses carry the code in error_code, or in code when the request accepts application/problem+json. No authentication is required.
+//	@Tags			errors
+//	@Produce		json
+//	@Success		200	{object}	serializer.Response{data=[]serializer.ErrorCatalogEntry}
+//	@Router			/errors [get]
+func ListErrorCodes(c *gin.Context) {
+	c.JSON(http.StatusOK, serializer.Response{Data: serializer.ErrorCatalog()})
+}
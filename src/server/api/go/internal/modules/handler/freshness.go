@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/path"
+)
+
+type FreshnessHandler struct {
+	svc service.FreshnessService
+}
+
+func NewFreshnessHandler(s service.FreshnessService) *FreshnessHandler {
+	return &FreshnessHandler{svc: s}
+}
+
+// VerifyBlock godoc
+//
+//	@Summary		Verify block
+//	@Description	Mark the content of a block as still accurate. This resets its freshness and removes it from the review queue. Updating a block resets its freshness too.
+//	@Tags			block
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			block_id	path	string	true	"Block ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Block}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/block/{block_id}/verify [post]
+func (h *FreshnessHandler) VerifyBlock(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	blockID, err := uuid.Parse(c.Param("block_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	b, err := h.svc.VerifyBlock(c.Request.Context(), project.ID, spaceID, blockID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: b})
+}
+
+type VerifyArtifactReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required" example:"/documents/report.md"` // File path including filename
+}
+
+// VerifyArtifact godoc
+//
+//	@Summary		Verify artifact
+//	@Description	Mark the content of an artifact as still accurate. This resets its freshness and removes it from the review queue. Updating an artifact resets its freshness too.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.VerifyArtifactReq	true	"VerifyArtifact payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Artifact}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/disk/{disk_id}/artifact/verify [post]
+func (h *FreshnessHandler) VerifyArtifact(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := VerifyArtifactReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	artifact, err := h.svc.VerifyArtifact(c.Request.Context(), service.VerifyArtifactInput{
+		ProjectID: project.ID,
+		DiskID:    diskID,
+		Path:      filePath,
+		Filename:  filename,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: artifact})
+}
+
+type ScanStaleReq struct {
+	MaxAgeDays int `form:"max_age_days" json:"max_age_days" binding:"omitempty,min=1" example:"90"`
+}
+
+// ScanStale godoc
+//
+//	@Summary		Scan for stale items
+//	@Description	Flag the blocks and artifacts of the project that were neither verified nor updated within max_age_days (default: server config) and add them to the review queue. The same scan runs periodically for all projects.
+//	@Tags			freshness
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.ScanStaleReq	false	"ScanStale payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ScanStaleOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/freshness/scan [post]
+func (h *FreshnessHandler) ScanStale(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := ScanStaleReq{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+	}
+
+	out, err := h.svc.Scan(c.Request.Context(), service.ScanStaleInput{
+		ProjectID: &project.ID,
+		MaxAge:    time.Duration(req.MaxAgeDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type ListReviewQueueReq struct {
+	ItemType string `form:"item_type" json:"item_type" binding:"omitempty,oneof=block artifact" example:"block" enums:"block,artifact"`
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// ListReviewQueue godoc
+//
+//	@Summary		List review queue
+//	@Description	List the stale blocks and artifacts of the project waiting for review. Verify or update an item to remove it from the queue.
+//	@Tags			freshness
+//	@Accept			json
+//	@Produce		json
+//	@Param			item_type	query	string	false	"Filter by item type"	enums(block,artifact)
+//	@Param			limit		query	integer	false	"Limit of items to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	string	false	"Order by flag time descending if true, ascending if false (default false)"	example:"false"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListStaleItemsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/freshness/review [get]
+func (h *FreshnessHandler) ListReviewQueue(c *gin.Context) {
+	req := ListReviewQueueReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.ListReviewQueue(c.Request.Context(), service.ListStaleItemsInput{
+		ProjectID: project.ID,
+		ItemType:  req.ItemType,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockFreshnessService is a mock implementation of FreshnessService
+type MockFreshnessService struct {
+	mock.Mock
+}
+
+func (m *MockFreshnessService) VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID) (*model.Block, error) {
+	args := m.Called(ctx, projectID, spaceID, blockID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockFreshnessService) VerifyArtifact(ctx context.Context, in service.VerifyArtifactInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockFreshnessService) Scan(ctx context.Context, in service.ScanStaleInput) (*service.ScanStaleOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ScanStaleOutput), args.Error(1)
+}
+
+func (m *MockFreshnessService) ListReviewQueue(ctx context.Context, in service.ListStaleItemsInput) (*service.ListStaleItemsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListStaleItemsOutput), args.Error(1)
+}
+
+func setupFreshnessRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	return gin.New()
+}
+
+func TestFreshnessHandler_VerifyBlock(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	blockID := uuid.New()
+
+	tests := []struct {
+		name           string
+		blockIDParam   string
+		setup          func(*MockFreshnessService)
+		expectedStatus int
+	}{
+		{
+			name:         "success",
+			blockIDParam: blockID.String(),
+			setup: func(svc *MockFreshnessService) {
+				now := time.Now()
+				svc.On("VerifyBlock", mock.Anything, projectID, spaceID, blockID).Return(&model.Block{ID: blockID, LastVerifiedAt: &now}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid block id",
+			blockIDParam:   "invalid",
+			setup:          func(svc *MockFreshnessService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "service layer error",
+			blockIDParam: blockID.String(),
+			setup: func(svc *MockFreshnessService) {
+				svc.On("VerifyBlock", mock.Anything, projectID, spaceID, blockID).Return(nil, errors.New("record not found"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockFreshnessService{}
+			tt.setup(mockService)
+
+			handler := NewFreshnessHandler(mockService)
+			router := setupFreshnessRouter()
+			router.POST("/space/:space_id/block/:block_id/verify", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.VerifyBlock(c)
+			})
+
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/block/"+tt.blockIDParam+"/verify", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFreshnessHandler_ScanStale(t *testing.T) {
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		setup          func(*MockFreshnessService)
+		expectedStatus int
+	}{
+		{
+			name:        "default max age",
+			requestBody: nil,
+			setup: func(svc *MockFreshnessService) {
+				svc.On("Scan", mock.Anything, mock.MatchedBy(func(in service.ScanStaleInput) bool {
+					return *in.ProjectID == projectID && in.MaxAge == 0
+				})).Return(&service.ScanStaleOutput{Flagged: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "max age override",
+			requestBody: ScanStaleReq{MaxAgeDays: 30},
+			setup: func(svc *MockFreshnessService) {
+				svc.On("Scan", mock.Anything, mock.MatchedBy(func(in service.ScanStaleInput) bool {
+					return in.MaxAge == 30*24*time.Hour
+				})).Return(&service.ScanStaleOutput{Flagged: 1}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid max age",
+			requestBody:    map[string]interface{}{"max_age_days": -1},
+			setup:          func(svc *MockFreshnessService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockFreshnessService{}
+			tt.setup(mockService)
+
+			handler := NewFreshnessHandler(mockService)
+			router := setupFreshnessRouter()
+			router.POST("/freshness/scan", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.ScanStale(c)
+			})
+
+			var body []byte
+			if tt.requestBody != nil {
+				body, _ = sonic.Marshal(tt.requestBody)
+			}
+			req := httptest.NewRequest("POST", "/freshness/scan", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFreshnessHandler_ListReviewQueue(t *testing.T) {
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockFreshnessService)
+		expectedStatus int
+	}{
+		{
+			name:  "filter by item type",
+			query: "?item_type=artifact&limit=10",
+			setup: func(svc *MockFreshnessService) {
+				svc.On("ListReviewQueue", mock.Anything, service.ListStaleItemsInput{
+					ProjectID: projectID,
+					ItemType:  model.StaleItemTypeArtifact,
+					Limit:     10,
+				}).Return(&service.ListStaleItemsOutput{Items: []model.StaleItem{{ID: uuid.New(), ItemType: model.StaleItemTypeArtifact}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid item type",
+			query:          "?item_type=session",
+			setup:          func(svc *MockFreshnessService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockFreshnessService{}
+			tt.setup(mockService)
+
+			handler := NewFreshnessHandler(mockService)
+			router := setupFreshnessRouter()
+			router.GET("/freshness/review", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.ListReviewQueue(c)
+			})
+
+			req := httptest.NewRequest("GET", "/freshness/review"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type IngestAlertHandler struct {
+	svc service.IngestAlertService
+}
+
+func NewIngestAlertHandler(s service.IngestAlertService) *IngestAlertHandler {
+	return &IngestAlertHandler{svc: s}
+}
+
+// GetIngestAlerts godoc
+//
+//	@Summary		Get ingest alerts
+//	@Description	Get the ingest anomaly alerts of the project. Data is null when they are disabled.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.IngestAlertPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/ingest_alerts [get]
+func (h *IngestAlertHandler) GetIngestAlerts(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdateIngestAlertsReq struct {
+	// Policy replaces the ingest alerts of the project, null disables them
+	Policy *model.IngestAlertPolicy `json:"policy"`
+}
+
+// UpdateIngestAlerts godoc
+//
+//	@Summary		Update ingest alerts
+//	@Description	Replace the ingest anomaly alerts of the project. A background job compares the messages stored in the last window_minutes with the average of the baseline_windows before it, and notifies a spike above spike_factor times the baseline or a drop below drop_factor times it, at most once per kind and window. Alerts are listed by GET /project/notifications and posted to the notification webhook. A null policy disables them.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateIngestAlertsReq	true	"UpdateIngestAlerts payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.IngestAlertPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/ingest_alerts [put]
+func (h *IngestAlertHandler) UpdateIngestAlerts(c *gin.Context) {
+	req := UpdateIngestAlertsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Policy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidIngestAlertPolicy) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetIngestRate godoc
+//
+//	@Summary		Get ingest rate
+//	@Description	Get the messages stored in the project per window, the current window first, with the baseline the ingest alerts compare it to. Windows follow the ingest alerts of the project, or are hourly over the last day without them.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.IngestRate}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/ingest_rate [get]
+func (h *IngestAlertHandler) GetIngestRate(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Rate(c.Request.Context(), project, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type NetworkAccessHandler struct {
+	svc service.NetworkAccessService
+}
+
+func NewNetworkAccessHandler(s service.NetworkAccessService) *NetworkAccessHandler {
+	return &NetworkAccessHandler{svc: s}
+}
+
+// GetNetworkAccess godoc
+//
+//	@Summary		Get network access rules
+//	@Description	Get the client IP rules of the project. Data is null when every IP may use the project key.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.NetworkAccessPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Router			/project/network_access [get]
+func (h *NetworkAccessHandler) GetNetworkAccess(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdateNetworkAccessReq struct {
+	// Policy replaces the network access rules of the project, null allows every IP
+	Policy *model.NetworkAccessPolicy `json:"policy"`
+}
+
+// UpdateNetworkAccess godoc
+//
+//	@Summary		Update network access rules
+//	@Description	Replace the client IP rules of the project. Requests from an IP matching a deny CIDR are refused with 403, then requests from an IP matching an allow CIDR are accepted, and the remaining IPs are accepted unless default_deny is set. Rules that would refuse the IP of this request are rejected with 400. A null policy allows every IP.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateNetworkAccessReq	true	"UpdateNetworkAccess payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.NetworkAccessPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/network_access [put]
+func (h *NetworkAccessHandler) UpdateNetworkAccess(c *gin.Context) {
+	req := UpdateNetworkAccessReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Policy, net.ParseIP(c.ClientIP()))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidNetworkAccessPolicy) || errors.Is(err, service.ErrNetworkAccessLocksOutCaller) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type NotificationHandler struct {
+	svc service.NotificationService
+}
+
+func NewNotificationHandler(s service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{svc: s}
+}
+
+type ListNotificationsReq struct {
+	Kind     string `form:"kind" json:"kind" binding:"omitempty,oneof=ingest_spike ingest_drop" example:"ingest_spike" enums:"ingest_spike,ingest_drop"`
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=true" json:"time_desc" example:"true"`
+}
+
+// ListNotifications godoc
+//
+//	@Summary		List notifications
+//	@Description	List the notifications of the project, e.g. ingest anomaly alerts, with the outcome of their webhook delivery.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			kind		query	string	false	"Filter by kind"	enums(ingest_spike,ingest_drop)
+//	@Param			limit		query	integer	false	"Limit of notifications to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	string	false	"Order by creation time descending if true (default), ascending if false"	example:"true"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListNotificationsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/notifications [get]
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	req := ListNotificationsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.List(c.Request.Context(), service.ListNotificationsInput{
+		ProjectID: project.ID,
+		Kind:      req.Kind,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type NotificationWebhookResp struct {
+	URL string `json:"url"`
+}
+
+// GetNotificationWebhook godoc
+//
+//	@Summary		Get notification webhook
+//	@Description	Get the URL the notifications of the project are posted to. An empty url means notifications are only listed.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.NotificationWebhookResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/notification_webhook [get]
+func (h *NotificationHandler) GetNotificationWebhook(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: NotificationWebhookResp{URL: h.svc.GetWebhook(c.Request.Context(), project)}})
+}
+
+type UpdateNotificationWebhookReq struct {
+	// URL receives every new notification as a JSON POST, empty removes the webhook
+	URL string `json:"url" binding:"max=2048" example:"https://hooks.example.com/acontext"`
+}
+
+// UpdateNotificationWebhook godoc
+//
+//	@Summary		Update notification webhook
+//	@Description	Replace the URL the notifications of the project are posted to. Each notification is posted once as JSON; a failed delivery is recorded in its delivery_error. An empty url removes the webhook.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateNotificationWebhookReq	true	"UpdateNotificationWebhook payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.NotificationWebhookResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/notification_webhook [put]
+func (h *NotificationHandler) UpdateNotificationWebhook(c *gin.Context) {
+	req := UpdateNotificationWebhookReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	url, err := h.svc.UpdateWebhook(c.Request.Context(), project, req.URL)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidNotificationWebhook) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: NotificationWebhookResp{URL: url}})
+}
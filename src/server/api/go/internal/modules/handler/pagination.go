@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPaginationLinks sets an RFC 8288 (formerly RFC 5988) Link header on a cursor-paginated response,
+// so generic HTTP clients can follow the pages without reading next_cursor from the body.
+// The links keep the other query parameters of the request and only replace the cursor.
+// Cursors only move forward, so "prev" is only given when the client sent prev_cursor, which the
+// "next" link carries along; "first" always points to the first page.
+func setPaginationLinks(c *gin.Context, nextCursor string) {
+	query := c.Request.URL.Query()
+	current := query.Get("cursor")
+	prev, hasPrev := query.Get("prev_cursor"), query.Has("prev_cursor")
+
+	links := []string{}
+	if nextCursor != "" {
+		links = append(links, paginationLink(c, query, nextCursor, current, true, "next"))
+	}
+	if current != "" && hasPrev {
+		// The page before the previous one is unknown, so following prev restarts the chain
+		links = append(links, paginationLink(c, query, prev, "", false, "prev"))
+	}
+	links = append(links, paginationLink(c, query, "", "", false, "first"))
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+func paginationLink(c *gin.Context, query url.Values, cursor string, prevCursor string, withPrev bool, rel string) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Del("cursor")
+	q.Del("prev_cursor")
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	if withPrev {
+		q.Set("prev_cursor", prevCursor)
+	}
+
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: q.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
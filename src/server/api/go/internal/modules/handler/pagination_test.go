@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPaginationLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		target     string
+		nextCursor string
+		expected   string
+	}{
+		{
+			name:       "first page",
+			target:     "/api/v1/session?limit=20",
+			nextCursor: "abc",
+			expected:   `</api/v1/session?cursor=abc&limit=20&prev_cursor=>; rel="next", </api/v1/session?limit=20>; rel="first"`,
+		},
+		{
+			name:       "second page links back to the first",
+			target:     "/api/v1/session?limit=20&cursor=abc&prev_cursor=",
+			nextCursor: "def",
+			expected:   `</api/v1/session?cursor=def&limit=20&prev_cursor=abc>; rel="next", </api/v1/session?limit=20>; rel="prev", </api/v1/session?limit=20>; rel="first"`,
+		},
+		{
+			name:     "last page",
+			target:   "/api/v1/session?limit=20&cursor=def&prev_cursor=abc",
+			expected: `</api/v1/session?cursor=abc&limit=20>; rel="prev", </api/v1/session?limit=20>; rel="first"`,
+		},
+		{
+			name:     "cursor without known previous page",
+			target:   "/api/v1/session?cursor=def",
+			expected: `</api/v1/session>; rel="first"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+
+			setPaginationLinks(c, tt.nextCursor)
+
+			assert.Equal(t, tt.expected, w.Header().Get("Link"))
+		})
+	}
+}
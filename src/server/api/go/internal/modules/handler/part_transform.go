@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type PartTransformHandler struct {
+	svc service.PartTransformService
+}
+
+func NewPartTransformHandler(s service.PartTransformService) *PartTransformHandler {
+	return &PartTransformHandler{svc: s}
+}
+
+// GetPartTransforms godoc
+//
+//	@Summary		Get part transforms
+//	@Description	Get the pipeline of transforms applied in order to the parts of new messages of the project. Projects use the server pipeline until they replace it.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.PartTransformConfig}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/part_transforms [get]
+func (h *PartTransformHandler) GetPartTransforms(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.GetPipeline(c.Request.Context(), project)})
+}
+
+type UpdatePartTransformsReq struct {
+	// Transforms replaces the pipeline of the project, null restores the server pipeline
+	Transforms []model.PartTransformConfig `json:"transforms"`
+}
+
+// UpdatePartTransforms godoc
+//
+//	@Summary		Update part transforms
+//	@Description	Replace the part transform pipeline of the project. Available transforms are normalize_whitespace, strip_base64_images and truncate_tool_output. An empty list disables all transforms, null restores the server pipeline.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdatePartTransformsReq	true	"UpdatePartTransforms payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.PartTransformConfig}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/part_transforms [put]
+func (h *PartTransformHandler) UpdatePartTransforms(c *gin.Context) {
+	req := UpdatePartTransformsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.UpdatePipeline(c.Request.Context(), project, req.Transforms)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownPartTransform) || errors.Is(err, service.ErrInvalidPartTransform) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type PresignPolicyHandler struct {
+	svc service.PresignPolicyService
+}
+
+func NewPresignPolicyHandler(s service.PresignPolicyService) *PresignPolicyHandler {
+	return &PresignPolicyHandler{svc: s}
+}
+
+// GetPresignPolicy godoc
+//
+//	@Summary		Get presign policy
+//	@Description	Get the policy bounding the expiry of the presigned URLs of the project. Data is null when the server defaults apply.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.PresignPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/presign_policy [get]
+func (h *PresignPolicyHandler) GetPresignPolicy(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdatePresignPolicyReq struct {
+	// Policy replaces the presign policy of the project, null restores the server defaults
+	Policy *model.PresignPolicy `json:"policy"`
+}
+
+// UpdatePresignPolicy godoc
+//
+//	@Summary		Update presign policy
+//	@Description	Set the expiry of the presigned URLs of assets and artifacts of the project. default_expire_sec applies when a request does not pass expire, and to the asset URLs of messages; without it each endpoint keeps its default, 3600 seconds for assets and artifacts and 24 hours for messages. Requests asking for an expire above max_expire_sec are refused with 400. The server never presigns for more than 7 days (604800 seconds). A null policy restores the server defaults.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdatePresignPolicyReq	true	"UpdatePresignPolicy payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.PresignPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/presign_policy [put]
+func (h *PresignPolicyHandler) UpdatePresignPolicy(c *gin.Context) {
+	req := UpdatePresignPolicyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Policy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPresignPolicy) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type ProjectKeyHandler struct {
+	svc service.ProjectKeyService
+}
+
+func NewProjectKeyHandler(s service.ProjectKeyService) *ProjectKeyHandler {
+	return &ProjectKeyHandler{svc: s}
+}
+
+// GetProjectKey godoc
+//
+//	@Summary		Get project key rotation
+//	@Description	Get whether a key rotation of the project is in progress, and until when the previous key is accepted.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ProjectKeyState}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/key [get]
+func (h *ProjectKeyHandler) GetProjectKey(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.State(c.Request.Context(), project)})
+}
+
+type RotateProjectKeyReq struct {
+	// GracePeriodSec is how long the current key stays valid, 1 day by default and at most 30 days
+	GracePeriodSec int `json:"grace_period_sec" binding:"omitempty,min=1,max=2592000" example:"86400"`
+}
+
+// RotateProjectKey godoc
+//
+//	@Summary		Rotate project key
+//	@Description	Issue a new bearer token for the project. The current token stays valid for grace_period_sec, so agents can switch to the new one without downtime; requests made with it carry the X-Acontext-Key-Expires-At header. Finalize the rotation to revoke the previous token early. A rotation is refused with 409 while the previous token of an earlier rotation is still valid, and with 403 when the server has no secret pepper configured. The new token is only returned once.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.RotateProjectKeyReq	false	"RotateProjectKey payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.RotatedProjectKey}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/key/rotate [post]
+func (h *ProjectKeyHandler) RotateProjectKey(c *gin.Context) {
+	req := RotateProjectKeyReq{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Rotate(c.Request.Context(), project, time.Duration(req.GracePeriodSec)*time.Second)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidGracePeriod):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		case errors.Is(err, service.ErrKeyRotationPending):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+		case errors.Is(err, service.ErrKeyRotationDisabled):
+			c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
+
+// FinalizeProjectKeyRotation godoc
+//
+//	@Summary		Finalize project key rotation
+//	@Description	Revoke the previous token of the last key rotation, only the new token is accepted afterwards.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/key/finalize [post]
+func (h *ProjectKeyHandler) FinalizeProjectKeyRotation(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := h.svc.Finalize(c.Request.Context(), project); err != nil {
+		if errors.Is(err, service.ErrNoKeyRotation) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockProjectKeyService struct {
+	mock.Mock
+}
+
+func (m *MockProjectKeyService) State(ctx context.Context, project *model.Project) *service.ProjectKeyState {
+	args := m.Called(ctx, project)
+	return args.Get(0).(*service.ProjectKeyState)
+}
+
+func (m *MockProjectKeyService) Rotate(ctx context.Context, project *model.Project, grace time.Duration) (*service.RotatedProjectKey, error) {
+	args := m.Called(ctx, project, grace)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.RotatedProjectKey), args.Error(1)
+}
+
+func (m *MockProjectKeyService) Finalize(ctx context.Context, project *model.Project) error {
+	args := m.Called(ctx, project)
+	return args.Error(0)
+}
+
+func setupProjectKeyRouter(h *ProjectKeyHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: uuid.New()})
+	})
+	r.GET("/project/key", h.GetProjectKey)
+	r.POST("/project/key/rotate", h.RotateProjectKey)
+	r.POST("/project/key/finalize", h.FinalizeProjectKeyRotation)
+	return r
+}
+
+func TestProjectKeyHandler_RotateProjectKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(*MockProjectKeyService)
+		wantStatus int
+	}{
+		{
+			name: "default grace period",
+			setup: func(svc *MockProjectKeyService) {
+				svc.On("Rotate", mock.Anything, mock.Anything, time.Duration(0)).Return(&service.RotatedProjectKey{Token: "sk-ac-new"}, nil)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "grace period",
+			body: `{"grace_period_sec": 3600}`,
+			setup: func(svc *MockProjectKeyService) {
+				svc.On("Rotate", mock.Anything, mock.Anything, time.Hour).Return(&service.RotatedProjectKey{Token: "sk-ac-new"}, nil)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "grace period too long",
+			body:       `{"grace_period_sec": 99999999}`,
+			setup:      func(svc *MockProjectKeyService) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "rotation pending",
+			setup: func(svc *MockProjectKeyService) {
+				svc.On("Rotate", mock.Anything, mock.Anything, mock.Anything).Return(nil, service.ErrKeyRotationPending)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "rotation disabled",
+			setup: func(svc *MockProjectKeyService) {
+				svc.On("Rotate", mock.Anything, mock.Anything, mock.Anything).Return(nil, service.ErrKeyRotationDisabled)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockProjectKeyService{}
+			tt.setup(svc)
+			router := setupProjectKeyRouter(NewProjectKeyHandler(svc))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/project/key/rotate", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProjectKeyHandler_FinalizeProjectKeyRotation(t *testing.T) {
+	svc := &MockProjectKeyService{}
+	svc.On("Finalize", mock.Anything, mock.Anything).Return(nil).Once()
+	svc.On("Finalize", mock.Anything, mock.Anything).Return(service.ErrNoKeyRotation).Once()
+	router := setupProjectKeyRouter(NewProjectKeyHandler(svc))
+
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/project/key/finalize", nil))
+		assert.Equal(t, want, w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type QuotaHandler struct {
+	svc service.QuotaService
+}
+
+func NewQuotaHandler(s service.QuotaService) *QuotaHandler {
+	return &QuotaHandler{svc: s}
+}
+
+// GetQuota godoc
+//
+//	@Summary		Get quota
+//	@Description	Get the usage of the project against its quotas: the messages stored today (UTC) and the bytes of message and artifact assets. A limit of 0 means the quota is disabled. Requests over a quota fail with error_code quota_exceeded and the quota details in data: 429 with Retry-After for messages, 402 for storage.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.QuotaState}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/quota [get]
+func (h *QuotaHandler) GetQuota(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.State(c.Request.Context(), project, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// EnforceMessages refuses requests storing messages once the project stored its messages of the day
+func (h *QuotaHandler) EnforceMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := c.MustGet("project").(*model.Project)
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := h.svc.CheckMessages(c.Request.Context(), project, time.Now(), 1); err != nil {
+			abortQuotaErr(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// EnforceStorage refuses uploads when the project is out of storage or the request body would not fit
+func (h *QuotaHandler) EnforceStorage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := c.MustGet("project").(*model.Project)
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := h.svc.CheckStorage(c.Request.Context(), project, c.Request.ContentLength); err != nil {
+			abortQuotaErr(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortQuotaErr responds to a failed quota check, a quota that cannot be checked fails the request
+func abortQuotaErr(c *gin.Context, err error) {
+	var exceeded *service.QuotaExceededError
+	if !errors.As(err, &exceeded) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	status := http.StatusPaymentRequired
+	if exceeded.RetryAfterSec != nil {
+		status = http.StatusTooManyRequests
+		c.Header("Retry-After", strconv.FormatInt(*exceeded.RetryAfterSec, 10))
+	}
+	res := serializer.Err(status, exceeded.Error(), nil)
+	res.ErrorCode = serializer.CodeQuotaExceeded
+	res.Data = exceeded
+	c.AbortWithStatusJSON(status, res)
+}
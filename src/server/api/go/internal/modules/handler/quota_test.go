@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQuotaService struct {
+	mock.Mock
+}
+
+func (m *MockQuotaService) State(ctx context.Context, project *model.Project, now time.Time) (*service.QuotaState, error) {
+	args := m.Called(ctx, project, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.QuotaState), args.Error(1)
+}
+
+func (m *MockQuotaService) CheckMessages(ctx context.Context, project *model.Project, now time.Time, adding int64) error {
+	args := m.Called(ctx, project, now, adding)
+	return args.Error(0)
+}
+
+func (m *MockQuotaService) CheckStorage(ctx context.Context, project *model.Project, incomingBytes int64) error {
+	args := m.Called(ctx, project, incomingBytes)
+	return args.Error(0)
+}
+
+func setupQuotaRouter(h *QuotaHandler, projectID uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+	})
+	r.GET("/project/quota", h.GetQuota)
+	r.POST("/messages", h.EnforceMessages(), h.EnforceStorage(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, serializer.Response{})
+	})
+	return r
+}
+
+func TestQuotaHandler_GetQuota(t *testing.T) {
+	svc := &MockQuotaService{}
+	svc.On("State", mock.Anything, mock.Anything, mock.Anything).Return(&service.QuotaState{
+		Messages: service.QuotaUsage{Limit: 100, Used: 3},
+	}, nil)
+	router := setupQuotaRouter(NewQuotaHandler(svc), uuid.New())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/project/quota", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"used":3`)
+	svc.AssertExpectations(t)
+}
+
+func TestQuotaHandler_Enforce(t *testing.T) {
+	retryAfter := int64(120)
+	reset := time.Now().Add(2 * time.Minute)
+
+	tests := []struct {
+		name           string
+		setup          func(*MockQuotaService)
+		expectedStatus int
+		retryAfter     string
+	}{
+		{
+			name: "within quotas",
+			setup: func(svc *MockQuotaService) {
+				svc.On("CheckMessages", mock.Anything, mock.Anything, mock.Anything, int64(1)).Return(nil)
+				svc.On("CheckStorage", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "daily messages exceeded",
+			setup: func(svc *MockQuotaService) {
+				svc.On("CheckMessages", mock.Anything, mock.Anything, mock.Anything, int64(1)).Return(&service.QuotaExceededError{
+					Quota: service.QuotaMessages, Limit: 10, Used: 10, ResetAt: &reset, RetryAfterSec: &retryAfter,
+				})
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			retryAfter:     "120",
+		},
+		{
+			name: "storage exceeded",
+			setup: func(svc *MockQuotaService) {
+				svc.On("CheckMessages", mock.Anything, mock.Anything, mock.Anything, int64(1)).Return(nil)
+				svc.On("CheckStorage", mock.Anything, mock.Anything, mock.Anything).Return(&service.QuotaExceededError{
+					Quota: service.QuotaStorage, Limit: 100, Used: 100,
+				})
+			},
+			expectedStatus: http.StatusPaymentRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockQuotaService{}
+			tt.setup(svc)
+			router := setupQuotaRouter(NewQuotaHandler(svc), uuid.New())
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/messages", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.retryAfter, w.Header().Get("Retry-After"))
+			if w.Code >= 400 {
+				res := serializer.Response{}
+				assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &res))
+				assert.Equal(t, serializer.CodeQuotaExceeded, res.ErrorCode)
+			}
+			svc.AssertExpectations(t)
+		})
+	}
+}
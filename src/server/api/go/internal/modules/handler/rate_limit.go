@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type RateLimitHandler struct {
+	svc service.RateLimitService
+}
+
+func NewRateLimitHandler(s service.RateLimitService) *RateLimitHandler {
+	return &RateLimitHandler{svc: s}
+}
+
+// LimitMessageWrites refuses messages sent to a session faster than its rate limit with 429 and Retry-After
+func (h *RateLimitHandler) LimitMessageWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := c.MustGet("project").(*model.Project)
+		if !ok {
+			c.Next()
+			return
+		}
+		// an invalid session id is refused by the handler
+		sessionID, err := uuid.Parse(c.Param("session_id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		if retryAfter, allowed := h.svc.AllowMessageWrite(c.Request.Context(), project.ID, sessionID); !allowed {
+			c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, serializer.Err(http.StatusTooManyRequests, "too many messages sent to this session, slow down", nil))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRateLimitService struct {
+	mock.Mock
+}
+
+func (m *MockRateLimitService) AllowMessageWrite(ctx context.Context, projectID, sessionID uuid.UUID) (time.Duration, bool) {
+	args := m.Called(ctx, projectID, sessionID)
+	return args.Get(0).(time.Duration), args.Bool(1)
+}
+
+func setupRateLimitRouter(h *RateLimitHandler, projectID uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+	})
+	r.POST("/session/:session_id/messages", h.LimitMessageWrites(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, serializer.Response{})
+	})
+	return r
+}
+
+func TestRateLimitHandler_LimitMessageWrites(t *testing.T) {
+	projectID, sessionID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		retryAfter time.Duration
+		allowed    bool
+		wantStatus int
+		wantRetry  string
+	}{
+		{"allowed", sessionID.String(), 0, true, http.StatusCreated, ""},
+		{"limited", sessionID.String(), 2500 * time.Millisecond, false, http.StatusTooManyRequests, "3"},
+		{"limited for less than a second", sessionID.String(), 50 * time.Millisecond, false, http.StatusTooManyRequests, "1"},
+		{"invalid session id", "not-a-uuid", 0, false, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockRateLimitService{}
+			svc.On("AllowMessageWrite", mock.Anything, projectID, sessionID).Return(tt.retryAfter, tt.allowed)
+			router := setupRateLimitRouter(NewRateLimitHandler(svc), projectID)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/session/"+tt.sessionID+"/messages", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantRetry, w.Header().Get("Retry-After"))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type RedactionHandler struct {
+	svc service.RedactionService
+}
+
+func NewRedactionHandler(s service.RedactionService) *RedactionHandler {
+	return &RedactionHandler{svc: s}
+}
+
+// GetRedaction godoc
+//
+//	@Summary		Get redaction policy
+//	@Description	Get the PII redaction policy of the project. Data is null when new messages are stored as sent.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.RedactionPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/redaction [get]
+func (h *RedactionHandler) GetRedaction(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdateRedactionReq struct {
+	// Policy replaces the redaction policy of the project, null stops redacting new messages
+	Policy *model.RedactionPolicy `json:"policy"`
+}
+
+// UpdateRedaction godoc
+//
+//	@Summary		Update redaction policy
+//	@Description	Replace the PII redaction policy of the project. When enabled, emails, API keys and phone numbers (or the kinds listed) and the matches of custom patterns are masked as [REDACTED:<kind>] in the text parts of new messages before they are stored, and the meta of the message gets a redaction report with the count of matches by kind. The ner detector also asks the named entity recognition service of the server and is only available when the server configures one. A null policy stops redacting.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateRedactionReq	true	"UpdateRedaction payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.RedactionPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/redaction [put]
+func (h *RedactionHandler) UpdateRedaction(c *gin.Context) {
+	req := UpdateRedactionReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Policy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRedactionPolicy) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type RetentionHandler struct {
+	svc service.RetentionService
+}
+
+func NewRetentionHandler(s service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{svc: s}
+}
+
+// GetRetention godoc
+//
+//	@Summary		Get retention policy
+//	@Description	Get the session retention policy of the project. Data is null when sessions are kept forever.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.RetentionPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/retention [get]
+func (h *RetentionHandler) GetRetention(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdateRetentionReq struct {
+	// Policy replaces the retention policy of the project, null keeps sessions forever
+	Policy *model.RetentionPolicy `json:"policy"`
+}
+
+// UpdateRetention godoc
+//
+//	@Summary		Update retention policy
+//	@Description	Replace the session retention policy of the project. A background job archives or deletes the sessions without new messages or updates for idle_days; deleting a session releases its message assets. A null policy keeps sessions forever.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateRetentionReq	true	"UpdateRetention payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.RetentionPolicy}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/retention [put]
+func (h *RetentionHandler) UpdateRetention(c *gin.Context) {
+	req := UpdateRetentionReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Policy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRetentionPolicy) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -1,22 +1,31 @@
 package handler
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/converter"
 	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+	"github.com/memodb-io/Acontext/internal/pkg/timing"
 	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
 	"gorm.io/datatypes"
 )
@@ -24,18 +33,46 @@ import (
 type SessionHandler struct {
 	svc        service.SessionService
 	coreClient *httpclient.CoreClient
+	upload     config.UploadCfg
+	postIngest service.PostIngestService
+	// tasks tracks exports and bulk deletes as tasks of the project, nil disables it
+	tasks service.TaskService
+	// quota checks turns against the project quotas once their size is known, nil disables it
+	quota service.QuotaService
+	// limits checks turns against the messages limits of the session, nil disables it
+	limits service.EntityLimitService
 }
 
-func NewSessionHandler(s service.SessionService, coreClient *httpclient.CoreClient) *SessionHandler {
+func NewSessionHandler(s service.SessionService, coreClient *httpclient.CoreClient, upload config.UploadCfg, postIngest service.PostIngestService, tasks service.TaskService, quota service.QuotaService, limits service.EntityLimitService) *SessionHandler {
 	return &SessionHandler{
 		svc:        s,
 		coreClient: coreClient,
+		upload:     upload,
+		postIngest: postIngest,
+		tasks:      tasks,
+		quota:      quota,
+		limits:     limits,
+	}
+}
+
+// startJob starts tracking a long-running job as a task of the project, the returned func finishes it
+func (h *SessionHandler) startJob(c *gin.Context, projectID uuid.UUID, kind string, data map[string]interface{}) (*model.Task, func(err error, data map[string]interface{})) {
+	if h.tasks == nil {
+		return nil, func(error, map[string]interface{}) {}
+	}
+	task := h.tasks.StartJob(c.Request.Context(), projectID, kind, data)
+	return task, func(err error, data map[string]interface{}) {
+		h.tasks.FinishJob(c.Request.Context(), task, err, data)
 	}
 }
 
 type CreateSessionReq struct {
-	SpaceID string                 `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
-	Configs map[string]interface{} `form:"configs" json:"configs"`
+	SpaceID     string                 `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
+	Configs     map[string]interface{} `form:"configs" json:"configs"`
+	Title       string                 `form:"title" json:"title" binding:"max=255" example:"Refund request"`
+	Description string                 `form:"description" json:"description" binding:"max=2000"`
+	Tags        []string               `form:"tags" json:"tags" binding:"max=32,dive,max=64" example:"support,billing"`
+	EndUserID   string                 `form:"end_user_id" json:"end_user_id" binding:"max=255" example:"user_123"`
 }
 
 type GetSessionsReq struct {
@@ -44,12 +81,46 @@ type GetSessionsReq struct {
 	Limit        int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
 	Cursor       string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
 	TimeDesc     bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	Tag          string `form:"tag" json:"tag" example:"support"`
+	Q            string `form:"q" json:"q" binding:"max=255" example:"refund"`
+	EndUserID    string `form:"end_user_id" json:"end_user_id" binding:"max=255" example:"user_123"`
+
+	IncludeArchived bool `form:"include_archived,default=false" json:"include_archived" example:"false"`
+}
+
+// maxConfigFilters bounds the configs.<key> filters of a session list
+const maxConfigFilters = 8
+
+// parseConfigFilters reads the configs.<key>=<value> query parameters of a session list, a key may be a dotted path
+// into nested configs
+func parseConfigFilters(query url.Values) (map[string]string, error) {
+	var filters map[string]string
+	for key, values := range query {
+		path, ok := strings.CutPrefix(key, "configs.")
+		if !ok {
+			continue
+		}
+		if slices.Contains(strings.Split(path, "."), "") {
+			return nil, fmt.Errorf("invalid config filter %s", key)
+		}
+		if len(values) > 1 {
+			return nil, fmt.Errorf("config filter %s is given more than once", key)
+		}
+		if filters == nil {
+			filters = map[string]string{}
+		}
+		filters[path] = values[0]
+	}
+	if len(filters) > maxConfigFilters {
+		return nil, fmt.Errorf("at most %d config filters are allowed", maxConfigFilters)
+	}
+	return filters, nil
 }
 
 // GetSessions godoc
 //
 //	@Summary		Get sessions
-//	@Description	Get all sessions under a project, optionally filtered by space_id
+//	@Description	Get all sessions under a project, optionally filtered by space_id, tag, title, end_user_id or configs. Archived sessions are excluded unless include_archived is true. configs.<key>=<value> keeps the sessions whose config key has the value, e.g. configs.model=gpt-4o; the key may be a dotted path into nested configs, e.g. configs.flags.beta=true, and a value reading as a number, boolean or null also matches its string form. Up to 8 config filters are combined with AND and use the index on configs.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
@@ -58,8 +129,15 @@ type GetSessionsReq struct {
 //	@Param			limit			query	integer	false	"Limit of sessions to return, default 20. Max 200."
 //	@Param			cursor			query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
 //	@Param			time_desc		query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example:"false"
+//	@Param			tag				query	string	false	"Only sessions with this tag"
+//	@Param			q				query	string	false	"Only sessions whose title contains this text, case-insensitive"
+//	@Param			configs.{key}	query	string	false	"Only sessions whose config key, or dotted path, has this value"
+//	@Param			include_archived	query	boolean	false	"Include archived sessions (default false)"	example(false)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.ListSessionsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List sessions\nsessions = client.sessions.list(\n    space_id='space-uuid',\n    limit=20,\n    time_desc=True\n)\nfor session in sessions.items:\n    print(f\"{session.id}: {session.space_id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List sessions\nconst sessions = await client.sessions.list({\n  spaceId: 'space-uuid',\n  limit: 20,\n  timeDesc: true\n});\nfor (const session of sessions.items) {\n  console.log(`${session.id}: ${session.space_id}`);\n}\n","label":"JavaScript"}]
 func (h *SessionHandler) GetSessions(c *gin.Context) {
@@ -86,32 +164,48 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 		spaceID = &parsed
 	}
 
+	configFilters, err := parseConfigFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	out, err := h.svc.List(c.Request.Context(), service.ListSessionsInput{
 		ProjectID:    project.ID,
 		SpaceID:      spaceID,
 		NotConnected: req.NotConnected,
 		Limit:        req.Limit,
+		Tag:          req.Tag,
+		Query:        req.Q,
+		EndUserID:    req.EndUserID,
+		Configs:      configFilters,
 		Cursor:       req.Cursor,
 		TimeDesc:     req.TimeDesc,
+
+		IncludeArchived: req.IncludeArchived,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
+	setPaginationLinks(c, out.NextCursor)
 	c.JSON(http.StatusOK, serializer.Response{Data: out})
 }
 
 // CreateSession godoc
 //
 //	@Summary		Create session
-//	@Description	Create a new session under a space
+//	@Description	Create a new session under a space. Without a title, the session is named after its first user message. end_user_id records the user of your product the conversation belongs to, so their sessions can be listed with GET /session?end_user_id=. configs.dedupe_window refuses with 409 a message repeating the role and content of the message it follows within that many seconds. When the project registers a session config schema (PUT /project/session_config_schema), configs that do not match it are refused with 400.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body	handler.CreateSessionReq	true	"CreateSession payload"
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Create a session\nsession = client.sessions.create(\n    space_id='space-uuid',\n    configs={\"mode\": \"chat\"}\n)\nprint(f\"Created session: {session.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Create a session\nconst session = await client.sessions.create({\n  spaceId: 'space-uuid',\n  configs: { mode: 'chat' }\n});\nconsole.log(`Created session: ${session.id}`);\n","label":"JavaScript"}]
 func (h *SessionHandler) CreateSession(c *gin.Context) {
@@ -127,9 +221,18 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
+	if err := validateSessionConfigs(project, req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	session := model.Session{
-		ProjectID: project.ID,
-		Configs:   datatypes.JSONMap(req.Configs),
+		ProjectID:   project.ID,
+		Configs:     datatypes.JSONMap(req.Configs),
+		Title:       strings.TrimSpace(req.Title),
+		Description: req.Description,
+		Tags:        req.Tags,
+		EndUserID:   strings.TrimSpace(req.EndUserID),
 	}
 	if len(req.SpaceID) != 0 {
 		spaceID, err := uuid.Parse(req.SpaceID)
@@ -157,6 +260,9 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 //	@Param			session_id	path	string	true	"Session ID"	format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id} [delete]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete a session\nclient.sessions.delete(session_id='session-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete a session\nawait client.sessions.delete('session-uuid');\n","label":"JavaScript"}]
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
@@ -180,14 +286,131 @@ func (h *SessionHandler) DeleteSession(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
+type BulkDeleteSessionsReq struct {
+	SessionIDs []uuid.UUID `json:"session_ids" binding:"max=1000"`
+	// SpaceID deletes all sessions of the space, instead of session_ids
+	SpaceID string `json:"space_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// Stream writes the progress after each batch as newline-delimited JSON, the last line is the result
+	Stream bool `json:"stream" example:"false"`
+}
+
+// BulkDeleteSessions godoc
+//
+//	@Summary		Bulk delete sessions
+//	@Description	Delete up to 1000 sessions by id, or all sessions of a space with space_id. Sessions are deleted in batches of 50, each batch in one transaction that also releases the assets of its messages; a failed batch is listed in failed and the next batches are still deleted. IDs that are not sessions of the project are listed in not_found. With stream=true the response is newline-delimited JSON with the progress after each batch, the last line being the result. The deletion is tracked as a bulk_delete task of the project, see GET /project/tasks.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.BulkDeleteSessionsReq	true	"BulkDeleteSessions payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.BulkDeleteSessionsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/bulk_delete [post]
+func (h *SessionHandler) BulkDeleteSessions(c *gin.Context) {
+	req := BulkDeleteSessionsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if (len(req.SessionIDs) == 0) == (req.SpaceID == "") {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("exactly one of session_ids and space_id is required")))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	in := service.BulkDeleteSessionsInput{ProjectID: project.ID, SessionIDs: req.SessionIDs}
+	jobData := map[string]interface{}{"sessions": len(req.SessionIDs)}
+	if req.SpaceID != "" {
+		spaceID := uuid.MustParse(req.SpaceID)
+		in.SpaceID = &spaceID
+		jobData = map[string]interface{}{"space_id": spaceID}
+	}
+	task, finish := h.startJob(c, project.ID, model.TaskKindBulkDelete, jobData)
+	progress := func(p service.BulkDeleteSessionsOutput) {
+		if h.tasks != nil {
+			h.tasks.UpdateJob(c.Request.Context(), task, model.TaskStatusRunning, bulkDeleteJobData(&p))
+		}
+	}
+
+	if !req.Stream {
+		if h.tasks != nil {
+			in.OnProgress = progress
+		}
+		out, err := h.svc.BulkDelete(c.Request.Context(), in)
+		finish(bulkDeleteJobErr(out, err), bulkDeleteJobData(out))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		c.JSON(http.StatusOK, serializer.Response{Data: out})
+		return
+	}
+
+	// The status is sent with the first line, later errors end the stream with an error line
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := sonic.ConfigDefault.NewEncoder(c.Writer)
+	in.OnProgress = func(p service.BulkDeleteSessionsOutput) {
+		_ = enc.Encode(serializer.Response{Data: p})
+		c.Writer.Flush()
+		progress(p)
+	}
+	out, err := h.svc.BulkDelete(c.Request.Context(), in)
+	finish(bulkDeleteJobErr(out, err), bulkDeleteJobData(out))
+	if err != nil {
+		_ = enc.Encode(serializer.DBErr("", err))
+		return
+	}
+	_ = enc.Encode(serializer.Response{Data: out})
+}
+
+// bulkDeleteJobData is the progress of a bulk delete kept in the data of its task
+func bulkDeleteJobData(p *service.BulkDeleteSessionsOutput) map[string]interface{} {
+	if p == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"total":     p.Total,
+		"deleted":   p.Deleted,
+		"batches":   p.Batches,
+		"not_found": len(p.NotFound),
+		"failed":    len(p.Failed),
+	}
+}
+
+// bulkDeleteJobErr is the error failing the task of a bulk delete, a failed batch fails it too
+func bulkDeleteJobErr(out *service.BulkDeleteSessionsOutput, err error) error {
+	if err == nil && out != nil && out.Error != "" {
+		return errors.New(out.Error)
+	}
+	return err
+}
+
 type UpdateSessionConfigsReq struct {
 	Configs map[string]interface{} `form:"configs" json:"configs"`
 }
 
+// validateSessionConfigs checks the session configs the server reads, then the configs against the schema of the project
+func validateSessionConfigs(project *model.Project, configs map[string]interface{}) error {
+	if v, ok := configs[model.SessionDedupeWindowConfigKey]; ok {
+		if n, isNum := v.(float64); !isNum || n < 0 || n != float64(int64(n)) {
+			return fmt.Errorf("%s must be a whole number of seconds", model.SessionDedupeWindowConfigKey)
+		}
+	}
+	return service.ValidateSessionConfigs(project, configs)
+}
+
 // UpdateSessionConfigs godoc
 //
 //	@Summary		Update session configs
-//	@Description	Update session configs by id
+//	@Description	Update session configs by id. The server reads dedupe_window: seconds within which a message repeating the role and content of the message it follows is refused with 409, 0 or missing disables the check. When the project registers a session config schema (PUT /project/session_config_schema), configs that do not match it are refused with 400.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
@@ -195,6 +418,9 @@ type UpdateSessionConfigsReq struct {
 //	@Param			payload		body	handler.UpdateSessionConfigsReq	true	"UpdateSessionConfigs payload"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/configs [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update session configs\nclient.sessions.update_configs(\n    session_id='session-uuid',\n    configs={\"mode\": \"updated-mode\"}\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update session configs\nawait client.sessions.updateConfigs('session-uuid', {\n  configs: { mode: 'updated-mode' }\n});\n","label":"JavaScript"}]
 func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
@@ -204,6 +430,17 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 		return
 	}
 
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := validateSessionConfigs(project, req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	sessionID, err := uuid.Parse(c.Param("session_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
@@ -220,6 +457,130 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
+type UpdateSessionMetadataReq struct {
+	Title       *string   `json:"title" binding:"omitempty,max=255" example:"Refund request"`
+	Description *string   `json:"description" binding:"omitempty,max=2000"`
+	Tags        *[]string `json:"tags" binding:"omitempty,max=32,dive,max=64" example:"support,billing"`
+}
+
+// UpdateSessionMetadata godoc
+//
+//	@Summary		Update session metadata
+//	@Description	Update the title, description and tags of a session. Omitted fields are kept, and tags replace the existing ones.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string								true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.UpdateSessionMetadataReq	true	"UpdateSessionMetadata payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/metadata [put]
+func (h *SessionHandler) UpdateMetadata(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := UpdateSessionMetadataReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	session, err := h.svc.UpdateMetadata(c.Request.Context(), service.UpdateSessionMetadataInput{
+		ProjectID:   project.ID,
+		SessionID:   sessionID,
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: session})
+}
+
+// ArchiveSession godoc
+//
+//	@Summary		Archive session
+//	@Description	Archive a session, it is hidden from the session list unless include_archived is true. Messages are kept and stay readable.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/archive [post]
+func (h *SessionHandler) ArchiveSession(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// UnarchiveSession godoc
+//
+//	@Summary		Unarchive session
+//	@Description	Restore an archived session to the session list
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/unarchive [post]
+func (h *SessionHandler) UnarchiveSession(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+func (h *SessionHandler) setArchived(c *gin.Context, archived bool) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	session, err := h.svc.SetArchived(c.Request.Context(), project.ID, sessionID, archived)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: session})
+}
+
 // GetSessionConfigs godoc
 //
 //	@Summary		Get session configs
@@ -230,6 +591,9 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 //	@Param			session_id	path	string	true	"Session ID"	format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/configs [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get session configs\nsession = client.sessions.get_configs(session_id='session-uuid')\nprint(session.configs)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get session configs\nconst session = await client.sessions.getConfigs('session-uuid');\nconsole.log(session.configs);\n","label":"JavaScript"}]
 func (h *SessionHandler) GetConfigs(c *gin.Context) {
@@ -262,6 +626,9 @@ type ConnectToSpaceReq struct {
 //	@Param			payload		body	handler.ConnectToSpaceReq	true	"ConnectToSpace payload"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/connect_to_space [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Connect session to space\nclient.sessions.connect_to_space(\n    session_id='session-uuid',\n    space_id='space-uuid'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Connect session to space\nawait client.sessions.connectToSpace('session-uuid', {\n  spaceId: 'space-uuid'\n});\n","label":"JavaScript"}]
 func (h *SessionHandler) ConnectToSpace(c *gin.Context) {
@@ -293,20 +660,132 @@ func (h *SessionHandler) ConnectToSpace(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
+type SendMessageQuery struct {
+	// Sync runs the post-ingest processors before responding
+	Sync bool `form:"sync" json:"sync" example:"false"`
+}
+
+// SendMessageResp is the response of SendMessage with sync=true, the message fields are inlined
+type SendMessageResp struct {
+	*model.Message
+	Processors []service.ProcessorResult `json:"processors"`
+}
+
 type SendMessageReq struct {
 	Blob   interface{} `form:"blob" json:"blob" binding:"required"`
-	Format string      `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic" example:"openai" enums:"acontext,openai,anthropic"`
+	Format string      `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+	// ParentID branches the message from an earlier message instead of the latest one
+	ParentID string `form:"parent_id" json:"parent_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// Usage is the token usage of the model call that produced the message, a JSON object in form requests
+	Usage *MessageUsageReq `form:"usage" json:"usage"`
+	// DeliverAt schedules the message, it is stored and published at that time (RFC 3339)
+	DeliverAt *time.Time `form:"-" json:"deliver_at" example:"2025-01-01T09:00:00Z"`
+}
+
+// ScheduledMessageResp is the response of SendMessage with deliver_at, the message is stored at deliver_at
+type ScheduledMessageResp struct {
+	*model.Message
+	DeliverAt time.Time `json:"deliver_at"`
+}
+
+// MessageUsageReq is token usage reported by the client, it is the same for every message format
+type MessageUsageReq struct {
+	PromptTokens     int    `json:"prompt_tokens" example:"1200"`
+	CompletionTokens int    `json:"completion_tokens" example:"350"`
+	Model            string `json:"model" example:"gpt-4.1"`
+}
+
+func (u *MessageUsageReq) toModel() (model.TokenUsage, error) {
+	if u == nil {
+		return model.TokenUsage{}, nil
+	}
+	if u.PromptTokens < 0 || u.CompletionTokens < 0 {
+		return model.TokenUsage{}, errors.New("token counts must not be negative")
+	}
+	return model.TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Model:            u.Model,
+	}, nil
+}
+
+// normalizedMessage is a message blob normalized to the acontext format
+type normalizedMessage struct {
+	role       string
+	parts      []service.PartIn
+	meta       map[string]interface{}
+	fileFields []string
+}
+
+// normalizeMessageBlob parses and validates a message blob of format, on error it also returns the response message
+func normalizeMessageBlob(format model.MessageFormat, blobJSON []byte) (*normalizedMessage, string, error) {
+	// Blob contains the complete message object, directly use official SDK validation
+	out := &normalizedMessage{}
+	var err error
+	switch format {
+	case model.FormatAcontext:
+		// Parse and validate using Acontext normalizer
+		norm := &normalizer.AcontextNormalizer{}
+		out.role, out.parts, out.meta, err = norm.NormalizeFromAcontextMessage(blobJSON)
+		if err != nil {
+			return nil, "failed to normalize Acontext message", err
+		}
+
+	case model.FormatOpenAI:
+		// Parse and validate using official OpenAI SDK
+		norm := &normalizer.OpenAINormalizer{}
+		out.role, out.parts, out.meta, err = norm.NormalizeFromOpenAIMessage(blobJSON)
+		if err != nil {
+			return nil, "failed to normalize OpenAI message", err
+		}
+
+	case model.FormatAnthropic:
+		// Parse and validate using official Anthropic SDK
+		norm := &normalizer.AnthropicNormalizer{}
+		out.role, out.parts, out.meta, err = norm.NormalizeFromAnthropicMessage(blobJSON)
+		if err != nil {
+			return nil, "failed to normalize Anthropic message", err
+		}
+
+	case model.FormatGemini:
+		// Parse and validate Gemini Content ({role, parts})
+		norm := &normalizer.GeminiNormalizer{}
+		out.role, out.parts, out.meta, err = norm.NormalizeFromGeminiMessage(blobJSON)
+		if err != nil {
+			return nil, "failed to normalize Gemini message", err
+		}
+
+	case model.FormatAISDK:
+		// Parse and validate Vercel AI SDK UIMessage ({id, role, parts})
+		norm := &normalizer.AISDKNormalizer{}
+		out.role, out.parts, out.meta, err = norm.NormalizeFromAISDKMessage(blobJSON)
+		if err != nil {
+			return nil, "failed to normalize AI SDK message", err
+		}
+
+	default:
+		return nil, "unsupported format", fmt.Errorf("format %s is not supported", format)
+	}
+
+	// Collect file fields from normalized parts
+	for _, p := range out.parts {
+		if p.FileField != "" {
+			out.fileFields = append(out.fileFields, p.FileField)
+		}
+	}
+	return out, "", nil
 }
 
 // SendMessage godoc
 //
 //	@Summary		Send message to session
-//	@Description	Supports JSON and multipart/form-data. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for acontext (internal), use {role, parts} format.
+//	@Description	Supports JSON and multipart/form-data. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for gemini, use Gemini Content format (with role and parts); for ai-sdk, use Vercel AI SDK UIMessage format (with role and parts); for acontext (internal), use {role, parts} format. The message is chained to the latest message of the session unless parent_id names an earlier message to branch from. The optional usage field records the prompt and completion tokens and the model of the call that produced the message, in multipart mode it is either part of the payload or its own usage form field, see GET /session/{session_id}/usage. With sync=true the post-ingest processors (space sync rules, and the session summary when an LLM is configured) run before the response and their results are returned in processors; they still run again asynchronously, which has no further effect. With deliver_at in the future, up to 90 days, the message is scheduled: files are uploaded now, and the message is stored, chained and published at deliver_at; the response is 202 with the id the message will have. deliver_at cannot be combined with sync=true. Messages sent to a session faster than the server rate limit are refused with 429 and Retry-After. With the dedupe_window session config, a message repeating the role and content of the message it follows within the window is refused with 409. A session holding as many messages as the server soft limit answers with an X-Acontext-Limit-Warning header, one at the hard limit refuses new messages with 422.
 //	@Tags			session
 //	@Accept			json
 //	@Accept			multipart/form-data
 //	@Produce		json
 //	@Param			session_id	path		string					true	"Session ID"	Format(uuid)
+//	@Param			query		query		handler.SendMessageQuery	false	"Processing options"
 //
 //	// Content-Type: application/json
 //	@Param			payload		body		handler.SendMessageReq	true	"SendMessage payload (Content-Type: application/json)"
@@ -315,10 +794,28 @@ type SendMessageReq struct {
 //	@Param			payload		formData	string					false	"SendMessage payload (Content-Type: multipart/form-data)"
 //	@Param			file		formData	file					false	"When uploading files, the field name must correspond to parts[*].file_field."
 //	@Security		BearerAuth
-//	@Success		201	{object}	serializer.Response{data=model.Message}
+//	@Success		201	{object}	serializer.Response{data=handler.SendMessageResp}
+//	@Success		202	{object}	serializer.Response{data=handler.ScheduledMessageResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		415	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		429	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Failure		503	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/messages [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\nfrom acontext.messages import build_acontext_message\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Send a message in Acontext format\nmessage = build_acontext_message(role='user', parts=['Hello!'])\nclient.sessions.send_message(\n    session_id='session-uuid',\n    blob=message,\n    format='acontext'\n)\n\n# Send a message in OpenAI format\nopenai_message = {'role': 'user', 'content': 'Hello from OpenAI format!'}\nclient.sessions.send_message(\n    session_id='session-uuid',\n    blob=openai_message,\n    format='openai'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient, MessagePart } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Send a message in Acontext format\nawait client.sessions.sendMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    parts: [MessagePart.textPart('Hello!')]\n  },\n  { format: 'acontext' }\n);\n\n// Send a message in OpenAI format\nawait client.sessions.sendMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    content: 'Hello from OpenAI format!'\n  },\n  { format: 'openai' }\n);\n","label":"JavaScript"}]
 func (h *SessionHandler) SendMessage(c *gin.Context) {
+	query := SendMessageQuery{}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	req := SendMessageReq{}
 
 	ct := c.ContentType()
@@ -329,6 +826,14 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 				return
 			}
 		}
+		// Usage may also be sent as its own form field, next to the payload
+		if u := c.PostForm("usage"); u != "" {
+			req.Usage = &MessageUsageReq{}
+			if err := sonic.Unmarshal([]byte(u), req.Usage); err != nil {
+				c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid usage json", err))
+				return
+			}
+		}
 	} else {
 		if err := c.ShouldBind(&req); err != nil {
 			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
@@ -348,72 +853,17 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Parse and normalize based on format
-	// Blob contains the complete message object, directly use official SDK validation
-	var normalizedRole string
-	var normalizedParts []service.PartIn
-	var normalizedMeta map[string]interface{}
-	var fileFields []string
-
 	blobJSON, err := sonic.Marshal(req.Blob)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid blob", err))
 		return
 	}
-
-	switch format {
-	case model.FormatAcontext:
-		// Parse and validate using Acontext normalizer
-		norm := &normalizer.AcontextNormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromAcontextMessage(blobJSON)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize Acontext message", err))
-			return
-		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
-		}
-
-	case model.FormatOpenAI:
-		// Parse and validate using official OpenAI SDK
-		norm := &normalizer.OpenAINormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromOpenAIMessage(blobJSON)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize OpenAI message", err))
-			return
-		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
-		}
-
-	case model.FormatAnthropic:
-		// Parse and validate using official Anthropic SDK
-		norm := &normalizer.AnthropicNormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromAnthropicMessage(blobJSON)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize Anthropic message", err))
-			return
-		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
-		}
-
-	default:
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("unsupported format", fmt.Errorf("format %s is not supported", format)))
+	norm, msg, err := normalizeMessageBlob(format, blobJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr(msg, err))
 		return
 	}
+	normalizedRole, normalizedParts, normalizedMeta, fileFields := norm.role, norm.parts, norm.meta, norm.fileFields
 
 	// Validate that we have at least one part
 	if len(normalizedParts) == 0 {
@@ -421,10 +871,28 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Handle file uploads if multipart
-	fileMap := map[string]*multipart.FileHeader{}
-	if strings.HasPrefix(ct, "multipart/form-data") {
-		for _, fileField := range fileFields {
+	usage, err := req.Usage.toModel()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid usage", err))
+		return
+	}
+
+	// A deliver_at in the past sends the message now
+	var deliverAt time.Time
+	if req.DeliverAt != nil {
+		if query.Sync {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("deliver_at cannot be combined with sync")))
+			return
+		}
+		if time.Until(*req.DeliverAt) > 0 {
+			deliverAt = *req.DeliverAt
+		}
+	}
+
+	// Handle file uploads if multipart
+	fileMap := map[string]*multipart.FileHeader{}
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		for _, fileField := range fileFields {
 			fh, err := c.FormFile(fileField)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("missing file %s", fileField), err))
@@ -432,6 +900,14 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 			}
 			fileMap[fileField] = fh
 		}
+		files := make([]*multipart.FileHeader, 0, len(fileMap))
+		for _, fh := range fileMap {
+			files = append(files, fh)
+		}
+		if err := checkUploads(h.upload, files); err != nil {
+			respondUploadErr(c, err)
+			return
+		}
 	}
 
 	project, ok := c.MustGet("project").(*model.Project)
@@ -446,6 +922,16 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
+	var parentID *uuid.UUID
+	if req.ParentID != "" {
+		id, err := uuid.Parse(req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid parent_id", err))
+			return
+		}
+		parentID = &id
+	}
+
 	out, err := h.svc.SendMessage(c.Request.Context(), service.SendMessageInput{
 		ProjectID:   project.ID,
 		SessionID:   sessionID,
@@ -453,12 +939,397 @@ func (h *SessionHandler) SendMessage(c *gin.Context) {
 		Parts:       normalizedParts,
 		MessageMeta: normalizedMeta,
 		Files:       fileMap,
+		ParentID:    parentID,
+		Usage:       usage,
+
+		PartTransforms: project.PartTransforms(),
+		Redaction:      project.Redaction(),
+		DeliverAt:      deliverAt,
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrParentMessageNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, service.ErrDuplicateMessage) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, service.ErrDeliverAtTooFar) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		if errors.Is(err, service.ErrScheduleUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, blob.ErrMIMEMismatch) {
+			c.JSON(http.StatusUnsupportedMediaType, serializer.Err(http.StatusUnsupportedMediaType, err.Error(), nil))
+			return
+		}
 		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
 		return
 	}
 
+	if !deliverAt.IsZero() {
+		c.JSON(http.StatusAccepted, serializer.Response{Data: ScheduledMessageResp{Message: out, DeliverAt: deliverAt}})
+		return
+	}
+	if !query.Sync {
+		c.JSON(http.StatusCreated, serializer.Response{Data: out})
+		return
+	}
+	resp := SendMessageResp{Message: out, Processors: []service.ProcessorResult{}}
+	if h.postIngest != nil {
+		resp.Processors = h.postIngest.Run(c.Request.Context(), service.SendMQPublishJSON{
+			ProjectID: project.ID,
+			SessionID: sessionID,
+			MessageID: out.ID,
+		})
+	}
+	c.JSON(http.StatusCreated, serializer.Response{Data: resp})
+}
+
+type SendTurnReq struct {
+	Format string `json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+	// Messages are the user message, then the assistant messages and tool results it led to, in order
+	Messages []TurnMessageReq `json:"messages" binding:"required,min=1,max=50,dive"`
+	// ParentID branches the turn from an earlier message instead of the latest one
+	ParentID string `json:"parent_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// TurnMessageReq is a message of a turn, blob is in the format of the turn
+type TurnMessageReq struct {
+	Blob interface{} `json:"blob" binding:"required"`
+	// Usage is the token usage of the model call that produced the message
+	Usage *MessageUsageReq `json:"usage"`
+}
+
+// SendTurn godoc
+//
+//	@Summary		Send a turn to session
+//	@Description	Stores a user message and the assistant messages and tool results it led to in one atomic request: either every message is stored or none is, so an agent crashing mid-turn never leaves a tool call without its result. Each blob is a complete message in format, as for POST /session/{session_id}/messages; files cannot be uploaded in a turn. The messages share a turn_id and are chained in order, the first one to the latest message of the session unless parent_id names an earlier message to branch from. A turn holds up to 50 messages; it is refused with 429 and Retry-After like a single message when the session is sent messages faster than the server rate limit. The turn counts against the quotas as a whole: it is refused with 429 when its messages do not fit in the messages of the day and with 402 when its blobs do not fit in the storage quota. With the dedupe_window session config, a turn whose first message repeats the message it follows within the window is refused with 409. A session reaching the server soft limit of messages with the turn answers with an X-Acontext-Limit-Warning header, a turn taking it over the hard limit is refused with 422.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path		string				true	"Session ID"	Format(uuid)
+//	@Param			payload		body		handler.SendTurnReq	true	"SendTurn payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.SendTurnOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		429	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/turns [post]
+func (h *SessionHandler) SendTurn(c *gin.Context) {
+	req := SendTurnReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	formatStr := req.Format
+	if formatStr == "" {
+		formatStr = string(model.FormatOpenAI) // Default to OpenAI format
+	}
+	format, err := converter.ValidateFormat(formatStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+
+	messages := make([]service.TurnMessageIn, 0, len(req.Messages))
+	var sizeB int64
+	for i, m := range req.Messages {
+		blobJSON, err := sonic.Marshal(m.Blob)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("invalid blob of messages[%d]", i), err))
+			return
+		}
+		sizeB += int64(len(blobJSON))
+		norm, msg, err := normalizeMessageBlob(format, blobJSON)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("messages[%d]: %s", i, msg), err))
+			return
+		}
+		if len(norm.parts) == 0 {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("messages[%d] must contain at least one part", i)))
+			return
+		}
+		if len(norm.fileFields) > 0 {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("messages[%d]: files cannot be uploaded in a turn", i)))
+			return
+		}
+		usage, err := m.Usage.toModel()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("invalid usage of messages[%d]", i), err))
+			return
+		}
+		messages = append(messages, service.TurnMessageIn{
+			Role:        norm.role,
+			Parts:       norm.parts,
+			MessageMeta: norm.meta,
+			Usage:       usage,
+		})
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	var parentID *uuid.UUID
+	if req.ParentID != "" {
+		id, err := uuid.Parse(req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid parent_id", err))
+			return
+		}
+		parentID = &id
+	}
+
+	// The limits and quotas are checked against the whole turn, not a single message
+	if h.limits != nil {
+		usage, err := h.limits.CheckSessionMessages(c.Request.Context(), sessionID, int64(len(messages)))
+		if !applyEntityLimit(c, usage, err) {
+			return
+		}
+	}
+	if h.quota != nil {
+		if err := h.quota.CheckMessages(c.Request.Context(), project, time.Now(), int64(len(messages))); err != nil {
+			abortQuotaErr(c, err)
+			return
+		}
+		if err := h.quota.CheckStorage(c.Request.Context(), project, sizeB); err != nil {
+			abortQuotaErr(c, err)
+			return
+		}
+	}
+
+	out, err := h.svc.SendTurn(c.Request.Context(), service.SendTurnInput{
+		ProjectID:      project.ID,
+		SessionID:      sessionID,
+		Messages:       messages,
+		ParentID:       parentID,
+		PartTransforms: project.PartTransforms(),
+		Redaction:      project.Redaction(),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrParentMessageNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, service.ErrDuplicateMessage) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, service.ErrTurnTooLarge) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
+
+// maxStreamLineBytes bounds a single SSE/NDJSON line of a streamed message
+const maxStreamLineBytes = 4 << 20
+
+var errInvalidStreamChunk = errors.New("invalid stream chunk")
+
+type StreamMessageReq struct {
+	Role string `form:"role,default=assistant" json:"role" binding:"omitempty,oneof=user assistant system" example:"assistant" enums:"user,assistant,system"`
+}
+
+// StreamMessageChunk is a single event of a streamed message.
+// Delta is appended to the current text part, Part appends a complete part and Meta is merged into the message meta.
+// Usage replaces the usage of the message, providers usually report it in the last chunk.
+type StreamMessageChunk struct {
+	Delta string                 `json:"delta,omitempty"`
+	Part  *service.PartIn        `json:"part,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+	Usage *MessageUsageReq       `json:"usage,omitempty"`
+}
+
+// messageStreamAssembler accumulates streamed chunks into the parts of a single message
+type messageStreamAssembler struct {
+	parts []service.PartIn
+	meta  map[string]interface{}
+	usage *MessageUsageReq
+	text  strings.Builder
+}
+
+func (a *messageStreamAssembler) add(chunk StreamMessageChunk) {
+	if chunk.Delta != "" {
+		a.text.WriteString(chunk.Delta)
+	}
+	if chunk.Part != nil {
+		a.flushText()
+		a.parts = append(a.parts, *chunk.Part)
+	}
+	for k, v := range chunk.Meta {
+		if a.meta == nil {
+			a.meta = map[string]interface{}{}
+		}
+		a.meta[k] = v
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+}
+
+func (a *messageStreamAssembler) flushText() {
+	if a.text.Len() == 0 {
+		return
+	}
+	a.parts = append(a.parts, service.PartIn{Type: "text", Text: a.text.String()})
+	a.text.Reset()
+}
+
+// readMessageStream consumes an SSE (`data: {...}`) or newline-delimited JSON body until EOF or a `[DONE]` event.
+// It returns whether the stream was closed cleanly; on a read error the chunks received so far are kept.
+func readMessageStream(body io.Reader, a *messageStreamAssembler) (bool, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+
+	// A chunk that does not parse is only invalid when more follows, as the last line it was cut off
+	var invalid error
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		if invalid != nil {
+			return false, invalid
+		}
+		if strings.HasPrefix(line, "event:") || strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "retry:") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if line == "[DONE]" {
+			return true, nil
+		}
+
+		chunk := StreamMessageChunk{}
+		if err := sonic.Unmarshal([]byte(line), &chunk); err != nil {
+			invalid = fmt.Errorf("%w: %v", errInvalidStreamChunk, err)
+			continue
+		}
+		a.add(chunk)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return invalid == nil, nil
+}
+
+// StreamMessage godoc
+//
+//	@Summary		Stream message to session
+//	@Description	Append a message incrementally while it is being generated. The request body is either Server-Sent Events (`data: {...}` lines) or newline-delimited JSON chunks. Each chunk may contain `delta` (text appended to the current text part), `part` (a complete part in acontext format, e.g. a tool-call), `meta` (merged into the message meta) and `usage` (token usage of the message, the last one wins). The stream ends at EOF or on a `[DONE]` event, then the assembled message is persisted. If the client disconnects mid-stream or the last chunk is cut off, the partial message is still persisted with `meta.stream_incomplete=true`. Streams count against the message rate limit of the session like POST /session/{session_id}/messages. A session holding as many messages as the server soft limit answers with an X-Acontext-Limit-Warning header, one at the hard limit refuses new messages with 422.
+//	@Tags			session
+//	@Accept			text/event-stream
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	Format(uuid)
+//	@Param			role		query	string	false	"Role of the streamed message (default assistant)"	Enums(user, assistant, system)
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Message}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		402	{object}	serializer.ErrorResponse
+//	@Failure		409	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		429	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/stream [post]
+func (h *SessionHandler) StreamMessage(c *gin.Context) {
+	req := StreamMessageReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if req.Role == "" {
+		req.Role = "assistant"
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	assembler := &messageStreamAssembler{}
+	complete, err := readMessageStream(c.Request.Body, assembler)
+	if errors.Is(err, errInvalidStreamChunk) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	assembler.flushText()
+	if len(assembler.parts) == 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("message must contain at least one part")))
+		return
+	}
+	for i := range assembler.parts {
+		if verr := assembler.parts[i].Validate(); verr != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("invalid part %d", i), verr))
+			return
+		}
+	}
+
+	usage, err := assembler.usage.toModel()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid usage", err))
+		return
+	}
+
+	meta := assembler.meta
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	if !complete {
+		meta["stream_incomplete"] = true
+	}
+
+	// Persist even if the client went away, so partial output is not lost
+	out, serr := h.svc.SendMessage(context.WithoutCancel(c.Request.Context()), service.SendMessageInput{
+		ProjectID:   project.ID,
+		SessionID:   sessionID,
+		Role:        req.Role,
+		Parts:       assembler.parts,
+		MessageMeta: meta,
+		Usage:       usage,
+
+		PartTransforms: project.PartTransforms(),
+		Redaction:      project.Redaction(),
+	})
+	if serr != nil {
+		if errors.Is(serr, service.ErrDuplicateMessage) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, serr.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", serr))
+		return
+	}
+
 	c.JSON(http.StatusCreated, serializer.Response{Data: out})
 }
 
@@ -466,25 +1337,57 @@ type GetMessagesReq struct {
 	Limit              int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
 	Cursor             string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
 	WithAssetPublicURL bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
-	Format             string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic" example:"openai" enums:"acontext,openai,anthropic"`
+	Format             string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
 	TimeDesc           bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	// Roles and PartTypes are comma-separated filters, a message matches with any of its parts
+	Roles     []string `form:"roles" collection_format:"csv" json:"roles" binding:"omitempty,dive,oneof=user assistant system" example:"user,assistant"`
+	PartTypes []string `form:"part_types" collection_format:"csv" json:"part_types" binding:"omitempty,dive,oneof=text image audio video file tool-call tool-result data" example:"text,tool-call"`
+	// AsOf reads the session as it was at that time (RFC 3339)
+	AsOf time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00" json:"as_of" example:"2025-01-01T12:00:00Z"`
+	// CollapseSuperseded leaves out superseded messages and the messages descending from them
+	CollapseSuperseded bool `form:"collapse_superseded" json:"collapse_superseded" example:"true"`
+	// AnchorMessageID returns the window of before and after messages around that message instead of a page
+	AnchorMessageID string `form:"anchor_message_id" json:"anchor_message_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Before          int    `form:"before,default=10" json:"before" binding:"min=0,max=200" example:"10"`
+	After           int    `form:"after,default=10" json:"after" binding:"min=0,max=200" example:"10"`
+}
+
+// messageAssetExpire is the expiry of the presigned URLs of message assets: the default of the presign policy of
+// the project, or else 24 hours
+func messageAssetExpire(c *gin.Context) time.Duration {
+	v, _ := c.Get("project")
+	project, _ := v.(*model.Project)
+	// No expiry is requested, so none is refused
+	expire, _ := service.PresignExpire(project, 0, 24*time.Hour)
+	return expire
 }
 
 // GetMessages godoc
 //
 //	@Summary		Get messages from session
-//	@Description	Get messages from session. Default format is openai. Can convert to acontext (original) or anthropic format.
+//	@Description	Get messages from session. Default format is openai. Can convert to acontext (original), anthropic, gemini or ai-sdk format. roles and part_types filter the messages on the server, e.g. roles=assistant&part_types=tool-call. processing_status lists, in the order of items, the state of the asynchronous processors of each message (pending, done or failed) and whether all of them are done. as_of reads the session as it was at a past time, e.g. to reconstruct the context an agent had during an evaluation: only messages created up to as_of are returned. collapse_superseded=true leaves out the messages superseded by a regenerated one, see POST /session/{session_id}/messages/{message_id}/supersede, together with the messages that descend from them. anchor_message_id returns a window centered on that message instead of a page, e.g. to deep-link into a long conversation: the before messages preceding it, the message and the after messages following it, oldest first; limit, cursor and time_desc do not apply and the filters apply to the surrounding messages only. next_cursor continues the window forwards and prev_cursor, with has_more_before, continues it backwards with time_desc=true.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
 //	@Param			session_id				path	string	true	"Session ID"	format(uuid)
 //	@Param			limit					query	integer	false	"Limit of messages to return, default 20. Max 200."
 //	@Param			cursor					query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
-//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public url, default is true"								example:"true"
-//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic."	enums(acontext,openai,anthropic)
+//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public urls, default is true. Provider formats carry them inline, e.g. in the image_url of openai and the source.url of anthropic; the acontext format returns them in public_urls, keyed by asset SHA256"	example:"true"
+//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic, gemini, ai-sdk."	enums(acontext,openai,anthropic,gemini,ai-sdk)
 //	@Param			time_desc				query	string	false	"Order by created_at descending if true, ascending if false (default false)"		example:"false"
+//	@Param			roles					query	[]string	false	"Only messages with one of these roles"	collectionFormat(csv)	Enums(user,assistant,system)
+//	@Param			part_types				query	[]string	false	"Only messages with a part of one of these types"	collectionFormat(csv)	Enums(text,image,audio,video,file,tool-call,tool-result,data)
+//	@Param			as_of					query	string	false	"Read the session as it was at this time (RFC 3339)"	format(date-time)	example:"2025-01-01T12:00:00Z"
+//	@Param			collapse_superseded		query	boolean	false	"Leave out superseded messages and their descendants"	example:"true"
+//	@Param			anchor_message_id		query	string	false	"Return the messages around this message"	format(uuid)
+//	@Param			before					query	integer	false	"Messages before the anchor, default 10. Max 200."
+//	@Param			after					query	integer	false	"Messages after the anchor, default 10. Max 200."
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.GetMessagesOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/messages [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get messages from session\nmessages = client.sessions.get_messages(\n    session_id='session-uuid',\n    limit=50,\n    format='acontext',\n    time_desc=True\n)\nfor message in messages.items:\n    print(f\"{message.role}: {message.parts}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get messages from session\nconst messages = await client.sessions.getMessages('session-uuid', {\n  limit: 50,\n  format: 'acontext',\n  timeDesc: true\n});\nfor (const message of messages.items) {\n  console.log(`${message.role}: ${JSON.stringify(message.parts)}`);\n}\n","label":"JavaScript"}]
 func (h *SessionHandler) GetMessages(c *gin.Context) {
@@ -499,15 +1402,40 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
+	var anchorID *uuid.UUID
+	if req.AnchorMessageID != "" {
+		if req.Cursor != "" {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("anchor_message_id cannot be combined with cursor")))
+			return
+		}
+		id, err := uuid.Parse(req.AnchorMessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid anchor_message_id", err))
+			return
+		}
+		anchorID = &id
+	}
+
 	out, err := h.svc.GetMessages(c.Request.Context(), service.GetMessagesInput{
 		SessionID:          sessionID,
 		Limit:              req.Limit,
 		Cursor:             req.Cursor,
 		WithAssetPublicURL: req.WithAssetPublicURL,
-		AssetExpire:        time.Hour * 24,
+		AssetExpire:        messageAssetExpire(c),
 		TimeDesc:           req.TimeDesc,
+		Roles:              req.Roles,
+		PartTypes:          req.PartTypes,
+		AsOf:               req.AsOf,
+		CollapseSuperseded: req.CollapseSuperseded,
+		AnchorMessageID:    anchorID,
+		Before:             req.Before,
+		After:              req.After,
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
 		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
 		return
 	}
@@ -524,6 +1452,7 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	stopConvert := timing.Track(c.Request.Context(), timing.Convert)
 	convertedOut, err := converter.GetConvertedMessagesOutput(
 		out.Items,
 		format,
@@ -531,14 +1460,1045 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		out.NextCursor,
 		out.HasMore,
 	)
+	stopConvert()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to convert messages", err))
 		return
 	}
 
+	if h.postIngest != nil {
+		ids := make([]uuid.UUID, 0, len(out.Items))
+		for _, m := range out.Items {
+			ids = append(ids, m.ID)
+		}
+		status, err := h.postIngest.Status(c.Request.Context(), ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		convertedOut["processing_status"] = status
+	}
+	if anchorID != nil {
+		convertedOut["prev_cursor"] = out.PrevCursor
+		convertedOut["has_more_before"] = out.HasMoreBefore
+	}
+
+	setPaginationLinks(c, out.NextCursor)
 	c.JSON(http.StatusOK, serializer.Response{Data: convertedOut})
 }
 
+type GetContextWindowReq struct {
+	MaxTokens          int    `form:"max_tokens,default=8000" json:"max_tokens" binding:"min=1,max=2000000" example:"8000"`
+	Strategy           string `form:"strategy,default=recent" json:"strategy" binding:"omitempty,oneof=recent summary" example:"recent" enums:"recent,summary"`
+	Format             string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+	WithAssetPublicURL bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
+}
+
+type GetContextWindowResp struct {
+	Items           interface{}                  `json:"items"`
+	PublicURLs      map[string]service.PublicURL `json:"public_urls,omitempty"`
+	Tokens          int                          `json:"tokens"`
+	MaxTokens       int                          `json:"max_tokens"`
+	Strategy        string                       `json:"strategy"`
+	Preset          string                       `json:"preset,omitempty"`
+	TotalMessages   int                          `json:"total_messages"`
+	DroppedMessages int                          `json:"dropped_messages"`
+	Truncated       bool                         `json:"truncated"`
+	Summarized      bool                         `json:"summarized"`
+}
+
+// GetContextWindow godoc
+//
+//	@Summary		Get context window of session
+//	@Description	Get the messages of the current branch of a session trimmed to a token budget, ready to send to a model in the requested format. Leading system messages are always kept, then the newest messages that fit; if not even the newest message fits, it is truncated. Tool results whose tool call was dropped are left out. With strategy=summary, a quarter of the budget is reserved for a user message quoting the dropped messages. Tokens are counted with o200k_base on text and tool parts.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id				path	string	true	"Session ID"	format(uuid)
+//	@Param			max_tokens				query	integer	false	"Token budget of the window, default 8000"	example:"8000"
+//	@Param			strategy				query	string	false	"How dropped messages are handled: recent (default) or summary"	enums(recent,summary)
+//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic, gemini, ai-sdk."	enums(acontext,openai,anthropic,gemini,ai-sdk)
+//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public url, default is true"	example:"true"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.GetContextWindowResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/context [get]
+func (h *SessionHandler) GetContextWindow(c *gin.Context) {
+	req := GetContextWindowReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	formatStr := req.Format
+	if formatStr == "" {
+		formatStr = string(model.FormatOpenAI)
+	}
+	format, err := converter.ValidateFormat(formatStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+	if req.Strategy == "" {
+		req.Strategy = service.ContextStrategyRecent
+	}
+
+	h.writeContextWindow(c, service.GetContextWindowInput{
+		SessionID:          sessionID,
+		MaxTokens:          req.MaxTokens,
+		Strategy:           req.Strategy,
+		WithAssetPublicURL: req.WithAssetPublicURL,
+		AssetExpire:        messageAssetExpire(c),
+	}, format, "")
+}
+
+type GetSessionWindowReq struct {
+	// Format overrides the format of the preset
+	Format             string `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"anthropic" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+	WithAssetPublicURL bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
+}
+
+// GetSessionWindow godoc
+//
+//	@Summary		Get window preset of session
+//	@Description	Get the context window of a session built with a named preset, ready to send to a model. Built-in presets are recent, summary+recent and last-10-turns-plus-pins; projects define their own with PUT /project/window_presets. A preset may keep only the last max_turns turns (a turn starts at a user message) and keep messages whose meta has pinned=true whatever their age.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id				path	string	true	"Session ID"	format(uuid)
+//	@Param			preset					path	string	true	"Preset name"	example:"last-10-turns-plus-pins"
+//	@Param			format					query	string	false	"Overrides the format of the preset: acontext, openai, anthropic, gemini, ai-sdk."	enums(acontext,openai,anthropic,gemini,ai-sdk)
+//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public url, default is true"	example:"true"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.GetContextWindowResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/window/{preset} [get]
+func (h *SessionHandler) GetSessionWindow(c *gin.Context) {
+	req := GetSessionWindowReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	preset, ok := service.ResolveWindowPreset(project, c.Param("preset"))
+	if !ok {
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "window preset not found", nil))
+		return
+	}
+	if req.Format != "" {
+		preset.Format = req.Format
+	}
+	format, err := converter.ValidateFormat(preset.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+
+	h.writeContextWindow(c, service.GetContextWindowInput{
+		SessionID:          sessionID,
+		MaxTokens:          preset.MaxTokens,
+		Strategy:           preset.Strategy,
+		WithAssetPublicURL: req.WithAssetPublicURL,
+		AssetExpire:        messageAssetExpire(c),
+		MaxTurns:           preset.MaxTurns,
+		KeepPinned:         preset.KeepPinned,
+	}, format, preset.Name)
+}
+
+// writeContextWindow builds the context window of in and writes it converted to format
+func (h *SessionHandler) writeContextWindow(c *gin.Context, in service.GetContextWindowInput, format model.MessageFormat, preset string) {
+	window, err := h.svc.GetContextWindow(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, service.ErrContextBudgetTooSmall) {
+			c.JSON(http.StatusUnprocessableEntity, serializer.Err(http.StatusUnprocessableEntity, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	stopConvert := timing.Track(c.Request.Context(), timing.Convert)
+	items, err := converter.ConvertMessages(converter.ConvertMessagesInput{
+		Messages:   window.Messages,
+		Format:     format,
+		PublicURLs: window.PublicURLs,
+	})
+	stopConvert()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to convert messages", err))
+		return
+	}
+
+	resp := GetContextWindowResp{
+		Items:           items,
+		Tokens:          window.Tokens,
+		MaxTokens:       in.MaxTokens,
+		Strategy:        in.Strategy,
+		Preset:          preset,
+		TotalMessages:   window.TotalMessages,
+		DroppedMessages: window.DroppedMessages,
+		Truncated:       window.Truncated,
+		Summarized:      window.Summarized,
+	}
+	// Same as GetMessages, public urls are only returned with the original format
+	if format == model.FormatAcontext {
+		resp.PublicURLs = window.PublicURLs
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// Formats of ExportSession, every format but archive is newline-delimited JSON
+const (
+	ExportFormatJSONL          = "jsonl"           // one acontext message per line
+	ExportFormatOpenAIFinetune = "openai-finetune" // one line {"messages": [...]} as expected by OpenAI fine-tuning
+	ExportFormatAnthropic      = "anthropic"       // one line {"system": "...", "messages": [...]} of Anthropic messages
+	ExportFormatArchive        = "archive"         // a zip of an HTML transcript with its assets and checksums
+)
+
+type ExportSessionReq struct {
+	// Format is jsonl (default), one acontext message per line; openai-finetune, one {"messages": [...]} line in the
+	// OpenAI chat fine-tuning format; anthropic, one {"system": "...", "messages": [...]} line where system joins the
+	// text of the system messages; or archive, a zip for retention outside of Acontext, see GET /session/archive.
+	// Files of several sessions can be concatenated into a dataset.
+	Format             string `form:"format,default=jsonl" json:"format" binding:"omitempty,oneof=jsonl openai-finetune anthropic archive" example:"openai-finetune" enums:"jsonl,openai-finetune,anthropic,archive"`
+	WithAssetPublicURL bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
+	// AfterMessageID resumes an interrupted jsonl export after the message of the last complete line.
+	// The file is streamed as messages are loaded, so a failure midway truncates it.
+	AfterMessageID string `form:"after_message_id" json:"after_message_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// ExportSession godoc
+//
+//	@Summary		Export session
+//	@Description	Download the whole current branch of a session, without pagination, as a newline-delimited JSON file in the given format or as a zip archive. The export is tracked as an export task of the project, see GET /project/tasks.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		application/x-ndjson
+//	@Param			session_id				path	string	true	"Session ID"	format(uuid)
+//	@Param			format					query	string	false	"Export format: jsonl (default), openai-finetune, anthropic, archive"	enums(jsonl,openai-finetune,anthropic,archive)
+//	@Param			with_asset_public_url	query	string	false	"Whether to reference assets with public urls, default is true"	example:"true"
+//	@Param			after_message_id		query	string	false	"Resume a jsonl export after this message"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{file}		file
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/export [get]
+func (h *SessionHandler) ExportSession(c *gin.Context) {
+	req := ExportSessionReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	in := service.ExportSessionInput{
+		ProjectID:          project.ID,
+		SessionID:          sessionID,
+		WithAssetPublicURL: req.WithAssetPublicURL,
+		AssetExpire:        messageAssetExpire(c),
+	}
+	if req.AfterMessageID != "" {
+		if req.Format != ExportFormatJSONL {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("after_message_id only resumes jsonl exports")))
+			return
+		}
+		id := uuid.MustParse(req.AfterMessageID)
+		in.AfterMessageID = &id
+	}
+	if req.Format == ExportFormatArchive {
+		h.writeArchive(c, project.ID, []uuid.UUID{sessionID}, fmt.Sprintf("session-%s-archive.zip", sessionID))
+		return
+	}
+
+	_, finish := h.startJob(c, project.ID, model.TaskKindExport, map[string]interface{}{"session_id": sessionID, "format": req.Format})
+	w := &sessionExportWriter{c: c, format: req.Format, filename: fmt.Sprintf("session-%s-%s.jsonl", sessionID, req.Format)}
+	n, err := h.svc.Export(c.Request.Context(), in, w.write)
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		finish(err, nil)
+		if w.started {
+			// The status is sent already, the client gets a truncated file
+			_ = c.Error(err)
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrExportCursorNotFound):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+	finish(nil, map[string]interface{}{"messages": n})
+}
+
+// sessionExportWriter writes the batches of a session export as they are loaded. jsonl writes a line per message;
+// the provider formats write a single line whose messages array is filled batch after batch.
+type sessionExportWriter struct {
+	c        *gin.Context
+	format   string
+	filename string
+	started  bool
+	items    int
+	system   []string
+}
+
+// start sends the headers, once the export is known to succeed at least up to its first batch
+func (w *sessionExportWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.filename))
+	w.c.Header("Content-Type", "application/x-ndjson")
+	w.c.Status(http.StatusOK)
+	if w.format == ExportFormatJSONL {
+		return nil
+	}
+	_, err := w.c.Writer.WriteString(`{"messages":[`)
+	return err
+}
+
+func (w *sessionExportWriter) write(batch *service.SessionExport) error {
+	format := model.FormatAcontext
+	switch w.format {
+	case ExportFormatOpenAIFinetune:
+		format = model.FormatOpenAI
+	case ExportFormatAnthropic:
+		format = model.FormatAnthropic
+		if system := systemText(batch.Messages); system != "" {
+			w.system = append(w.system, system)
+		}
+	}
+	items, err := converter.ConvertMessages(converter.ConvertMessagesInput{Messages: batch.Messages, Format: format, PublicURLs: batch.PublicURLs})
+	if err != nil {
+		return fmt.Errorf("failed to convert messages: %w", err)
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	if format == model.FormatAcontext {
+		enc := sonic.ConfigDefault.NewEncoder(w.c.Writer)
+		for _, m := range items.([]converter.AcontextMessage) {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+	} else {
+		// The items of the batch without the brackets of their array
+		raw, err := sonic.Marshal(items)
+		if err != nil {
+			return err
+		}
+		if inner := raw[1 : len(raw)-1]; len(inner) > 0 {
+			if w.items > 0 {
+				inner = append([]byte{','}, inner...)
+			}
+			if _, err := w.c.Writer.Write(inner); err != nil {
+				return err
+			}
+			w.items++
+		}
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// close ends the single line of the provider formats
+func (w *sessionExportWriter) close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.format == ExportFormatJSONL {
+		return nil
+	}
+	end := []byte("]")
+	if len(w.system) > 0 {
+		system, err := sonic.Marshal(strings.Join(w.system, "\n\n"))
+		if err != nil {
+			return err
+		}
+		end = append(append(end, `,"system":`...), system...)
+	}
+	_, err := w.c.Writer.Write(append(end, "}\n"...))
+	return err
+}
+
+// ArchiveSessionsReq selects the sessions of an archive. The zip holds an index.html linking to one HTML transcript per
+// session under sessions/, the assets of the messages under assets/ named by their SHA-256, and a manifest.json listing
+// every other file with its SHA-256 and size.
+type ArchiveSessionsReq struct {
+	// SessionIDs are checked before the download starts, a failure midway truncates the zip
+	SessionIDs []string `form:"session_ids" collection_format:"csv" json:"session_ids" binding:"required,min=1,max=50,dive,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// ArchiveSessions godoc
+//
+//	@Summary		Archive sessions
+//	@Description	Download a self-contained zip of HTML transcripts of the current branch of sessions, with their assets and checksums, for legal or compliance retention outside of Acontext. The archive is tracked as an export task of the project, see GET /project/tasks.
+//	@Tags			session
+//	@Produce		application/zip
+//	@Param			session_ids	query	[]string	true	"IDs of the sessions to archive, at most 50"	collectionFormat(csv)
+//	@Security		BearerAuth
+//	@Success		200	{file}		file
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/archive [get]
+func (h *SessionHandler) ArchiveSessions(c *gin.Context) {
+	req := ArchiveSessionsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.SessionIDs))
+	for _, raw := range req.SessionIDs {
+		if id := uuid.MustParse(raw); !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	h.writeArchive(c, project.ID, ids, "sessions-archive.zip")
+}
+
+// writeArchive streams the archive of sessions as a zip download, tracked as an export task
+func (h *SessionHandler) writeArchive(c *gin.Context, projectID uuid.UUID, sessionIDs []uuid.UUID, filename string) {
+	_, finish := h.startJob(c, projectID, model.TaskKindExport, map[string]interface{}{"session_ids": sessionIDs, "format": ExportFormatArchive})
+	w := &archiveWriter{c: c, filename: filename}
+	n, err := h.svc.Archive(c.Request.Context(), service.ArchiveSessionsInput{ProjectID: projectID, SessionIDs: sessionIDs}, w)
+	if err != nil {
+		finish(err, nil)
+		if w.started {
+			// The status is sent already, the client gets a truncated zip
+			_ = c.Error(err)
+			return
+		}
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	finish(nil, map[string]interface{}{"messages": n})
+}
+
+// archiveWriter sends the headers of the download with the first bytes of the zip
+type archiveWriter struct {
+	c        *gin.Context
+	filename string
+	started  bool
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.filename))
+		w.c.Header("Content-Type", "application/zip")
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+type SampleMessagesReq struct {
+	Size     int       `form:"size,default=50" json:"size" binding:"min=1,max=500" example:"50"`
+	Stratify string    `form:"stratify,default=none" json:"stratify" binding:"omitempty,oneof=none tag tool time" example:"tag" enums:"none,tag,tool,time"`
+	Bucket   string    `form:"bucket,default=day" json:"bucket" binding:"omitempty,oneof=hour day week" example:"day" enums:"hour,day,week"`
+	Roles    []string  `form:"roles" collection_format:"csv" json:"roles" binding:"omitempty,dive,oneof=user assistant system" example:"assistant"`
+	Since    time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" json:"since" example:"2025-01-01T00:00:00Z"`
+	Until    time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" json:"until" example:"2025-02-01T00:00:00Z"`
+}
+
+// SampleMessages godoc
+//
+//	@Summary		Sample messages
+//	@Description	Draw a random sample of the messages of the project for quality review, without exporting everything. With stratify the sample is spread evenly across strata: tag samples every message tag (untagged messages are in "(none)"), tool samples every tool called by the messages, time samples every hour, day or week bucket. Strata lists how many messages of each stratum were in the drawn pool and in the sample.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			size		query	integer		false	"Sample size, default 50, max 500"
+//	@Param			stratify	query	string		false	"Stratify by none (default), tag, tool or time"	enums(none,tag,tool,time)
+//	@Param			bucket		query	string		false	"Time bucket of stratify=time, default day"	enums(hour,day,week)
+//	@Param			roles		query	[]string	false	"Only messages of these roles"	collectionFormat(csv)	Enums(user,assistant,system)
+//	@Param			since		query	string		false	"Only messages created at or after this time (RFC 3339)"	format(date-time)
+//	@Param			until		query	string		false	"Only messages created before this time (RFC 3339)"	format(date-time)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.MessageSample}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/messages/sample [get]
+func (h *SessionHandler) SampleMessages(c *gin.Context) {
+	req := SampleMessagesReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if !req.Since.IsZero() && !req.Until.IsZero() && !req.Until.After(req.Since) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("until must be after since")))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.SampleMessages(c.Request.Context(), service.SampleMessagesInput{
+		ProjectID: project.ID,
+		Size:      req.Size,
+		Stratify:  req.Stratify,
+		Bucket:    req.Bucket,
+		Roles:     req.Roles,
+		Since:     req.Since,
+		Until:     req.Until,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSampleBucket) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// systemText joins the text parts of the system messages of msgs
+func systemText(msgs []model.Message) string {
+	var texts []string
+	for _, m := range msgs {
+		if m.Role != "system" {
+			continue
+		}
+		for _, p := range m.Parts {
+			if p.Type == "text" && p.Text != "" {
+				texts = append(texts, p.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+type ForkSessionReq struct {
+	// WithMessages copies the messages into the fork, default true
+	WithMessages *bool `form:"with_messages" json:"with_messages" example:"true"`
+	// MessageID limits the copied messages to the branch ending at this message
+	MessageID string `form:"message_id" json:"message_id" binding:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// ForkSession godoc
+//
+//	@Summary		Fork session
+//	@Description	Clone a session into a new session with the same configs, to explore an alternative trajectory without changing the original transcript. Messages are copied unless with_messages is false; with message_id only the branch ending at that message is copied. Copied messages share their parts and assets with the original. The fork is not connected to a space.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string					true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.ForkSessionReq	false	"ForkSession payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Session}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/fork [post]
+func (h *SessionHandler) ForkSession(c *gin.Context) {
+	req := ForkSessionReq{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	in := service.ForkSessionInput{
+		ProjectID:    project.ID,
+		SessionID:    sessionID,
+		WithMessages: req.WithMessages == nil || *req.WithMessages,
+	}
+	if req.MessageID != "" {
+		messageID, err := uuid.Parse(req.MessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		in.UpToMessageID = &messageID
+	}
+
+	fork, err := h.svc.Fork(c.Request.Context(), in)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrForkMessageNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: fork})
+}
+
+// ExpandMessagePart godoc
+//
+//	@Summary		Expand message part
+//	@Description	Get the full text of a part of a message. Oversized tool results are archived on ingest and keep a short preview, marked by meta.truncated; this restores their full output.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string	true	"Message ID"	format(uuid)
+//	@Param			index		path	integer	true	"Index of the part in the message"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ExpandedPart}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id}/parts/{index}/expand [get]
+func (h *SessionHandler) ExpandMessagePart(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid message_id", err))
+		return
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid index", err))
+		return
+	}
+
+	part, err := h.svc.ExpandPart(c.Request.Context(), project.ID, sessionID, messageID, index)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) || errors.Is(err, service.ErrMessageNotFound) || errors.Is(err, service.ErrPartNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: part})
+}
+
+type SupersedeMessageReq struct {
+	// By is the assistant message regenerated in place of the superseded one, typically sent with the same parent_id.
+	// It cannot descend from the superseded message nor be superseded itself. Superseding a message again replaces
+	// the message it is superseded by.
+	By uuid.UUID `json:"by" binding:"required" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// SupersedeMessage godoc
+//
+//	@Summary		Supersede message
+//	@Description	Mark an assistant message as superseded by another assistant message of the session. Both stay in the history, GET /session/{session_id}/messages with collapse_superseded=true leaves out the superseded message and its descendants.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string						true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string						true	"ID of the superseded message"	format(uuid)
+//	@Param			payload		body	handler.SupersedeMessageReq	true	"SupersedeMessage payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Message}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id}/supersede [post]
+func (h *SessionHandler) SupersedeMessage(c *gin.Context) {
+	req := SupersedeMessageReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid message_id", err))
+		return
+	}
+
+	msg, err := h.svc.Supersede(c.Request.Context(), service.SupersedeMessageInput{
+		ProjectID: project.ID,
+		SessionID: sessionID,
+		MessageID: messageID,
+		By:        req.By,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrInvalidSupersession):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(err.Error(), err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: msg})
+}
+
+// DeleteMessage godoc
+//
+//	@Summary		Delete message
+//	@Description	Delete a message of a session. Its children are re-linked to its parent, so the messages after it stay in the thread. Messages it superseded are no longer superseded, the rolling summary of the session is rebuilt without it and a message_deleted event is recorded.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string	true	"Message ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.DeleteMessageOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/{message_id} [delete]
+func (h *SessionHandler) DeleteMessage(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid message_id", err))
+		return
+	}
+
+	out, err := h.svc.DeleteMessage(c.Request.Context(), project.ID, sessionID, messageID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) || errors.Is(err, service.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// CheckMessageChains godoc
+//
+//	@Summary		Check message chains of session
+//	@Description	Check that the parent links of the messages of a session form a single tree, so threads can be rebuilt from them. Reports the roots, the orphans whose parent is not in the session, the messages whose parents loop and the messages superseded by a message that is not in the session; consistent is true when there is at most one root and nothing else to report.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.MessageChainReport}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/consistency [get]
+func (h *SessionHandler) CheckMessageChains(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	report, err := h.svc.CheckMessageChains(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: report})
+}
+
+// GetMessageTree godoc
+//
+//	@Summary		Get message tree of session
+//	@Description	Get the branch structure of the messages of a session, without their parts. Each node lists its parent and children; leaf_ids are the heads of every branch.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.MessageTree}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/tree [get]
+func (h *SessionHandler) GetMessageTree(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	tree, err := h.svc.GetMessageTree(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: tree})
+}
+
+// GetSessionUsage godoc
+//
+//	@Summary		Get token usage of session
+//	@Description	Total the token usage reported on the messages of a session when they were sent, overall and per model. Messages sent without usage are not counted.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SessionUsage}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/usage [get]
+func (h *SessionHandler) GetSessionUsage(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	usage, err := h.svc.GetUsage(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: usage})
+}
+
+// GetSessionSummary godoc
+//
+//	@Summary		Get rolling summary of session
+//	@Description	Get the rolling summary the summarization worker keeps for the current branch of a session. The summary is refreshed in the background once enough new messages were added, and stays empty when no LLM provider is configured.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SessionSummary}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/summary [get]
+func (h *SessionHandler) GetSessionSummary(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	summary, err := h.svc.GetSummary(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: summary})
+}
+
+type GetSessionEventsReq struct {
+	Kind     string `form:"kind" json:"kind" binding:"omitempty,oneof=created connected_to_space config_changed message_deleted archived unarchived" example:"config_changed" enums:"created,connected_to_space,config_changed,message_deleted,archived,unarchived"`
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// GetSessionEvents godoc
+//
+//	@Summary		Get session events
+//	@Description	List the lifecycle events of a session for audits: its creation, space connections, config changes, message deletions and archiving. Config changes record the changed keys, not their values.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			kind		query	string	false	"Filter by kind"	enums(created,connected_to_space,config_changed,message_deleted,archived,unarchived)
+//	@Param			limit		query	integer	false	"Limit of events to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example:"false"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListSessionEventsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/events [get]
+func (h *SessionHandler) GetSessionEvents(c *gin.Context) {
+	req := GetSessionEventsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.ListEvents(c.Request.Context(), service.ListSessionEventsInput{
+		ProjectID: project.ID,
+		SessionID: sessionID,
+		Kind:      req.Kind,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 // SessionFlush godoc
 //
 //	@Summary		Flush session
@@ -549,6 +2509,9 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 //	@Param			session_id	path	string	true	"Session ID"	format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=httpclient.FlagResponse}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/flush [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Flush session buffer\nresult = client.sessions.flush(session_id='session-uuid')\nprint(result.status)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Flush session buffer\nconst result = await client.sessions.flush('session-uuid');\nconsole.log(result.status);\n","label":"JavaScript"}]
 func (h *SessionHandler) SessionFlush(c *gin.Context) {
@@ -583,6 +2546,9 @@ func (h *SessionHandler) SessionFlush(c *gin.Context) {
 //	@Param			session_id	path	string	true	"Session ID"	format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=httpclient.LearningStatusResponse}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/get_learning_status [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get learning status\nresult = client.sessions.get_learning_status(session_id='session-uuid')\nprint(f\"Space digested: {result.space_digested_count}, Not digested: {result.not_space_digested_count}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get learning status\nconst result = await client.sessions.getLearningStatus('session-uuid');\nconsole.log(`Space digested: ${result.space_digested_count}, Not digested: ${result.not_space_digested_count}`);\n","label":"JavaScript"}]
 func (h *SessionHandler) GetLearningStatus(c *gin.Context) {
@@ -621,6 +2587,9 @@ type TokenCountsResp struct {
 //	@Param			session_id	path	string	true	"Session ID"	format(uuid)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.TokenCountsResp}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/session/{session_id}/token_counts [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get token counts\nresult = client.sessions.get_token_counts(session_id='session-uuid')\nprint(f\"Total tokens: {result.total_tokens}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get token counts\nconst result = await client.sessions.getTokenCounts('session-uuid');\nconsole.log(`Total tokens: ${result.total_tokens}`);\n","label":"JavaScript"}]
 func (h *SessionHandler) GetTokenCounts(c *gin.Context) {
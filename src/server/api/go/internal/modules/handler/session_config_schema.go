@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type SessionConfigSchemaHandler struct {
+	svc service.SessionConfigSchemaService
+}
+
+func NewSessionConfigSchemaHandler(s service.SessionConfigSchemaService) *SessionConfigSchemaHandler {
+	return &SessionConfigSchemaHandler{svc: s}
+}
+
+// GetSessionConfigSchema godoc
+//
+//	@Summary		Get session config schema
+//	@Description	Get the JSON Schema the session configs of the project are validated against. Data is null when configs are not validated.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.SessionConfigSchema}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/session_config_schema [get]
+func (h *SessionConfigSchemaHandler) GetSessionConfigSchema(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.Get(c.Request.Context(), project)})
+}
+
+type UpdateSessionConfigSchemaReq struct {
+	// Schema replaces the session config schema of the project, null stops validating session configs
+	Schema *model.SessionConfigSchema `json:"schema"`
+}
+
+// UpdateSessionConfigSchema godoc
+//
+//	@Summary		Update session config schema
+//	@Description	Register a JSON Schema for the configs of the sessions of the project. POST /session and PUT /session/{session_id}/configs refuse with 400 configs that do not match it, listing every violation. In strict mode, keys of an object that its schema does not declare in properties are refused too, with the closest declared key as a suggestion, unless additionalProperties, patternProperties or unevaluatedProperties allow them; objects composed with allOf, anyOf or oneOf are not made strict. The schema is JSON Schema draft 2020-12 unless its $schema says otherwise, and may only $ref its own definitions. The configs of existing sessions are not checked again. A null schema stops validating.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateSessionConfigSchemaReq	true	"UpdateSessionConfigSchema payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.SessionConfigSchema}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/session_config_schema [put]
+func (h *SessionConfigSchemaHandler) UpdateSessionConfigSchema(c *gin.Context) {
+	req := UpdateSessionConfigSchemaReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Schema)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSessionConfigSchema) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/service"
@@ -38,6 +44,53 @@ func (m *MockSessionService) Delete(ctx context.Context, projectID uuid.UUID, se
 	return args.Error(0)
 }
 
+func (m *MockSessionService) Export(ctx context.Context, in service.ExportSessionInput, fn func(batch *service.SessionExport) error) (int, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return 0, args.Error(1)
+	}
+	batch := args.Get(0).(*service.SessionExport)
+	if err := fn(batch); err != nil {
+		return 0, err
+	}
+	return len(batch.Messages), args.Error(1)
+}
+
+func (m *MockSessionService) Archive(ctx context.Context, in service.ArchiveSessionsInput, w io.Writer) (int, error) {
+	args := m.Called(ctx, in)
+	if zip := args.String(0); zip != "" {
+		if _, err := io.WriteString(w, zip); err != nil {
+			return 0, err
+		}
+	}
+	return len(in.SessionIDs), args.Error(1)
+}
+
+func (m *MockSessionService) SampleMessages(ctx context.Context, in service.SampleMessagesInput) (*service.MessageSample, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.MessageSample), args.Error(1)
+}
+
+func (m *MockSessionService) HandleScheduledDelivery(ctx context.Context, body []byte) error {
+	args := m.Called(ctx, body)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) BulkDelete(ctx context.Context, in service.BulkDeleteSessionsInput) (*service.BulkDeleteSessionsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	out := args.Get(0).(*service.BulkDeleteSessionsOutput)
+	if in.OnProgress != nil {
+		in.OnProgress(*out)
+	}
+	return out, args.Error(1)
+}
+
 func (m *MockSessionService) UpdateByID(ctx context.Context, s *model.Session) error {
 	args := m.Called(ctx, s)
 	return args.Error(0)
@@ -59,6 +112,14 @@ func (m *MockSessionService) SendMessage(ctx context.Context, in service.SendMes
 	return args.Get(0).(*model.Message), args.Error(1)
 }
 
+func (m *MockSessionService) SendTurn(ctx context.Context, in service.SendTurnInput) (*service.SendTurnOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SendTurnOutput), args.Error(1)
+}
+
 func (m *MockSessionService) GetMessages(ctx context.Context, in service.GetMessagesInput) (*service.GetMessagesOutput, error) {
 	args := m.Called(ctx, in)
 	if args.Get(0) == nil {
@@ -83,6 +144,118 @@ func (m *MockSessionService) GetAllMessages(ctx context.Context, sessionID uuid.
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
+func (m *MockSessionService) GetMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error) {
+	args := m.Called(ctx, messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionService) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	args := m.Called(ctx, sessionID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Message), args.Error(1)
+}
+
+func (m *MockSessionService) Fork(ctx context.Context, in service.ForkSessionInput) (*model.Session, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionService) GetMessageTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*service.MessageTree, error) {
+	args := m.Called(ctx, projectID, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.MessageTree), args.Error(1)
+}
+
+func (m *MockSessionService) DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (*service.DeleteMessageOutput, error) {
+	args := m.Called(ctx, projectID, sessionID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.DeleteMessageOutput), args.Error(1)
+}
+
+func (m *MockSessionService) CheckMessageChains(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*service.MessageChainReport, error) {
+	args := m.Called(ctx, projectID, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.MessageChainReport), args.Error(1)
+}
+
+func (m *MockSessionService) GetUsage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*service.SessionUsage, error) {
+	args := m.Called(ctx, projectID, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SessionUsage), args.Error(1)
+}
+
+func (m *MockSessionService) GetContextWindow(ctx context.Context, in service.GetContextWindowInput) (*service.ContextWindow, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ContextWindow), args.Error(1)
+}
+
+func (m *MockSessionService) UpdateMetadata(ctx context.Context, in service.UpdateSessionMetadataInput) (*model.Session, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionService) SetArchived(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, archived bool) (*model.Session, error) {
+	args := m.Called(ctx, projectID, sessionID, archived)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionService) ExpandPart(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, index int) (*service.ExpandedPart, error) {
+	args := m.Called(ctx, projectID, sessionID, messageID, index)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ExpandedPart), args.Error(1)
+}
+
+func (m *MockSessionService) Supersede(ctx context.Context, in service.SupersedeMessageInput) (*model.Message, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Message), args.Error(1)
+}
+
+func (m *MockSessionService) GetSummary(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*service.SessionSummary, error) {
+	args := m.Called(ctx, projectID, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SessionSummary), args.Error(1)
+}
+
+func (m *MockSessionService) ListEvents(ctx context.Context, in service.ListSessionEventsInput) (*service.ListSessionEventsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListSessionEventsOutput), args.Error(1)
+}
+
 func setupSessionRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -169,6 +342,38 @@ func TestSessionHandler_GetSessions(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:        "successful sessions retrieval - filter by end_user_id",
+			queryParams: "?end_user_id=user_123",
+			setup: func(svc *MockSessionService) {
+				svc.On("List", mock.Anything, mock.MatchedBy(func(in service.ListSessionsInput) bool {
+					return in.EndUserID == "user_123"
+				})).Return(&service.ListSessionsOutput{Items: []model.Session{{ID: uuid.New(), ProjectID: projectID, EndUserID: "user_123"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "successful sessions retrieval - filter by configs",
+			queryParams: "?configs.model=gpt-4o&configs.flags.beta=true",
+			setup: func(svc *MockSessionService) {
+				svc.On("List", mock.Anything, mock.MatchedBy(func(in service.ListSessionsInput) bool {
+					return len(in.Configs) == 2 && in.Configs["model"] == "gpt-4o" && in.Configs["flags.beta"] == "true"
+				})).Return(&service.ListSessionsOutput{Items: []model.Session{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid config filter",
+			queryParams:    "?configs..model=gpt-4o",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repeated config filter",
+			queryParams:    "?configs.model=gpt-4o&configs.model=gpt-4",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:        "empty sessions list",
 			queryParams: "",
@@ -200,7 +405,7 @@ func TestSessionHandler_GetSessions(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.GET("/session", func(c *gin.Context) {
 				project := &model.Project{ID: projectID}
@@ -289,7 +494,7 @@ func TestSessionHandler_CreateSession(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.POST("/session", func(c *gin.Context) {
 				// Simulate middleware setting project information
@@ -350,7 +555,7 @@ func TestSessionHandler_DeleteSession(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.DELETE("/session/:session_id", func(c *gin.Context) {
 				project := &model.Project{ID: projectID}
@@ -422,9 +627,12 @@ func TestSessionHandler_UpdateConfigs(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
-			router.PUT("/session/:session_id/configs", handler.UpdateConfigs)
+			router.PUT("/session/:session_id/configs", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: uuid.New()})
+				handler.UpdateConfigs(c)
+			})
 
 			body, _ := sonic.Marshal(tt.requestBody)
 			req := httptest.NewRequest("PUT", "/session/"+tt.sessionIDParam+"/configs", bytes.NewBuffer(body))
@@ -483,7 +691,7 @@ func TestSessionHandler_GetConfigs(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.GET("/session/:session_id/configs", handler.GetConfigs)
 
@@ -558,7 +766,7 @@ func TestSessionHandler_ConnectToSpace(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.POST("/session/:session_id/connect_to_space", handler.ConnectToSpace)
 
@@ -1873,7 +2081,7 @@ func TestSessionHandler_SendMessage(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.POST("/session/:session_id/messages", func(c *gin.Context) {
 				project := &model.Project{ID: projectID}
@@ -1894,6 +2102,155 @@ func TestSessionHandler_SendMessage(t *testing.T) {
 	}
 }
 
+func TestSessionHandler_StreamMessage(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		query          string
+		body           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "sse deltas assembled into one text part",
+			sessionIDParam: sessionID.String(),
+			body:           "data: {\"delta\":\"Hel\"}\n\ndata: {\"delta\":\"lo\"}\n\ndata: [DONE]\n\n",
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.SessionID == sessionID &&
+						in.Role == "assistant" &&
+						len(in.Parts) == 1 &&
+						in.Parts[0].Text == "Hello" &&
+						in.MessageMeta["stream_incomplete"] == nil
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "usage from the last chunk",
+			sessionIDParam: sessionID.String(),
+			body: "data: {\"delta\":\"Hi\"}\n\n" +
+				"data: {\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":1,\"model\":\"gpt-4o\"}}\n\n" +
+				"data: [DONE]\n\n",
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.Usage == model.TokenUsage{PromptTokens: 12, CompletionTokens: 1, Model: "gpt-4o"}
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "ndjson with tool-call part and meta",
+			sessionIDParam: sessionID.String(),
+			query:          "?role=assistant",
+			body: "{\"delta\":\"Let me check\"}\n" +
+				"{\"part\":{\"type\":\"tool-call\",\"meta\":{\"name\":\"search\",\"arguments\":\"{}\"}}}\n" +
+				"{\"meta\":{\"model\":\"gpt-4o\"}}\n",
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return len(in.Parts) == 2 &&
+						in.Parts[0].Type == "text" &&
+						in.Parts[1].Type == "tool-call" &&
+						in.MessageMeta["model"] == "gpt-4o"
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid role",
+			sessionIDParam: sessionID.String(),
+			query:          "?role=tool",
+			body:           "data: {\"delta\":\"hi\"}\n",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid chunk",
+			sessionIDParam: sessionID.String(),
+			body:           "data: not-json\n",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty stream",
+			sessionIDParam: sessionID.String(),
+			body:           "data: [DONE]\n",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid session id",
+			sessionIDParam: "invalid-uuid",
+			body:           "data: {\"delta\":\"hi\"}\n",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages/stream", func(c *gin.Context) {
+				project := &model.Project{ID: projectID}
+				c.Set("project", project)
+				handler.StreamMessage(c)
+			})
+
+			req := httptest.NewRequest("POST", "/session/"+tt.sessionIDParam+"/messages/stream"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "text/event-stream")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReadMessageStream_Disconnect(t *testing.T) {
+	a := &messageStreamAssembler{}
+	body := io.MultiReader(bytes.NewBufferString("data: {\"delta\":\"partial\"}\n"), &failingReader{})
+
+	complete, err := readMessageStream(body, a)
+	a.flushText()
+
+	assert.False(t, complete)
+	assert.Error(t, err)
+	require.Len(t, a.parts, 1)
+	assert.Equal(t, "partial", a.parts[0].Text)
+}
+
+func TestReadMessageStream_Truncated(t *testing.T) {
+	t.Run("cut off last line keeps the chunks before it", func(t *testing.T) {
+		a := &messageStreamAssembler{}
+		complete, err := readMessageStream(bytes.NewBufferString("{\"delta\":\"partial\"}\n{\"delta\":\"out"), a)
+		a.flushText()
+
+		assert.False(t, complete)
+		assert.NoError(t, err)
+		require.Len(t, a.parts, 1)
+		assert.Equal(t, "partial", a.parts[0].Text)
+	})
+
+	t.Run("invalid line followed by more chunks", func(t *testing.T) {
+		a := &messageStreamAssembler{}
+		_, err := readMessageStream(bytes.NewBufferString("{\"delta\":\"a\"}\nnot json\n{\"delta\":\"b\"}\n"), a)
+		assert.ErrorIs(t, err, errInvalidStreamChunk)
+	})
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
 func TestSessionHandler_GetMessages(t *testing.T) {
 	sessionID := uuid.New()
 
@@ -2235,7 +2592,7 @@ func TestSessionHandler_GetMessages(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.GET("/session/:session_id/messages", handler.GetMessages)
 
@@ -2299,6 +2656,18 @@ func TestSessionHandler_SendMessage_Multipart(t *testing.T) {
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:           "multipart file contradicting its declared type",
+			sessionIDParam: sessionID.String(),
+			payload:        `{"format": "acontext", "blob": {"role": "user", "parts": [{"type": "image", "file_field": "image_file"}]}}`,
+			files: map[string]string{
+				"image_file": "not an image",
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("upload image_file failed: %w", blob.ErrMIMEMismatch))
+			},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
 		{
 			name:           "multipart with invalid JSON payload",
 			sessionIDParam: sessionID.String(),
@@ -2425,7 +2794,7 @@ func TestSessionHandler_SendMessage_Multipart(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.POST("/session/:session_id/messages", func(c *gin.Context) {
 				project := &model.Project{ID: projectID}
@@ -2471,7 +2840,7 @@ func TestSessionHandler_SendMessage_InvalidJSON(t *testing.T) {
 		mockService := &MockSessionService{}
 		// No setup needed as the request should fail before reaching the service
 
-		handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+		handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 		router := setupSessionRouter()
 		router.POST("/session/:session_id/messages", func(c *gin.Context) {
 			project := &model.Project{ID: projectID}
@@ -2529,7 +2898,7 @@ func TestOpenAI_ToolCalls_FieldPreservation(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -2684,7 +3053,7 @@ func TestOpenAIToAnthropic_FieldMapping(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -2808,7 +3177,7 @@ func TestAnthropicToOpenAI_FieldMapping(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -2914,7 +3283,7 @@ func TestToolResult_OpenAIToAnthropic(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -3027,7 +3396,7 @@ func TestToolResult_AnthropicToOpenAI(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -3125,7 +3494,7 @@ func TestAnthropic_CacheControl_Preservation(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -3251,7 +3620,7 @@ func TestMultipleToolCalls_Conversion(t *testing.T) {
 		HasMore: false,
 	}, nil)
 
-	handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 	router := setupSessionRouter()
 
 	router.POST("/session/:session_id/messages", func(c *gin.Context) {
@@ -3507,7 +3876,7 @@ func TestSessionHandler_GetTokenCounts(t *testing.T) {
 			mockService := &MockSessionService{}
 			tt.setup(mockService)
 
-			handler := NewSessionHandler(mockService, getMockSessionCoreClient())
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
 			router := setupSessionRouter()
 			router.GET("/session/:session_id/token_counts", handler.GetTokenCounts)
 
@@ -3541,3 +3910,2004 @@ func TestSessionHandler_GetTokenCounts(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionHandler_SendMessage_ParentID(t *testing.T) {
+	sessionID := uuid.New()
+	parentID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		parentID       string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:     "branch from parent",
+			parentID: parentID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.ParentID != nil && *in.ParentID == parentID
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, ParentID: &parentID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid parent id",
+			parentID:       "not-a-uuid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "parent not in session",
+			parentID: parentID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.Anything).Return(nil, service.ErrParentMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:     "duplicate of the parent",
+			parentID: parentID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.Anything).Return(nil, service.ErrDuplicateMessage)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendMessage(c)
+			})
+
+			body, _ := sonic.Marshal(map[string]interface{}{
+				"blob":      map[string]interface{}{"role": "user", "content": "hi"},
+				"parent_id": tt.parentID,
+			})
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SendTurn(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	turn := []interface{}{
+		map[string]interface{}{"blob": map[string]interface{}{"role": "user", "content": "what is 6*7?"}},
+		map[string]interface{}{"blob": map[string]interface{}{"role": "tool", "tool_call_id": "call_1", "content": "42"}},
+		map[string]interface{}{
+			"blob":  map[string]interface{}{"role": "assistant", "content": "42"},
+			"usage": map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 2},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		body           map[string]interface{}
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "stores the turn",
+			body: map[string]interface{}{"messages": turn},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendTurn", mock.Anything, mock.MatchedBy(func(in service.SendTurnInput) bool {
+					return in.SessionID == sessionID && len(in.Messages) == 3 &&
+						in.Messages[1].Role == "user" && in.Messages[1].Parts[0].Type == "tool-result" &&
+						in.Messages[2].Usage.PromptTokens == 10
+				})).Return(&service.SendTurnOutput{TurnID: uuid.New()}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "empty turn",
+			body:           map[string]interface{}{"messages": []interface{}{}},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid message",
+			body:           map[string]interface{}{"messages": []interface{}{map[string]interface{}{"blob": map[string]interface{}{"role": "nobody"}}}},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "gemini inline file",
+			body: map[string]interface{}{"format": "gemini", "messages": []interface{}{
+				map[string]interface{}{"blob": map[string]interface{}{"role": "user", "parts": []interface{}{
+					map[string]interface{}{"text": "what is in this picture?"},
+					map[string]interface{}{"inlineData": map[string]interface{}{"mimeType": "image/png", "data": "aGVsbG8="}},
+				}}},
+			}},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendTurn", mock.Anything, mock.MatchedBy(func(in service.SendTurnInput) bool {
+					return len(in.Messages) == 1 && len(in.Messages[0].Parts) == 2 && in.Messages[0].Parts[1].Type == "image"
+				})).Return(&service.SendTurnOutput{TurnID: uuid.New()}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "file upload",
+			body: map[string]interface{}{"format": "acontext", "messages": []interface{}{
+				map[string]interface{}{"blob": map[string]interface{}{"role": "user", "parts": []interface{}{
+					map[string]interface{}{"type": "image", "file_field": "photo"},
+				}}},
+			}},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "parent not in session",
+			body: map[string]interface{}{"messages": turn, "parent_id": uuid.New().String()},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendTurn", mock.Anything, mock.Anything).Return(nil, service.ErrParentMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "duplicate of the parent",
+			body: map[string]interface{}{"messages": turn},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendTurn", mock.Anything, mock.Anything).Return(nil, service.ErrDuplicateMessage)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/turns", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendTurn(c)
+			})
+
+			body, _ := sonic.Marshal(tt.body)
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/turns", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SendTurn_Quota(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	turn := []interface{}{
+		map[string]interface{}{"blob": map[string]interface{}{"role": "user", "content": "hi"}},
+		map[string]interface{}{"blob": map[string]interface{}{"role": "assistant", "content": "hello"}},
+	}
+
+	tests := []struct {
+		name           string
+		setup          func(*MockQuotaService, *MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "turn fits",
+			setup: func(quota *MockQuotaService, svc *MockSessionService) {
+				quota.On("CheckMessages", mock.Anything, project, mock.Anything, int64(2)).Return(nil)
+				quota.On("CheckStorage", mock.Anything, project, mock.MatchedBy(func(n int64) bool { return n > 0 })).Return(nil)
+				svc.On("SendTurn", mock.Anything, mock.Anything).Return(&service.SendTurnOutput{TurnID: uuid.New()}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "messages do not fit",
+			setup: func(quota *MockQuotaService, svc *MockSessionService) {
+				retryAfter := int64(60)
+				quota.On("CheckMessages", mock.Anything, project, mock.Anything, int64(2)).
+					Return(&service.QuotaExceededError{Quota: service.QuotaMessages, Limit: 10, Used: 9, Requested: 2, RetryAfterSec: &retryAfter})
+			},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "blobs do not fit",
+			setup: func(quota *MockQuotaService, svc *MockSessionService) {
+				quota.On("CheckMessages", mock.Anything, project, mock.Anything, int64(2)).Return(nil)
+				quota.On("CheckStorage", mock.Anything, project, mock.Anything).
+					Return(&service.QuotaExceededError{Quota: service.QuotaStorage, Limit: 10, Used: 9, Requested: 80})
+			},
+			expectedStatus: http.StatusPaymentRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota := &MockQuotaService{}
+			mockService := &MockSessionService{}
+			tt.setup(quota, mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, quota, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/turns", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendTurn(c)
+			})
+
+			body, _ := sonic.Marshal(map[string]interface{}{"messages": turn})
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/turns", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			quota.AssertExpectations(t)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SendTurn_Limits(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	turn := []interface{}{
+		map[string]interface{}{"blob": map[string]interface{}{"role": "user", "content": "hi"}},
+		map[string]interface{}{"blob": map[string]interface{}{"role": "assistant", "content": "hello"}},
+	}
+	usage := &service.EntityLimit{Limit: service.LimitMessagesPerSession, Used: 8, Soft: 8, Hard: 10}
+
+	tests := []struct {
+		name           string
+		usage          *service.EntityLimit
+		err            error
+		expectedStatus int
+		wantWarning    string
+	}{
+		{"under the soft limit", nil, nil, http.StatusCreated, ""},
+		{"soft limit", usage, nil, http.StatusCreated, "messages_per_session; used=8; soft=8; hard=10"},
+		{"turn over the hard limit", nil, &service.LimitExceededError{EntityLimit: *usage, Requested: 2}, http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := &MockEntityLimitService{}
+			limits.On("CheckSessionMessages", mock.Anything, sessionID, int64(2)).Return(tt.usage, tt.err)
+			mockService := &MockSessionService{}
+			if tt.err == nil {
+				mockService.On("SendTurn", mock.Anything, mock.Anything).Return(&service.SendTurnOutput{TurnID: uuid.New()}, nil)
+			}
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, limits)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/turns", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendTurn(c)
+			})
+
+			body, _ := sonic.Marshal(map[string]interface{}{"messages": turn})
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/turns", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.wantWarning, w.Header().Get(limitWarningHeader))
+			limits.AssertExpectations(t)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SendMessage_Usage(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		format         string
+		blob           map[string]interface{}
+		usage          map[string]interface{}
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:   "openai message with usage",
+			format: "openai",
+			blob:   map[string]interface{}{"role": "assistant", "content": "hello"},
+			usage:  map[string]interface{}{"prompt_tokens": 100, "completion_tokens": 20, "model": "gpt-4.1"},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.Usage == model.TokenUsage{PromptTokens: 100, CompletionTokens: 20, Model: "gpt-4.1"}
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "anthropic message with usage",
+			format: "anthropic",
+			blob:   map[string]interface{}{"role": "assistant", "content": "hello"},
+			usage:  map[string]interface{}{"prompt_tokens": 7, "completion_tokens": 3, "model": "claude-sonnet-4"},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.Usage.PromptTokens == 7 && in.Usage.Model == "claude-sonnet-4"
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "without usage",
+			format: "openai",
+			blob:   map[string]interface{}{"role": "user", "content": "hi"},
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.Usage == model.TokenUsage{}
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "negative token count",
+			format:         "openai",
+			blob:           map[string]interface{}{"role": "user", "content": "hi"},
+			usage:          map[string]interface{}{"prompt_tokens": -1},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendMessage(c)
+			})
+
+			payload := map[string]interface{}{"format": tt.format, "blob": tt.blob}
+			if tt.usage != nil {
+				payload["usage"] = tt.usage
+			}
+			body, _ := sonic.Marshal(payload)
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+
+	t.Run("multipart usage field", func(t *testing.T) {
+		mockService := &MockSessionService{}
+		mockService.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+			return in.Usage == model.TokenUsage{PromptTokens: 12, CompletionTokens: 4, Model: "gpt-4.1"}
+		})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+		handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+		router := setupSessionRouter()
+		router.POST("/session/:session_id/messages", func(c *gin.Context) {
+			c.Set("project", project)
+			handler.SendMessage(c)
+		})
+
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		require.NoError(t, mw.WriteField("payload", `{"format": "openai", "blob": {"role": "assistant", "content": "hello"}}`))
+		require.NoError(t, mw.WriteField("usage", `{"prompt_tokens": 12, "completion_tokens": 4, "model": "gpt-4.1"}`))
+		require.NoError(t, mw.Close())
+
+		req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+type fakePostIngest struct {
+	events []service.SendMQPublishJSON
+}
+
+func (f *fakePostIngest) Run(ctx context.Context, ev service.SendMQPublishJSON) []service.ProcessorResult {
+	f.events = append(f.events, ev)
+	return []service.ProcessorResult{{Name: "space_sync", Status: service.ProcessorStatusOK}}
+}
+
+func (f *fakePostIngest) HandleDelivery(ctx context.Context, processor string, body []byte) error {
+	return nil
+}
+
+func (f *fakePostIngest) Status(ctx context.Context, messageIDs []uuid.UUID) ([]service.MessageProcessing, error) {
+	out := make([]service.MessageProcessing, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		out = append(out, service.MessageProcessing{MessageID: id, Processors: map[string]string{"space_sync": "done"}, Complete: true})
+	}
+	return out, nil
+}
+
+func TestSessionHandler_SendMessage_Sync(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		query          string
+		wantProcessors bool
+	}{
+		{name: "async by default", query: ""},
+		{name: "sync runs processors", query: "?sync=true", wantProcessors: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			mockService.On("SendMessage", mock.Anything, mock.Anything).Return(&model.Message{ID: messageID, SessionID: sessionID}, nil)
+			postIngest := &fakePostIngest{}
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, postIngest, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendMessage(c)
+			})
+
+			body, _ := sonic.Marshal(map[string]interface{}{
+				"blob": map[string]interface{}{"role": "user", "content": "hi"},
+			})
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages"+tt.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusCreated, w.Code)
+			var resp struct {
+				Data struct {
+					ID         uuid.UUID                 `json:"id"`
+					Processors []service.ProcessorResult `json:"processors"`
+				} `json:"data"`
+			}
+			require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, messageID, resp.Data.ID)
+			if tt.wantProcessors {
+				require.Len(t, postIngest.events, 1)
+				assert.Equal(t, service.SendMQPublishJSON{ProjectID: project.ID, SessionID: sessionID, MessageID: messageID}, postIngest.events[0])
+				require.Len(t, resp.Data.Processors, 1)
+				assert.Equal(t, "space_sync", resp.Data.Processors[0].Name)
+			} else {
+				assert.Empty(t, postIngest.events)
+				assert.Nil(t, resp.Data.Processors)
+			}
+		})
+	}
+}
+
+func TestSessionHandler_GetSessionUsage(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetUsage", mock.Anything, project.ID, sessionID).Return(&service.SessionUsage{PromptTokens: 10, TotalTokens: 10}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid session id",
+			sessionIDParam: "invalid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "session of another project",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetUsage", mock.Anything, project.ID, sessionID).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "service layer error",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetUsage", mock.Anything, project.ID, sessionID).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/usage", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.GetSessionUsage(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+tt.sessionIDParam+"/usage", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetContextWindow(t *testing.T) {
+	sessionID := uuid.New()
+	window := &service.ContextWindow{
+		Messages: []model.Message{
+			{ID: uuid.New(), SessionID: sessionID, Role: "user", Parts: []model.Part{{Type: "text", Text: "hi"}}},
+		},
+		Tokens:        1,
+		TotalMessages: 1,
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetContextWindow", mock.Anything, mock.MatchedBy(func(in service.GetContextWindowInput) bool {
+					return in.SessionID == sessionID && in.MaxTokens == 8000 && in.Strategy == service.ContextStrategyRecent
+				})).Return(window, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "summary strategy in anthropic format",
+			query: "?max_tokens=2000&strategy=summary&format=anthropic",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetContextWindow", mock.Anything, mock.MatchedBy(func(in service.GetContextWindowInput) bool {
+					return in.MaxTokens == 2000 && in.Strategy == service.ContextStrategySummary
+				})).Return(window, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown strategy",
+			query:          "?strategy=oldest",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid budget",
+			query:          "?max_tokens=0",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "budget smaller than system messages",
+			query: "?max_tokens=10",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetContextWindow", mock.Anything, mock.Anything).Return(nil, service.ErrContextBudgetTooSmall)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/context", handler.GetContextWindow)
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/context"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_BulkDeleteSessions(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	spaceID := uuid.New()
+	result := &service.BulkDeleteSessionsOutput{Total: 1, Deleted: 1, Batches: 1, NotFound: []uuid.UUID{}, Failed: []uuid.UUID{}}
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+		expectedLines  int
+	}{
+		{
+			name: "by ids",
+			body: `{"session_ids":["` + sessionID.String() + `"]}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("BulkDelete", mock.Anything, mock.MatchedBy(func(in service.BulkDeleteSessionsInput) bool {
+					return in.ProjectID == projectID && len(in.SessionIDs) == 1 && in.SpaceID == nil && in.OnProgress == nil
+				})).Return(result, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  1,
+		},
+		{
+			name: "by space with progress",
+			body: `{"space_id":"` + spaceID.String() + `","stream":true}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("BulkDelete", mock.Anything, mock.MatchedBy(func(in service.BulkDeleteSessionsInput) bool {
+					return in.SpaceID != nil && *in.SpaceID == spaceID && in.OnProgress != nil
+				})).Return(result, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  2,
+		},
+		{
+			name:           "ids and space",
+			body:           `{"session_ids":["` + sessionID.String() + `"],"space_id":"` + spaceID.String() + `"}`,
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "nothing to delete",
+			body:           `{}`,
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "service error",
+			body: `{"session_ids":["` + sessionID.String() + `"]}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("BulkDelete", mock.Anything, mock.Anything).Return(nil, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/bulk_delete", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.BulkDeleteSessions(c)
+			})
+
+			req := httptest.NewRequest("POST", "/session/bulk_delete", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLines > 0 {
+				assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), tt.expectedLines)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_BulkDeleteSessions_TracksTask(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	task := &model.Task{ID: uuid.New(), ProjectID: projectID, Kind: model.TaskKindBulkDelete}
+
+	mockService := &MockSessionService{}
+	mockService.On("BulkDelete", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(1).(service.BulkDeleteSessionsInput).OnProgress(service.BulkDeleteSessionsOutput{Total: 1, Batches: 1, Failed: []uuid.UUID{sessionID}, Error: "db down"})
+	}).Return(&service.BulkDeleteSessionsOutput{Total: 1, Batches: 1, NotFound: []uuid.UUID{}, Failed: []uuid.UUID{sessionID}, Error: "db down"}, nil)
+
+	tasks := &MockTaskService{}
+	tasks.On("StartJob", mock.Anything, projectID, model.TaskKindBulkDelete, map[string]interface{}{"sessions": 1}).Return(task)
+	tasks.On("UpdateJob", mock.Anything, task, model.TaskStatusRunning, mock.Anything).Return()
+	tasks.On("FinishJob", mock.Anything, task, errors.New("db down"), mock.MatchedBy(func(data map[string]interface{}) bool {
+		return data["failed"] == 1 && data["deleted"] == 0
+	})).Return()
+
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, tasks, nil, nil)
+	router := setupSessionRouter()
+	router.POST("/session/bulk_delete", func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+		handler.BulkDeleteSessions(c)
+	})
+
+	req := httptest.NewRequest("POST", "/session/bulk_delete", strings.NewReader(`{"session_ids":["`+sessionID.String()+`"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+	tasks.AssertExpectations(t)
+}
+
+func TestSessionHandler_ExportSession(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	export := &service.SessionExport{Messages: []model.Message{
+		{ID: uuid.New(), SessionID: sessionID, Role: "system", Parts: []model.Part{{Type: "text", Text: "be brief"}}},
+		{ID: uuid.New(), SessionID: sessionID, Role: "user", Parts: []model.Part{{Type: "text", Text: "hi"}}},
+		{ID: uuid.New(), SessionID: sessionID, Role: "assistant", Parts: []model.Part{{Type: "text", Text: "hello"}}},
+	}}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+		expectedLines  int
+		expectedBody   string
+	}{
+		{
+			name:  "jsonl",
+			query: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.MatchedBy(func(in service.ExportSessionInput) bool {
+					return in.ProjectID == projectID && in.SessionID == sessionID && in.WithAssetPublicURL
+				})).Return(export, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  3,
+			expectedBody:   `"role":"assistant"`,
+		},
+		{
+			name:  "openai fine-tune",
+			query: "?format=openai-finetune",
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.Anything).Return(export, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  1,
+			expectedBody:   `{"messages":[`,
+		},
+		{
+			name:  "anthropic",
+			query: "?format=anthropic",
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.Anything).Return(export, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  1,
+			expectedBody:   `"system":"be brief"`,
+		},
+		{
+			name:           "unknown format",
+			query:          "?format=csv",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "session not found",
+			query: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.Anything).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:  "resume after a message",
+			query: "?after_message_id=" + export.Messages[0].ID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.MatchedBy(func(in service.ExportSessionInput) bool {
+					return in.AfterMessageID != nil && *in.AfterMessageID == export.Messages[0].ID
+				})).Return(&service.SessionExport{Messages: export.Messages[1:]}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedLines:  2,
+			expectedBody:   `"role":"user"`,
+		},
+		{
+			name:  "unknown resume cursor",
+			query: "?after_message_id=" + uuid.New().String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("Export", mock.Anything, mock.Anything).Return(nil, service.ErrExportCursorNotFound)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "resume cursor with a provider format",
+			query:          "?format=anthropic&after_message_id=" + uuid.New().String(),
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/export", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.ExportSession(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLines > 0 {
+				assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), tt.expectedLines)
+				assert.Contains(t, w.Body.String(), tt.expectedBody)
+				assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ArchiveSessions(t *testing.T) {
+	projectID := uuid.New()
+	a, b := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name             string
+		path             string
+		setup            func(*MockSessionService)
+		expectedStatus   int
+		expectedFilename string
+	}{
+		{
+			name: "sessions",
+			path: "/session/archive?session_ids=" + a.String() + "," + b.String() + "," + a.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("Archive", mock.Anything, service.ArchiveSessionsInput{ProjectID: projectID, SessionIDs: []uuid.UUID{a, b}}).Return("PK", nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedFilename: "sessions-archive.zip",
+		},
+		{
+			name: "export format of a session",
+			path: "/session/" + a.String() + "/export?format=archive",
+			setup: func(svc *MockSessionService) {
+				svc.On("Archive", mock.Anything, service.ArchiveSessionsInput{ProjectID: projectID, SessionIDs: []uuid.UUID{a}}).Return("PK", nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedFilename: "session-" + a.String() + "-archive.zip",
+		},
+		{
+			name: "session not found",
+			path: "/session/archive?session_ids=" + a.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("Archive", mock.Anything, mock.Anything).Return("", service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "failure after the download started",
+			path: "/session/archive?session_ids=" + a.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("Archive", mock.Anything, mock.Anything).Return("PK", errors.New("s3 is down"))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedFilename: "sessions-archive.zip",
+		},
+		{
+			name:           "no sessions",
+			path:           "/session/archive",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid session id",
+			path:           "/session/archive?session_ids=" + a.String() + ",nope",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too many sessions",
+			path:           "/session/archive?session_ids=" + strings.Repeat(a.String()+",", 50) + a.String(),
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+			})
+			router.GET("/session/archive", handler.ArchiveSessions)
+			router.GET("/session/:session_id/export", handler.ExportSession)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedFilename != "" {
+				assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Header().Get("Content-Disposition"), tt.expectedFilename)
+				assert.Equal(t, "PK", w.Body.String())
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetSessionWindow(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New(), Configs: map[string]interface{}{
+		model.ProjectWindowPresetsConfigKey: []interface{}{
+			map[string]interface{}{"name": "short", "strategy": "summary", "max_tokens": float64(500), "max_turns": float64(2), "format": "gemini"},
+		},
+	}}
+	window := &service.ContextWindow{
+		Messages: []model.Message{
+			{ID: uuid.New(), SessionID: sessionID, Role: "user", Parts: []model.Part{{Type: "text", Text: "hi"}}},
+		},
+		Tokens:        1,
+		TotalMessages: 1,
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "built-in preset",
+			path: "/window/last-10-turns-plus-pins",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetContextWindow", mock.Anything, mock.MatchedBy(func(in service.GetContextWindowInput) bool {
+					return in.SessionID == sessionID && in.MaxTurns == 10 && in.KeepPinned && in.Strategy == service.ContextStrategyRecent
+				})).Return(window, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "project preset with format override",
+			path: "/window/short?format=anthropic",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetContextWindow", mock.Anything, mock.MatchedBy(func(in service.GetContextWindowInput) bool {
+					return in.MaxTokens == 500 && in.MaxTurns == 2 && in.Strategy == service.ContextStrategySummary
+				})).Return(window, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown preset",
+			path:           "/window/missing",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid format override",
+			path:           "/window/recent?format=xml",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/window/:preset", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.GetSessionWindow(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if w.Code == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"preset"`)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetMessageTree(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessageTree", mock.Anything, project.ID, sessionID).Return(&service.MessageTree{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid session id",
+			sessionIDParam: "invalid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "session of another project",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessageTree", mock.Anything, project.ID, sessionID).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "service layer error",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessageTree", mock.Anything, project.ID, sessionID).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/messages/tree", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.GetMessageTree(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+tt.sessionIDParam+"/messages/tree", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ForkSession(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "fork with messages by default",
+			body: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("Fork", mock.Anything, service.ForkSessionInput{ProjectID: project.ID, SessionID: sessionID, WithMessages: true}).
+					Return(&model.Session{ID: uuid.New(), ProjectID: project.ID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "fork up to a message",
+			body: `{"message_id": "` + messageID.String() + `"}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("Fork", mock.Anything, service.ForkSessionInput{ProjectID: project.ID, SessionID: sessionID, WithMessages: true, UpToMessageID: &messageID}).
+					Return(&model.Session{ID: uuid.New(), ProjectID: project.ID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "fork configs only",
+			body: `{"with_messages": false}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("Fork", mock.Anything, service.ForkSessionInput{ProjectID: project.ID, SessionID: sessionID}).
+					Return(&model.Session{ID: uuid.New(), ProjectID: project.ID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid message id",
+			body:           `{"message_id": "invalid"}`,
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "session not found",
+			body: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("Fork", mock.Anything, mock.Anything).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/fork", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.ForkSession(c)
+			})
+
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/fork", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetSessionSummary(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetSummary", mock.Anything, project.ID, sessionID).Return(&service.SessionSummary{SessionID: sessionID, Summary: "user asked about billing"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid session id",
+			sessionIDParam: "invalid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "session not found",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetSummary", mock.Anything, project.ID, sessionID).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "service layer error",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetSummary", mock.Anything, project.ID, sessionID).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/summary", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.GetSessionSummary(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+tt.sessionIDParam+"/summary", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetSessionEvents(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		query          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			sessionIDParam: sessionID.String(),
+			query:          "?kind=config_changed&limit=5&time_desc=true",
+			setup: func(svc *MockSessionService) {
+				svc.On("ListEvents", mock.Anything, service.ListSessionEventsInput{
+					ProjectID: project.ID,
+					SessionID: sessionID,
+					Kind:      model.SessionEventConfigChanged,
+					Limit:     5,
+					TimeDesc:  true,
+				}).Return(&service.ListSessionEventsOutput{Items: []model.SessionEvent{{SessionID: sessionID, Kind: model.SessionEventConfigChanged}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid kind",
+			sessionIDParam: sessionID.String(),
+			query:          "?kind=renamed",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid session id",
+			sessionIDParam: "invalid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "session not found",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("ListEvents", mock.Anything, mock.Anything).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "service layer error",
+			sessionIDParam: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("ListEvents", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/events", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.GetSessionEvents(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+tt.sessionIDParam+"/events"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_UpdateMetadata(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"title":"Refund request","tags":["support"]}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("UpdateMetadata", mock.Anything, mock.MatchedBy(func(in service.UpdateSessionMetadataInput) bool {
+					return in.ProjectID == project.ID && in.SessionID == sessionID &&
+						in.Title != nil && *in.Title == "Refund request" && in.Description == nil &&
+						in.Tags != nil && len(*in.Tags) == 1
+				})).Return(&model.Session{ID: sessionID, ProjectID: project.ID, Title: "Refund request"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "title too long",
+			body:           `{"title":"` + strings.Repeat("a", 256) + `"}`,
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "session not found",
+			body: `{"description":"x"}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("UpdateMetadata", mock.Anything, mock.Anything).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "service layer error",
+			body: `{"tags":[]}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("UpdateMetadata", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.PUT("/session/:session_id/metadata", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.UpdateMetadata(c)
+			})
+
+			req := httptest.NewRequest("PUT", "/session/"+sessionID.String()+"/metadata", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ArchiveSession(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		path           string
+		sessionID      string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:      "archive",
+			path:      "archive",
+			sessionID: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SetArchived", mock.Anything, project.ID, sessionID, true).Return(&model.Session{ID: sessionID, IsArchived: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:      "unarchive",
+			path:      "unarchive",
+			sessionID: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SetArchived", mock.Anything, project.ID, sessionID, false).Return(&model.Session{ID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid session id",
+			path:           "archive",
+			sessionID:      "not-a-uuid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "session not found",
+			path:      "archive",
+			sessionID: sessionID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("SetArchived", mock.Anything, project.ID, sessionID, true).Return(nil, service.ErrSessionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/archive", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.ArchiveSession(c)
+			})
+			router.POST("/session/:session_id/unarchive", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.UnarchiveSession(c)
+			})
+
+			req := httptest.NewRequest("POST", "/session/"+tt.sessionID+"/"+tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ExpandMessagePart(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		index          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:  "archived output",
+			index: "1",
+			setup: func(svc *MockSessionService) {
+				svc.On("ExpandPart", mock.Anything, project.ID, sessionID, messageID, 1).Return(&service.ExpandedPart{MessageID: messageID, Index: 1, Type: "tool-result", Text: "full", Archived: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid index",
+			index:          "first",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "part not found",
+			index: "7",
+			setup: func(svc *MockSessionService) {
+				svc.On("ExpandPart", mock.Anything, project.ID, sessionID, messageID, 7).Return(nil, service.ErrPartNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/messages/:message_id/parts/:index/expand", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.ExpandMessagePart(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/messages/"+messageID.String()+"/parts/"+tt.index+"/expand", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SupersedeMessage(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	byID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "supersede",
+			body: `{"by":"` + byID.String() + `"}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("Supersede", mock.Anything, service.SupersedeMessageInput{ProjectID: project.ID, SessionID: sessionID, MessageID: messageID, By: byID}).
+					Return(&model.Message{ID: messageID, SupersededBy: &byID}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing by",
+			body:           `{}`,
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid supersession",
+			body: `{"by":"` + byID.String() + `"}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("Supersede", mock.Anything, mock.Anything).Return(nil, service.ErrInvalidSupersession)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "message not found",
+			body: `{"by":"` + byID.String() + `"}`,
+			setup: func(svc *MockSessionService) {
+				svc.On("Supersede", mock.Anything, mock.Anything).Return(nil, service.ErrMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages/:message_id/supersede", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SupersedeMessage(c)
+			})
+
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages/"+messageID.String()+"/supersede", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_DeleteMessage(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		messageParam   string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:         "delete",
+			messageParam: messageID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("DeleteMessage", mock.Anything, project.ID, sessionID, messageID).Return(&service.DeleteMessageOutput{RelinkedChildren: 1}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid message id",
+			messageParam:   "not-a-uuid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "message not found",
+			messageParam: messageID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("DeleteMessage", mock.Anything, project.ID, sessionID, messageID).Return(nil, service.ErrMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.DELETE("/session/:session_id/messages/:message_id", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.DeleteMessage(c)
+			})
+
+			req := httptest.NewRequest("DELETE", "/session/"+sessionID.String()+"/messages/"+tt.messageParam, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_CheckMessageChains(t *testing.T) {
+	project := &model.Project{ID: uuid.New()}
+	sessionID := uuid.New()
+	orphan := uuid.New()
+
+	mockService := &MockSessionService{}
+	mockService.On("CheckMessageChains", mock.Anything, project.ID, sessionID).Return(&service.MessageChainReport{
+		Messages: 2,
+		Roots:    []uuid.UUID{uuid.New()},
+		Orphans:  []uuid.UUID{orphan},
+	}, nil)
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/messages/consistency", func(c *gin.Context) {
+		c.Set("project", project)
+		handler.CheckMessageChains(c)
+	})
+
+	req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/messages/consistency", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), orphan.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestSessionHandler_GetMessages_ProcessingStatus(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	mockService := &MockSessionService{}
+	mockService.On("GetMessages", mock.Anything, mock.Anything).Return(&service.GetMessagesOutput{
+		Items: []model.Message{{
+			ID:        messageID,
+			SessionID: sessionID,
+			Role:      "user",
+			Parts:     []model.Part{{Type: "text", Text: "hi"}},
+		}},
+	}, nil)
+	handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, &fakePostIngest{}, nil, nil, nil)
+
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/messages", handler.GetMessages)
+
+	req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/messages?format=acontext", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			ProcessingStatus []service.MessageProcessing `json:"processing_status"`
+		} `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.ProcessingStatus, 1)
+	assert.Equal(t, messageID, resp.Data.ProcessingStatus[0].MessageID)
+	assert.True(t, resp.Data.ProcessingStatus[0].Complete)
+}
+
+func TestSessionHandler_GetMessages_Filters(t *testing.T) {
+	sessionID := uuid.New()
+	anchorID := uuid.New()
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:  "roles and part types",
+			query: "?roles=user,assistant&part_types=tool-call",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return assert.ObjectsAreEqual([]string{"user", "assistant"}, in.Roles) &&
+						assert.ObjectsAreEqual([]string{"tool-call"}, in.PartTypes)
+				})).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown role",
+			query:          "?roles=user,tool",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown part type",
+			query:          "?part_types=thinking",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "as of",
+			query: "?as_of=2025-01-01T12:00:00Z",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.AsOf.Equal(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+				})).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid as of",
+			query:          "?as_of=yesterday",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "anchor",
+			query: "?anchor_message_id=" + anchorID.String() + "&before=5",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.AnchorMessageID != nil && *in.AnchorMessageID == anchorID && in.Before == 5 && in.After == 10
+				})).Return(&service.GetMessagesOutput{Items: []model.Message{}, HasMoreBefore: true, PrevCursor: "prev"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "anchor with cursor",
+			query:          "?anchor_message_id=" + anchorID.String() + "&cursor=abc",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "unknown anchor",
+			query: "?anchor_message_id=" + anchorID.String(),
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.Anything).Return(nil, service.ErrMessageNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/messages", handler.GetMessages)
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/messages"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SampleMessages(t *testing.T) {
+	projectID := uuid.New()
+	sample := &service.MessageSample{
+		Stratify: service.SampleStratifyTag,
+		Pool:     2,
+		Strata:   []service.SampleStratum{{Key: "billing", Pool: 2, Sampled: 1}},
+		Items:    []service.SampledMessage{{Message: model.Message{ID: uuid.New(), Role: "assistant"}, Stratum: "billing"}},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("SampleMessages", mock.Anything, mock.MatchedBy(func(in service.SampleMessagesInput) bool {
+					return in.ProjectID == projectID && in.Size == 50 && in.Stratify == service.SampleStratifyNone && in.Bucket == "day"
+				})).Return(sample, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "stratified by tag",
+			query: "?size=10&stratify=tag&roles=assistant&since=2025-01-01T00:00:00Z",
+			setup: func(svc *MockSessionService) {
+				svc.On("SampleMessages", mock.Anything, mock.MatchedBy(func(in service.SampleMessagesInput) bool {
+					return in.Size == 10 && in.Stratify == service.SampleStratifyTag && len(in.Roles) == 1 && !in.Since.IsZero()
+				})).Return(sample, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown stratify",
+			query:          "?stratify=model",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "size too large",
+			query:          "?size=501",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "until before since",
+			query:          "?since=2025-02-01T00:00:00Z&until=2025-01-01T00:00:00Z",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "service error",
+			query: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("SampleMessages", mock.Anything, mock.Anything).Return(nil, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.GET("/project/messages/sample", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.SampleMessages(c)
+			})
+
+			req := httptest.NewRequest("GET", "/project/messages/sample"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"stratum":"billing"`)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SendMessage_DeliverAt(t *testing.T) {
+	sessionID := uuid.New()
+	project := &model.Project{ID: uuid.New()}
+	deliverAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name           string
+		query          string
+		deliverAt      string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:      "scheduled",
+			deliverAt: deliverAt.Format(time.RFC3339),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.DeliverAt.Equal(deliverAt)
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:      "past time sends now",
+			deliverAt: time.Now().Add(-time.Hour).Format(time.RFC3339),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.MatchedBy(func(in service.SendMessageInput) bool {
+					return in.DeliverAt.IsZero()
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "with sync",
+			query:          "?sync=true",
+			deliverAt:      deliverAt.Format(time.RFC3339),
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "too far",
+			deliverAt: deliverAt.Format(time.RFC3339),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.Anything).Return(nil, service.ErrDeliverAtTooFar)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "no message queue",
+			deliverAt: deliverAt.Format(time.RFC3339),
+			setup: func(svc *MockSessionService) {
+				svc.On("SendMessage", mock.Anything, mock.Anything).Return(nil, service.ErrScheduleUnavailable)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+			handler := NewSessionHandler(mockService, getMockSessionCoreClient(), config.UploadCfg{}, nil, nil, nil, nil)
+
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages", func(c *gin.Context) {
+				c.Set("project", project)
+				handler.SendMessage(c)
+			})
+
+			body, _ := sonic.Marshal(map[string]interface{}{
+				"blob":       map[string]interface{}{"role": "user", "content": "remind me"},
+				"deliver_at": tt.deliverAt,
+			})
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/messages"+tt.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusAccepted {
+				assert.Contains(t, w.Body.String(), `"deliver_at"`)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestValidateSessionConfigs(t *testing.T) {
+	project := &model.Project{}
+	assert.NoError(t, validateSessionConfigs(project, nil))
+	assert.NoError(t, validateSessionConfigs(project, map[string]interface{}{"mode": "chat"}))
+	assert.NoError(t, validateSessionConfigs(project, map[string]interface{}{"dedupe_window": float64(30)}))
+	assert.NoError(t, validateSessionConfigs(project, map[string]interface{}{"dedupe_window": float64(0)}))
+
+	assert.Error(t, validateSessionConfigs(project, map[string]interface{}{"dedupe_window": float64(-1)}))
+	assert.Error(t, validateSessionConfigs(project, map[string]interface{}{"dedupe_window": 1.5}))
+	assert.Error(t, validateSessionConfigs(project, map[string]interface{}{"dedupe_window": "30"}))
+
+	project.Configs = datatypes.JSONMap{model.ProjectSessionConfigSchemaKey: map[string]interface{}{
+		"schema": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"temperature": map[string]interface{}{"type": "number"}},
+		},
+		"strict": true,
+	}}
+	assert.NoError(t, validateSessionConfigs(project, map[string]interface{}{"temperature": 0.2}))
+	assert.ErrorIs(t, validateSessionConfigs(project, map[string]interface{}{"temprature": 0.2}), service.ErrInvalidSessionConfigs)
+}
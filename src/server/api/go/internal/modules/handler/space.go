@@ -2,8 +2,11 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
@@ -26,10 +29,15 @@ func NewSpaceHandler(s service.SpaceService, coreClient *httpclient.CoreClient)
 }
 
 type CreateSpaceReq struct {
-	Configs map[string]interface{} `form:"configs" json:"configs"`
+	Configs     map[string]interface{} `form:"configs" json:"configs"`
+	Name        string                 `form:"name" json:"name" binding:"max=255" example:"Support agent"`
+	Description string                 `form:"description" json:"description" binding:"max=2000"`
+	Tags        []string               `form:"tags" json:"tags" binding:"max=32,dive,max=64" example:"support,production"`
 }
 
 type GetSpacesReq struct {
+	Name     string `form:"name" json:"name" binding:"max=255" example:"support"`
+	Tag      string `form:"tag" json:"tag" example:"production"`
 	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
 	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
 	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
@@ -38,15 +46,20 @@ type GetSpacesReq struct {
 // GetSpaces godoc
 //
 //	@Summary		Get spaces
-//	@Description	Get all spaces under a project
+//	@Description	Get all spaces under a project, optionally filtered by name or tag
 //	@Tags			space
 //	@Accept			json
 //	@Produce		json
+//	@Param			name		query	string	false	"Only spaces whose name contains this text, case-insensitive"
+//	@Param			tag			query	string	false	"Only spaces with this tag"
 //	@Param			limit		query	integer	false	"Limit of spaces to return, default 20. Max 200."
 //	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
 //	@Param			time_desc	query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example:"false"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.ListSpacesOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List spaces\nspaces = client.spaces.list(limit=20, time_desc=True)\nfor space in spaces.items:\n    print(f\"{space.id}: {space.configs}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List spaces\nconst spaces = await client.spaces.list({ limit: 20, timeDesc: true });\nfor (const space of spaces.items) {\n  console.log(`${space.id}: ${JSON.stringify(space.configs)}`);\n}\n","label":"JavaScript"}]
 func (h *SpaceHandler) GetSpaces(c *gin.Context) {
@@ -64,6 +77,8 @@ func (h *SpaceHandler) GetSpaces(c *gin.Context) {
 
 	out, err := h.svc.List(c.Request.Context(), service.ListSpacesInput{
 		ProjectID: project.ID,
+		Name:      req.Name,
+		Tag:       req.Tag,
 		Limit:     req.Limit,
 		Cursor:    req.Cursor,
 		TimeDesc:  req.TimeDesc,
@@ -73,19 +88,23 @@ func (h *SpaceHandler) GetSpaces(c *gin.Context) {
 		return
 	}
 
+	setPaginationLinks(c, out.NextCursor)
 	c.JSON(http.StatusOK, serializer.Response{Data: out})
 }
 
 // CreateSpace godoc
 //
 //	@Summary		Create space
-//	@Description	Create a new space under a project
+//	@Description	Create a new space under a project, with an optional name, description and tags
 //	@Tags			space
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body	handler.CreateSpaceReq	true	"CreateSpace payload"
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Space}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Create a space\nspace = client.spaces.create(configs={\"name\": \"My Space\"})\nprint(f\"Created space: {space.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Create a space\nconst space = await client.spaces.create({ configs: { name: 'My Space' } });\nconsole.log(`Created space: ${space.id}`);\n","label":"JavaScript"}]
 func (h *SpaceHandler) CreateSpace(c *gin.Context) {
@@ -102,8 +121,11 @@ func (h *SpaceHandler) CreateSpace(c *gin.Context) {
 	}
 
 	space := model.Space{
-		ProjectID: project.ID,
-		Configs:   datatypes.JSONMap(req.Configs),
+		ProjectID:   project.ID,
+		Configs:     datatypes.JSONMap(req.Configs),
+		Name:        req.Name,
+		Description: req.Description,
+		Tags:        req.Tags,
 	}
 	if err := h.svc.Create(c.Request.Context(), &space); err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
@@ -123,6 +145,9 @@ func (h *SpaceHandler) CreateSpace(c *gin.Context) {
 //	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id} [delete]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete a space\nclient.spaces.delete(space_id='space-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete a space\nawait client.spaces.delete('space-uuid');\n","label":"JavaScript"}]
 func (h *SpaceHandler) DeleteSpace(c *gin.Context) {
@@ -146,6 +171,120 @@ func (h *SpaceHandler) DeleteSpace(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
+type UpdateSpaceMetadataReq struct {
+	Name        *string   `json:"name" binding:"omitempty,max=255" example:"Support agent"`
+	Description *string   `json:"description" binding:"omitempty,max=2000"`
+	Tags        *[]string `json:"tags" binding:"omitempty,max=32,dive,max=64" example:"support,production"`
+}
+
+// UpdateSpaceMetadata godoc
+//
+//	@Summary		Update space metadata
+//	@Description	Update the name, description and tags of a space. Omitted fields are kept, and tags replace the existing ones.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string							true	"Space ID"	Format(uuid)
+//	@Param			payload		body	handler.UpdateSpaceMetadataReq	true	"UpdateSpaceMetadata payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Space}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/metadata [put]
+func (h *SpaceHandler) UpdateMetadata(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := UpdateSpaceMetadataReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	space, err := h.svc.UpdateMetadata(c.Request.Context(), service.UpdateSpaceMetadataInput{
+		ProjectID:   project.ID,
+		SpaceID:     spaceID,
+		Name:        req.Name,
+		Description: req.Description,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrSpaceNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: space})
+}
+
+// MergeSpace godoc
+//
+//	@Summary		Merge space
+//	@Description	Move the pages and other blocks, with their tool SOPs, the connected sessions, the experience confirmations and the sync rules of a space into this space, then delete it. The moved top-level blocks are sorted after those of this space, keeping their order. Moved pages whose slug is taken in this space get it suffixed with a number.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id		path	string	true	"ID of the space merged into"	Format(uuid)
+//	@Param			source_space_id	path	string	true	"ID of the space merged and deleted"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.MergeSpaceOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		404	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/merge_from/{source_space_id} [post]
+func (h *SpaceHandler) MergeSpace(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	sourceSpaceID, err := uuid.Parse(c.Param("source_space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.Merge(c.Request.Context(), service.MergeSpaceInput{
+		ProjectID:     project.ID,
+		SpaceID:       spaceID,
+		SourceSpaceID: sourceSpaceID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSpaceNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrMergeSameSpace):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 type UpdateSpaceConfigsReq struct {
 	Configs map[string]interface{} `form:"configs" json:"configs" binding:"required"`
 }
@@ -161,6 +300,9 @@ type UpdateSpaceConfigsReq struct {
 //	@Param			payload		body	handler.UpdateSpaceConfigsReq	true	"UpdateConfigs payload"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/configs [put]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update space configs\nclient.spaces.update_configs(\n    space_id='space-uuid',\n    configs={\"name\": \"Updated Name\", \"description\": \"New description\"}\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update space configs\nawait client.spaces.updateConfigs('space-uuid', {\n  configs: { name: 'Updated Name', description: 'New description' }\n});\n","label":"JavaScript"}]
 func (h *SpaceHandler) UpdateConfigs(c *gin.Context) {
@@ -196,6 +338,9 @@ func (h *SpaceHandler) UpdateConfigs(c *gin.Context) {
 //	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.Space}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/configs [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get space configs\nspace = client.spaces.get_configs(space_id='space-uuid')\nprint(space.configs)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get space configs\nconst space = await client.spaces.getConfigs('space-uuid');\nconsole.log(space.configs);\n","label":"JavaScript"}]
 func (h *SpaceHandler) GetConfigs(c *gin.Context) {
@@ -236,6 +381,9 @@ type GetExperienceSearchReq struct {
 //	@Param			max_iterations		query	int		false	"Maximum number of iterations for agentic search (1-100, default 16)"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=httpclient.SpaceSearchResult}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/experience_search [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Experience search\nresult = client.spaces.experience_search(\n    space_id='space-uuid',\n    query='How to implement authentication?',\n    limit=10,\n    mode='agentic',\n    max_iterations=20\n)\nfor block in result.cited_blocks:\n    print(f\"{block.title} (distance: {block.distance})\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Experience search\nconst result = await client.spaces.experienceSearch('space-uuid', {\n  query: 'How to implement authentication?',\n  limit: 10,\n  mode: 'agentic',\n  maxIterations: 20\n});\nfor (const block of result.cited_blocks) {\n  console.log(`${block.title} (distance: ${block.distance})`);\n}\n","label":"JavaScript"}]
 func (h *SpaceHandler) GetExperienceSearch(c *gin.Context) {
@@ -277,6 +425,322 @@ func (h *SpaceHandler) GetExperienceSearch(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{Data: result})
 }
 
+type ExportSpaceReq struct {
+	Format string `form:"format,default=markdown" json:"format" binding:"omitempty,oneof=markdown json" example:"markdown" enums:"markdown,json"`
+}
+
+// ExportSpace godoc
+//
+//	@Summary		Export space
+//	@Description	Download the pages and blocks of a space for backup or migration, archived blocks are left out. markdown (default) is a zip with a directory per folder and a Markdown file per page holding its text and SOP blocks, the pages nested under a page are in a directory named like the page; it is streamed page by page, an error midway truncates it. json is the block tree, each block with its children.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		application/zip
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Param			format		query	string	false	"Export format: markdown (default) or json"	Enums(markdown,json)
+//	@Security		BearerAuth
+//	@Success		200	{file}		file
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/export [get]
+func (h *SpaceHandler) ExportSpace(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := ExportSpaceReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	// Verify the space belongs to the project
+	space, err := h.svc.GetByID(c.Request.Context(), &model.Space{ID: spaceID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if space.ProjectID != project.ID {
+		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		return
+	}
+
+	if req.Format == "json" {
+		export, err := h.svc.Export(c.Request.Context(), spaceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="space-%s.json"`, spaceID))
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		if err := sonic.ConfigDefault.NewEncoder(c.Writer).Encode(export); err != nil {
+			_ = c.Error(err)
+		}
+		return
+	}
+
+	// Pages are written as they are loaded, the status is only sent with the first of them
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="space-%s.zip"`, spaceID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := h.svc.ExportMarkdownZip(c.Request.Context(), spaceID, c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.Header("Content-Type", "")
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		// The client gets a truncated archive
+		_ = c.Error(err)
+	}
+}
+
+type SearchSpaceMessagesReq struct {
+	Q      string `form:"q" json:"q" binding:"required,max=255" example:"refund policy"`
+	Limit  int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=100" example:"20"`
+	Cursor string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+}
+
+// SearchSpaceMessages godoc
+//
+//	@Summary		Search messages of space
+//	@Description	Search the text parts of the messages of all the sessions connected to a space, case-insensitively, latest first. Each hit has the session and message it was found in and a snippet around the first match, with the matches in the snippet as character ranges. Messages stored before search was introduced are not searched.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			q			query	string	true	"Text to search for"
+//	@Param			limit		query	integer	false	"Limit of hits to return, default 20. Max 100."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SearchSpaceMessagesOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/search [get]
+func (h *SpaceHandler) SearchSpaceMessages(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := SearchSpaceMessagesReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	// Verify the space belongs to the project
+	space, err := h.svc.GetByID(c.Request.Context(), &model.Space{ID: spaceID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if space.ProjectID != project.ID {
+		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		return
+	}
+
+	out, err := h.svc.SearchMessages(c.Request.Context(), service.SearchSpaceMessagesInput{
+		SpaceID: spaceID,
+		Query:   req.Q,
+		Limit:   req.Limit,
+		Cursor:  req.Cursor,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type SearchSpaceBlocksReq struct {
+	Q      string `form:"q" json:"q" binding:"required,max=255" example:"rollback deploy"`
+	Type   string `form:"type" json:"type" example:"text"`
+	Limit  int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=100" example:"20"`
+	Cursor string `form:"cursor" json:"cursor" example:"MC42MDc5MjcxfDEyM2U0NTY3LWU4OWItMTJkMy1hNDU2LTQyNjYxNDE3NDAwMA"`
+}
+
+// SearchSpaceBlocks godoc
+//
+//	@Summary		Search blocks of space
+//	@Description	Search the title and text of the blocks of a space by full-text search, best ranked first. q is a web search query: words match whole words in any order, "quoted phrases" match in order, or matches either side and -word excludes a word. A match in the title ranks above one in the text. Each hit has a snippet around the first match of a query term, with the matches in the snippet as character ranges. Archived blocks are not searched.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			q			query	string	true	"Web search query"
+//	@Param			type		query	string	false	"Block type"	Enums(page, folder, text, sop, code, table, todo, markdown)
+//	@Param			limit		query	integer	false	"Limit of hits to return, default 20. Max 100."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SearchSpaceBlocksOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/blocks/search [get]
+func (h *SpaceHandler) SearchSpaceBlocks(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := SearchSpaceBlocksReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if req.Type != "" && !model.IsValidBlockType(req.Type) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("type", errors.New("invalid block type")))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	// Verify the space belongs to the project
+	space, err := h.svc.GetByID(c.Request.Context(), &model.Space{ID: spaceID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if space.ProjectID != project.ID {
+		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		return
+	}
+
+	out, err := h.svc.SearchBlocks(c.Request.Context(), service.SearchSpaceBlocksInput{
+		SpaceID: spaceID,
+		Query:   req.Q,
+		Type:    req.Type,
+		Limit:   req.Limit,
+		Cursor:  req.Cursor,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type SemanticSearchSpaceBlocksReq struct {
+	Query string `json:"query" binding:"required,max=2000" example:"how do we roll back a deploy?"`
+	TopK  int    `json:"top_k" binding:"omitempty,min=1,max=100" example:"10"`
+	Type  string `json:"type" example:"markdown"`
+	// Threshold is the largest cosine distance of a hit, from 0 (identical) to 2 (opposite)
+	Threshold *float64 `json:"threshold" binding:"omitempty,gt=0,max=2" example:"0.8"`
+}
+
+// SemanticSearchSpaceBlocks godoc
+//
+//	@Summary		Semantic search blocks of space
+//	@Description	Search the blocks of a space by meaning: the query is embedded with the embedding model of the blocks and the top_k blocks nearest to it by cosine distance are returned, nearest first. Blocks are embedded asynchronously after they are created or changed, so a block written a moment ago may not be found yet. top_k defaults to 10. Archived blocks are not searched.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string								true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.SemanticSearchSpaceBlocksReq	true	"SemanticSearchSpaceBlocks payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SemanticSearchBlocksOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/blocks/semantic_search [post]
+func (h *SpaceHandler) SemanticSearchSpaceBlocks(c *gin.Context) {
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := SemanticSearchSpaceBlocksReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("query", errors.New("query is empty")))
+		return
+	}
+	if req.Type != "" && !model.IsValidBlockType(req.Type) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("type", errors.New("invalid block type")))
+		return
+	}
+	if req.TopK == 0 {
+		req.TopK = 10
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	// Verify the space belongs to the project
+	space, err := h.svc.GetByID(c.Request.Context(), &model.Space{ID: spaceID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if space.ProjectID != project.ID {
+		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		return
+	}
+
+	embedded, err := h.coreClient.Embed(c.Request.Context(), project.ID, httpclient.EmbedRequest{Texts: []string{req.Query}, Phase: "query"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "Failed to call core service", err))
+		return
+	}
+
+	in := service.SemanticSearchBlocksInput{
+		SpaceID:   spaceID,
+		Embedding: embedded.Embeddings[0],
+		Type:      req.Type,
+		TopK:      req.TopK,
+	}
+	if req.Threshold != nil {
+		in.Threshold = *req.Threshold
+	}
+	out, err := h.svc.SemanticSearchBlocks(c.Request.Context(), in)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 type ListExperienceConfirmationsReq struct {
 	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
 	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
@@ -296,6 +760,10 @@ type ListExperienceConfirmationsReq struct {
 //	@Param			time_desc	query	boolean	false	"Order by created_at descending if true, ascending if false (default false)"	example(false)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.ListExperienceConfirmationsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/experience_confirmations [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get unconfirmed experiences\nexperiences = client.spaces.get_unconfirmed_experiences(\n    space_id='space-uuid',\n    limit=20,\n    time_desc=True\n)\nfor experience in experiences.items:\n    print(f\"{experience.id}: {experience.experience_data}\")\n\n# If there are more, use the cursor for pagination\nif experiences.has_more:\n    next_experiences = client.spaces.get_unconfirmed_experiences(\n        space_id='space-uuid',\n        limit=20,\n        cursor=experiences.next_cursor\n    )\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get unconfirmed experiences\nconst experiences = await client.spaces.getUnconfirmedExperiences('space-uuid', {\n  limit: 20,\n  timeDesc: true\n});\nfor (const experience of experiences.items) {\n  console.log(`${experience.id}: ${JSON.stringify(experience.experience_data)}`);\n}\n\n// If there are more, use the cursor for pagination\nif (experiences.hasMore) {\n  const nextExperiences = await client.spaces.getUnconfirmedExperiences('space-uuid', {\n    limit: 20,\n    cursor: experiences.nextCursor\n  });\n}\n","label":"JavaScript"}]
 func (h *SpaceHandler) ListExperienceConfirmations(c *gin.Context) {
@@ -339,6 +807,7 @@ func (h *SpaceHandler) ListExperienceConfirmations(c *gin.Context) {
 		return
 	}
 
+	setPaginationLinks(c, out.NextCursor)
 	c.JSON(http.StatusOK, serializer.Response{Data: out})
 }
 
@@ -358,6 +827,10 @@ type ConfirmExperienceReq struct {
 //	@Param			request			body	ConfirmExperienceReq	true	"Confirmation request with save flag"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.ExperienceConfirmation}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		403	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
 //	@Router			/space/{space_id}/experience_confirmations/{experience_id} [patch]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Confirm experience and save data\nconfirmation = client.spaces.confirm_experience(\n    space_id='space-uuid',\n    experience_id='experience-uuid',\n    save=True\n)\nprint(f\"Saved confirmation: {confirmation.experience_data}\")\n\n# Confirm experience without saving (just delete)\nclient.spaces.confirm_experience(\n    space_id='space-uuid',\n    experience_id='experience-uuid',\n    save=False\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Confirm experience and save data\nconst confirmation = await client.spaces.confirmExperience('space-uuid', 'experience-uuid', {\n  save: true\n});\nconsole.log(`Saved confirmation: ${JSON.stringify(confirmation.experience_data)}`);\n\n// Confirm experience without saving (just delete)\nawait client.spaces.confirmExperience('space-uuid', 'experience-uuid', {\n  save: false\n});\n","label":"JavaScript"}]
 func (h *SpaceHandler) ConfirmExperience(c *gin.Context) {
@@ -404,3 +877,75 @@ func (h *SpaceHandler) ConfirmExperience(c *gin.Context) {
 
 	c.JSON(http.StatusOK, serializer.Response{Data: confirmation})
 }
+
+type ImportSpaceReq struct {
+	Name string `form:"name" json:"name" binding:"max=255" example:"Support runbooks"`
+}
+
+// ImportSpace godoc
+//
+//	@Summary		Import space
+//	@Description	Create a space from a zip of Markdown files, such as a space export (GET /space/{space_id}/export) or a Notion Markdown export. Directories become folders and .md files become pages, named after the leading # heading of the file or else the file name; the ids Notion appends to names are dropped. The text of a page is split into a text block per ## heading, the text before the first heading being a text block without title. Folders and pages are sorted by title and text blocks keep the order of the file. Other files, such as images, are skipped and listed in skipped. The space is named after the top-level directory of the archive, or else the zip file, unless name is given. The zip may be up to 64 MiB and hold up to 20000 entries, with Markdown files of up to 4 MiB each and 256 MiB in all. A folder or page with more blocks than the server hard limit of children is refused with 422.
+//	@Tags			space
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Zip of Markdown files"
+//	@Param			name	formData	string	false	"Name of the new space"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.ImportSpaceOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		413	{object}	serializer.ErrorResponse
+//	@Failure		422	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/import [post]
+func (h *SpaceHandler) ImportSpace(c *gin.Context) {
+	req := ImportSpaceReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("file is required", err))
+		return
+	}
+	if fh.Size > service.MaxSpaceImportBytes {
+		respondUploadErr(c, fmt.Errorf("%w: %s is %d bytes, the limit is %d", errFileTooLarge, fh.Filename, fh.Size, service.MaxSpaceImportBytes))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	defer f.Close()
+
+	out, err := h.svc.Import(c.Request.Context(), service.ImportSpaceInput{
+		ProjectID: project.ID,
+		Name:      req.Name,
+		FileName:  fh.Filename,
+		Archive:   f,
+		Size:      fh.Size,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSpaceImport) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		if limitExceeded(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/bytedance/sonic"
@@ -41,6 +44,14 @@ func (m *MockSpaceService) UpdateByID(ctx context.Context, s *model.Space) error
 	return args.Error(0)
 }
 
+func (m *MockSpaceService) UpdateMetadata(ctx context.Context, in service.UpdateSpaceMetadataInput) (*model.Space, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Space), args.Error(1)
+}
+
 func (m *MockSpaceService) GetByID(ctx context.Context, s *model.Space) (*model.Space, error) {
 	args := m.Called(ctx, s)
 	if args.Get(0) == nil {
@@ -73,6 +84,51 @@ func (m *MockSpaceService) ConfirmExperience(ctx context.Context, spaceID uuid.U
 	return args.Get(0).(*model.ExperienceConfirmation), args.Error(1)
 }
 
+func (m *MockSpaceService) SearchMessages(ctx context.Context, in service.SearchSpaceMessagesInput) (*service.SearchSpaceMessagesOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SearchSpaceMessagesOutput), args.Error(1)
+}
+
+func (m *MockSpaceService) SearchBlocks(ctx context.Context, in service.SearchSpaceBlocksInput) (*service.SearchSpaceBlocksOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SearchSpaceBlocksOutput), args.Error(1)
+}
+
+func (m *MockSpaceService) SemanticSearchBlocks(ctx context.Context, in service.SemanticSearchBlocksInput) (*service.SemanticSearchBlocksOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SemanticSearchBlocksOutput), args.Error(1)
+}
+
+func (m *MockSpaceService) ExportMarkdownZip(ctx context.Context, spaceID uuid.UUID, w io.Writer) error {
+	args := m.Called(ctx, spaceID, w)
+	return args.Error(0)
+}
+
+func (m *MockSpaceService) Export(ctx context.Context, spaceID uuid.UUID) (*service.SpaceExport, error) {
+	args := m.Called(ctx, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SpaceExport), args.Error(1)
+}
+
+func (m *MockSpaceService) Import(ctx context.Context, in service.ImportSpaceInput) (*service.ImportSpaceOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ImportSpaceOutput), args.Error(1)
+}
+
 func setupSpaceRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -642,3 +698,549 @@ func TestSpaceHandler_ListExperienceConfirmations(t *testing.T) {
 		})
 	}
 }
+
+func TestSpaceHandler_SearchSpaceMessages(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	ownSpace := func(svc *MockSpaceService, projectID uuid.UUID) {
+		svc.On("GetByID", mock.Anything, mock.MatchedBy(func(s *model.Space) bool {
+			return s.ID == spaceID
+		})).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+	}
+
+	tests := []struct {
+		name           string
+		spaceIDParam   string
+		queryParams    string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name:         "success",
+			spaceIDParam: spaceID.String(),
+			queryParams:  "?q=refund&limit=5",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, projectID)
+				svc.On("SearchMessages", mock.Anything, service.SearchSpaceMessagesInput{SpaceID: spaceID, Query: "refund", Limit: 5}).
+					Return(&service.SearchSpaceMessagesOutput{Items: []service.MessageSearchHit{{MessageID: uuid.New(), Snippet: "refund"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing query",
+			spaceIDParam:   spaceID.String(),
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid space ID",
+			spaceIDParam:   "invalid-uuid",
+			queryParams:    "?q=refund",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "space does not belong to project",
+			spaceIDParam: spaceID.String(),
+			queryParams:  "?q=refund",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, uuid.New())
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:         "service layer error",
+			spaceIDParam: spaceID.String(),
+			queryParams:  "?q=refund",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, projectID)
+				svc.On("SearchMessages", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.GET("/space/:space_id/search", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.SearchSpaceMessages(c)
+			})
+
+			req := httptest.NewRequest("GET", "/space/"+tt.spaceIDParam+"/search"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_SearchSpaceBlocks(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	ownSpace := func(svc *MockSpaceService, projectID uuid.UUID) {
+		svc.On("GetByID", mock.Anything, mock.MatchedBy(func(s *model.Space) bool {
+			return s.ID == spaceID
+		})).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name:        "success",
+			queryParams: "?q=rollback+deploy&type=code&limit=5",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, projectID)
+				svc.On("SearchBlocks", mock.Anything, service.SearchSpaceBlocksInput{SpaceID: spaceID, Query: "rollback deploy", Type: "code", Limit: 5}).
+					Return(&service.SearchSpaceBlocksOutput{Items: []service.BlockSearchHit{{BlockID: uuid.New(), Snippet: "rollback"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing query",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid block type",
+			queryParams:    "?q=rollback&type=image",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "space does not belong to project",
+			queryParams: "?q=rollback",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, uuid.New())
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:        "service layer error",
+			queryParams: "?q=rollback",
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, projectID)
+				svc.On("SearchBlocks", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.GET("/space/:space_id/blocks/search", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.SearchSpaceBlocks(c)
+			})
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/blocks/search"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_SemanticSearchSpaceBlocks(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	ownSpace := func(svc *MockSpaceService, projectID uuid.UUID) {
+		svc.On("GetByID", mock.Anything, mock.MatchedBy(func(s *model.Space) bool {
+			return s.ID == spaceID
+		})).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+	}
+
+	// The core service embeds the query
+	var embedded httpclient.EmbedRequest
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&embedded)
+		_, _ = w.Write([]byte(`{"embeddings":[[0.6,0.8]],"model":"text-embedding-3-small"}`))
+	}))
+	defer core.Close()
+	coreClient := &httpclient.CoreClient{BaseURL: core.URL, HTTPClient: core.Client(), Propagator: otel.GetTextMapPropagator()}
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"query":"how do we roll back?","type":"markdown","threshold":0.5}`,
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, projectID)
+				svc.On("SemanticSearchBlocks", mock.Anything, service.SemanticSearchBlocksInput{
+					SpaceID: spaceID, Embedding: []float32{0.6, 0.8}, Type: "markdown", TopK: 10, Threshold: 0.5,
+				}).Return(&service.SemanticSearchBlocksOutput{Items: []service.SemanticBlockHit{{BlockID: uuid.New(), Distance: 0.2}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "blank query",
+			body:           `{"query":"  "}`,
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "top_k too large",
+			body:           `{"query":"rollback","top_k":1000}`,
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid block type",
+			body:           `{"query":"rollback","type":"image"}`,
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "space does not belong to project",
+			body: `{"query":"rollback"}`,
+			setup: func(svc *MockSpaceService) {
+				ownSpace(svc, uuid.New())
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, coreClient)
+			router := setupSpaceRouter()
+			router.POST("/space/:space_id/blocks/semantic_search", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.SemanticSearchSpaceBlocks(c)
+			})
+
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/blocks/semantic_search", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+	assert.Equal(t, "query", embedded.Phase)
+}
+
+func (m *MockSpaceService) Merge(ctx context.Context, in service.MergeSpaceInput) (*service.MergeSpaceOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.MergeSpaceOutput), args.Error(1)
+}
+
+func TestSpaceHandler_UpdateMetadata(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"name":"Support agent","tags":["support"]}`,
+			setup: func(svc *MockSpaceService) {
+				svc.On("UpdateMetadata", mock.Anything, mock.MatchedBy(func(in service.UpdateSpaceMetadataInput) bool {
+					return in.ProjectID == projectID && in.SpaceID == spaceID && *in.Name == "Support agent" &&
+						in.Description == nil && len(*in.Tags) == 1
+				})).Return(&model.Space{ID: spaceID, ProjectID: projectID, Name: "Support agent"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "name too long",
+			body:           `{"name":"` + strings.Repeat("a", 256) + `"}`,
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "space not found",
+			body: `{"description":"gone"}`,
+			setup: func(svc *MockSpaceService) {
+				svc.On("UpdateMetadata", mock.Anything, mock.Anything).Return(nil, service.ErrSpaceNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.PUT("/space/:space_id/metadata", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.UpdateMetadata(c)
+			})
+
+			req := httptest.NewRequest("PUT", "/space/"+spaceID.String()+"/metadata", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_MergeSpace(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	sourceSpaceID := uuid.New()
+
+	tests := []struct {
+		name           string
+		source         string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name:   "success",
+			source: sourceSpaceID.String(),
+			setup: func(svc *MockSpaceService) {
+				svc.On("Merge", mock.Anything, service.MergeSpaceInput{ProjectID: projectID, SpaceID: spaceID, SourceSpaceID: sourceSpaceID}).
+					Return(&service.MergeSpaceOutput{Space: &model.Space{ID: spaceID, ProjectID: projectID}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid source space id",
+			source:         "old",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "same space",
+			source: spaceID.String(),
+			setup: func(svc *MockSpaceService) {
+				svc.On("Merge", mock.Anything, mock.Anything).Return(nil, service.ErrMergeSameSpace)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "space not found",
+			source: sourceSpaceID.String(),
+			setup: func(svc *MockSpaceService) {
+				svc.On("Merge", mock.Anything, mock.Anything).Return(nil, service.ErrSpaceNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.POST("/space/:space_id/merge_from/:source_space_id", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.MergeSpace(c)
+			})
+
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/merge_from/"+tt.source, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_ExportSpace(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	export := &service.SpaceExport{SpaceID: spaceID, Blocks: []*service.SpaceExportNode{
+		{Block: &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "Runbook"}},
+	}}
+
+	tests := []struct {
+		name            string
+		query           string
+		setup           func(*MockSpaceService)
+		expectedStatus  int
+		expectedType    string
+		expectedContent string
+	}{
+		{
+			name: "markdown zip",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+				svc.On("ExportMarkdownZip", mock.Anything, spaceID, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedType:   "application/zip",
+		},
+		{
+			name: "markdown zip fails before writing",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+				svc.On("ExportMarkdownZip", mock.Anything, spaceID, mock.Anything).Return(errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedType:   "application/json; charset=utf-8",
+		},
+		{
+			name:  "json tree",
+			query: "?format=json",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+				svc.On("Export", mock.Anything, spaceID).Return(export, nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedType:    "application/json",
+			expectedContent: `"title":"Runbook"`,
+		},
+		{
+			name:           "unknown format",
+			query:          "?format=pdf",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "space of another project",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: uuid.New()}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.GET("/space/:space_id/export", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.ExportSpace(c)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/space/"+spaceID.String()+"/export"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedType != "" {
+				assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+			}
+			if tt.expectedContent != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedContent)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_ImportSpace(t *testing.T) {
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		withFile       bool
+		spaceName      string
+		setup          func(*MockSpaceService)
+		expectedStatus int
+	}{
+		{
+			name:      "imported",
+			withFile:  true,
+			spaceName: "Runbooks",
+			setup: func(svc *MockSpaceService) {
+				svc.On("Import", mock.Anything, mock.MatchedBy(func(in service.ImportSpaceInput) bool {
+					return in.ProjectID == projectID && in.Name == "Runbooks" && in.FileName == "kb.zip" && in.Size == 3
+				})).Return(&service.ImportSpaceOutput{Space: &model.Space{ID: uuid.New(), ProjectID: projectID}, Pages: 1}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:     "not a zip",
+			withFile: true,
+			setup: func(svc *MockSpaceService) {
+				svc.On("Import", mock.Anything, mock.Anything).Return(nil, service.ErrInvalidSpaceImport)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing file",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "store failure",
+			withFile: true,
+			setup: func(svc *MockSpaceService) {
+				svc.On("Import", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.POST("/space/import", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.ImportSpace(c)
+			})
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			if tt.withFile {
+				fw, err := writer.CreateFormFile("file", "kb.zip")
+				assert.NoError(t, err)
+				_, _ = fw.Write([]byte("zip"))
+			}
+			if tt.spaceName != "" {
+				assert.NoError(t, writer.WriteField("name", tt.spaceName))
+			}
+			assert.NoError(t, writer.Close())
+
+			req := httptest.NewRequest("POST", "/space/import", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
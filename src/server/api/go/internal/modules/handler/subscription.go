@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/converter"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+const (
+	subscriptionPingInterval = 30 * time.Second
+	subscriptionWriteTimeout = 10 * time.Second
+	subscriptionMaxReadBytes = 1 << 20
+
+	// pollMaxWait bounds the time a poll request is held open
+	pollMaxWait = 60 * time.Second
+)
+
+type SubscriptionHandler struct {
+	svc      service.SessionService
+	hub      *service.MessageHub
+	upgrader websocket.Upgrader
+}
+
+func NewSubscriptionHandler(s service.SessionService, hub *service.MessageHub) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		svc: s,
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			// Requests are authenticated by bearer token, not by cookies, so cross-origin clients are allowed
+			CheckOrigin: func(r *http.Request) bool { return true },
+			Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+				b, _ := sonic.Marshal(serializer.Err(status, "websocket upgrade failed", reason))
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(status)
+				_, _ = w.Write(b)
+			},
+		},
+	}
+}
+
+type SubscribeMessagesReq struct {
+	Format string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+}
+
+// SubscribeMessageEvent is a websocket text frame pushed to subscribers
+type SubscribeMessageEvent struct {
+	Type      string      `json:"type"` // "message" | "error"
+	MessageID string      `json:"message_id,omitempty"`
+	Items     interface{} `json:"items,omitempty"` // the new message converted to the requested format, as in GetMessages
+	Error     string      `json:"error,omitempty"`
+}
+
+// SubscribeMessages godoc
+//
+//	@Summary		Subscribe to session messages
+//	@Description	Upgrade to a WebSocket and receive every message persisted to the session from now on, converted to the requested format. Each text frame is a JSON event `{type: "message", message_id, items: [message]}`, or `{type: "error", message_id, error}` if a message could not be loaded. Messages sent to the socket by the client are ignored.
+//	@Tags			session
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			format		query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic, gemini, ai-sdk."	enums(acontext,openai,anthropic,gemini,ai-sdk)
+//	@Security		BearerAuth
+//	@Success		101	{object}	handler.SubscribeMessageEvent
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/subscribe [get]
+func (h *SubscriptionHandler) SubscribeMessages(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := SubscribeMessagesReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	format, err := converter.ValidateFormat(req.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	// Subscribe before upgrading so no message persisted meanwhile is missed
+	events, unsubscribe := h.hub.Subscribe(sessionID)
+	defer unsubscribe()
+
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("websocket upgrade required", errors.New("not a websocket upgrade request")))
+		return
+	}
+	// On failure the upgrader has already replied through its Error hook
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(subscriptionMaxReadBytes)
+
+	// The request context is not tied to the hijacked connection, the read loop detects disconnects
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(subscriptionPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			closeSubscription(conn, websocket.CloseGoingAway)
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(subscriptionWriteTimeout)); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				closeSubscription(conn, websocket.CloseGoingAway)
+				return
+			}
+			if ev.ProjectID != project.ID {
+				continue
+			}
+			if err := h.pushMessage(ctx, conn, sessionID, ev.MessageID, format); err != nil {
+				closeSubscription(conn, websocket.CloseInternalServerErr)
+				return
+			}
+		}
+	}
+}
+
+// pushMessage loads a persisted message, converts it and writes it to the socket.
+// Only write failures are returned, load failures are reported to the client as error events.
+func (h *SubscriptionHandler) pushMessage(ctx context.Context, conn *websocket.Conn, sessionID uuid.UUID, messageID uuid.UUID, format model.MessageFormat) error {
+	event := SubscribeMessageEvent{Type: "message", MessageID: messageID.String()}
+
+	msg, err := h.svc.GetMessage(ctx, sessionID, messageID)
+	if err == nil {
+		event.Items, err = converter.ConvertMessages(converter.ConvertMessagesInput{
+			Messages: []model.Message{*msg},
+			Format:   format,
+		})
+	}
+	if err != nil {
+		event = SubscribeMessageEvent{Type: "error", MessageID: messageID.String(), Error: err.Error()}
+	}
+
+	b, err := sonic.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(subscriptionWriteTimeout))
+	return conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// closeSubscription sends a close frame, the deferred Close then drops the connection
+func closeSubscription(conn *websocket.Conn, code int) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(subscriptionWriteTimeout))
+}
+
+type PollMessagesReq struct {
+	AfterCursor        string        `form:"after_cursor" json:"after_cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	Wait               time.Duration `form:"wait,default=30s" json:"wait" swaggertype:"string" example:"30s"`
+	Limit              int           `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Format             string        `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini ai-sdk" example:"openai" enums:"acontext,openai,anthropic,gemini,ai-sdk"`
+	WithAssetPublicURL bool          `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
+}
+
+// PollMessages godoc
+//
+//	@Summary		Long-poll session messages
+//	@Description	Return the messages persisted to the session after after_cursor, oldest first, holding the request for up to wait until one arrives, for clients that cannot use the WebSocket of GET /session/{session_id}/messages/subscribe. Without after_cursor the messages are returned from the start of the session. next_cursor is the after_cursor of the next poll; it is left out while the session has no message. has_more means more messages are already waiting, so the next poll returns at once. An empty items means the wait expired.
+//	@Tags			session
+//	@Produce		json
+//	@Param			session_id				path	string	true	"Session ID"	format(uuid)
+//	@Param			after_cursor			query	string	false	"Cursor of the last message received, next_cursor of the previous poll"
+//	@Param			wait					query	string	false	"Longest time to wait for a message, as a duration, default 30s. Max 60s, 0s returns at once."	example(30s)
+//	@Param			limit					query	integer	false	"Limit of messages to return, default 20. Max 200."
+//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic, gemini, ai-sdk."	enums(acontext,openai,anthropic,gemini,ai-sdk)
+//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public urls, default is true"	example:"true"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.GetMessagesOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/messages/poll [get]
+func (h *SubscriptionHandler) PollMessages(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := PollMessagesReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if req.Wait < 0 || req.Wait > pollMaxWait {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("wait", fmt.Errorf("wait must be between 0s and %s", pollMaxWait)))
+		return
+	}
+	if req.AfterCursor != "" {
+		if _, _, err := paging.DecodeCursor(req.AfterCursor); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid after_cursor", err))
+			return
+		}
+	}
+	format, err := converter.ValidateFormat(req.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	// Subscribe before the first read so no message persisted in between is missed
+	events, unsubscribe := h.hub.Subscribe(sessionID)
+	defer unsubscribe()
+	timer := time.NewTimer(req.Wait)
+	defer timer.Stop()
+
+	ctx := c.Request.Context()
+	in := service.GetMessagesInput{
+		SessionID:          sessionID,
+		Limit:              req.Limit,
+		Cursor:             req.AfterCursor,
+		WithAssetPublicURL: req.WithAssetPublicURL,
+		AssetExpire:        messageAssetExpire(c),
+	}
+	var out *service.GetMessagesOutput
+	for {
+		out, err = h.svc.GetMessages(ctx, in)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		if len(out.Items) > 0 || !waitMessageEvent(ctx, events, project.ID, timer) {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		// The client is gone
+		return
+	}
+
+	// The cursor of the last message returned, so the next poll continues after it
+	nextCursor := req.AfterCursor
+	if len(out.Items) > 0 {
+		last := out.Items[len(out.Items)-1]
+		nextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	convertedOut, err := converter.GetConvertedMessagesOutput(out.Items, format, out.PublicURLs, nextCursor, out.HasMore)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to convert messages", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: convertedOut})
+}
+
+// waitMessageEvent blocks until a message of the project is persisted to the session, and reports whether one was.
+// It returns false once the timer fires, the context is done or the hub closes the subscription.
+func waitMessageEvent(ctx context.Context, events <-chan service.SendMQPublishJSON, projectID uuid.UUID, timer *time.Timer) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return false
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			if ev.ProjectID == projectID {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func setupSubscriptionServer(h *SubscriptionHandler, projectID uuid.UUID) *httptest.Server {
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/messages/subscribe", func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+		h.SubscribeMessages(c)
+	})
+	return httptest.NewServer(router)
+}
+
+// dialWebsocket performs the client handshake and returns the connection
+func dialWebsocket(t *testing.T, srv *httptest.Server, path string) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	return conn
+}
+
+func readTextFrame(t *testing.T, conn *websocket.Conn) SubscribeMessageEvent {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	mt, payload, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.TextMessage, mt)
+
+	var ev SubscribeMessageEvent
+	require.NoError(t, sonic.Unmarshal(payload, &ev))
+	return ev
+}
+
+func TestSubscriptionHandler_SubscribeMessages(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	missingID := uuid.New()
+
+	mockService := &MockSessionService{}
+	mockService.On("GetMessage", mock.Anything, sessionID, messageID).Return(&model.Message{
+		ID:        messageID,
+		SessionID: sessionID,
+		Role:      "user",
+		Parts:     []model.Part{{Type: "text", Text: "hello"}},
+	}, nil)
+	mockService.On("GetMessage", mock.Anything, sessionID, missingID).Return(nil, errors.New("record not found"))
+
+	hub := service.NewMessageHub(zap.NewNop())
+	srv := setupSubscriptionServer(NewSubscriptionHandler(mockService, hub), projectID)
+	defer srv.Close()
+
+	conn := dialWebsocket(t, srv, "/session/"+sessionID.String()+"/messages/subscribe?format=acontext")
+	defer conn.Close()
+
+	// Events of other projects are ignored, the next event is delivered
+	hub.Dispatch(service.SendMQPublishJSON{ProjectID: uuid.New(), SessionID: sessionID, MessageID: missingID})
+	hub.Dispatch(service.SendMQPublishJSON{ProjectID: projectID, SessionID: sessionID, MessageID: messageID})
+
+	ev := readTextFrame(t, conn)
+	assert.Equal(t, "message", ev.Type)
+	assert.Equal(t, messageID.String(), ev.MessageID)
+	assert.NotEmpty(t, ev.Items)
+
+	hub.Dispatch(service.SendMQPublishJSON{ProjectID: projectID, SessionID: sessionID, MessageID: missingID})
+	ev = readTextFrame(t, conn)
+	assert.Equal(t, "error", ev.Type)
+	assert.Equal(t, missingID.String(), ev.MessageID)
+}
+
+func TestSubscriptionHandler_SubscribeMessages_BadRequest(t *testing.T) {
+	hub := service.NewMessageHub(zap.NewNop())
+	srv := setupSubscriptionServer(NewSubscriptionHandler(&MockSessionService{}, hub), uuid.New())
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "not an upgrade request", path: "/session/" + uuid.New().String() + "/messages/subscribe"},
+		{name: "invalid session id", path: "/session/invalid/messages/subscribe"},
+		{name: "invalid format", path: "/session/" + uuid.New().String() + "/messages/subscribe?format=mistral"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestSubscriptionHandler_PollMessages(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	first := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", Parts: []model.Part{{Type: "text", Text: "hello"}}, CreatedAt: time.Now()}
+	firstCursor := paging.EncodeCursor(first.CreatedAt, first.ID)
+	after := func(cursor string) interface{} {
+		return mock.MatchedBy(func(in service.GetMessagesInput) bool {
+			return in.SessionID == sessionID && in.Cursor == cursor && in.Limit == 20
+		})
+	}
+
+	poll := func(t *testing.T, h *SubscriptionHandler, query string) (int, map[string]interface{}) {
+		router := setupSessionRouter()
+		router.GET("/session/:session_id/messages/poll", func(c *gin.Context) {
+			c.Set("project", &model.Project{ID: projectID})
+			h.PollMessages(c)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/session/"+sessionID.String()+"/messages/poll"+query, nil))
+
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = sonic.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	t.Run("messages already persisted", func(t *testing.T) {
+		mockService := &MockSessionService{}
+		mockService.On("GetMessages", mock.Anything, after("")).Return(&service.GetMessagesOutput{Items: []model.Message{first}}, nil).Once()
+
+		code, data := poll(t, NewSubscriptionHandler(mockService, service.NewMessageHub(zap.NewNop())), "?format=acontext")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, data["items"], 1)
+		assert.Equal(t, firstCursor, data["next_cursor"])
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("waits for a message", func(t *testing.T) {
+		second := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", Parts: []model.Part{{Type: "text", Text: "hi"}}, CreatedAt: first.CreatedAt.Add(time.Second)}
+		hub := service.NewMessageHub(zap.NewNop())
+
+		mockService := &MockSessionService{}
+		mockService.On("GetMessages", mock.Anything, after(firstCursor)).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil).Once().Run(func(mock.Arguments) {
+			// Events of other projects do not end the wait
+			hub.Dispatch(service.SendMQPublishJSON{ProjectID: uuid.New(), SessionID: sessionID, MessageID: uuid.New()})
+			hub.Dispatch(service.SendMQPublishJSON{ProjectID: projectID, SessionID: sessionID, MessageID: second.ID})
+		})
+		mockService.On("GetMessages", mock.Anything, after(firstCursor)).Return(&service.GetMessagesOutput{Items: []model.Message{second}}, nil).Once()
+
+		code, data := poll(t, NewSubscriptionHandler(mockService, hub), "?after_cursor="+firstCursor+"&wait=5s")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, data["items"], 1)
+		assert.Equal(t, paging.EncodeCursor(second.CreatedAt, second.ID), data["next_cursor"])
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("wait expires", func(t *testing.T) {
+		mockService := &MockSessionService{}
+		mockService.On("GetMessages", mock.Anything, after(firstCursor)).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil).Once()
+
+		code, data := poll(t, NewSubscriptionHandler(mockService, service.NewMessageHub(zap.NewNop())), "?after_cursor="+firstCursor+"&wait=10ms")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, data["items"])
+		assert.Equal(t, firstCursor, data["next_cursor"])
+		mockService.AssertExpectations(t)
+	})
+
+	for _, query := range []string{"?wait=2m", "?wait=-1s", "?wait=soon", "?after_cursor=invalid", "?limit=500", "?format=mistral"} {
+		t.Run("bad request "+query, func(t *testing.T) {
+			code, _ := poll(t, NewSubscriptionHandler(&MockSessionService{}, service.NewMessageHub(zap.NewNop())), query)
+			assert.Equal(t, http.StatusBadRequest, code)
+		})
+	}
+}
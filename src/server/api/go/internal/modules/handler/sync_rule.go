@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type SyncRuleHandler struct {
+	svc service.SyncRuleService
+}
+
+func NewSyncRuleHandler(s service.SyncRuleService) *SyncRuleHandler {
+	return &SyncRuleHandler{svc: s}
+}
+
+type SyncRuleMatchReq struct {
+	Tags     []string `form:"tags" json:"tags" example:"decision"`                                                         // Match messages whose meta.tags contains any of them
+	Roles    []string `form:"roles" json:"roles" binding:"omitempty,dive,oneof=user assistant system" example:"assistant"` // Match messages with one of the roles
+	Contains string   `form:"contains" json:"contains" example:"we decided"`                                               // Match messages whose text contains it, case-insensitive
+}
+
+func (r SyncRuleMatchReq) toModel() model.SyncRuleMatch {
+	return model.SyncRuleMatch{Tags: r.Tags, Roles: r.Roles, Contains: r.Contains}
+}
+
+type CreateSyncRuleReq struct {
+	Name         string           `form:"name" json:"name" example:"Decisions"`
+	Match        SyncRuleMatchReq `form:"match" json:"match"`
+	TargetPageID string           `form:"target_page_id" json:"target_page_id" binding:"required,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Enabled      *bool            `form:"enabled" json:"enabled" example:"true"` // default true
+}
+
+// CreateSyncRule godoc
+//
+//	@Summary		Create sync rule
+//	@Description	Create a rule that copies the matching messages of the sessions connected to the space into a page of the space, one text block per message. Messages are matched on meta.tags, role and text; every condition that is set must hold and at least one is required.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string						true	"Space ID"	Format(uuid)
+//	@Param			payload		body	handler.CreateSyncRuleReq	true	"CreateSyncRule payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.SyncRule}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/sync_rules [post]
+func (h *SyncRuleHandler) CreateSyncRule(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := CreateSyncRuleReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	rule, err := h.svc.Create(c.Request.Context(), service.CreateSyncRuleInput{
+		ProjectID:    project.ID,
+		SpaceID:      spaceID,
+		Name:         req.Name,
+		Match:        req.Match.toModel(),
+		TargetPageID: uuid.MustParse(req.TargetPageID),
+		Enabled:      enabled,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrSyncRuleEmptyMatch) || errors.Is(err, service.ErrSyncRuleTargetNotFound) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: rule})
+}
+
+// ListSyncRules godoc
+//
+//	@Summary		List sync rules
+//	@Description	List the sync rules of a space
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.SyncRule}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/sync_rules [get]
+func (h *SyncRuleHandler) ListSyncRules(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	rules, err := h.svc.List(c.Request.Context(), project.ID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: rules})
+}
+
+type UpdateSyncRuleReq struct {
+	Name    *string           `form:"name" json:"name" example:"Decisions"`
+	Match   *SyncRuleMatchReq `form:"match" json:"match"`
+	Enabled *bool             `form:"enabled" json:"enabled" example:"false"`
+}
+
+// UpdateSyncRule godoc
+//
+//	@Summary		Update sync rule
+//	@Description	Update the name, match conditions or enabled state of a sync rule. Omitted fields are left unchanged.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string						true	"Space ID"		Format(uuid)
+//	@Param			rule_id		path	string						true	"Sync rule ID"	Format(uuid)
+//	@Param			payload		body	handler.UpdateSyncRuleReq	true	"UpdateSyncRule payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.SyncRule}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/sync_rules/{rule_id} [patch]
+func (h *SyncRuleHandler) UpdateSyncRule(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	ruleID, err := uuid.Parse(c.Param("rule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := UpdateSyncRuleReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	in := service.UpdateSyncRuleInput{
+		ProjectID: project.ID,
+		SpaceID:   spaceID,
+		RuleID:    ruleID,
+		Name:      req.Name,
+		Enabled:   req.Enabled,
+	}
+	if req.Match != nil {
+		match := req.Match.toModel()
+		in.Match = &match
+	}
+
+	rule, err := h.svc.Update(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, service.ErrSyncRuleEmptyMatch) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: rule})
+}
+
+// DeleteSyncRule godoc
+//
+//	@Summary		Delete sync rule
+//	@Description	Delete a sync rule. Blocks already copied into the target page are kept.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"		Format(uuid)
+//	@Param			rule_id		path	string	true	"Sync rule ID"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/space/{space_id}/sync_rules/{rule_id} [delete]
+func (h *SyncRuleHandler) DeleteSyncRule(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	ruleID, err := uuid.Parse(c.Param("rule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.Delete(c.Request.Context(), project.ID, spaceID, ruleID); err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSyncRuleService is a mock implementation of SyncRuleService
+type MockSyncRuleService struct {
+	mock.Mock
+}
+
+func (m *MockSyncRuleService) Create(ctx context.Context, in service.CreateSyncRuleInput) (*model.SyncRule, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleService) List(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error) {
+	args := m.Called(ctx, projectID, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleService) Update(ctx context.Context, in service.UpdateSyncRuleInput) (*model.SyncRule, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleService) Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, ruleID uuid.UUID) error {
+	args := m.Called(ctx, projectID, spaceID, ruleID)
+	return args.Error(0)
+}
+
+func (m *MockSyncRuleService) HandleDelivery(ctx context.Context, body []byte) error {
+	args := m.Called(ctx, body)
+	return args.Error(0)
+}
+
+func (m *MockSyncRuleService) SyncMessage(ctx context.Context, ev service.SendMQPublishJSON) ([]uuid.UUID, error) {
+	args := m.Called(ctx, ev)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func setupSyncRuleRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	return gin.New()
+}
+
+func TestSyncRuleHandler_CreateSyncRule(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		setup          func(*MockSyncRuleService)
+		expectedStatus int
+	}{
+		{
+			name: "success, enabled by default",
+			requestBody: CreateSyncRuleReq{
+				Name:         "Decisions",
+				Match:        SyncRuleMatchReq{Tags: []string{"decision"}},
+				TargetPageID: pageID.String(),
+			},
+			setup: func(svc *MockSyncRuleService) {
+				svc.On("Create", mock.Anything, service.CreateSyncRuleInput{
+					ProjectID:    projectID,
+					SpaceID:      spaceID,
+					Name:         "Decisions",
+					Match:        model.SyncRuleMatch{Tags: []string{"decision"}},
+					TargetPageID: pageID,
+					Enabled:      true,
+				}).Return(&model.SyncRule{ID: uuid.New(), SpaceID: spaceID, TargetPageID: pageID, Enabled: true}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid target page id",
+			requestBody:    map[string]interface{}{"target_page_id": "invalid", "match": map[string]interface{}{"tags": []string{"decision"}}},
+			setup:          func(svc *MockSyncRuleService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid role",
+			requestBody:    map[string]interface{}{"target_page_id": pageID.String(), "match": map[string]interface{}{"roles": []string{"tool"}}},
+			setup:          func(svc *MockSyncRuleService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "empty match",
+			requestBody: CreateSyncRuleReq{TargetPageID: pageID.String()},
+			setup: func(svc *MockSyncRuleService) {
+				svc.On("Create", mock.Anything, mock.Anything).Return(nil, service.ErrSyncRuleEmptyMatch)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "service layer error",
+			requestBody: CreateSyncRuleReq{
+				Match:        SyncRuleMatchReq{Contains: "decided"},
+				TargetPageID: pageID.String(),
+			},
+			setup: func(svc *MockSyncRuleService) {
+				svc.On("Create", mock.Anything, mock.Anything).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSyncRuleService{}
+			tt.setup(mockService)
+
+			handler := NewSyncRuleHandler(mockService)
+			router := setupSyncRuleRouter()
+			router.POST("/space/:space_id/sync_rules", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.CreateSyncRule(c)
+			})
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/space/"+spaceID.String()+"/sync_rules", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSyncRuleHandler_UpdateSyncRule(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	ruleID := uuid.New()
+
+	mockService := &MockSyncRuleService{}
+	mockService.On("Update", mock.Anything, mock.MatchedBy(func(in service.UpdateSyncRuleInput) bool {
+		return in.RuleID == ruleID && in.Enabled != nil && !*in.Enabled && in.Name == nil && in.Match == nil
+	})).Return(&model.SyncRule{ID: ruleID, Enabled: false}, nil)
+
+	handler := NewSyncRuleHandler(mockService)
+	router := setupSyncRuleRouter()
+	router.PATCH("/space/:space_id/sync_rules/:rule_id", func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+		handler.UpdateSyncRule(c)
+	})
+
+	req := httptest.NewRequest("PATCH", "/space/"+spaceID.String()+"/sync_rules/"+ruleID.String(), bytes.NewBufferString(`{"enabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
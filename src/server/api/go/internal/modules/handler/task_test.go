@@ -29,6 +29,30 @@ func (m *MockTaskService) GetTasks(ctx context.Context, in service.GetTasksInput
 	return args.Get(0).(*service.GetTasksOutput), args.Error(1)
 }
 
+func (m *MockTaskService) GetJobTasks(ctx context.Context, in service.GetJobTasksInput) (*service.GetTasksOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.GetTasksOutput), args.Error(1)
+}
+
+func (m *MockTaskService) StartJob(ctx context.Context, projectID uuid.UUID, kind string, data map[string]interface{}) *model.Task {
+	args := m.Called(ctx, projectID, kind, data)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*model.Task)
+}
+
+func (m *MockTaskService) UpdateJob(ctx context.Context, task *model.Task, status string, data map[string]interface{}) {
+	m.Called(ctx, task, status, data)
+}
+
+func (m *MockTaskService) FinishJob(ctx context.Context, task *model.Task, err error, data map[string]interface{}) {
+	m.Called(ctx, task, err, data)
+}
+
 func TestTaskHandler_GetTasks(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	serializer.SetLogger(zap.NewNop())
@@ -52,7 +76,7 @@ func TestTaskHandler_GetTasks(t *testing.T) {
 					Items: []model.Task{
 						{
 							ID:        uuid.New(),
-							SessionID: sessionID,
+							SessionID: &sessionID,
 							Status:    "pending",
 						},
 					},
@@ -85,7 +109,7 @@ func TestTaskHandler_GetTasks(t *testing.T) {
 					Items: []model.Task{
 						{
 							ID:        uuid.New(),
-							SessionID: sessionID,
+							SessionID: &sessionID,
 							Status:    "success",
 						},
 					},
@@ -173,3 +197,56 @@ func TestTaskHandler_GetTasks(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskHandler_GetJobTasks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serializer.SetLogger(zap.NewNop())
+
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		setup          func(*MockTaskService)
+		expectedStatus int
+	}{
+		{
+			name:        "success - of one kind",
+			queryParams: "?kind=bulk_delete&time_desc=true",
+			setup: func(svc *MockTaskService) {
+				svc.On("GetJobTasks", mock.Anything, mock.MatchedBy(func(in service.GetJobTasksInput) bool {
+					return in.ProjectID == projectID && in.Kind == model.TaskKindBulkDelete && in.Limit == 20 && in.TimeDesc
+				})).Return(&service.GetTasksOutput{
+					Items: []model.Task{{ID: uuid.New(), ProjectID: projectID, Kind: model.TaskKindBulkDelete, Status: model.TaskStatusRunning}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "error - unknown kind",
+			queryParams:    "?kind=agent",
+			setup:          func(svc *MockTaskService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &MockTaskService{}
+			tt.setup(svc)
+
+			handler := NewTaskHandler(svc)
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+			})
+			r.GET("/project/tasks", handler.GetJobTasks)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/project/tasks"+tt.queryParams, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type ToolCallHandler struct {
+	svc service.ToolCallService
+}
+
+func NewToolCallHandler(s service.ToolCallService) *ToolCallHandler {
+	return &ToolCallHandler{svc: s}
+}
+
+type ListToolCallsReq struct {
+	Limit   int    `form:"limit,default=50" json:"limit" binding:"required,min=1,max=200" example:"50"`
+	Cursor  string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	Name    string `form:"name" json:"name" example:"get_weather"`
+	Pending bool   `form:"pending" json:"pending" example:"false"`
+}
+
+// ListToolCalls godoc
+//
+//	@Summary		List tool calls of session
+//	@Description	List the tool calls of a session paired with their results, in the order they were made. A tool-call part with an id is paired with the tool-result part whose tool_call_id matches it; latency_ms is the time between the two messages. Calls without result yet have a null result, pending=true lists only those. Tool calls are recorded as messages are stored.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			limit		query	int		false	"Limit of tool calls to return, default 50. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			name		query	string	false	"Only the calls of this tool"
+//	@Param			pending		query	bool	false	"Only the calls without result"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListToolCallsOutput}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/session/{session_id}/tool_calls [get]
+func (h *ToolCallHandler) ListToolCalls(c *gin.Context) {
+	req := ListToolCallsReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.List(c.Request.Context(), service.ListToolCallsInput{
+		SessionID: sessionID,
+		Name:      req.Name,
+		Pending:   req.Pending,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	setPaginationLinks(c, out.NextCursor)
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
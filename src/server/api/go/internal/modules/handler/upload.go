@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/mimesniff"
+)
+
+var (
+	errFileTooLarge        = errors.New("file too large")
+	errMessageTooLarge     = errors.New("files of the message are too large")
+	errUnsupportedFileType = errors.New("unsupported file type")
+)
+
+// checkUploads enforces the size and content type limits of cfg on the files of one request
+func checkUploads(cfg config.UploadCfg, files []*multipart.FileHeader) error {
+	var total int64
+	for _, fh := range files {
+		if cfg.MaxFileBytes > 0 && fh.Size > cfg.MaxFileBytes {
+			return fmt.Errorf("%w: %s is %d bytes, the limit is %d", errFileTooLarge, fh.Filename, fh.Size, cfg.MaxFileBytes)
+		}
+		total += fh.Size
+
+		contentType := mimesniff.BaseType(fh.Header.Get("Content-Type"))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if !mimeAllowed(cfg.AllowedMIMETypes, contentType) {
+			return fmt.Errorf("%w: %s has type %s", errUnsupportedFileType, fh.Filename, contentType)
+		}
+	}
+	if cfg.MaxMessageBytes > 0 && total > cfg.MaxMessageBytes {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", errMessageTooLarge, total, cfg.MaxMessageBytes)
+	}
+	return nil
+}
+
+// checkDirectUpload enforces the limits of cfg on a file uploaded straight to S3, from its declared size and type
+func checkDirectUpload(cfg config.UploadCfg, filename string, contentType string, size int64) error {
+	if cfg.MaxDirectBytes > 0 && size > cfg.MaxDirectBytes {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d", errFileTooLarge, filename, size, cfg.MaxDirectBytes)
+	}
+	if !mimeAllowed(cfg.AllowedMIMETypes, mimesniff.BaseType(contentType)) {
+		return fmt.Errorf("%w: %s has type %s", errUnsupportedFileType, filename, contentType)
+	}
+	return nil
+}
+
+// mimeAllowed matches contentType against the allowlist, an empty allowlist accepts every type
+func mimeAllowed(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		a = mimesniff.BaseType(a)
+		if a == "*/*" || a == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// respondUploadErr writes the response of a checkUploads error
+func respondUploadErr(c *gin.Context, err error) {
+	status := http.StatusRequestEntityTooLarge
+	if errors.Is(err, errUnsupportedFileType) {
+		status = http.StatusUnsupportedMediaType
+	}
+	c.JSON(status, serializer.Err(status, err.Error(), nil))
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileHeader(name, contentType string, size int64) *multipart.FileHeader {
+	h := textproto.MIMEHeader{}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	return &multipart.FileHeader{Filename: name, Header: h, Size: size}
+}
+
+func TestCheckUploads(t *testing.T) {
+	cfg := config.UploadCfg{
+		MaxFileBytes:     100,
+		MaxMessageBytes:  150,
+		AllowedMIMETypes: []string{"image/*", "application/pdf"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.UploadCfg
+		files   []*multipart.FileHeader
+		wantErr error
+	}{
+		{
+			name:  "within limits",
+			cfg:   cfg,
+			files: []*multipart.FileHeader{fileHeader("a.png", "image/png", 100), fileHeader("b.pdf", "application/pdf; name=b.pdf", 50)},
+		},
+		{
+			name:    "file too large",
+			cfg:     cfg,
+			files:   []*multipart.FileHeader{fileHeader("a.png", "image/png", 101)},
+			wantErr: errFileTooLarge,
+		},
+		{
+			name:    "message too large",
+			cfg:     cfg,
+			files:   []*multipart.FileHeader{fileHeader("a.png", "image/png", 100), fileHeader("b.png", "image/png", 51)},
+			wantErr: errMessageTooLarge,
+		},
+		{
+			name:    "type not allowed",
+			cfg:     cfg,
+			files:   []*multipart.FileHeader{fileHeader("a.txt", "text/plain", 10)},
+			wantErr: errUnsupportedFileType,
+		},
+		{
+			name:    "missing type is octet-stream",
+			cfg:     cfg,
+			files:   []*multipart.FileHeader{fileHeader("a.bin", "", 10)},
+			wantErr: errUnsupportedFileType,
+		},
+		{
+			name:  "no limits",
+			cfg:   config.UploadCfg{},
+			files: []*multipart.FileHeader{fileHeader("a.bin", "", 1<<40)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUploads(tt.cfg, tt.files)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDirectUpload(t *testing.T) {
+	cfg := config.UploadCfg{
+		MaxFileBytes:     100,
+		MaxDirectBytes:   1 << 30,
+		AllowedMIMETypes: []string{"video/*"},
+	}
+
+	// The limit of direct uploads applies, not the one of files sent through the API
+	assert.NoError(t, checkDirectUpload(cfg, "a.mp4", "video/mp4", 1<<30))
+	assert.ErrorIs(t, checkDirectUpload(cfg, "a.mp4", "video/mp4", 1<<30+1), errFileTooLarge)
+	assert.ErrorIs(t, checkDirectUpload(cfg, "a.bin", "application/octet-stream", 10), errUnsupportedFileType)
+	assert.NoError(t, checkDirectUpload(config.UploadCfg{}, "a.bin", "application/octet-stream", 1<<40))
+}
+
+func TestRespondUploadErr(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondUploadErr(c, errFileTooLarge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	respondUploadErr(c, errUnsupportedFileType)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type WindowPresetHandler struct {
+	svc service.WindowPresetService
+}
+
+func NewWindowPresetHandler(s service.WindowPresetService) *WindowPresetHandler {
+	return &WindowPresetHandler{svc: s}
+}
+
+// GetWindowPresets godoc
+//
+//	@Summary		Get window presets
+//	@Description	Get the context window presets usable with GET /session/{session_id}/window/{preset}: the built-in presets followed by the presets of the project. A project preset replaces the built-in preset of the same name.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.WindowPreset}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Router			/project/window_presets [get]
+func (h *WindowPresetHandler) GetWindowPresets(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.List(c.Request.Context(), project)})
+}
+
+type UpdateWindowPresetsReq struct {
+	// Presets replaces the presets of the project, built-in presets stay available
+	Presets []model.WindowPreset `json:"presets"`
+}
+
+// UpdateWindowPresets godoc
+//
+//	@Summary		Update window presets
+//	@Description	Replace the context window presets of the project. Each preset needs a name, a strategy (recent or summary), a positive max_tokens and a format; max_turns and keep_pinned are optional. An empty list removes all project presets.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.UpdateWindowPresetsReq	true	"UpdateWindowPresets payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.WindowPreset}
+//	@Failure		400	{object}	serializer.ErrorResponse
+//	@Failure		401	{object}	serializer.ErrorResponse
+//	@Failure		500	{object}	serializer.ErrorResponse
+//	@Router			/project/window_presets [put]
+func (h *WindowPresetHandler) UpdateWindowPresets(c *gin.Context) {
+	req := UpdateWindowPresetsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Update(c.Request.Context(), project, req.Presets)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWindowPreset) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
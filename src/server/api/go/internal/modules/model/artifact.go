@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // Reserved metadata keys that are not allowed in user metadata
@@ -34,17 +35,109 @@ func (Disk) TableName() string { return "disks" }
 
 type Artifact struct {
 	ID        uuid.UUID                 `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
-	DiskID    uuid.UUID                 `gorm:"type:uuid;not null;index;uniqueIndex:idx_disk_path_filename" json:"disk_id"`
-	Path      string                    `gorm:"type:text;not null;uniqueIndex:idx_disk_path_filename" json:"path"`
-	Filename  string                    `gorm:"type:text;not null;uniqueIndex:idx_disk_path_filename" json:"filename"`
+	DiskID    uuid.UUID                 `gorm:"type:uuid;not null;index;uniqueIndex:idx_disk_path_filename_live,where:trashed_at IS NULL" json:"disk_id"`
+	Path      string                    `gorm:"type:text;not null;uniqueIndex:idx_disk_path_filename_live" json:"path"`
+	Filename  string                    `gorm:"type:text;not null;uniqueIndex:idx_disk_path_filename_live" json:"filename"`
 	Meta      datatypes.JSONMap         `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
 	AssetMeta datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
 
+	// LastVerifiedAt is when a curator last confirmed the content is still accurate, see StaleItem
+	LastVerifiedAt *time.Time `gorm:"index" json:"last_verified_at"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
+	// TrashedAt is set when the artifact is deleted, it is hidden from queries and its asset is kept
+	// until it is restored or purged after the retention window
+	TrashedAt gorm.DeletedAt `gorm:"index" swaggertype:"string" json:"trashed_at"`
+
 	// Artifact <-> Disk
 	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 }
 
 func (Artifact) TableName() string { return "artifacts" }
+
+// ArtifactLease is a time bound write lock an agent holds on an artifact path, the path needs not exist yet
+type ArtifactLease struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	DiskID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_artifact_lease_disk_path_filename" json:"disk_id"`
+	Path      string    `gorm:"type:text;not null;uniqueIndex:idx_artifact_lease_disk_path_filename" json:"path"`
+	Filename  string    `gorm:"type:text;not null;uniqueIndex:idx_artifact_lease_disk_path_filename" json:"filename"`
+	Holder    string    `gorm:"type:text;not null" json:"holder"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// ArtifactLease <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ArtifactLease) TableName() string { return "artifact_leases" }
+
+// ArtifactUpload is a pending upload of an artifact straight to S3 with presigned URLs,
+// the artifact is created when the upload is finalized
+type ArtifactUpload struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null" json:"-"`
+	DiskID    uuid.UUID `gorm:"type:uuid;not null;index" json:"disk_id"`
+	Path      string    `gorm:"type:text;not null" json:"path"`
+	Filename  string    `gorm:"type:text;not null" json:"filename"`
+	// MIME, SizeB and SHA256 are declared by the client and checked against the uploaded content on finalize
+	MIME   string `gorm:"type:text;not null" json:"mime"`
+	SizeB  int64  `gorm:"not null" json:"size_b"`
+	SHA256 string `gorm:"type:text;not null" json:"sha256"`
+	S3Key  string `gorm:"type:text;not null" json:"-"`
+	// MultipartID is the S3 multipart upload of the content, empty when it is uploaded with a single PUT
+	MultipartID string `gorm:"type:text" json:"-"`
+	// PartSize is the size of every part of a multipart upload but the last one
+	PartSize int64 `gorm:"not null;default:0" json:"part_size,omitempty"`
+	// Exists is set when S3 already stores the content, nothing is uploaded then
+	Exists    bool              `gorm:"not null;default:false" json:"exists"`
+	Meta      datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
+	ExpiresAt time.Time         `gorm:"not null;index" json:"expires_at"`
+	// CompletedAt is set when the parts of a multipart upload are assembled, its content is then checked in the
+	// background and its artifact created, finalized by LeaseHolder
+	CompletedAt *time.Time `gorm:"index" json:"completed_at,omitempty"`
+	LeaseHolder string     `gorm:"type:text;not null;default:''" json:"-"`
+	// Failure tells why the check of a completed upload dropped its content, the upload is kept until it expires
+	Failure string `gorm:"type:text;not null;default:''" json:"failure,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// ArtifactUpload <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ArtifactUpload) TableName() string { return "artifact_uploads" }
+
+// PartCount returns the number of parts of a multipart upload, 0 for an upload with a single PUT
+func (u *ArtifactUpload) PartCount() int32 {
+	if u.PartSize <= 0 {
+		return 0
+	}
+	return int32((u.SizeB + u.PartSize - 1) / u.PartSize)
+}
+
+// PartBytes returns the size of part n of a multipart upload, numbered from 1
+func (u *ArtifactUpload) PartBytes(n int32) int64 {
+	if n < u.PartCount() {
+		return u.PartSize
+	}
+	return u.SizeB - int64(n-1)*u.PartSize
+}
+
+// ArtifactUploadPart is a part of a multipart ArtifactUpload sent through the API, a part sent again replaces it
+type ArtifactUploadPart struct {
+	UploadID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	PartNumber int32     `gorm:"primaryKey;autoIncrement:false" json:"part_number"`
+	ETag       string    `gorm:"type:text;not null" json:"etag"`
+	SizeB      int64     `gorm:"not null" json:"size_b"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// ArtifactUploadPart <-> ArtifactUpload
+	Upload *ArtifactUpload `gorm:"foreignKey:UploadID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ArtifactUploadPart) TableName() string { return "artifact_upload_parts" }
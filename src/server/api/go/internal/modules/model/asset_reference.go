@@ -56,6 +56,14 @@ type Asset struct {
 	SHA256 string `json:"sha256"`
 	MIME   string `json:"mime"`
 	SizeB  int64  `json:"size_b"`
+
+	// DeclaredMIME is the type sent by the client and DetectedMIME the one found from the content of an uploaded file,
+	// MIME is the declared type unless the content contradicts it
+	DeclaredMIME string `json:"declared_mime,omitempty"`
+	DetectedMIME string `json:"detected_mime,omitempty"`
+
+	// Encrypted objects are sealed with the data key of their project, they are served by the API instead of presigned URLs
+	Encrypted bool `json:"encrypted,omitempty"`
 }
 
 // IsOrphaned returns true if this asset has no references
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of auth events
+const (
+	AuthEventFailure = "failure" // a request failed authentication
+	AuthEventLockout = "lockout" // an IP or token prefix failed too often and is refused for a while
+	AuthEventMisuse  = "misuse"  // a valid project key was used against the rules of its project
+)
+
+// AuthEvent is an entry of the audit log of authentication, kept for security reviews
+type AuthEvent struct {
+	ID   uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Kind string    `gorm:"type:text;not null;index:idx_auth_event_kind_created_at,priority:1" json:"kind"`
+
+	IP string `gorm:"type:text;not null;default:'';index" json:"ip"`
+	// TokenPrefix is the start of the presented secret, never the whole token
+	TokenPrefix string     `gorm:"type:text;not null;default:''" json:"token_prefix"`
+	ProjectID   *uuid.UUID `gorm:"type:uuid;index" json:"project_id,omitempty"`
+	Reason      string     `gorm:"type:text;not null;default:''" json:"reason"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_auth_event_kind_created_at,priority:2" json:"created_at"`
+}
+
+func (AuthEvent) TableName() string { return "auth_events" }
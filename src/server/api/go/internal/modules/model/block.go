@@ -1,11 +1,14 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // BlockTypeConfig Define the configuration of block types
@@ -21,6 +24,13 @@ const (
 	BlockTypeFolder = "folder"
 	BlockTypeText   = "text"
 	BlockTypeSOP    = "sop"
+
+	BlockTypeReference = "reference"
+
+	BlockTypeCode     = "code"
+	BlockTypeTable    = "table"
+	BlockTypeTodo     = "todo"
+	BlockTypeMarkdown = "markdown"
 )
 
 // BlockType Define all supported block types
@@ -45,6 +55,31 @@ var BlockTypes = map[string]BlockTypeConfig{
 		AllowChildren: false,
 		RequireParent: true,
 	},
+	BlockTypeReference: {
+		Name:          BlockTypeReference,
+		AllowChildren: false,
+		RequireParent: true,
+	},
+	BlockTypeCode: {
+		Name:          BlockTypeCode,
+		AllowChildren: false,
+		RequireParent: true,
+	},
+	BlockTypeTable: {
+		Name:          BlockTypeTable,
+		AllowChildren: false,
+		RequireParent: true,
+	},
+	BlockTypeTodo: {
+		Name:          BlockTypeTodo,
+		AllowChildren: false,
+		RequireParent: true,
+	},
+	BlockTypeMarkdown: {
+		Name:          BlockTypeMarkdown,
+		AllowChildren: false,
+		RequireParent: true,
+	},
 }
 
 // IsValidBlockType Check if the given type is valid
@@ -70,7 +105,7 @@ func GetAllBlockTypes() map[string]BlockTypeConfig {
 type Block struct {
 	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 
-	SpaceID uuid.UUID `gorm:"type:uuid;not null;index:idx_blocks_space;index:idx_blocks_space_type_archived,priority:1;uniqueIndex:ux_blocks_space_parent_sort,priority:1" json:"space_id"`
+	SpaceID uuid.UUID `gorm:"type:uuid;not null;index:idx_blocks_space;index:idx_blocks_space_type_archived,priority:1;uniqueIndex:ux_blocks_space_parent_sort,priority:1;uniqueIndex:ux_blocks_space_slug,priority:1" json:"space_id"`
 	Space   *Space    `gorm:"constraint:fk_blocks_space,OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 
 	Type string `gorm:"type:text;not null;index:idx_blocks_space_type;index:idx_blocks_space_type_archived,priority:2" json:"type"`
@@ -81,17 +116,35 @@ type Block struct {
 	Title string                             `gorm:"type:text;not null;default:''" json:"title"`
 	Props datatypes.JSONType[map[string]any] `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"props"`
 
+	// Slug is the permalink of a page, unique in its space and kept when the page is renamed
+	Slug *string `gorm:"type:text;uniqueIndex:ux_blocks_space_slug,priority:2" json:"slug,omitempty" example:"getting-started"`
+
 	Sort       int64 `gorm:"not null;default:0;uniqueIndex:ux_blocks_space_parent_sort,priority:3" json:"sort"`
 	IsArchived bool  `gorm:"not null;default:false;index:idx_blocks_space_type_archived,priority:3;index" json:"is_archived"`
 
+	// LastVerifiedAt is when a curator last confirmed the content is still accurate, see StaleItem
+	LastVerifiedAt *time.Time `gorm:"index" json:"last_verified_at"`
+
 	Children  []*Block  `gorm:"foreignKey:ParentID;constraint:fk_blocks_children,OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	ToolSOPs  []ToolSOP `gorm:"foreignKey:SOPBlockID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// Version changes with every update of the block, by the API or the core. It is UpdatedAt in microseconds, the
+	// precision of the database, and is set on blocks read from the database.
+	Version int64 `gorm:"-" json:"version" example:"1767225600000000"`
 }
 
 func (Block) TableName() string { return "blocks" }
 
+// AfterFind sets the version of a block read from the database
+func (b *Block) AfterFind(tx *gorm.DB) error {
+	if !b.UpdatedAt.IsZero() {
+		b.Version = b.UpdatedAt.UnixMicro()
+	}
+	return nil
+}
+
 // Validate Validate the fields of a Block
 func (b *Block) Validate() error {
 	// Check if the type is valid
@@ -111,7 +164,7 @@ func (b *Block) Validate() error {
 		return fmt.Errorf("only page and folder type blocks can exist without a parent")
 	}
 
-	return nil
+	return b.ValidateProps()
 }
 
 // CanHaveChildren Check if the block type can have children
@@ -188,3 +241,179 @@ func (b *Block) SetFolderPath(path string) {
 	propsData["path"] = path
 	b.Props = datatypes.NewJSONType(propsData)
 }
+
+// BlockSearchProps are the props holding the text of blocks, searched with the title by full-text search
+var BlockSearchProps = []string{"notes", "preferences", "content", "text", "code"}
+
+// SearchText joins the title and the text props of the block, one per line
+func (b *Block) SearchText() string {
+	lines := []string{b.Title}
+	props := b.Props.Data()
+	for _, key := range BlockSearchProps {
+		if text, _ := props[key].(string); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MaxTableBlockColumns is the largest number of columns of a table block
+const MaxTableBlockColumns = 64
+
+// Types of the columns of a table block
+const (
+	TableColumnText    = "text"
+	TableColumnNumber  = "number"
+	TableColumnBoolean = "boolean"
+)
+
+// TableColumn is a column of the schema of a table block
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // text, number or boolean, text when empty
+}
+
+// ValidateProps Check the props against the block type
+// Rules:
+// - Code: language is a non-empty string, code a string
+// - Table: columns is a non-empty list of {name, type}, rows a list of rows holding a cell per column, each null or of the type of its column
+// - Todo: checked is a boolean, text a string
+// - Markdown: content is a string
+// - Reference: reference_block_id is the ID of the referenced block or page
+// Props other than language, columns and reference_block_id may be left out, the other block types accept any props
+func (b *Block) ValidateProps() error {
+	props := b.Props.Data()
+	var err error
+	switch b.Type {
+	case BlockTypeCode:
+		if language, _ := props["language"].(string); strings.TrimSpace(language) == "" {
+			err = errors.New("language is required")
+		} else {
+			err = stringProp(props, "code")
+		}
+	case BlockTypeTable:
+		var columns []TableColumn
+		if columns, err = TableColumns(props); err == nil {
+			err = validateTableRows(props["rows"], columns)
+		}
+	case BlockTypeTodo:
+		if checked, ok := props["checked"]; ok {
+			if _, isBool := checked.(bool); !isBool {
+				err = errors.New("checked must be a boolean")
+			}
+		}
+		if err == nil {
+			err = stringProp(props, "text")
+		}
+	case BlockTypeMarkdown:
+		err = stringProp(props, "content")
+	case BlockTypeReference:
+		if _, ok := b.ReferenceBlockID(); !ok {
+			err = errors.New("reference_block_id must be a block ID")
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid props for block type '%s': %w", b.Type, err)
+	}
+	return nil
+}
+
+// ReferenceBlockID Get the ID of the block referenced by a reference block from Props
+func (b *Block) ReferenceBlockID() (uuid.UUID, bool) {
+	if b.Type != BlockTypeReference {
+		return uuid.Nil, false
+	}
+	raw, _ := b.Props.Data()["reference_block_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil || id == uuid.Nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// TableColumns Get the column schema from the props of a table block
+func TableColumns(props map[string]any) ([]TableColumn, error) {
+	raw, ok := props["columns"].([]any)
+	if !ok || len(raw) == 0 {
+		return nil, errors.New("columns must be a non-empty list")
+	}
+	if len(raw) > MaxTableBlockColumns {
+		return nil, fmt.Errorf("a table has at most %d columns", MaxTableBlockColumns)
+	}
+
+	columns := make([]TableColumn, 0, len(raw))
+	names := make(map[string]bool, len(raw))
+	for i, c := range raw {
+		m, ok := c.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("column %d must be an object", i)
+		}
+		name, _ := m["name"].(string)
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("column %d requires a name", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate column name '%s'", name)
+		}
+		names[name] = true
+
+		column := TableColumn{Name: name, Type: TableColumnText}
+		if t, ok := m["type"]; ok && t != nil {
+			column.Type, _ = t.(string)
+		}
+		switch column.Type {
+		case TableColumnText, TableColumnNumber, TableColumnBoolean:
+		default:
+			return nil, fmt.Errorf("column '%s' has an invalid type, expected text, number or boolean", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func validateTableRows(rows any, columns []TableColumn) error {
+	if rows == nil {
+		return nil
+	}
+	list, ok := rows.([]any)
+	if !ok {
+		return errors.New("rows must be a list")
+	}
+	for i, r := range list {
+		cells, ok := r.([]any)
+		if !ok || len(cells) != len(columns) {
+			return fmt.Errorf("row %d must be a list of %d cells", i, len(columns))
+		}
+		for j, cell := range cells {
+			if cell == nil {
+				continue
+			}
+			valid := false
+			switch columns[j].Type {
+			case TableColumnText:
+				_, valid = cell.(string)
+			case TableColumnNumber:
+				switch cell.(type) {
+				case float64, float32, int, int64:
+					valid = true
+				}
+			case TableColumnBoolean:
+				_, valid = cell.(bool)
+			}
+			if !valid {
+				return fmt.Errorf("cell %d of row %d must be a %s", j, i, columns[j].Type)
+			}
+		}
+	}
+	return nil
+}
+
+func stringProp(props map[string]any, key string) error {
+	if v, ok := props[key]; ok && v != nil {
+		if _, isString := v.(string); !isString {
+			return fmt.Errorf("%s must be a string", key)
+		}
+	}
+	return nil
+}
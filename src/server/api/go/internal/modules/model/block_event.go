@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ProjectBlockWebhookConfigKey is the key under Project.Configs holding the URL the block events of the project are posted to
+const ProjectBlockWebhookConfigKey = "block_webhook"
+
+// BlockWebhook returns the URL the block events of the project are posted to, empty when they are only published to the queue
+func (p *Project) BlockWebhook() string {
+	url, _ := p.Configs[ProjectBlockWebhookConfigKey].(string)
+	return url
+}
+
+// BlockEventRow is a change of a row of blocks, recorded in the outbox by a trigger in the transaction of the change,
+// whether the API, the core or a cascaded delete made it. OldRow is null for an insert and NewRow for a delete.
+type BlockEventRow struct {
+	ID        int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	TxID      int64          `gorm:"not null;index" json:"tx_id"`
+	BlockID   uuid.UUID      `gorm:"type:uuid;not null" json:"block_id"`
+	OldRow    datatypes.JSON `gorm:"type:jsonb" json:"old_row"`
+	NewRow    datatypes.JSON `gorm:"type:jsonb" json:"new_row"`
+	CreatedAt time.Time      `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (BlockEventRow) TableName() string { return "block_events" }
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlockReference indexes the target of a reference block so the blocks referencing a block are found without
+// scanning the props. The target is in the props of the reference block, see Block.ReferenceBlockID. When the target
+// is deleted ReferenceBlockID is set to NULL and the reference is broken.
+type BlockReference struct {
+	BlockID uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_block_references_block" json:"block_id"`
+	Block   *Block    `gorm:"foreignKey:BlockID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+
+	ReferenceBlockID *uuid.UUID `gorm:"type:uuid;index:idx_block_references_reference_block" json:"reference_block_id"`
+	ReferenceBlock   *Block     `gorm:"foreignKey:ReferenceBlockID;references:ID;constraint:OnDelete:SET NULL,OnUpdate:CASCADE;" json:"-"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (BlockReference) TableName() string { return "block_references" }
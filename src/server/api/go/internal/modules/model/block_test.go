@@ -2,6 +2,7 @@ package model
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -409,6 +410,10 @@ func TestBlockTypeConstants(t *testing.T) {
 		assert.Equal(t, "folder", BlockTypeFolder)
 		assert.Equal(t, "text", BlockTypeText)
 		assert.Equal(t, "sop", BlockTypeSOP)
+		assert.Equal(t, "code", BlockTypeCode)
+		assert.Equal(t, "table", BlockTypeTable)
+		assert.Equal(t, "todo", BlockTypeTodo)
+		assert.Equal(t, "markdown", BlockTypeMarkdown)
 	})
 }
 
@@ -691,3 +696,97 @@ func TestBlock_SetFolderPath(t *testing.T) {
 		})
 	}
 }
+
+func TestBlock_ValidateProps(t *testing.T) {
+	parentID := uuid.New()
+	columns := []any{
+		map[string]any{"name": "tool"},
+		map[string]any{"name": "calls", "type": "number"},
+		map[string]any{"name": "enabled", "type": "boolean"},
+	}
+
+	tests := []struct {
+		name      string
+		blockType string
+		props     map[string]any
+		errMsg    string
+	}{
+		{name: "text accepts any props", blockType: BlockTypeText, props: map[string]any{"notes": 1}},
+		{name: "code", blockType: BlockTypeCode, props: map[string]any{"language": "go", "code": "package main"}},
+		{name: "code without language", blockType: BlockTypeCode, props: map[string]any{"code": "package main"}, errMsg: "language is required"},
+		{name: "code without props", blockType: BlockTypeCode, errMsg: "language is required"},
+		{name: "code not a string", blockType: BlockTypeCode, props: map[string]any{"language": "go", "code": 1.0}, errMsg: "code must be a string"},
+		{
+			name:      "table",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": columns, "rows": []any{[]any{"grep", 3.0, true}, []any{"ls", nil, false}}},
+		},
+		{name: "table without rows", blockType: BlockTypeTable, props: map[string]any{"columns": columns}},
+		{name: "table without columns", blockType: BlockTypeTable, props: map[string]any{"rows": []any{}}, errMsg: "columns must be a non-empty list"},
+		{
+			name:      "table column without name",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": []any{map[string]any{"type": "text"}}},
+			errMsg:    "column 0 requires a name",
+		},
+		{
+			name:      "table duplicate column",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": []any{map[string]any{"name": "a"}, map[string]any{"name": "a"}}},
+			errMsg:    "duplicate column name 'a'",
+		},
+		{
+			name:      "table invalid column type",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": []any{map[string]any{"name": "a", "type": "date"}}},
+			errMsg:    "column 'a' has an invalid type",
+		},
+		{
+			name:      "table row with missing cells",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": columns, "rows": []any{[]any{"grep", 3.0}}},
+			errMsg:    "row 0 must be a list of 3 cells",
+		},
+		{
+			name:      "table cell of the wrong type",
+			blockType: BlockTypeTable,
+			props:     map[string]any{"columns": columns, "rows": []any{[]any{"grep", "three", true}}},
+			errMsg:    "cell 1 of row 0 must be a number",
+		},
+		{name: "todo", blockType: BlockTypeTodo, props: map[string]any{"checked": true, "text": "write tests"}},
+		{name: "todo without checked", blockType: BlockTypeTodo, props: map[string]any{"text": "write tests"}},
+		{name: "todo checked not a boolean", blockType: BlockTypeTodo, props: map[string]any{"checked": "yes"}, errMsg: "checked must be a boolean"},
+		{name: "markdown", blockType: BlockTypeMarkdown, props: map[string]any{"content": "# Notes"}},
+		{name: "markdown not a string", blockType: BlockTypeMarkdown, props: map[string]any{"content": []any{}}, errMsg: "content must be a string"},
+		{name: "reference", blockType: BlockTypeReference, props: map[string]any{"reference_block_id": uuid.NewString()}},
+		{name: "reference without target", blockType: BlockTypeReference, errMsg: "reference_block_id must be a block ID"},
+		{name: "reference not an ID", blockType: BlockTypeReference, props: map[string]any{"reference_block_id": "page-1"}, errMsg: "reference_block_id must be a block ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Block{Type: tt.blockType, ParentID: &parentID}
+			if tt.props != nil {
+				b.Props = datatypes.NewJSONType(tt.props)
+			}
+
+			err := b.Validate()
+			if tt.errMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBlock_AfterFind(t *testing.T) {
+	b := &Block{UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 123456000, time.UTC)}
+	assert.NoError(t, b.AfterFind(nil))
+	assert.Equal(t, int64(1767225600123456), b.Version)
+
+	unread := &Block{}
+	assert.NoError(t, unread.AfterFind(nil))
+	assert.Zero(t, unread.Version)
+}
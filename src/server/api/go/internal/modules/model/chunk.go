@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	ChunkSourceArtifact = "artifact"
+	ChunkSourceBlock    = "block"
+)
+
+// Chunk is a retrievable piece of an artifact or a page/text block, with a back-reference to its source
+type Chunk struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index:ix_chunk_project_id" json:"project_id"`
+
+	SourceType string            `gorm:"type:text;not null;check:source_type IN ('artifact','block');uniqueIndex:uq_chunk_source_index,priority:1" json:"source_type"`
+	SourceID   uuid.UUID         `gorm:"type:uuid;not null;uniqueIndex:uq_chunk_source_index,priority:2" json:"source_id"`
+	SourceRef  datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"source_ref"`
+
+	ChunkIndex int    `gorm:"not null;uniqueIndex:uq_chunk_source_index,priority:3" json:"index"`
+	Heading    string `gorm:"type:text;not null;default:''" json:"heading"`
+	Content    string `gorm:"type:text;not null" json:"content"`
+	TokenCount int    `gorm:"not null;default:0" json:"token_count"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// Chunk <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (Chunk) TableName() string { return "chunks" }
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProjectDataKey is the key sealing the S3 objects of a project, stored wrapped by the master key of a KMS.
+// It outlives its project, objects copied to other projects by a clone are still sealed with it.
+type ProjectDataKey struct {
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey" json:"project_id"`
+	KMS       string    `gorm:"type:text;not null" json:"kms"`
+	// KeyID identifies the master key that wrapped the data key
+	KeyID      string    `gorm:"type:text;not null;default:''" json:"key_id"`
+	WrappedKey []byte    `gorm:"type:bytea;not null" json:"-"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (ProjectDataKey) TableName() string { return "project_data_keys" }
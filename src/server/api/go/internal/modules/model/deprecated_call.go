@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeprecatedCall counts the calls of a project to a deprecated endpoint or parameter on a day (UTC), so operators know
+// who still uses it before its sunset
+type DeprecatedCall struct {
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey" json:"project_id"`
+	// Deprecation is the key of the deprecation, see service.Deprecation
+	Deprecation string    `gorm:"type:text;primaryKey" json:"deprecation"`
+	Day         time.Time `gorm:"type:date;primaryKey;index" json:"day"`
+
+	Calls        int64     `gorm:"not null;default:0" json:"calls"`
+	LastCalledAt time.Time `gorm:"not null" json:"last_called_at"`
+
+	// DeprecatedCall <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (DeprecatedCall) TableName() string { return "deprecated_calls" }
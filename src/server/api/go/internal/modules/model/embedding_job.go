@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProjectEmbeddingConfigKey is the key under Project.Configs holding the embedding settings
+const ProjectEmbeddingConfigKey = "embedding"
+
+const (
+	EmbeddingJobStatusPending   = "pending"
+	EmbeddingJobStatusRunning   = "running"
+	EmbeddingJobStatusSuccess   = "success"
+	EmbeddingJobStatusFailed    = "failed"
+	EmbeddingJobStatusCancelled = "cancelled"
+)
+
+// EmbeddingConfig describes the embedding model used to vectorize a project's blocks
+type EmbeddingConfig struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
+}
+
+// EmbeddingJob tracks the re-embedding of a project's blocks after the embedding model changes
+type EmbeddingJob struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index:ix_embedding_job_project_id_status,priority:1;uniqueIndex:ux_embedding_job_project_active,where:status = 'pending' OR status = 'running'" json:"project_id"` // one pending or running job per project
+
+	Provider       string `gorm:"type:text;not null" json:"provider"`
+	Model          string `gorm:"type:text;not null" json:"model"`
+	Dimensions     int    `gorm:"not null" json:"dimensions"`
+	PrevModel      string `gorm:"type:text" json:"prev_model,omitempty"`
+	PrevDimensions int    `json:"prev_dimensions,omitempty"`
+
+	Status    string  `gorm:"type:text;not null;default:'pending';check:status IN ('pending','running','success','failed','cancelled');index:ix_embedding_job_project_id_status,priority:2" json:"status"`
+	Total     int     `gorm:"not null;default:0" json:"total"`
+	Processed int     `gorm:"not null;default:0" json:"processed"`
+	Error     *string `gorm:"type:text" json:"error,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// EmbeddingJob <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (EmbeddingJob) TableName() string { return "embedding_jobs" }
+
+// IsActive reports whether the job is still pending or running
+func (j *EmbeddingJob) IsActive() bool {
+	return j.Status == EmbeddingJobStatusPending || j.Status == EmbeddingJobStatusRunning
+}
@@ -0,0 +1,30 @@
+package model
+
+// ProjectIngestAlertsConfigKey is the key under Project.Configs holding the ingest anomaly alerts of the project
+const ProjectIngestAlertsConfigKey = "ingest_alerts"
+
+// IngestAlertPolicy compares the messages stored in the last window with the average of the trailing baseline windows.
+// A spike is a window with more than SpikeFactor times the baseline, a drop a window with less than DropFactor times it.
+type IngestAlertPolicy struct {
+	WindowMinutes   int     `json:"window_minutes" example:"60"`
+	BaselineWindows int     `json:"baseline_windows" example:"24"`
+	SpikeFactor     float64 `json:"spike_factor" example:"3"`  // 0 disables spike alerts
+	DropFactor      float64 `json:"drop_factor" example:"0.2"` // 0 disables drop alerts
+	// MinMessages ignores quiet projects: a spike needs this many messages in the window, a drop this baseline
+	MinMessages int `json:"min_messages" example:"50"`
+}
+
+// IngestAlerts returns the ingest anomaly alerts of the project, nil when they are disabled
+func (p *Project) IngestAlerts() *IngestAlertPolicy {
+	m, ok := p.Configs[ProjectIngestAlertsConfigKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return &IngestAlertPolicy{
+		WindowMinutes:   configInt(m["window_minutes"]),
+		BaselineWindows: configInt(m["baseline_windows"]),
+		SpikeFactor:     configFloat(m["spike_factor"]),
+		DropFactor:      configFloat(m["drop_factor"]),
+		MinMessages:     configInt(m["min_messages"]),
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+// ProjectManifest declares the spaces, pages, tool references and notification webhook of a project, a project is
+// reconciled to match it with POST /project/apply. A nil list leaves the resources of its kind as they are.
+type ProjectManifest struct {
+	Spaces *[]SpaceManifest `json:"spaces,omitempty"`
+	Tools  *[]ToolManifest  `json:"tools,omitempty"`
+	// NotificationWebhook is the URL the notifications of the project are posted to, empty removes the webhook
+	NotificationWebhook *string `json:"notification_webhook,omitempty"`
+}
+
+// SpaceManifest is a space, identified by its name within the project
+type SpaceManifest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Pages are the pages at the root of the space, nil leaves the pages of the space as they are
+	Pages *[]PageManifest `json:"pages,omitempty"`
+}
+
+// PageManifest is a page at the root of a space, identified by its title within the space
+type PageManifest struct {
+	Title string         `json:"title"`
+	Props map[string]any `json:"props,omitempty"`
+	// Blocks are the content blocks of the page in order, nil leaves the blocks of the page as they are
+	Blocks *[]BlockManifest `json:"blocks,omitempty"`
+}
+
+// BlockManifest is a content block of a page, e.g. a text, code or table block
+type BlockManifest struct {
+	Type  string         `json:"type"`
+	Title string         `json:"title,omitempty"`
+	Props map[string]any `json:"props,omitempty"`
+}
+
+// ToolManifest is a tool reference, identified by its name within the project
+type ToolManifest struct {
+	Name            string         `json:"name"`
+	Description     string         `json:"description,omitempty"`
+	ArgumentsSchema map[string]any `json:"arguments_schema,omitempty"`
+}
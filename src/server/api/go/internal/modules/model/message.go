@@ -1,6 +1,11 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,24 +19,57 @@ const (
 	FormatAcontext  MessageFormat = "acontext"
 	FormatOpenAI    MessageFormat = "openai"
 	FormatAnthropic MessageFormat = "anthropic"
+	FormatGemini    MessageFormat = "gemini"
+	FormatAISDK     MessageFormat = "ai-sdk"
 )
 
 type Message struct {
 	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1" json:"session_id"`
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1;index:idx_session_role,priority:1" json:"session_id"`
 	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
 	Parent    *Message   `gorm:"foreignKey:ParentID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 	Children  []Message  `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 
-	Role string `gorm:"type:text;not null;check:role IN ('user','assistant','system')" json:"role"`
+	Role string `gorm:"type:text;not null;check:role IN ('user','assistant','system');index:idx_session_role,priority:2" json:"role"`
 
 	Meta datatypes.JSONType[map[string]any] `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"meta"`
 
 	PartsAssetMeta datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
 	Parts          []Part                    `gorm:"-" swaggertype:"array,object" json:"parts"`
 
+	// InlineParts holds the parts of small messages, PartsAssetMeta is then empty. See PartsInline.
+	InlineParts datatypes.JSONSlice[Part] `gorm:"type:jsonb" swaggertype:"-" json:"-"`
+
+	// PartTypes lists the distinct types of the parts, so messages can be filtered without downloading the parts.
+	// It is empty for messages stored before it was introduced.
+	PartTypes datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]';index:idx_messages_part_types,type:gin" swaggertype:"-" json:"-"`
+
+	// AssetSHA256s lists the assets uploaded with the parts, so references can be found without downloading the parts
+	AssetSHA256s datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]'" swaggertype:"-" json:"-"`
+
+	// ContentHash identifies the role and parts of the message, see MessageContentHash.
+	// It is empty for scheduled messages and messages stored before it was introduced.
+	ContentHash string `gorm:"type:text;not null;default:''" swaggertype:"-" json:"-"`
+
+	// SizeB is the size of the parts and of the assets uploaded with them, 0 for messages stored before it was introduced
+	SizeB int64 `gorm:"not null;default:0" swaggertype:"-" json:"-"`
+
+	// SearchText joins the text parts, so messages can be searched without downloading the parts.
+	// It is empty for messages stored before it was introduced.
+	SearchText string `gorm:"type:text;not null;default:''" swaggertype:"-" json:"-"`
+
+	// Usage is the token usage of the model call that produced the message, zero when not reported
+	Usage TokenUsage `gorm:"embedded;embeddedPrefix:usage_" json:"usage"`
+
+	// TurnID is shared by the messages stored together as one turn, nil for messages sent one at a time
+	TurnID *uuid.UUID `gorm:"type:uuid;index" json:"turn_id,omitempty"`
+
 	TaskID *uuid.UUID `gorm:"type:uuid;index" json:"task_id"`
 
+	// SupersededBy is the message regenerated in place of this one, both stay in the history
+	SupersededBy *uuid.UUID `gorm:"type:uuid;index" json:"superseded_by,omitempty"`
+	SupersededAt *time.Time `json:"superseded_at,omitempty"`
+
 	SessionTaskProcessStatus string `gorm:"type:text;not null;default:'pending';check:session_task_process_status IN ('success','failed','running','pending')" json:"session_task_process_status"`
 
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_session_created,priority:2,sort:desc" json:"created_at"`
@@ -46,6 +84,66 @@ type Message struct {
 
 func (Message) TableName() string { return "messages" }
 
+// PartsInline reports whether the parts are stored in InlineParts rather than in the S3 object of PartsAssetMeta
+func (m *Message) PartsInline() bool { return m.PartsAssetMeta.Data().S3Key == "" }
+
+// TokenUsage is the token usage reported by the client for a message
+type TokenUsage struct {
+	PromptTokens     int    `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int    `gorm:"not null;default:0" json:"completion_tokens"`
+	Model            string `gorm:"type:text;not null;default:''" json:"model"`
+}
+
+// PartTypes returns the distinct types of parts in order of appearance
+func PartTypes(parts []Part) []string {
+	types := []string{}
+	for _, p := range parts {
+		if !slices.Contains(types, p.Type) {
+			types = append(types, p.Type)
+		}
+	}
+	return types
+}
+
+// MessageSearchText joins the text of the text parts, one per line
+func MessageSearchText(parts []Part) string {
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// MessageContentHash hashes the role and parts of a message. Assets count by content, not by where they are stored,
+// and meta keys are sorted, so the same message sent twice has the same hash.
+func MessageContentHash(role string, parts []Part) string {
+	type hashedPart struct {
+		Type     string         `json:"type"`
+		Text     string         `json:"text,omitempty"`
+		Asset    string         `json:"asset,omitempty"`
+		Filename string         `json:"filename,omitempty"`
+		Meta     map[string]any `json:"meta,omitempty"`
+	}
+	hashed := make([]hashedPart, 0, len(parts))
+	for _, p := range parts {
+		hp := hashedPart{Type: p.Type, Text: p.Text, Filename: p.Filename, Meta: p.Meta}
+		if p.Asset != nil {
+			hp.Asset = p.Asset.SHA256
+		}
+		hashed = append(hashed, hp)
+	}
+	// encoding/json sorts map keys, the hash does not depend on the order of meta
+	b, _ := json.Marshal(hashed)
+
+	h := sha256.New()
+	h.Write([]byte(role))
+	h.Write([]byte{0})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 type Part struct {
 	// "text" | "image" | "audio" | "video" | "file" | "tool-call" | "tool-result" | "data"
 	Type string `json:"type"`
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Reactions of a MessageAnnotation
+const (
+	AnnotationReactionUp   = "up"
+	AnnotationReactionDown = "down"
+)
+
+// MessageAnnotation is the feedback given to a message by a labeler, e.g. an external labeling tool, a review team or a reviewer.
+// A message has at most one annotation per labeler, annotating it again replaces it.
+type MessageAnnotation struct {
+	MessageID uuid.UUID `gorm:"type:uuid;primaryKey" json:"message_id"`
+	Labeler   string    `gorm:"type:text;primaryKey" json:"labeler"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index" json:"session_id"`
+
+	Reaction string            `gorm:"type:text;not null;default:''" json:"reaction,omitempty" enums:"up,down"` // thumbs up or down
+	Label    string            `gorm:"type:text;not null;default:''" json:"label"`
+	Score    *float64          `json:"score,omitempty"`
+	Comment  string            `gorm:"type:text;not null;default:''" json:"comment,omitempty"`
+	Data     datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"data,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// MessageAnnotation <-> Message
+	Message *Message `gorm:"foreignKey:MessageID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (MessageAnnotation) TableName() string { return "message_annotations" }
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// MessageEmbedding is the embedding of the text of a message, computed by the embedding processor when the message
+// is stored. It is only reused while Model is the embedding model of the project.
+type MessageEmbedding struct {
+	MessageID uuid.UUID                    `gorm:"type:uuid;primaryKey" json:"message_id"`
+	Model     string                       `gorm:"type:text;not null" json:"model"`
+	Embedding datatypes.JSONSlice[float32] `gorm:"type:jsonb;not null" json:"embedding"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// MessageEmbedding <-> Message
+	Message *Message `gorm:"foreignKey:MessageID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (MessageEmbedding) TableName() string { return "message_embeddings" }
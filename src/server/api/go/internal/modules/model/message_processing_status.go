@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ProcessingStatusPending = "pending"
+	ProcessingStatusDone    = "done"
+	ProcessingStatusFailed  = "failed"
+)
+
+// MessageProcessingStatus is the state of one downstream processor (space sync, summary, embedding, ...) for a message.
+// Rows are written by the consumers once they processed the message, a processor without a row has not run yet.
+type MessageProcessingStatus struct {
+	MessageID uuid.UUID `gorm:"type:uuid;primaryKey" json:"message_id"`
+	Processor string    `gorm:"type:text;primaryKey" json:"processor"`
+
+	Status string `gorm:"type:text;not null;check:status IN ('pending','done','failed')" json:"status"`
+	Error  string `gorm:"type:text;not null;default:''" json:"error,omitempty"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// MessageProcessingStatus <-> Message
+	Message *Message `gorm:"foreignKey:MessageID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (MessageProcessingStatus) TableName() string { return "message_processing_statuses" }
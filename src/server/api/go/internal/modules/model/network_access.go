@@ -0,0 +1,86 @@
+package model
+
+import (
+	"net"
+	"strings"
+)
+
+// ProjectNetworkAccessConfigKey is the key under Project.Configs holding the network access rules of the project
+const ProjectNetworkAccessConfigKey = "network_access"
+
+// NetworkAccessPolicy restricts the client IPs allowed to use the API key of a project.
+// Deny rules win over allow rules; an IP matching neither is allowed unless DefaultDeny is set.
+type NetworkAccessPolicy struct {
+	Allow       []string `json:"allow" example:"203.0.113.0/24,198.51.100.7"` // CIDRs or single IPs
+	Deny        []string `json:"deny" example:"203.0.113.9"`
+	DefaultDeny bool     `json:"default_deny" example:"true"` // only IPs of allow are accepted
+}
+
+// NetworkAccess returns the network access rules of the project, nil when every IP is allowed
+func (p *Project) NetworkAccess() *NetworkAccessPolicy {
+	m, ok := p.Configs[ProjectNetworkAccessConfigKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	n := &NetworkAccessPolicy{
+		Allow: configStrings(m["allow"]),
+		Deny:  configStrings(m["deny"]),
+	}
+	n.DefaultDeny, _ = m["default_deny"].(bool)
+	return n
+}
+
+// Allows reports whether a client IP may use the project, rules that do not parse never match
+func (n *NetworkAccessPolicy) Allows(ip net.IP) bool {
+	if n == nil {
+		return true
+	}
+	if ip == nil {
+		return !n.DefaultDeny && len(n.Deny) == 0
+	}
+	for _, rule := range n.Deny {
+		if ipnet, err := ParseNetworkRule(rule); err == nil && ipnet.Contains(ip) {
+			return false
+		}
+	}
+	for _, rule := range n.Allow {
+		if ipnet, err := ParseNetworkRule(rule); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return !n.DefaultDeny
+}
+
+// ParseNetworkRule parses a CIDR, a single IP is a network of one address
+func ParseNetworkRule(rule string) (*net.IPNet, error) {
+	rule = strings.TrimSpace(rule)
+	if !strings.Contains(rule, "/") {
+		ip := net.ParseIP(rule)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: rule}
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(rule)
+	return ipnet, err
+}
+
+// configStrings reads a list of strings of a config map, JSON arrays are decoded as []interface{}
+func configStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
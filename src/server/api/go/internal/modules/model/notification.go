@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ProjectNotificationWebhookConfigKey is the key under Project.Configs holding the URL notifications of the project are posted to
+const ProjectNotificationWebhookConfigKey = "notification_webhook"
+
+// Kinds of notifications
+const (
+	NotificationKindIngestSpike = "ingest_spike"
+	NotificationKindIngestDrop  = "ingest_drop"
+	NotificationKindTokenMisuse = "token_misuse"
+)
+
+// Notification is an event of a project worth the attention of its owners, e.g. an ingest anomaly.
+// Notifications are kept so they can be listed, and posted to the webhook of the project when it has one.
+type Notification struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index:idx_notification_project_id_kind_created_at,priority:1" json:"project_id"`
+
+	Kind  string            `gorm:"type:text;not null;index:idx_notification_project_id_kind_created_at,priority:2" json:"kind"`
+	Title string            `gorm:"type:text;not null" json:"title"`
+	Data  datatypes.JSONMap `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"data"`
+
+	// DeliveredAt is set once the webhook accepted the notification, DeliveryError holds the last failure
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	DeliveryError string     `gorm:"type:text;not null;default:''" json:"delivery_error,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_notification_project_id_kind_created_at,priority:3" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// Notification <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (Notification) TableName() string { return "notifications" }
+
+// NotificationWebhook returns the URL the notifications of the project are posted to, empty when they are only listed
+func (p *Project) NotificationWebhook() string {
+	url, _ := p.Configs[ProjectNotificationWebhookConfigKey].(string)
+	return url
+}
@@ -0,0 +1,46 @@
+package model
+
+// ProjectPartTransformsConfigKey is the key under Project.Configs holding the part transform pipeline of the project
+const ProjectPartTransformsConfigKey = "part_transforms"
+
+// Part transforms applied to the parts of new messages
+const (
+	PartTransformNormalizeWhitespace = "normalize_whitespace" // normalizes line endings, trailing spaces and blank lines of text parts
+	PartTransformStripBase64Images   = "strip_base64_images"  // drops base64 image data larger than MaxBytes
+	PartTransformTruncateToolOutput  = "truncate_tool_output" // truncates tool results to MaxBytes, the full output is stored as the part asset
+)
+
+// Meta keys set on tool results archived by truncate_tool_output, the asset of the part holds the full output
+const (
+	PartMetaTruncated    = "truncated"
+	PartMetaOriginalSize = "original_size_b"
+)
+
+// PartTransformConfig is a step of a part transform pipeline, steps run in order
+type PartTransformConfig struct {
+	Name     string `json:"name" example:"truncate_tool_output"`
+	Enabled  bool   `json:"enabled"`
+	MaxBytes int    `json:"max_bytes,omitempty" example:"65536"`
+}
+
+// PartTransforms returns the part transform pipeline of the project, nil when the project uses the server one
+func (p *Project) PartTransforms() []PartTransformConfig {
+	raw, ok := p.Configs[ProjectPartTransformsConfigKey].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	out := make([]PartTransformConfig, 0, len(raw))
+	for _, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t := PartTransformConfig{}
+		t.Name, _ = m["name"].(string)
+		t.Enabled, _ = m["enabled"].(bool)
+		t.MaxBytes = configInt(m["max_bytes"])
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// ProjectPresignPolicyKey is the key under Project.Configs holding the presigned URL policy of the project
+const ProjectPresignPolicyKey = "presign_policy"
+
+// MaxPresignExpire is the longest a presigned URL may stay valid, the limit of S3 signature V4
+const MaxPresignExpire = 7 * 24 * time.Hour
+
+// PresignPolicy bounds the expiry of the presigned URLs of the assets and artifacts of a project
+type PresignPolicy struct {
+	DefaultExpireSec int `json:"default_expire_sec" example:"900"` // used when a request does not ask for an expiry, 0 keeps the default of each endpoint
+	MaxExpireSec     int `json:"max_expire_sec" example:"3600"`    // longest expiry a request may ask for, 0 allows up to 7 days
+}
+
+// PresignPolicy returns the presigned URL policy of the project, nil when the server defaults apply
+func (p *Project) PresignPolicy() *PresignPolicy {
+	m, ok := p.Configs[ProjectPresignPolicyKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return &PresignPolicy{
+		DefaultExpireSec: configInt(m["default_expire_sec"]),
+		MaxExpireSec:     configInt(m["max_expire_sec"]),
+	}
+}
@@ -7,12 +7,20 @@ import (
 	"gorm.io/datatypes"
 )
 
+// ProjectDebugTimingsConfigKey is the key under Project.Configs enabling the X-Acontext-Debug timing breakdown
+const ProjectDebugTimingsConfigKey = "debug_timings"
+
 type Project struct {
 	ID               uuid.UUID         `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	SecretKeyHMAC    string            `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
 	SecretKeyHashPHC string            `gorm:"type:varchar(255);not null" json:"-"`
 	Configs          datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"configs"`
 
+	// The key replaced by a rotation stays valid until PreviousKeyExpiresAt, or until the rotation is finalized
+	PreviousSecretKeyHMAC    *string    `gorm:"type:char(64);uniqueIndex" json:"-"`
+	PreviousSecretKeyHashPHC string     `gorm:"type:varchar(255);not null;default:''" json:"-"`
+	PreviousKeyExpiresAt     *time.Time `json:"-"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
@@ -30,6 +38,20 @@ type Project struct {
 
 	// Project <-> Metric
 	Metrics []Metric `gorm:"constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+
+	// Project <-> EmbeddingJob
+	EmbeddingJobs []EmbeddingJob `gorm:"constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 }
 
 func (Project) TableName() string { return "projects" }
+
+// PreviousKeyValid reports whether the key replaced by a rotation is still accepted at now
+func (p *Project) PreviousKeyValid(now time.Time) bool {
+	return p.PreviousSecretKeyHMAC != nil && p.PreviousKeyExpiresAt != nil && now.Before(*p.PreviousKeyExpiresAt)
+}
+
+// DebugTimingsEnabled reports whether requests of the project may ask for debug timings
+func (p *Project) DebugTimingsEnabled() bool {
+	enabled, _ := p.Configs[ProjectDebugTimingsConfigKey].(bool)
+	return enabled
+}
@@ -0,0 +1,26 @@
+package model
+
+// ProjectQuotaConfigKey is the key under Project.Configs holding the quota overrides of the project, set by operators
+const ProjectQuotaConfigKey = "quota"
+
+// QuotaLimits bounds what a project may store, a zero limit disables the quota
+type QuotaLimits struct {
+	MessagesPerDay int64 `json:"messages_per_day" example:"10000"`
+	StorageBytes   int64 `json:"storage_bytes" example:"1073741824"`
+}
+
+// Quota returns the quota limits of the project, the limits set in its configs override defaults
+func (p *Project) Quota(defaults QuotaLimits) QuotaLimits {
+	m, ok := p.Configs[ProjectQuotaConfigKey].(map[string]interface{})
+	if !ok {
+		return defaults
+	}
+	q := defaults
+	if _, ok := m["messages_per_day"]; ok {
+		q.MessagesPerDay = int64(configInt(m["messages_per_day"]))
+	}
+	if _, ok := m["storage_bytes"]; ok {
+		q.StorageBytes = int64(configInt(m["storage_bytes"]))
+	}
+	return q
+}
@@ -0,0 +1,66 @@
+package model
+
+// ProjectRedactionConfigKey is the key under Project.Configs holding the redaction policy of the project
+const ProjectRedactionConfigKey = "redaction"
+
+// MessageMetaRedactionKey is the key under the meta of a message holding its RedactionReport
+const MessageMetaRedactionKey = "redaction"
+
+// Detectors finding PII in text parts
+const (
+	RedactionDetectorRegex = "regex" // built-in patterns and the custom patterns of the policy
+	RedactionDetectorNER   = "ner"   // the named entity recognition service of the server, then the regex detector
+)
+
+// Kinds of PII masked by the built-in patterns
+const (
+	RedactionKindEmail  = "email"
+	RedactionKindAPIKey = "api_key"
+	RedactionKindPhone  = "phone"
+)
+
+// RedactionPattern is a custom regular expression, its matches are masked as Name
+type RedactionPattern struct {
+	Name  string `json:"name" example:"employee_id"`
+	Regex string `json:"regex" example:"EMP-[0-9]{6}"`
+}
+
+// RedactionPolicy masks PII in the text parts of new messages before they are stored.
+// Each match is replaced with [REDACTED:<kind>].
+type RedactionPolicy struct {
+	Enabled  bool               `json:"enabled"`
+	Detector string             `json:"detector" example:"regex"`            // regex or ner
+	Kinds    []string           `json:"kinds" example:"email,api_key,phone"` // kinds to mask, the ner detector also takes entity labels such as person; empty masks the built-in kinds
+	Patterns []RedactionPattern `json:"patterns,omitempty"`
+}
+
+// RedactionReport tells what was masked in a message, it never holds the masked values
+type RedactionReport struct {
+	Detector string         `json:"detector"`
+	Counts   map[string]int `json:"counts"` // matches masked by kind
+	Parts    []int          `json:"parts"`  // indexes of the redacted parts
+}
+
+// Redaction returns the redaction policy of the project, nil when nothing is redacted
+func (p *Project) Redaction() *RedactionPolicy {
+	m, ok := p.Configs[ProjectRedactionConfigKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	r := &RedactionPolicy{Kinds: configStrings(m["kinds"])}
+	r.Enabled, _ = m["enabled"].(bool)
+	r.Detector, _ = m["detector"].(string)
+	if raw, ok := m["patterns"].([]interface{}); ok {
+		for _, item := range raw {
+			pm, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			pattern := RedactionPattern{}
+			pattern.Name, _ = pm["name"].(string)
+			pattern.Regex, _ = pm["regex"].(string)
+			r.Patterns = append(r.Patterns, pattern)
+		}
+	}
+	return r
+}
@@ -0,0 +1,28 @@
+package model
+
+// ProjectRetentionConfigKey is the key under Project.Configs holding the session retention policy of the project
+const ProjectRetentionConfigKey = "retention"
+
+// Actions of a retention policy on idle sessions
+const (
+	RetentionActionArchive = "archive"
+	RetentionActionDelete  = "delete"
+)
+
+// RetentionPolicy archives or deletes the sessions of a project without activity for IdleDays
+type RetentionPolicy struct {
+	Action   string `json:"action" enums:"archive,delete" example:"archive"`
+	IdleDays int    `json:"idle_days" example:"30"`
+}
+
+// Retention returns the session retention policy of the project, nil when sessions are kept forever
+func (p *Project) Retention() *RetentionPolicy {
+	m, ok := p.Configs[ProjectRetentionConfigKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	r := &RetentionPolicy{}
+	r.Action, _ = m["action"].(string)
+	r.IdleDays = configInt(m["idle_days"])
+	return r
+}
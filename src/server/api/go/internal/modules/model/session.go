@@ -7,13 +7,39 @@ import (
 	"gorm.io/datatypes"
 )
 
+// SessionDedupeWindowConfigKey is the session config key of the dedupe window in seconds: a message repeating the role
+// and content of the message it follows within the window is refused. 0 or missing disables the check.
+const SessionDedupeWindowConfigKey = "dedupe_window"
+
 type Session struct {
 	ID        uuid.UUID         `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	ProjectID uuid.UUID         `gorm:"type:uuid;not null;index" json:"project_id"`
+	ProjectID uuid.UUID         `gorm:"type:uuid;not null;index;index:idx_sessions_project_end_user,priority:1" json:"project_id"`
 	SpaceID   *uuid.UUID        `gorm:"type:uuid;index" json:"space_id"`
-	Configs   datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"configs"`
+	Configs   datatypes.JSONMap `gorm:"type:jsonb;index:idx_sessions_configs,type:gin" swaggertype:"object" json:"configs"`
+
+	Title       string                      `gorm:"type:text;not null;default:''" json:"title"`
+	Description string                      `gorm:"type:text;not null;default:''" json:"description"`
+	Tags        datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]';index:idx_sessions_tags,type:gin" swaggertype:"array,string" json:"tags"`
+
+	// EndUserID is the user of the product the conversation belongs to, empty when not set
+	EndUserID string `gorm:"type:text;not null;default:'';index:idx_sessions_project_end_user,priority:2" json:"end_user_id,omitempty"`
+
+	// IsArchived hides the session from the session list unless archived sessions are asked for
+	IsArchived bool `gorm:"not null;default:false" json:"is_archived"`
 
-	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	// MessageCount, LastMessageAt and TotalBytes are kept as messages are stored, so sessions list with their stats.
+	// TotalBytes is the size of the parts of the messages and of the assets uploaded with them.
+	MessageCount  int64      `gorm:"not null;default:0" json:"message_count"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	TotalBytes    int64      `gorm:"not null;default:0" json:"total_bytes"`
+
+	// Summary is the rolling summary of the current branch up to SummaryMessageID, kept by the summarization worker
+	Summary          string     `gorm:"type:text;not null;default:''" json:"-"`
+	SummaryMessageID *uuid.UUID `gorm:"type:uuid" json:"-"`
+	SummaryMessages  int        `gorm:"not null;default:0" json:"-"`
+	SummaryUpdatedAt *time.Time `json:"-"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_sessions_project_end_user,priority:3" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
 	// Session <-> Project
@@ -30,3 +56,8 @@ type Session struct {
 }
 
 func (Session) TableName() string { return "sessions" }
+
+// DedupeWindow returns the dedupe window of the session, 0 when disabled
+func (s *Session) DedupeWindow() time.Duration {
+	return time.Duration(max(configInt(s.Configs[SessionDedupeWindowConfigKey]), 0)) * time.Second
+}
@@ -0,0 +1,26 @@
+package model
+
+// ProjectSessionConfigSchemaKey is the key under Project.Configs holding the schema of the session configs of the project
+const ProjectSessionConfigSchemaKey = "session_config_schema"
+
+// SessionConfigSchema is a JSON Schema the configs of the sessions of a project are validated against
+// when a session is created and when its configs are updated
+type SessionConfigSchema struct {
+	Schema map[string]interface{} `json:"schema" swaggertype:"object"`
+	Strict bool                   `json:"strict"` // keys of an object that its schema does not declare are rejected, unless additionalProperties allows them
+}
+
+// SessionConfigSchema returns the schema of the session configs of the project, nil when configs are not validated
+func (p *Project) SessionConfigSchema() *SessionConfigSchema {
+	m, ok := p.Configs[ProjectSessionConfigSchemaKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	schema, ok := m["schema"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s := &SessionConfigSchema{Schema: schema}
+	s.Strict, _ = m["strict"].(bool)
+	return s
+}
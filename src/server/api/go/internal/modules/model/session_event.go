@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Kinds of session events
+const (
+	SessionEventCreated          = "created"
+	SessionEventConnectedToSpace = "connected_to_space"
+	SessionEventConfigChanged    = "config_changed"
+	SessionEventMessageDeleted   = "message_deleted"
+	SessionEventArchived         = "archived"
+	SessionEventUnarchived       = "unarchived"
+)
+
+// SessionEvent is an entry of the lifecycle log of a session, kept for audits.
+// Events are written in the transaction of the change they record and are deleted with their session.
+type SessionEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index:idx_session_event_session_id_created_at,priority:1" json:"session_id"`
+
+	Kind string            `gorm:"type:text;not null" json:"kind"`
+	Data datatypes.JSONMap `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"data"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_session_event_session_id_created_at,priority:2" json:"created_at"`
+
+	// SessionEvent <-> Session
+	Session *Session `gorm:"foreignKey:SessionID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (SessionEvent) TableName() string { return "session_events" }
@@ -12,6 +12,10 @@ type Space struct {
 	ProjectID uuid.UUID         `gorm:"type:uuid;not null;index" json:"project_id"`
 	Configs   datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"configs"`
 
+	Name        string                      `gorm:"type:text;not null;default:''" json:"name"`
+	Description string                      `gorm:"type:text;not null;default:''" json:"description"`
+	Tags        datatypes.JSONSlice[string] `gorm:"type:jsonb;not null;default:'[]';index:idx_spaces_tags,type:gin" swaggertype:"array,string" json:"tags"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	StaleItemTypeBlock    = "block"
+	StaleItemTypeArtifact = "artifact"
+)
+
+// StaleItem is an entry of the review queue: a block or artifact that has been neither
+// verified nor updated for longer than the configured max age. Verifying or updating
+// the item removes it from the queue.
+type StaleItem struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+
+	ItemType string            `gorm:"type:text;not null;check:item_type IN ('block','artifact');uniqueIndex:uq_stale_item,priority:1" json:"item_type"`
+	ItemID   uuid.UUID         `gorm:"type:uuid;not null;uniqueIndex:uq_stale_item,priority:2" json:"item_id"`
+	ItemRef  datatypes.JSONMap `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"item_ref"` // space_id/type/title for blocks, disk_id/path/filename for artifacts
+
+	// LastVerifiedAt is the later of the item's last verification and last update when it was flagged
+	LastVerifiedAt time.Time `gorm:"not null" json:"last_verified_at"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// StaleItem <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (StaleItem) TableName() string { return "stale_items" }
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// SyncRuleMatch selects the session messages copied by a SyncRule. Every condition that is set must hold.
+type SyncRuleMatch struct {
+	Tags     []string `json:"tags,omitempty"`     // the message meta "tags" contains any of them
+	Roles    []string `json:"roles,omitempty"`    // the message role is one of them
+	Contains string   `json:"contains,omitempty"` // the message text contains it, case-insensitive
+}
+
+// IsEmpty reports whether no condition is set, a rule must not copy every message
+func (m SyncRuleMatch) IsEmpty() bool {
+	return len(m.Tags) == 0 && len(m.Roles) == 0 && m.Contains == ""
+}
+
+// Matches reports whether a message with the given role, meta and text satisfies the conditions
+func (m SyncRuleMatch) Matches(role string, meta map[string]any, text string) bool {
+	if len(m.Roles) > 0 && !slices.Contains(m.Roles, role) {
+		return false
+	}
+	if m.Contains != "" && !strings.Contains(strings.ToLower(text), strings.ToLower(m.Contains)) {
+		return false
+	}
+	if len(m.Tags) > 0 && !slices.ContainsFunc(MessageTags(meta), func(tag string) bool {
+		return slices.Contains(m.Tags, tag)
+	}) {
+		return false
+	}
+	return true
+}
+
+// MessageTags returns the tags of a message, set as a list or a single string in meta "tags"
+func MessageTags(meta map[string]any) []string {
+	switch v := meta["tags"].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		tags := make([]string, 0, len(v))
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// SyncRule copies the messages of the sessions connected to a space that match into a page of the space,
+// one text block per message, keeping a human-readable log of key agent outcomes.
+type SyncRule struct {
+	ID      uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SpaceID uuid.UUID `gorm:"type:uuid;not null;index" json:"space_id"`
+
+	Name  string                            `gorm:"type:text;not null;default:''" json:"name"`
+	Match datatypes.JSONType[SyncRuleMatch] `gorm:"type:jsonb;not null" swaggertype:"object" json:"match"`
+
+	TargetPageID uuid.UUID `gorm:"type:uuid;not null;index" json:"target_page_id"`
+	Enabled      bool      `gorm:"not null" json:"enabled"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// SyncRule <-> Space
+	Space *Space `gorm:"foreignKey:SpaceID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+
+	// SyncRule <-> Block
+	TargetPage *Block `gorm:"foreignKey:TargetPageID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (SyncRule) TableName() string { return "sync_rules" }
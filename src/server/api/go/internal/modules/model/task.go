@@ -7,11 +7,28 @@ import (
 	"gorm.io/datatypes"
 )
 
+// Kinds of tasks, agent tasks are planned by the core for a session, the others track long-running jobs of the server
+const (
+	TaskKindAgent      = "agent"
+	TaskKindExport     = "export"
+	TaskKindBulkDelete = "bulk_delete"
+	TaskKindReEmbed    = "re_embed"
+)
+
+const (
+	TaskStatusPending = "pending"
+	TaskStatusRunning = "running"
+	TaskStatusSuccess = "success"
+	TaskStatusFailed  = "failed"
+)
+
 type Task struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	SessionID uuid.UUID `gorm:"type:uuid;not null;index:ix_task_session_id;index:ix_task_session_id_task_id,priority:1;index:ix_task_session_id_status,priority:1;uniqueIndex:uq_session_id_order,priority:1" json:"session_id"`
-	ProjectID uuid.UUID `gorm:"type:uuid;not null;index:ix_task_project_id" json:"project_id"`
+	ID uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	// SessionID is nil for the jobs of the server, they belong to the project
+	SessionID *uuid.UUID `gorm:"type:uuid;index:ix_task_session_id;index:ix_task_session_id_task_id,priority:1;index:ix_task_session_id_status,priority:1;uniqueIndex:uq_session_id_order,priority:1" json:"session_id"`
+	ProjectID uuid.UUID  `gorm:"type:uuid;not null;index:ix_task_project_id;index:ix_task_project_id_kind,priority:1" json:"project_id"`
 
+	Kind          string            `gorm:"type:text;not null;default:'agent';index:ix_task_project_id_kind,priority:2" json:"kind"`
 	Order         int               `gorm:"not null;uniqueIndex:uq_session_id_order,priority:2" json:"order"`
 	Data          datatypes.JSONMap `gorm:"type:jsonb;not null" swaggertype:"object" json:"data"`
 	Status        string            `gorm:"type:text;not null;default:'pending';check:status IN ('success','failed','running','pending');index:ix_task_session_id_status,priority:2" json:"status"`
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ToolCallLink pairs a tool-call part of a session with the tool-result part answering it, matched by tool call id.
+// Links are recorded as messages are stored, a call without result is still pending.
+type ToolCallLink struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	SessionID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_tool_call_link_session_call,priority:1;index:idx_tool_call_link_session_created,priority:1" json:"session_id"`
+	ToolCallID string    `gorm:"type:text;not null;uniqueIndex:idx_tool_call_link_session_call,priority:2" json:"tool_call_id"`
+	Name       string    `gorm:"type:text;not null;default:''" json:"name"`
+
+	CallMessageID   *uuid.UUID `gorm:"type:uuid" json:"call_message_id"`
+	CalledAt        *time.Time `json:"called_at"`
+	ResultMessageID *uuid.UUID `gorm:"type:uuid" json:"result_message_id"`
+	ResultAt        *time.Time `json:"result_at"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_tool_call_link_session_created,priority:2" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// ToolCallLink <-> Session
+	Session *Session `gorm:"foreignKey:SessionID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ToolCallLink) TableName() string { return "tool_call_links" }
+
+// ToolCallLinks returns the links a message makes: one per tool-call id and one per tool-result tool_call_id, the
+// call or result side is set from the message. An id repeated in the message is linked once, named after its first
+// part with a name, since a single upsert cannot touch the same link twice.
+func ToolCallLinks(msg *Message) (calls []ToolCallLink, results []ToolCallLink) {
+	add := func(links []ToolCallLink, l ToolCallLink) []ToolCallLink {
+		for i := range links {
+			if links[i].ToolCallID == l.ToolCallID {
+				if links[i].Name == "" {
+					links[i].Name = l.Name
+				}
+				return links
+			}
+		}
+		return append(links, l)
+	}
+	for _, p := range msg.Parts {
+		switch p.Type {
+		case "tool-call":
+			id, _ := p.Meta["id"].(string)
+			if id == "" {
+				continue
+			}
+			name, _ := p.Meta["name"].(string)
+			calls = add(calls, ToolCallLink{SessionID: msg.SessionID, ToolCallID: id, Name: name, CallMessageID: &msg.ID, CalledAt: &msg.CreatedAt})
+		case "tool-result":
+			id, _ := p.Meta["tool_call_id"].(string)
+			if id == "" {
+				continue
+			}
+			name, _ := p.Meta["name"].(string)
+			results = add(results, ToolCallLink{SessionID: msg.SessionID, ToolCallID: id, Name: name, ResultMessageID: &msg.ID, ResultAt: &msg.CreatedAt})
+		}
+	}
+	return calls, results
+}
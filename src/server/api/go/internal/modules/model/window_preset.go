@@ -0,0 +1,63 @@
+package model
+
+// ProjectWindowPresetsConfigKey is the key under Project.Configs holding the context window presets of the project
+const ProjectWindowPresetsConfigKey = "window_presets"
+
+// MessageMetaPinned is the message meta key marking messages kept by presets with KeepPinned
+const MessageMetaPinned = "pinned"
+
+// WindowPreset is a named recipe for the context window of a session
+type WindowPreset struct {
+	Name       string `json:"name" example:"last-10-turns-plus-pins"`
+	Strategy   string `json:"strategy" enums:"recent,summary" example:"recent"`
+	MaxTokens  int    `json:"max_tokens" example:"8000"`
+	MaxTurns   int    `json:"max_turns,omitempty" example:"10"`     // only the last turns are kept, a turn starts at a user message, 0 keeps all
+	KeepPinned bool   `json:"keep_pinned,omitempty" example:"true"` // messages with meta.pinned are kept whatever their age
+	Format     string `json:"format" enums:"acontext,openai,anthropic,gemini,ai-sdk" example:"openai"`
+}
+
+// WindowPresets returns the context window presets defined by the project
+func (p *Project) WindowPresets() []WindowPreset {
+	raw, ok := p.Configs[ProjectWindowPresetsConfigKey].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	out := make([]WindowPreset, 0, len(raw))
+	for _, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		w := WindowPreset{}
+		w.Name, _ = m["name"].(string)
+		w.Strategy, _ = m["strategy"].(string)
+		w.Format, _ = m["format"].(string)
+		w.KeepPinned, _ = m["keep_pinned"].(bool)
+		w.MaxTokens = configInt(m["max_tokens"])
+		w.MaxTurns = configInt(m["max_turns"])
+		out = append(out, w)
+	}
+	return out
+}
+
+// configInt reads a number of a config map, JSON numbers are decoded as float64
+func configInt(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+func configFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	}
+	return 0
+}
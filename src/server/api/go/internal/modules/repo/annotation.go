@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AnnotationRepo interface {
+	ListForReview(ctx context.Context, projectID uuid.UUID, f ReviewFilter, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error)
+	MessageSessions(ctx context.Context, projectID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]uuid.UUID, error)
+	Upsert(ctx context.Context, annotations []model.MessageAnnotation) error
+	ListByMessage(ctx context.Context, messageID uuid.UUID) ([]model.MessageAnnotation, error)
+	Delete(ctx context.Context, messageID uuid.UUID, labeler string) (bool, error)
+}
+
+// ReviewFilter selects the messages of a project exported for labeling, every condition that is set must hold
+type ReviewFilter struct {
+	SessionIDs []uuid.UUID
+	SpaceID    *uuid.UUID
+	Roles      []string
+	// Labeler keeps the messages without an annotation of this labeler, empty keeps the messages without any annotation
+	Labeler string
+	// IncludeAnnotated keeps annotated messages too
+	IncludeAnnotated bool
+}
+
+type annotationRepo struct{ db *gorm.DB }
+
+func NewAnnotationRepo(db *gorm.DB) AnnotationRepo {
+	return &annotationRepo{db: db}
+}
+
+// ListForReview returns the messages of the project matching f, oldest first, after the cursor
+func (r *annotationRepo) ListForReview(ctx context.Context, projectID uuid.UUID, f ReviewFilter, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	sessions := r.db.Model(&model.Session{}).Select("id").Where("project_id = ?", projectID)
+	if len(f.SessionIDs) > 0 {
+		sessions = sessions.Where("id IN ?", f.SessionIDs)
+	}
+	if f.SpaceID != nil {
+		sessions = sessions.Where("space_id = ?", *f.SpaceID)
+	}
+
+	q := r.db.WithContext(ctx).Where("messages.session_id IN (?)", sessions)
+	if len(f.Roles) > 0 {
+		q = q.Where("messages.role IN ?", f.Roles)
+	}
+	if !f.IncludeAnnotated {
+		annotated := r.db.Model(&model.MessageAnnotation{}).Select("1").Where("message_annotations.message_id = messages.id")
+		if f.Labeler != "" {
+			annotated = annotated.Where("message_annotations.labeler = ?", f.Labeler)
+		}
+		q = q.Where("NOT EXISTS (?)", annotated)
+	}
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(messages.created_at > ?) OR (messages.created_at = ? AND messages.id > ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var msgs []model.Message
+	return msgs, q.Order("messages.created_at ASC, messages.id ASC").Limit(limit).Find(&msgs).Error
+}
+
+// MessageSessions returns the session of each message of messageIDs that belongs to the project
+func (r *annotationRepo) MessageSessions(ctx context.Context, projectID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	var rows []struct {
+		ID        uuid.UUID
+		SessionID uuid.UUID
+	}
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Select("messages.id, messages.session_id").
+		Joins("JOIN sessions ON sessions.id = messages.session_id").
+		Where("messages.id IN ? AND sessions.project_id = ?", messageIDs, projectID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[uuid.UUID]uuid.UUID, len(rows))
+	for _, row := range rows {
+		out[row.ID] = row.SessionID
+	}
+	return out, nil
+}
+
+// Upsert stores annotations, replacing the annotation of the same labeler on a message
+func (r *annotationRepo) Upsert(ctx context.Context, annotations []model.MessageAnnotation) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "labeler"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reaction", "label", "score", "comment", "data", "updated_at"}),
+	}).Create(&annotations).Error
+}
+
+// ListByMessage returns the annotations of a message, oldest first
+func (r *annotationRepo) ListByMessage(ctx context.Context, messageID uuid.UUID) ([]model.MessageAnnotation, error) {
+	var annotations []model.MessageAnnotation
+	return annotations, r.db.WithContext(ctx).Where("message_id = ?", messageID).Order("created_at ASC, labeler ASC").Find(&annotations).Error
+}
+
+// Delete removes the annotation of a labeler on a message, it reports whether there was one
+func (r *annotationRepo) Delete(ctx context.Context, messageID uuid.UUID, labeler string) (bool, error) {
+	res := r.db.WithContext(ctx).Where("message_id = ? AND labeler = ?", messageID, labeler).Delete(&model.MessageAnnotation{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type ApplyRepo interface {
+	LoadState(ctx context.Context, projectID uuid.UUID) (*ApplyState, error)
+	Apply(ctx context.Context, projectID uuid.UUID, plan *ApplyPlan) error
+}
+
+// ApplyState is what a manifest is reconciled against: the spaces of a project, the pages at the root of them that
+// are not archived with their blocks, and the tool references of the project
+type ApplyState struct {
+	Spaces []model.Space
+	// Pages have their Children loaded, ordered by sort
+	Pages []model.Block
+	// NextRootSort is the sort after the last root block of each space with root blocks
+	NextRootSort map[uuid.UUID]int64
+	Tools        []model.ToolReference
+}
+
+// ApplyPlan is a set of changes to the resources of a project, written at once by Apply
+type ApplyPlan struct {
+	CreateSpaces []model.Space
+	// UpdateSpaces write the description and tags of the spaces
+	UpdateSpaces   []model.Space
+	DeleteSpaceIDs []uuid.UUID
+
+	// CreateBlocks are new pages with their blocks and the new blocks of updated pages, each parent before its children.
+	// Slugs of new pages are suffixed with a number when taken in their space.
+	CreateBlocks []model.Block
+	// UpdatePages write the props of the pages
+	UpdatePages []model.Block
+	// DeleteBlockIDs are deleted pages and the replaced blocks of updated pages, deleted before any block is created
+	DeleteBlockIDs []uuid.UUID
+
+	CreateTools []model.ToolReference
+	// UpdateTools write the description and arguments schema of the tools
+	UpdateTools   []model.ToolReference
+	DeleteToolIDs []uuid.UUID
+
+	// Configs replace the configs of the project when not nil
+	Configs datatypes.JSONMap
+}
+
+type applyRepo struct{ db *gorm.DB }
+
+func NewApplyRepo(db *gorm.DB) ApplyRepo {
+	return &applyRepo{db: db}
+}
+
+func (r *applyRepo) LoadState(ctx context.Context, projectID uuid.UUID) (*ApplyState, error) {
+	db := r.db.WithContext(ctx)
+	state := &ApplyState{NextRootSort: map[uuid.UUID]int64{}}
+	if err := db.Where("project_id = ?", projectID).Order("created_at ASC, id ASC").Find(&state.Spaces).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("project_id = ?", projectID).Order("name ASC").Find(&state.Tools).Error; err != nil {
+		return nil, err
+	}
+	if len(state.Spaces) == 0 {
+		return state, nil
+	}
+
+	spaceIDs := make([]uuid.UUID, len(state.Spaces))
+	for i, s := range state.Spaces {
+		spaceIDs[i] = s.ID
+	}
+	err := db.
+		Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("sort ASC") }).
+		Where("space_id IN ? AND parent_id IS NULL AND type = ? AND is_archived = ?", spaceIDs, model.BlockTypePage, false).
+		Order("sort ASC").
+		Find(&state.Pages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var sorts []struct {
+		SpaceID  uuid.UUID
+		NextSort int64
+	}
+	err = db.Model(&model.Block{}).
+		Select("space_id, MAX(sort) + 1 AS next_sort").
+		Where("space_id IN ? AND parent_id IS NULL", spaceIDs).
+		Group("space_id").
+		Scan(&sorts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sorts {
+		state.NextRootSort[s.SpaceID] = s.NextSort
+	}
+	return state, nil
+}
+
+// Apply writes a plan in one transaction: deletions first, so the sort of replaced blocks can be reused
+func (r *applyRepo) Apply(ctx context.Context, projectID uuid.UUID, plan *ApplyPlan) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(plan.DeleteBlockIDs) > 0 {
+			if err := tx.Where("id IN ?", plan.DeleteBlockIDs).Delete(&model.Block{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(plan.DeleteSpaceIDs) > 0 {
+			if err := tx.Where("project_id = ? AND id IN ?", projectID, plan.DeleteSpaceIDs).Delete(&model.Space{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(plan.DeleteToolIDs) > 0 {
+			if err := tx.Where("project_id = ? AND id IN ?", projectID, plan.DeleteToolIDs).Delete(&model.ToolReference{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range plan.UpdateSpaces {
+			s := &plan.UpdateSpaces[i]
+			if err := tx.Model(&model.Space{ID: s.ID}).Select("description", "tags").Updates(s).Error; err != nil {
+				return err
+			}
+		}
+		if len(plan.CreateSpaces) > 0 {
+			if err := tx.Create(&plan.CreateSpaces).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(plan.CreateBlocks) > 0 {
+			if err := uniqueSlugs(tx, plan.CreateBlocks); err != nil {
+				return err
+			}
+			if err := tx.CreateInBatches(plan.CreateBlocks, 500).Error; err != nil {
+				return err
+			}
+		}
+		for i := range plan.UpdatePages {
+			b := &plan.UpdatePages[i]
+			if err := tx.Model(&model.Block{ID: b.ID}).Select("props").Updates(b).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(plan.CreateTools) > 0 {
+			if err := tx.Create(&plan.CreateTools).Error; err != nil {
+				return err
+			}
+		}
+		for i := range plan.UpdateTools {
+			t := &plan.UpdateTools[i]
+			if err := tx.Model(&model.ToolReference{ID: t.ID}).Select("description", "arguments_schema").Updates(t).Error; err != nil {
+				return err
+			}
+		}
+
+		if plan.Configs != nil {
+			return tx.Model(&model.Project{}).Where("id = ?", projectID).Update("configs", plan.Configs).Error
+		}
+		return nil
+	})
+}
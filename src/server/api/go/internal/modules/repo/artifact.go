@@ -2,11 +2,15 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ArtifactRepo interface {
@@ -17,6 +21,44 @@ type ArtifactRepo interface {
 	ListByPath(ctx context.Context, diskID uuid.UUID, path string) ([]*model.Artifact, error)
 	GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error)
 	ExistsByPathAndFilename(ctx context.Context, diskID uuid.UUID, path string, filename string, excludeID *uuid.UUID) (bool, error)
+	ListTrash(ctx context.Context, diskID uuid.UUID) ([]*model.Artifact, error)
+	GetTrashed(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.Artifact, error)
+	Restore(ctx context.Context, a *model.Artifact) error
+	PurgeTrashed(ctx context.Context, trashedBefore time.Time, limit int) (int, error)
+	AcquireLease(ctx context.Context, l *model.ArtifactLease) (bool, error)
+	ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) (bool, error)
+	GetActiveLease(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.ArtifactLease, error)
+	MoveDir(ctx context.Context, diskID uuid.UUID, from string, to string, holder string) (int64, error)
+	DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, holder string) (int64, error)
+	CreateUpload(ctx context.Context, u *model.ArtifactUpload) error
+	GetUpload(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.ArtifactUpload, error)
+	FinalizeUpload(ctx context.Context, projectID uuid.UUID, uploadID uuid.UUID, a *model.Artifact) error
+	CompleteUpload(ctx context.Context, id uuid.UUID, holder string, expiresAt time.Time) error
+	ListCompletedUploads(ctx context.Context, limit int) ([]model.ArtifactUpload, error)
+	FailUpload(ctx context.Context, id uuid.UUID, failure string) error
+	ListExpiredUploads(ctx context.Context, expiredBefore time.Time, limit int) ([]model.ArtifactUpload, error)
+	DeleteUpload(ctx context.Context, id uuid.UUID) error
+	AssetReferenced(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error)
+	UpsertUploadPart(ctx context.Context, p *model.ArtifactUploadPart) error
+	ListUploadParts(ctx context.Context, uploadID uuid.UUID) ([]model.ArtifactUploadPart, error)
+}
+
+var (
+	// ErrArtifactDirConflict is returned by MoveDir when a moved artifact would take the path of another artifact
+	ErrArtifactDirConflict = errors.New("a moved artifact would replace another artifact")
+	// ErrArtifactUploadGone is returned by FinalizeUpload when the upload was finalized or dropped meanwhile
+	ErrArtifactUploadGone = errors.New("artifact upload no longer exists")
+)
+
+// ArtifactDirLeasedError is returned by MoveDir and DeleteDir when a holder other than the writer leases a path under
+// a directory they write
+type ArtifactDirLeasedError struct {
+	// Path is the leased path, with its filename
+	Path string
+}
+
+func (e *ArtifactDirLeasedError) Error() string {
+	return "artifact leased by another holder: " + e.Path
 }
 
 type artifactRepo struct {
@@ -56,17 +98,15 @@ func (r *artifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, di
 		return err
 	}
 
-	// Save asset meta before deletion for reference decrement
-	asset := a.AssetMeta.Data()
-
-	// Use transaction to ensure atomicity: delete artifact and decrement reference
+	// Move the artifact to the trash, its asset reference is kept until it is purged
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Delete(&a).Error; err != nil {
 			return err
 		}
 
-		if err := r.assetReferenceRepo.DecrementAssetRef(ctx, projectID, asset); err != nil {
-			return fmt.Errorf("decrement asset reference: %w", err)
+		// Drop the retrieval chunks that point back to this artifact
+		if err := tx.Where("source_type = ? AND source_id = ?", model.ChunkSourceArtifact, a.ID).Delete(&model.Chunk{}).Error; err != nil {
+			return err
 		}
 
 		return nil
@@ -133,3 +173,367 @@ func (r *artifactRepo) ExistsByPathAndFilename(ctx context.Context, diskID uuid.
 
 	return count > 0, nil
 }
+
+// ListTrash returns the trashed artifacts of a disk, most recently trashed first
+func (r *artifactRepo) ListTrash(ctx context.Context, diskID uuid.UUID) ([]*model.Artifact, error) {
+	var artifacts []*model.Artifact
+	err := r.db.WithContext(ctx).Unscoped().
+		Where("disk_id = ? AND trashed_at IS NOT NULL", diskID).
+		Order("trashed_at DESC").
+		Find(&artifacts).Error
+	return artifacts, err
+}
+
+// GetTrashed returns a trashed artifact of a disk, or nil if there is none with this id
+func (r *artifactRepo) GetTrashed(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.Artifact, error) {
+	var artifact model.Artifact
+	err := r.db.WithContext(ctx).Unscoped().
+		Where("id = ? AND disk_id = ? AND trashed_at IS NOT NULL", id, diskID).
+		First(&artifact).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+func (r *artifactRepo) Restore(ctx context.Context, a *model.Artifact) error {
+	if err := r.db.WithContext(ctx).Unscoped().Model(a).Update("trashed_at", nil).Error; err != nil {
+		return err
+	}
+	a.TrashedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// PurgeTrashed permanently deletes up to limit artifacts trashed before trashedBefore and releases their assets.
+// It returns the number of purged artifacts.
+func (r *artifactRepo) PurgeTrashed(ctx context.Context, trashedBefore time.Time, limit int) (int, error) {
+	type trashedArtifact struct {
+		model.Artifact
+		ProjectID uuid.UUID
+	}
+	var trashed []trashedArtifact
+	if err := r.db.WithContext(ctx).Unscoped().Model(&model.Artifact{}).
+		Select("artifacts.*, disks.project_id").
+		Joins("JOIN disks ON disks.id = artifacts.disk_id").
+		Where("artifacts.trashed_at IS NOT NULL AND artifacts.trashed_at < ?", trashedBefore).
+		Order("artifacts.trashed_at ASC").
+		Limit(limit).
+		Find(&trashed).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, t := range trashed {
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			res := tx.Unscoped().Where("id = ? AND trashed_at IS NOT NULL", t.ID).Delete(&model.Artifact{})
+			if res.Error != nil {
+				return res.Error
+			}
+			// Restored or purged concurrently
+			if res.RowsAffected == 0 {
+				return nil
+			}
+			if err := r.assetReferenceRepo.DecrementAssetRef(ctx, t.ProjectID, t.AssetMeta.Data()); err != nil {
+				return fmt.Errorf("decrement asset reference: %w", err)
+			}
+			purged++
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// AcquireLease takes the lease on the path of l for l.Holder, or extends it if the holder already owns it.
+// It returns false if another holder owns a lease that has not expired yet. A lease is not taken while a directory
+// operation of the disk runs, so that operation sees every lease under its directories.
+func (r *artifactRepo) AcquireLease(ctx context.Context, l *model.ArtifactLease) (bool, error) {
+	now := time.Now()
+	var acquired bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").Where(&model.Disk{ID: l.DiskID}).Take(&model.Disk{}).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "disk_id"}, {Name: "path"}, {Name: "filename"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"holder":     gorm.Expr("EXCLUDED.holder"),
+					"expires_at": gorm.Expr("EXCLUDED.expires_at"),
+					"updated_at": now,
+				}),
+				Where: clause.Where{Exprs: []clause.Expression{
+					gorm.Expr("artifact_leases.holder = EXCLUDED.holder OR artifact_leases.expires_at <= ?", now),
+				}},
+			},
+		).Omit(clause.Associations).Create(l)
+		if res.Error != nil {
+			return res.Error
+		}
+		acquired = res.RowsAffected > 0
+		return nil
+	})
+	return acquired, err
+}
+
+// ReleaseLease drops the lease of holder on a path, it returns false if holder does not own it
+func (r *artifactRepo) ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Where("disk_id = ? AND path = ? AND filename = ? AND holder = ?", diskID, path, filename, holder).
+		Delete(&model.ArtifactLease{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// GetActiveLease returns the unexpired lease on a path, or nil if the path is not locked
+func (r *artifactRepo) GetActiveLease(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.ArtifactLease, error) {
+	var lease model.ArtifactLease
+	err := r.db.WithContext(ctx).
+		Where("disk_id = ? AND path = ? AND filename = ? AND expires_at > ?", diskID, path, filename, time.Now()).
+		First(&lease).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// dirPattern matches with LIKE the paths of the artifacts under dir, a path ending with '/', at any depth
+func dirPattern(dir string) string {
+	return escapeLike(dir) + "%"
+}
+
+// checkDirLeases returns an *ArtifactDirLeasedError when a holder other than holder has an unexpired lease on a path
+// under one of dirs, at any depth. The disk is locked in tx, so no lease is taken meanwhile, see AcquireLease.
+func checkDirLeases(tx *gorm.DB, diskID uuid.UUID, holder string, dirs ...string) error {
+	q := tx.Where("disk_id = ? AND holder <> ? AND expires_at > ?", diskID, holder, time.Now())
+	under := tx.Where("path LIKE ?", dirPattern(dirs[0]))
+	for _, dir := range dirs[1:] {
+		under = under.Or("path LIKE ?", dirPattern(dir))
+	}
+
+	var leases []model.ArtifactLease
+	if err := q.Where(under).Order("path, filename").Limit(1).Find(&leases).Error; err != nil {
+		return err
+	}
+	if len(leases) > 0 {
+		return &ArtifactDirLeasedError{Path: leases[0].Path + leases[0].Filename}
+	}
+	return nil
+}
+
+// MoveDir moves the artifacts under directory from, at any depth, to directory to in one transaction, both paths
+// ending with '/'. The path of their system meta, of their chunks and of their review queue entries follows. Trashed
+// artifacts keep their path. It returns the number of moved artifacts, ErrArtifactDirConflict when one would take the
+// path of an artifact that is not moved, or an *ArtifactDirLeasedError when a holder other than holder leases a path
+// under from or to.
+func (r *artifactRepo) MoveDir(ctx context.Context, diskID uuid.UUID, from string, to string, holder string) (int64, error) {
+	// substr counts characters from 1
+	rest := utf8.RuneCountInString(from) + 1
+	var moved int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Directory operations of a disk run one at a time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where(&model.Disk{ID: diskID}).Take(&model.Disk{}).Error; err != nil {
+			return err
+		}
+		if err := checkDirLeases(tx, diskID, holder, from, to); err != nil {
+			return err
+		}
+
+		var conflicts int64
+		if err := tx.Model(&model.Artifact{}).
+			Joins("JOIN artifacts taken ON taken.disk_id = artifacts.disk_id AND taken.filename = artifacts.filename AND taken.trashed_at IS NULL").
+			Where("taken.path = ? || substr(artifacts.path, ?) AND taken.path NOT LIKE ?", to, rest, dirPattern(from)).
+			Where("artifacts.disk_id = ? AND artifacts.path LIKE ?", diskID, dirPattern(from)).
+			Count(&conflicts).Error; err != nil {
+			return err
+		}
+		if conflicts > 0 {
+			return ErrArtifactDirConflict
+		}
+
+		// The chunks are matched by their artifact before it is moved
+		if err := tx.Model(&model.Chunk{}).
+			Where("source_type = ? AND source_id IN (?)", model.ChunkSourceArtifact,
+				tx.Model(&model.Artifact{}).Select("id").Where("disk_id = ? AND path LIKE ?", diskID, dirPattern(from))).
+			Update("source_ref", gorm.Expr("jsonb_set(source_ref, '{path}', to_jsonb(? || substr(source_ref->>'path', ?)))", to, rest)).Error; err != nil {
+			return err
+		}
+
+		res := tx.Model(&model.Artifact{}).
+			Where("disk_id = ? AND path LIKE ?", diskID, dirPattern(from)).
+			Updates(map[string]any{
+				"path": gorm.Expr("? || substr(path, ?)", to, rest),
+				"meta": gorm.Expr("CASE WHEN jsonb_typeof(meta->?) = 'object' THEN jsonb_set(meta, ARRAY[?::text, 'path'], to_jsonb(? || substr(path, ?))) ELSE meta END",
+					model.ArtifactInfoKey, model.ArtifactInfoKey, to, rest),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		moved = res.RowsAffected
+
+		return tx.Exec(
+			"UPDATE stale_items SET item_ref = jsonb_set(item_ref, '{path}', to_jsonb(? || substr(item_ref->>'path', ?))) WHERE item_type = ? AND item_ref->>'disk_id' = ? AND item_ref->>'path' LIKE ?",
+			to, rest, model.StaleItemTypeArtifact, diskID.String(), dirPattern(from),
+		).Error
+	})
+	return moved, err
+}
+
+// DeleteDir moves the artifacts under directory dir, at any depth, to the trash in one transaction, like
+// DeleteByPath. It returns the number of trashed artifacts, or an *ArtifactDirLeasedError when a holder other than
+// holder leases a path under dir.
+func (r *artifactRepo) DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, holder string) (int64, error) {
+	var trashed int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where(&model.Disk{ID: diskID}).Take(&model.Disk{}).Error; err != nil {
+			return err
+		}
+		if err := checkDirLeases(tx, diskID, holder, dir); err != nil {
+			return err
+		}
+
+		var ids []uuid.UUID
+		if err := tx.Model(&model.Artifact{}).Where("disk_id = ? AND path LIKE ?", diskID, dirPattern(dir)).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		res := tx.Where("id IN ?", ids).Delete(&model.Artifact{})
+		if res.Error != nil {
+			return res.Error
+		}
+		trashed = res.RowsAffected
+
+		return tx.Where("source_type = ? AND source_id IN ?", model.ChunkSourceArtifact, ids).Delete(&model.Chunk{}).Error
+	})
+	return trashed, err
+}
+
+func (r *artifactRepo) CreateUpload(ctx context.Context, u *model.ArtifactUpload) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(u).Error
+}
+
+// GetUpload returns a pending upload of a disk, or nil if there is none with this id or it expired
+func (r *artifactRepo) GetUpload(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.ArtifactUpload, error) {
+	var u model.ArtifactUpload
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND disk_id = ? AND expires_at > ?", id, diskID, time.Now()).
+		First(&u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// FinalizeUpload creates the artifact of a pending upload and drops the upload in one transaction,
+// it returns ErrArtifactUploadGone if the upload no longer exists
+func (r *artifactRepo) FinalizeUpload(ctx context.Context, projectID uuid.UUID, uploadID uuid.UUID, a *model.Artifact) error {
+	asset := a.AssetMeta.Data()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Claims the upload, a concurrent finalize of the same upload waits and then finds nothing
+		res := tx.Where("id = ?", uploadID).Delete(&model.ArtifactUpload{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrArtifactUploadGone
+		}
+
+		if err := tx.Create(a).Error; err != nil {
+			return err
+		}
+
+		if err := r.assetReferenceRepo.IncrementAssetRef(ctx, projectID, asset); err != nil {
+			return fmt.Errorf("increment asset reference: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// CompleteUpload marks an upload as completed by holder, to be checked before expiresAt
+func (r *artifactRepo) CompleteUpload(ctx context.Context, id uuid.UUID, holder string, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.ArtifactUpload{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"completed_at": time.Now(),
+			"lease_holder": holder,
+			"expires_at":   gorm.Expr("GREATEST(expires_at, ?)", expiresAt),
+		}).Error
+}
+
+// ListCompletedUploads returns up to limit unexpired completed uploads that were not checked yet, oldest first
+func (r *artifactRepo) ListCompletedUploads(ctx context.Context, limit int) ([]model.ArtifactUpload, error) {
+	var uploads []model.ArtifactUpload
+	err := r.db.WithContext(ctx).
+		Where("completed_at IS NOT NULL AND failure = '' AND expires_at > ?", time.Now()).
+		Order("completed_at ASC").
+		Limit(limit).
+		Find(&uploads).Error
+	return uploads, err
+}
+
+// FailUpload records why the content of a completed upload was dropped
+func (r *artifactRepo) FailUpload(ctx context.Context, id uuid.UUID, failure string) error {
+	return r.db.WithContext(ctx).Model(&model.ArtifactUpload{}).Where("id = ?", id).Update("failure", failure).Error
+}
+
+// ListExpiredUploads returns up to limit pending uploads that expired before expiredBefore, oldest first
+func (r *artifactRepo) ListExpiredUploads(ctx context.Context, expiredBefore time.Time, limit int) ([]model.ArtifactUpload, error) {
+	var uploads []model.ArtifactUpload
+	err := r.db.WithContext(ctx).
+		Where("expires_at < ?", expiredBefore).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&uploads).Error
+	return uploads, err
+}
+
+// UpsertUploadPart records a part of an upload, replacing the part with the same number
+func (r *artifactRepo) UpsertUploadPart(ctx context.Context, p *model.ArtifactUploadPart) error {
+	return r.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "upload_id"}, {Name: "part_number"}},
+			DoUpdates: clause.AssignmentColumns([]string{"etag", "size_b", "created_at"}),
+		},
+	).Omit(clause.Associations).Create(p).Error
+}
+
+// ListUploadParts returns the recorded parts of an upload by part number
+func (r *artifactRepo) ListUploadParts(ctx context.Context, uploadID uuid.UUID) ([]model.ArtifactUploadPart, error) {
+	var parts []model.ArtifactUploadPart
+	err := r.db.WithContext(ctx).
+		Where("upload_id = ?", uploadID).
+		Order("part_number ASC").
+		Find(&parts).Error
+	return parts, err
+}
+
+func (r *artifactRepo) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&model.ArtifactUpload{}).Error
+}
+
+// AssetReferenced reports whether the project references the asset with this SHA256
+func (r *artifactRepo) AssetReferenced(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error) {
+	ref, err := r.assetReferenceRepo.Get(ctx, projectID, sha256)
+	if err != nil {
+		return false, err
+	}
+	return ref != nil, nil
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,8 +19,38 @@ type AssetReferenceRepo interface {
 	DecrementAssetRef(ctx context.Context, projectID uuid.UUID, asset model.Asset) error
 	BatchIncrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error
 	BatchDecrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error
+	Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error)
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error)
+	ListSessionHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]AssetHolder, error)
+	ListDiskHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]AssetHolder, error)
+	DeleteIfUnreferenced(ctx context.Context, projectID uuid.UUID, sha256 string, referencedBefore time.Time) (bool, error)
 }
 
+// AssetHolder is a session or disk that references an asset
+type AssetHolder struct {
+	SHA256   string    `gorm:"column:sha256"`
+	HolderID uuid.UUID `gorm:"column:holder_id"`
+}
+
+// sessionHoldersQuery selects (sha256, session id) for the parts files and the part assets of the messages of a project
+const sessionHoldersQuery = `
+SELECT DISTINCT refs.sha256, messages.session_id AS holder_id
+FROM messages
+JOIN sessions ON sessions.id = messages.session_id
+CROSS JOIN LATERAL (
+	SELECT messages.parts_asset_meta->>'sha256' AS sha256
+	UNION ALL
+	SELECT jsonb_array_elements_text(messages.asset_sha256s)
+) refs
+WHERE sessions.project_id = @project_id AND refs.sha256 IN @sha256s`
+
+// diskHoldersQuery selects (sha256, disk id) for the artifacts of a project
+const diskHoldersQuery = `
+SELECT DISTINCT artifacts.asset_meta->>'sha256' AS sha256, artifacts.disk_id AS holder_id
+FROM artifacts
+JOIN disks ON disks.id = artifacts.disk_id
+WHERE disks.project_id = @project_id AND artifacts.asset_meta->>'sha256' IN @sha256s`
+
 type assetReferenceRepo struct {
 	db *gorm.DB
 	s3 *blob.S3Deps
@@ -212,3 +243,106 @@ func (r *assetReferenceRepo) BatchDecrementAssetRefs(ctx context.Context, projec
 	}
 	return nil
 }
+
+// Get returns the asset reference, or nil if the project has no such asset
+func (r *assetReferenceRepo) Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	var ref model.AssetReference
+	err := r.db.WithContext(ctx).Where("project_id = ? AND sha256 = ?", projectID, sha256).First(&ref).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (r *assetReferenceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error) {
+	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var refs []model.AssetReference
+	return refs, q.Order(orderBy).Limit(limit).Find(&refs).Error
+}
+
+// ListSessionHolders returns the sessions whose messages reference the assets
+func (r *assetReferenceRepo) ListSessionHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]AssetHolder, error) {
+	holders := []AssetHolder{}
+	if len(sha256s) == 0 {
+		return holders, nil
+	}
+	err := r.db.WithContext(ctx).Raw(sessionHoldersQuery, map[string]any{
+		"project_id": projectID,
+		"sha256s":    sha256s,
+	}).Scan(&holders).Error
+	return holders, err
+}
+
+// ListDiskHolders returns the disks whose artifacts reference the assets
+func (r *assetReferenceRepo) ListDiskHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]AssetHolder, error) {
+	holders := []AssetHolder{}
+	if len(sha256s) == 0 {
+		return holders, nil
+	}
+	err := r.db.WithContext(ctx).Raw(diskHoldersQuery, map[string]any{
+		"project_id": projectID,
+		"sha256s":    sha256s,
+	}).Scan(&holders).Error
+	return holders, err
+}
+
+// DeleteIfUnreferenced deletes the asset and its S3 object when its ref count dropped to zero, no message or artifact
+// of the project references it and it was not referenced since referencedBefore, which covers uploads whose message
+// or artifact is not stored yet. The ref count is required because messages stored before asset_sha256s existed do
+// not list their part assets. The row is deleted before the object and stays locked until the object is gone,
+// so a concurrent IncrementAssetRef waits and a failed object deletion keeps the row.
+func (r *assetReferenceRepo) DeleteIfUnreferenced(ctx context.Context, projectID uuid.UUID, sha256 string, referencedBefore time.Time) (bool, error) {
+	deleted := false
+	err := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Transaction(func(tx *gorm.DB) error {
+		var ref model.AssetReference
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("project_id = ? AND sha256 = ? AND ref_count <= 0 AND last_referenced_at < ?", projectID, sha256, referencedBefore).
+			First(&ref).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		args := map[string]any{"project_id": projectID, "sha256s": []string{sha256}}
+		var referenced bool
+		if err := tx.Raw("SELECT EXISTS ("+sessionHoldersQuery+") OR EXISTS ("+diskHoldersQuery+")", args).
+			Scan(&referenced).Error; err != nil {
+			return err
+		}
+		if referenced {
+			return nil
+		}
+
+		if err := tx.Delete(&ref).Error; err != nil {
+			return err
+		}
+		if err := r.s3.DeleteObject(ctx, ref.S3Key); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
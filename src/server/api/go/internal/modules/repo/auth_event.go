@@ -0,0 +1,22 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type AuthEventRepo interface {
+	Create(ctx context.Context, e *model.AuthEvent) error
+}
+
+type authEventRepo struct{ db *gorm.DB }
+
+func NewAuthEventRepo(db *gorm.DB) AuthEventRepo {
+	return &authEventRepo{db: db}
+}
+
+func (r *authEventRepo) Create(ctx context.Context, e *model.AuthEvent) error {
+	return r.db.WithContext(ctx).Create(e).Error
+}
@@ -2,7 +2,11 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
@@ -11,24 +15,56 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrBlockVersionConflict is returned when a block changed since the version an update was based on
+	ErrBlockVersionConflict = errors.New("block changed since the expected version")
+	// ErrChildrenOrderMismatch is returned when an order of children does not list every child exactly once
+	ErrChildrenOrderMismatch = errors.New("the order must list every child of the block exactly once")
+)
+
 type BlockRepo interface {
 	Create(ctx context.Context, b *model.Block) error
 	Delete(ctx context.Context, spaceID uuid.UUID, id uuid.UUID) error
 	Get(ctx context.Context, id uuid.UUID) (*model.Block, error)
+	ListByIDs(ctx context.Context, spaceID uuid.UUID, ids []uuid.UUID) ([]model.Block, error)
 	Update(ctx context.Context, b *model.Block) error
+	UpdateAtVersion(ctx context.Context, b *model.Block, version int64) error
 	ListBySpace(ctx context.Context, spaceID uuid.UUID, blockType string, parentID *uuid.UUID) ([]model.Block, error)
+	ListChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]model.Block, error)
+	ParentsWithChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]uuid.UUID, error)
 	NextSort(ctx context.Context, spaceID uuid.UUID, parentID *uuid.UUID) (int64, error)
 	MoveToParentAppend(ctx context.Context, id uuid.UUID, newParentID *uuid.UUID) error
 	ReorderWithinGroup(ctx context.Context, id uuid.UUID, newSort int64) error
 	MoveToParentAtSort(ctx context.Context, id uuid.UUID, newParentID *uuid.UUID, targetSort int64) error
+	ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, ids []uuid.UUID) error
+	CreateCopies(ctx context.Context, blocks []model.Block, sops []model.ToolSOP) error
+	GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error)
+	ListBacklinks(ctx context.Context, spaceID uuid.UUID, id uuid.UUID) ([]model.Block, error)
+	SpaceProjectID(ctx context.Context, spaceID uuid.UUID) (uuid.UUID, error)
 }
 
 type blockRepo struct{ db *gorm.DB }
 
 func NewBlockRepo(db *gorm.DB) BlockRepo { return &blockRepo{db: db} }
 
+// Create inserts a block. A slug is suffixed with a number when another page of the space already has it.
 func (r *blockRepo) Create(ctx context.Context, b *model.Block) error {
-	return r.db.WithContext(ctx).Create(b).Error
+	if b.Slug == nil && b.Type != model.BlockTypeReference {
+		return r.db.WithContext(ctx).Create(b).Error
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if b.Slug != nil {
+			slug, err := r.freeSlug(tx, b.SpaceID, *b.Slug)
+			if err != nil {
+				return err
+			}
+			b.Slug = &slug
+		}
+		if err := tx.Create(b).Error; err != nil {
+			return err
+		}
+		return saveBlockReferences(tx, []model.Block{*b})
+	})
 }
 
 func (r *blockRepo) Delete(ctx context.Context, spaceID uuid.UUID, id uuid.UUID) error {
@@ -52,8 +88,62 @@ func (r *blockRepo) Get(ctx context.Context, id uuid.UUID) (*model.Block, error)
 	return &b, nil
 }
 
+// ListByIDs returns the blocks of the space among ids, in no particular order
+func (r *blockRepo) ListByIDs(ctx context.Context, spaceID uuid.UUID, ids []uuid.UUID) ([]model.Block, error) {
+	var list []model.Block
+	err := r.db.WithContext(ctx).
+		Preload("ToolSOPs.ToolReference").
+		Where(&model.Block{SpaceID: spaceID}).
+		Where("id IN ?", ids).
+		Find(&list).Error
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		r.mergeToolSOPsIntoProps(&list[i])
+	}
+
+	return list, nil
+}
+
+// Update writes the non-zero fields of b and sets b.Version to the new version of the block. The reference of a
+// reference block follows its props when b.Type is set.
 func (r *blockRepo) Update(ctx context.Context, b *model.Block) error {
-	return r.db.WithContext(ctx).Where(&model.Block{ID: b.ID}).Updates(b).Error
+	if b.Type != model.BlockTypeReference || b.Props.Data() == nil {
+		return r.update(r.db.WithContext(ctx), b, 0)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return r.update(tx, b, 0)
+	})
+}
+
+// UpdateAtVersion is Update for a block that must still have the version the update is based on, else
+// ErrBlockVersionConflict is returned
+func (r *blockRepo) UpdateAtVersion(ctx context.Context, b *model.Block, version int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return r.update(tx, b, version)
+	})
+}
+
+func (r *blockRepo) update(tx *gorm.DB, b *model.Block, version int64) error {
+	q := tx.Where(&model.Block{ID: b.ID})
+	if version != 0 {
+		q = q.Where("updated_at = ?", time.UnixMicro(version))
+	}
+	// The stored update time is rounded to microseconds, the version is read back
+	res := q.Clauses(clause.Returning{Columns: []clause.Column{{Name: "updated_at"}}}).Updates(b)
+	if res.Error != nil {
+		return res.Error
+	}
+	if version != 0 && res.RowsAffected == 0 {
+		return ErrBlockVersionConflict
+	}
+	b.Version = b.UpdatedAt.UnixMicro()
+	if b.Type != model.BlockTypeReference || b.Props.Data() == nil {
+		return nil
+	}
+	return saveBlockReferences(tx, []model.Block{*b})
 }
 
 func (r *blockRepo) ListBySpace(ctx context.Context, spaceID uuid.UUID, blockType string, parentID *uuid.UUID) ([]model.Block, error) {
@@ -86,6 +176,38 @@ func (r *blockRepo) ListBySpace(ctx context.Context, spaceID uuid.UUID, blockTyp
 	return list, nil
 }
 
+// ListChildren returns the children of several blocks of the space at once, in the order of ListBySpace
+func (r *blockRepo) ListChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]model.Block, error) {
+	var list []model.Block
+	err := r.db.WithContext(ctx).
+		Preload("ToolSOPs.ToolReference").
+		Where(&model.Block{SpaceID: spaceID}).
+		Where("parent_id IN ?", parentIDs).
+		Order("type ASC, sort ASC").
+		Find(&list).Error
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		r.mergeToolSOPsIntoProps(&list[i])
+	}
+
+	return list, nil
+}
+
+// ParentsWithChildren returns the blocks among parentIDs that have at least one child
+func (r *blockRepo) ParentsWithChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&model.Block{}).
+		Where(&model.Block{SpaceID: spaceID}).
+		Where("parent_id IN ?", parentIDs).
+		Distinct().
+		Pluck("parent_id", &ids).Error
+	return ids, err
+}
+
 // NextSort returns max(sort)+1 within group (space_id, parent_id)
 func (r *blockRepo) NextSort(ctx context.Context, spaceID uuid.UUID, parentID *uuid.UUID) (int64, error) {
 	type result struct{ Next int64 }
@@ -121,6 +243,182 @@ func (r *blockRepo) MoveToParentAppend(ctx context.Context, id uuid.UUID, newPar
 	})
 }
 
+// CreateCopies inserts copied blocks, parents before children, and the SOP steps of the copies in a single transaction.
+// The first block is appended to the blocks of its parent, the others keep their sort. Slugs of copied pages are
+// suffixed with a number when taken.
+func (r *blockRepo) CreateCopies(ctx context.Context, blocks []model.Block, sops []model.ToolSOP) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Compute next sort in target group
+		root := &blocks[0]
+		q := r.buildGroupQuery(tx, root.SpaceID, root.ParentID).Select("COALESCE(MAX(sort), -1) + 1")
+		if err := q.Take(&root.Sort).Error; err != nil {
+			return err
+		}
+
+		if err := uniqueSlugs(tx, blocks); err != nil {
+			return err
+		}
+		if err := tx.CreateInBatches(blocks, 100).Error; err != nil {
+			return err
+		}
+		if len(sops) > 0 {
+			if err := tx.CreateInBatches(sops, 100).Error; err != nil {
+				return err
+			}
+		}
+		return saveBlockReferences(tx, blocks)
+	})
+}
+
+// SpaceProjectID returns the project of a space, gorm.ErrRecordNotFound when there is no such space
+func (r *blockRepo) SpaceProjectID(ctx context.Context, spaceID uuid.UUID) (uuid.UUID, error) {
+	var space model.Space
+	err := r.db.WithContext(ctx).Select("project_id").Where("id = ?", spaceID).Take(&space).Error
+	return space.ProjectID, err
+}
+
+// ListBacklinks returns the reference blocks of the space referencing the block, oldest first
+func (r *blockRepo) ListBacklinks(ctx context.Context, spaceID uuid.UUID, id uuid.UUID) ([]model.Block, error) {
+	var list []model.Block
+	err := r.db.WithContext(ctx).
+		Joins("JOIN block_references ON block_references.block_id = blocks.id").
+		Where("blocks.space_id = ? AND block_references.reference_block_id = ?", spaceID, id).
+		Order("blocks.created_at ASC, blocks.id ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// saveBlockReferences points the block_references rows of the reference blocks among blocks at the targets in
+// their props. A target that no longer exists is saved as a broken reference, as if it had been deleted after.
+func saveBlockReferences(tx *gorm.DB, blocks []model.Block) error {
+	refs := []model.BlockReference{}
+	targets := []uuid.UUID{}
+	for _, b := range blocks {
+		if target, ok := b.ReferenceBlockID(); ok {
+			refs = append(refs, model.BlockReference{BlockID: b.ID, ReferenceBlockID: &target})
+			targets = append(targets, target)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var existing []uuid.UUID
+	if err := tx.Model(&model.Block{}).Where("id IN ?", targets).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	found := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	for i := range refs {
+		if !found[*refs[i].ReferenceBlockID] {
+			refs[i].ReferenceBlockID = nil
+		}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "block_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reference_block_id", "updated_at"}),
+	}).CreateInBatches(refs, 100).Error
+}
+
+// GetPageBySlug returns the page of the space with the slug
+func (r *blockRepo) GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error) {
+	var b model.Block
+	err := r.db.WithContext(ctx).
+		Where(&model.Block{SpaceID: spaceID, Type: model.BlockTypePage, Slug: &slug}).
+		First(&b).Error
+	return &b, err
+}
+
+// freeSlug returns base, or base-2, base-3... when it is taken in the space. The space row stays locked until the end
+// of tx, so concurrent writers of the space do not pick the same slug.
+func (r *blockRepo) freeSlug(tx *gorm.DB, spaceID uuid.UUID, base string) (string, error) {
+	if err := lockSpaces(tx, []uuid.UUID{spaceID}); err != nil {
+		return "", err
+	}
+
+	// Slugs have no LIKE wildcards, see service.PageSlug
+	var used []string
+	if err := tx.Model(&model.Block{}).
+		Where(&model.Block{SpaceID: spaceID}).
+		Where("slug = ? OR slug LIKE ?", base, base+"-%").
+		Pluck("slug", &used).Error; err != nil {
+		return "", err
+	}
+	return claimSlug(slugSet(used), base), nil
+}
+
+// uniqueSlugs suffixes the slugs of blocks with a number where another page of their space, or an earlier block of
+// blocks, already has them. The spaces stay locked until the end of tx, so concurrent writers do not pick the same
+// slug.
+func uniqueSlugs(tx *gorm.DB, blocks []model.Block) error {
+	var spaceIDs []uuid.UUID
+	taken := map[uuid.UUID]map[string]bool{}
+	for _, b := range blocks {
+		if b.Slug != nil && taken[b.SpaceID] == nil {
+			spaceIDs = append(spaceIDs, b.SpaceID)
+			taken[b.SpaceID] = map[string]bool{}
+		}
+	}
+	if len(spaceIDs) == 0 {
+		return nil
+	}
+	if err := lockSpaces(tx, spaceIDs); err != nil {
+		return err
+	}
+
+	var used []struct {
+		SpaceID uuid.UUID
+		Slug    string
+	}
+	if err := tx.Model(&model.Block{}).
+		Select("space_id, slug").
+		Where("space_id IN ? AND slug IS NOT NULL", spaceIDs).
+		Find(&used).Error; err != nil {
+		return err
+	}
+	for _, u := range used {
+		taken[u.SpaceID][u.Slug] = true
+	}
+	for i := range blocks {
+		if blocks[i].Slug != nil {
+			slug := claimSlug(taken[blocks[i].SpaceID], *blocks[i].Slug)
+			blocks[i].Slug = &slug
+		}
+	}
+	return nil
+}
+
+// lockSpaces locks the rows of spaces in a fixed order until the end of tx. Spaces that do not exist yet, such as
+// those created in tx, are locked by their insert.
+func lockSpaces(tx *gorm.DB, spaceIDs []uuid.UUID) error {
+	var locked []model.Space
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id IN ?", spaceIDs).Order("id").Find(&locked).Error
+}
+
+// slugSet returns the set of slugs
+func slugSet(slugs []string) map[string]bool {
+	taken := make(map[string]bool, len(slugs))
+	for _, s := range slugs {
+		taken[s] = true
+	}
+	return taken
+}
+
+// claimSlug returns base, or base-2, base-3... when it is taken, and marks it taken
+func claimSlug(taken map[string]bool, base string) string {
+	slug := base
+	for i := 2; taken[slug]; i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	taken[slug] = true
+	return slug
+}
+
 // ReorderWithinGroup safely reorders an item to newSort within its current (space_id, parent_id) group.
 func (r *blockRepo) ReorderWithinGroup(ctx context.Context, id uuid.UUID, newSort int64) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -155,6 +453,48 @@ func (r *blockRepo) MoveToParentAtSort(ctx context.Context, id uuid.UUID, newPar
 	})
 }
 
+// ReorderChildren gives the children of a block the sorts 0, 1, 2... in the order of ids in one transaction. ids must
+// list every child of the block exactly once, else ErrChildrenOrderMismatch is returned.
+func (r *blockRepo) ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, ids []uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children []uuid.UUID
+		if err := r.buildGroupQuery(tx, spaceID, &parentID).Clauses(clause.Locking{Strength: "UPDATE"}).Pluck("id", &children).Error; err != nil {
+			return err
+		}
+		if len(children) != len(ids) {
+			return ErrChildrenOrderMismatch
+		}
+		unlisted := make(map[uuid.UUID]bool, len(children))
+		for _, id := range children {
+			unlisted[id] = true
+		}
+		for _, id := range ids {
+			if !unlisted[id] {
+				return ErrChildrenOrderMismatch
+			}
+			delete(unlisted, id)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		// The unique sort index is checked row by row, so the children first get distinct negative sorts that the
+		// final ones cannot collide with
+		if err := r.buildGroupQuery(tx, spaceID, &parentID).Update("sort", gorm.Expr("-1 - sort")).Error; err != nil {
+			return err
+		}
+		var sql strings.Builder
+		args := make([]any, 0, 2*len(ids))
+		sql.WriteString("CASE id")
+		for i, id := range ids {
+			sql.WriteString(" WHEN ?::uuid THEN ?::bigint")
+			args = append(args, id, int64(i))
+		}
+		sql.WriteString(" END")
+		return r.buildGroupQuery(tx, spaceID, &parentID).Update("sort", gorm.Expr(sql.String(), args...)).Error
+	})
+}
+
 // reorderInTransaction reorders a block within its current parent group
 func (r *blockRepo) reorderInTransaction(tx *gorm.DB, b *model.Block, targetSort int64) error {
 	if targetSort < 0 {
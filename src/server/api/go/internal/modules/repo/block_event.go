@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+// BlockEventTrigger records every change of a row of blocks in block_events, with the ID of its transaction
+const BlockEventTrigger = `
+CREATE OR REPLACE FUNCTION record_block_event() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), NEW.id, NULL, to_jsonb(NEW));
+	ELSIF TG_OP = 'UPDATE' THEN
+		INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), NEW.id, to_jsonb(OLD), to_jsonb(NEW));
+	ELSE
+		INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), OLD.id, to_jsonb(OLD), NULL);
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS blocks_record_event ON blocks;
+CREATE TRIGGER blocks_record_event AFTER INSERT OR UPDATE OR DELETE ON blocks
+	FOR EACH ROW EXECUTE FUNCTION record_block_event();
+`
+
+type BlockEventRepo interface {
+	Relay(ctx context.Context, limit int, publish func(rows []model.BlockEventRow) error) (int, error)
+}
+
+type blockEventRepo struct{ db *gorm.DB }
+
+func NewBlockEventRepo(db *gorm.DB) BlockEventRepo { return &blockEventRepo{db: db} }
+
+// Relay passes the rows of the oldest transactions of the outbox, up to about limit rows, to publish in their order,
+// and deletes them once publish returns nil. Every row of a transaction is passed at once, so the changes a
+// transaction made to a block can be told as one. It returns the number of rows relayed.
+func (r *blockEventRepo) Relay(ctx context.Context, limit int, publish func(rows []model.BlockEventRow) error) (int, error) {
+	var rows []model.BlockEventRow
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		oldest := tx.Model(&model.BlockEventRow{}).Select("tx_id").Order("id").Limit(limit)
+		if err := tx.Where("tx_id IN (?)", oldest).Order("id").Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := publish(rows); err != nil {
+			return err
+		}
+		// The rows of a transaction become visible together, so none of them was left out
+		var txIDs []int64
+		for i, row := range rows {
+			if i == 0 || row.TxID != rows[i-1].TxID {
+				txIDs = append(txIDs, row.TxID)
+			}
+		}
+		return tx.Where("tx_id IN ?", txIDs).Delete(&model.BlockEventRow{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type ChunkRepo interface {
+	ReplaceBySource(ctx context.Context, sourceType string, sourceID uuid.UUID, chunks []model.Chunk) error
+	ListBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) ([]model.Chunk, error)
+	DeleteBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) error
+}
+
+type chunkRepo struct{ db *gorm.DB }
+
+func NewChunkRepo(db *gorm.DB) ChunkRepo {
+	return &chunkRepo{db: db}
+}
+
+// ReplaceBySource atomically swaps all chunks of a source with the given ones
+func (r *chunkRepo) ReplaceBySource(ctx context.Context, sourceType string, sourceID uuid.UUID, chunks []model.Chunk) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).Delete(&model.Chunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 200).Error
+	})
+}
+
+func (r *chunkRepo) ListBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) ([]model.Chunk, error) {
+	var chunks []model.Chunk
+	err := r.db.WithContext(ctx).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Order("chunk_index ASC").
+		Find(&chunks).Error
+	return chunks, err
+}
+
+func (r *chunkRepo) DeleteBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Delete(&model.Chunk{}).Error
+}
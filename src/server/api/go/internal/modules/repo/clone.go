@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type CloneRepo interface {
+	ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error)
+	GetSpace(ctx context.Context, spaceID uuid.UUID) (*model.Space, error)
+	CloneSpace(ctx context.Context, src *model.Space, targetProjectID uuid.UUID) (*model.Space, error)
+}
+
+type cloneRepo struct{ db *gorm.DB }
+
+func NewCloneRepo(db *gorm.DB) CloneRepo {
+	return &cloneRepo{db: db}
+}
+
+func (r *cloneRepo) ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", projectID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *cloneRepo) GetSpace(ctx context.Context, spaceID uuid.UUID) (*model.Space, error) {
+	var s model.Space
+	return &s, r.db.WithContext(ctx).Where(&model.Space{ID: spaceID}).First(&s).Error
+}
+
+// CloneSpace copies a space with its block tree and SOP steps into the target project in one transaction.
+// The tools used by SOP steps are matched by name in the target project and created there when missing.
+// Chunks and embeddings are derived from the blocks and are not copied. Pages keep their slugs.
+func (r *cloneRepo) CloneSpace(ctx context.Context, src *model.Space, targetProjectID uuid.UUID) (*model.Space, error) {
+	clone := &model.Space{
+		ProjectID: targetProjectID,
+		Configs:   src.Configs,
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var blocks []model.Block
+		if err := tx.Preload("ToolSOPs.ToolReference").Where(&model.Block{SpaceID: src.ID}).Find(&blocks).Error; err != nil {
+			return fmt.Errorf("list blocks: %w", err)
+		}
+
+		if err := tx.Create(clone).Error; err != nil {
+			return fmt.Errorf("create space: %w", err)
+		}
+
+		ids := make(map[uuid.UUID]uuid.UUID, len(blocks))
+		for _, b := range blocks {
+			ids[b.ID] = uuid.New()
+		}
+		tools := map[uuid.UUID]uuid.UUID{}
+
+		// Parents are inserted before their children, references once all blocks exist
+		var references []model.Block
+		for _, level := range blockLevels(blocks) {
+			copies := make([]model.Block, 0, len(level))
+			sops := []model.ToolSOP{}
+			for _, b := range level {
+				cp := model.Block{
+					ID:             ids[b.ID],
+					SpaceID:        clone.ID,
+					Type:           b.Type,
+					Title:          b.Title,
+					Props:          b.Props,
+					Slug:           b.Slug,
+					Sort:           b.Sort,
+					IsArchived:     b.IsArchived,
+					LastVerifiedAt: b.LastVerifiedAt,
+				}
+				if b.ParentID != nil {
+					parentID := ids[*b.ParentID]
+					cp.ParentID = &parentID
+				}
+				// References follow their target into the clone, broken ones stay broken
+				if target, ok := b.ReferenceBlockID(); ok {
+					if cloned, ok := ids[target]; ok {
+						props := maps.Clone(b.Props.Data())
+						props["reference_block_id"] = cloned.String()
+						cp.Props = datatypes.NewJSONType(props)
+						references = append(references, cp)
+					}
+				}
+				copies = append(copies, cp)
+
+				for _, sop := range b.ToolSOPs {
+					toolID, err := r.targetTool(tx, sop, targetProjectID, tools)
+					if err != nil {
+						return err
+					}
+					sops = append(sops, model.ToolSOP{
+						Order:           sop.Order,
+						Action:          sop.Action,
+						ToolReferenceID: toolID,
+						SOPBlockID:      cp.ID,
+						Props:           sop.Props,
+					})
+				}
+			}
+			if err := tx.CreateInBatches(copies, 100).Error; err != nil {
+				return fmt.Errorf("copy blocks: %w", err)
+			}
+			if len(sops) > 0 {
+				if err := tx.CreateInBatches(sops, 100).Error; err != nil {
+					return fmt.Errorf("copy sop steps: %w", err)
+				}
+			}
+		}
+		if err := saveBlockReferences(tx, references); err != nil {
+			return fmt.Errorf("copy block references: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// targetTool returns the tool of the target project with the name of the tool used by sop, creating it if needed
+func (r *cloneRepo) targetTool(tx *gorm.DB, sop model.ToolSOP, targetProjectID uuid.UUID, cache map[uuid.UUID]uuid.UUID) (uuid.UUID, error) {
+	if id, ok := cache[sop.ToolReferenceID]; ok {
+		return id, nil
+	}
+	if sop.ToolReference == nil {
+		return uuid.Nil, fmt.Errorf("tool %s of sop step not found", sop.ToolReferenceID)
+	}
+
+	tool := model.ToolReference{}
+	err := tx.Where(&model.ToolReference{ProjectID: targetProjectID, Name: sop.ToolReference.Name}).
+		Attrs(model.ToolReference{
+			Description:     sop.ToolReference.Description,
+			ArgumentsSchema: sop.ToolReference.ArgumentsSchema,
+		}).
+		FirstOrCreate(&tool).Error
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("copy tool %q: %w", sop.ToolReference.Name, err)
+	}
+	cache[sop.ToolReferenceID] = tool.ID
+	return tool.ID, nil
+}
+
+// blockLevels groups blocks by depth, roots first. Blocks whose parent is not among blocks are treated as roots.
+func blockLevels(blocks []model.Block) [][]model.Block {
+	children := make(map[uuid.UUID][]model.Block, len(blocks))
+	present := make(map[uuid.UUID]bool, len(blocks))
+	for _, b := range blocks {
+		present[b.ID] = true
+	}
+
+	level := []model.Block{}
+	for _, b := range blocks {
+		if b.ParentID == nil || !present[*b.ParentID] {
+			b.ParentID = nil
+			level = append(level, b)
+		} else {
+			children[*b.ParentID] = append(children[*b.ParentID], b)
+		}
+	}
+
+	levels := [][]model.Block{}
+	for len(level) > 0 {
+		levels = append(levels, level)
+		next := []model.Block{}
+		for _, b := range level {
+			next = append(next, children[b.ID]...)
+		}
+		level = next
+	}
+	return levels
+}
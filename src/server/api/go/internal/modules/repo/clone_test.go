@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockLevels(t *testing.T) {
+	folder := model.Block{ID: uuid.New(), Type: model.BlockTypeFolder}
+	page := model.Block{ID: uuid.New(), Type: model.BlockTypePage, ParentID: &folder.ID}
+	text := model.Block{ID: uuid.New(), Type: model.BlockTypeText, ParentID: &page.ID}
+	missing := uuid.New()
+	orphan := model.Block{ID: uuid.New(), Type: model.BlockTypePage, ParentID: &missing}
+
+	levels := blockLevels([]model.Block{text, page, orphan, folder})
+	if assert.Len(t, levels, 3) {
+		assert.ElementsMatch(t, []uuid.UUID{orphan.ID, folder.ID}, []uuid.UUID{levels[0][0].ID, levels[0][1].ID})
+		assert.Equal(t, page.ID, levels[1][0].ID)
+		assert.Equal(t, text.ID, levels[2][0].ID)
+	}
+	// Orphans become roots of the copy
+	for _, b := range levels[0] {
+		assert.Nil(t, b.ParentID)
+	}
+}
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DataKeyRepo interface {
+	// Get returns the data key of the project, nil if it has none yet
+	Get(ctx context.Context, projectID uuid.UUID) (*model.ProjectDataKey, error)
+	// Create stores the data key of its project unless one exists, and returns the stored one
+	Create(ctx context.Context, k *model.ProjectDataKey) (*model.ProjectDataKey, error)
+}
+
+type dataKeyRepo struct{ db *gorm.DB }
+
+func NewDataKeyRepo(db *gorm.DB) DataKeyRepo {
+	return &dataKeyRepo{db: db}
+}
+
+func (r *dataKeyRepo) Get(ctx context.Context, projectID uuid.UUID) (*model.ProjectDataKey, error) {
+	var k model.ProjectDataKey
+	err := r.db.WithContext(ctx).Where("project_id = ?", projectID).Take(&k).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *dataKeyRepo) Create(ctx context.Context, k *model.ProjectDataKey) (*model.ProjectDataKey, error) {
+	// Concurrent first uploads of a project race to create its key, the first one wins
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(k).Error; err != nil {
+		return nil, err
+	}
+	stored, err := r.Get(ctx, k.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return stored, nil
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeprecatedCallRepo interface {
+	Add(ctx context.Context, calls []model.DeprecatedCall) error
+	Usage(ctx context.Context, since time.Time) ([]DeprecatedCallUsage, error)
+}
+
+// DeprecatedCallUsage is the calls of a project to a deprecation since a day
+type DeprecatedCallUsage struct {
+	Deprecation  string
+	ProjectID    uuid.UUID
+	Calls        int64
+	LastCalledAt time.Time
+}
+
+type deprecatedCallRepo struct{ db *gorm.DB }
+
+func NewDeprecatedCallRepo(db *gorm.DB) DeprecatedCallRepo {
+	return &deprecatedCallRepo{db: db}
+}
+
+// Add adds calls to the counts of their project, deprecation and day
+func (r *deprecatedCallRepo) Add(ctx context.Context, calls []model.DeprecatedCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}, {Name: "deprecation"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"calls":          gorm.Expr("deprecated_calls.calls + excluded.calls"),
+			"last_called_at": gorm.Expr("GREATEST(deprecated_calls.last_called_at, excluded.last_called_at)"),
+		}),
+	}).Create(&calls).Error
+}
+
+// Usage sums the calls per deprecation and project since a day, most calls first
+func (r *deprecatedCallRepo) Usage(ctx context.Context, since time.Time) ([]DeprecatedCallUsage, error) {
+	var usage []DeprecatedCallUsage
+	return usage, r.db.WithContext(ctx).Model(&model.DeprecatedCall{}).
+		Select("deprecation, project_id, SUM(calls) AS calls, MAX(last_called_at) AS last_called_at").
+		Where("day >= ?", since.UTC().Format(time.DateOnly)).
+		Group("deprecation, project_id").
+		Order("deprecation ASC, calls DESC, project_id ASC").
+		Scan(&usage).Error
+}
@@ -13,6 +13,7 @@ import (
 type DiskRepo interface {
 	Create(ctx context.Context, d *model.Disk) error
 	Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) error
+	Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error)
 	ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error)
 }
 
@@ -38,10 +39,10 @@ func (r *diskRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.
 			return err
 		}
 
-		// Query all artifacts before deletion to collect asset meta for reference decrement
+		// Query all artifacts before deletion to collect asset meta for reference decrement, trashed ones included
 		// Artifacts will be automatically deleted by CASCADE when disk is deleted
 		var artifacts []model.Artifact
-		if err := tx.Where("disk_id = ?", diskID).Find(&artifacts).Error; err != nil {
+		if err := tx.Unscoped().Where("disk_id = ?", diskID).Find(&artifacts).Error; err != nil {
 			return fmt.Errorf("query artifacts: %w", err)
 		}
 
@@ -73,6 +74,14 @@ func (r *diskRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.
 	})
 }
 
+func (r *diskRepo) Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error) {
+	var disk model.Disk
+	if err := r.db.WithContext(ctx).Where("id = ?", diskID).First(&disk).Error; err != nil {
+		return nil, err
+	}
+	return &disk, nil
+}
+
 func (r *diskRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error) {
 	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
 
@@ -0,0 +1,218 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EmbeddingRepo interface {
+	UpdateConfigWithJob(ctx context.Context, projectID uuid.UUID, configs datatypes.JSONMap, job *model.EmbeddingJob) error
+	CountProjectBlocks(ctx context.Context, projectID uuid.UUID) (int64, error)
+	GetActiveJob(ctx context.Context, projectID uuid.UUID) (*model.EmbeddingJob, error)
+	GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error)
+	ListJobsWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.EmbeddingJob, error)
+	UpdateJobStatus(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID, status string) error
+	ListBlockEmbeddings(ctx context.Context, projectID uuid.UUID, blockIDs []uuid.UUID) (map[uuid.UUID][]float32, error)
+	SetMessageEmbedding(ctx context.Context, e *model.MessageEmbedding) error
+	ListMessageEmbeddings(ctx context.Context, messageIDs []uuid.UUID, embeddingModel string) (map[uuid.UUID][]float32, error)
+}
+
+// ErrEmbeddingJobActive is returned when a job is created while the project has a pending or running one
+var ErrEmbeddingJobActive = errors.New("the project has an active embedding job")
+
+type embeddingRepo struct{ db *gorm.DB }
+
+func NewEmbeddingRepo(db *gorm.DB) EmbeddingRepo {
+	return &embeddingRepo{db: db}
+}
+
+// UpdateConfigWithJob stores the project configs and, when job is not nil, creates the re-embedding job in the same transaction,
+// along with the re_embed task tracking it
+func (r *embeddingRepo) UpdateConfigWithJob(ctx context.Context, projectID uuid.UUID, configs datatypes.JSONMap, job *model.EmbeddingJob) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Project{}).Where("id = ?", projectID).Update("configs", configs).Error; err != nil {
+			return err
+		}
+		if job == nil {
+			return nil
+		}
+		if err := tx.Create(job).Error; err != nil {
+			if isUniqueViolation(err, "ux_embedding_job_project_active") {
+				return ErrEmbeddingJobActive
+			}
+			return err
+		}
+		return tx.Create(&model.Task{
+			ProjectID: projectID,
+			Kind:      model.TaskKindReEmbed,
+			Status:    model.TaskStatusPending,
+			Data: datatypes.JSONMap{
+				"embedding_job_id": job.ID,
+				"model":            job.Model,
+				"dimensions":       job.Dimensions,
+				"total":            job.Total,
+			},
+		}).Error
+	})
+}
+
+// isUniqueViolation reports whether err is the violation of the unique constraint or index named constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+func (r *embeddingRepo) CountProjectBlocks(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&model.Block{}).
+		Joins("JOIN spaces ON spaces.id = blocks.space_id").
+		Where("spaces.project_id = ?", projectID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetActiveJob returns the pending or running job of a project, or nil if there is none
+func (r *embeddingRepo) GetActiveJob(ctx context.Context, projectID uuid.UUID) (*model.EmbeddingJob, error) {
+	var job model.EmbeddingJob
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND status IN ?", projectID, []string{model.EmbeddingJobStatusPending, model.EmbeddingJobStatusRunning}).
+		Order("created_at DESC").
+		First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *embeddingRepo) GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	var job model.EmbeddingJob
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND project_id = ?", jobID, projectID).
+		First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *embeddingRepo) ListJobsWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.EmbeddingJob, error) {
+	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		// Determine comparison operator based on sort direction
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	// Apply ordering based on sort direction
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var jobs []model.EmbeddingJob
+	return jobs, q.Order(orderBy).Limit(limit).Find(&jobs).Error
+}
+
+// UpdateJobStatus sets the status of a job and of the re_embed task tracking it, a cancelled job fails its task
+func (r *embeddingRepo) UpdateJobStatus(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID, status string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.EmbeddingJob{}).
+			Where("id = ? AND project_id = ?", jobID, projectID).
+			Update("status", status).Error; err != nil {
+			return err
+		}
+
+		taskStatus, data := status, datatypes.JSONMap{}
+		if status == model.EmbeddingJobStatusCancelled {
+			taskStatus, data["error"] = model.TaskStatusFailed, "cancelled"
+		}
+		return tx.Model(&model.Task{}).
+			Where("project_id = ? AND session_id IS NULL AND kind = ? AND data->>'embedding_job_id' = ?", projectID, model.TaskKindReEmbed, jobID.String()).
+			UpdateColumns(map[string]interface{}{
+				"status":     taskStatus,
+				"data":       gorm.Expr("data || ?::jsonb", data),
+				"updated_at": time.Now(),
+			}).Error
+	})
+}
+
+// ListBlockEmbeddings returns the latest stored embedding of each of the blocks of the project, blocks without
+// one are left out
+func (r *embeddingRepo) ListBlockEmbeddings(ctx context.Context, projectID uuid.UUID, blockIDs []uuid.UUID) (map[uuid.UUID][]float32, error) {
+	out := make(map[uuid.UUID][]float32, len(blockIDs))
+	if len(blockIDs) == 0 {
+		return out, nil
+	}
+
+	// The vector is read in its text form, [x,y,...], which is a JSON array
+	var rows []struct {
+		BlockID   uuid.UUID
+		Embedding string
+	}
+	err := r.db.WithContext(ctx).Raw(`SELECT DISTINCT ON (be.block_id) be.block_id, be.embedding::text AS embedding
+FROM block_embeddings be
+JOIN spaces ON spaces.id = be.space_id
+WHERE spaces.project_id = ? AND be.block_id IN ?
+ORDER BY be.block_id, be.created_at DESC`, projectID, blockIDs).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		var v []float32
+		if err := json.Unmarshal([]byte(row.Embedding), &v); err != nil {
+			return nil, fmt.Errorf("parse embedding of block %s: %w", row.BlockID, err)
+		}
+		out[row.BlockID] = v
+	}
+	return out, nil
+}
+
+// SetMessageEmbedding stores the embedding of a message, replacing the previous one
+func (r *embeddingRepo) SetMessageEmbedding(ctx context.Context, e *model.MessageEmbedding) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model", "embedding", "created_at"}),
+	}).Create(e).Error
+}
+
+// ListMessageEmbeddings returns the stored embeddings of the messages computed with embeddingModel, messages without
+// one are left out
+func (r *embeddingRepo) ListMessageEmbeddings(ctx context.Context, messageIDs []uuid.UUID, embeddingModel string) (map[uuid.UUID][]float32, error) {
+	out := make(map[uuid.UUID][]float32, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+
+	var rows []model.MessageEmbedding
+	if err := r.db.WithContext(ctx).
+		Where("message_id IN ? AND model = ?", messageIDs, embeddingModel).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.MessageID] = row.Embedding
+	}
+	return out, nil
+}
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type EntityLimitRepo interface {
+	CountSessionMessages(ctx context.Context, sessionID uuid.UUID) (int64, error)
+	CountBlockChildren(ctx context.Context, parentID uuid.UUID) (int64, error)
+}
+
+type entityLimitRepo struct{ db *gorm.DB }
+
+func NewEntityLimitRepo(db *gorm.DB) EntityLimitRepo {
+	return &entityLimitRepo{db: db}
+}
+
+// CountSessionMessages returns the number of messages of a session, superseded ones included
+func (r *entityLimitRepo) CountSessionMessages(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.Message{}).Where("session_id = ?", sessionID).Count(&n).Error
+	return n, err
+}
+
+// CountBlockChildren returns the number of direct children of a block, archived ones included
+func (r *entityLimitRepo) CountBlockChildren(ctx context.Context, parentID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.Block{}).Where("parent_id = ?", parentID).Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type FreshnessRepo interface {
+	VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID, at time.Time) (*model.Block, error)
+	VerifyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, at time.Time) (*model.Artifact, error)
+	FlagStale(ctx context.Context, projectID *uuid.UUID, cutoff time.Time) (int64, error)
+	ListStaleWithCursor(ctx context.Context, projectID uuid.UUID, itemType string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.StaleItem, error)
+}
+
+type freshnessRepo struct{ db *gorm.DB }
+
+func NewFreshnessRepo(db *gorm.DB) FreshnessRepo {
+	return &freshnessRepo{db: db}
+}
+
+// VerifyBlock marks a block of the project as verified and removes it from the review queue.
+// UpdateColumn is used so verifying does not count as an update of the content.
+func (r *freshnessRepo) VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID, at time.Time) (*model.Block, error) {
+	var b model.Block
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("blocks.id = ? AND blocks.space_id = ?", blockID, spaceID).
+			Where("blocks.space_id IN (?)", tx.Model(&model.Space{}).Select("id").Where("project_id = ?", projectID)).
+			First(&b).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&b).UpdateColumn("last_verified_at", at).Error; err != nil {
+			return err
+		}
+		return tx.Where("item_type = ? AND item_id = ?", model.StaleItemTypeBlock, b.ID).Delete(&model.StaleItem{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.LastVerifiedAt = &at
+	return &b, nil
+}
+
+// VerifyArtifact marks an artifact of the project as verified and removes it from the review queue
+func (r *freshnessRepo) VerifyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, at time.Time) (*model.Artifact, error) {
+	var a model.Artifact
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("artifacts.disk_id = ? AND artifacts.path = ? AND artifacts.filename = ?", diskID, path, filename).
+			Where("artifacts.disk_id IN (?)", tx.Model(&model.Disk{}).Select("id").Where("project_id = ?", projectID)).
+			First(&a).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&a).UpdateColumn("last_verified_at", at).Error; err != nil {
+			return err
+		}
+		return tx.Where("item_type = ? AND item_id = ?", model.StaleItemTypeArtifact, a.ID).Delete(&model.StaleItem{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.LastVerifiedAt = &at
+	return &a, nil
+}
+
+// FlagStale adds blocks and artifacts neither verified nor updated since cutoff to the review queue,
+// and drops queue entries whose item was deleted, archived, verified or updated in the meantime.
+// A nil projectID scans all projects. It returns the number of newly flagged items.
+func (r *freshnessRepo) FlagStale(ctx context.Context, projectID *uuid.UUID, cutoff time.Time) (int64, error) {
+	var flagged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		queueFilter, ownerFilter := "", ""
+		var projectArgs []interface{}
+		if projectID != nil {
+			queueFilter = " AND si.project_id = ?"
+			ownerFilter = " AND owner.project_id = ?"
+			projectArgs = []interface{}{*projectID}
+		}
+
+		// Resolve entries that are no longer stale
+		if err := tx.Exec(`DELETE FROM stale_items si WHERE si.item_type = ?`+queueFilter+` AND NOT EXISTS (
+			SELECT 1 FROM blocks b WHERE b.id = si.item_id AND b.is_archived = false AND GREATEST(b.last_verified_at, b.updated_at) < ?)`,
+			append(append([]interface{}{model.StaleItemTypeBlock}, projectArgs...), cutoff)...).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM stale_items si WHERE si.item_type = ?`+queueFilter+` AND NOT EXISTS (
+			SELECT 1 FROM artifacts a WHERE a.id = si.item_id AND a.trashed_at IS NULL AND GREATEST(a.last_verified_at, a.updated_at) < ?)`,
+			append(append([]interface{}{model.StaleItemTypeArtifact}, projectArgs...), cutoff)...).Error; err != nil {
+			return err
+		}
+
+		// Folders only group pages, they hold no content to verify
+		res := tx.Exec(`INSERT INTO stale_items (project_id, item_type, item_id, item_ref, last_verified_at)
+			SELECT owner.project_id, ?, b.id, jsonb_build_object('space_id', b.space_id, 'type', b.type, 'title', b.title), GREATEST(b.last_verified_at, b.updated_at)
+			FROM blocks b JOIN spaces owner ON owner.id = b.space_id
+			WHERE b.is_archived = false AND b.type <> ? AND GREATEST(b.last_verified_at, b.updated_at) < ?`+ownerFilter+`
+			ON CONFLICT (item_type, item_id) DO NOTHING`,
+			append([]interface{}{model.StaleItemTypeBlock, model.BlockTypeFolder, cutoff}, projectArgs...)...)
+		if res.Error != nil {
+			return res.Error
+		}
+		flagged += res.RowsAffected
+
+		res = tx.Exec(`INSERT INTO stale_items (project_id, item_type, item_id, item_ref, last_verified_at)
+			SELECT owner.project_id, ?, a.id, jsonb_build_object('disk_id', a.disk_id, 'path', a.path, 'filename', a.filename), GREATEST(a.last_verified_at, a.updated_at)
+			FROM artifacts a JOIN disks owner ON owner.id = a.disk_id
+			WHERE a.trashed_at IS NULL AND GREATEST(a.last_verified_at, a.updated_at) < ?`+ownerFilter+`
+			ON CONFLICT (item_type, item_id) DO NOTHING`,
+			append([]interface{}{model.StaleItemTypeArtifact, cutoff}, projectArgs...)...)
+		if res.Error != nil {
+			return res.Error
+		}
+		flagged += res.RowsAffected
+		return nil
+	})
+	return flagged, err
+}
+
+func (r *freshnessRepo) ListStaleWithCursor(ctx context.Context, projectID uuid.UUID, itemType string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.StaleItem, error) {
+	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+	if itemType != "" {
+		q = q.Where("item_type = ?", itemType)
+	}
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		// Determine comparison operator based on sort direction
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	// Apply ordering based on sort direction
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var items []model.StaleItem
+	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type IngestRepo interface {
+	WindowCounts(ctx context.Context, projectID uuid.UUID, end time.Time, window time.Duration, n int) ([]int64, error)
+}
+
+type ingestRepo struct{ db *gorm.DB }
+
+func NewIngestRepo(db *gorm.DB) IngestRepo {
+	return &ingestRepo{db: db}
+}
+
+// WindowCounts returns the number of messages stored in the project in each of the n windows before end,
+// the window ending at end first
+func (r *ingestRepo) WindowCounts(ctx context.Context, projectID uuid.UUID, end time.Time, window time.Duration, n int) ([]int64, error) {
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Select("floor(extract(epoch FROM (?::timestamptz - created_at)) / ?)::int AS bucket, count(*) AS count", end, window.Seconds()).
+		Where("session_id IN (?)", r.db.Model(&model.Session{}).Select("id").Where("project_id = ?", projectID)).
+		Where("created_at >= ? AND created_at < ?", end.Add(-time.Duration(n)*window), end).
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, n)
+	for _, row := range rows {
+		if row.Bucket >= 0 && row.Bucket < n {
+			counts[row.Bucket] = row.Count
+		}
+	}
+	return counts, nil
+}
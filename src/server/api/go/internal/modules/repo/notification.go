@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type NotificationRepo interface {
+	Create(ctx context.Context, n *model.Notification) error
+	UpdateDelivery(ctx context.Context, n *model.Notification) error
+	LastOfKind(ctx context.Context, projectID uuid.UUID, kind string) (*model.Notification, error)
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Notification, error)
+}
+
+type notificationRepo struct{ db *gorm.DB }
+
+func NewNotificationRepo(db *gorm.DB) NotificationRepo {
+	return &notificationRepo{db: db}
+}
+
+func (r *notificationRepo) Create(ctx context.Context, n *model.Notification) error {
+	return r.db.WithContext(ctx).Create(n).Error
+}
+
+// UpdateDelivery stores the outcome of the webhook call of a notification
+func (r *notificationRepo) UpdateDelivery(ctx context.Context, n *model.Notification) error {
+	return r.db.WithContext(ctx).Model(n).Updates(map[string]interface{}{
+		"delivered_at":   n.DeliveredAt,
+		"delivery_error": n.DeliveryError,
+	}).Error
+}
+
+// LastOfKind returns the latest notification of a kind of the project, nil when there is none
+func (r *notificationRepo) LastOfKind(ctx context.Context, projectID uuid.UUID, kind string) (*model.Notification, error) {
+	var n model.Notification
+	err := r.db.WithContext(ctx).Where("project_id = ? AND kind = ?", projectID, kind).Order("created_at DESC").First(&n).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (r *notificationRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Notification, error) {
+	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		// Determine comparison operator based on sort direction
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	// Apply ordering based on sort direction
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var items []model.Notification
+	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
+}
@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProcessingStatusRepo interface {
+	Set(ctx context.Context, s *model.MessageProcessingStatus) error
+	ListByMessageIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.MessageProcessingStatus, error)
+}
+
+type processingStatusRepo struct{ db *gorm.DB }
+
+func NewProcessingStatusRepo(db *gorm.DB) ProcessingStatusRepo {
+	return &processingStatusRepo{db: db}
+}
+
+// Set stores the state of a processor for a message, replacing the previous one
+func (r *processingStatusRepo) Set(ctx context.Context, s *model.MessageProcessingStatus) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "processor"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "error", "updated_at"}),
+	}).Create(s).Error
+}
+
+func (r *processingStatusRepo) ListByMessageIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.MessageProcessingStatus, error) {
+	var statuses []model.MessageProcessingStatus
+	if len(messageIDs) == 0 {
+		return statuses, nil
+	}
+	return statuses, r.db.WithContext(ctx).
+		Where("message_id IN ?", messageIDs).
+		Order("message_id ASC, processor ASC").
+		Find(&statuses).Error
+}
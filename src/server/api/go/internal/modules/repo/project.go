@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type ProjectRepo interface {
+	SetConfig(ctx context.Context, projectID uuid.UUID, key string, value any) error
+	ListWithConfig(ctx context.Context, key string) ([]model.Project, error)
+	RotateKey(ctx context.Context, projectID uuid.UUID, hmac, phc string, previousExpiresAt time.Time) (bool, error)
+	FinalizeKeyRotation(ctx context.Context, projectID uuid.UUID) (bool, error)
+	GetBySpace(ctx context.Context, spaceID uuid.UUID) (*model.Project, error)
+}
+
+type projectRepo struct{ db *gorm.DB }
+
+func NewProjectRepo(db *gorm.DB) ProjectRepo {
+	return &projectRepo{db: db}
+}
+
+// SetConfig sets the top-level key of the project configs to value, or removes it when value is nil. It is a single
+// statement, so concurrent updates of other keys are not lost.
+func (r *projectRepo) SetConfig(ctx context.Context, projectID uuid.UUID, key string, value any) error {
+	expr := gorm.Expr("COALESCE(configs, '{}'::jsonb) - ?", key)
+	if value != nil {
+		expr = gorm.Expr("jsonb_set(COALESCE(configs, '{}'::jsonb), ARRAY[?]::text[], ?::jsonb)", key, datatypes.NewJSONType(value))
+	}
+	return r.db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", projectID).Update("configs", expr).Error
+}
+
+// ListWithConfig returns the projects whose configs have the top-level key
+func (r *projectRepo) ListWithConfig(ctx context.Context, key string) ([]model.Project, error) {
+	var projects []model.Project
+	err := r.db.WithContext(ctx).Where("configs -> ? IS NOT NULL", key).Find(&projects).Error
+	return projects, err
+}
+
+// RotateKey replaces the key of the project, keeping the current one valid until previousExpiresAt.
+// It returns false without changes while the key of an earlier rotation is still valid.
+func (r *projectRepo) RotateKey(ctx context.Context, projectID uuid.UUID, hmac, phc string, previousExpiresAt time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.Project{}).
+		Where("id = ? AND (previous_secret_key_hmac IS NULL OR previous_key_expires_at <= ?)", projectID, time.Now()).
+		Updates(map[string]interface{}{
+			"previous_secret_key_hmac":     gorm.Expr("secret_key_hmac"),
+			"previous_secret_key_hash_phc": gorm.Expr("secret_key_hash_phc"),
+			"previous_key_expires_at":      previousExpiresAt,
+			"secret_key_hmac":              hmac,
+			"secret_key_hash_phc":          phc,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// FinalizeKeyRotation revokes the key replaced by the last rotation, it returns false when there is none
+func (r *projectRepo) FinalizeKeyRotation(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.Project{}).
+		Where("id = ? AND previous_secret_key_hmac IS NOT NULL", projectID).
+		Updates(map[string]interface{}{
+			"previous_secret_key_hmac":     nil,
+			"previous_secret_key_hash_phc": "",
+			"previous_key_expires_at":      nil,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetBySpace returns the project a space belongs to
+func (r *projectRepo) GetBySpace(ctx context.Context, spaceID uuid.UUID) (*model.Project, error) {
+	var p model.Project
+	err := r.db.WithContext(ctx).
+		Where("id = (?)", r.db.Model(&model.Space{}).Select("project_id").Where("id = ?", spaceID)).
+		First(&p).Error
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
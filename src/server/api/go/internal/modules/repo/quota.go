@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type QuotaRepo interface {
+	CountMessagesSince(ctx context.Context, projectID uuid.UUID, since time.Time) (int64, error)
+	SumStorageBytes(ctx context.Context, projectID uuid.UUID) (int64, error)
+}
+
+type quotaRepo struct{ db *gorm.DB }
+
+func NewQuotaRepo(db *gorm.DB) QuotaRepo {
+	return &quotaRepo{db: db}
+}
+
+// CountMessagesSince returns the number of messages stored in the project since the time
+func (r *quotaRepo) CountMessagesSince(ctx context.Context, projectID uuid.UUID, since time.Time) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("session_id IN (?)", r.db.Model(&model.Session{}).Select("id").Where("project_id = ?", projectID)).
+		Where("created_at >= ?", since).
+		Count(&n).Error
+	return n, err
+}
+
+// SumStorageBytes returns the size of the referenced assets of the project, each stored once however often it is referenced
+func (r *quotaRepo) SumStorageBytes(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&model.AssetReference{}).
+		Select("COALESCE(SUM((asset_meta->>'size_b')::bigint), 0)").
+		Where("project_id = ? AND ref_count > 0", projectID).
+		Scan(&n).Error
+	return n, err
+}
@@ -2,25 +2,76 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/infra/blob"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrDuplicateMessage is returned when a message repeats the message it follows within the dedupe window of the session
+var ErrDuplicateMessage = errors.New("message repeats the previous message of the session")
+
 type SessionRepo interface {
 	Create(ctx context.Context, s *model.Session) error
 	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
+	DeleteMany(ctx context.Context, projectID uuid.UUID, sessionIDs []uuid.UUID) ([]uuid.UUID, error)
+	ListIDsBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]uuid.UUID, error)
 	Update(ctx context.Context, s *model.Session) error
 	Get(ctx context.Context, s *model.Session) (*model.Session, error)
-	ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error)
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, tag string, titleQuery string, endUserID string, configFilters map[string]string, includeArchived bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error)
 	CreateMessageWithAssets(ctx context.Context, msg *model.Message) error
-	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
+	CreateTurn(ctx context.Context, msgs []*model.Message) error
+	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, roles []string, partTypes []string, asOf time.Time, collapseSuperseded bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
 	ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	ListMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error)
+	GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error)
+	MessageExists(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (bool, error)
+	SupersedeMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, byID uuid.UUID, at time.Time) error
+	MergeMessageMeta(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, meta map[string]any) error
+	DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (int64, error)
+	Fork(ctx context.Context, fork *model.Session, messages []model.Message) error
+	SumUsageByModel(ctx context.Context, sessionID uuid.UUID) ([]ModelUsage, error)
+	UpdateMetadata(ctx context.Context, s *model.Session) error
+	SetTitleIfEmpty(ctx context.Context, sessionID uuid.UUID, title string) error
+	SetArchived(ctx context.Context, sessionID uuid.UUID, archived bool) error
+	SumAnnotations(ctx context.Context, sessionID uuid.UUID) ([]AnnotationCount, error)
+	SampleMessages(ctx context.Context, projectID uuid.UUID, f MessageSampleFilter, limit int) ([]model.Message, error)
+	ListIdle(ctx context.Context, projectID uuid.UUID, idleSince time.Time, includeArchived bool, limit int) ([]uuid.UUID, error)
+	UpdateSummary(ctx context.Context, sessionID uuid.UUID, fromMessageID *uuid.UUID, summary SessionSummaryUpdate) (bool, error)
+	ListEventsWithCursor(ctx context.Context, sessionID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.SessionEvent, error)
+}
+
+// MessageSampleFilter selects the messages of a project drawn by SampleMessages, every condition that is set must hold
+type MessageSampleFilter struct {
+	Roles        []string
+	Since        time.Time
+	Until        time.Time
+	WithToolCall bool // only messages with a tool-call part
+}
+
+// SessionSummaryUpdate is a new rolling summary of a session
+type SessionSummaryUpdate struct {
+	Summary   string
+	MessageID uuid.UUID
+	Messages  int
+}
+
+// ModelUsage is the token usage of the messages of a session produced by one model
+type ModelUsage struct {
+	Model            string `gorm:"column:model"`
+	PromptTokens     int64  `gorm:"column:prompt_tokens"`
+	CompletionTokens int64  `gorm:"column:completion_tokens"`
+	Messages         int64  `gorm:"column:messages"`
 }
 
 type sessionRepo struct {
@@ -39,8 +90,14 @@ func NewSessionRepo(db *gorm.DB, assetReferenceRepo AssetReferenceRepo, s3 *blob
 	}
 }
 
+// Create creates a session and records its created event in one transaction
 func (r *sessionRepo) Create(ctx context.Context, s *model.Session) error {
-	return r.db.WithContext(ctx).Create(s).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		return recordSessionEvent(tx, s.ID, model.SessionEventCreated, sessionCreatedEventData(s))
+	})
 }
 
 func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
@@ -59,35 +116,16 @@ func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID
 		}
 
 		// Collect all assets from messages
-		assets := make([]model.Asset, 0)
-		for _, msg := range messages {
-			// Extract PartsAssetMeta (the asset that stores the parts JSON)
-			partsAssetMeta := msg.PartsAssetMeta.Data()
-			if partsAssetMeta.SHA256 != "" {
-				assets = append(assets, partsAssetMeta)
-			}
-
-			// Download and parse parts to extract assets from individual parts
-			if r.s3 != nil && partsAssetMeta.S3Key != "" {
-				parts := []model.Part{}
-				if err := r.s3.DownloadJSON(ctx, partsAssetMeta.S3Key, &parts); err != nil {
-					// Log error but continue with other messages
-					r.log.Warn("failed to download parts", zap.Error(err), zap.String("s3_key", partsAssetMeta.S3Key))
-					continue
-				}
+		assets := r.messagesAssets(ctx, messages)
 
-				// Extract assets from parts
-				for _, part := range parts {
-					if part.Asset != nil && part.Asset.SHA256 != "" {
-						assets = append(assets, *part.Asset)
-					}
-				}
-			}
+		// Delete the session (messages will be automatically deleted by CASCADE). A concurrent delete of the same
+		// session affects no row, its assets are then released by the other delete only.
+		res := tx.Delete(&session)
+		if res.Error != nil {
+			return fmt.Errorf("delete session: %w", res.Error)
 		}
-
-		// Delete the session (messages will be automatically deleted by CASCADE)
-		if err := tx.Delete(&session).Error; err != nil {
-			return fmt.Errorf("delete session: %w", err)
+		if res.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
 		}
 
 		// Note: BatchDecrementAssetRefs uses its own DB connection and may involve S3 operations
@@ -103,15 +141,204 @@ func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID
 	})
 }
 
+// DeleteMany deletes the sessions of sessionIDs that belong to the project in one transaction and releases the assets
+// of their messages with a single decrement. It returns the IDs of the deleted sessions.
+func (r *sessionRepo) DeleteMany(ctx context.Context, projectID uuid.UUID, sessionIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var deleted []uuid.UUID
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted = nil
+		// The rows are locked so a concurrent delete of the same sessions waits and then finds none of them
+		if err := tx.Model(&model.Session{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND project_id = ?", sessionIDs, projectID).Pluck("id", &deleted).Error; err != nil {
+			return fmt.Errorf("query sessions: %w", err)
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		var messages []model.Message
+		if err := tx.Where("session_id IN ?", deleted).Find(&messages).Error; err != nil {
+			return fmt.Errorf("query messages: %w", err)
+		}
+		assets := r.messagesAssets(ctx, messages)
+
+		// Messages are deleted by CASCADE
+		if err := tx.Where("id IN ?", deleted).Delete(&model.Session{}).Error; err != nil {
+			return fmt.Errorf("delete sessions: %w", err)
+		}
+
+		// Same as Delete, the decrement is not part of the transaction
+		if len(assets) > 0 {
+			if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, assets); err != nil {
+				return fmt.Errorf("decrement asset references: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// ListIDsBySpace returns the IDs of the sessions of a project connected to the space
+func (r *sessionRepo) ListIDsBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("project_id = ? AND space_id = ?", projectID, spaceID).
+		Order("created_at ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// messagesAssets returns the parts assets of messages and the assets uploaded with their parts.
+// Messages whose parts cannot be downloaded only release their parts asset.
+func (r *sessionRepo) messagesAssets(ctx context.Context, messages []model.Message) []model.Asset {
+	assets := make([]model.Asset, 0)
+	for _, msg := range messages {
+		// Extract PartsAssetMeta (the asset that stores the parts JSON)
+		partsAssetMeta := msg.PartsAssetMeta.Data()
+		if partsAssetMeta.SHA256 != "" {
+			assets = append(assets, partsAssetMeta)
+		}
+
+		// Parse parts, downloading them unless inline, to extract assets from individual parts
+		partAssets, err := r.partAssets(ctx, msg)
+		if err != nil {
+			// Log error but continue with other messages
+			r.log.Warn("failed to download parts", zap.Error(err), zap.String("s3_key", partsAssetMeta.S3Key))
+			continue
+		}
+		assets = append(assets, partAssets...)
+	}
+	return assets
+}
+
+// partAssets returns the assets uploaded with the parts of msg
+func (r *sessionRepo) partAssets(ctx context.Context, msg model.Message) ([]model.Asset, error) {
+	parts := []model.Part(msg.InlineParts)
+	if !msg.PartsInline() {
+		if r.s3 == nil {
+			return nil, nil
+		}
+		if err := r.s3.DownloadJSON(ctx, msg.PartsAssetMeta.Data().S3Key, &parts); err != nil {
+			return nil, err
+		}
+	}
+
+	assets := make([]model.Asset, 0)
+	for _, part := range parts {
+		if part.Asset != nil && part.Asset.SHA256 != "" {
+			assets = append(assets, *part.Asset)
+		}
+	}
+	return assets, nil
+}
+
+// Fork creates fork and copies messages into it, messages must be ordered from old to new.
+// Copies keep their parts and assets, which gain a reference instead of being duplicated.
+func (r *sessionRepo) Fork(ctx context.Context, fork *model.Session, messages []model.Message) error {
+	assets := make([]model.Asset, 0)
+	copies := make([]model.Message, 0, len(messages))
+	ids := make(map[uuid.UUID]uuid.UUID, len(messages))
+	for _, msg := range messages {
+		partsAssetMeta := msg.PartsAssetMeta.Data()
+		if partsAssetMeta.SHA256 != "" {
+			assets = append(assets, partsAssetMeta)
+		}
+		partAssets, err := r.partAssets(ctx, msg)
+		if err != nil {
+			return fmt.Errorf("download parts: %w", err)
+		}
+		assets = append(assets, partAssets...)
+
+		ids[msg.ID] = uuid.New()
+		cp := model.Message{
+			ID:             ids[msg.ID],
+			Role:           msg.Role,
+			Meta:           msg.Meta,
+			PartsAssetMeta: msg.PartsAssetMeta,
+			InlineParts:    msg.InlineParts,
+			PartTypes:      msg.PartTypes,
+			AssetSHA256s:   msg.AssetSHA256s,
+			SizeB:          msg.SizeB,
+			SearchText:     msg.SearchText,
+			CreatedAt:      msg.CreatedAt,
+			// Usage stays with the original session, the fork did not spend it
+		}
+		if msg.ParentID != nil {
+			if parentID, ok := ids[*msg.ParentID]; ok {
+				cp.ParentID = &parentID
+			}
+		}
+		copies = append(copies, cp)
+	}
+
+	// The fork starts with the counters of the copied messages
+	fork.MessageCount, fork.TotalBytes, fork.LastMessageAt = int64(len(copies)), 0, nil
+	for i := range copies {
+		fork.TotalBytes += copies[i].SizeB
+		if fork.LastMessageAt == nil || copies[i].CreatedAt.After(*fork.LastMessageAt) {
+			fork.LastMessageAt = &copies[i].CreatedAt
+		}
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(fork).Error; err != nil {
+			return fmt.Errorf("create session: %w", err)
+		}
+		if err := recordSessionEvent(tx, fork.ID, model.SessionEventCreated, sessionCreatedEventData(fork)); err != nil {
+			return fmt.Errorf("record session event: %w", err)
+		}
+
+		if len(copies) > 0 {
+			for i := range copies {
+				copies[i].SessionID = fork.ID
+			}
+			if err := tx.CreateInBatches(copies, 100).Error; err != nil {
+				return fmt.Errorf("copy messages: %w", err)
+			}
+			if err := copyToolCallLinks(tx, messages[0].SessionID, fork.ID, ids); err != nil {
+				return fmt.Errorf("copy tool calls: %w", err)
+			}
+		}
+
+		// Like Delete, the asset references are updated outside of the transaction
+		if len(assets) > 0 {
+			if err := r.assetReferenceRepo.BatchIncrementAssetRefs(ctx, fork.ProjectID, assets); err != nil {
+				return fmt.Errorf("increment asset references: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Update updates the non-zero fields of a session, recording the space connection and config change events it makes
 func (r *sessionRepo) Update(ctx context.Context, s *model.Session) error {
-	return r.db.WithContext(ctx).Where(&model.Session{ID: s.ID}).Updates(s).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(&model.Session{ID: s.ID}).Updates(s).Error; err != nil {
+			return err
+		}
+		if s.SpaceID != nil {
+			if err := recordSessionEvent(tx, s.ID, model.SessionEventConnectedToSpace, datatypes.JSONMap{"space_id": s.SpaceID.String()}); err != nil {
+				return fmt.Errorf("record session event: %w", err)
+			}
+		}
+		if s.Configs != nil {
+			if err := recordSessionEvent(tx, s.ID, model.SessionEventConfigChanged, datatypes.JSONMap{"keys": sortedKeys(s.Configs)}); err != nil {
+				return fmt.Errorf("record session event: %w", err)
+			}
+		}
+		return nil
+	})
 }
 
 func (r *sessionRepo) Get(ctx context.Context, s *model.Session) (*model.Session, error) {
 	return s, r.db.WithContext(ctx).Where(&model.Session{ID: s.ID}).First(s).Error
 }
 
-func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
+func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, tag string, titleQuery string, endUserID string, configFilters map[string]string, includeArchived bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
 	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
 
 	if notConnected {
@@ -119,6 +346,31 @@ func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, s
 	} else if spaceID != nil {
 		q = q.Where("space_id = ?", spaceID)
 	}
+	if tag != "" {
+		q = q.Where("tags @> ?", datatypes.JSONSlice[string]{tag})
+	}
+	if titleQuery != "" {
+		q = q.Where("title ILIKE ?", "%"+escapeLike(titleQuery)+"%")
+	}
+	if endUserID != "" {
+		q = q.Where("end_user_id = ?", endUserID)
+	}
+	paths := make([]string, 0, len(configFilters))
+	for path := range configFilters {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		docs := configContainment(path, configFilters[path])
+		cond := r.db.Where("configs @> ?::jsonb", docs[0])
+		for _, doc := range docs[1:] {
+			cond = cond.Or("configs @> ?::jsonb", doc)
+		}
+		q = q.Where(cond)
+	}
+	if !includeArchived {
+		q = q.Where("is_archived = ?", false)
+	}
 
 	// Apply cursor-based pagination filter if cursor is provided
 	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
@@ -143,27 +395,150 @@ func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, s
 	return sessions, q.Order(orderBy).Limit(limit).Find(&sessions).Error
 }
 
+// configContainment returns the JSON documents the configs of a session may contain for the value at the dotted path
+// to equal raw. A raw value that reads as a JSON number, boolean or null matches that value as well as the string,
+// so that configs.max_turns=10 finds both 10 and "10". Containment is answered by the GIN index on configs.
+func configContainment(path string, raw string) []string {
+	quoted, _ := json.Marshal(raw)
+	leaves := []string{string(quoted)}
+	if json.Valid([]byte(raw)) && strings.TrimSpace(raw) == raw && !strings.ContainsAny(raw[:1], `"[{`) {
+		leaves = append(leaves, raw)
+	}
+
+	keys := strings.Split(path, ".")
+	docs := make([]string, 0, len(leaves))
+	for _, doc := range leaves {
+		for i := len(keys) - 1; i >= 0; i-- {
+			key, _ := json.Marshal(keys[i])
+			doc = "{" + string(key) + ":" + doc + "}"
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
 func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// First get the message parent id in session
-		parent := model.Message{}
-		if err := tx.Where(&model.Message{SessionID: msg.SessionID}).Order("created_at desc").Limit(1).Find(&parent).Error; err == nil {
-			if parent.ID != uuid.Nil {
-				msg.ParentID = &parent.ID
-			}
+		if err := chainMessage(tx, msg); err != nil {
+			return err
 		}
 
 		// Create message
 		if err := tx.Create(msg).Error; err != nil {
 			return err
 		}
+		if err := countMessage(tx, msg); err != nil {
+			return err
+		}
 
+		return linkToolCalls(tx, msg)
+	})
+}
+
+// CreateTurn stores the messages of a turn in one transaction, each following the previous one.
+// The first message is chained like by CreateMessageWithAssets.
+func (r *sessionRepo) CreateTurn(ctx context.Context, msgs []*model.Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Messages of a turn would often share a timestamp, they are spaced so they list in order
+		base := time.Now()
+		for i, msg := range msgs {
+			if i == 0 {
+				if err := chainMessage(tx, msg); err != nil {
+					return err
+				}
+			} else {
+				msg.ParentID = &msgs[i-1].ID
+			}
+			msg.CreatedAt = base.Add(time.Duration(i) * time.Microsecond)
+
+			if err := tx.Create(msg).Error; err != nil {
+				return err
+			}
+			if err := countMessage(tx, msg); err != nil {
+				return err
+			}
+			if err := linkToolCalls(tx, msg); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
-func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+// countMessage adds a new message to the counters of its session. The columns are updated without touching
+// updated_at, which tells when the session itself was changed.
+func countMessage(tx *gorm.DB, msg *model.Message) error {
+	return tx.Model(&model.Session{}).Where("id = ?", msg.SessionID).UpdateColumns(map[string]interface{}{
+		"message_count":   gorm.Expr("message_count + 1"),
+		"last_message_at": gorm.Expr("GREATEST(last_message_at, ?)", msg.CreatedAt),
+		"total_bytes":     gorm.Expr("total_bytes + ?", msg.SizeB),
+	}).Error
+}
+
+// chainMessage sets the parent of a new message to the latest message in session unless the caller branches from
+// an explicit parent, and refuses a repeat of the message it follows within the dedupe window of the session
+func chainMessage(tx *gorm.DB, msg *model.Message) error {
+	parent := model.Message{}
+	if msg.ParentID == nil {
+		if err := tx.Where(&model.Message{SessionID: msg.SessionID}).Order("created_at desc").Limit(1).Find(&parent).Error; err == nil {
+			if parent.ID != uuid.Nil {
+				msg.ParentID = &parent.ID
+			}
+		}
+	}
+
+	if msg.ContentHash == "" || msg.ParentID == nil {
+		return nil
+	}
+	session := model.Session{}
+	if err := tx.Select("id", "configs").Where("id = ?", msg.SessionID).Find(&session).Error; err != nil {
+		return err
+	}
+	if window := session.DedupeWindow(); window > 0 {
+		if parent.ID == uuid.Nil {
+			if err := tx.Select("id", "content_hash", "created_at").Where("id = ?", *msg.ParentID).Find(&parent).Error; err != nil {
+				return err
+			}
+		}
+		if parent.ContentHash == msg.ContentHash && time.Since(parent.CreatedAt) < window {
+			return ErrDuplicateMessage
+		}
+	}
+	return nil
+}
+
+// ListBySessionWithCursor lists the messages of a session, optionally only those with one of roles and with a part
+// of one of partTypes. Messages without recorded part types are returned by the part type filter, the caller checks their parts.
+func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, roles []string, partTypes []string, asOf time.Time, collapseSuperseded bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
 	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if len(roles) > 0 {
+		q = q.Where("role IN ?", roles)
+	}
+	if len(partTypes) > 0 {
+		cond := r.db.Where("part_types = '[]'::jsonb")
+		for _, t := range partTypes {
+			cond = cond.Or("part_types @> ?", datatypes.JSONSlice[string]{t})
+		}
+		q = q.Where(cond)
+	}
+	// Messages are never edited, so the messages created up to asOf are the session as it was then
+	if !asOf.IsZero() {
+		q = q.Where("created_at <= ?", asOf)
+	}
+	// Superseded messages are left out with the messages that descend from them
+	if collapseSuperseded {
+		superseded := "session_id = ? AND superseded_by IS NOT NULL"
+		args := []interface{}{sessionID}
+		if !asOf.IsZero() {
+			superseded += " AND superseded_at <= ?"
+			args = append(args, asOf)
+		}
+		q = q.Where("id NOT IN (?)", r.db.Raw(`WITH RECURSIVE collapsed AS (
+			SELECT id FROM messages WHERE `+superseded+`
+			UNION
+			SELECT m.id FROM messages m JOIN collapsed c ON m.parent_id = c.id
+		) SELECT id FROM collapsed`, args...))
+	}
 
 	// Apply cursor-based pagination filter if cursor is provided
 	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
@@ -193,3 +568,287 @@ func (r *sessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uu
 	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Find(&messages).Error
 	return messages, err
 }
+
+// ListMessagesByIDs returns the messages of messageIDs that exist, in no particular order
+func (r *sessionRepo) ListMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error) {
+	var messages []model.Message
+	err := r.db.WithContext(ctx).Where("id IN ?", messageIDs).Find(&messages).Error
+	return messages, err
+}
+
+func (r *sessionRepo) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	var msg model.Message
+	if err := r.db.WithContext(ctx).Where("id = ? AND session_id = ?", messageID, sessionID).First(&msg).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SupersedeMessage marks a message of a session as superseded by another one
+func (r *sessionRepo) SupersedeMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, byID uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("id = ? AND session_id = ?", messageID, sessionID).
+		Updates(map[string]interface{}{"superseded_by": byID, "superseded_at": at}).Error
+}
+
+// MergeMessageMeta sets the given keys of the meta of a message, the other keys are kept
+func (r *sessionRepo) MergeMessageMeta(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, meta map[string]any) error {
+	return r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("id = ? AND session_id = ?", messageID, sessionID).
+		UpdateColumn("meta", gorm.Expr("meta || ?::jsonb", datatypes.JSONMap(meta))).Error
+}
+
+// DeleteMessage deletes a message of a session and returns the number of its children. The children are re-linked
+// to the parent of the message first, parent_id cascading on delete would remove the branches below it otherwise.
+// Supersessions and tool call links pointing to the message are cleared, the summary of the session is reset so it is
+// rebuilt without the message, the counters of the session are updated, the message_deleted event is recorded and
+// the assets of the message are released.
+func (r *sessionRepo) DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (int64, error) {
+	var relinked int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var msg model.Message
+		if err := tx.Where("id = ? AND session_id = ?", messageID, sessionID).First(&msg).Error; err != nil {
+			return err
+		}
+
+		res := tx.Model(&model.Message{}).
+			Where("session_id = ? AND parent_id = ?", sessionID, messageID).
+			UpdateColumn("parent_id", msg.ParentID)
+		if res.Error != nil {
+			return fmt.Errorf("relink children: %w", res.Error)
+		}
+		relinked = res.RowsAffected
+
+		if err := tx.Model(&model.Message{}).
+			Where("session_id = ? AND superseded_by = ?", sessionID, messageID).
+			UpdateColumns(map[string]interface{}{"superseded_by": nil, "superseded_at": nil}).Error; err != nil {
+			return fmt.Errorf("clear supersessions: %w", err)
+		}
+		if err := tx.Model(&model.ToolCallLink{}).
+			Where("session_id = ? AND call_message_id = ?", sessionID, messageID).
+			UpdateColumns(map[string]interface{}{"call_message_id": nil, "called_at": nil}).Error; err != nil {
+			return fmt.Errorf("clear tool calls: %w", err)
+		}
+		if err := tx.Model(&model.ToolCallLink{}).
+			Where("session_id = ? AND result_message_id = ?", sessionID, messageID).
+			UpdateColumns(map[string]interface{}{"result_message_id": nil, "result_at": nil}).Error; err != nil {
+			return fmt.Errorf("clear tool results: %w", err)
+		}
+
+		if err := tx.Delete(&msg).Error; err != nil {
+			return fmt.Errorf("delete message: %w", err)
+		}
+
+		// UpdateColumns keeps updated_at, like countMessage
+		if err := tx.Model(&model.Session{}).Where("id = ?", sessionID).UpdateColumns(map[string]interface{}{
+			"message_count":      gorm.Expr("GREATEST(message_count - 1, 0)"),
+			"total_bytes":        gorm.Expr("GREATEST(total_bytes - ?, 0)", msg.SizeB),
+			"last_message_at":    gorm.Expr("(SELECT MAX(created_at) FROM messages WHERE session_id = ?)", sessionID),
+			"summary":            "",
+			"summary_message_id": nil,
+			"summary_messages":   0,
+			"summary_updated_at": nil,
+		}).Error; err != nil {
+			return fmt.Errorf("update session counters: %w", err)
+		}
+
+		data := datatypes.JSONMap{"message_id": messageID.String(), "relinked_children": relinked}
+		if msg.ParentID != nil {
+			data["parent_id"] = msg.ParentID.String()
+		}
+		if err := recordSessionEvent(tx, sessionID, model.SessionEventMessageDeleted, data); err != nil {
+			return err
+		}
+
+		if assets := r.messagesAssets(ctx, []model.Message{msg}); len(assets) > 0 {
+			if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, assets); err != nil {
+				return fmt.Errorf("decrement asset references: %w", err)
+			}
+		}
+		return nil
+	})
+	return relinked, err
+}
+
+// SumUsageByModel totals the reported token usage of a session per model, messages without usage are skipped
+func (r *sessionRepo) SumUsageByModel(ctx context.Context, sessionID uuid.UUID) ([]ModelUsage, error) {
+	var usage []ModelUsage
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Select("usage_model AS model, SUM(usage_prompt_tokens) AS prompt_tokens, SUM(usage_completion_tokens) AS completion_tokens, COUNT(*) AS messages").
+		Where("session_id = ? AND (usage_prompt_tokens > 0 OR usage_completion_tokens > 0)", sessionID).
+		Group("usage_model").
+		Order("usage_model").
+		Scan(&usage).Error
+	return usage, err
+}
+
+// AnnotationCount is the number of annotations of a session with a reaction and label
+type AnnotationCount struct {
+	Reaction    string
+	Label       string
+	Annotations int64
+	Scored      int64   // annotations with a score
+	ScoreSum    float64 // sum of their scores
+}
+
+// SumAnnotations counts the annotations of the messages of a session per reaction and label
+func (r *sessionRepo) SumAnnotations(ctx context.Context, sessionID uuid.UUID) ([]AnnotationCount, error) {
+	var counts []AnnotationCount
+	err := r.db.WithContext(ctx).Model(&model.MessageAnnotation{}).
+		Select("reaction, label, COUNT(*) AS annotations, COUNT(score) AS scored, COALESCE(SUM(score), 0) AS score_sum").
+		Where("session_id = ?", sessionID).
+		Group("reaction, label").
+		Order("reaction, label").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// UpdateMetadata writes the title, description and tags of a session, including empty values
+func (r *sessionRepo) UpdateMetadata(ctx context.Context, s *model.Session) error {
+	return r.db.WithContext(ctx).Model(&model.Session{ID: s.ID}).Select("title", "description", "tags").Updates(s).Error
+}
+
+// SetTitleIfEmpty sets the title of a session that has none yet
+func (r *sessionRepo) SetTitleIfEmpty(ctx context.Context, sessionID uuid.UUID, title string) error {
+	return r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND title = ''", sessionID).
+		UpdateColumn("title", title).Error
+}
+
+// SetArchived archives or restores a session and records the archived or unarchived event
+func (r *sessionRepo) SetArchived(ctx context.Context, sessionID uuid.UUID, archived bool) error {
+	kind := model.SessionEventUnarchived
+	if archived {
+		kind = model.SessionEventArchived
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Session{ID: sessionID}).Update("is_archived", archived).Error; err != nil {
+			return err
+		}
+		return recordSessionEvent(tx, sessionID, kind, nil)
+	})
+}
+
+// SampleMessages returns up to limit messages of the project matching f, in random order
+func (r *sessionRepo) SampleMessages(ctx context.Context, projectID uuid.UUID, f MessageSampleFilter, limit int) ([]model.Message, error) {
+	q := r.db.WithContext(ctx).
+		Where("session_id IN (?)", r.db.Model(&model.Session{}).Select("id").Where("project_id = ?", projectID))
+	if len(f.Roles) > 0 {
+		q = q.Where("role IN ?", f.Roles)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+	if f.WithToolCall {
+		q = q.Where("part_types @> ?", datatypes.JSONSlice[string]{"tool-call"})
+	}
+
+	var msgs []model.Message
+	return msgs, q.Order("random()").Limit(limit).Find(&msgs).Error
+}
+
+// ListIdle returns the sessions of a project neither updated nor given a message since idleSince, oldest first
+func (r *sessionRepo) ListIdle(ctx context.Context, projectID uuid.UUID, idleSince time.Time, includeArchived bool, limit int) ([]uuid.UUID, error) {
+	q := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("project_id = ? AND updated_at < ?", projectID, idleSince).
+		Where("NOT EXISTS (SELECT 1 FROM messages WHERE messages.session_id = sessions.id AND messages.created_at >= ?)", idleSince)
+	if !includeArchived {
+		q = q.Where("is_archived = ?", false)
+	}
+
+	var ids []uuid.UUID
+	err := q.Order("updated_at ASC").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// escapeLike escapes the LIKE wildcards of s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// UpdateSummary stores a summary only if the stored one still ends at fromMessageID,
+// so concurrent workers don't overwrite a newer summary. It reports whether the summary was stored.
+func (r *sessionRepo) UpdateSummary(ctx context.Context, sessionID uuid.UUID, fromMessageID *uuid.UUID, summary SessionSummaryUpdate) (bool, error) {
+	q := r.db.WithContext(ctx).Model(&model.Session{}).Where("id = ?", sessionID)
+	if fromMessageID == nil {
+		q = q.Where("summary_message_id IS NULL")
+	} else {
+		q = q.Where("summary_message_id = ?", *fromMessageID)
+	}
+
+	// UpdateColumns keeps updated_at, the session itself did not change
+	res := q.UpdateColumns(map[string]interface{}{
+		"summary":            summary.Summary,
+		"summary_message_id": summary.MessageID,
+		"summary_messages":   summary.Messages,
+		"summary_updated_at": time.Now(),
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *sessionRepo) MessageExists(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("id = ? AND session_id = ?", messageID, sessionID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// recordSessionEvent adds an event to the log of a session within tx, nothing is recorded when the session does not exist
+func recordSessionEvent(tx *gorm.DB, sessionID uuid.UUID, kind string, data datatypes.JSONMap) error {
+	if data == nil {
+		data = datatypes.JSONMap{}
+	}
+	return tx.Exec(
+		"INSERT INTO session_events (project_id, session_id, kind, data) SELECT project_id, id, ?, ? FROM sessions WHERE id = ?",
+		kind, data, sessionID,
+	).Error
+}
+
+func sessionCreatedEventData(s *model.Session) datatypes.JSONMap {
+	data := datatypes.JSONMap{}
+	if s.SpaceID != nil {
+		data["space_id"] = s.SpaceID.String()
+	}
+	return data
+}
+
+// sortedKeys returns the keys of m in order, config changes are logged by key so their values are not copied to the log
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *sessionRepo) ListEventsWithCursor(ctx context.Context, sessionID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.SessionEvent, error) {
+	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var items []model.SessionEvent
+	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
+}
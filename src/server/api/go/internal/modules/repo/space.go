@@ -2,11 +2,16 @@ package repo
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SpaceRepo interface {
@@ -14,10 +19,19 @@ type SpaceRepo interface {
 	Delete(ctx context.Context, s *model.Space) error
 	Update(ctx context.Context, s *model.Space) error
 	Get(ctx context.Context, s *model.Space) (*model.Space, error)
-	ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error)
+	UpdateMetadata(ctx context.Context, s *model.Space) error
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, nameQuery string, tag string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error)
 	ListExperienceConfirmationsWithCursor(ctx context.Context, spaceID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.ExperienceConfirmation, error)
 	GetExperienceConfirmation(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID) (*model.ExperienceConfirmation, error)
 	DeleteExperienceConfirmation(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID) error
+	SearchMessages(ctx context.Context, spaceID uuid.UUID, query string, beforeCreatedAt time.Time, beforeID uuid.UUID, limit int) ([]model.Message, error)
+	SearchBlocks(ctx context.Context, spaceID uuid.UUID, query string, blockType string, afterRank float32, afterID uuid.UUID, limit int) ([]RankedBlock, error)
+	SemanticSearchBlocks(ctx context.Context, spaceID uuid.UUID, embedding []float32, blockType string, maxDistance float64, limit int) ([]NearBlock, error)
+	ListBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error)
+	ListTreeBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error)
+	ListContentBlocks(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID) ([]model.Block, error)
+	CreateWithBlocks(ctx context.Context, s *model.Space, blocks []model.Block) error
+	Merge(ctx context.Context, dstID uuid.UUID, srcID uuid.UUID) (*SpaceMergeResult, error)
 }
 
 type spaceRepo struct{ db *gorm.DB }
@@ -42,9 +56,21 @@ func (r *spaceRepo) Get(ctx context.Context, s *model.Space) (*model.Space, erro
 	return s, r.db.WithContext(ctx).Where(&model.Space{ID: s.ID}).First(s).Error
 }
 
-func (r *spaceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error) {
+// UpdateMetadata writes the name, description and tags of a space, including empty values
+func (r *spaceRepo) UpdateMetadata(ctx context.Context, s *model.Space) error {
+	return r.db.WithContext(ctx).Model(&model.Space{ID: s.ID}).Select("name", "description", "tags").Updates(s).Error
+}
+
+func (r *spaceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, nameQuery string, tag string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error) {
 	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
 
+	if nameQuery != "" {
+		q = q.Where("name ILIKE ?", "%"+escapeLike(nameQuery)+"%")
+	}
+	if tag != "" {
+		q = q.Where("tags @> ?", datatypes.JSONSlice[string]{tag})
+	}
+
 	// Apply cursor-based pagination filter if cursor is provided
 	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
 		// Determine comparison operator based on sort direction
@@ -110,3 +136,291 @@ func (r *spaceRepo) DeleteExperienceConfirmation(ctx context.Context, spaceID uu
 		Where("id = ? AND space_id = ?", experienceID, spaceID).
 		Delete(&model.ExperienceConfirmation{}).Error
 }
+
+// SearchMessages returns the messages of the sessions connected to a space whose text contains query, case-insensitively,
+// latest first. Only the columns of a search hit are loaded.
+func (r *spaceRepo) SearchMessages(ctx context.Context, spaceID uuid.UUID, query string, beforeCreatedAt time.Time, beforeID uuid.UUID, limit int) ([]model.Message, error) {
+	q := r.db.WithContext(ctx).Model(&model.Message{}).
+		Select("id", "session_id", "role", "search_text", "created_at").
+		Where("session_id IN (?)", r.db.Model(&model.Session{}).Select("id").Where("space_id = ?", spaceID)).
+		Where("search_text ILIKE ?", "%"+escapeLike(query)+"%")
+
+	if !beforeCreatedAt.IsZero() && beforeID != uuid.Nil {
+		q = q.Where("(created_at < ?) OR (created_at = ? AND id < ?)", beforeCreatedAt, beforeCreatedAt, beforeID)
+	}
+
+	var msgs []model.Message
+	return msgs, q.Order("created_at DESC, id DESC").Limit(limit).Find(&msgs).Error
+}
+
+// BlockSearchVector is the full-text document of a block, its title weighted above the text props of
+// model.BlockSearchProps. The blocks have a GIN index on it, searches use the same expression to be served by it.
+var BlockSearchVector = func() string {
+	props := make([]string, 0, len(model.BlockSearchProps))
+	for _, key := range model.BlockSearchProps {
+		props = append(props, fmt.Sprintf("coalesce(props->>'%s', '')", key))
+	}
+	return "setweight(to_tsvector('simple'::regconfig, title), 'A') || " +
+		"setweight(to_tsvector('simple'::regconfig, " + strings.Join(props, " || ' ' || ") + "), 'B')"
+}()
+
+// RankedBlock is a block matching a full-text search, with the rank of the match
+type RankedBlock struct {
+	ID       uuid.UUID                          `gorm:"column:id"`
+	ParentID *uuid.UUID                         `gorm:"column:parent_id"`
+	Type     string                             `gorm:"column:type"`
+	Title    string                             `gorm:"column:title"`
+	Props    datatypes.JSONType[map[string]any] `gorm:"column:props"`
+	Rank     float32                            `gorm:"column:rank"`
+}
+
+// SearchBlocks returns the blocks of a space that are not archived and match query, a web search query, on their
+// title and text, best ranked first. blockType filters the type when not empty. Blocks after a cursor rank below
+// afterRank, or rank the same with a greater id.
+func (r *spaceRepo) SearchBlocks(ctx context.Context, spaceID uuid.UUID, query string, blockType string, afterRank float32, afterID uuid.UUID, limit int) ([]RankedBlock, error) {
+	tsquery := "websearch_to_tsquery('simple'::regconfig, ?)"
+	ranked := r.db.Model(&model.Block{}).
+		Select("id, parent_id, type, title, props, ts_rank("+BlockSearchVector+", "+tsquery+") AS rank", query).
+		Where("space_id = ? AND is_archived = ?", spaceID, false).
+		Where("("+BlockSearchVector+") @@ "+tsquery, query)
+	if blockType != "" {
+		ranked = ranked.Where("type = ?", blockType)
+	}
+
+	q := r.db.WithContext(ctx).Table("(?) AS ranked", ranked)
+	if afterID != uuid.Nil {
+		q = q.Where("rank < ? OR (rank = ? AND id > ?)", afterRank, afterRank, afterID)
+	}
+
+	var blocks []RankedBlock
+	return blocks, q.Order("rank DESC, id ASC").Limit(limit).Find(&blocks).Error
+}
+
+// NearBlock is a block whose embedding is near a query embedding, with the cosine distance between them
+type NearBlock struct {
+	ID       uuid.UUID                          `gorm:"column:id"`
+	ParentID *uuid.UUID                         `gorm:"column:parent_id"`
+	Type     string                             `gorm:"column:type"`
+	Title    string                             `gorm:"column:title"`
+	Props    datatypes.JSONType[map[string]any] `gorm:"column:props"`
+	Distance float64                            `gorm:"column:distance"`
+}
+
+// semanticSearchOversample is how many nearest embeddings SemanticSearchBlocks reads per block it returns, since a
+// block can have several embeddings and the nearest ones can belong to archived blocks or blocks of another type
+const semanticSearchOversample = 10
+
+// SemanticSearchBlocks returns the blocks of a space that are not archived nearest to embedding, by the cosine
+// distance of their nearest stored embedding, up to maxDistance when above 0. blockType filters the type when not
+// empty. Blocks without embedding are left out.
+//
+// The nearest embeddings are read first, ordered by distance with a limit so the vector index can serve them, then
+// deduplicated per block and filtered. A space with many archived blocks near the query can return fewer than limit
+// blocks.
+func (r *spaceRepo) SemanticSearchBlocks(ctx context.Context, spaceID uuid.UUID, embedding []float32, blockType string, maxDistance float64, limit int) ([]NearBlock, error) {
+	vec := vectorLiteral(embedding)
+	nearest := r.db.Table("block_embeddings").
+		Select("block_id, embedding <=> ?::vector AS distance", vec).
+		Where("space_id = ?", spaceID).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "embedding <=> ?::vector", Vars: []any{vec}}}).
+		Limit(limit * semanticSearchOversample)
+	near := r.db.Table("(?) AS nearest", nearest).
+		Select("block_id, MIN(distance) AS distance").
+		Group("block_id")
+
+	q := r.db.WithContext(ctx).Model(&model.Block{}).
+		Select("blocks.id, blocks.parent_id, blocks.type, blocks.title, blocks.props, near.distance").
+		Joins("JOIN (?) AS near ON near.block_id = blocks.id", near).
+		Where("blocks.space_id = ? AND blocks.is_archived = ?", spaceID, false)
+	if blockType != "" {
+		q = q.Where("blocks.type = ?", blockType)
+	}
+	if maxDistance > 0 {
+		q = q.Where("near.distance <= ?", maxDistance)
+	}
+
+	var blocks []NearBlock
+	return blocks, q.Order("near.distance ASC, blocks.id ASC").Limit(limit).Find(&blocks).Error
+}
+
+// vectorLiteral formats an embedding as a pgvector literal, [x,y,...]
+func vectorLiteral(v []float32) string {
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.FormatFloat(float64(x), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// ListBlocks returns the blocks of a space that are not archived with the tool SOPs of SOP blocks, ordered by sort
+func (r *spaceRepo) ListBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error) {
+	var blocks []model.Block
+	err := r.db.WithContext(ctx).
+		Preload("ToolSOPs", func(db *gorm.DB) *gorm.DB { return db.Order(`"order" ASC`) }).
+		Preload("ToolSOPs.ToolReference").
+		Where("space_id = ? AND is_archived = ?", spaceID, false).
+		Order("sort ASC, id ASC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// ListTreeBlocks returns the folders and pages of a space that are not archived, ordered by sort
+func (r *spaceRepo) ListTreeBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error) {
+	var blocks []model.Block
+	err := r.db.WithContext(ctx).
+		Where("space_id = ? AND is_archived = ? AND type IN ?", spaceID, false, []string{model.BlockTypeFolder, model.BlockTypePage}).
+		Order("sort ASC, id ASC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// ListContentBlocks returns the content of a page, its blocks that are not archived other than folders and pages,
+// with the tool SOPs of SOP blocks, ordered by sort
+func (r *spaceRepo) ListContentBlocks(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID) ([]model.Block, error) {
+	var blocks []model.Block
+	err := r.db.WithContext(ctx).
+		Preload("ToolSOPs", func(db *gorm.DB) *gorm.DB { return db.Order(`"order" ASC`) }).
+		Preload("ToolSOPs.ToolReference").
+		Where("space_id = ? AND parent_id = ? AND is_archived = ? AND type NOT IN ?", spaceID, pageID, false, []string{model.BlockTypeFolder, model.BlockTypePage}).
+		Order("sort ASC, id ASC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// CreateWithBlocks creates a space and its blocks at once, blocks are ordered with each parent before its children.
+// Slugs of pages are suffixed with a number when an earlier page has them.
+func (r *spaceRepo) CreateWithBlocks(ctx context.Context, s *model.Space, blocks []model.Block) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		for i := range blocks {
+			blocks[i].SpaceID = s.ID
+		}
+		if err := uniqueSlugs(tx, blocks); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(blocks, 500).Error
+	})
+}
+
+// SpaceMergeResult counts what Merge moved
+type SpaceMergeResult struct {
+	Blocks   int64 `json:"blocks"`
+	Sessions int64 `json:"sessions"`
+	ToolSOPs int64 `json:"tool_sops"`
+	// SlugsRenamed is the number of moved pages whose slug was taken in the destination, their slug is suffixed with a
+	// number
+	SlugsRenamed int64 `json:"slugs_renamed"`
+}
+
+// Merge moves the blocks, with their tool SOPs and embeddings, the connected sessions, the experience confirmations
+// and the sync rules of space srcID into space dstID, then deletes srcID, in one transaction. The top-level blocks of
+// srcID are sorted after those of dstID in their own order.
+func (r *spaceRepo) Merge(ctx context.Context, dstID uuid.UUID, srcID uuid.UUID) (*SpaceMergeResult, error) {
+	res := &SpaceMergeResult{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock both spaces in a fixed order, so blocks are not written to them meanwhile
+		var spaces []model.Space
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id IN ?", []uuid.UUID{dstID, srcID}).Order("id").Find(&spaces).Error; err != nil {
+			return err
+		}
+		if len(spaces) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+
+		srcBlocks := tx.Model(&model.Block{}).Select("id").Where("space_id = ?", srcID)
+		if err := tx.Model(&model.ToolSOP{}).Where("sop_block_id IN (?)", srcBlocks).Count(&res.ToolSOPs).Error; err != nil {
+			return err
+		}
+
+		renamed, err := renameTakenSlugs(tx, dstID, srcID)
+		if err != nil {
+			return err
+		}
+		res.SlugsRenamed = renamed
+
+		var sorts struct {
+			Next  int64
+			First int64
+		}
+		if err := tx.Model(&model.Block{}).
+			Select("(SELECT COALESCE(MAX(sort) + 1, 0) FROM blocks WHERE space_id = ? AND parent_id IS NULL) AS next, COALESCE(MIN(sort), 0) AS first", dstID).
+			Where("space_id = ? AND parent_id IS NULL", srcID).
+			Scan(&sorts).Error; err != nil {
+			return err
+		}
+		moved := tx.Model(&model.Block{}).Where("space_id = ?", srcID).Updates(map[string]any{
+			"space_id": dstID,
+			"sort":     gorm.Expr("CASE WHEN parent_id IS NULL THEN sort + ? ELSE sort END", sorts.Next-sorts.First),
+		})
+		if moved.Error != nil {
+			return moved.Error
+		}
+		res.Blocks = moved.RowsAffected
+
+		if err := tx.Table("block_embeddings").Where("space_id = ?", srcID).Update("space_id", dstID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(
+			"UPDATE stale_items SET item_ref = jsonb_set(item_ref, '{space_id}', to_jsonb(?::text)) WHERE item_type = ? AND item_ref->>'space_id' = ?",
+			dstID.String(), model.StaleItemTypeBlock, srcID.String(),
+		).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(
+			"INSERT INTO session_events (project_id, session_id, kind, data) SELECT project_id, id, ?, ? FROM sessions WHERE space_id = ?",
+			model.SessionEventConnectedToSpace, datatypes.JSONMap{"space_id": dstID.String()}, srcID,
+		).Error; err != nil {
+			return fmt.Errorf("record session events: %w", err)
+		}
+		sessions := tx.Model(&model.Session{}).Where("space_id = ?", srcID).Update("space_id", dstID)
+		if sessions.Error != nil {
+			return sessions.Error
+		}
+		res.Sessions = sessions.RowsAffected
+
+		if err := tx.Model(&model.ExperienceConfirmation{}).Where("space_id = ?", srcID).Update("space_id", dstID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.SyncRule{}).Where("space_id = ?", srcID).Update("space_id", dstID).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&model.Space{ID: srcID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// renameTakenSlugs suffixes with a number the slugs of the pages of space srcID that pages of space dstID already have,
+// so the pages of srcID can be moved to dstID, and returns how many were renamed
+func renameTakenSlugs(tx *gorm.DB, dstID uuid.UUID, srcID uuid.UUID) (int64, error) {
+	var pages []model.Block
+	if err := tx.Select("id", "slug").
+		Where("space_id = ? AND slug IN (?)", srcID, tx.Model(&model.Block{}).Select("slug").Where("space_id = ? AND slug IS NOT NULL", dstID)).
+		Find(&pages).Error; err != nil {
+		return 0, err
+	}
+	if len(pages) == 0 {
+		return 0, nil
+	}
+
+	var used []string
+	if err := tx.Model(&model.Block{}).Where("space_id IN ? AND slug IS NOT NULL", []uuid.UUID{dstID, srcID}).Pluck("slug", &used).Error; err != nil {
+		return 0, err
+	}
+	taken := slugSet(used)
+	for _, pg := range pages {
+		if err := tx.Model(&model.Block{}).Where("id = ?", pg.ID).Update("slug", claimSlug(taken, *pg.Slug)).Error; err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(pages)), nil
+}
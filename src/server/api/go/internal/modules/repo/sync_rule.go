@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SyncRuleRepo interface {
+	Create(ctx context.Context, r *model.SyncRule) error
+	Get(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) (*model.SyncRule, error)
+	Update(ctx context.Context, r *model.SyncRule) error
+	Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) error
+	ListBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error)
+	ListEnabledForSession(ctx context.Context, sessionID uuid.UUID) ([]model.SyncRule, error)
+	GetPage(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, pageID uuid.UUID) (*model.Block, error)
+	AppendBlock(ctx context.Context, ruleID uuid.UUID, messageID uuid.UUID, b *model.Block) (bool, error)
+}
+
+type syncRuleRepo struct{ db *gorm.DB }
+
+func NewSyncRuleRepo(db *gorm.DB) SyncRuleRepo {
+	return &syncRuleRepo{db: db}
+}
+
+// inSpace scopes a sync_rules query to a space of the project
+func (r *syncRuleRepo) inSpace(tx *gorm.DB, projectID uuid.UUID, spaceID uuid.UUID) *gorm.DB {
+	return tx.
+		Where("sync_rules.space_id = ?", spaceID).
+		Where("sync_rules.space_id IN (?)", r.db.Model(&model.Space{}).Select("id").Where("project_id = ?", projectID))
+}
+
+func (r *syncRuleRepo) Create(ctx context.Context, rule *model.SyncRule) error {
+	return r.db.WithContext(ctx).Create(rule).Error
+}
+
+func (r *syncRuleRepo) Get(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) (*model.SyncRule, error) {
+	var rule model.SyncRule
+	if err := r.inSpace(r.db.WithContext(ctx), projectID, spaceID).Where("sync_rules.id = ?", id).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *syncRuleRepo) Update(ctx context.Context, rule *model.SyncRule) error {
+	// Select is needed to store a disabled rule, Updates skips zero values otherwise
+	return r.db.WithContext(ctx).Model(rule).Select("name", "match", "enabled").Updates(rule).Error
+}
+
+func (r *syncRuleRepo) Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) error {
+	return r.inSpace(r.db.WithContext(ctx), projectID, spaceID).Where("sync_rules.id = ?", id).Delete(&model.SyncRule{}).Error
+}
+
+func (r *syncRuleRepo) ListBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error) {
+	var rules []model.SyncRule
+	return rules, r.inSpace(r.db.WithContext(ctx), projectID, spaceID).Order("created_at ASC, id ASC").Find(&rules).Error
+}
+
+// ListEnabledForSession returns the enabled rules of the space the session is connected to.
+// It returns no rules if the session is not connected or no longer exists.
+func (r *syncRuleRepo) ListEnabledForSession(ctx context.Context, sessionID uuid.UUID) ([]model.SyncRule, error) {
+	var rules []model.SyncRule
+	return rules, r.db.WithContext(ctx).
+		Joins("JOIN sessions ON sessions.space_id = sync_rules.space_id").
+		Where("sessions.id = ? AND sync_rules.enabled = true", sessionID).
+		Order("sync_rules.created_at ASC, sync_rules.id ASC").
+		Find(&rules).Error
+}
+
+// GetPage returns a page block of a space of the project, or nil if there is none
+func (r *syncRuleRepo) GetPage(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, pageID uuid.UUID) (*model.Block, error) {
+	var b model.Block
+	err := r.db.WithContext(ctx).
+		Where("blocks.id = ? AND blocks.space_id = ? AND blocks.type = ?", pageID, spaceID, model.BlockTypePage).
+		Where("blocks.space_id IN (?)", r.db.Model(&model.Space{}).Select("id").Where("project_id = ?", projectID)).
+		First(&b).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// AppendBlock appends b at the end of its parent page, unless the message was already copied by the rule,
+// so redelivered events do not duplicate blocks. It reports whether the block was created.
+func (r *syncRuleRepo) AppendBlock(ctx context.Context, ruleID uuid.UUID, messageID uuid.UUID, b *model.Block) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the page so concurrent appends get distinct sort values
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", b.ParentID).
+			First(&model.Block{}).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&model.Block{}).
+			Where("parent_id = ? AND props->>'sync_rule_id' = ? AND props->>'source_message_id' = ?", b.ParentID, ruleID.String(), messageID.String()).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		type result struct{ Next int64 }
+		var res result
+		if err := tx.Model(&model.Block{}).
+			Where("space_id = ? AND parent_id = ?", b.SpaceID, b.ParentID).
+			Select("COALESCE(MAX(sort), -1) + 1 AS next").
+			Take(&res).Error; err != nil {
+			return err
+		}
+		b.Sort = res.Next
+
+		if err := tx.Create(b).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
@@ -6,11 +6,15 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type TaskRepo interface {
 	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Task, error)
+	ListJobsWithCursor(ctx context.Context, projectID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Task, error)
+	CreateJob(ctx context.Context, projectID uuid.UUID, kind string, data datatypes.JSONMap) (*model.Task, error)
+	UpdateJob(ctx context.Context, id uuid.UUID, status string, data datatypes.JSONMap) error
 }
 
 type taskRepo struct{ db *gorm.DB }
@@ -44,3 +48,65 @@ func (r *taskRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.U
 	var items []model.Task
 	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
 }
+
+// ListJobsWithCursor lists the tasks tracking the jobs of the server for a project, of one kind when kind is not empty
+func (r *taskRepo) ListJobsWithCursor(ctx context.Context, projectID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Task, error) {
+	q := r.db.WithContext(ctx).Where("project_id = ? AND session_id IS NULL", projectID)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		// Determine comparison operator based on sort direction
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	// Apply ordering based on sort direction
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var items []model.Task
+	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
+}
+
+// CreateJob creates a running task tracking a job of the server, it belongs to the project and no session
+func (r *taskRepo) CreateJob(ctx context.Context, projectID uuid.UUID, kind string, data datatypes.JSONMap) (*model.Task, error) {
+	if data == nil {
+		data = datatypes.JSONMap{}
+	}
+	task := &model.Task{
+		ProjectID: projectID,
+		Kind:      kind,
+		Data:      data,
+		Status:    model.TaskStatusRunning,
+	}
+	if err := r.db.WithContext(ctx).Create(task).Error; err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// UpdateJob sets the status of a job task and merges data into its data
+func (r *taskRepo) UpdateJob(ctx context.Context, id uuid.UUID, status string, data datatypes.JSONMap) error {
+	if data == nil {
+		data = datatypes.JSONMap{}
+	}
+	return r.db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND session_id IS NULL", id).
+		UpdateColumns(map[string]interface{}{
+			"status":     status,
+			"data":       gorm.Expr("data || ?::jsonb", data),
+			"updated_at": time.Now(),
+		}).Error
+}
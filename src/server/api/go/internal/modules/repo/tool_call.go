@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ToolCallRepo interface {
+	ListBySession(ctx context.Context, sessionID uuid.UUID, name string, pendingOnly bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.ToolCallLink, error)
+}
+
+type toolCallRepo struct{ db *gorm.DB }
+
+func NewToolCallRepo(db *gorm.DB) ToolCallRepo {
+	return &toolCallRepo{db: db}
+}
+
+// ListBySession returns the tool calls of a session in the order they were recorded, after the cursor.
+// name keeps the calls of one tool, pendingOnly the calls without result.
+func (r *toolCallRepo) ListBySession(ctx context.Context, sessionID uuid.UUID, name string, pendingOnly bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.ToolCallLink, error) {
+	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if name != "" {
+		q = q.Where("name = ?", name)
+	}
+	if pendingOnly {
+		q = q.Where("result_message_id IS NULL")
+	}
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(created_at > ?) OR (created_at = ? AND id > ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var links []model.ToolCallLink
+	return links, q.Order("created_at ASC, id ASC").Limit(limit).Find(&links).Error
+}
+
+// linkToolCalls records the tool calls and results of a new message, within the transaction storing it.
+// A call or result seen again for the same tool call id replaces its side of the link.
+func linkToolCalls(tx *gorm.DB, msg *model.Message) error {
+	calls, results := model.ToolCallLinks(msg)
+	conflict := []clause.Column{{Name: "session_id"}, {Name: "tool_call_id"}}
+	if len(calls) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   conflict,
+			DoUpdates: clause.AssignmentColumns([]string{"name", "call_message_id", "called_at", "updated_at"}),
+		}).Create(&calls).Error; err != nil {
+			return err
+		}
+	}
+	if len(results) > 0 {
+		// the name of the call wins, results only name the tool in some formats
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: conflict,
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"name":              gorm.Expr("COALESCE(NULLIF(tool_call_links.name, ''), excluded.name)"),
+				"result_message_id": gorm.Expr("excluded.result_message_id"),
+				"result_at":         gorm.Expr("excluded.result_at"),
+				"updated_at":        gorm.Expr("excluded.updated_at"),
+			}),
+		}).Create(&results).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyToolCallLinks copies the tool call links of forked messages to the fork, ids maps the original messages to their copies
+func copyToolCallLinks(tx *gorm.DB, sourceSessionID, forkID uuid.UUID, ids map[uuid.UUID]uuid.UUID) error {
+	var links []model.ToolCallLink
+	if err := tx.Where("session_id = ?", sourceSessionID).Find(&links).Error; err != nil {
+		return err
+	}
+
+	copies := make([]model.ToolCallLink, 0, len(links))
+	for _, l := range links {
+		cp := model.ToolCallLink{SessionID: forkID, ToolCallID: l.ToolCallID, Name: l.Name}
+		if l.CallMessageID != nil {
+			if id, ok := ids[*l.CallMessageID]; ok {
+				cp.CallMessageID, cp.CalledAt = &id, l.CalledAt
+			}
+		}
+		if l.ResultMessageID != nil {
+			if id, ok := ids[*l.ResultMessageID]; ok {
+				cp.ResultMessageID, cp.ResultAt = &id, l.ResultAt
+			}
+		}
+		if cp.CallMessageID == nil && cp.ResultMessageID == nil {
+			continue
+		}
+		copies = append(copies, cp)
+	}
+	if len(copies) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(copies, 100).Error
+}
@@ -17,10 +17,11 @@ func SetLogger(log *zap.Logger) {
 
 // Response
 type Response struct {
-	Code  int         `json:"code"`
-	Data  interface{} `json:"data,omitempty" swaggerignore:"true"`
-	Msg   string      `json:"msg"`
-	Error string      `json:"error,omitempty"`
+	Code      int         `json:"code"`
+	Data      interface{} `json:"data,omitempty" swaggerignore:"true"`
+	Msg       string      `json:"msg"`
+	ErrorCode ErrorCode   `json:"error_code,omitempty" swaggerignore:"true"`
+	Error     string      `json:"error,omitempty"`
 }
 
 // TraceErrorResponse
@@ -32,8 +33,9 @@ type TrackedErrorResponse struct {
 // Err
 func Err(errCode int, msg string, err error) Response {
 	res := Response{
-		Code: errCode,
-		Msg:  msg,
+		Code:      errCode,
+		Msg:       msg,
+		ErrorCode: CodeForStatus(errCode),
 	}
 	// Log error if logger is available
 	if err != nil && logger != nil {
@@ -55,7 +57,9 @@ func DBErr(msg string, err error) Response {
 	if msg == "" {
 		msg = "database error"
 	}
-	return Err(http.StatusInternalServerError, msg, err)
+	res := Err(http.StatusInternalServerError, msg, err)
+	res.ErrorCode = CodeDatabaseError
+	return res
 }
 
 // ParamErr
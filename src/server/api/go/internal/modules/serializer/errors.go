@@ -0,0 +1,145 @@
+package serializer
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ErrorCode is the stable, machine-readable kind of an error response, SDKs map it to typed exceptions
+type ErrorCode string
+
+const (
+	CodeInvalidParameter     ErrorCode = "invalid_parameter"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeUnprocessable        ErrorCode = "unprocessable_entity"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeQuotaExceeded        ErrorCode = "quota_exceeded"
+	CodeDatabaseError        ErrorCode = "database_error"
+	CodeInternal             ErrorCode = "internal_error"
+	CodeUnavailable          ErrorCode = "service_unavailable"
+)
+
+// ErrorCatalogEntry describes an error code and the HTTP status it is sent with
+type ErrorCatalogEntry struct {
+	Code        ErrorCode `json:"code" enums:"invalid_parameter,unauthorized,forbidden,not_found,conflict,payload_too_large,unsupported_media_type,unprocessable_entity,rate_limited,quota_exceeded,database_error,internal_error,service_unavailable"`
+	Status      int       `json:"status"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+}
+
+var errorCatalog = []ErrorCatalogEntry{
+	{CodeInvalidParameter, http.StatusBadRequest, "Invalid parameter", "The request is malformed or a parameter failed validation."},
+	{CodeUnauthorized, http.StatusUnauthorized, "Unauthorized", "The bearer token is missing or invalid."},
+	{CodeForbidden, http.StatusForbidden, "Forbidden", "The token is valid but not allowed to perform the operation."},
+	{CodeNotFound, http.StatusNotFound, "Not found", "The resource does not exist or belongs to another project."},
+	{CodeConflict, http.StatusConflict, "Conflict", "The request conflicts with the current state of the resource."},
+	{CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "Payload too large", "The request body or an uploaded file exceeds a size limit."},
+	{CodeUnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported media type", "The content type of the request or of a file is not supported."},
+	{CodeUnprocessable, http.StatusUnprocessableEntity, "Unprocessable entity", "The request is well-formed but cannot be processed, e.g. a limit was exceeded."},
+	{CodeRateLimited, http.StatusTooManyRequests, "Rate limited", "Too many requests, retry after the delay given in Retry-After."},
+	{CodeQuotaExceeded, http.StatusPaymentRequired, "Quota exceeded", "The project is over a quota, data has the details. Storage is refused with 402 until usage drops, the daily message quota with 429 and Retry-After until it resets."},
+	{CodeDatabaseError, http.StatusInternalServerError, "Database error", "The request failed while reading or writing data, it may be retried."},
+	{CodeInternal, http.StatusInternalServerError, "Internal error", "An unexpected server error."},
+	{CodeUnavailable, http.StatusServiceUnavailable, "Service unavailable", "A dependency of the server is unavailable, retry later."},
+}
+
+// ErrorCatalog lists every error code the API returns
+func ErrorCatalog() []ErrorCatalogEntry {
+	return append([]ErrorCatalogEntry(nil), errorCatalog...)
+}
+
+// CodeForStatus returns the error code of responses sent with status
+func CodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidParameter
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusPaymentRequired:
+		return CodeQuotaExceeded
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return CodeUnavailable
+	default:
+		if status >= 400 && status < 500 {
+			return CodeInvalidParameter
+		}
+		return CodeInternal
+	}
+}
+
+// ErrorResponse documents the body of error responses
+type ErrorResponse struct {
+	Code      int       `json:"code" example:"400"`
+	Msg       string    `json:"msg" example:"parameter error"`
+	ErrorCode ErrorCode `json:"error_code" enums:"invalid_parameter,unauthorized,forbidden,not_found,conflict,payload_too_large,unsupported_media_type,unprocessable_entity,rate_limited,quota_exceeded,database_error,internal_error,service_unavailable"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ProblemContentType is the media type of RFC 9457 (formerly RFC 7807) problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error response in the problem details format, sent to clients that accept it
+type Problem struct {
+	Type   string    `json:"type" example:"https://acontext.io/errors/not_found"`
+	Title  string    `json:"title" example:"Not found"`
+	Status int       `json:"status" example:"404"`
+	Detail string    `json:"detail,omitempty" example:"session not found"`
+	Code   ErrorCode `json:"code" enums:"invalid_parameter,unauthorized,forbidden,not_found,conflict,payload_too_large,unsupported_media_type,unprocessable_entity,rate_limited,quota_exceeded,database_error,internal_error,service_unavailable"`
+	// Instance identifies the occurrence of the problem, set for unexpected errors that can be reported
+	Instance string `json:"instance,omitempty" example:"urn:acontext:incident:123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// IncidentIDHeader carries the id of an unexpected error, under which it is logged and reported
+const IncidentIDHeader = "X-Acontext-Incident-Id"
+
+// IncidentInstancePrefix prefixes the incident id to form the instance URI of a problem
+const IncidentInstancePrefix = "urn:acontext:incident:"
+
+// ProblemTypeBase prefixes the error code to form the type URI of a problem
+const ProblemTypeBase = "https://acontext.io/errors/"
+
+// NewProblem converts an error response into problem details
+func NewProblem(status int, res Response) Problem {
+	code := res.ErrorCode
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+	p := Problem{
+		Type:   ProblemTypeBase + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: res.Msg,
+		Code:   code,
+	}
+	for _, e := range errorCatalog {
+		if e.Code == code {
+			p.Title = e.Title
+			break
+		}
+	}
+	return p
+}
+
+// AcceptsProblem reports whether the Accept header asks for problem details
+func AcceptsProblem(accept string) bool {
+	return strings.Contains(accept, ProblemContentType)
+}
@@ -0,0 +1,59 @@
+package serializer
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeForStatus(t *testing.T) {
+	assert.Equal(t, CodeInvalidParameter, CodeForStatus(http.StatusBadRequest))
+	assert.Equal(t, CodeNotFound, CodeForStatus(http.StatusNotFound))
+	assert.Equal(t, CodeUnprocessable, CodeForStatus(http.StatusUnprocessableEntity))
+	assert.Equal(t, CodeQuotaExceeded, CodeForStatus(http.StatusPaymentRequired))
+	assert.Equal(t, CodeInvalidParameter, CodeForStatus(http.StatusMethodNotAllowed))
+	assert.Equal(t, CodeInternal, CodeForStatus(http.StatusInternalServerError))
+}
+
+func TestErrorCodes(t *testing.T) {
+	assert.Equal(t, CodeNotFound, Err(http.StatusNotFound, "session not found", nil).ErrorCode)
+	assert.Equal(t, CodeInvalidParameter, ParamErr("", nil).ErrorCode)
+	assert.Equal(t, CodeUnauthorized, AuthErr("").ErrorCode)
+	assert.Equal(t, CodeDatabaseError, DBErr("", errors.New("timeout")).ErrorCode)
+}
+
+func TestErrorCatalog(t *testing.T) {
+	catalog := ErrorCatalog()
+	seen := map[ErrorCode]bool{}
+	for _, e := range catalog {
+		assert.False(t, seen[e.Code], "duplicate code %s", e.Code)
+		seen[e.Code] = true
+		assert.GreaterOrEqual(t, e.Status, 400)
+		assert.NotEmpty(t, e.Title)
+	}
+	// Every code derived from a status is documented
+	for _, status := range []int{400, 401, 402, 403, 404, 409, 413, 415, 422, 429, 500, 502, 503} {
+		assert.True(t, seen[CodeForStatus(status)], "status %d", status)
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	p := NewProblem(http.StatusNotFound, Err(http.StatusNotFound, "session not found", nil))
+	assert.Equal(t, ProblemTypeBase+"not_found", p.Type)
+	assert.Equal(t, "Not found", p.Title)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "session not found", p.Detail)
+	assert.Equal(t, CodeNotFound, p.Code)
+
+	// Responses without a code get the one of the status
+	p = NewProblem(http.StatusConflict, Response{Code: http.StatusConflict, Msg: "exists"})
+	assert.Equal(t, CodeConflict, p.Code)
+}
+
+func TestAcceptsProblem(t *testing.T) {
+	assert.True(t, AcceptsProblem("application/problem+json"))
+	assert.True(t, AcceptsProblem("application/json, application/problem+json;q=0.9"))
+	assert.False(t, AcceptsProblem("application/json"))
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+var (
+	ErrAnnotationLabelerRequired = errors.New("labeler is required")
+	ErrAnnotationEmpty           = errors.New("annotation needs a reaction, label, score or comment")
+	ErrAnnotationNotFound        = errors.New("annotation not found")
+)
+
+type AnnotationService interface {
+	Export(ctx context.Context, in ExportAnnotationsInput) (*AnnotationBundle, error)
+	Import(ctx context.Context, in ImportAnnotationsInput) (*ImportAnnotationsOutput, error)
+	Annotate(ctx context.Context, in AnnotateMessageInput) (*model.MessageAnnotation, error)
+	ListForMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) ([]model.MessageAnnotation, error)
+	Remove(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, labeler string) error
+}
+
+type annotationService struct {
+	r        repo.AnnotationRepo
+	sessions SessionService
+}
+
+func NewAnnotationService(r repo.AnnotationRepo, sessions SessionService) AnnotationService {
+	return &annotationService{r: r, sessions: sessions}
+}
+
+type ExportAnnotationsInput struct {
+	ProjectID uuid.UUID
+	Filter    repo.ReviewFilter
+	// ContextMessages is the number of messages preceding each message on its branch included as context
+	ContextMessages int
+	Limit           int
+	Cursor          string
+}
+
+// AnnotationBundle is a page of messages to label, import the labels back with Import
+type AnnotationBundle struct {
+	Labeler    string                 `json:"labeler,omitempty"`
+	ExportedAt time.Time              `json:"exported_at"`
+	Items      []AnnotationBundleItem `json:"items"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+	HasMore    bool                   `json:"has_more"`
+}
+
+type AnnotationBundleItem struct {
+	MessageID uuid.UUID    `json:"message_id"`
+	SessionID uuid.UUID    `json:"session_id"`
+	Role      string       `json:"role"`
+	Parts     []model.Part `json:"parts"`
+	CreatedAt time.Time    `json:"created_at"`
+	// Context holds the messages preceding the message on its branch, oldest first
+	Context []AnnotationContextMessage `json:"context"`
+}
+
+type AnnotationContextMessage struct {
+	MessageID uuid.UUID    `json:"message_id"`
+	Role      string       `json:"role"`
+	Parts     []model.Part `json:"parts"`
+}
+
+// Export returns a page of the messages of the project to label, each with the messages preceding it as context
+func (s *annotationService) Export(ctx context.Context, in ExportAnnotationsInput) (*AnnotationBundle, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	if in.Cursor != "" {
+		var err error
+		if afterT, afterID, err = paging.DecodeCursor(in.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	msgs, err := s.r.ListForReview(ctx, in.ProjectID, in.Filter, afterT, afterID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &AnnotationBundle{Labeler: in.Filter.Labeler, ExportedAt: time.Now().UTC(), Items: []AnnotationBundleItem{}}
+	if len(msgs) > in.Limit {
+		out.HasMore = true
+		msgs = msgs[:in.Limit]
+		last := msgs[len(msgs)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	// Load the annotated messages, then their context one generation of parents at a time, so only the messages
+	// of the bundle are read
+	index := make(map[uuid.UUID]model.Message, len(msgs))
+	ids := make([]uuid.UUID, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	for depth := 0; len(ids) > 0; depth++ {
+		loaded, err := s.sessions.GetMessagesByIDs(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("load messages: %w", err)
+		}
+		for _, m := range loaded {
+			index[m.ID] = m
+		}
+		ids = nil
+		if depth == in.ContextMessages {
+			break
+		}
+		queued := map[uuid.UUID]bool{}
+		for _, m := range loaded {
+			if m.ParentID == nil || queued[*m.ParentID] {
+				continue
+			}
+			if _, ok := index[*m.ParentID]; !ok {
+				queued[*m.ParentID] = true
+				ids = append(ids, *m.ParentID)
+			}
+		}
+	}
+
+	for _, m := range msgs {
+		full, ok := index[m.ID]
+		if !ok {
+			// deleted since it was listed
+			continue
+		}
+		item := AnnotationBundleItem{
+			MessageID: full.ID,
+			SessionID: full.SessionID,
+			Role:      full.Role,
+			Parts:     full.Parts,
+			CreatedAt: full.CreatedAt,
+			Context:   []AnnotationContextMessage{},
+		}
+		for parent := full.ParentID; parent != nil && len(item.Context) < in.ContextMessages; {
+			pm, ok := index[*parent]
+			if !ok {
+				break
+			}
+			item.Context = append(item.Context, AnnotationContextMessage{MessageID: pm.ID, Role: pm.Role, Parts: pm.Parts})
+			parent = pm.ParentID
+		}
+		// collected from the message backwards
+		for i, j := 0, len(item.Context)-1; i < j; i, j = i+1, j-1 {
+			item.Context[i], item.Context[j] = item.Context[j], item.Context[i]
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+type ImportAnnotationsInput struct {
+	ProjectID   uuid.UUID
+	Labeler     string
+	Annotations []ImportedAnnotation
+}
+
+type ImportedAnnotation struct {
+	MessageID uuid.UUID              `json:"message_id" binding:"required"`
+	Reaction  string                 `json:"reaction,omitempty" binding:"omitempty,oneof=up down" example:"up"`
+	Label     string                 `json:"label" example:"good"`
+	Score     *float64               `json:"score,omitempty" example:"0.8"`
+	Comment   string                 `json:"comment,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+type ImportAnnotationsOutput struct {
+	Imported int         `json:"imported"`
+	NotFound []uuid.UUID `json:"not_found"`
+}
+
+// Import stores the annotations of a labeler, replacing its previous annotations of the same messages.
+// Messages that are not in the project are listed in NotFound and skipped.
+func (s *annotationService) Import(ctx context.Context, in ImportAnnotationsInput) (*ImportAnnotationsOutput, error) {
+	if in.Labeler == "" {
+		return nil, ErrAnnotationLabelerRequired
+	}
+
+	ids := make([]uuid.UUID, 0, len(in.Annotations))
+	for _, a := range in.Annotations {
+		ids = append(ids, a.MessageID)
+	}
+	sessions, err := s.r.MessageSessions(ctx, in.ProjectID, uniqueIDs(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ImportAnnotationsOutput{NotFound: []uuid.UUID{}}
+	// The last annotation of a message wins, the upsert cannot touch a row twice
+	latest := make(map[uuid.UUID]int, len(in.Annotations))
+	for i, a := range in.Annotations {
+		if _, ok := sessions[a.MessageID]; !ok {
+			out.NotFound = append(out.NotFound, a.MessageID)
+			continue
+		}
+		latest[a.MessageID] = i
+	}
+
+	rows := make([]model.MessageAnnotation, 0, len(latest))
+	for i, a := range in.Annotations {
+		if j, ok := latest[a.MessageID]; !ok || j != i {
+			continue
+		}
+		rows = append(rows, model.MessageAnnotation{
+			MessageID: a.MessageID,
+			Labeler:   in.Labeler,
+			SessionID: sessions[a.MessageID],
+			Reaction:  a.Reaction,
+			Label:     a.Label,
+			Score:     a.Score,
+			Comment:   a.Comment,
+			Data:      a.Data,
+		})
+	}
+	if err := s.r.Upsert(ctx, rows); err != nil {
+		return nil, err
+	}
+	out.Imported = len(rows)
+	return out, nil
+}
+
+type AnnotateMessageInput struct {
+	ProjectID uuid.UUID
+	SessionID uuid.UUID
+	MessageID uuid.UUID
+	Labeler   string
+	Reaction  string
+	Label     string
+	Score     *float64
+	Comment   string
+	Data      map[string]interface{}
+}
+
+// Annotate stores the feedback of a labeler on a message of a session, replacing its previous annotation of the message
+func (s *annotationService) Annotate(ctx context.Context, in AnnotateMessageInput) (*model.MessageAnnotation, error) {
+	if in.Labeler == "" {
+		return nil, ErrAnnotationLabelerRequired
+	}
+	if in.Reaction == "" && in.Label == "" && in.Score == nil && in.Comment == "" {
+		return nil, ErrAnnotationEmpty
+	}
+	if err := s.checkMessage(ctx, in.ProjectID, in.SessionID, in.MessageID); err != nil {
+		return nil, err
+	}
+
+	a := model.MessageAnnotation{
+		MessageID: in.MessageID,
+		Labeler:   in.Labeler,
+		SessionID: in.SessionID,
+		Reaction:  in.Reaction,
+		Label:     in.Label,
+		Score:     in.Score,
+		Comment:   in.Comment,
+		Data:      in.Data,
+	}
+	if err := s.r.Upsert(ctx, []model.MessageAnnotation{a}); err != nil {
+		return nil, err
+	}
+
+	// Read it back for the timestamps of an annotation that was replaced
+	all, err := s.r.ListByMessage(ctx, in.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].Labeler == in.Labeler {
+			return &all[i], nil
+		}
+	}
+	return &a, nil
+}
+
+// ListForMessage returns the annotations of a message of a session, oldest first
+func (s *annotationService) ListForMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) ([]model.MessageAnnotation, error) {
+	if err := s.checkMessage(ctx, projectID, sessionID, messageID); err != nil {
+		return nil, err
+	}
+	return s.r.ListByMessage(ctx, messageID)
+}
+
+// Remove deletes the annotation of a labeler on a message of a session
+func (s *annotationService) Remove(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, labeler string) error {
+	if err := s.checkMessage(ctx, projectID, sessionID, messageID); err != nil {
+		return err
+	}
+	deleted, err := s.r.Delete(ctx, messageID, labeler)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAnnotationNotFound
+	}
+	return nil
+}
+
+// checkMessage returns ErrMessageNotFound unless the message is in the session and the session in the project
+func (s *annotationService) checkMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) error {
+	sessions, err := s.r.MessageSessions(ctx, projectID, []uuid.UUID{messageID})
+	if err != nil {
+		return err
+	}
+	if sid, ok := sessions[messageID]; !ok || sid != sessionID {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+type fakeAnnotationRepo struct {
+	review   []model.Message
+	sessions map[uuid.UUID]uuid.UUID
+	stored   []model.MessageAnnotation
+}
+
+func (r *fakeAnnotationRepo) ListForReview(ctx context.Context, projectID uuid.UUID, f repo.ReviewFilter, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	return r.review[:min(limit, len(r.review))], nil
+}
+
+func (r *fakeAnnotationRepo) MessageSessions(ctx context.Context, projectID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	return r.sessions, nil
+}
+
+func (r *fakeAnnotationRepo) Upsert(ctx context.Context, annotations []model.MessageAnnotation) error {
+	r.stored = annotations
+	return nil
+}
+
+func (r *fakeAnnotationRepo) ListByMessage(ctx context.Context, messageID uuid.UUID) ([]model.MessageAnnotation, error) {
+	var out []model.MessageAnnotation
+	for _, a := range r.stored {
+		if a.MessageID == messageID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeAnnotationRepo) Delete(ctx context.Context, messageID uuid.UUID, labeler string) (bool, error) {
+	for i, a := range r.stored {
+		if a.MessageID == messageID && a.Labeler == labeler {
+			r.stored = append(r.stored[:i], r.stored[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAnnotationService_Export(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	var msgs []model.Message
+	add := func(role string, text string) model.Message {
+		m := model.Message{ID: uuid.New(), SessionID: sessionID, Role: role, CreatedAt: base.Add(time.Duration(len(msgs)) * time.Second),
+			InlineParts: datatypes.NewJSONSlice([]model.Part{{Type: "text", Text: text}})}
+		if len(msgs) > 0 {
+			m.ParentID = &msgs[len(msgs)-1].ID
+		}
+		msgs = append(msgs, m)
+		return m
+	}
+	add("system", "be brief")
+	add("user", "hi")
+	first := add("assistant", "hello")
+	add("user", "bye")
+	second := add("assistant", "goodbye")
+
+	// Only the annotated message and its context are read, one generation at a time
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("ListMessagesByIDs", ctx, []uuid.UUID{first.ID}).Return([]model.Message{msgs[2]}, nil).Once()
+	sessionRepo.On("ListMessagesByIDs", ctx, []uuid.UUID{msgs[1].ID}).Return([]model.Message{msgs[1]}, nil).Once()
+	sessionRepo.On("ListMessagesByIDs", ctx, []uuid.UUID{msgs[0].ID}).Return([]model.Message{msgs[0]}, nil).Once()
+	sessions := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	r := &fakeAnnotationRepo{review: []model.Message{first, second}}
+	svc := NewAnnotationService(r, sessions)
+
+	out, err := svc.Export(ctx, ExportAnnotationsInput{Filter: repo.ReviewFilter{Labeler: "team-a"}, ContextMessages: 2, Limit: 1})
+	require.NoError(t, err)
+
+	assert.True(t, out.HasMore)
+	assert.NotEmpty(t, out.NextCursor)
+	assert.Equal(t, "team-a", out.Labeler)
+	require.Len(t, out.Items, 1)
+	item := out.Items[0]
+	assert.Equal(t, first.ID, item.MessageID)
+	assert.Equal(t, "hello", item.Parts[0].Text)
+	require.Len(t, item.Context, 2)
+	assert.Equal(t, "system", item.Context[0].Role)
+	assert.Equal(t, "hi", item.Context[1].Parts[0].Text)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestAnnotationService_Import(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	known, unknown := uuid.New(), uuid.New()
+	score := 0.5
+
+	r := &fakeAnnotationRepo{sessions: map[uuid.UUID]uuid.UUID{known: sessionID}}
+	svc := NewAnnotationService(r, nil)
+
+	_, err := svc.Import(ctx, ImportAnnotationsInput{Annotations: []ImportedAnnotation{{MessageID: known}}})
+	assert.ErrorIs(t, err, ErrAnnotationLabelerRequired)
+
+	out, err := svc.Import(ctx, ImportAnnotationsInput{Labeler: "team-a", Annotations: []ImportedAnnotation{
+		{MessageID: known, Label: "bad"},
+		{MessageID: unknown, Label: "good"},
+		{MessageID: known, Label: "good", Score: &score},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, out.Imported)
+	assert.Equal(t, []uuid.UUID{unknown}, out.NotFound)
+	require.Len(t, r.stored, 1)
+	assert.Equal(t, "good", r.stored[0].Label)
+	assert.Equal(t, sessionID, r.stored[0].SessionID)
+	assert.Equal(t, "team-a", r.stored[0].Labeler)
+}
+
+func TestAnnotationService_Annotate(t *testing.T) {
+	ctx := context.Background()
+	projectID, sessionID := uuid.New(), uuid.New()
+	messageID := uuid.New()
+
+	r := &fakeAnnotationRepo{sessions: map[uuid.UUID]uuid.UUID{messageID: sessionID}}
+	svc := NewAnnotationService(r, nil)
+
+	_, err := svc.Annotate(ctx, AnnotateMessageInput{ProjectID: projectID, SessionID: sessionID, MessageID: messageID, Labeler: "alice"})
+	assert.ErrorIs(t, err, ErrAnnotationEmpty)
+
+	_, err = svc.Annotate(ctx, AnnotateMessageInput{ProjectID: projectID, SessionID: uuid.New(), MessageID: messageID, Labeler: "alice", Reaction: model.AnnotationReactionUp})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	out, err := svc.Annotate(ctx, AnnotateMessageInput{ProjectID: projectID, SessionID: sessionID, MessageID: messageID, Labeler: "alice", Reaction: model.AnnotationReactionDown, Label: "hallucination"})
+	require.NoError(t, err)
+	assert.Equal(t, model.AnnotationReactionDown, out.Reaction)
+	assert.Equal(t, sessionID, out.SessionID)
+
+	list, err := svc.ListForMessage(ctx, projectID, sessionID, messageID)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	assert.NoError(t, svc.Remove(ctx, projectID, sessionID, messageID, "alice"))
+	assert.ErrorIs(t, svc.Remove(ctx, projectID, sessionID, messageID, "alice"), ErrAnnotationNotFound)
+}
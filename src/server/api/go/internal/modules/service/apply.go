@@ -0,0 +1,521 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"gorm.io/datatypes"
+)
+
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+const (
+	// MaxManifestBytes bounds the size of a manifest posted to POST /project/apply
+	MaxManifestBytes = 4 << 20
+	// maxManifestBlocks bounds the pages and blocks created by one apply
+	maxManifestBlocks = 10000
+)
+
+const (
+	ApplyActionCreate = "create"
+	ApplyActionUpdate = "update"
+	ApplyActionDelete = "delete"
+
+	ApplyKindSpace               = "space"
+	ApplyKindPage                = "page"
+	ApplyKindTool                = "tool"
+	ApplyKindNotificationWebhook = "notification_webhook"
+)
+
+// ApplyChange is a change made, or to be made on a dry run, to reconcile a project with its manifest
+type ApplyChange struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	// Name identifies the resource: the name of a space or tool, or "<space>/<page>" for a page
+	Name string `json:"name"`
+	// Fields are the fields changed by an update
+	Fields []string `json:"fields,omitempty"`
+}
+
+type ApplyManifestInput struct {
+	Project  *model.Project
+	Manifest *model.ProjectManifest
+	// Prune deletes the spaces, pages and tools missing from the lists of the manifest
+	Prune  bool
+	DryRun bool
+}
+
+type ApplyManifestOutput struct {
+	DryRun  bool          `json:"dry_run"`
+	Changes []ApplyChange `json:"changes"`
+}
+
+type ApplyService interface {
+	Apply(ctx context.Context, in ApplyManifestInput) (*ApplyManifestOutput, error)
+}
+
+type applyService struct {
+	r         repo.ApplyRepo
+	publisher *mq.Publisher
+	cfg       *config.Config
+	log       *zap.Logger
+	// limits bounds the children of the pages written, nil disables it
+	limits EntityLimitService
+}
+
+func NewApplyService(r repo.ApplyRepo, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger, limits EntityLimitService) ApplyService {
+	return &applyService{r: r, publisher: publisher, cfg: cfg, log: log, limits: limits}
+}
+
+// ParseProjectManifest decodes a manifest written in YAML or JSON, unknown fields are refused
+func ParseProjectManifest(raw []byte) (*model.ProjectManifest, error) {
+	var doc any
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: manifest is empty", ErrInvalidManifest)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	m := &model.ProjectManifest{}
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	return m, nil
+}
+
+// Apply reconciles the spaces, pages, tools and notification webhook of the project with the manifest. Resources
+// are matched by name, spaces and tools within the project and pages at the root of their space by title. The
+// changes are listed in the order they were planned and written in one transaction, unless the input is a dry run.
+// A page with more blocks than the hard children limit is refused with a *LimitExceededError, dry runs included.
+func (s *applyService) Apply(ctx context.Context, in ApplyManifestInput) (*ApplyManifestOutput, error) {
+	if in.Project == nil {
+		return nil, errors.New("project is empty")
+	}
+	if in.Manifest == nil {
+		return nil, fmt.Errorf("%w: manifest is empty", ErrInvalidManifest)
+	}
+
+	state, err := s.r.LoadState(ctx, in.Project.ID)
+	if err != nil {
+		return nil, err
+	}
+	p := &applyPlanner{project: in.Project, state: state, prune: in.Prune, plan: &repo.ApplyPlan{}}
+	if err := p.planSpaces(in.Manifest.Spaces); err != nil {
+		return nil, err
+	}
+	if err := p.planTools(in.Manifest.Tools); err != nil {
+		return nil, err
+	}
+	if err := p.planWebhook(in.Manifest.NotificationWebhook); err != nil {
+		return nil, err
+	}
+	// The blocks of a page are all created by the plan, those it replaces are deleted first
+	if err := checkBlockWrite(ctx, s.limits, nil, p.plan.CreateBlocks); err != nil {
+		return nil, err
+	}
+
+	out := &ApplyManifestOutput{DryRun: in.DryRun, Changes: p.changes}
+	if out.Changes == nil {
+		out.Changes = []ApplyChange{}
+	}
+	if in.DryRun || len(p.changes) == 0 {
+		return out, nil
+	}
+	if err := s.r.Apply(ctx, in.Project.ID, p.plan); err != nil {
+		return nil, err
+	}
+	if p.plan.Configs != nil {
+		in.Project.Configs = p.plan.Configs
+	}
+
+	// The created blocks and the pages with new props are (re-)embedded
+	written := map[uuid.UUID][]uuid.UUID{}
+	for _, blocks := range [][]model.Block{p.plan.CreateBlocks, p.plan.UpdatePages} {
+		for _, b := range blocks {
+			written[b.SpaceID] = append(written[b.SpaceID], b.ID)
+		}
+	}
+	for spaceID, blockIDs := range written {
+		publishBlockEmbeddings(ctx, s.publisher, s.cfg, s.log, spaceID, blockIDs)
+	}
+	return out, nil
+}
+
+type applyPlanner struct {
+	project *model.Project
+	state   *repo.ApplyState
+	prune   bool
+
+	plan    *repo.ApplyPlan
+	changes []ApplyChange
+	blocks  int
+}
+
+func (p *applyPlanner) change(action, kind, name string, fields ...string) {
+	p.changes = append(p.changes, ApplyChange{Action: action, Kind: kind, Name: name, Fields: fields})
+}
+
+func (p *applyPlanner) planSpaces(spaces *[]model.SpaceManifest) error {
+	if spaces == nil {
+		return nil
+	}
+
+	existing := map[string][]*model.Space{}
+	for i := range p.state.Spaces {
+		sp := &p.state.Spaces[i]
+		existing[sp.Name] = append(existing[sp.Name], sp)
+	}
+	pages := map[uuid.UUID][]*model.Block{}
+	for i := range p.state.Pages {
+		pg := &p.state.Pages[i]
+		pages[pg.SpaceID] = append(pages[pg.SpaceID], pg)
+	}
+
+	seen := map[string]bool{}
+	for _, sm := range *spaces {
+		name := strings.TrimSpace(sm.Name)
+		if name == "" {
+			return fmt.Errorf("%w: space name is required", ErrInvalidManifest)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: space '%s' is declared twice", ErrInvalidManifest, name)
+		}
+		seen[name] = true
+		tags := normalizeTags(sm.Tags)
+
+		matches := existing[name]
+		if len(matches) > 1 {
+			return fmt.Errorf("%w: %d spaces of the project are named '%s'", ErrInvalidManifest, len(matches), name)
+		}
+		if len(matches) == 0 {
+			sp := model.Space{
+				ID:          uuid.New(),
+				ProjectID:   p.project.ID,
+				Name:        name,
+				Description: sm.Description,
+				Tags:        datatypes.JSONSlice[string](tags),
+			}
+			p.plan.CreateSpaces = append(p.plan.CreateSpaces, sp)
+			p.change(ApplyActionCreate, ApplyKindSpace, name)
+			if err := p.planPages(sp.ID, name, sm.Pages, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sp := *matches[0]
+		var fields []string
+		if sp.Description != sm.Description {
+			sp.Description = sm.Description
+			fields = append(fields, "description")
+		}
+		if !equalStrings(sp.Tags, tags) {
+			sp.Tags = datatypes.JSONSlice[string](tags)
+			fields = append(fields, "tags")
+		}
+		if len(fields) > 0 {
+			p.plan.UpdateSpaces = append(p.plan.UpdateSpaces, sp)
+			p.change(ApplyActionUpdate, ApplyKindSpace, name, fields...)
+		}
+		if err := p.planPages(sp.ID, name, sm.Pages, pages[sp.ID]); err != nil {
+			return err
+		}
+	}
+
+	if p.prune {
+		for i := range p.state.Spaces {
+			sp := &p.state.Spaces[i]
+			if !seen[sp.Name] {
+				p.plan.DeleteSpaceIDs = append(p.plan.DeleteSpaceIDs, sp.ID)
+				p.change(ApplyActionDelete, ApplyKindSpace, sp.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// planPages plans the pages at the root of a space, existing are the current pages of the space
+func (p *applyPlanner) planPages(spaceID uuid.UUID, spaceName string, pages *[]model.PageManifest, existing []*model.Block) error {
+	if pages == nil {
+		return nil
+	}
+
+	byTitle := map[string][]*model.Block{}
+	for _, pg := range existing {
+		byTitle[pg.Title] = append(byTitle[pg.Title], pg)
+	}
+
+	seen := map[string]bool{}
+	for _, pm := range *pages {
+		title := strings.TrimSpace(pm.Title)
+		name := spaceName + "/" + title
+		switch {
+		case title == "":
+			return fmt.Errorf("%w: page title is required in space '%s'", ErrInvalidManifest, spaceName)
+		case strings.Contains(title, "/"):
+			return fmt.Errorf("%w: page title '%s' must not contain '/'", ErrInvalidManifest, title)
+		case seen[title]:
+			return fmt.Errorf("%w: page '%s' is declared twice", ErrInvalidManifest, name)
+		}
+		seen[title] = true
+
+		matches := byTitle[title]
+		if len(matches) > 1 {
+			return fmt.Errorf("%w: %d pages of space '%s' are titled '%s'", ErrInvalidManifest, len(matches), spaceName, title)
+		}
+		if len(matches) == 0 {
+			page := model.Block{
+				ID:      uuid.New(),
+				SpaceID: spaceID,
+				Type:    model.BlockTypePage,
+				Title:   title,
+				Props:   datatypes.NewJSONType(propsOrEmpty(pm.Props)),
+				Slug:    pageSlug(title),
+				Sort:    p.state.NextRootSort[spaceID],
+			}
+			p.state.NextRootSort[spaceID]++
+			if err := p.addBlock(page, nil, name); err != nil {
+				return err
+			}
+			if pm.Blocks != nil {
+				if err := p.addPageBlocks(&page, *pm.Blocks, name); err != nil {
+					return err
+				}
+			}
+			p.change(ApplyActionCreate, ApplyKindPage, name)
+			continue
+		}
+
+		page := *matches[0]
+		var fields []string
+		if !equalProps(page.Props.Data(), pm.Props) {
+			page.Props = datatypes.NewJSONType(propsOrEmpty(pm.Props))
+			p.plan.UpdatePages = append(p.plan.UpdatePages, page)
+			fields = append(fields, "props")
+		}
+		if pm.Blocks != nil && !equalPageBlocks(page.Children, *pm.Blocks) {
+			for _, child := range page.Children {
+				p.plan.DeleteBlockIDs = append(p.plan.DeleteBlockIDs, child.ID)
+			}
+			if err := p.addPageBlocks(&page, *pm.Blocks, name); err != nil {
+				return err
+			}
+			fields = append(fields, "blocks")
+		}
+		if len(fields) > 0 {
+			p.change(ApplyActionUpdate, ApplyKindPage, name, fields...)
+		}
+	}
+
+	if p.prune {
+		for _, pg := range existing {
+			if !seen[pg.Title] {
+				p.plan.DeleteBlockIDs = append(p.plan.DeleteBlockIDs, pg.ID)
+				p.change(ApplyActionDelete, ApplyKindPage, spaceName+"/"+pg.Title)
+			}
+		}
+	}
+	return nil
+}
+
+// addPageBlocks plans the creation of the blocks of a page, in the order of the manifest
+func (p *applyPlanner) addPageBlocks(page *model.Block, blocks []model.BlockManifest, name string) error {
+	for i, bm := range blocks {
+		b := model.Block{
+			ID:       uuid.New(),
+			SpaceID:  page.SpaceID,
+			Type:     bm.Type,
+			ParentID: &page.ID,
+			Title:    bm.Title,
+			Props:    datatypes.NewJSONType(propsOrEmpty(bm.Props)),
+			Sort:     int64(i),
+		}
+		if err := p.addBlock(b, page, fmt.Sprintf("%s block %d", name, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *applyPlanner) addBlock(b model.Block, parent *model.Block, name string) error {
+	if p.blocks++; p.blocks > maxManifestBlocks {
+		return fmt.Errorf("%w: a manifest may create at most %d pages and blocks", ErrInvalidManifest, maxManifestBlocks)
+	}
+	if err := ValidateBlockProps(&b); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidManifest, name, err)
+	}
+	if err := b.Validate(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidManifest, name, err)
+	}
+	if err := b.ValidateParentType(parent); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidManifest, name, err)
+	}
+	p.plan.CreateBlocks = append(p.plan.CreateBlocks, b)
+	return nil
+}
+
+func (p *applyPlanner) planTools(tools *[]model.ToolManifest) error {
+	if tools == nil {
+		return nil
+	}
+
+	existing := map[string]*model.ToolReference{}
+	for i := range p.state.Tools {
+		t := &p.state.Tools[i]
+		existing[t.Name] = t
+	}
+
+	seen := map[string]bool{}
+	for _, tm := range *tools {
+		name := strings.TrimSpace(tm.Name)
+		if name == "" {
+			return fmt.Errorf("%w: tool name is required", ErrInvalidManifest)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: tool '%s' is declared twice", ErrInvalidManifest, name)
+		}
+		seen[name] = true
+
+		var description *string
+		if tm.Description != "" {
+			description = &tm.Description
+		}
+
+		cur, ok := existing[name]
+		if !ok {
+			p.plan.CreateTools = append(p.plan.CreateTools, model.ToolReference{
+				ProjectID:       p.project.ID,
+				Name:            name,
+				Description:     description,
+				ArgumentsSchema: datatypes.JSONMap(tm.ArgumentsSchema),
+			})
+			p.change(ApplyActionCreate, ApplyKindTool, name)
+			continue
+		}
+
+		t := *cur
+		var fields []string
+		if stringValue(t.Description) != tm.Description {
+			t.Description = description
+			fields = append(fields, "description")
+		}
+		if !equalProps(t.ArgumentsSchema, tm.ArgumentsSchema) {
+			t.ArgumentsSchema = datatypes.JSONMap(tm.ArgumentsSchema)
+			fields = append(fields, "arguments_schema")
+		}
+		if len(fields) > 0 {
+			p.plan.UpdateTools = append(p.plan.UpdateTools, t)
+			p.change(ApplyActionUpdate, ApplyKindTool, t.Name, fields...)
+		}
+	}
+
+	if p.prune {
+		for i := range p.state.Tools {
+			t := &p.state.Tools[i]
+			if !seen[t.Name] {
+				p.plan.DeleteToolIDs = append(p.plan.DeleteToolIDs, t.ID)
+				p.change(ApplyActionDelete, ApplyKindTool, t.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *applyPlanner) planWebhook(webhook *string) error {
+	if webhook == nil {
+		return nil
+	}
+	want := strings.TrimSpace(*webhook)
+	if want != "" && !validNotificationWebhook(want) {
+		return fmt.Errorf("%w: %v", ErrInvalidManifest, ErrInvalidNotificationWebhook)
+	}
+
+	cur := p.project.NotificationWebhook()
+	if cur == want {
+		return nil
+	}
+	configs := datatypes.JSONMap{}
+	for k, v := range p.project.Configs {
+		configs[k] = v
+	}
+	switch {
+	case want == "":
+		delete(configs, model.ProjectNotificationWebhookConfigKey)
+		p.change(ApplyActionDelete, ApplyKindNotificationWebhook, cur)
+	case cur == "":
+		configs[model.ProjectNotificationWebhookConfigKey] = want
+		p.change(ApplyActionCreate, ApplyKindNotificationWebhook, want)
+	default:
+		configs[model.ProjectNotificationWebhookConfigKey] = want
+		p.change(ApplyActionUpdate, ApplyKindNotificationWebhook, want)
+	}
+	p.plan.Configs = configs
+	return nil
+}
+
+// equalPageBlocks reports whether the current blocks of a page are the blocks of the manifest, in order
+func equalPageBlocks(children []*model.Block, blocks []model.BlockManifest) bool {
+	if len(children) != len(blocks) {
+		return false
+	}
+	for i, c := range children {
+		bm := blocks[i]
+		if c.IsArchived || c.Type != bm.Type || c.Title != bm.Title || !equalProps(c.Props.Data(), bm.Props) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalProps compares JSON objects, nil and empty objects are equal
+func equalProps[A, B ~map[string]any](a A, b B) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(map[string]any(a), map[string]any(b))
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func propsOrEmpty(props map[string]any) map[string]any {
+	if props == nil {
+		return map[string]any{}
+	}
+	return props
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
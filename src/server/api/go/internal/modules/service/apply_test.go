@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+type fakeApplyRepo struct {
+	state   *repo.ApplyState
+	applied *repo.ApplyPlan
+}
+
+func (r *fakeApplyRepo) LoadState(ctx context.Context, projectID uuid.UUID) (*repo.ApplyState, error) {
+	return r.state, nil
+}
+
+func (r *fakeApplyRepo) Apply(ctx context.Context, projectID uuid.UUID, plan *repo.ApplyPlan) error {
+	r.applied = plan
+	return nil
+}
+
+func TestParseProjectManifest(t *testing.T) {
+	m, err := ParseProjectManifest([]byte(`
+spaces:
+  - name: docs
+    tags: [a, b]
+    pages:
+      - title: Intro
+        blocks:
+          - type: code
+            props: {language: go, code: "package main"}
+tools:
+  - name: search
+    arguments_schema: {type: object}
+notification_webhook: https://example.com/hook
+`))
+	require.NoError(t, err)
+	require.NotNil(t, m.Spaces)
+	require.Len(t, *m.Spaces, 1)
+	pages := *(*m.Spaces)[0].Pages
+	assert.Equal(t, "Intro", pages[0].Title)
+	assert.Equal(t, "go", (*pages[0].Blocks)[0].Props["language"])
+	assert.Equal(t, "search", (*m.Tools)[0].Name)
+	assert.Equal(t, "https://example.com/hook", *m.NotificationWebhook)
+
+	m, err = ParseProjectManifest([]byte(`{"tools": []}`))
+	require.NoError(t, err)
+	assert.Nil(t, m.Spaces)
+	assert.Empty(t, *m.Tools)
+
+	for _, raw := range []string{"", "spaces: [", "unknown: 1", "spaces:\n  - name: a\n    color: red"} {
+		_, err := ParseProjectManifest([]byte(raw))
+		assert.ErrorIs(t, err, ErrInvalidManifest, raw)
+	}
+}
+
+func TestApplyService_Apply(t *testing.T) {
+	ctx := context.Background()
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+	docs := model.Space{ID: uuid.New(), ProjectID: project.ID, Name: "docs", Tags: datatypes.JSONSlice[string]{"a"}}
+	old := model.Space{ID: uuid.New(), ProjectID: project.ID, Name: "old"}
+	intro := model.Block{ID: uuid.New(), SpaceID: docs.ID, Type: model.BlockTypePage, Title: "Intro", Props: datatypes.NewJSONType(map[string]any{})}
+	intro.Children = []*model.Block{{
+		ID: uuid.New(), SpaceID: docs.ID, Type: model.BlockTypeText, ParentID: &intro.ID, Title: "hello",
+		Props: datatypes.NewJSONType(map[string]any{}),
+	}}
+	stale := model.Block{ID: uuid.New(), SpaceID: docs.ID, Type: model.BlockTypePage, Title: "Stale", Sort: 1, Props: datatypes.NewJSONType(map[string]any{})}
+	description := "search the docs"
+	tool := model.ToolReference{ID: uuid.New(), ProjectID: project.ID, Name: "search", Description: &description}
+	newState := func() *repo.ApplyState {
+		return &repo.ApplyState{
+			Spaces:       []model.Space{docs, old},
+			Pages:        []model.Block{intro, stale},
+			NextRootSort: map[uuid.UUID]int64{docs.ID: 2},
+			Tools:        []model.ToolReference{tool},
+		}
+	}
+
+	manifest, err := ParseProjectManifest([]byte(`
+spaces:
+  - name: docs
+    tags: [a, b]
+    pages:
+      - title: Intro
+        blocks:
+          - type: text
+            title: hello
+      - title: Setup
+        blocks:
+          - type: code
+            props: {language: sh, code: make}
+  - name: notes
+tools:
+  - name: search
+    description: search the docs
+notification_webhook: https://example.com/hook
+`))
+	require.NoError(t, err)
+
+	r := &fakeApplyRepo{state: newState()}
+	svc := NewApplyService(r, nil, nil, nil, nil)
+	out, err := svc.Apply(ctx, ApplyManifestInput{Project: project, Manifest: manifest, DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, out.DryRun)
+	assert.Nil(t, r.applied)
+	assert.Equal(t, []ApplyChange{
+		{Action: ApplyActionUpdate, Kind: ApplyKindSpace, Name: "docs", Fields: []string{"tags"}},
+		{Action: ApplyActionCreate, Kind: ApplyKindPage, Name: "docs/Setup"},
+		{Action: ApplyActionCreate, Kind: ApplyKindSpace, Name: "notes"},
+		{Action: ApplyActionCreate, Kind: ApplyKindNotificationWebhook, Name: "https://example.com/hook"},
+	}, out.Changes)
+	assert.Empty(t, project.NotificationWebhook())
+
+	r.state = newState()
+	out, err = svc.Apply(ctx, ApplyManifestInput{Project: project, Manifest: manifest, Prune: true})
+	require.NoError(t, err)
+	require.NotNil(t, r.applied)
+	assert.Len(t, out.Changes, 6)
+	assert.Equal(t, []uuid.UUID{old.ID}, r.applied.DeleteSpaceIDs)
+	assert.Equal(t, []uuid.UUID{stale.ID}, r.applied.DeleteBlockIDs)
+	require.Len(t, r.applied.CreateBlocks, 2)
+	setup, code := r.applied.CreateBlocks[0], r.applied.CreateBlocks[1]
+	assert.Equal(t, int64(2), setup.Sort)
+	if assert.NotNil(t, setup.Slug) {
+		assert.Equal(t, "setup", *setup.Slug)
+	}
+	assert.Equal(t, &setup.ID, code.ParentID)
+	assert.Nil(t, code.Slug)
+	assert.Equal(t, "https://example.com/hook", project.NotificationWebhook())
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	// the blocks of a page are replaced when they differ
+	manifest, err = ParseProjectManifest([]byte(`
+spaces:
+  - name: docs
+    tags: [a]
+    pages:
+      - title: Intro
+        blocks:
+          - type: markdown
+            props: {content: "# hi"}
+tools: []
+`))
+	require.NoError(t, err)
+	r.state = newState()
+	out, err = svc.Apply(ctx, ApplyManifestInput{Project: project, Manifest: manifest, Prune: true})
+	require.NoError(t, err)
+	assert.Equal(t, []ApplyChange{
+		{Action: ApplyActionUpdate, Kind: ApplyKindPage, Name: "docs/Intro", Fields: []string{"blocks"}},
+		{Action: ApplyActionDelete, Kind: ApplyKindPage, Name: "docs/Stale"},
+		{Action: ApplyActionDelete, Kind: ApplyKindSpace, Name: "old"},
+		{Action: ApplyActionDelete, Kind: ApplyKindTool, Name: "search"},
+	}, out.Changes)
+	assert.Equal(t, []uuid.UUID{intro.Children[0].ID, stale.ID}, r.applied.DeleteBlockIDs)
+	require.Len(t, r.applied.CreateBlocks, 1)
+	assert.Equal(t, &intro.ID, r.applied.CreateBlocks[0].ParentID)
+
+	// an unchanged project is not written
+	manifest, err = ParseProjectManifest([]byte(`{"spaces": [{"name": "docs", "tags": ["a"]}], "notification_webhook": "https://example.com/hook"}`))
+	require.NoError(t, err)
+	r.state, r.applied = newState(), nil
+	out, err = svc.Apply(ctx, ApplyManifestInput{Project: project, Manifest: manifest})
+	require.NoError(t, err)
+	assert.Empty(t, out.Changes)
+	assert.Nil(t, r.applied)
+}
+
+func TestApplyService_InvalidManifest(t *testing.T) {
+	ctx := context.Background()
+	project := &model.Project{ID: uuid.New()}
+	svc := NewApplyService(&fakeApplyRepo{state: &repo.ApplyState{NextRootSort: map[uuid.UUID]int64{}}}, nil, nil, nil, nil)
+
+	for _, raw := range []string{
+		`{"spaces": [{"name": " "}]}`,
+		`{"spaces": [{"name": "a"}, {"name": "a"}]}`,
+		`{"spaces": [{"name": "a", "pages": [{"title": "x/y"}]}]}`,
+		`{"spaces": [{"name": "a", "pages": [{"title": "x", "blocks": [{"type": "folder"}]}]}]}`,
+		`{"spaces": [{"name": "a", "pages": [{"title": "x", "blocks": [{"type": "code", "props": {}}]}]}]}`,
+		`{"tools": [{"name": "t"}, {"name": "t"}]}`,
+		`{"notification_webhook": "ftp://example.com"}`,
+	} {
+		manifest, err := ParseProjectManifest([]byte(raw))
+		require.NoError(t, err, raw)
+		_, err = svc.Apply(ctx, ApplyManifestInput{Project: project, Manifest: manifest, DryRun: true})
+		assert.ErrorIs(t, err, ErrInvalidManifest, raw)
+	}
+}
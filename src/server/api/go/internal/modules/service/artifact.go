@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +14,8 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/fileparser"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/mimesniff"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tabular"
 	"gorm.io/datatypes"
 )
 
@@ -24,15 +28,47 @@ type ArtifactService interface {
 	UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error)
 	ListByPath(ctx context.Context, diskID uuid.UUID, path string) ([]*model.Artifact, error)
 	GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error)
+	ListTrash(ctx context.Context, diskID uuid.UUID) ([]TrashedArtifact, error)
+	Restore(ctx context.Context, diskID uuid.UUID, artifactID uuid.UUID) (*model.Artifact, error)
+	PurgeTrash(ctx context.Context, trashedBefore time.Time) (int, error)
+	AcquireLease(ctx context.Context, in AcquireArtifactLeaseInput) (*model.ArtifactLease, error)
+	ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) error
+	Query(ctx context.Context, artifact *model.Artifact, q tabular.Query) (*tabular.Result, error)
+	MoveDir(ctx context.Context, in MoveArtifactDirInput) (*ArtifactDirResult, error)
+	DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, leaseHolder string) (*ArtifactDirResult, error)
+	PresignUpload(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadTicket, error)
+	FinalizeUpload(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error)
+	CheckUploads(ctx context.Context) (int, error)
+	PurgeExpiredUploads(ctx context.Context, expiredBefore time.Time) (int, error)
+	StartUploadSession(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadSession, error)
+	GetUploadSession(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) (*ArtifactUploadSession, error)
+	UploadPart(ctx context.Context, in UploadArtifactPartInput) (*model.ArtifactUploadPart, error)
+	CompleteUploadSession(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error)
+	AbortUpload(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) error
 }
 
+var (
+	ErrTrashedArtifactNotFound = errors.New("trashed artifact not found")
+	ErrArtifactPathTaken       = errors.New("an artifact already exists at this path")
+	ErrArtifactLeased          = errors.New("artifact path is locked by another holder")
+	ErrArtifactLeaseNotHeld    = errors.New("no lease held on this artifact path")
+	ErrUnsupportedQueryFormat  = errors.New("artifact format cannot be queried, only CSV and JSONL are supported")
+	ErrArtifactDirNotFound     = errors.New("directory not found")
+	ErrInvalidArtifactDir      = errors.New("invalid directory")
+)
+
+// purgeTrashBatchSize bounds the artifacts purged per repository call
+const purgeTrashBatchSize = 100
+
 type artifactService struct {
 	r  repo.ArtifactRepo
 	s3 *blob.S3Deps
+	// quota checks the declared size of direct uploads, nil skips the check
+	quota QuotaService
 }
 
-func NewArtifactService(r repo.ArtifactRepo, s3 *blob.S3Deps) ArtifactService {
-	return &artifactService{r: r, s3: s3}
+func NewArtifactService(r repo.ArtifactRepo, s3 *blob.S3Deps, quota QuotaService) ArtifactService {
+	return &artifactService{r: r, s3: s3, quota: quota}
 }
 
 type CreateArtifactInput struct {
@@ -42,9 +78,19 @@ type CreateArtifactInput struct {
 	Filename   string
 	FileHeader *multipart.FileHeader
 	UserMeta   map[string]interface{}
+	// LeaseHolder identifies the writer, the write is rejected if another holder leases the path
+	LeaseHolder string
 }
 
 func (s *artifactService) Create(ctx context.Context, in CreateArtifactInput) (*model.Artifact, error) {
+	lease, err := s.r.GetActiveLease(ctx, in.DiskID, in.Path, in.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("check artifact lease: %w", err)
+	}
+	if lease != nil && lease.Holder != in.LeaseHolder {
+		return nil, ErrArtifactLeased
+	}
+
 	// Check if artifact with same path and filename already exists in the same disk
 	exists, err := s.r.ExistsByPathAndFilename(ctx, in.DiskID, in.Path, in.Filename, nil)
 	if err != nil {
@@ -126,8 +172,11 @@ func (s *artifactService) GetFileContent(ctx context.Context, artifact *model.Ar
 		return nil, errors.New("artifact has no S3 key")
 	}
 
-	// Check if file type is parsable before downloading
+	// Check if file type is parsable before downloading, the filename is not trusted over binary content
 	parser := fileparser.NewFileParser()
+	if assetData.DetectedMIME != "" && !mimesniff.IsText(assetData.DetectedMIME) {
+		return nil, fmt.Errorf("unsupported file type: %s (detected mime: %s)", artifact.Filename, assetData.DetectedMIME)
+	}
 	if !parser.CanParseFile(artifact.Filename, assetData.MIME) {
 		return nil, fmt.Errorf("unsupported file type: %s (mime: %s)", artifact.Filename, assetData.MIME)
 	}
@@ -192,3 +241,221 @@ func (s *artifactService) ListByPath(ctx context.Context, diskID uuid.UUID, path
 func (s *artifactService) GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error) {
 	return s.r.GetAllPaths(ctx, diskID)
 }
+
+// TrashedArtifact is a deleted artifact that can still be restored, its id is needed to restore it
+type TrashedArtifact struct {
+	ID        uuid.UUID              `json:"id"`
+	DiskID    uuid.UUID              `json:"disk_id"`
+	Path      string                 `json:"path"`
+	Filename  string                 `json:"filename"`
+	Meta      map[string]interface{} `json:"meta"`
+	TrashedAt time.Time              `json:"trashed_at"`
+}
+
+func (s *artifactService) ListTrash(ctx context.Context, diskID uuid.UUID) ([]TrashedArtifact, error) {
+	artifacts, err := s.r.ListTrash(ctx, diskID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TrashedArtifact, 0, len(artifacts))
+	for _, a := range artifacts {
+		out = append(out, TrashedArtifact{
+			ID:        a.ID,
+			DiskID:    a.DiskID,
+			Path:      a.Path,
+			Filename:  a.Filename,
+			Meta:      a.Meta,
+			TrashedAt: a.TrashedAt.Time,
+		})
+	}
+	return out, nil
+}
+
+// Restore moves a trashed artifact back to its path, which must not hold another artifact meanwhile
+func (s *artifactService) Restore(ctx context.Context, diskID uuid.UUID, artifactID uuid.UUID) (*model.Artifact, error) {
+	artifact, err := s.r.GetTrashed(ctx, diskID, artifactID)
+	if err != nil {
+		return nil, err
+	}
+	if artifact == nil {
+		return nil, ErrTrashedArtifactNotFound
+	}
+
+	exists, err := s.r.ExistsByPathAndFilename(ctx, diskID, artifact.Path, artifact.Filename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("check artifact existence: %w", err)
+	}
+	if exists {
+		return nil, ErrArtifactPathTaken
+	}
+
+	if err := s.r.Restore(ctx, artifact); err != nil {
+		return nil, fmt.Errorf("restore artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// PurgeTrash permanently deletes the artifacts trashed before trashedBefore, it returns how many were purged
+func (s *artifactService) PurgeTrash(ctx context.Context, trashedBefore time.Time) (int, error) {
+	total := 0
+	for {
+		purged, err := s.r.PurgeTrashed(ctx, trashedBefore, purgeTrashBatchSize)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+		if purged < purgeTrashBatchSize {
+			return total, nil
+		}
+	}
+}
+
+type AcquireArtifactLeaseInput struct {
+	DiskID   uuid.UUID
+	Path     string
+	Filename string
+	Holder   string
+	TTL      time.Duration
+}
+
+// AcquireLease locks a path for a holder until the TTL elapses, acquiring it again extends the lease
+func (s *artifactService) AcquireLease(ctx context.Context, in AcquireArtifactLeaseInput) (*model.ArtifactLease, error) {
+	if in.Path == "" || in.Filename == "" {
+		return nil, errors.New("path and filename are required")
+	}
+	if in.Holder == "" {
+		return nil, errors.New("holder is required")
+	}
+
+	lease := &model.ArtifactLease{
+		DiskID:    in.DiskID,
+		Path:      in.Path,
+		Filename:  in.Filename,
+		Holder:    in.Holder,
+		ExpiresAt: time.Now().Add(in.TTL),
+	}
+	acquired, err := s.r.AcquireLease(ctx, lease)
+	if err != nil {
+		return nil, fmt.Errorf("acquire artifact lease: %w", err)
+	}
+	if !acquired {
+		return nil, ErrArtifactLeased
+	}
+	return lease, nil
+}
+
+func (s *artifactService) ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) error {
+	released, err := s.r.ReleaseLease(ctx, diskID, path, filename, holder)
+	if err != nil {
+		return fmt.Errorf("release artifact lease: %w", err)
+	}
+	if !released {
+		return ErrArtifactLeaseNotHeld
+	}
+	return nil
+}
+
+// ArtifactDirResult is the outcome of a directory operation
+type ArtifactDirResult struct {
+	Path      string `json:"path"`
+	Artifacts int64  `json:"artifacts"`
+}
+
+type MoveArtifactDirInput struct {
+	DiskID uuid.UUID
+	// From and To are directory paths, starting and ending with '/'
+	From string
+	To   string
+	// LeaseHolder identifies the writer, the move is rejected if another holder leases a path under From or To
+	LeaseHolder string
+}
+
+// MoveDir renames or moves a directory with everything under it. Directories only exist through their artifacts, so
+// a directory without any is not found.
+func (s *artifactService) MoveDir(ctx context.Context, in MoveArtifactDirInput) (*ArtifactDirResult, error) {
+	if in.From == "/" {
+		return nil, fmt.Errorf("%w: the root cannot be moved", ErrInvalidArtifactDir)
+	}
+	if strings.HasPrefix(in.To, in.From) {
+		return nil, fmt.Errorf("%w: %s cannot be moved into itself", ErrInvalidArtifactDir, in.From)
+	}
+	moved, err := s.r.MoveDir(ctx, in.DiskID, in.From, in.To, in.LeaseHolder)
+	if err != nil {
+		if errors.Is(err, repo.ErrArtifactDirConflict) {
+			return nil, ErrArtifactPathTaken
+		}
+		var leased *repo.ArtifactDirLeasedError
+		if errors.As(err, &leased) {
+			return nil, fmt.Errorf("%w: %s", ErrArtifactLeased, leased.Path)
+		}
+		return nil, fmt.Errorf("move directory: %w", err)
+	}
+	if moved == 0 {
+		return nil, ErrArtifactDirNotFound
+	}
+	return &ArtifactDirResult{Path: in.To, Artifacts: moved}, nil
+}
+
+// DeleteDir moves a directory with everything under it to the trash, its artifacts are restored one by one
+func (s *artifactService) DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, leaseHolder string) (*ArtifactDirResult, error) {
+	if dir == "/" {
+		return nil, fmt.Errorf("%w: the root cannot be deleted", ErrInvalidArtifactDir)
+	}
+	trashed, err := s.r.DeleteDir(ctx, diskID, dir, leaseHolder)
+	if err != nil {
+		var leased *repo.ArtifactDirLeasedError
+		if errors.As(err, &leased) {
+			return nil, fmt.Errorf("%w: %s", ErrArtifactLeased, leased.Path)
+		}
+		return nil, fmt.Errorf("delete directory: %w", err)
+	}
+	if trashed == 0 {
+		return nil, ErrArtifactDirNotFound
+	}
+	return &ArtifactDirResult{Path: dir, Artifacts: trashed}, nil
+}
+
+// queryFormat picks the tabular format of an artifact from its filename, falling back to the declared MIME type
+func queryFormat(artifact *model.Artifact) (tabular.Format, bool) {
+	switch strings.ToLower(filepath.Ext(artifact.Filename)) {
+	case ".csv":
+		return tabular.FormatCSV, true
+	case ".jsonl", ".ndjson":
+		return tabular.FormatJSONL, true
+	}
+	switch mimesniff.BaseType(artifact.AssetMeta.Data().MIME) {
+	case "text/csv", "application/csv":
+		return tabular.FormatCSV, true
+	case "application/jsonl", "application/x-ndjson":
+		return tabular.FormatJSONL, true
+	}
+	return "", false
+}
+
+// Query filters, projects and aggregates a CSV or JSONL artifact while streaming it from S3
+func (s *artifactService) Query(ctx context.Context, artifact *model.Artifact, q tabular.Query) (*tabular.Result, error) {
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+
+	format, ok := queryFormat(artifact)
+	if !ok {
+		return nil, ErrUnsupportedQueryFormat
+	}
+	assetData := artifact.AssetMeta.Data()
+	if assetData.DetectedMIME != "" && !mimesniff.IsText(assetData.DetectedMIME) {
+		return nil, ErrUnsupportedQueryFormat
+	}
+	if assetData.S3Key == "" {
+		return nil, errors.New("artifact has no S3 key")
+	}
+
+	body, err := s.s3.OpenFile(ctx, assetData.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("open artifact: %w", err)
+	}
+	defer body.Close()
+
+	return tabular.Run(ctx, body, format, q, tabular.DefaultLimits)
+}
@@ -9,7 +9,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/fileparser"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tabular"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/datatypes"
@@ -64,6 +66,124 @@ func (m *MockArtifactRepo) ExistsByPathAndFilename(ctx context.Context, diskID u
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockArtifactRepo) ListTrash(ctx context.Context, diskID uuid.UUID) ([]*model.Artifact, error) {
+	args := m.Called(ctx, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactRepo) GetTrashed(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactRepo) Restore(ctx context.Context, a *model.Artifact) error {
+	args := m.Called(ctx, a)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) PurgeTrashed(ctx context.Context, trashedBefore time.Time, limit int) (int, error) {
+	args := m.Called(ctx, trashedBefore, limit)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockArtifactRepo) AcquireLease(ctx context.Context, l *model.ArtifactLease) (bool, error) {
+	args := m.Called(ctx, l)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockArtifactRepo) ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) (bool, error) {
+	args := m.Called(ctx, diskID, path, filename, holder)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockArtifactRepo) GetActiveLease(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.ArtifactLease, error) {
+	args := m.Called(ctx, diskID, path, filename)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactLease), args.Error(1)
+}
+
+func (m *MockArtifactRepo) MoveDir(ctx context.Context, diskID uuid.UUID, from string, to string, holder string) (int64, error) {
+	args := m.Called(ctx, diskID, from, to, holder)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactRepo) DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, holder string) (int64, error) {
+	args := m.Called(ctx, diskID, dir, holder)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactRepo) CreateUpload(ctx context.Context, u *model.ArtifactUpload) error {
+	args := m.Called(ctx, u)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) GetUpload(ctx context.Context, diskID uuid.UUID, id uuid.UUID) (*model.ArtifactUpload, error) {
+	args := m.Called(ctx, diskID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactRepo) FinalizeUpload(ctx context.Context, projectID uuid.UUID, uploadID uuid.UUID, a *model.Artifact) error {
+	args := m.Called(ctx, projectID, uploadID, a)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) CompleteUpload(ctx context.Context, id uuid.UUID, holder string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, holder, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ListCompletedUploads(ctx context.Context, limit int) ([]model.ArtifactUpload, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactRepo) FailUpload(ctx context.Context, id uuid.UUID, failure string) error {
+	args := m.Called(ctx, id, failure)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ListExpiredUploads(ctx context.Context, expiredBefore time.Time, limit int) ([]model.ArtifactUpload, error) {
+	args := m.Called(ctx, expiredBefore, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactRepo) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) UpsertUploadPart(ctx context.Context, p *model.ArtifactUploadPart) error {
+	args := m.Called(ctx, p)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ListUploadParts(ctx context.Context, uploadID uuid.UUID) ([]model.ArtifactUploadPart, error) {
+	args := m.Called(ctx, uploadID)
+	return args.Get(0).([]model.ArtifactUploadPart), args.Error(1)
+}
+
+func (m *MockArtifactRepo) AssetReferenced(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error) {
+	args := m.Called(ctx, projectID, sha256)
+	return args.Bool(0), args.Error(1)
+}
+
 // MockArtifactS3Deps is a mock implementation of blob.S3Deps for file service
 type MockArtifactS3Deps struct {
 	mock.Mock
@@ -236,6 +356,75 @@ func (s *testArtifactService) GetAllPaths(ctx context.Context, diskID uuid.UUID)
 	return s.r.GetAllPaths(ctx, diskID)
 }
 
+// The trash methods do not use S3, they run the real implementation
+func (s *testArtifactService) ListTrash(ctx context.Context, diskID uuid.UUID) ([]TrashedArtifact, error) {
+	return (&artifactService{r: s.r}).ListTrash(ctx, diskID)
+}
+
+func (s *testArtifactService) Restore(ctx context.Context, diskID uuid.UUID, artifactID uuid.UUID) (*model.Artifact, error) {
+	return (&artifactService{r: s.r}).Restore(ctx, diskID, artifactID)
+}
+
+func (s *testArtifactService) PurgeTrash(ctx context.Context, trashedBefore time.Time) (int, error) {
+	return (&artifactService{r: s.r}).PurgeTrash(ctx, trashedBefore)
+}
+
+func (s *testArtifactService) AcquireLease(ctx context.Context, in AcquireArtifactLeaseInput) (*model.ArtifactLease, error) {
+	return (&artifactService{r: s.r}).AcquireLease(ctx, in)
+}
+
+func (s *testArtifactService) ReleaseLease(ctx context.Context, diskID uuid.UUID, path string, filename string, holder string) error {
+	return (&artifactService{r: s.r}).ReleaseLease(ctx, diskID, path, filename, holder)
+}
+
+func (s *testArtifactService) Query(ctx context.Context, artifact *model.Artifact, q tabular.Query) (*tabular.Result, error) {
+	return (&artifactService{r: s.r}).Query(ctx, artifact, q)
+}
+
+func (s *testArtifactService) MoveDir(ctx context.Context, in MoveArtifactDirInput) (*ArtifactDirResult, error) {
+	return (&artifactService{r: s.r}).MoveDir(ctx, in)
+}
+
+func (s *testArtifactService) DeleteDir(ctx context.Context, diskID uuid.UUID, dir string, leaseHolder string) (*ArtifactDirResult, error) {
+	return (&artifactService{r: s.r}).DeleteDir(ctx, diskID, dir, leaseHolder)
+}
+
+func (s *testArtifactService) PresignUpload(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadTicket, error) {
+	return (&artifactService{r: s.r}).PresignUpload(ctx, in)
+}
+
+func (s *testArtifactService) FinalizeUpload(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error) {
+	return (&artifactService{r: s.r}).FinalizeUpload(ctx, in)
+}
+
+func (s *testArtifactService) CheckUploads(ctx context.Context) (int, error) {
+	return (&artifactService{r: s.r}).CheckUploads(ctx)
+}
+
+func (s *testArtifactService) PurgeExpiredUploads(ctx context.Context, expiredBefore time.Time) (int, error) {
+	return (&artifactService{r: s.r}).PurgeExpiredUploads(ctx, expiredBefore)
+}
+
+func (s *testArtifactService) StartUploadSession(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadSession, error) {
+	return (&artifactService{r: s.r}).StartUploadSession(ctx, in)
+}
+
+func (s *testArtifactService) GetUploadSession(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) (*ArtifactUploadSession, error) {
+	return (&artifactService{r: s.r}).GetUploadSession(ctx, projectID, diskID, uploadID)
+}
+
+func (s *testArtifactService) UploadPart(ctx context.Context, in UploadArtifactPartInput) (*model.ArtifactUploadPart, error) {
+	return (&artifactService{r: s.r}).UploadPart(ctx, in)
+}
+
+func (s *testArtifactService) CompleteUploadSession(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error) {
+	return (&artifactService{r: s.r}).CompleteUploadSession(ctx, in)
+}
+
+func (s *testArtifactService) AbortUpload(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) error {
+	return (&artifactService{r: s.r}).AbortUpload(ctx, projectID, diskID, uploadID)
+}
+
 func (s *testArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error) {
 	// Get existing artifact
 	artifact, err := s.GetByPath(ctx, diskID, path, filename)
@@ -503,3 +692,312 @@ func TestArtifactService_UpdateArtifactMetaByPath(t *testing.T) {
 		})
 	}
 }
+
+func TestArtifactService_Restore(t *testing.T) {
+	diskID := uuid.New()
+	artifactID := uuid.New()
+
+	tests := []struct {
+		name        string
+		setup       func(*MockArtifactRepo)
+		expectedErr error
+		expectError bool
+	}{
+		{
+			name: "successful restore",
+			setup: func(repo *MockArtifactRepo) {
+				trashed := createTestArtifact()
+				trashed.ID = artifactID
+				repo.On("GetTrashed", mock.Anything, diskID, artifactID).Return(trashed, nil)
+				repo.On("ExistsByPathAndFilename", mock.Anything, diskID, trashed.Path, trashed.Filename, (*uuid.UUID)(nil)).Return(false, nil)
+				repo.On("Restore", mock.Anything, trashed).Return(nil)
+			},
+		},
+		{
+			name: "not in the trash",
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("GetTrashed", mock.Anything, diskID, artifactID).Return(nil, nil)
+			},
+			expectedErr: ErrTrashedArtifactNotFound,
+		},
+		{
+			name: "path reused meanwhile",
+			setup: func(repo *MockArtifactRepo) {
+				trashed := createTestArtifact()
+				repo.On("GetTrashed", mock.Anything, diskID, artifactID).Return(trashed, nil)
+				repo.On("ExistsByPathAndFilename", mock.Anything, diskID, trashed.Path, trashed.Filename, (*uuid.UUID)(nil)).Return(true, nil)
+			},
+			expectedErr: ErrArtifactPathTaken,
+		},
+		{
+			name: "restore error",
+			setup: func(repo *MockArtifactRepo) {
+				trashed := createTestArtifact()
+				repo.On("GetTrashed", mock.Anything, diskID, artifactID).Return(trashed, nil)
+				repo.On("ExistsByPathAndFilename", mock.Anything, diskID, trashed.Path, trashed.Filename, (*uuid.UUID)(nil)).Return(false, nil)
+				repo.On("Restore", mock.Anything, trashed).Return(errors.New("database error"))
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			tt.setup(mockRepo)
+
+			service := NewArtifactService(mockRepo, nil, nil)
+			artifact, err := service.Restore(context.Background(), diskID, artifactID)
+
+			switch {
+			case tt.expectedErr != nil:
+				assert.ErrorIs(t, err, tt.expectedErr)
+			case tt.expectError:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, artifactID, artifact.ID)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactService_MoveDir(t *testing.T) {
+	diskID := uuid.New()
+
+	tests := []struct {
+		name        string
+		from, to    string
+		holder      string
+		setup       func(*MockArtifactRepo)
+		expectedErr error
+	}{
+		{
+			name: "successful move",
+			from: "/docs/",
+			to:   "/archive/docs/",
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("MoveDir", mock.Anything, diskID, "/docs/", "/archive/docs/", "").Return(int64(4), nil)
+			},
+		},
+		{
+			name:   "leased by the mover",
+			from:   "/docs/",
+			to:     "/archive/docs/",
+			holder: "agent-1",
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("MoveDir", mock.Anything, diskID, "/docs/", "/archive/docs/", "agent-1").Return(int64(4), nil)
+			},
+		},
+		{
+			name:   "leased by another holder",
+			from:   "/docs/",
+			to:     "/archive/docs/",
+			holder: "agent-2",
+			setup: func(m *MockArtifactRepo) {
+				m.On("MoveDir", mock.Anything, diskID, "/docs/", "/archive/docs/", "agent-2").
+					Return(int64(0), &repo.ArtifactDirLeasedError{Path: "/docs/drafts/plan.md"})
+			},
+			expectedErr: ErrArtifactLeased,
+		},
+		{
+			name:        "into itself",
+			from:        "/docs/",
+			to:          "/docs/old/",
+			setup:       func(repo *MockArtifactRepo) {},
+			expectedErr: ErrInvalidArtifactDir,
+		},
+		{
+			name:        "root",
+			from:        "/",
+			to:          "/archive/",
+			setup:       func(repo *MockArtifactRepo) {},
+			expectedErr: ErrInvalidArtifactDir,
+		},
+		{
+			name: "artifact at the destination",
+			from: "/docs/",
+			to:   "/archive/",
+			setup: func(m *MockArtifactRepo) {
+				m.On("MoveDir", mock.Anything, diskID, "/docs/", "/archive/", "").Return(int64(0), repo.ErrArtifactDirConflict)
+			},
+			expectedErr: ErrArtifactPathTaken,
+		},
+		{
+			name: "empty directory",
+			from: "/docs/",
+			to:   "/archive/",
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("MoveDir", mock.Anything, diskID, "/docs/", "/archive/", "").Return(int64(0), nil)
+			},
+			expectedErr: ErrArtifactDirNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			tt.setup(mockRepo)
+
+			service := NewArtifactService(mockRepo, nil, nil)
+			result, err := service.MoveDir(context.Background(), MoveArtifactDirInput{DiskID: diskID, From: tt.from, To: tt.to, LeaseHolder: tt.holder})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, &ArtifactDirResult{Path: tt.to, Artifacts: 4}, result)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactService_DeleteDir(t *testing.T) {
+	diskID := uuid.New()
+
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("DeleteDir", mock.Anything, diskID, "/docs/", "").Return(int64(3), nil).Once()
+	mockRepo.On("DeleteDir", mock.Anything, diskID, "/docs/", "").Return(int64(0), nil).Once()
+	mockRepo.On("DeleteDir", mock.Anything, diskID, "/docs/", "agent-2").
+		Return(int64(0), &repo.ArtifactDirLeasedError{Path: "/docs/drafts/plan.md"}).Once()
+	service := NewArtifactService(mockRepo, nil, nil)
+
+	result, err := service.DeleteDir(context.Background(), diskID, "/docs/", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Artifacts)
+
+	_, err = service.DeleteDir(context.Background(), diskID, "/docs/", "")
+	assert.ErrorIs(t, err, ErrArtifactDirNotFound)
+
+	_, err = service.DeleteDir(context.Background(), diskID, "/docs/", "agent-2")
+	assert.ErrorIs(t, err, ErrArtifactLeased)
+
+	_, err = service.DeleteDir(context.Background(), diskID, "/", "")
+	assert.ErrorIs(t, err, ErrInvalidArtifactDir)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestArtifactService_PurgeTrash(t *testing.T) {
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+
+	// Full batches are followed by another batch until one comes back short
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("PurgeTrashed", mock.Anything, cutoff, purgeTrashBatchSize).Return(purgeTrashBatchSize, nil).Once()
+	mockRepo.On("PurgeTrashed", mock.Anything, cutoff, purgeTrashBatchSize).Return(3, nil).Once()
+
+	purged, err := NewArtifactService(mockRepo, nil, nil).PurgeTrash(context.Background(), cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, purgeTrashBatchSize+3, purged)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestArtifactService_AcquireLease(t *testing.T) {
+	diskID := uuid.New()
+	in := AcquireArtifactLeaseInput{DiskID: diskID, Path: "/docs/", Filename: "a.md", Holder: "agent-1", TTL: time.Minute}
+
+	tests := []struct {
+		name        string
+		in          AcquireArtifactLeaseInput
+		setup       func(*MockArtifactRepo)
+		expectedErr error
+		expectError bool
+	}{
+		{
+			name: "lease acquired",
+			in:   in,
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("AcquireLease", mock.Anything, mock.MatchedBy(func(l *model.ArtifactLease) bool {
+					return l.DiskID == diskID && l.Holder == "agent-1" && l.ExpiresAt.After(time.Now())
+				})).Return(true, nil)
+			},
+		},
+		{
+			name: "held by another holder",
+			in:   in,
+			setup: func(repo *MockArtifactRepo) {
+				repo.On("AcquireLease", mock.Anything, mock.Anything).Return(false, nil)
+			},
+			expectedErr: ErrArtifactLeased,
+		},
+		{
+			name:        "missing holder",
+			in:          AcquireArtifactLeaseInput{DiskID: diskID, Path: "/docs/", Filename: "a.md", TTL: time.Minute},
+			setup:       func(repo *MockArtifactRepo) {},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			tt.setup(mockRepo)
+
+			lease, err := NewArtifactService(mockRepo, nil, nil).AcquireLease(context.Background(), tt.in)
+
+			switch {
+			case tt.expectedErr != nil:
+				assert.ErrorIs(t, err, tt.expectedErr)
+			case tt.expectError:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, "agent-1", lease.Holder)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactService_CreateRejectsLeasedPath(t *testing.T) {
+	diskID := uuid.New()
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("GetActiveLease", mock.Anything, diskID, "/docs/", "a.md").
+		Return(&model.ArtifactLease{DiskID: diskID, Path: "/docs/", Filename: "a.md", Holder: "agent-1"}, nil)
+
+	_, err := NewArtifactService(mockRepo, nil, nil).Create(context.Background(), CreateArtifactInput{
+		DiskID:      diskID,
+		Path:        "/docs/",
+		Filename:    "a.md",
+		LeaseHolder: "agent-2",
+	})
+	assert.ErrorIs(t, err, ErrArtifactLeased)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestArtifactService_Query_UnsupportedFormat(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		artifact *model.Artifact
+	}{
+		{
+			name:     "parquet file",
+			artifact: &model.Artifact{Filename: "orders.parquet", AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/a.parquet", MIME: "application/vnd.apache.parquet"})},
+		},
+		{
+			name:     "csv name on binary content",
+			artifact: &model.Artifact{Filename: "orders.csv", AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/a.csv", DetectedMIME: "application/zip"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewArtifactService(&MockArtifactRepo{}, nil, nil).Query(ctx, tt.artifact, tabular.Query{})
+			assert.ErrorIs(t, err, ErrUnsupportedQueryFormat)
+		})
+	}
+}
+
+func TestQueryFormat(t *testing.T) {
+	csvByMIME := &model.Artifact{Filename: "export", AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "text/csv; charset=utf-8"})}
+	format, ok := queryFormat(csvByMIME)
+	assert.True(t, ok)
+	assert.Equal(t, tabular.FormatCSV, format)
+
+	format, ok = queryFormat(&model.Artifact{Filename: "events.NDJSON"})
+	assert.True(t, ok)
+	assert.Equal(t, tabular.FormatJSONL, format)
+}
@@ -0,0 +1,617 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrArtifactUploadNotFound   = errors.New("artifact upload not found or expired")
+	ErrArtifactUploadIncomplete = errors.New("the content of the artifact upload has not been uploaded")
+	ErrArtifactUploadMismatch   = errors.New("uploaded content does not match its declared size or sha256")
+	ErrInvalidArtifactUpload    = errors.New("invalid artifact upload")
+	ErrArtifactUploadSealed     = errors.New("uploads straight to S3 or in parts are disabled with envelope encryption, upload the file in one request")
+)
+
+const (
+	// directUploadPartBytes is the part size of direct uploads, a larger file is uploaded in parts
+	directUploadPartBytes = 64 << 20
+	// sessionPartBytes is the part size of upload sessions, small enough to hold a part in memory
+	sessionPartBytes = 16 << 20
+	// maxUploadParts is the most parts S3 accepts in a multipart upload
+	maxUploadParts = 10000
+	// purgeUploadsBatchSize bounds the expired uploads dropped per repository call
+	purgeUploadsBatchSize = 100
+	// checkUploadsBatchSize bounds the completed uploads checked per call of CheckUploads
+	checkUploadsBatchSize = 10
+	// checkUploadTTL is how long a completed upload at least stays valid for its content to be checked
+	checkUploadTTL = 24 * time.Hour
+)
+
+// ArtifactUploadCheckLockKey is the advisory lock key that keeps CheckUploads to one instance at a time, so the
+// content of an upload is read once
+const ArtifactUploadCheckLockKey int64 = 0x61637478_7570636b
+
+// uploadPartBytes returns the part size of a multipart upload of size bytes, grown past partBytes when the file
+// would not fit in maxUploadParts parts
+func uploadPartBytes(size int64, partBytes int64) int64 {
+	part := partBytes
+	if size > part*maxUploadParts {
+		part = (size + maxUploadParts - 1) / maxUploadParts
+	}
+	return part
+}
+
+type ArtifactUploadInput struct {
+	Project  *model.Project
+	DiskID   uuid.UUID
+	Path     string
+	Filename string
+	// MIME, SizeB and SHA256, lowercase hex, are declared by the client for the file it uploads
+	MIME     string
+	SizeB    int64
+	SHA256   string
+	UserMeta map[string]interface{}
+	// LeaseHolder identifies the writer, the upload is rejected if another holder leases the path
+	LeaseHolder string
+	// Expire is how long the upload, and its presigned URLs, stay valid
+	Expire time.Duration
+}
+
+// ArtifactUploadTicket tells a client where to upload the content of an artifact, with a single PUT to URL and the
+// Headers, or with a PUT of each part of Upload.PartSize bytes to its URL. Nothing is uploaded when the upload exists
+// already.
+type ArtifactUploadTicket struct {
+	Upload  *model.ArtifactUpload `json:"upload"`
+	URL     string                `json:"url,omitempty"`
+	Headers map[string]string     `json:"headers,omitempty"`
+	Parts   []PresignedUploadPart `json:"parts,omitempty"`
+}
+
+type PresignedUploadPart struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+// PresignUpload starts an upload of an artifact straight to S3 and returns its presigned URLs. Content S3 already
+// stores for the project is not uploaded again, the ticket has no URL and the upload can be finalized right away.
+func (s *artifactService) PresignUpload(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadTicket, error) {
+	upload, err := s.newUpload(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	ticket := &ArtifactUploadTicket{Upload: upload}
+
+	if !upload.Exists && in.SizeB <= directUploadPartBytes {
+		url, err := s.s3.PresignPut(ctx, upload.S3Key, in.MIME, in.SHA256, in.Expire)
+		if err != nil {
+			return nil, fmt.Errorf("presign upload: %w", err)
+		}
+		ticket.URL, ticket.Headers = url, s.s3.PresignHeaders(in.MIME, in.SHA256)
+	}
+	if !upload.Exists && in.SizeB > directUploadPartBytes {
+		if err := s.startMultipart(ctx, upload, directUploadPartBytes); err != nil {
+			return nil, err
+		}
+		parts := upload.PartCount()
+		ticket.Parts = make([]PresignedUploadPart, 0, parts)
+		for n := int32(1); n <= parts; n++ {
+			url, err := s.s3.PresignUploadPart(ctx, upload.S3Key, upload.MultipartID, n, in.Expire)
+			if err != nil {
+				_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID)
+				return nil, fmt.Errorf("presign upload part: %w", err)
+			}
+			ticket.Parts = append(ticket.Parts, PresignedUploadPart{PartNumber: n, URL: url})
+		}
+	}
+
+	if err := s.r.CreateUpload(ctx, upload); err != nil {
+		if upload.MultipartID != "" {
+			_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID)
+		}
+		return nil, fmt.Errorf("create artifact upload: %w", err)
+	}
+	return ticket, nil
+}
+
+// newUpload checks an upload against the lease of its path and the storage quota, and returns it unsaved with the
+// key of its content. Content S3 already stores for the project is reused.
+func (s *artifactService) newUpload(ctx context.Context, in ArtifactUploadInput) (*model.ArtifactUpload, error) {
+	// Nothing could seal the content on its way to S3
+	if s.s3.Sealing() {
+		return nil, ErrArtifactUploadSealed
+	}
+	if in.SizeB <= 0 {
+		return nil, fmt.Errorf("%w: the size must be positive", ErrInvalidArtifactUpload)
+	}
+	lease, err := s.r.GetActiveLease(ctx, in.DiskID, in.Path, in.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("check artifact lease: %w", err)
+	}
+	if lease != nil && lease.Holder != in.LeaseHolder {
+		return nil, ErrArtifactLeased
+	}
+	if s.quota != nil {
+		if err := s.quota.CheckStorage(ctx, in.Project, in.SizeB); err != nil {
+			return nil, err
+		}
+	}
+
+	upload := &model.ArtifactUpload{
+		ProjectID: in.Project.ID,
+		DiskID:    in.DiskID,
+		Path:      in.Path,
+		Filename:  in.Filename,
+		MIME:      in.MIME,
+		SizeB:     in.SizeB,
+		SHA256:    in.SHA256,
+		Meta:      in.UserMeta,
+		ExpiresAt: time.Now().Add(in.Expire),
+	}
+
+	keyPrefix := "disks/" + in.Project.ID.String()
+	if existing := s.s3.FindObject(ctx, keyPrefix, in.SHA256); existing != nil {
+		if existing.SizeB != in.SizeB {
+			return nil, fmt.Errorf("%w: content with this sha256 has %d bytes", ErrArtifactUploadMismatch, existing.SizeB)
+		}
+		upload.S3Key, upload.Exists = existing.S3Key, true
+		return upload, nil
+	}
+	upload.S3Key = blob.ObjectKey(keyPrefix, in.SHA256, strings.ToLower(filepath.Ext(in.Filename)))
+	return upload, nil
+}
+
+// startMultipart starts the S3 multipart upload of an upload in parts of about partBytes
+func (s *artifactService) startMultipart(ctx context.Context, upload *model.ArtifactUpload, partBytes int64) error {
+	multipartID, err := s.s3.CreateMultipartUpload(ctx, upload.S3Key, upload.MIME)
+	if err != nil {
+		return fmt.Errorf("start multipart upload: %w", err)
+	}
+	upload.MultipartID, upload.PartSize = multipartID, uploadPartBytes(upload.SizeB, partBytes)
+	return nil
+}
+
+type FinalizeArtifactUploadInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	UploadID  uuid.UUID
+	// Parts are required to finalize a multipart upload
+	Parts []blob.CompletedPart
+	// LeaseHolder identifies the writer, the write is rejected if another holder leases the path
+	LeaseHolder string
+}
+
+// FinalizedArtifactUpload is the artifact of a finalized upload, or the upload while its content is checked
+type FinalizedArtifactUpload struct {
+	Artifact *model.Artifact
+	// Upload is set for a multipart upload, CheckUploads creates its artifact once its content is checked
+	Upload *model.ArtifactUpload
+}
+
+// FinalizeUpload creates or replaces the artifact of an upload uploaded with a single PUT, its content was checked
+// against the declared SHA256 by S3. A multipart upload is completed and its content checked in the background,
+// S3 has no checksum of the whole content of one. Content that does not match is dropped with the upload.
+func (s *artifactService) FinalizeUpload(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error) {
+	upload, err := s.getUpload(ctx, in.ProjectID, in.DiskID, in.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Failure != "" {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactUploadMismatch, upload.Failure)
+	}
+	if err := s.checkUploadLease(ctx, upload, in.LeaseHolder); err != nil {
+		return nil, err
+	}
+	if upload.CompletedAt != nil {
+		return &FinalizedArtifactUpload{Upload: upload}, nil
+	}
+
+	if upload.MultipartID != "" {
+		if len(in.Parts) == 0 {
+			return nil, fmt.Errorf("%w: parts are required to finalize a multipart upload", ErrInvalidArtifactUpload)
+		}
+		// An upload completed by an earlier finalize that failed afterwards is completed again as it is
+		err := s.s3.CompleteMultipartUpload(ctx, upload.S3Key, upload.MultipartID, in.Parts)
+		if errors.Is(err, blob.ErrInvalidParts) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArtifactUpload, err)
+		}
+		if err != nil && !errors.Is(err, blob.ErrNoSuchUpload) {
+			return nil, fmt.Errorf("complete multipart upload: %w", err)
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(checkUploadTTL)
+		if err := s.r.CompleteUpload(ctx, upload.ID, in.LeaseHolder, expiresAt); err != nil {
+			return nil, fmt.Errorf("complete artifact upload: %w", err)
+		}
+		upload.CompletedAt, upload.LeaseHolder = &now, in.LeaseHolder
+		if upload.ExpiresAt.Before(expiresAt) {
+			upload.ExpiresAt = expiresAt
+		}
+		return &FinalizedArtifactUpload{Upload: upload}, nil
+	}
+
+	asset, head, err := s.s3.StatObject(ctx, upload.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("check uploaded content: %w", err)
+	}
+	if asset == nil {
+		return nil, ErrArtifactUploadIncomplete
+	}
+	switch {
+	case asset.SHA256 != "":
+	case upload.Exists:
+		// The API stored this content under its SHA256
+		asset.SHA256 = upload.SHA256
+	default:
+		// A store without checksums, the content of a single PUT is small enough to be read
+		asset, head, err = s.s3.DigestObject(ctx, upload.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("check uploaded content: %w", err)
+		}
+		if asset == nil {
+			return nil, ErrArtifactUploadIncomplete
+		}
+	}
+	if err := s.resolveUploadedContent(upload, asset, head); err != nil {
+		if derr := s.dropUpload(ctx, upload); derr != nil {
+			return nil, fmt.Errorf("drop artifact upload: %w", derr)
+		}
+		return nil, err
+	}
+
+	artifact, err := s.createUploadedArtifact(ctx, upload, asset)
+	if err != nil {
+		return nil, err
+	}
+	return &FinalizedArtifactUpload{Artifact: artifact}, nil
+}
+
+// checkUploadLease returns ErrArtifactLeased when a holder other than holder leases the path of an upload
+func (s *artifactService) checkUploadLease(ctx context.Context, upload *model.ArtifactUpload, holder string) error {
+	lease, err := s.r.GetActiveLease(ctx, upload.DiskID, upload.Path, upload.Filename)
+	if err != nil {
+		return fmt.Errorf("check artifact lease: %w", err)
+	}
+	if lease != nil && lease.Holder != holder {
+		return ErrArtifactLeased
+	}
+	return nil
+}
+
+// resolveUploadedContent checks uploaded content against what the client declared and resolves its type, it returns
+// ErrArtifactUploadMismatch or blob.ErrMIMEMismatch when the content has to be dropped
+func (s *artifactService) resolveUploadedContent(upload *model.ArtifactUpload, asset *model.Asset, head []byte) error {
+	if asset.SHA256 != upload.SHA256 || asset.SizeB != upload.SizeB {
+		return fmt.Errorf("%w: got %d bytes with sha256 %s", ErrArtifactUploadMismatch, asset.SizeB, asset.SHA256)
+	}
+	var err error
+	asset.MIME, asset.DetectedMIME, err = s.s3.ResolveMIME(upload.Filename, upload.MIME, head)
+	if err != nil {
+		return err
+	}
+	asset.DeclaredMIME = upload.MIME
+	return nil
+}
+
+// createUploadedArtifact creates or replaces the artifact at the path of an upload with its checked content
+func (s *artifactService) createUploadedArtifact(ctx context.Context, upload *model.ArtifactUpload, asset *model.Asset) (*model.Artifact, error) {
+	exists, err := s.r.ExistsByPathAndFilename(ctx, upload.DiskID, upload.Path, upload.Filename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("check artifact existence: %w", err)
+	}
+	if exists {
+		if err := s.r.DeleteByPath(ctx, upload.ProjectID, upload.DiskID, upload.Path, upload.Filename); err != nil {
+			return nil, fmt.Errorf("upsert existing artifact: %w", err)
+		}
+	}
+
+	meta := map[string]interface{}{
+		model.ArtifactInfoKey: map[string]interface{}{
+			"path":     upload.Path,
+			"filename": upload.Filename,
+			"mime":     asset.MIME,
+			"size":     asset.SizeB,
+		},
+	}
+	for k, v := range upload.Meta {
+		meta[k] = v
+	}
+
+	artifact := &model.Artifact{
+		DiskID:    upload.DiskID,
+		Path:      upload.Path,
+		Filename:  upload.Filename,
+		Meta:      meta,
+		AssetMeta: datatypes.NewJSONType(*asset),
+	}
+	if err := s.r.FinalizeUpload(ctx, upload.ProjectID, upload.ID, artifact); err != nil {
+		if errors.Is(err, repo.ErrArtifactUploadGone) {
+			return nil, ErrArtifactUploadNotFound
+		}
+		return nil, fmt.Errorf("create artifact record: %w", err)
+	}
+	return artifact, nil
+}
+
+// CheckUploads checks the content of completed multipart uploads against what their clients declared and creates
+// their artifacts. Content that does not match is dropped and the failure kept on the upload until it expires. An
+// upload whose path another holder leases waits for the lease to end. It returns how many artifacts were created.
+func (s *artifactService) CheckUploads(ctx context.Context) (int, error) {
+	uploads, err := s.r.ListCompletedUploads(ctx, checkUploadsBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	for i := range uploads {
+		ok, err := s.checkUpload(ctx, &uploads[i])
+		if err != nil {
+			return created, fmt.Errorf("check artifact upload %s: %w", uploads[i].ID, err)
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// checkUpload checks the content of a completed upload and creates its artifact, it returns false when the upload
+// waits for a lease, was dropped meanwhile, or failed the check
+func (s *artifactService) checkUpload(ctx context.Context, upload *model.ArtifactUpload) (bool, error) {
+	if err := s.checkUploadLease(ctx, upload, upload.LeaseHolder); err != nil {
+		if errors.Is(err, ErrArtifactLeased) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	asset, head, err := s.s3.DigestObject(ctx, upload.S3Key)
+	if err != nil {
+		return false, err
+	}
+	if asset == nil {
+		return false, s.failUpload(ctx, upload, "the uploaded content no longer exists")
+	}
+	if err := s.resolveUploadedContent(upload, asset, head); err != nil {
+		return false, s.failUpload(ctx, upload, err.Error())
+	}
+
+	// The lease may have been taken while the content was read
+	if err := s.checkUploadLease(ctx, upload, upload.LeaseHolder); err != nil {
+		if errors.Is(err, ErrArtifactLeased) {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := s.createUploadedArtifact(ctx, upload, asset); err != nil {
+		if errors.Is(err, ErrArtifactUploadNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// failUpload drops the content of a completed upload and records why on the upload
+func (s *artifactService) failUpload(ctx context.Context, upload *model.ArtifactUpload, failure string) error {
+	if err := s.dropContent(ctx, upload); err != nil {
+		return err
+	}
+	return s.r.FailUpload(ctx, upload.ID, failure)
+}
+
+// ArtifactUploadSession is an upload sent through the API in parts, with the parts received so far
+type ArtifactUploadSession struct {
+	Upload    *model.ArtifactUpload      `json:"upload"`
+	PartCount int32                      `json:"part_count"` // parts to send, numbered from 1, 0 when S3 already stores the content
+	Parts     []model.ArtifactUploadPart `json:"parts"`
+}
+
+// StartUploadSession starts an upload of an artifact sent through the API in parts of Upload.PartSize bytes, a part
+// can be sent again until the session is completed. Content S3 already stores for the project needs no part, the
+// session can be completed right away.
+func (s *artifactService) StartUploadSession(ctx context.Context, in ArtifactUploadInput) (*ArtifactUploadSession, error) {
+	upload, err := s.newUpload(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.Exists {
+		if err := s.startMultipart(ctx, upload, sessionPartBytes); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.r.CreateUpload(ctx, upload); err != nil {
+		if upload.MultipartID != "" {
+			_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID)
+		}
+		return nil, fmt.Errorf("create artifact upload: %w", err)
+	}
+	return &ArtifactUploadSession{Upload: upload, PartCount: upload.PartCount(), Parts: []model.ArtifactUploadPart{}}, nil
+}
+
+// getUpload returns a pending upload of a disk of the project, or ErrArtifactUploadNotFound
+func (s *artifactService) getUpload(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) (*model.ArtifactUpload, error) {
+	upload, err := s.r.GetUpload(ctx, diskID, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("get artifact upload: %w", err)
+	}
+	if upload == nil || upload.ProjectID != projectID {
+		return nil, ErrArtifactUploadNotFound
+	}
+	return upload, nil
+}
+
+// GetUploadSession returns an upload with the parts received so far, to resume it
+func (s *artifactService) GetUploadSession(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) (*ArtifactUploadSession, error) {
+	upload, err := s.getUpload(ctx, projectID, diskID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.r.ListUploadParts(ctx, upload.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list upload parts: %w", err)
+	}
+	return &ArtifactUploadSession{Upload: upload, PartCount: upload.PartCount(), Parts: parts}, nil
+}
+
+type UploadArtifactPartInput struct {
+	ProjectID  uuid.UUID
+	DiskID     uuid.UUID
+	UploadID   uuid.UUID
+	PartNumber int32
+	Body       io.Reader // read up to the size of the part
+}
+
+// UploadPart sends a part of an upload to S3, it replaces the part sent before with the same number
+func (s *artifactService) UploadPart(ctx context.Context, in UploadArtifactPartInput) (*model.ArtifactUploadPart, error) {
+	upload, err := s.getUpload(ctx, in.ProjectID, in.DiskID, in.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.MultipartID == "" {
+		return nil, fmt.Errorf("%w: the upload takes no parts", ErrInvalidArtifactUpload)
+	}
+	if upload.CompletedAt != nil {
+		return nil, fmt.Errorf("%w: the upload is completed", ErrInvalidArtifactUpload)
+	}
+	if in.PartNumber < 1 || in.PartNumber > upload.PartCount() {
+		return nil, fmt.Errorf("%w: the part number must be between 1 and %d", ErrInvalidArtifactUpload, upload.PartCount())
+	}
+	size := upload.PartBytes(in.PartNumber)
+	body, err := io.ReadAll(io.LimitReader(in.Body, size+1))
+	if err != nil {
+		return nil, fmt.Errorf("read part: %w", err)
+	}
+	if int64(len(body)) != size {
+		return nil, fmt.Errorf("%w: part %d must be %d bytes", ErrInvalidArtifactUpload, in.PartNumber, size)
+	}
+
+	etag, err := s.s3.UploadPart(ctx, upload.S3Key, upload.MultipartID, in.PartNumber, body)
+	if errors.Is(err, blob.ErrNoSuchUpload) {
+		return nil, ErrArtifactUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upload part: %w", err)
+	}
+
+	part := &model.ArtifactUploadPart{
+		UploadID:   upload.ID,
+		PartNumber: in.PartNumber,
+		ETag:       etag,
+		SizeB:      size,
+	}
+	if err := s.r.UpsertUploadPart(ctx, part); err != nil {
+		return nil, fmt.Errorf("record upload part: %w", err)
+	}
+	return part, nil
+}
+
+// CompleteUploadSession assembles the parts of an upload once all were received and finalizes it
+func (s *artifactService) CompleteUploadSession(ctx context.Context, in FinalizeArtifactUploadInput) (*FinalizedArtifactUpload, error) {
+	upload, err := s.getUpload(ctx, in.ProjectID, in.DiskID, in.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	in.Parts = nil
+	if upload.MultipartID != "" && upload.CompletedAt == nil {
+		received, err := s.r.ListUploadParts(ctx, upload.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list upload parts: %w", err)
+		}
+		if missing := missingParts(upload.PartCount(), received); len(missing) > 0 {
+			return nil, fmt.Errorf("%w: %d of %d parts are missing, starting with %v", ErrArtifactUploadIncomplete, len(missing), upload.PartCount(), missing[:min(len(missing), 10)])
+		}
+		for _, p := range received {
+			in.Parts = append(in.Parts, blob.CompletedPart{PartNumber: p.PartNumber, ETag: p.ETag})
+		}
+	}
+	return s.FinalizeUpload(ctx, in)
+}
+
+// missingParts returns the numbers of the parts of 1 to count that were not received
+func missingParts(count int32, received []model.ArtifactUploadPart) []int32 {
+	got := make(map[int32]bool, len(received))
+	for _, p := range received {
+		got[p.PartNumber] = true
+	}
+	var missing []int32
+	for n := int32(1); n <= count; n++ {
+		if !got[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// AbortUpload drops an upload with what was uploaded for it
+func (s *artifactService) AbortUpload(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, uploadID uuid.UUID) error {
+	upload, err := s.getUpload(ctx, projectID, diskID, uploadID)
+	if err != nil {
+		return err
+	}
+	return s.dropUpload(ctx, upload)
+}
+
+// PurgeExpiredUploads drops the uploads that expired before expiredBefore with what was uploaded for them,
+// it returns how many were dropped
+func (s *artifactService) PurgeExpiredUploads(ctx context.Context, expiredBefore time.Time) (int, error) {
+	total := 0
+	for {
+		uploads, err := s.r.ListExpiredUploads(ctx, expiredBefore, purgeUploadsBatchSize)
+		if err != nil {
+			return total, err
+		}
+		for i := range uploads {
+			if err := s.dropUpload(ctx, &uploads[i]); err != nil {
+				return total, err
+			}
+			total++
+		}
+		if len(uploads) < purgeUploadsBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// dropUpload deletes an upload with the content uploaded for it, see dropContent
+func (s *artifactService) dropUpload(ctx context.Context, upload *model.ArtifactUpload) error {
+	if err := s.dropContent(ctx, upload); err != nil {
+		return err
+	}
+	return s.r.DeleteUpload(ctx, upload.ID)
+}
+
+// dropContent aborts the multipart upload of an upload and deletes the content uploaded for it unless the project
+// references that content
+func (s *artifactService) dropContent(ctx context.Context, upload *model.ArtifactUpload) error {
+	if upload.MultipartID != "" {
+		err := s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID)
+		if err != nil && !errors.Is(err, blob.ErrNoSuchUpload) {
+			return err
+		}
+	}
+	if !upload.Exists {
+		referenced, err := s.r.AssetReferenced(ctx, upload.ProjectID, upload.SHA256)
+		if err != nil {
+			return fmt.Errorf("check asset reference: %w", err)
+		}
+		if !referenced {
+			if err := s.s3.DeleteObject(ctx, upload.S3Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
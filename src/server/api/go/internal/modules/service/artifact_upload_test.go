@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/infra/envelope"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestUploadPartBytes(t *testing.T) {
+	assert.Equal(t, int64(directUploadPartBytes), uploadPartBytes(1<<30, directUploadPartBytes))
+	assert.Equal(t, int64(directUploadPartBytes), uploadPartBytes(directUploadPartBytes*maxUploadParts, directUploadPartBytes))
+
+	// A file too large for maxUploadParts parts of the default size gets larger parts
+	size := int64(directUploadPartBytes)*maxUploadParts + 1
+	part := uploadPartBytes(size, directUploadPartBytes)
+	assert.Greater(t, part, int64(directUploadPartBytes))
+	assert.LessOrEqual(t, (size+part-1)/part, int64(maxUploadParts))
+}
+
+func TestArtifactService_PresignUpload_Rejected(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{
+		model.ProjectQuotaConfigKey: map[string]interface{}{"storage_bytes": float64(100)},
+	}}
+	in := ArtifactUploadInput{
+		Project:  project,
+		DiskID:   diskID,
+		Path:     "/videos/",
+		Filename: "demo.mp4",
+		MIME:     "video/mp4",
+		SizeB:    50,
+		SHA256:   "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Expire:   time.Hour,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(in *ArtifactUploadInput)
+		lease   *model.ArtifactLease
+		wantErr error
+	}{
+		{
+			name:    "empty file",
+			modify:  func(in *ArtifactUploadInput) { in.SizeB = 0 },
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "path leased by another holder",
+			modify:  func(in *ArtifactUploadInput) { in.LeaseHolder = "agent-2" },
+			lease:   &model.ArtifactLease{Holder: "agent-1"},
+			wantErr: ErrArtifactLeased,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			mockRepo.On("GetActiveLease", ctx, diskID, "/videos/", "demo.mp4").Return(tt.lease, nil)
+			req := in
+			tt.modify(&req)
+
+			_, err := NewArtifactService(mockRepo, nil, nil).PresignUpload(ctx, req)
+			assert.ErrorIs(t, err, tt.wantErr)
+			mockRepo.AssertNotCalled(t, "CreateUpload", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("over the storage quota", func(t *testing.T) {
+		mockRepo := &MockArtifactRepo{}
+		mockRepo.On("GetActiveLease", ctx, diskID, "/videos/", "demo.mp4").Return(nil, nil)
+		quota := NewQuotaService(&fakeQuotaRepo{storage: 60}, &config.Config{})
+
+		_, err := NewArtifactService(mockRepo, nil, quota).PresignUpload(ctx, in)
+		var exceeded *QuotaExceededError
+		require.True(t, errors.As(err, &exceeded))
+		assert.Equal(t, int64(50), exceeded.Requested)
+		mockRepo.AssertNotCalled(t, "CreateUpload", mock.Anything, mock.Anything)
+	})
+	t.Run("envelope encryption enabled", func(t *testing.T) {
+		mockRepo := &MockArtifactRepo{}
+		sealing := &blob.S3Deps{Sealer: &envelope.Sealer{}}
+
+		_, err := NewArtifactService(mockRepo, sealing, nil).PresignUpload(ctx, in)
+		assert.ErrorIs(t, err, ErrArtifactUploadSealed)
+		_, err = NewArtifactService(mockRepo, sealing, nil).StartUploadSession(ctx, in)
+		assert.ErrorIs(t, err, ErrArtifactUploadSealed)
+		mockRepo.AssertNotCalled(t, "CreateUpload", mock.Anything, mock.Anything)
+	})
+}
+
+func TestArtifactService_FinalizeUpload_Rejected(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	multipart := &model.ArtifactUpload{ID: uploadID, DiskID: diskID, Path: "/videos/", Filename: "demo.mp4", MultipartID: "mp-1"}
+
+	tests := []struct {
+		name    string
+		upload  *model.ArtifactUpload
+		lease   *model.ArtifactLease
+		holder  string
+		wantErr error
+	}{
+		{
+			name:    "finalized or expired",
+			wantErr: ErrArtifactUploadNotFound,
+		},
+		{
+			name:    "path leased by another holder",
+			upload:  multipart,
+			lease:   &model.ArtifactLease{Holder: "agent-1"},
+			holder:  "agent-2",
+			wantErr: ErrArtifactLeased,
+		},
+		{
+			name:    "multipart upload without parts",
+			upload:  multipart,
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "upload of another project",
+			upload:  &model.ArtifactUpload{ID: uploadID, ProjectID: uuid.New(), DiskID: diskID, Path: "/videos/", Filename: "demo.mp4"},
+			wantErr: ErrArtifactUploadNotFound,
+		},
+		{
+			name:    "content dropped by the check",
+			upload:  &model.ArtifactUpload{ID: uploadID, DiskID: diskID, Path: "/videos/", Filename: "demo.mp4", Failure: "got 3 bytes"},
+			wantErr: ErrArtifactUploadMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			mockRepo.On("GetUpload", ctx, diskID, uploadID).Return(tt.upload, nil)
+			mockRepo.On("GetActiveLease", ctx, diskID, "/videos/", "demo.mp4").Return(tt.lease, nil)
+
+			_, err := NewArtifactService(mockRepo, nil, nil).FinalizeUpload(ctx, FinalizeArtifactUploadInput{
+				DiskID:      diskID,
+				UploadID:    uploadID,
+				LeaseHolder: tt.holder,
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			mockRepo.AssertNotCalled(t, "FinalizeUpload", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestArtifactService_FinalizeUpload_Completed(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	completedAt := time.Now()
+	upload := &model.ArtifactUpload{ID: uploadID, DiskID: diskID, Path: "/videos/", Filename: "demo.mp4", MultipartID: "mp-1", CompletedAt: &completedAt}
+
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("GetUpload", ctx, diskID, uploadID).Return(upload, nil)
+	mockRepo.On("GetActiveLease", ctx, diskID, "/videos/", "demo.mp4").Return(nil, nil)
+
+	// Finalized again while its content is checked, the upload is returned as it is
+	finalized, err := NewArtifactService(mockRepo, nil, nil).FinalizeUpload(ctx, FinalizeArtifactUploadInput{DiskID: diskID, UploadID: uploadID})
+	require.NoError(t, err)
+	assert.Nil(t, finalized.Artifact)
+	assert.Equal(t, upload, finalized.Upload)
+	mockRepo.AssertNotCalled(t, "CompleteUpload", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestArtifactService_CheckUploads_Leased(t *testing.T) {
+	ctx := context.Background()
+	completedAt := time.Now()
+	upload := model.ArtifactUpload{ID: uuid.New(), DiskID: uuid.New(), Path: "/videos/", Filename: "demo.mp4", CompletedAt: &completedAt, LeaseHolder: "agent-1"}
+
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("ListCompletedUploads", ctx, checkUploadsBatchSize).Return([]model.ArtifactUpload{upload}, nil)
+	mockRepo.On("GetActiveLease", ctx, upload.DiskID, "/videos/", "demo.mp4").Return(&model.ArtifactLease{Holder: "agent-2"}, nil)
+
+	// The upload waits for the lease of another holder to end, its content is not read
+	created, err := NewArtifactService(mockRepo, nil, nil).CheckUploads(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, created)
+	mockRepo.AssertNotCalled(t, "FailUpload", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "FinalizeUpload", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestArtifactService_PurgeExpiredUploads(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	projectID := uuid.New()
+
+	// Uploads of content S3 already stored and referenced keep it
+	existing := model.ArtifactUpload{ID: uuid.New(), ProjectID: projectID, S3Key: "disks/a", Exists: true}
+	referenced := model.ArtifactUpload{ID: uuid.New(), ProjectID: projectID, S3Key: "disks/b", SHA256: "b"}
+
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("ListExpiredUploads", ctx, now, purgeUploadsBatchSize).Return([]model.ArtifactUpload{existing, referenced}, nil)
+	mockRepo.On("AssetReferenced", ctx, projectID, "b").Return(true, nil)
+	mockRepo.On("DeleteUpload", ctx, existing.ID).Return(nil)
+	mockRepo.On("DeleteUpload", ctx, referenced.ID).Return(nil)
+
+	dropped, err := NewArtifactService(mockRepo, nil, nil).PurgeExpiredUploads(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestArtifactService_UploadPart_Rejected(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	// 40 bytes in parts of 16 bytes, the last part holds 8 bytes
+	session := &model.ArtifactUpload{ID: uploadID, DiskID: diskID, SizeB: 40, MultipartID: "mp-1", PartSize: 16}
+
+	tests := []struct {
+		name    string
+		upload  *model.ArtifactUpload
+		part    int32
+		body    string
+		wantErr error
+	}{
+		{
+			name:    "finalized or expired",
+			part:    1,
+			body:    strings.Repeat("a", 16),
+			wantErr: ErrArtifactUploadNotFound,
+		},
+		{
+			name:    "content already stored",
+			upload:  &model.ArtifactUpload{ID: uploadID, DiskID: diskID, SizeB: 40, Exists: true},
+			part:    1,
+			body:    strings.Repeat("a", 16),
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "upload of another project",
+			upload:  &model.ArtifactUpload{ID: uploadID, ProjectID: uuid.New(), DiskID: diskID, SizeB: 40, MultipartID: "mp-1", PartSize: 16},
+			part:    1,
+			body:    strings.Repeat("a", 16),
+			wantErr: ErrArtifactUploadNotFound,
+		},
+		{
+			name:    "completed upload",
+			upload:  &model.ArtifactUpload{ID: uploadID, DiskID: diskID, SizeB: 40, MultipartID: "mp-1", PartSize: 16, CompletedAt: &time.Time{}},
+			part:    1,
+			body:    strings.Repeat("a", 16),
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "part number past the last part",
+			upload:  session,
+			part:    4,
+			body:    strings.Repeat("a", 8),
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "part shorter than the part size",
+			upload:  session,
+			part:    1,
+			body:    strings.Repeat("a", 8),
+			wantErr: ErrInvalidArtifactUpload,
+		},
+		{
+			name:    "last part longer than the rest of the file",
+			upload:  session,
+			part:    3,
+			body:    strings.Repeat("a", 16),
+			wantErr: ErrInvalidArtifactUpload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockArtifactRepo{}
+			mockRepo.On("GetUpload", ctx, diskID, uploadID).Return(tt.upload, nil)
+
+			_, err := NewArtifactService(mockRepo, nil, nil).UploadPart(ctx, UploadArtifactPartInput{
+				DiskID:     diskID,
+				UploadID:   uploadID,
+				PartNumber: tt.part,
+				Body:       strings.NewReader(tt.body),
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			mockRepo.AssertNotCalled(t, "UpsertUploadPart", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestArtifactService_CompleteUploadSession_MissingParts(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	uploadID := uuid.New()
+	session := &model.ArtifactUpload{ID: uploadID, DiskID: diskID, SizeB: 40, MultipartID: "mp-1", PartSize: 16}
+
+	mockRepo := &MockArtifactRepo{}
+	mockRepo.On("GetUpload", ctx, diskID, uploadID).Return(session, nil)
+	mockRepo.On("ListUploadParts", ctx, uploadID).Return([]model.ArtifactUploadPart{
+		{UploadID: uploadID, PartNumber: 2, ETag: "b", SizeB: 16},
+	}, nil)
+
+	_, err := NewArtifactService(mockRepo, nil, nil).CompleteUploadSession(ctx, FinalizeArtifactUploadInput{
+		DiskID:   diskID,
+		UploadID: uploadID,
+	})
+	assert.ErrorIs(t, err, ErrArtifactUploadIncomplete)
+	assert.Contains(t, err.Error(), "[1 3]")
+	mockRepo.AssertNotCalled(t, "FinalizeUpload", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
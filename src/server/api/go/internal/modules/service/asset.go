@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+// assetDeleteGracePeriod keeps recently referenced assets, their message or artifact may not be stored yet
+const assetDeleteGracePeriod = 10 * time.Minute
+
+var (
+	ErrAssetNotFound   = errors.New("asset not found")
+	ErrAssetReferenced = errors.New("asset is still referenced")
+)
+
+type AssetService interface {
+	List(ctx context.Context, in ListAssetsInput) (*ListAssetsOutput, error)
+	Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*AssetObject, error)
+	// Open returns the content of an asset, decrypted if it is encrypted, the caller must close it
+	Open(ctx context.Context, projectID uuid.UUID, sha256 string) (io.ReadCloser, *AssetObject, error)
+	// Stat returns an asset without its content or a presigned URL
+	Stat(ctx context.Context, projectID uuid.UUID, sha256 string) (*AssetObject, error)
+	// OpenRange returns length bytes of the content of an asset from offset, see Open
+	OpenRange(ctx context.Context, projectID uuid.UUID, sha256 string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error
+}
+
+type assetService struct {
+	r  repo.AssetReferenceRepo
+	s3 *blob.S3Deps
+}
+
+func NewAssetService(r repo.AssetReferenceRepo, s3 *blob.S3Deps) AssetService {
+	return &assetService{r: r, s3: s3}
+}
+
+type ListAssetsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+// ProjectAsset is a unique asset of a project with what references it
+type ProjectAsset struct {
+	SHA256           string      `json:"sha256"`
+	S3Key            string      `json:"s3_key"`
+	MIME             string      `json:"mime"`
+	SizeB            int64       `json:"size_b"`
+	RefCount         int         `json:"ref_count"`
+	SessionIDs       []uuid.UUID `json:"session_ids"`
+	DiskIDs          []uuid.UUID `json:"disk_ids"`
+	CreatedAt        time.Time   `json:"created_at"`
+	LastReferencedAt time.Time   `json:"last_referenced_at"`
+}
+
+type ListAssetsOutput struct {
+	Items      []ProjectAsset `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	HasMore    bool           `json:"has_more"`
+}
+
+func (s *assetService) List(ctx context.Context, in ListAssetsInput) (*ListAssetsOutput, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	refs, err := s.r.ListWithCursor(ctx, in.ProjectID, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListAssetsOutput{}
+	if len(refs) > in.Limit {
+		refs = refs[:in.Limit]
+		last := refs[len(refs)-1]
+		out.HasMore = true
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	sha256s := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		sha256s = append(sha256s, ref.SHA256)
+	}
+
+	sessionHolders, err := s.r.ListSessionHolders(ctx, in.ProjectID, sha256s)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions referencing assets: %w", err)
+	}
+	diskHolders, err := s.r.ListDiskHolders(ctx, in.ProjectID, sha256s)
+	if err != nil {
+		return nil, fmt.Errorf("list disks referencing assets: %w", err)
+	}
+	sessionIDs := groupAssetHolders(sessionHolders)
+	diskIDs := groupAssetHolders(diskHolders)
+
+	out.Items = make([]ProjectAsset, 0, len(refs))
+	for _, ref := range refs {
+		meta := ref.AssetMeta.Data()
+		item := ProjectAsset{
+			SHA256:           ref.SHA256,
+			S3Key:            ref.S3Key,
+			MIME:             meta.MIME,
+			SizeB:            meta.SizeB,
+			RefCount:         ref.RefCount,
+			SessionIDs:       sessionIDs[ref.SHA256],
+			DiskIDs:          diskIDs[ref.SHA256],
+			CreatedAt:        ref.CreatedAt,
+			LastReferencedAt: ref.LastReferencedAt,
+		}
+		if item.SessionIDs == nil {
+			item.SessionIDs = []uuid.UUID{}
+		}
+		if item.DiskIDs == nil {
+			item.DiskIDs = []uuid.UUID{}
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return out, nil
+}
+
+func groupAssetHolders(holders []repo.AssetHolder) map[string][]uuid.UUID {
+	grouped := make(map[string][]uuid.UUID)
+	for _, h := range holders {
+		grouped[h.SHA256] = append(grouped[h.SHA256], h.HolderID)
+	}
+	return grouped
+}
+
+// AssetObject is where the content of an asset can be fetched, whichever message or artifact stored it.
+// Encrypted assets have no public URL, their content is served by the API.
+type AssetObject struct {
+	SHA256    string     `json:"sha256"`
+	MIME      string     `json:"mime"`
+	SizeB     int64      `json:"size_b"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	PublicURL string     `json:"public_url,omitempty"`
+	ExpireAt  *time.Time `json:"expire_at,omitempty"`
+}
+
+func (s *assetService) get(ctx context.Context, projectID uuid.UUID, sha256 string) (string, *AssetObject, error) {
+	ref, err := s.r.Get(ctx, projectID, sha256)
+	if err != nil {
+		return "", nil, err
+	}
+	if ref == nil || ref.S3Key == "" {
+		return "", nil, ErrAssetNotFound
+	}
+	meta := ref.AssetMeta.Data()
+	return ref.S3Key, &AssetObject{
+		SHA256:    ref.SHA256,
+		MIME:      meta.MIME,
+		SizeB:     meta.SizeB,
+		Encrypted: strings.HasSuffix(ref.S3Key, blob.SealedSuffix),
+	}, nil
+}
+
+// Get resolves an asset of the project by content hash to a presigned URL of its stored object
+func (s *assetService) Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*AssetObject, error) {
+	key, obj, err := s.get(ctx, projectID, sha256)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Encrypted {
+		return obj, nil
+	}
+
+	url, err := s.s3.PresignGet(ctx, key, expire)
+	if err != nil {
+		return nil, fmt.Errorf("presign asset: %w", err)
+	}
+	expireAt := time.Now().Add(expire)
+	obj.PublicURL, obj.ExpireAt = url, &expireAt
+	return obj, nil
+}
+
+func (s *assetService) Open(ctx context.Context, projectID uuid.UUID, sha256 string) (io.ReadCloser, *AssetObject, error) {
+	key, obj, err := s.get(ctx, projectID, sha256)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := s.s3.OpenFile(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open asset: %w", err)
+	}
+	return body, obj, nil
+}
+
+func (s *assetService) Stat(ctx context.Context, projectID uuid.UUID, sha256 string) (*AssetObject, error) {
+	_, obj, err := s.get(ctx, projectID, sha256)
+	return obj, err
+}
+
+func (s *assetService) OpenRange(ctx context.Context, projectID uuid.UUID, sha256 string, offset, length int64) (io.ReadCloser, error) {
+	key, _, err := s.get(ctx, projectID, sha256)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.s3.OpenFileRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("open asset range: %w", err)
+	}
+	return body, nil
+}
+
+// Delete removes an asset whose ref count dropped to zero and that no session or disk references anymore
+func (s *assetService) Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error {
+	ref, err := s.r.Get(ctx, projectID, sha256)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return ErrAssetNotFound
+	}
+	if ref.RefCount > 0 {
+		return ErrAssetReferenced
+	}
+
+	deleted, err := s.r.DeleteIfUnreferenced(ctx, projectID, sha256, time.Now().Add(-assetDeleteGracePeriod))
+	if err != nil {
+		return fmt.Errorf("delete asset: %w", err)
+	}
+	if !deleted {
+		return ErrAssetReferenced
+	}
+	return nil
+}
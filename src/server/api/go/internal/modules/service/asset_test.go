@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestAssetService_List(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	diskID := uuid.New()
+	now := time.Now()
+
+	refs := []model.AssetReference{
+		{ID: uuid.New(), SHA256: "aaa", S3Key: "assets/a.png", RefCount: 2, CreatedAt: now,
+			AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "image/png", SizeB: 10})},
+		{ID: uuid.New(), SHA256: "bbb", S3Key: "disks/b.txt", RefCount: 1, CreatedAt: now.Add(time.Second),
+			AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "text/plain", SizeB: 20})},
+		{ID: uuid.New(), SHA256: "ccc", CreatedAt: now.Add(2 * time.Second)},
+	}
+
+	r := &MockAssetReferenceRepo{}
+	r.On("ListWithCursor", ctx, projectID, time.Time{}, uuid.Nil, 3, false).Return(refs, nil)
+	r.On("ListSessionHolders", ctx, projectID, []string{"aaa", "bbb"}).Return([]repo.AssetHolder{{SHA256: "aaa", HolderID: sessionID}}, nil)
+	r.On("ListDiskHolders", ctx, projectID, []string{"aaa", "bbb"}).Return([]repo.AssetHolder{{SHA256: "aaa", HolderID: diskID}}, nil)
+
+	out, err := NewAssetService(r, nil).List(ctx, ListAssetsInput{ProjectID: projectID, Limit: 2})
+	require.NoError(t, err)
+
+	assert.True(t, out.HasMore)
+	assert.NotEmpty(t, out.NextCursor)
+	require.Len(t, out.Items, 2)
+	assert.Equal(t, "image/png", out.Items[0].MIME)
+	assert.Equal(t, int64(10), out.Items[0].SizeB)
+	assert.Equal(t, []uuid.UUID{sessionID}, out.Items[0].SessionIDs)
+	assert.Equal(t, []uuid.UUID{diskID}, out.Items[0].DiskIDs)
+
+	// Counted but not referenced anywhere
+	assert.Equal(t, 1, out.Items[1].RefCount)
+	assert.Empty(t, out.Items[1].SessionIDs)
+	assert.NotNil(t, out.Items[1].DiskIDs)
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_Delete(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sha := "aaa"
+
+	tests := []struct {
+		name    string
+		setup   func(*MockAssetReferenceRepo)
+		wantErr error
+	}{
+		{
+			name: "unreferenced asset is deleted",
+			setup: func(r *MockAssetReferenceRepo) {
+				r.On("Get", ctx, projectID, sha).Return(&model.AssetReference{SHA256: sha}, nil)
+				r.On("DeleteIfUnreferenced", ctx, projectID, sha, mock.MatchedBy(func(before time.Time) bool {
+					return before.Before(time.Now().Add(-assetDeleteGracePeriod + time.Minute))
+				})).Return(true, nil)
+			},
+		},
+		{
+			name: "unknown asset",
+			setup: func(r *MockAssetReferenceRepo) {
+				r.On("Get", ctx, projectID, sha).Return(nil, nil)
+			},
+			wantErr: ErrAssetNotFound,
+		},
+		{
+			name: "counted asset is kept",
+			setup: func(r *MockAssetReferenceRepo) {
+				r.On("Get", ctx, projectID, sha).Return(&model.AssetReference{SHA256: sha, RefCount: 2}, nil)
+			},
+			wantErr: ErrAssetReferenced,
+		},
+		{
+			name: "referenced asset is kept",
+			setup: func(r *MockAssetReferenceRepo) {
+				r.On("Get", ctx, projectID, sha).Return(&model.AssetReference{SHA256: sha}, nil)
+				r.On("DeleteIfUnreferenced", ctx, projectID, sha, mock.Anything).Return(false, nil)
+			},
+			wantErr: ErrAssetReferenced,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &MockAssetReferenceRepo{}
+			tt.setup(r)
+
+			err := NewAssetService(r, nil).Delete(ctx, projectID, sha)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+
+	t.Run("repository error", func(t *testing.T) {
+		r := &MockAssetReferenceRepo{}
+		r.On("Get", ctx, projectID, sha).Return(nil, errors.New("database error"))
+
+		err := NewAssetService(r, nil).Delete(ctx, projectID, sha)
+		assert.Error(t, err)
+	})
+}
+
+func TestAssetService_Get_NotFound(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	r := &MockAssetReferenceRepo{}
+	r.On("Get", ctx, projectID, "aaa").Return(nil, nil)
+
+	_, err := NewAssetService(r, nil).Get(ctx, projectID, "aaa", time.Hour)
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_Get_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	r := &MockAssetReferenceRepo{}
+	r.On("Get", ctx, projectID, "aaa").Return(&model.AssetReference{
+		SHA256:    "aaa",
+		S3Key:     "assets/" + projectID.String() + "/2025/01/01/aaa.png.sealed",
+		AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "image/png", SizeB: 10, Encrypted: true}),
+	}, nil)
+
+	// encrypted assets are not presigned, the service has no S3 to call here
+	obj, err := NewAssetService(r, nil).Get(ctx, projectID, "aaa", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, obj.Encrypted)
+	assert.Empty(t, obj.PublicURL)
+	assert.Nil(t, obj.ExpireAt)
+	assert.Equal(t, "image/png", obj.MIME)
+	r.AssertExpectations(t)
+}
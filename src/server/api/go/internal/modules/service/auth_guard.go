@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+const (
+	// Redis key prefixes of failed authentication counters and lockouts
+	redisKeyPrefixAuthFailures = "auth:failures:"
+	redisKeyPrefixAuthLockout  = "auth:lockout:"
+	redisKeyPrefixAuthMisuse   = "auth:misuse:"
+	redisKeyPrefixAuthAudited  = "auth:audited:"
+
+	// authTokenPrefixLen is how much of a presented token is kept to identify it, never enough to use it
+	authTokenPrefixLen = 10
+	// maxLocalAuthCounters bounds the in-memory counters, expired ones are dropped when it is full
+	maxLocalAuthCounters = 10000
+)
+
+// AuthGuardService locks out IPs and tokens failing authentication too often,
+// and records failures, lockouts and misuse of valid keys in the auth audit log.
+// Failures and misuse are recorded once per failure window and IP, a client retrying does not write a row per request.
+type AuthGuardService interface {
+	// Locked reports whether the IP or the presented token is locked out, and for how long
+	Locked(ctx context.Context, ip, token string) (time.Duration, bool)
+	// RecordFailure records a presented token that failed verification, token is empty when none was presented.
+	// Only failed verifications count towards lockouts, a request without a token is audited only.
+	RecordFailure(ctx context.Context, ip, token, reason string)
+	// RecordMisuse records a valid key of the project used against its rules, e.g. from a denied IP,
+	// and notifies the project, once per failure window and IP
+	RecordMisuse(ctx context.Context, project *model.Project, ip, tokenPrefix, reason string)
+}
+
+type authGuardService struct {
+	r        repo.AuthEventRepo
+	notifier NotificationService
+	redis    *redis.Client
+	log      *zap.Logger
+
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+
+	// counters and lockouts when Redis is unavailable, keyed like in Redis
+	mu    sync.Mutex
+	local map[string]localAuthCounter
+}
+
+type localAuthCounter struct {
+	n     int64
+	until time.Time
+}
+
+func NewAuthGuardService(r repo.AuthEventRepo, notifier NotificationService, rdb *redis.Client, cfg *config.Config, log *zap.Logger) AuthGuardService {
+	s := &authGuardService{
+		r:        r,
+		notifier: notifier,
+		redis:    rdb,
+		log:      log,
+		window:   5 * time.Minute,
+		lockout:  15 * time.Minute,
+		local:    map[string]localAuthCounter{},
+	}
+	if cfg != nil {
+		s.maxFailures = cfg.Auth.MaxFailures
+		if cfg.Auth.FailureWindowSec > 0 {
+			s.window = time.Duration(cfg.Auth.FailureWindowSec) * time.Second
+		}
+		if cfg.Auth.LockoutSec > 0 {
+			s.lockout = time.Duration(cfg.Auth.LockoutSec) * time.Second
+		}
+	}
+	return s
+}
+
+// AuthTokenPrefix returns the part of a presented token kept in the audit log
+func AuthTokenPrefix(token string) string {
+	if len(token) > authTokenPrefixLen {
+		return token[:authTokenPrefixLen]
+	}
+	return token
+}
+
+// authSubjects are the counter keys of an IP and a token, a missing token is not tracked. Tokens are keyed by a
+// hash of the whole token: keys share their prefix, so failures of one must not lock out the others.
+func authSubjects(ip, token string) []string {
+	subjects := []string{"ip:" + ip}
+	if token != "" {
+		sum := sha256.Sum256([]byte(token))
+		subjects = append(subjects, "token:"+hex.EncodeToString(sum[:16]))
+	}
+	return subjects
+}
+
+func (s *authGuardService) Locked(ctx context.Context, ip, token string) (time.Duration, bool) {
+	if s.maxFailures <= 0 {
+		return 0, false
+	}
+	var longest time.Duration
+	for _, subject := range authSubjects(ip, token) {
+		if ttl, ok := s.ttl(ctx, redisKeyPrefixAuthLockout+subject); ok && ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, longest > 0
+}
+
+func (s *authGuardService) RecordFailure(ctx context.Context, ip, token, reason string) {
+	tokenPrefix := AuthTokenPrefix(token)
+	if s.incr(ctx, redisKeyPrefixAuthAudited+"ip:"+ip, s.window) == 1 {
+		s.audit(ctx, &model.AuthEvent{Kind: model.AuthEventFailure, IP: ip, TokenPrefix: tokenPrefix, Reason: reason})
+	}
+	if s.maxFailures <= 0 || token == "" {
+		return
+	}
+
+	for _, subject := range authSubjects(ip, token) {
+		n := s.incr(ctx, redisKeyPrefixAuthFailures+subject, s.window)
+		if n < int64(s.maxFailures) {
+			continue
+		}
+		s.set(ctx, redisKeyPrefixAuthLockout+subject, s.lockout)
+		s.del(ctx, redisKeyPrefixAuthFailures+subject)
+		s.log.Warn("authentication locked out after repeated failures",
+			zap.String("subject", subject), zap.Int64("failures", n), zap.Duration("lockout", s.lockout))
+		s.audit(ctx, &model.AuthEvent{
+			Kind:        model.AuthEventLockout,
+			IP:          ip,
+			TokenPrefix: tokenPrefix,
+			Reason:      fmt.Sprintf("%d failed authentications of %s within %s", n, subject, s.window),
+		})
+	}
+}
+
+func (s *authGuardService) RecordMisuse(ctx context.Context, project *model.Project, ip, tokenPrefix, reason string) {
+	// a misused key is usually retried, only the first use of the window is recorded and notified
+	if s.incr(ctx, redisKeyPrefixAuthMisuse+project.ID.String()+":"+ip, s.window) > 1 {
+		return
+	}
+	s.audit(ctx, &model.AuthEvent{Kind: model.AuthEventMisuse, IP: ip, TokenPrefix: tokenPrefix, ProjectID: &project.ID, Reason: reason})
+	if s.notifier == nil {
+		return
+	}
+	s.log.Warn("project key misused", zap.String("project_id", project.ID.String()), zap.String("ip", ip), zap.String("reason", reason))
+	if err := s.notifier.Notify(ctx, project, &model.Notification{
+		Kind:  model.NotificationKindTokenMisuse,
+		Title: fmt.Sprintf("Project key used from %s: %s", ip, reason),
+		Data: datatypes.JSONMap{
+			"ip":           ip,
+			"token_prefix": tokenPrefix,
+			"reason":       reason,
+		},
+	}); err != nil {
+		s.log.Warn("failed to notify token misuse", zap.String("project_id", project.ID.String()), zap.Error(err))
+	}
+}
+
+func (s *authGuardService) audit(ctx context.Context, e *model.AuthEvent) {
+	if s.r == nil {
+		return
+	}
+	if err := s.r.Create(ctx, e); err != nil {
+		s.log.Warn("failed to record auth event", zap.String("kind", e.Kind), zap.Error(err))
+	}
+}
+
+// incr counts an event of key within ttl, falling back to memory when Redis fails
+func (s *authGuardService) incr(ctx context.Context, key string, ttl time.Duration) int64 {
+	if s.redis != nil {
+		n, err := s.redis.Incr(ctx, key).Result()
+		if err == nil {
+			if n == 1 {
+				s.redis.Expire(ctx, key, ttl)
+			}
+			return n
+		}
+		s.log.Warn("failed to count auth event in Redis", zap.String("key", key), zap.Error(err))
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	c := s.local[key]
+	if !now.Before(c.until) {
+		c = localAuthCounter{until: now.Add(ttl)}
+	}
+	c.n++
+	s.local[key] = c
+	return c.n
+}
+
+func (s *authGuardService) set(ctx context.Context, key string, ttl time.Duration) {
+	if s.redis != nil {
+		err := s.redis.Set(ctx, key, 1, ttl).Err()
+		if err == nil {
+			return
+		}
+		s.log.Warn("failed to store auth lockout in Redis", zap.String("key", key), zap.Error(err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.local[key] = localAuthCounter{n: 1, until: time.Now().Add(ttl)}
+}
+
+func (s *authGuardService) del(ctx context.Context, key string) {
+	if s.redis != nil {
+		s.redis.Del(ctx, key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.local, key)
+}
+
+// ttl returns how long key is still set
+func (s *authGuardService) ttl(ctx context.Context, key string) (time.Duration, bool) {
+	if s.redis != nil {
+		if ttl, err := s.redis.PTTL(ctx, key).Result(); err == nil {
+			if ttl > 0 {
+				return ttl, true
+			}
+		} else {
+			s.log.Warn("failed to get auth lockout from Redis", zap.String("key", key), zap.Error(err))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.local[key]
+	if !ok {
+		return 0, false
+	}
+	ttl := time.Until(c.until)
+	return ttl, ttl > 0
+}
+
+// sweep drops expired local counters, called with mu held
+func (s *authGuardService) sweep(now time.Time) {
+	if len(s.local) < maxLocalAuthCounters {
+		return
+	}
+	for k, c := range s.local {
+		if !now.Before(c.until) {
+			delete(s.local, k)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeAuthEventRepo struct {
+	events []*model.AuthEvent
+}
+
+func (r *fakeAuthEventRepo) Create(ctx context.Context, e *model.AuthEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *fakeAuthEventRepo) kinds() []string {
+	kinds := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestAuthTokenPrefix(t *testing.T) {
+	assert.Equal(t, "sk-ac-abcd", AuthTokenPrefix("sk-ac-abcdefghijkl"))
+	assert.Equal(t, "short", AuthTokenPrefix("short"))
+}
+
+func TestAuthGuardService_Lockout(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Auth: config.AuthCfg{MaxFailures: 3, FailureWindowSec: 60, LockoutSec: 120}}
+
+	t.Run("locks out the IP after max failures", func(t *testing.T) {
+		r := &fakeAuthEventRepo{}
+		svc := NewAuthGuardService(r, nil, nil, cfg, zap.NewNop())
+
+		for _, token := range []string{"sk-ac-guess1", "sk-ac-guess2"} {
+			svc.RecordFailure(ctx, "10.0.0.1", token, "secret mismatch")
+		}
+		_, locked := svc.Locked(ctx, "10.0.0.1", "")
+		assert.False(t, locked)
+
+		svc.RecordFailure(ctx, "10.0.0.1", "sk-ac-guess3", "secret mismatch")
+		retryAfter, locked := svc.Locked(ctx, "10.0.0.1", "")
+		assert.True(t, locked)
+		assert.InDelta(t, 120, retryAfter.Seconds(), 1)
+		// one failure row per window and IP
+		assert.Equal(t, []string{model.AuthEventFailure, model.AuthEventLockout}, r.kinds())
+
+		_, locked = svc.Locked(ctx, "10.0.0.2", "")
+		assert.False(t, locked)
+	})
+
+	t.Run("locks out a token tried from many IPs", func(t *testing.T) {
+		r := &fakeAuthEventRepo{}
+		svc := NewAuthGuardService(r, nil, nil, cfg, zap.NewNop())
+
+		for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+			svc.RecordFailure(ctx, ip, "sk-ac-abcdefgh", "secret mismatch")
+		}
+		_, locked := svc.Locked(ctx, "10.0.0.4", "sk-ac-abcdefgh")
+		assert.True(t, locked)
+		// another key with the same prefix is not locked out
+		_, locked = svc.Locked(ctx, "10.0.0.4", "sk-ac-abcdwxyz")
+		assert.False(t, locked)
+		assert.Equal(t, "sk-ac-abcd", r.events[0].TokenPrefix)
+	})
+
+	t.Run("requests without a token do not count", func(t *testing.T) {
+		r := &fakeAuthEventRepo{}
+		svc := NewAuthGuardService(r, nil, nil, cfg, zap.NewNop())
+
+		for range 5 {
+			svc.RecordFailure(ctx, "10.0.0.1", "", "missing bearer token")
+		}
+		_, locked := svc.Locked(ctx, "10.0.0.1", "")
+		assert.False(t, locked)
+		assert.Len(t, r.events, 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		r := &fakeAuthEventRepo{}
+		svc := NewAuthGuardService(r, nil, nil, &config.Config{}, zap.NewNop())
+
+		for range 20 {
+			svc.RecordFailure(ctx, "10.0.0.1", "", "missing bearer token")
+		}
+		_, locked := svc.Locked(ctx, "10.0.0.1", "")
+		assert.False(t, locked)
+		assert.Len(t, r.events, 1)
+
+		svc.RecordFailure(ctx, "10.0.0.2", "", "missing bearer token")
+		assert.Len(t, r.events, 2)
+	})
+}
+
+func TestAuthGuardService_RecordMisuse(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeAuthEventRepo{}
+	notifications := &fakeNotificationRepo{}
+	notifier := NewNotificationService(notifications, &fakeProjectRepo{}, &config.Config{}, zap.NewNop())
+	svc := NewAuthGuardService(r, notifier, nil, &config.Config{}, zap.NewNop())
+	project := &model.Project{ID: uuid.New()}
+
+	svc.RecordMisuse(ctx, project, "10.0.0.1", "sk-ac-abcd", "client IP denied by network access rules")
+	svc.RecordMisuse(ctx, project, "10.0.0.1", "sk-ac-abcd", "client IP denied by network access rules")
+	svc.RecordMisuse(ctx, project, "10.0.0.2", "sk-ac-abcd", "client IP denied by network access rules")
+
+	// one row and notification per IP within the window
+	require.Len(t, r.events, 2)
+	assert.Equal(t, model.AuthEventMisuse, r.events[0].Kind)
+	assert.Equal(t, project.ID, *r.events[0].ProjectID)
+
+	require.Len(t, notifications.created, 2)
+	assert.Equal(t, model.NotificationKindTokenMisuse, notifications.created[0].Kind)
+	assert.Equal(t, "10.0.0.2", notifications.created[1].Data["ip"])
+	assert.WithinDuration(t, time.Now(), notifications.created[0].CreatedAt, time.Minute)
+}
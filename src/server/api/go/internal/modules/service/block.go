@@ -3,10 +3,17 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
 
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type BlockService interface {
@@ -18,24 +25,57 @@ type BlockService interface {
 
 	// Properties - unified methods
 	GetBlockProperties(ctx context.Context, blockID uuid.UUID) (*model.Block, error)
+	// UpdateBlockProperties updates the title and props; with b.Version set, only if the block still has this version
 	UpdateBlockProperties(ctx context.Context, b *model.Block) error
+	BulkGet(ctx context.Context, spaceID uuid.UUID, blockIDs []uuid.UUID) (*BulkGetBlocksOutput, error)
 
 	// List - unified method with optional filters
 	List(ctx context.Context, spaceID uuid.UUID, blockType string, parentID *uuid.UUID) ([]model.Block, error)
 
+	// Tree - a block with its descendants nested up to a depth
+	Tree(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID, depth int) (*BlockTreeNode, error)
+
 	// Move - unified method, handles special logic for folder path
 	Move(ctx context.Context, blockID uuid.UUID, newParentID *uuid.UUID, targetSort *int64) error
 
 	// Sort - unified method
 	UpdateSort(ctx context.Context, blockID uuid.UUID, sort int64) error
+
+	// ReorderChildren - rewrites the sorts of all children of a block at once
+	ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, childIDs []uuid.UUID) error
+
+	// Duplicate - copies a block, with its descendants when deep, to the end of a parent
+	Duplicate(ctx context.Context, in DuplicateBlockInput) (*model.Block, error)
+
+	// GetPageBySlug - resolves the permalink of a page
+	GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error)
+
+	// Backlinks - the reference blocks pointing at a block
+	Backlinks(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID) ([]model.Block, error)
+
+	// RenderPage - serializes a page and its content blocks as one Markdown or HTML document
+	RenderPage(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID, format string) (string, error)
 }
 
-type blockService struct{ r repo.BlockRepo }
+type blockService struct {
+	r         repo.BlockRepo
+	publisher *mq.Publisher
+	cfg       *config.Config
+	log       *zap.Logger
+	// limits bounds the children of the blocks written by copies, nil disables it
+	limits EntityLimitService
+}
 
-func NewBlockService(r repo.BlockRepo) BlockService { return &blockService{r: r} }
+func NewBlockService(r repo.BlockRepo, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger, limits EntityLimitService) BlockService {
+	return &blockService{r: r, publisher: publisher, cfg: cfg, log: log, limits: limits}
+}
 
 // validateAndPrepareCreate validates a block for creation and prepares its parent
 func (s *blockService) validateAndPrepareCreate(ctx context.Context, b *model.Block) (*model.Block, error) {
+	// Props first, so invalid props are told apart with ErrInvalidBlockProps
+	if err := ValidateBlockProps(b); err != nil {
+		return nil, err
+	}
 	if err := b.Validate(); err != nil {
 		return nil, err
 	}
@@ -55,6 +95,9 @@ func (s *blockService) validateAndPrepareCreate(ctx context.Context, b *model.Bl
 	if err := b.ValidateParentType(parent); err != nil {
 		return nil, err
 	}
+	if err := s.validateReference(ctx, b); err != nil {
+		return nil, err
+	}
 
 	return parent, nil
 }
@@ -91,12 +134,20 @@ func (s *blockService) Create(ctx context.Context, b *model.Block) error {
 		}
 		b.SetFolderPath(path)
 	}
+	// Pages get a permalink from their title, made unique in the space when written
+	if b.Type == model.BlockTypePage {
+		b.Slug = pageSlug(b.Title)
+	}
 
 	if err := s.prepareBlockForCreation(ctx, b); err != nil {
 		return err
 	}
 
-	return s.r.Create(ctx, b)
+	if err := s.r.Create(ctx, b); err != nil {
+		return err
+	}
+	publishBlockEmbeddings(ctx, s.publisher, s.cfg, s.log, b.SpaceID, []uuid.UUID{b.ID})
+	return nil
 }
 
 // isDescendant checks if candidateID is a descendant of ancestorID in the tree
@@ -191,12 +242,109 @@ func (s *blockService) GetBlockProperties(ctx context.Context, blockID uuid.UUID
 	return s.r.Get(ctx, blockID)
 }
 
+type BulkGetBlocksOutput struct {
+	// Blocks follow the order of the requested IDs, without duplicates
+	Blocks []model.Block `json:"blocks"`
+	// Missing are the requested IDs that are not blocks of the space
+	Missing []uuid.UUID `json:"missing"`
+}
+
+// BulkGet - get several blocks of a space in one query
+func (s *blockService) BulkGet(ctx context.Context, spaceID uuid.UUID, blockIDs []uuid.UUID) (*BulkGetBlocksOutput, error) {
+	if len(spaceID) == 0 {
+		return nil, errors.New("space id is empty")
+	}
+
+	ids := make([]uuid.UUID, 0, len(blockIDs))
+	seen := make(map[uuid.UUID]bool, len(blockIDs))
+	for _, id := range blockIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	out := &BulkGetBlocksOutput{Blocks: []model.Block{}, Missing: []uuid.UUID{}}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	list, err := s.r.ListByIDs(ctx, spaceID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]model.Block, len(list))
+	for _, b := range list {
+		byID[b.ID] = b
+	}
+	for _, id := range ids {
+		if b, ok := byID[id]; ok {
+			out.Blocks = append(out.Blocks, b)
+		} else {
+			out.Missing = append(out.Missing, id)
+		}
+	}
+	return out, nil
+}
+
 // UpdateBlockProperties - unified update properties method
 func (s *blockService) UpdateBlockProperties(ctx context.Context, b *model.Block) error {
 	if len(b.ID) == 0 {
 		return errors.New("block id is empty")
 	}
-	return s.r.Update(ctx, b)
+
+	current, err := s.r.Get(ctx, b.ID)
+	if err != nil {
+		return err
+	}
+	if b.Version != 0 && b.Version != current.Version {
+		return ErrBlockVersionConflict
+	}
+	// The props replace the current ones and must suit the type of the block
+	if b.Props.Data() != nil {
+		next := &model.Block{ID: current.ID, SpaceID: current.SpaceID, Type: current.Type, Props: b.Props}
+		if err := ValidateBlockProps(next); err != nil {
+			return err
+		}
+		if err := s.validateReference(ctx, next); err != nil {
+			return err
+		}
+		// The repository moves the reference along with the props
+		if current.Type == model.BlockTypeReference {
+			b.Type = current.Type
+		}
+	}
+	// The version is checked again as the block is written, it may have changed since it was read
+	if b.Version != 0 {
+		err = s.r.UpdateAtVersion(ctx, b, b.Version)
+	} else {
+		err = s.r.Update(ctx, b)
+	}
+	if err != nil {
+		return err
+	}
+	// The title and props are what a block is embedded from
+	publishBlockEmbeddings(ctx, s.publisher, s.cfg, s.log, current.SpaceID, []uuid.UUID{b.ID})
+	return nil
+}
+
+// maxTableBlockRows is the largest number of rows of a table block
+const maxTableBlockRows = 1000
+
+var ErrInvalidBlockProps = errors.New("invalid block props")
+
+// ValidateBlockProps checks the props of a block against its type, see model.Block.ValidateProps, and the limits
+// of the server on them
+func ValidateBlockProps(b *model.Block) error {
+	if err := b.ValidateProps(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBlockProps, err)
+	}
+	if b.Type == model.BlockTypeTable {
+		if rows, _ := b.Props.Data()["rows"].([]any); len(rows) > maxTableBlockRows {
+			return fmt.Errorf("%w: a table has at most %d rows", ErrInvalidBlockProps, maxTableBlockRows)
+		}
+	}
+	return nil
 }
 
 // List - unified list method with optional type and parent_id filters
@@ -207,6 +355,83 @@ func (s *blockService) List(ctx context.Context, spaceID uuid.UUID, blockType st
 	return s.r.ListBySpace(ctx, spaceID, blockType, parentID)
 }
 
+// Depths of a block tree
+const (
+	defaultBlockTreeDepth = 3
+	maxBlockTreeDepth     = 10
+)
+
+var (
+	ErrBlockNotFound        = errors.New("block not found")
+	ErrBlockVersionConflict = repo.ErrBlockVersionConflict
+	ErrInvalidChildrenOrder = repo.ErrChildrenOrderMismatch
+)
+
+// BlockTreeNode is a block with its children, in the order of List
+type BlockTreeNode struct {
+	*model.Block
+	Children []*BlockTreeNode `json:"children"`
+	// HasMore is set on the blocks at the depth of the tree that have children, fetch their own tree to go deeper
+	HasMore bool `json:"has_more"`
+}
+
+// Tree returns a block of the space with its descendants nested depth levels deep, reading one level per query
+func (s *blockService) Tree(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID, depth int) (*BlockTreeNode, error) {
+	root, err := s.r.Get(ctx, blockID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBlockNotFound
+		}
+		return nil, err
+	}
+	if root.SpaceID != spaceID {
+		return nil, ErrBlockNotFound
+	}
+	if depth <= 0 {
+		depth = defaultBlockTreeDepth
+	}
+	depth = min(depth, maxBlockTreeDepth)
+
+	tree := &BlockTreeNode{Block: root, Children: []*BlockTreeNode{}}
+	level := map[uuid.UUID]*BlockTreeNode{root.ID: tree}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		children, err := s.r.ListChildren(ctx, spaceID, parentIDs(level))
+		if err != nil {
+			return nil, err
+		}
+		next := make(map[uuid.UUID]*BlockTreeNode)
+		for i := range children {
+			n := &BlockTreeNode{Block: &children[i], Children: []*BlockTreeNode{}}
+			parent := level[*children[i].ParentID]
+			parent.Children = append(parent.Children, n)
+			if children[i].CanHaveChildren() {
+				next[children[i].ID] = n
+			}
+		}
+		level = next
+	}
+
+	// The blocks at the depth of the tree were not expanded
+	if len(level) > 0 {
+		ids, err := s.r.ParentsWithChildren(ctx, spaceID, parentIDs(level))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			level[id].HasMore = true
+		}
+	}
+	return tree, nil
+}
+
+func parentIDs(level map[uuid.UUID]*BlockTreeNode) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(level))
+	for id := range level {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // Move - unified move method for all block types
 func (s *blockService) Move(ctx context.Context, blockID uuid.UUID, newParentID *uuid.UUID, targetSort *int64) error {
 	block, parent, err := s.validateAndPrepareMove(ctx, blockID, newParentID)
@@ -244,3 +469,229 @@ func (s *blockService) UpdateSort(ctx context.Context, blockID uuid.UUID, sort i
 	}
 	return s.r.ReorderWithinGroup(ctx, blockID, sort)
 }
+
+// ReorderChildren orders the children of a block of the space as childIDs, which lists every child once. The
+// children get the sorts 0, 1, 2... in one transaction, so siblings never collide on the unique sort of their parent.
+func (s *blockService) ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, childIDs []uuid.UUID) error {
+	parent, err := s.r.Get(ctx, parentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBlockNotFound
+		}
+		return err
+	}
+	if parent.SpaceID != spaceID {
+		return ErrBlockNotFound
+	}
+	return s.r.ReorderChildren(ctx, spaceID, parentID, childIDs)
+}
+
+// maxDuplicateBlocks is the largest number of blocks copied by a deep Duplicate
+const maxDuplicateBlocks = 5000
+
+var (
+	ErrInvalidDuplicateParent = errors.New("invalid parent for the copy")
+	ErrDuplicateTooLarge      = fmt.Errorf("a block with more than %d descendants cannot be duplicated", maxDuplicateBlocks-1)
+	ErrCopyReferenceOutside   = errors.New("a reference block copied to another space must reference a block copied with it")
+)
+
+type DuplicateBlockInput struct {
+	SpaceID uuid.UUID
+	BlockID uuid.UUID
+	// ParentID is the parent of the copy, nil keeps the parent of the block, or puts the copy at the root of
+	// TargetSpaceID
+	ParentID *uuid.UUID
+	// Deep copies the descendants of the block too, archived ones included
+	Deep bool
+	// TargetSpaceID is the space of the copy, the space of the block when zero. Both spaces must be of ProjectID.
+	TargetSpaceID uuid.UUID
+	ProjectID     uuid.UUID
+}
+
+// Duplicate copies a block of the space to the end of the blocks of its parent, or of ParentID, and returns the copy.
+// Copies get new IDs; the descendants keep their order under their copied parent and folder paths follow the new
+// parent. All copies are written in one transaction. A copy to another space keeps its references within the copy:
+// they point at the copies of their targets, and a reference to a block that is not copied is refused.
+// A copy taking the parent, or a copied block, over the hard children limit is refused with a *LimitExceededError.
+func (s *blockService) Duplicate(ctx context.Context, in DuplicateBlockInput) (*model.Block, error) {
+	src, err := s.r.Get(ctx, in.BlockID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBlockNotFound
+		}
+		return nil, err
+	}
+	if src.SpaceID != in.SpaceID {
+		return nil, ErrBlockNotFound
+	}
+
+	spaceID := in.SpaceID
+	parentID := src.ParentID
+	if in.TargetSpaceID != uuid.Nil && in.TargetSpaceID != in.SpaceID {
+		if err := s.checkCopySpaces(ctx, in); err != nil {
+			return nil, err
+		}
+		spaceID = in.TargetSpaceID
+		parentID = nil
+	}
+	if in.ParentID != nil {
+		parentID = in.ParentID
+	}
+	var parent *model.Block
+	if parentID != nil {
+		parent, err = s.r.Get(ctx, *parentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: parent not found", ErrInvalidDuplicateParent)
+			}
+			return nil, err
+		}
+		if parent.SpaceID != spaceID {
+			return nil, fmt.Errorf("%w: parent not found", ErrInvalidDuplicateParent)
+		}
+	}
+	if err := src.ValidateParentType(parent); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDuplicateParent, err)
+	}
+
+	ids := map[uuid.UUID]uuid.UUID{src.ID: uuid.New()}
+	copies := []model.Block{duplicateBlock(src, ids[src.ID], spaceID, parentID, parent)}
+	sops := duplicateToolSOPs(src, ids[src.ID])
+	if in.Deep && src.CanHaveChildren() {
+		// The subtree is read level by level before anything is written, so a copy under the block itself does not
+		// copy itself. Parents are copied before their children, so the folder path of a copied parent is known.
+		index := map[uuid.UUID]int{ids[src.ID]: 0}
+		level := []uuid.UUID{src.ID}
+		for len(level) > 0 {
+			children, err := s.r.ListChildren(ctx, in.SpaceID, level)
+			if err != nil {
+				return nil, err
+			}
+			if len(copies)+len(children) > maxDuplicateBlocks {
+				return nil, ErrDuplicateTooLarge
+			}
+			level = level[:0]
+			for i := range children {
+				child := &children[i]
+				id := uuid.New()
+				ids[child.ID] = id
+				copyParentID := ids[*child.ParentID]
+				copies = append(copies, duplicateBlock(child, id, spaceID, &copyParentID, &copies[index[copyParentID]]))
+				index[id] = len(copies) - 1
+				sops = append(sops, duplicateToolSOPs(child, id)...)
+				if child.CanHaveChildren() {
+					level = append(level, child.ID)
+				}
+			}
+		}
+	}
+
+	if spaceID != in.SpaceID {
+		if err := remapCopyReferences(copies, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkBlockWrite(ctx, s.limits, parentID, copies); err != nil {
+		return nil, err
+	}
+	if err := s.r.CreateCopies(ctx, copies, sops); err != nil {
+		return nil, err
+	}
+
+	copied := make([]uuid.UUID, 0, len(copies))
+	for _, b := range copies {
+		copied = append(copied, b.ID)
+	}
+	publishBlockEmbeddings(ctx, s.publisher, s.cfg, s.log, spaceID, copied)
+	return &copies[0], nil
+}
+
+// checkCopySpaces checks that the space of the block and the target space of a copy are both of the project
+func (s *blockService) checkCopySpaces(ctx context.Context, in DuplicateBlockInput) error {
+	projectID, err := s.r.SpaceProjectID(ctx, in.SpaceID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil || projectID != in.ProjectID {
+		return ErrBlockNotFound
+	}
+	projectID, err = s.r.SpaceProjectID(ctx, in.TargetSpaceID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil || projectID != in.ProjectID {
+		return fmt.Errorf("%w: target space not found", ErrInvalidDuplicateParent)
+	}
+	return nil
+}
+
+// remapCopyReferences points the reference blocks among copies at the copies of their targets, ids maps a block to
+// its copy
+func remapCopyReferences(copies []model.Block, ids map[uuid.UUID]uuid.UUID) error {
+	for i := range copies {
+		target, ok := copies[i].ReferenceBlockID()
+		if !ok {
+			continue
+		}
+		id, ok := ids[target]
+		if !ok {
+			return fmt.Errorf("%w: %q references %s", ErrCopyReferenceOutside, copies[i].Title, target)
+		}
+		props := copies[i].Props.Data()
+		props["reference_block_id"] = id.String()
+		copies[i].Props = datatypes.NewJSONType(props)
+	}
+	return nil
+}
+
+// duplicateBlock returns a copy of b with a new ID under parentID of the space. The sort of the copy is set when it
+// is written, as is the slug of a copied page, made from its title.
+func duplicateBlock(b *model.Block, id uuid.UUID, spaceID uuid.UUID, parentID *uuid.UUID, parent *model.Block) model.Block {
+	props := maps.Clone(b.Props.Data())
+	if props == nil {
+		props = map[string]any{}
+	}
+	// The SOP steps are read into the props, they are copied as steps
+	if b.Type == model.BlockTypeSOP && len(b.ToolSOPs) > 0 {
+		delete(props, "tool_sops")
+	}
+	cp := model.Block{
+		ID:             id,
+		SpaceID:        spaceID,
+		Type:           b.Type,
+		ParentID:       parentID,
+		Title:          b.Title,
+		Props:          datatypes.NewJSONType(props),
+		Sort:           b.Sort,
+		IsArchived:     b.IsArchived,
+		LastVerifiedAt: b.LastVerifiedAt,
+	}
+	if cp.Type == model.BlockTypePage {
+		cp.Slug = pageSlug(cp.Title)
+	}
+	if cp.Type == model.BlockTypeFolder {
+		path := cp.Title
+		if parent != nil {
+			if parentPath := parent.GetFolderPath(); parentPath != "" {
+				path = parentPath + "/" + cp.Title
+			}
+		}
+		cp.SetFolderPath(path)
+	}
+	return cp
+}
+
+func duplicateToolSOPs(b *model.Block, id uuid.UUID) []model.ToolSOP {
+	sops := make([]model.ToolSOP, 0, len(b.ToolSOPs))
+	for _, sop := range b.ToolSOPs {
+		sops = append(sops, model.ToolSOP{
+			Order:           sop.Order,
+			Action:          sop.Action,
+			ToolReferenceID: sop.ToolReferenceID,
+			SOPBlockID:      id,
+			Props:           sop.Props,
+		})
+	}
+	return sops
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"go.uber.org/zap"
+)
+
+// blockEmbeddingBatch is the largest number of blocks of one BlockEmbeddingMQPublishJSON
+const blockEmbeddingBatch = 100
+
+// BlockEmbeddingMQPublishJSON is published after blocks are created or changed by the API, so core (re-)embeds
+// them for semantic search
+type BlockEmbeddingMQPublishJSON struct {
+	SpaceID  uuid.UUID   `json:"space_id"`
+	BlockIDs []uuid.UUID `json:"block_ids"`
+}
+
+// publishBlockEmbeddings queues the embedding of blocks of a space in batches. The blocks are already written, so a
+// failed publish is only logged: they stay without embedding, or with their previous one, until written again.
+func publishBlockEmbeddings(ctx context.Context, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger, spaceID uuid.UUID, blockIDs []uuid.UUID) {
+	if publisher == nil {
+		return
+	}
+	for start := 0; start < len(blockIDs); start += blockEmbeddingBatch {
+		batch := blockIDs[start:min(start+blockEmbeddingBatch, len(blockIDs))]
+		if err := publisher.PublishJSON(ctx, cfg.RabbitMQ.ExchangeName.Embedding, cfg.RabbitMQ.RoutingKey.EmbeddingBlockUpsert, BlockEmbeddingMQPublishJSON{
+			SpaceID:  spaceID,
+			BlockIDs: batch,
+		}); err != nil {
+			log.Error("publish block embedding", zap.String("space_id", spaceID.String()), zap.Error(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Types of block events
+const (
+	BlockEventCreated = "created"
+	BlockEventUpdated = "updated"
+	BlockEventMoved   = "moved"
+	BlockEventDeleted = "deleted"
+)
+
+var ErrInvalidBlockWebhook = ErrInvalidNotificationWebhook
+
+// BlockEventMQPublishJSON is published after a block or page was created, updated, moved or deleted, by the API, by
+// the core or along with its parent, so indexers and UIs follow the changes without polling. The changes a transaction
+// made to a block are one event. Before is empty for created and After for deleted.
+type BlockEventMQPublishJSON struct {
+	// ID tells apart events delivered twice
+	ID         uuid.UUID    `json:"id"`
+	Type       string       `json:"type"`
+	SpaceID    uuid.UUID    `json:"space_id"`
+	BlockID    uuid.UUID    `json:"block_id"`
+	Before     *model.Block `json:"before"`
+	After      *model.Block `json:"after"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// blockEventRelayBatch is about the number of outbox rows relayed per transaction
+const blockEventRelayBatch = 500
+
+// BlockEventRelayLockKey is the advisory lock key that keeps Relay to one instance at a time, so events keep their order
+const BlockEventRelayLockKey int64 = 0x61637478_626c6b65
+
+// blockEvents tells the changes recorded in the outbox as events, one per block changed in a transaction, in the order
+// of their first change. A block created and deleted in the same transaction has no event.
+func blockEvents(rows []model.BlockEventRow) ([]BlockEventMQPublishJSON, error) {
+	type change struct{ first, last *model.BlockEventRow }
+	type key struct {
+		txID    int64
+		blockID uuid.UUID
+	}
+	changes := map[key]*change{}
+	var order []key
+	for i := range rows {
+		k := key{rows[i].TxID, rows[i].BlockID}
+		if c, ok := changes[k]; ok {
+			c.last = &rows[i]
+			continue
+		}
+		changes[k] = &change{first: &rows[i], last: &rows[i]}
+		order = append(order, k)
+	}
+
+	events := make([]BlockEventMQPublishJSON, 0, len(order))
+	for _, k := range order {
+		c := changes[k]
+		before, err := blockEventRow(c.first.OldRow)
+		if err != nil {
+			return nil, err
+		}
+		after, err := blockEventRow(c.last.NewRow)
+		if err != nil {
+			return nil, err
+		}
+
+		ev := BlockEventMQPublishJSON{
+			// The ID stays the same when the rows are relayed again
+			ID:         uuid.NewSHA1(uuid.NameSpaceOID, []byte("block_event:"+strconv.FormatInt(c.first.ID, 10))),
+			BlockID:    k.blockID,
+			Before:     before,
+			After:      after,
+			OccurredAt: c.last.CreatedAt.UTC(),
+		}
+		switch {
+		case before == nil && after == nil:
+			continue
+		case before == nil:
+			ev.Type, ev.SpaceID = BlockEventCreated, after.SpaceID
+		case after == nil:
+			ev.Type, ev.SpaceID = BlockEventDeleted, before.SpaceID
+		case before.SpaceID != after.SpaceID || !equalParent(before.ParentID, after.ParentID) || before.Sort != after.Sort:
+			ev.Type, ev.SpaceID = BlockEventMoved, after.SpaceID
+		default:
+			ev.Type, ev.SpaceID = BlockEventUpdated, after.SpaceID
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// blockEventRow reads a row of blocks recorded in the outbox, nil when there is none
+func blockEventRow(row datatypes.JSON) (*model.Block, error) {
+	if len(row) == 0 || string(row) == "null" {
+		return nil, nil
+	}
+	var b model.Block
+	if err := sonic.Unmarshal(row, &b); err != nil {
+		return nil, fmt.Errorf("read block event row: %w", err)
+	}
+	b.Version = b.UpdatedAt.UnixMicro()
+	return &b, nil
+}
+
+func equalParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type BlockEventService interface {
+	// Relay publishes the block changes recorded in the outbox, see BlockEventMQPublishJSON
+	Relay(ctx context.Context) (int, error)
+	// HandleDelivery posts a block event to the webhook of the project of its space, if any
+	HandleDelivery(ctx context.Context, body []byte) error
+	GetWebhook(ctx context.Context, project *model.Project) string
+	UpdateWebhook(ctx context.Context, project *model.Project, webhook string) (string, error)
+}
+
+type blockEventService struct {
+	r           repo.BlockEventRepo
+	projectRepo repo.ProjectRepo
+	publisher   *mq.Publisher
+	cfg         *config.Config
+	client      *http.Client
+	log         *zap.Logger
+}
+
+func NewBlockEventService(r repo.BlockEventRepo, projectRepo repo.ProjectRepo, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger) BlockEventService {
+	return &blockEventService{r: r, projectRepo: projectRepo, publisher: publisher, cfg: cfg, client: newWebhookClient(cfg), log: log}
+}
+
+// Relay publishes the events of the changes recorded in the outbox, oldest first, and returns how many were
+// published. Rows are deleted once their events are published, so a failed publish is retried by the next Relay and
+// an event can be published twice, with the same ID.
+func (s *blockEventService) Relay(ctx context.Context) (int, error) {
+	// The rows stay in the outbox until there is a queue to publish them to
+	if s.publisher == nil {
+		return 0, nil
+	}
+	published := 0
+	for {
+		n, err := s.r.Relay(ctx, blockEventRelayBatch, func(rows []model.BlockEventRow) error {
+			events, err := blockEvents(rows)
+			if err != nil {
+				return err
+			}
+			for _, ev := range events {
+				if err := s.publisher.PublishJSON(ctx, s.cfg.RabbitMQ.ExchangeName.BlockEvent, s.cfg.RabbitMQ.RoutingKey.BlockEventChange, ev); err != nil {
+					return fmt.Errorf("publish block event %s: %w", ev.ID, err)
+				}
+				published++
+			}
+			return nil
+		})
+		if err != nil || n < blockEventRelayBatch {
+			return published, err
+		}
+	}
+}
+
+// HandleDelivery posts the event as JSON to the block webhook of the project. Events are posted once: a failed
+// delivery is logged and dropped, so an unreachable webhook does not hold the queue back.
+func (s *blockEventService) HandleDelivery(ctx context.Context, body []byte) error {
+	var ev BlockEventMQPublishJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		// Requeuing would never succeed
+		s.log.Error("drop invalid block event", zap.Error(err))
+		return nil
+	}
+
+	project, err := s.projectRepo.GetBySpace(ctx, ev.SpaceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	webhook := project.BlockWebhook()
+	if webhook == "" {
+		return nil
+	}
+	if err := postWebhookJSON(ctx, s.client, webhook, ev); err != nil {
+		s.log.Warn("block event delivery failed", zap.String("project_id", project.ID.String()), zap.String("event_id", ev.ID.String()), zap.Error(err))
+	}
+	return nil
+}
+
+// GetWebhook returns the URL the block events of the project are posted to, empty when there is none
+func (s *blockEventService) GetWebhook(ctx context.Context, project *model.Project) string {
+	return project.BlockWebhook()
+}
+
+// UpdateWebhook replaces the block webhook of the project, an empty URL removes it
+func (s *blockEventService) UpdateWebhook(ctx context.Context, project *model.Project, webhook string) (string, error) {
+	if project == nil {
+		return "", errors.New("project is empty")
+	}
+	if webhook != "" && !validNotificationWebhook(webhook) {
+		return "", ErrInvalidBlockWebhook
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if webhook == "" {
+		delete(configs, model.ProjectBlockWebhookConfigKey)
+	} else {
+		configs[model.ProjectBlockWebhookConfigKey] = webhook
+	}
+
+	if err := s.projectRepo.SetConfig(ctx, project.ID, model.ProjectBlockWebhookConfigKey, configs[model.ProjectBlockWebhookConfigKey]); err != nil {
+		return "", err
+	}
+	project.Configs = configs
+	return project.BlockWebhook(), nil
+}
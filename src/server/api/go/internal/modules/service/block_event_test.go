@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+func TestBlockEventService_HandleDelivery(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	before := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeText, Title: "Draft"}
+	after := &model.Block{ID: before.ID, SpaceID: spaceID, Type: model.BlockTypeText, Title: "Final"}
+	ev := BlockEventMQPublishJSON{ID: uuid.New(), Type: BlockEventUpdated, SpaceID: spaceID, BlockID: before.ID, Before: before, After: after}
+	body, err := sonic.Marshal(ev)
+	require.NoError(t, err)
+
+	var posted []BlockEventMQPublishJSON
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var got BlockEventMQPublishJSON
+		b, _ := io.ReadAll(req.Body)
+		assert.NoError(t, sonic.Unmarshal(b, &got))
+		posted = append(posted, got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	project := model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{model.ProjectBlockWebhookConfigKey: srv.URL}}
+	r := &fakeProjectRepo{projects: []model.Project{project}, spaces: map[uuid.UUID]uuid.UUID{spaceID: project.ID}}
+	svc := NewBlockEventService(nil, r, nil, localWebhookConfig, zap.NewNop())
+
+	require.NoError(t, svc.HandleDelivery(ctx, body))
+	require.Len(t, posted, 1)
+	assert.Equal(t, ev.ID, posted[0].ID)
+	assert.Equal(t, "Draft", posted[0].Before.Title)
+	assert.Equal(t, "Final", posted[0].After.Title)
+
+	// A failed delivery is dropped, not requeued
+	status = http.StatusBadGateway
+	assert.NoError(t, svc.HandleDelivery(ctx, body))
+	assert.Len(t, posted, 2)
+
+	// Without a webhook, or once the space is deleted, nothing is posted
+	r.projects[0].Configs = datatypes.JSONMap{}
+	assert.NoError(t, svc.HandleDelivery(ctx, body))
+	delete(r.spaces, spaceID)
+	assert.NoError(t, svc.HandleDelivery(ctx, body))
+	assert.NoError(t, svc.HandleDelivery(ctx, []byte("not json")))
+	assert.Len(t, posted, 2)
+}
+
+func TestBlockEventService_UpdateWebhook(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewBlockEventService(nil, r, nil, &config.Config{}, zap.NewNop())
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{model.ProjectNotificationWebhookConfigKey: "https://hooks.example.com/acontext"}}
+
+	url, err := svc.UpdateWebhook(ctx, project, "https://hooks.example.com/blocks")
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/blocks", url)
+	assert.Equal(t, "https://hooks.example.com/acontext", project.Configs[model.ProjectNotificationWebhookConfigKey])
+	assert.Equal(t, url, r.configs[model.ProjectBlockWebhookConfigKey])
+	assert.Equal(t, url, svc.GetWebhook(ctx, project))
+
+	_, err = svc.UpdateWebhook(ctx, project, "hooks.example.com")
+	assert.ErrorIs(t, err, ErrInvalidBlockWebhook)
+
+	url, err = svc.UpdateWebhook(ctx, project, "")
+	require.NoError(t, err)
+	assert.Empty(t, url)
+	assert.NotContains(t, r.configs, model.ProjectBlockWebhookConfigKey)
+}
+
+func TestBlockEvents(t *testing.T) {
+	spaceID, otherSpaceID := uuid.New(), uuid.New()
+	pageID, textID, childID, tmpID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	row := func(b map[string]any) datatypes.JSON {
+		raw, err := sonic.Marshal(b)
+		require.NoError(t, err)
+		return raw
+	}
+	text := func(title string, sort int64) datatypes.JSON {
+		return row(map[string]any{"id": textID, "space_id": spaceID, "parent_id": pageID, "type": model.BlockTypeText, "title": title, "sort": sort, "props": map[string]any{}, "updated_at": "2026-10-16T08:00:00.000001+00:00"})
+	}
+	created := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	events, err := blockEvents([]model.BlockEventRow{
+		// created in transaction 1
+		{ID: 1, TxID: 1, BlockID: pageID, NewRow: row(map[string]any{"id": pageID, "space_id": spaceID, "type": model.BlockTypePage, "title": "Intro"}), CreatedAt: created},
+		// renamed then moved back to its sort in transaction 2, through a sentinel sort
+		{ID: 2, TxID: 2, BlockID: textID, OldRow: text("Draft", 1), NewRow: text("Draft", -1)},
+		{ID: 3, TxID: 2, BlockID: textID, OldRow: text("Draft", -1), NewRow: text("Final", 1)},
+		// deleted with its parent in transaction 3
+		{ID: 4, TxID: 3, BlockID: childID, OldRow: row(map[string]any{"id": childID, "space_id": otherSpaceID, "type": model.BlockTypeText})},
+		// moved in transaction 4
+		{ID: 5, TxID: 4, BlockID: textID, OldRow: text("Final", 1), NewRow: text("Final", 2)},
+		// created and deleted in transaction 5
+		{ID: 6, TxID: 5, BlockID: tmpID, NewRow: row(map[string]any{"id": tmpID, "space_id": spaceID})},
+		{ID: 7, TxID: 5, BlockID: tmpID, OldRow: row(map[string]any{"id": tmpID, "space_id": spaceID})},
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	assert.Equal(t, BlockEventCreated, events[0].Type)
+	assert.Equal(t, spaceID, events[0].SpaceID)
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, "Intro", events[0].After.Title)
+	assert.Equal(t, created, events[0].OccurredAt)
+
+	assert.Equal(t, BlockEventUpdated, events[1].Type)
+	assert.Equal(t, "Draft", events[1].Before.Title)
+	assert.Equal(t, "Final", events[1].After.Title)
+	assert.Equal(t, time.Date(2026, 10, 16, 8, 0, 0, 1000, time.UTC).UnixMicro(), events[1].After.Version)
+
+	assert.Equal(t, BlockEventDeleted, events[2].Type)
+	assert.Equal(t, otherSpaceID, events[2].SpaceID)
+	assert.Nil(t, events[2].After)
+
+	assert.Equal(t, BlockEventMoved, events[3].Type)
+	assert.Equal(t, int64(2), events[3].After.Sort)
+
+	// Relaying the same rows again gives the same IDs
+	again, err := blockEvents([]model.BlockEventRow{{ID: 1, TxID: 1, BlockID: pageID, NewRow: row(map[string]any{"id": pageID, "space_id": spaceID})}})
+	require.NoError(t, err)
+	assert.Equal(t, events[0].ID, again[0].ID)
+	assert.NotEqual(t, events[0].ID, events[1].ID)
+}
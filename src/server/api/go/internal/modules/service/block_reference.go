@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+// validateReference checks that a reference block points at another block of its space. Blocks of other spaces are
+// reported like missing ones.
+func (s *blockService) validateReference(ctx context.Context, b *model.Block) error {
+	target, ok := b.ReferenceBlockID()
+	if !ok {
+		return nil
+	}
+	if target == b.ID {
+		return fmt.Errorf("%w: a block cannot reference itself", ErrInvalidBlockProps)
+	}
+	t, err := s.r.Get(ctx, target)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: referenced block %s not found", ErrInvalidBlockProps, target)
+		}
+		return err
+	}
+	if t.SpaceID != b.SpaceID {
+		return fmt.Errorf("%w: referenced block %s not found", ErrInvalidBlockProps, target)
+	}
+	return nil
+}
+
+// Backlinks returns the reference blocks of the space pointing at a block, oldest first
+func (s *blockService) Backlinks(ctx context.Context, spaceID uuid.UUID, blockID uuid.UUID) ([]model.Block, error) {
+	b, err := s.r.Get(ctx, blockID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBlockNotFound
+		}
+		return nil, err
+	}
+	if b.SpaceID != spaceID {
+		return nil, ErrBlockNotFound
+	}
+	return s.r.ListBacklinks(ctx, spaceID, blockID)
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+// Formats of RenderPage
+const (
+	PageRenderMarkdown = "markdown"
+	PageRenderHTML     = "html"
+)
+
+var ErrNotAPage = errors.New("block is not a page")
+
+// pageRenderItem is a content block of a rendered page. A reference block is rendered as the content block it
+// references, as a link when it references a page, a folder or another reference, and as broken when its target is
+// gone.
+type pageRenderItem struct {
+	ID    uuid.UUID
+	Title string
+	// Block is the content rendered, nil for links and broken references
+	Block *model.Block
+	Steps []SpaceExportToolSOP
+	// Link is the block a reference links to
+	Link   *model.Block
+	Broken bool
+}
+
+// RenderPage renders a page of the space with its content blocks that are not archived, in sort order, as a single
+// Markdown or HTML document
+func (s *blockService) RenderPage(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID, format string) (string, error) {
+	page, err := s.r.Get(ctx, pageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrBlockNotFound
+		}
+		return "", err
+	}
+	if page.SpaceID != spaceID {
+		return "", ErrBlockNotFound
+	}
+	if page.Type != model.BlockTypePage {
+		return "", ErrNotAPage
+	}
+
+	children, err := s.r.ListChildren(ctx, spaceID, []uuid.UUID{pageID})
+	if err != nil {
+		return "", err
+	}
+	children = slices.DeleteFunc(children, func(b model.Block) bool { return b.IsArchived })
+	slices.SortStableFunc(children, func(a, b model.Block) int { return int(a.Sort - b.Sort) })
+
+	targetIDs := []uuid.UUID{}
+	for i := range children {
+		if id, ok := children[i].ReferenceBlockID(); ok {
+			targetIDs = append(targetIDs, id)
+		}
+	}
+	targets := map[uuid.UUID]*model.Block{}
+	if len(targetIDs) > 0 {
+		found, err := s.r.ListByIDs(ctx, spaceID, targetIDs)
+		if err != nil {
+			return "", err
+		}
+		for i := range found {
+			targets[found[i].ID] = &found[i]
+		}
+	}
+
+	items := make([]pageRenderItem, 0, len(children))
+	for i := range children {
+		b := &children[i]
+		item := pageRenderItem{ID: b.ID, Title: b.Title, Block: b}
+		if b.Type == model.BlockTypeReference {
+			item.Block = nil
+			id, _ := b.ReferenceBlockID()
+			switch target := targets[id]; {
+			case target == nil:
+				item.Broken = true
+			case target.Type == model.BlockTypePage || target.Type == model.BlockTypeFolder || target.Type == model.BlockTypeReference:
+				item.Link = target
+				if item.Title == "" {
+					item.Title = target.Title
+				}
+			default:
+				item.Block = target
+				item.Title = target.Title
+			}
+		}
+		if item.Block != nil {
+			item.Steps = exportToolSOPs(item.Block)
+		}
+		items = append(items, item)
+	}
+
+	switch format {
+	case PageRenderHTML:
+		return renderPageHTML(page, items)
+	default:
+		return renderPageMarkdown(page, items), nil
+	}
+}
+
+func renderPageMarkdown(page *model.Block, items []pageRenderItem) string {
+	var sb strings.Builder
+	sb.WriteString("# ")
+	sb.WriteString(page.Title)
+	sb.WriteString("\n\n")
+	for _, it := range items {
+		if it.Block != nil {
+			writeBlockSection(&sb, it.Block)
+			writeToolSteps(&sb, it.Steps)
+			continue
+		}
+		sb.WriteString("## ")
+		sb.WriteString(it.Title)
+		sb.WriteString("\n\n")
+		if it.Broken {
+			sb.WriteString("> Broken reference\n\n")
+		} else {
+			fmt.Fprintf(&sb, "> See %s\n\n", it.Link.Title)
+		}
+	}
+	return sb.String()
+}
+
+// renderHTMLBlock is a content block of a page for pageTemplates
+type renderHTMLBlock struct {
+	ID       uuid.UUID
+	Type     string
+	Title    string
+	Text     string
+	Language string
+	Code     string
+	Checked  bool
+	Columns  []string
+	Rows     [][]string
+	Steps    []SpaceExportToolSOP
+	Link     *model.Block
+	Broken   bool
+}
+
+func renderPageHTML(page *model.Block, items []pageRenderItem) (string, error) {
+	blocks := make([]renderHTMLBlock, 0, len(items))
+	for _, it := range items {
+		hb := renderHTMLBlock{ID: it.ID, Type: model.BlockTypeReference, Title: it.Title, Steps: it.Steps, Link: it.Link, Broken: it.Broken}
+		if it.Block != nil {
+			props := it.Block.Props.Data()
+			hb.Type = it.Block.Type
+			switch it.Block.Type {
+			case model.BlockTypeText:
+				hb.Text, _ = props["notes"].(string)
+			case model.BlockTypeSOP:
+				hb.Text, _ = props["preferences"].(string)
+			case model.BlockTypeMarkdown:
+				hb.Text, _ = props["content"].(string)
+			case model.BlockTypeCode:
+				hb.Language, _ = props["language"].(string)
+				hb.Code, _ = props["code"].(string)
+			case model.BlockTypeTodo:
+				hb.Text, _ = props["text"].(string)
+				hb.Checked, _ = props["checked"].(bool)
+			case model.BlockTypeTable:
+				hb.Columns, hb.Rows = tableCells(props)
+			default:
+				continue
+			}
+		}
+		blocks = append(blocks, hb)
+	}
+
+	var sb strings.Builder
+	err := pageTemplates.ExecuteTemplate(&sb, "page", map[string]any{"Page": page, "Blocks": blocks})
+	return sb.String(), err
+}
+
+// tableCells returns the column names and the cells of a table block, empty cells for null
+func tableCells(props map[string]any) ([]string, [][]string) {
+	columns, err := model.TableColumns(props)
+	if err != nil {
+		return nil, nil
+	}
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	rows, _ := props["rows"].([]any)
+	cells := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		row, _ := r.([]any)
+		line := make([]string, len(columns))
+		for i := range line {
+			if i < len(row) && row[i] != nil {
+				line[i] = fmt.Sprint(row[i])
+			}
+		}
+		cells = append(cells, line)
+	}
+	return names, cells
+}
+
+var pageTemplates = template.Must(template.New("page").Parse(`
+{{- define "page"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Page.Title}}</title>
+<style>.text{white-space:pre-wrap}table{border-collapse:collapse}td,th{border:1px solid #ddd;padding:.3em .6em;text-align:left}</style>
+</head><body>
+<article id="{{.Page.ID}}">
+<h1>{{.Page.Title}}</h1>
+{{- range .Blocks}}
+<section class="block {{.Type}}" id="{{.ID}}">
+<h2>{{.Title}}</h2>
+{{- if .Broken}}
+<blockquote class="reference">Broken reference</blockquote>
+{{- else if .Link}}
+<blockquote class="reference" data-block-id="{{.Link.ID}}">See {{.Link.Title}}</blockquote>
+{{- else if eq .Type "code"}}
+<pre><code class="language-{{.Language}}">{{.Code}}</code></pre>
+{{- else if eq .Type "todo"}}
+<p><input type="checkbox" disabled{{if .Checked}} checked{{end}}> {{.Text}}</p>
+{{- else if eq .Type "table"}}
+<table><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- else if .Text}}
+<div class="text">{{.Text}}</div>
+{{- end}}
+{{- if .Steps}}
+<ol class="steps">{{range .Steps}}<li><code>{{.ToolName}}</code>: {{.Action}}</li>{{end}}</ol>
+{{- end}}
+</section>
+{{- end}}
+</article>
+</body></html>
+{{end}}
+`))
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+// maxPageSlugLen is the largest number of characters of a slug made from a title, before its collision suffix
+const maxPageSlugLen = 64
+
+// PageSlug makes the slug of a page from its title: lowercase letters and digits, with a single dash for anything in
+// between, e.g. "Getting Started (v2)" is getting-started-v2. A title without letters or digits gives "page".
+func PageSlug(title string) string {
+	var b strings.Builder
+	n := 0
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if n == maxPageSlugLen {
+			break
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			n++
+			dash = false
+			if n == maxPageSlugLen {
+				break
+			}
+		}
+		b.WriteRune(r)
+		n++
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return model.BlockTypePage
+	}
+	return slug
+}
+
+// pageSlug returns the slug of a new page from its title, made unique in the space when written
+func pageSlug(title string) *string {
+	slug := PageSlug(title)
+	return &slug
+}
+
+// GetPageBySlug returns the page of the space with the slug
+func (s *blockService) GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error) {
+	page, err := s.r.GetPageBySlug(ctx, spaceID, slug)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBlockNotFound
+		}
+		return nil, err
+	}
+	return page, nil
+}
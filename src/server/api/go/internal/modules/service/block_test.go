@@ -3,12 +3,15 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockBlockRepo is a mock implementation of BlockRepo
@@ -67,6 +70,66 @@ func (m *MockBlockRepo) ListBySpace(ctx context.Context, spaceID uuid.UUID, bloc
 	return args.Get(0).([]model.Block), args.Error(1)
 }
 
+func (m *MockBlockRepo) ListByIDs(ctx context.Context, spaceID uuid.UUID, ids []uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockBlockRepo) SpaceProjectID(ctx context.Context, spaceID uuid.UUID) (uuid.UUID, error) {
+	args := m.Called(ctx, spaceID)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockBlockRepo) ListChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID, parentIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockBlockRepo) CreateCopies(ctx context.Context, blocks []model.Block, sops []model.ToolSOP) error {
+	args := m.Called(ctx, blocks, sops)
+	return args.Error(0)
+}
+
+func (m *MockBlockRepo) GetPageBySlug(ctx context.Context, spaceID uuid.UUID, slug string) (*model.Block, error) {
+	args := m.Called(ctx, spaceID, slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockBlockRepo) ReorderChildren(ctx context.Context, spaceID uuid.UUID, parentID uuid.UUID, ids []uuid.UUID) error {
+	args := m.Called(ctx, spaceID, parentID, ids)
+	return args.Error(0)
+}
+
+func (m *MockBlockRepo) UpdateAtVersion(ctx context.Context, b *model.Block, version int64) error {
+	args := m.Called(ctx, b, version)
+	return args.Error(0)
+}
+
+func (m *MockBlockRepo) ListBacklinks(ctx context.Context, spaceID uuid.UUID, id uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockBlockRepo) ParentsWithChildren(ctx context.Context, spaceID uuid.UUID, parentIDs []uuid.UUID) ([]uuid.UUID, error) {
+	args := m.Called(ctx, spaceID, parentIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
 func TestBlockService_Create_Page(t *testing.T) {
 	ctx := context.Background()
 	spaceID := uuid.New()
@@ -89,7 +152,7 @@ func TestBlockService_Create_Page(t *testing.T) {
 			setup: func(repo *MockBlockRepo) {
 				repo.On("NextSort", ctx, spaceID, (*uuid.UUID)(nil)).Return(int64(1), nil)
 				repo.On("Create", ctx, mock.MatchedBy(func(b *model.Block) bool {
-					return b.Type == model.BlockTypePage && b.Sort == 1
+					return b.Type == model.BlockTypePage && b.Sort == 1 && b.Slug != nil && *b.Slug == "test-page"
 				})).Return(nil)
 			},
 			wantErr: false,
@@ -158,7 +221,7 @@ func TestBlockService_Create_Page(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Create(ctx, tt.block)
 
 			if tt.wantErr {
@@ -220,7 +283,7 @@ func TestBlockService_Delete(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Delete(ctx, spaceID, tt.blockID)
 
 			if tt.wantErr {
@@ -360,7 +423,7 @@ func TestBlockService_Create_Text(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Create(ctx, tt.block)
 
 			if tt.wantErr {
@@ -495,7 +558,7 @@ func TestBlockService_Create_Folder(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Create(ctx, tt.block)
 
 			if tt.wantErr {
@@ -606,7 +669,7 @@ func TestBlockService_Move_Folder(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Move(ctx, tt.folderID, tt.newParentID, tt.targetSort)
 
 			if tt.wantErr {
@@ -683,7 +746,7 @@ func TestBlockService_List(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			_, err := service.List(ctx, tt.spaceID, tt.blockType, tt.parentID)
 
 			if tt.wantErr {
@@ -697,6 +760,326 @@ func TestBlockService_List(t *testing.T) {
 	}
 }
 
+func TestBlockService_BulkGet(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	a := model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeText}
+	b := model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage}
+	missing := uuid.New()
+
+	t.Run("keeps request order and reports missing ids", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("ListByIDs", ctx, spaceID, []uuid.UUID{b.ID, missing, a.ID}).Return([]model.Block{a, b}, nil)
+
+		out, err := NewBlockService(repo, nil, nil, nil, nil).BulkGet(ctx, spaceID, []uuid.UUID{b.ID, missing, a.ID, b.ID})
+		assert.NoError(t, err)
+		if assert.Len(t, out.Blocks, 2) {
+			assert.Equal(t, b.ID, out.Blocks[0].ID)
+			assert.Equal(t, a.ID, out.Blocks[1].ID)
+		}
+		assert.Equal(t, []uuid.UUID{missing}, out.Missing)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("repo error", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("ListByIDs", ctx, spaceID, []uuid.UUID{a.ID}).Return(nil, errors.New("db error"))
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).BulkGet(ctx, spaceID, []uuid.UUID{a.ID})
+		assert.Error(t, err)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestBlockService_Tree(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	root := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeFolder}
+	folder := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &root.ID, Type: model.BlockTypeFolder}
+	page := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &root.ID, Type: model.BlockTypePage}
+	text := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeText}
+	sameIDs := func(want ...uuid.UUID) interface{} {
+		// The order of the ids of a level is not defined
+		return mock.MatchedBy(func(ids []uuid.UUID) bool {
+			got := map[uuid.UUID]bool{}
+			for _, id := range ids {
+				got[id] = true
+			}
+			for _, id := range want {
+				if !got[id] {
+					return false
+				}
+			}
+			return len(ids) == len(want)
+		})
+	}
+
+	t.Run("marks the blocks at the depth with children", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, root.ID).Return(root, nil)
+		repo.On("ListChildren", ctx, spaceID, []uuid.UUID{root.ID}).Return([]model.Block{folder, page}, nil)
+		repo.On("ParentsWithChildren", ctx, spaceID, sameIDs(folder.ID, page.ID)).Return([]uuid.UUID{page.ID}, nil)
+
+		tree, err := NewBlockService(repo, nil, nil, nil, nil).Tree(ctx, spaceID, root.ID, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, tree.Children, 2) {
+			assert.Equal(t, folder.ID, tree.Children[0].ID)
+			assert.False(t, tree.Children[0].HasMore)
+			assert.Equal(t, page.ID, tree.Children[1].ID)
+			assert.True(t, tree.Children[1].HasMore)
+			assert.Empty(t, tree.Children[1].Children)
+		}
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("stops at the leaves", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, root.ID).Return(root, nil)
+		repo.On("ListChildren", ctx, spaceID, []uuid.UUID{root.ID}).Return([]model.Block{folder, page}, nil)
+		repo.On("ListChildren", ctx, spaceID, sameIDs(folder.ID, page.ID)).Return([]model.Block{text}, nil)
+
+		tree, err := NewBlockService(repo, nil, nil, nil, nil).Tree(ctx, spaceID, root.ID, 5)
+		assert.NoError(t, err)
+		if assert.Len(t, tree.Children, 2) && assert.Len(t, tree.Children[1].Children, 1) {
+			assert.Equal(t, text.ID, tree.Children[1].Children[0].ID)
+			assert.False(t, tree.Children[1].Children[0].HasMore)
+		}
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("block of another space", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, root.ID).Return(root, nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Tree(ctx, uuid.New(), root.ID, 1)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, root.ID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Tree(ctx, spaceID, root.ID, 1)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestBlockService_Duplicate(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	toolID := uuid.New()
+	archive := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeFolder, Title: "archive", Props: datatypes.NewJSONType(map[string]any{"path": "archive"})}
+	docs := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeFolder, Title: "docs", Sort: 3, Props: datatypes.NewJSONType(map[string]any{"path": "docs"})}
+	sub := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &docs.ID, Type: model.BlockTypeFolder, Title: "sub", Props: datatypes.NewJSONType(map[string]any{"path": "docs/sub"})}
+	page := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &docs.ID, Type: model.BlockTypePage, Title: "intro", Sort: 1, Props: datatypes.NewJSONType(map[string]any{})}
+	sop := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeSOP, Title: "deploy", IsArchived: true,
+		Props:    datatypes.NewJSONType(map[string]any{"use_when": "releasing", "tool_sops": []map[string]any{{"action": "run", "tool_name": "ci"}}}),
+		ToolSOPs: []model.ToolSOP{{Order: 0, Action: "run", ToolReferenceID: toolID, SOPBlockID: uuid.New()}},
+	}
+
+	t.Run("deep copy under another folder", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, docs.ID).Return(docs, nil)
+		repo.On("Get", ctx, archive.ID).Return(archive, nil)
+		repo.On("ListChildren", ctx, spaceID, []uuid.UUID{docs.ID}).Return([]model.Block{sub, page}, nil)
+		repo.On("ListChildren", ctx, spaceID, mock.Anything).Return([]model.Block{sop}, nil).Once()
+		var copies []model.Block
+		var sops []model.ToolSOP
+		repo.On("CreateCopies", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			copies = args.Get(1).([]model.Block)
+			sops = args.Get(2).([]model.ToolSOP)
+		}).Return(nil)
+
+		copied, err := NewBlockService(repo, nil, nil, nil, nil).Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: docs.ID, ParentID: &archive.ID, Deep: true})
+		assert.NoError(t, err)
+		if !assert.Len(t, copies, 4) {
+			return
+		}
+		assert.Equal(t, copies[0].ID, copied.ID)
+		assert.NotEqual(t, docs.ID, copied.ID)
+		assert.Equal(t, &archive.ID, copied.ParentID)
+		assert.Equal(t, "archive/docs", copied.GetFolderPath())
+
+		cpSub, cpPage, cpSOP := copies[1], copies[2], copies[3]
+		assert.Equal(t, &copied.ID, cpSub.ParentID)
+		assert.Equal(t, "archive/docs/sub", cpSub.GetFolderPath())
+		assert.Equal(t, &copied.ID, cpPage.ParentID)
+		assert.Equal(t, int64(1), cpPage.Sort)
+		if assert.NotNil(t, cpPage.Slug) {
+			assert.Equal(t, "intro", *cpPage.Slug)
+		}
+		assert.Nil(t, cpSub.Slug)
+		assert.Equal(t, &cpPage.ID, cpSOP.ParentID)
+		assert.True(t, cpSOP.IsArchived)
+		assert.Equal(t, map[string]any{"use_when": "releasing"}, cpSOP.Props.Data())
+		assert.Equal(t, []model.ToolSOP{{Order: 0, Action: "run", ToolReferenceID: toolID, SOPBlockID: cpSOP.ID}}, sops)
+		// The source is left as it is
+		assert.Equal(t, "docs/sub", sub.GetFolderPath())
+		assert.Contains(t, sop.Props.Data(), "tool_sops")
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("shallow copy under the same parent", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(&page, nil)
+		repo.On("Get", ctx, docs.ID).Return(docs, nil)
+		repo.On("CreateCopies", ctx, mock.MatchedBy(func(blocks []model.Block) bool {
+			return len(blocks) == 1 && blocks[0].ID != page.ID && *blocks[0].ParentID == docs.ID && blocks[0].Title == "intro"
+		}), []model.ToolSOP{}).Return(nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID})
+		assert.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("invalid parent", func(t *testing.T) {
+		other := &model.Block{ID: uuid.New(), SpaceID: uuid.New(), Type: model.BlockTypeFolder}
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(&page, nil)
+		repo.On("Get", ctx, other.ID).Return(other, nil)
+		repo.On("Get", ctx, sop.ID).Return(&sop, nil)
+		svc := NewBlockService(repo, nil, nil, nil, nil)
+
+		// A parent of another space
+		_, err := svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, ParentID: &other.ID})
+		assert.ErrorIs(t, err, ErrInvalidDuplicateParent)
+		// A page under a block that cannot have children
+		_, err = svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, ParentID: &sop.ID})
+		assert.ErrorIs(t, err, ErrInvalidDuplicateParent)
+		repo.AssertNotCalled(t, "CreateCopies", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID})
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestBlockService_Duplicate_ToSpace(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	spaceID, targetSpaceID, foreignSpaceID := uuid.New(), uuid.New(), uuid.New()
+	page := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "runbook", Props: datatypes.NewJSONType(map[string]any{})}
+	text := model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeText, Title: "steps", Props: datatypes.NewJSONType(map[string]any{"notes": "restart"})}
+	reference := func(target uuid.UUID) model.Block {
+		return model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeReference, Title: "see steps",
+			Props: datatypes.NewJSONType(map[string]any{"reference_block_id": target.String()})}
+	}
+	folder := &model.Block{ID: uuid.New(), SpaceID: targetSpaceID, Type: model.BlockTypeFolder, Title: "shared", Props: datatypes.NewJSONType(map[string]any{"path": "shared"})}
+
+	newRepo := func(children ...model.Block) *MockBlockRepo {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(page, nil)
+		repo.On("Get", ctx, folder.ID).Return(folder, nil)
+		repo.On("SpaceProjectID", ctx, spaceID).Return(projectID, nil)
+		repo.On("SpaceProjectID", ctx, targetSpaceID).Return(projectID, nil)
+		repo.On("SpaceProjectID", ctx, foreignSpaceID).Return(uuid.New(), nil)
+		repo.On("ListChildren", ctx, spaceID, []uuid.UUID{page.ID}).Return(children, nil)
+		return repo
+	}
+
+	t.Run("deep copy with its references", func(t *testing.T) {
+		ref := reference(text.ID)
+		repo := newRepo(text, ref)
+		var copies []model.Block
+		repo.On("CreateCopies", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			copies = args.Get(1).([]model.Block)
+		}).Return(nil)
+
+		copied, err := NewBlockService(repo, nil, nil, nil, nil).Duplicate(ctx, DuplicateBlockInput{
+			SpaceID: spaceID, BlockID: page.ID, ParentID: &folder.ID, Deep: true, TargetSpaceID: targetSpaceID, ProjectID: projectID,
+		})
+		assert.NoError(t, err)
+		if !assert.Len(t, copies, 3) {
+			return
+		}
+		assert.Equal(t, &folder.ID, copied.ParentID)
+		for _, cp := range copies {
+			assert.Equal(t, targetSpaceID, cp.SpaceID)
+		}
+		target, _ := copies[2].ReferenceBlockID()
+		assert.Equal(t, copies[1].ID, target)
+		// The source is left as it is
+		target, _ = ref.ReferenceBlockID()
+		assert.Equal(t, text.ID, target)
+	})
+
+	t.Run("to the root of the space", func(t *testing.T) {
+		repo := newRepo()
+		repo.On("CreateCopies", ctx, mock.MatchedBy(func(blocks []model.Block) bool {
+			return len(blocks) == 1 && blocks[0].ParentID == nil && blocks[0].SpaceID == targetSpaceID
+		}), []model.ToolSOP{}).Return(nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, TargetSpaceID: targetSpaceID, ProjectID: projectID})
+		assert.NoError(t, err)
+		repo.AssertCalled(t, "CreateCopies", ctx, mock.Anything, mock.Anything)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		repo := newRepo(text, reference(uuid.New()))
+		svc := NewBlockService(repo, nil, nil, nil, nil)
+
+		// A reference to a block that is not copied
+		_, err := svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, Deep: true, TargetSpaceID: targetSpaceID, ProjectID: projectID})
+		assert.ErrorIs(t, err, ErrCopyReferenceOutside)
+		// A target space of another project
+		_, err = svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, TargetSpaceID: foreignSpaceID, ProjectID: projectID})
+		assert.ErrorIs(t, err, ErrInvalidDuplicateParent)
+		// A block of another project
+		_, err = svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, TargetSpaceID: targetSpaceID, ProjectID: uuid.New()})
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		// A parent left in the space of the block
+		_, err = svc.Duplicate(ctx, DuplicateBlockInput{SpaceID: spaceID, BlockID: page.ID, ParentID: &page.ID, TargetSpaceID: targetSpaceID, ProjectID: projectID})
+		assert.ErrorIs(t, err, ErrInvalidDuplicateParent)
+		repo.AssertNotCalled(t, "CreateCopies", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestPageSlug(t *testing.T) {
+	tests := map[string]string{
+		"Getting Started":              "getting-started",
+		"  Getting Started (v2)":       "getting-started-v2",
+		"API / Auth -- Tokens!":        "api-auth-tokens",
+		"Café Déjà Vu":                 "café-déjà-vu",
+		"???":                          "page",
+		"":                             "page",
+		strings.Repeat("a", 70):        strings.Repeat("a", 64),
+		strings.Repeat("a", 63) + " b": strings.Repeat("a", 63),
+	}
+	for title, want := range tests {
+		assert.Equal(t, want, PageSlug(title), title)
+	}
+}
+
+func TestBlockService_GetPageBySlug(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	slug := "getting-started"
+	page := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "Getting Started", Slug: &slug}
+
+	t.Run("found", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("GetPageBySlug", ctx, spaceID, slug).Return(page, nil)
+
+		got, err := NewBlockService(repo, nil, nil, nil, nil).GetPageBySlug(ctx, spaceID, slug)
+		assert.NoError(t, err)
+		assert.Equal(t, page.ID, got.ID)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("GetPageBySlug", ctx, spaceID, "missing").Return(nil, gorm.ErrRecordNotFound).Once()
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).GetPageBySlug(ctx, spaceID, "missing")
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		repo.AssertExpectations(t)
+	})
+}
+
 // Test comprehensive nesting scenarios
 func TestBlockService_ComprehensiveNesting(t *testing.T) {
 	ctx := context.Background()
@@ -716,7 +1099,7 @@ func TestBlockService_ComprehensiveNesting(t *testing.T) {
 			return b.Type == model.BlockTypeFolder && b.GetFolderPath() == "Root"
 		})).Return(nil)
 
-		service := NewBlockService(repo)
+		service := NewBlockService(repo, nil, nil, nil, nil)
 		err := service.Create(ctx, rootFolder)
 		assert.NoError(t, err)
 		assert.Equal(t, "Root", rootFolder.GetFolderPath())
@@ -741,7 +1124,7 @@ func TestBlockService_ComprehensiveNesting(t *testing.T) {
 		}
 		repo.On("Get", ctx, pageID).Return(pageBlock, nil)
 
-		service := NewBlockService(repo)
+		service := NewBlockService(repo, nil, nil, nil, nil)
 		err := service.Create(ctx, folderUnderPage)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "cannot be a child of")
@@ -758,7 +1141,7 @@ func TestBlockService_ComprehensiveNesting(t *testing.T) {
 			Title:   "InvalidText",
 		}
 
-		service := NewBlockService(repo)
+		service := NewBlockService(repo, nil, nil, nil, nil)
 		err := service.Create(ctx, textAtRoot)
 		assert.Error(t, err)
 		// The error comes from Validate() which checks RequireParent first
@@ -999,7 +1382,7 @@ func TestBlockService_Move_CircularReference(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			err := service.Move(ctx, tt.blockID, tt.newParentID, nil)
 
 			if tt.wantErr {
@@ -1143,7 +1526,7 @@ func TestBlockService_isDescendant(t *testing.T) {
 			repo := &MockBlockRepo{}
 			tt.setup(repo)
 
-			service := NewBlockService(repo)
+			service := NewBlockService(repo, nil, nil, nil, nil)
 			result, err := service.(*blockService).isDescendant(ctx, tt.ancestorID, tt.candidateID)
 
 			if tt.wantErr {
@@ -1157,3 +1540,284 @@ func TestBlockService_isDescendant(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockService_DocumentBlockProps(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	tableID := uuid.New()
+
+	repo := &MockBlockRepo{}
+	repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+	repo.On("Get", ctx, tableID).Return(&model.Block{ID: tableID, SpaceID: spaceID, Type: model.BlockTypeTable}, nil)
+	repo.On("NextSort", ctx, spaceID, &pageID).Return(int64(0), nil)
+	repo.On("Create", ctx, mock.Anything).Return(nil)
+	repo.On("Update", ctx, mock.Anything).Return(nil)
+	svc := NewBlockService(repo, nil, nil, nil, nil)
+
+	todo := &model.Block{SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeTodo, Props: datatypes.NewJSONType(map[string]any{"checked": false, "text": "ship"})}
+	assert.NoError(t, svc.Create(ctx, todo))
+
+	code := &model.Block{SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeCode, Props: datatypes.NewJSONType(map[string]any{"code": "x := 1"})}
+	assert.ErrorIs(t, svc.Create(ctx, code), ErrInvalidBlockProps)
+
+	columns := []any{map[string]any{"name": "n", "type": "number"}}
+	assert.NoError(t, svc.UpdateBlockProperties(ctx, &model.Block{ID: tableID, Props: datatypes.NewJSONType(map[string]any{
+		"columns": columns,
+		"rows":    []any{[]any{1.0}},
+	})}))
+
+	// The props are validated against the stored type of the block
+	err := svc.UpdateBlockProperties(ctx, &model.Block{ID: tableID, Props: datatypes.NewJSONType(map[string]any{"content": "# Notes"})})
+	assert.ErrorIs(t, err, ErrInvalidBlockProps)
+
+	rows := make([]any, maxTableBlockRows+1)
+	for i := range rows {
+		rows[i] = []any{float64(i)}
+	}
+	err = svc.UpdateBlockProperties(ctx, &model.Block{ID: tableID, Props: datatypes.NewJSONType(map[string]any{"columns": columns, "rows": rows})})
+	assert.ErrorIs(t, err, ErrInvalidBlockProps)
+
+	repo.AssertNumberOfCalls(t, "Create", 1)
+	repo.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestBlockService_ReorderChildren(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	order := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	t.Run("reorder", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+		repo.On("ReorderChildren", ctx, spaceID, pageID, order).Return(nil)
+
+		assert.NoError(t, NewBlockService(repo, nil, nil, nil, nil).ReorderChildren(ctx, spaceID, pageID, order))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("order missing a child", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+		repo.On("ReorderChildren", ctx, spaceID, pageID, order[:2]).Return(ErrInvalidChildrenOrder)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).ReorderChildren(ctx, spaceID, pageID, order[:2])
+		assert.ErrorIs(t, err, ErrInvalidChildrenOrder)
+	})
+
+	t.Run("block of another space", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: uuid.New(), Type: model.BlockTypePage}, nil)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).ReorderChildren(ctx, spaceID, pageID, order)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		repo.AssertNotCalled(t, "ReorderChildren", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(nil, gorm.ErrRecordNotFound)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).ReorderChildren(ctx, spaceID, pageID, order)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestBlockService_UpdateBlockProperties_Version(t *testing.T) {
+	ctx := context.Background()
+	blockID := uuid.New()
+	version := int64(1767225600000000)
+	current := &model.Block{ID: blockID, SpaceID: uuid.New(), Type: model.BlockTypeText, Version: version}
+
+	t.Run("at the current version", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, blockID).Return(current, nil)
+		repo.On("UpdateAtVersion", ctx, mock.Anything, version).Return(nil)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).UpdateBlockProperties(ctx, &model.Block{ID: blockID, Title: "new", Version: version})
+		assert.NoError(t, err)
+		repo.AssertExpectations(t)
+		repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("block changed since", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, blockID).Return(current, nil)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).UpdateBlockProperties(ctx, &model.Block{ID: blockID, Title: "new", Version: version - 1})
+		assert.ErrorIs(t, err, ErrBlockVersionConflict)
+		repo.AssertNotCalled(t, "UpdateAtVersion", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("block changed while written", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, blockID).Return(current, nil)
+		repo.On("UpdateAtVersion", ctx, mock.Anything, version).Return(ErrBlockVersionConflict)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).UpdateBlockProperties(ctx, &model.Block{ID: blockID, Title: "new", Version: version})
+		assert.ErrorIs(t, err, ErrBlockVersionConflict)
+	})
+
+	t.Run("without version", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, blockID).Return(current, nil)
+		repo.On("Update", ctx, mock.Anything).Return(nil)
+
+		err := NewBlockService(repo, nil, nil, nil, nil).UpdateBlockProperties(ctx, &model.Block{ID: blockID, Title: "new"})
+		assert.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestBlockService_ReferenceBlocks(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	targetID := uuid.New()
+	foreignID := uuid.New()
+	missingID := uuid.New()
+	refID := uuid.New()
+
+	repo := &MockBlockRepo{}
+	repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+	repo.On("Get", ctx, targetID).Return(&model.Block{ID: targetID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+	repo.On("Get", ctx, foreignID).Return(&model.Block{ID: foreignID, SpaceID: uuid.New(), Type: model.BlockTypePage}, nil)
+	repo.On("Get", ctx, missingID).Return(nil, gorm.ErrRecordNotFound)
+	repo.On("Get", ctx, refID).Return(&model.Block{ID: refID, SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeReference}, nil)
+	repo.On("NextSort", ctx, spaceID, &pageID).Return(int64(0), nil)
+	repo.On("Create", ctx, mock.Anything).Return(nil)
+	repo.On("Update", ctx, mock.MatchedBy(func(b *model.Block) bool {
+		return b.ID == refID && b.Type == model.BlockTypeReference
+	})).Return(nil)
+	svc := NewBlockService(repo, nil, nil, nil, nil)
+
+	reference := func(target uuid.UUID) datatypes.JSONType[map[string]any] {
+		return datatypes.NewJSONType(map[string]any{"reference_block_id": target.String()})
+	}
+
+	ref := &model.Block{SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeReference, Props: reference(targetID)}
+	assert.NoError(t, svc.Create(ctx, ref))
+
+	for _, target := range []uuid.UUID{foreignID, missingID} {
+		ref := &model.Block{SpaceID: spaceID, ParentID: &pageID, Type: model.BlockTypeReference, Props: reference(target)}
+		assert.ErrorIs(t, svc.Create(ctx, ref), ErrInvalidBlockProps)
+	}
+
+	// The type of the stored block tells the repository to move the reference
+	assert.NoError(t, svc.UpdateBlockProperties(ctx, &model.Block{ID: refID, Props: reference(pageID)}))
+	assert.ErrorIs(t, svc.UpdateBlockProperties(ctx, &model.Block{ID: refID, Props: reference(refID)}), ErrInvalidBlockProps)
+
+	repo.AssertNumberOfCalls(t, "Create", 1)
+	repo.AssertNumberOfCalls(t, "Update", 1)
+}
+
+func TestBlockService_Backlinks(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	backlinks := []model.Block{{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeReference}}
+
+	t.Run("backlinks", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage}, nil)
+		repo.On("ListBacklinks", ctx, spaceID, pageID).Return(backlinks, nil)
+
+		got, err := NewBlockService(repo, nil, nil, nil, nil).Backlinks(ctx, spaceID, pageID)
+		assert.NoError(t, err)
+		assert.Equal(t, backlinks, got)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("block of another space", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: uuid.New(), Type: model.BlockTypePage}, nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Backlinks(ctx, spaceID, pageID)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		repo.AssertNotCalled(t, "ListBacklinks", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, pageID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).Backlinks(ctx, spaceID, pageID)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestBlockService_RenderPage(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	page := &model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "Deploy"}
+	otherPage := model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "Rollback"}
+	sop := model.Block{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeSOP, Title: "Release", Props: datatypes.NewJSONType(map[string]any{"preferences": "tag first"}),
+		ToolSOPs: []model.ToolSOP{{Action: "push the tag", ToolReference: &model.ToolReference{Name: "git"}}}}
+	missingID := uuid.New()
+	reference := func(title string, sort int64, target uuid.UUID) model.Block {
+		return model.Block{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeReference, Title: title, Sort: sort,
+			Props: datatypes.NewJSONType(map[string]any{"reference_block_id": target.String()})}
+	}
+	children := []model.Block{
+		{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeCode, Title: "Script", Sort: 1,
+			Props: datatypes.NewJSONType(map[string]any{"language": "sh", "code": "make <deploy>"})},
+		{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeMarkdown, Title: "Old", Sort: 2, IsArchived: true},
+		reference("", 3, otherPage.ID),
+		reference("Gone", 4, missingID),
+		{ID: uuid.New(), SpaceID: spaceID, ParentID: &page.ID, Type: model.BlockTypeTodo, Title: "Check", Sort: 0,
+			Props: datatypes.NewJSONType(map[string]any{"text": "run tests", "checked": true})},
+		reference("Release steps", 5, sop.ID),
+	}
+
+	newRepo := func() *MockBlockRepo {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(page, nil)
+		repo.On("ListChildren", ctx, spaceID, []uuid.UUID{page.ID}).Return(append([]model.Block(nil), children...), nil)
+		repo.On("ListByIDs", ctx, spaceID, []uuid.UUID{otherPage.ID, missingID, sop.ID}).Return([]model.Block{sop, otherPage}, nil)
+		return repo
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		doc, err := NewBlockService(newRepo(), nil, nil, nil, nil).RenderPage(ctx, spaceID, page.ID, PageRenderMarkdown)
+		assert.NoError(t, err)
+		assert.Equal(t, "# Deploy\n\n"+
+			"## Check\n\n- [x] run tests\n\n"+
+			"## Script\n\n```sh\nmake <deploy>\n```\n\n"+
+			"## Rollback\n\n> See Rollback\n\n"+
+			"## Gone\n\n> Broken reference\n\n"+
+			"## Release\n\ntag first\n\n- `git`: push the tag\n\n", doc)
+	})
+
+	t.Run("html", func(t *testing.T) {
+		doc, err := NewBlockService(newRepo(), nil, nil, nil, nil).RenderPage(ctx, spaceID, page.ID, PageRenderHTML)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(doc, "<!DOCTYPE html>"))
+		assert.Contains(t, doc, "<h1>Deploy</h1>")
+		assert.Contains(t, doc, `<input type="checkbox" disabled checked> run tests`)
+		assert.Contains(t, doc, `<pre><code class="language-sh">make &lt;deploy&gt;</code></pre>`)
+		assert.Contains(t, doc, `data-block-id="`+otherPage.ID.String()+`">See Rollback</blockquote>`)
+		assert.Contains(t, doc, "Broken reference")
+		assert.Contains(t, doc, `<div class="text">tag first</div>`)
+		assert.Contains(t, doc, "<li><code>git</code>: push the tag</li>")
+		assert.NotContains(t, doc, "Old")
+		assert.Less(t, strings.Index(doc, "run tests"), strings.Index(doc, "make"))
+	})
+
+	t.Run("not a page", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, sop.ID).Return(&sop, nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).RenderPage(ctx, spaceID, sop.ID, PageRenderMarkdown)
+		assert.ErrorIs(t, err, ErrNotAPage)
+	})
+
+	t.Run("page of another space", func(t *testing.T) {
+		repo := &MockBlockRepo{}
+		repo.On("Get", ctx, page.ID).Return(page, nil)
+
+		_, err := NewBlockService(repo, nil, nil, nil, nil).RenderPage(ctx, uuid.New(), page.ID, PageRenderMarkdown)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		repo.AssertNotCalled(t, "ListChildren", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
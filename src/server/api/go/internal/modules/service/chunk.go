@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/chunker"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/fileparser"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+type ChunkService interface {
+	ChunkArtifact(ctx context.Context, in ChunkArtifactInput) ([]model.Chunk, error)
+	ChunkBlock(ctx context.Context, in ChunkBlockInput) ([]model.Chunk, error)
+	ListArtifactChunks(ctx context.Context, diskID uuid.UUID, path string, filename string) ([]model.Chunk, error)
+	ListBlockChunks(ctx context.Context, blockID uuid.UUID) ([]model.Chunk, error)
+}
+
+type chunkService struct {
+	r            repo.ChunkRepo
+	artifactRepo repo.ArtifactRepo
+	blockRepo    repo.BlockRepo
+	s3           *blob.S3Deps
+	publisher    *mq.Publisher
+	cfg          *config.Config
+	log          *zap.Logger
+}
+
+func NewChunkService(r repo.ChunkRepo, artifactRepo repo.ArtifactRepo, blockRepo repo.BlockRepo, s3 *blob.S3Deps, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger) ChunkService {
+	return &chunkService{
+		r:            r,
+		artifactRepo: artifactRepo,
+		blockRepo:    blockRepo,
+		s3:           s3,
+		publisher:    publisher,
+		cfg:          cfg,
+		log:          log,
+	}
+}
+
+// ChunkMQPublishJSON is published after the chunks of a source are replaced, so they get (re-)embedded
+type ChunkMQPublishJSON struct {
+	ProjectID  uuid.UUID `json:"project_id"`
+	SourceType string    `json:"source_type"`
+	SourceID   uuid.UUID `json:"source_id"`
+}
+
+type ChunkArtifactInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	Path      string
+	Filename  string
+	Config    *chunker.Config // [Optional] overrides the server default
+}
+
+type ChunkBlockInput struct {
+	ProjectID uuid.UUID
+	SpaceID   uuid.UUID
+	BlockID   uuid.UUID
+	Config    *chunker.Config // [Optional] overrides the server default
+}
+
+func (s *chunkService) chunkerConfig(override *chunker.Config) chunker.Config {
+	if override != nil {
+		return *override
+	}
+	return chunker.Config{
+		Strategy:      s.cfg.Chunker.Strategy,
+		MaxTokens:     s.cfg.Chunker.MaxTokens,
+		OverlapTokens: s.cfg.Chunker.OverlapTokens,
+	}
+}
+
+func (s *chunkService) ChunkArtifact(ctx context.Context, in ChunkArtifactInput) ([]model.Chunk, error) {
+	artifact, err := s.artifactRepo.GetByPath(ctx, in.DiskID, in.Path, in.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	assetData := artifact.AssetMeta.Data()
+	parser := fileparser.NewFileParser()
+	if !parser.CanParseFile(artifact.Filename, assetData.MIME) {
+		return nil, fmt.Errorf("unsupported file type: %s (mime: %s)", artifact.Filename, assetData.MIME)
+	}
+	content, err := s.s3.DownloadFile(ctx, assetData.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file content: %w", err)
+	}
+	fileContent, err := parser.ParseFile(artifact.Filename, assetData.MIME, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file content: %w", err)
+	}
+
+	return s.replaceChunks(ctx, in.ProjectID, model.ChunkSourceArtifact, artifact.ID, datatypes.JSONMap{
+		"disk_id":  in.DiskID.String(),
+		"path":     artifact.Path,
+		"filename": artifact.Filename,
+	}, fileContent.Raw, s.chunkerConfig(in.Config))
+}
+
+func (s *chunkService) ChunkBlock(ctx context.Context, in ChunkBlockInput) ([]model.Chunk, error) {
+	b, err := s.blockRepo.Get(ctx, in.BlockID)
+	if err != nil {
+		return nil, err
+	}
+	if b.SpaceID != in.SpaceID {
+		return nil, errors.New("block not found in space")
+	}
+
+	var children []model.Block
+	if b.Type == model.BlockTypePage {
+		children, err = s.blockRepo.ListBySpace(ctx, in.SpaceID, "", &b.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else if b.Type == model.BlockTypeFolder {
+		return nil, fmt.Errorf("block type '%s' has no content to chunk", b.Type)
+	}
+
+	return s.replaceChunks(ctx, in.ProjectID, model.ChunkSourceBlock, b.ID, datatypes.JSONMap{
+		"space_id": in.SpaceID.String(),
+		"block_id": b.ID.String(),
+		"type":     b.Type,
+	}, renderBlockMarkdown(b, children), s.chunkerConfig(in.Config))
+}
+
+func (s *chunkService) replaceChunks(ctx context.Context, projectID uuid.UUID, sourceType string, sourceID uuid.UUID, ref datatypes.JSONMap, text string, cfg chunker.Config) ([]model.Chunk, error) {
+	ck, err := chunker.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pieces, err := ck.Split(text)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]model.Chunk, 0, len(pieces))
+	for _, p := range pieces {
+		chunks = append(chunks, model.Chunk{
+			ProjectID:  projectID,
+			SourceType: sourceType,
+			SourceID:   sourceID,
+			SourceRef:  ref,
+			ChunkIndex: p.Index,
+			Heading:    p.Heading,
+			Content:    p.Text,
+			TokenCount: p.Tokens,
+		})
+	}
+
+	if err := s.r.ReplaceBySource(ctx, sourceType, sourceID, chunks); err != nil {
+		return nil, err
+	}
+
+	if s.publisher != nil {
+		if err := s.publisher.PublishJSON(ctx, s.cfg.RabbitMQ.ExchangeName.Embedding, s.cfg.RabbitMQ.RoutingKey.EmbeddingChunkUpsert, ChunkMQPublishJSON{
+			ProjectID:  projectID,
+			SourceType: sourceType,
+			SourceID:   sourceID,
+		}); err != nil {
+			s.log.Error("publish chunk upsert", zap.Error(err))
+		}
+	}
+
+	return chunks, nil
+}
+
+func (s *chunkService) ListArtifactChunks(ctx context.Context, diskID uuid.UUID, path string, filename string) ([]model.Chunk, error) {
+	artifact, err := s.artifactRepo.GetByPath(ctx, diskID, path, filename)
+	if err != nil {
+		return nil, err
+	}
+	return s.r.ListBySource(ctx, model.ChunkSourceArtifact, artifact.ID)
+}
+
+func (s *chunkService) ListBlockChunks(ctx context.Context, blockID uuid.UUID) ([]model.Chunk, error) {
+	return s.r.ListBySource(ctx, model.ChunkSourceBlock, blockID)
+}
+
+// renderBlockMarkdown renders a page (with its children) or a single content block as markdown,
+// so the headings strategy can split it at block boundaries
+func renderBlockMarkdown(b *model.Block, children []model.Block) string {
+	var sb strings.Builder
+	if b.Type == model.BlockTypePage {
+		sb.WriteString("# ")
+		sb.WriteString(b.Title)
+		sb.WriteString("\n\n")
+		for i := range children {
+			writeBlockSection(&sb, &children[i])
+		}
+		return sb.String()
+	}
+	writeBlockSection(&sb, b)
+	return sb.String()
+}
+
+func writeBlockSection(sb *strings.Builder, b *model.Block) {
+	props := b.Props.Data()
+	body := ""
+	switch b.Type {
+	case model.BlockTypeText:
+		body, _ = props["notes"].(string)
+	case model.BlockTypeSOP:
+		body, _ = props["preferences"].(string)
+	case model.BlockTypeMarkdown:
+		body, _ = props["content"].(string)
+	case model.BlockTypeCode:
+		language, _ := props["language"].(string)
+		code, _ := props["code"].(string)
+		body = "```" + language + "\n" + strings.TrimRight(code, "\n") + "\n```"
+	case model.BlockTypeTodo:
+		text, _ := props["text"].(string)
+		body = "- [ ] " + text
+		if checked, _ := props["checked"].(bool); checked {
+			body = "- [x] " + text
+		}
+	case model.BlockTypeTable:
+		body = renderTableMarkdown(props)
+	default:
+		return
+	}
+
+	sb.WriteString("## ")
+	sb.WriteString(b.Title)
+	sb.WriteString("\n\n")
+	if body != "" {
+		sb.WriteString(body)
+		sb.WriteString("\n\n")
+	}
+}
+
+// renderTableMarkdown renders the rows of a table block as a markdown table, empty cells for null
+func renderTableMarkdown(props map[string]any) string {
+	columns, err := model.TableColumns(props)
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeRow := func(cells []string) {
+		sb.WriteString("|")
+		for _, c := range cells {
+			sb.WriteString(" ")
+			sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(c, "|", "\\|"), "\n", " "))
+			sb.WriteString(" |")
+		}
+		sb.WriteString("\n")
+	}
+
+	cells := make([]string, len(columns))
+	for i, c := range columns {
+		cells[i] = c.Name
+	}
+	writeRow(cells)
+	for i := range cells {
+		cells[i] = "---"
+	}
+	writeRow(cells)
+	rows, _ := props["rows"].([]any)
+	for _, r := range rows {
+		row, _ := r.([]any)
+		for i := range cells {
+			cells[i] = ""
+			if i < len(row) && row[i] != nil {
+				cells[i] = fmt.Sprint(row[i])
+			}
+		}
+		writeRow(cells)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
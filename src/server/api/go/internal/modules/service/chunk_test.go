@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/chunker"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+// MockChunkRepo is a mock implementation of ChunkRepo
+type MockChunkRepo struct {
+	mock.Mock
+}
+
+func (m *MockChunkRepo) ReplaceBySource(ctx context.Context, sourceType string, sourceID uuid.UUID, chunks []model.Chunk) error {
+	args := m.Called(ctx, sourceType, sourceID, chunks)
+	return args.Error(0)
+}
+
+func (m *MockChunkRepo) ListBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) ([]model.Chunk, error) {
+	args := m.Called(ctx, sourceType, sourceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Chunk), args.Error(1)
+}
+
+func (m *MockChunkRepo) DeleteBySource(ctx context.Context, sourceType string, sourceID uuid.UUID) error {
+	args := m.Called(ctx, sourceType, sourceID)
+	return args.Error(0)
+}
+
+func TestChunkService_ChunkBlock(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+
+	ctx := context.Background()
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+
+	page := &model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage, Title: "Deploy"}
+	children := []model.Block{
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeText, Title: "Build", Props: datatypes.NewJSONType(map[string]any{"notes": "run make build"})},
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeText, Title: "Release", Props: datatypes.NewJSONType(map[string]any{"notes": "tag and push"})},
+	}
+	headings := &chunker.Config{Strategy: chunker.StrategyHeadings, MaxTokens: 256}
+
+	tests := []struct {
+		name       string
+		config     *chunker.Config
+		setup      func(*MockChunkRepo, *MockBlockRepo)
+		wantChunks int
+		wantErr    bool
+	}{
+		{
+			name:   "page split by headings",
+			config: headings,
+			setup: func(cr *MockChunkRepo, br *MockBlockRepo) {
+				br.On("Get", ctx, pageID).Return(page, nil)
+				br.On("ListBySpace", ctx, spaceID, "", &pageID).Return(children, nil)
+				cr.On("ReplaceBySource", ctx, model.ChunkSourceBlock, pageID, mock.MatchedBy(func(chunks []model.Chunk) bool {
+					return len(chunks) == 2 &&
+						chunks[0].Heading == "Build" &&
+						chunks[1].Heading == "Release" &&
+						chunks[1].ChunkIndex == 1 &&
+						chunks[0].SourceRef["space_id"] == spaceID.String()
+				})).Return(nil)
+			},
+			wantChunks: 2,
+		},
+		{
+			name:   "block in another space",
+			config: headings,
+			setup: func(cr *MockChunkRepo, br *MockBlockRepo) {
+				br.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: uuid.New(), Type: model.BlockTypePage}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "folder has no content",
+			config: headings,
+			setup: func(cr *MockChunkRepo, br *MockBlockRepo) {
+				br.On("Get", ctx, pageID).Return(&model.Block{ID: pageID, SpaceID: spaceID, Type: model.BlockTypeFolder}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "replace failed",
+			config: headings,
+			setup: func(cr *MockChunkRepo, br *MockBlockRepo) {
+				br.On("Get", ctx, pageID).Return(page, nil)
+				br.On("ListBySpace", ctx, spaceID, "", &pageID).Return(children, nil)
+				cr.On("ReplaceBySource", ctx, model.ChunkSourceBlock, pageID, mock.Anything).Return(errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunkRepo := &MockChunkRepo{}
+			blockRepo := &MockBlockRepo{}
+			tt.setup(chunkRepo, blockRepo)
+
+			svc := NewChunkService(chunkRepo, &MockArtifactRepo{}, blockRepo, nil, nil, &config.Config{}, zap.NewNop())
+			chunks, err := svc.ChunkBlock(ctx, ChunkBlockInput{
+				ProjectID: projectID,
+				SpaceID:   spaceID,
+				BlockID:   pageID,
+				Config:    tt.config,
+			})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, chunks, tt.wantChunks)
+			}
+
+			chunkRepo.AssertExpectations(t)
+			blockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRenderBlockMarkdown(t *testing.T) {
+	page := &model.Block{Type: model.BlockTypePage, Title: "Guide"}
+	children := []model.Block{
+		{Type: model.BlockTypeText, Title: "Intro", Props: datatypes.NewJSONType(map[string]any{"notes": "hello"})},
+		{Type: model.BlockTypeSOP, Title: "When deploying", Props: datatypes.NewJSONType(map[string]any{"preferences": "use blue/green"})},
+	}
+
+	out := renderBlockMarkdown(page, children)
+	assert.Equal(t, "# Guide\n\n## Intro\n\nhello\n\n## When deploying\n\nuse blue/green\n\n", out)
+}
+
+func TestRenderBlockMarkdown_DocumentBlocks(t *testing.T) {
+	page := &model.Block{Type: model.BlockTypePage, Title: "Runbook"}
+	children := []model.Block{
+		{Type: model.BlockTypeMarkdown, Title: "Overview", Props: datatypes.NewJSONType(map[string]any{"content": "Read *first*."})},
+		{Type: model.BlockTypeCode, Title: "Build", Props: datatypes.NewJSONType(map[string]any{"language": "sh", "code": "make build\n"})},
+		{Type: model.BlockTypeTodo, Title: "Release", Props: datatypes.NewJSONType(map[string]any{"checked": true, "text": "tag v1"})},
+		{Type: model.BlockTypeTable, Title: "Hosts", Props: datatypes.NewJSONType(map[string]any{
+			"columns": []any{map[string]any{"name": "host"}, map[string]any{"name": "cpus", "type": "number"}},
+			"rows":    []any{[]any{"a|b", 4.0}, []any{"c", nil}},
+		})},
+	}
+
+	out := renderBlockMarkdown(page, children)
+	assert.Equal(t, "# Runbook\n\n"+
+		"## Overview\n\nRead *first*.\n\n"+
+		"## Build\n\n```sh\nmake build\n```\n\n"+
+		"## Release\n\n- [x] tag v1\n\n"+
+		"## Hosts\n\n| host | cpus |\n| --- | --- |\n| a\\|b | 4 |\n| c |  |\n\n", out)
+}
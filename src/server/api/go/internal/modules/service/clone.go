@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCloneTargetProjectNotFound = errors.New("target project not found")
+	ErrCloneSpaceNotFound         = errors.New("space not found")
+)
+
+// CloneService copies spaces and sessions into another project, it backs the admin endpoints
+type CloneService interface {
+	CloneSpace(ctx context.Context, spaceID uuid.UUID, targetProjectID uuid.UUID) (*model.Space, error)
+	CloneSession(ctx context.Context, sessionID uuid.UUID, targetProjectID uuid.UUID) (*model.Session, error)
+}
+
+type cloneService struct {
+	r           repo.CloneRepo
+	sessionRepo repo.SessionRepo
+	s3          *blob.S3Deps
+}
+
+func NewCloneService(r repo.CloneRepo, sessionRepo repo.SessionRepo, s3 *blob.S3Deps) CloneService {
+	return &cloneService{
+		r:           r,
+		sessionRepo: sessionRepo,
+		s3:          s3,
+	}
+}
+
+func (s *cloneService) checkTargetProject(ctx context.Context, targetProjectID uuid.UUID) error {
+	exists, err := s.r.ProjectExists(ctx, targetProjectID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCloneTargetProjectNotFound
+	}
+	return nil
+}
+
+func (s *cloneService) CloneSpace(ctx context.Context, spaceID uuid.UUID, targetProjectID uuid.UUID) (*model.Space, error) {
+	src, err := s.r.GetSpace(ctx, spaceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCloneSpaceNotFound
+		}
+		return nil, err
+	}
+	if err := s.checkTargetProject(ctx, targetProjectID); err != nil {
+		return nil, err
+	}
+	return s.r.CloneSpace(ctx, src, targetProjectID)
+}
+
+// CloneSession copies a session with all its branches into the target project. The new session is not connected to a space.
+// Asset keys are scoped by project and an object is deleted when its project drops the last reference,
+// so the parts and their files are copied under the target project, which then holds its own references.
+func (s *cloneService) CloneSession(ctx context.Context, sessionID uuid.UUID, targetProjectID uuid.UUID) (*model.Session, error) {
+	src, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if err := s.checkTargetProject(ctx, targetProjectID); err != nil {
+		return nil, err
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list messages: %w", err)
+	}
+	// Fork needs parents before their children
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].ID.String() < msgs[j].ID.String()
+		}
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+
+	copied := map[string]string{}
+	for i := range msgs {
+		parts := []model.Part(msgs[i].InlineParts)
+		if !msgs[i].PartsInline() {
+			if err := s.s3.DownloadJSON(ctx, msgs[i].PartsAssetMeta.Data().S3Key, &parts); err != nil {
+				return nil, fmt.Errorf("download parts: %w", err)
+			}
+		}
+		for j := range parts {
+			a := parts[j].Asset
+			if a == nil || a.S3Key == "" {
+				continue
+			}
+			dst, ok := copied[a.S3Key]
+			if !ok {
+				dst = projectAssetKey(a.S3Key, "assets", src.ProjectID, targetProjectID)
+				if err := s.s3.CopyObject(ctx, a.S3Key, dst); err != nil {
+					return nil, err
+				}
+				copied[a.S3Key] = dst
+			}
+			cp := *a
+			cp.S3Key = dst
+			parts[j].Asset = &cp
+		}
+		// Sealed parts of the source are kept in the row of the copy, see storeParts
+		if msgs[i].PartsInline() || s.s3.Sealing() {
+			msgs[i].InlineParts = datatypes.NewJSONSlice(parts)
+			msgs[i].PartsAssetMeta = datatypes.NewJSONType(model.Asset{})
+			continue
+		}
+
+		asset, err := s.s3.UploadJSON(ctx, "parts/"+targetProjectID.String(), parts)
+		if err != nil {
+			return nil, fmt.Errorf("upload parts: %w", err)
+		}
+		msgs[i].PartsAssetMeta = datatypes.NewJSONType(*asset)
+	}
+
+	clone := &model.Session{
+		ProjectID:   targetProjectID,
+		Configs:     src.Configs,
+		Title:       src.Title,
+		Description: src.Description,
+		Tags:        src.Tags,
+	}
+	if err := s.sessionRepo.Fork(ctx, clone, msgs); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// projectAssetKey moves key from the <prefix>/<source project> folder to the one of the target project
+func projectAssetKey(key string, prefix string, sourceProjectID uuid.UUID, targetProjectID uuid.UUID) string {
+	target := prefix + "/" + targetProjectID.String() + "/"
+	if rest, ok := strings.CutPrefix(key, prefix+"/"+sourceProjectID.String()+"/"); ok {
+		return target + rest
+	}
+	return target + strings.TrimPrefix(key, "/")
+}
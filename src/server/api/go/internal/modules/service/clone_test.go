@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockCloneRepo struct {
+	mock.Mock
+}
+
+func (m *MockCloneRepo) ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, projectID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockCloneRepo) GetSpace(ctx context.Context, spaceID uuid.UUID) (*model.Space, error) {
+	args := m.Called(ctx, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Space), args.Error(1)
+}
+
+func (m *MockCloneRepo) CloneSpace(ctx context.Context, src *model.Space, targetProjectID uuid.UUID) (*model.Space, error) {
+	args := m.Called(ctx, src, targetProjectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Space), args.Error(1)
+}
+
+func TestCloneService_CloneSpace(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	targetID := uuid.New()
+	src := &model.Space{ID: spaceID, ProjectID: uuid.New()}
+
+	t.Run("success", func(t *testing.T) {
+		r := &MockCloneRepo{}
+		r.On("GetSpace", ctx, spaceID).Return(src, nil)
+		r.On("ProjectExists", ctx, targetID).Return(true, nil)
+		r.On("CloneSpace", ctx, src, targetID).Return(&model.Space{ID: uuid.New(), ProjectID: targetID}, nil)
+
+		space, err := NewCloneService(r, &MockSessionRepo{}, nil).CloneSpace(ctx, spaceID, targetID)
+		assert.NoError(t, err)
+		assert.Equal(t, targetID, space.ProjectID)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("space not found", func(t *testing.T) {
+		r := &MockCloneRepo{}
+		r.On("GetSpace", ctx, spaceID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewCloneService(r, &MockSessionRepo{}, nil).CloneSpace(ctx, spaceID, targetID)
+		assert.ErrorIs(t, err, ErrCloneSpaceNotFound)
+	})
+
+	t.Run("target project not found", func(t *testing.T) {
+		r := &MockCloneRepo{}
+		r.On("GetSpace", ctx, spaceID).Return(src, nil)
+		r.On("ProjectExists", ctx, targetID).Return(false, nil)
+
+		_, err := NewCloneService(r, &MockSessionRepo{}, nil).CloneSpace(ctx, spaceID, targetID)
+		assert.ErrorIs(t, err, ErrCloneTargetProjectNotFound)
+		r.AssertNotCalled(t, "CloneSpace", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestCloneService_CloneSession_NotFound(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+	_, err := NewCloneService(&MockCloneRepo{}, sessionRepo, nil).CloneSession(ctx, sessionID, uuid.New())
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestProjectAssetKey(t *testing.T) {
+	src := uuid.New()
+	dst := uuid.New()
+
+	assert.Equal(t, "assets/"+dst.String()+"/2025/01/02/abc.png",
+		projectAssetKey("assets/"+src.String()+"/2025/01/02/abc.png", "assets", src, dst))
+	// Keys outside of the project folder are nested under the target folder
+	assert.Equal(t, "assets/"+dst.String()+"/legacy/abc.png",
+		projectAssetKey("legacy/abc.png", "assets", src, dst))
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+)
+
+// Deprecation marks an endpoint, or a query parameter of an endpoint, as deprecated. Calls to it are answered with
+// the Deprecation header (RFC 9745), the Sunset header (RFC 8594) once a removal date is planned and a Link to the
+// migration notes, and are counted per project for the admin report.
+type Deprecation struct {
+	Method string `json:"method" example:"GET"`
+	// Path is the route of the endpoint as registered, e.g. /api/v1/session/:session_id/get_learning_status
+	Path string `json:"path" example:"/api/v1/session/:session_id/get_learning_status"`
+	// Param is the deprecated query parameter, empty when the whole endpoint is deprecated
+	Param        string    `json:"param,omitempty"`
+	DeprecatedAt time.Time `json:"deprecated_at"`
+	// Sunset is when the endpoint or parameter is removed, nil while no date is planned
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// Link is the documentation of the migration
+	Link string `json:"link,omitempty"`
+	// Note tells integrators what to use instead
+	Note string `json:"note,omitempty"`
+}
+
+// Key identifies the deprecation in the counts of calls, e.g. "GET /api/v1/session/:session_id/messages?format"
+func (d Deprecation) Key() string {
+	key := d.Method + " " + d.Path
+	if d.Param != "" {
+		key += "?" + d.Param
+	}
+	return key
+}
+
+// Deprecations are the deprecated endpoints and query parameters of the API. An entry is added when its replacement
+// ships and removed together with the endpoint or parameter, after its sunset, e.g.
+//
+//	{Method: http.MethodGet, Path: "/api/v1/session/:session_id/messages", Param: "format",
+//	 DeprecatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Note: "use the Accept header"}
+var Deprecations = []Deprecation{}
+
+// DeprecationReport is the use of the deprecations by projects since a day
+type DeprecationReport struct {
+	Since        time.Time          `json:"since"`
+	Deprecations []DeprecationUsage `json:"deprecations"`
+}
+
+type DeprecationUsage struct {
+	Deprecation
+	Key   string `json:"key"`
+	Calls int64  `json:"calls"`
+	// Projects are the projects that called the deprecation, most calls first
+	Projects []DeprecationProjectUsage `json:"projects"`
+}
+
+type DeprecationProjectUsage struct {
+	ProjectID    uuid.UUID `json:"project_id"`
+	Calls        int64     `json:"calls"`
+	LastCalledAt time.Time `json:"last_called_at"`
+}
+
+type DeprecationService interface {
+	// Match returns the deprecations a request to the route with the query uses
+	Match(method, path string, query url.Values) []Deprecation
+	// Record counts a call of the project to the deprecation, kept in memory until the next Flush
+	Record(projectID uuid.UUID, d Deprecation, at time.Time)
+	// Flush writes the calls recorded since the last Flush
+	Flush(ctx context.Context) error
+	Report(ctx context.Context, since time.Time) (*DeprecationReport, error)
+}
+
+type deprecatedCallKey struct {
+	projectID   uuid.UUID
+	deprecation string
+	day         time.Time
+}
+
+type deprecationService struct {
+	r            repo.DeprecatedCallRepo
+	deprecations []Deprecation
+	// routes indexes the deprecations by method and path
+	routes map[string][]Deprecation
+
+	mu      sync.Mutex
+	pending map[deprecatedCallKey]*model.DeprecatedCall
+}
+
+func NewDeprecationService(r repo.DeprecatedCallRepo, deprecations []Deprecation) DeprecationService {
+	s := &deprecationService{
+		r:            r,
+		deprecations: deprecations,
+		routes:       make(map[string][]Deprecation),
+		pending:      make(map[deprecatedCallKey]*model.DeprecatedCall),
+	}
+	for _, d := range deprecations {
+		route := d.Method + " " + d.Path
+		s.routes[route] = append(s.routes[route], d)
+	}
+	return s
+}
+
+func (s *deprecationService) Match(method, path string, query url.Values) []Deprecation {
+	var matched []Deprecation
+	for _, d := range s.routes[method+" "+path] {
+		if d.Param == "" || query.Has(d.Param) {
+			matched = append(matched, d)
+		}
+	}
+	return matched
+}
+
+func (s *deprecationService) Record(projectID uuid.UUID, d Deprecation, at time.Time) {
+	at = at.UTC()
+	key := deprecatedCallKey{projectID: projectID, deprecation: d.Key(), day: at.Truncate(24 * time.Hour)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call := s.pending[key]
+	if call == nil {
+		call = &model.DeprecatedCall{ProjectID: key.projectID, Deprecation: key.deprecation, Day: key.day}
+		s.pending[key] = call
+	}
+	call.Calls++
+	if at.After(call.LastCalledAt) {
+		call.LastCalledAt = at
+	}
+}
+
+// Flush writes the recorded calls. Calls that fail to be written are kept for the next Flush.
+func (s *deprecationService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[deprecatedCallKey]*model.DeprecatedCall)
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	calls := make([]model.DeprecatedCall, 0, len(pending))
+	for _, call := range pending {
+		calls = append(calls, *call)
+	}
+	if err := s.r.Add(ctx, calls); err != nil {
+		s.mu.Lock()
+		for key, call := range pending {
+			if cur := s.pending[key]; cur != nil {
+				cur.Calls += call.Calls
+				cur.LastCalledAt = maxTime(cur.LastCalledAt, call.LastCalledAt)
+			} else {
+				s.pending[key] = call
+			}
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Report returns the calls to every deprecation since a day, the calls recorded so far included, in the order of
+// the deprecations
+func (s *deprecationService) Report(ctx context.Context, since time.Time) (*DeprecationReport, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	since = since.UTC().Truncate(24 * time.Hour)
+	usage, err := s.r.Usage(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string][]DeprecationProjectUsage)
+	for _, u := range usage {
+		byKey[u.Deprecation] = append(byKey[u.Deprecation], DeprecationProjectUsage{
+			ProjectID:    u.ProjectID,
+			Calls:        u.Calls,
+			LastCalledAt: u.LastCalledAt,
+		})
+	}
+	report := &DeprecationReport{Since: since, Deprecations: make([]DeprecationUsage, 0, len(s.deprecations))}
+	for _, d := range s.deprecations {
+		du := DeprecationUsage{Deprecation: d, Key: d.Key(), Projects: byKey[d.Key()]}
+		if du.Projects == nil {
+			du.Projects = []DeprecationProjectUsage{}
+		}
+		for _, p := range du.Projects {
+			du.Calls += p.Calls
+		}
+		report.Deprecations = append(report.Deprecations, du)
+	}
+	return report, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeprecatedCallRepo sums the calls it is given like the upsert of the repository
+type fakeDeprecatedCallRepo struct {
+	calls map[string]*model.DeprecatedCall
+	err   error
+}
+
+func (r *fakeDeprecatedCallRepo) Add(ctx context.Context, calls []model.DeprecatedCall) error {
+	if r.err != nil {
+		return r.err
+	}
+	for _, c := range calls {
+		key := c.ProjectID.String() + c.Deprecation + c.Day.String()
+		if cur := r.calls[key]; cur != nil {
+			cur.Calls += c.Calls
+			cur.LastCalledAt = maxTime(cur.LastCalledAt, c.LastCalledAt)
+			continue
+		}
+		r.calls[key] = &c
+	}
+	return nil
+}
+
+func (r *fakeDeprecatedCallRepo) Usage(ctx context.Context, since time.Time) ([]repo.DeprecatedCallUsage, error) {
+	sums := map[string]*repo.DeprecatedCallUsage{}
+	for _, c := range r.calls {
+		if c.Day.Before(since) {
+			continue
+		}
+		key := c.Deprecation + c.ProjectID.String()
+		if sums[key] == nil {
+			sums[key] = &repo.DeprecatedCallUsage{Deprecation: c.Deprecation, ProjectID: c.ProjectID}
+		}
+		sums[key].Calls += c.Calls
+		sums[key].LastCalledAt = maxTime(sums[key].LastCalledAt, c.LastCalledAt)
+	}
+	var usage []repo.DeprecatedCallUsage
+	for _, u := range sums {
+		usage = append(usage, *u)
+	}
+	return usage, nil
+}
+
+func TestDeprecationService_Match(t *testing.T) {
+	endpoint := Deprecation{Method: http.MethodGet, Path: "/api/v1/session/:session_id/get_learning_status"}
+	param := Deprecation{Method: http.MethodGet, Path: "/api/v1/session/:session_id/messages", Param: "format"}
+	svc := NewDeprecationService(&fakeDeprecatedCallRepo{}, []Deprecation{endpoint, param})
+
+	assert.Equal(t, []Deprecation{endpoint}, svc.Match(http.MethodGet, endpoint.Path, url.Values{}))
+	assert.Empty(t, svc.Match(http.MethodPost, endpoint.Path, url.Values{}))
+	assert.Empty(t, svc.Match(http.MethodGet, param.Path, url.Values{"limit": {"10"}}))
+	assert.Equal(t, []Deprecation{param}, svc.Match(http.MethodGet, param.Path, url.Values{"format": {""}}))
+	assert.Equal(t, "GET /api/v1/session/:session_id/messages?format", param.Key())
+}
+
+func TestDeprecationService_Report(t *testing.T) {
+	ctx := context.Background()
+	used := Deprecation{Method: http.MethodGet, Path: "/api/v1/old"}
+	unused := Deprecation{Method: http.MethodGet, Path: "/api/v1/older"}
+	r := &fakeDeprecatedCallRepo{calls: map[string]*model.DeprecatedCall{}}
+	svc := NewDeprecationService(r, []Deprecation{used, unused})
+
+	p1, p2 := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	lastWeek := now.AddDate(0, 0, -7)
+	svc.Record(p1, used, lastWeek)
+	svc.Record(p1, used, yesterday)
+	svc.Record(p1, used, now)
+	svc.Record(p2, used, now)
+	require.NoError(t, svc.Flush(ctx))
+	// calls recorded after the last flush are in the report too
+	svc.Record(p1, used, now)
+
+	report, err := svc.Report(ctx, yesterday)
+	require.NoError(t, err)
+	assert.Equal(t, yesterday.Truncate(24*time.Hour), report.Since)
+	require.Len(t, report.Deprecations, 2)
+
+	u := report.Deprecations[0]
+	assert.Equal(t, used.Key(), u.Key)
+	assert.Equal(t, int64(4), u.Calls)
+	calls := map[uuid.UUID]int64{}
+	for _, p := range u.Projects {
+		calls[p.ProjectID] = p.Calls
+		assert.Equal(t, now, p.LastCalledAt)
+	}
+	assert.Equal(t, map[uuid.UUID]int64{p1: 3, p2: 1}, calls)
+
+	assert.Equal(t, unused.Key(), report.Deprecations[1].Key)
+	assert.Zero(t, report.Deprecations[1].Calls)
+	assert.Empty(t, report.Deprecations[1].Projects)
+}
+
+func TestDeprecationService_FlushKeepsFailedCalls(t *testing.T) {
+	ctx := context.Background()
+	d := Deprecation{Method: http.MethodGet, Path: "/api/v1/old"}
+	r := &fakeDeprecatedCallRepo{calls: map[string]*model.DeprecatedCall{}, err: errors.New("db down")}
+	svc := NewDeprecationService(r, []Deprecation{d})
+
+	projectID := uuid.New()
+	svc.Record(projectID, d, time.Now())
+	assert.Error(t, svc.Flush(ctx))
+	svc.Record(projectID, d, time.Now())
+
+	r.err = nil
+	require.NoError(t, svc.Flush(ctx))
+	require.Len(t, r.calls, 1)
+	for _, c := range r.calls {
+		assert.Equal(t, int64(2), c.Calls)
+	}
+}
@@ -15,6 +15,8 @@ import (
 type DiskService interface {
 	Create(ctx context.Context, projectID uuid.UUID) (*model.Disk, error)
 	Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) error
+	// Get returns a disk of any project, callers check its ProjectID
+	Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error)
 	List(ctx context.Context, in ListDisksInput) (*ListDisksOutput, error)
 }
 
@@ -43,6 +45,10 @@ func (s *diskService) Delete(ctx context.Context, projectID uuid.UUID, diskID uu
 	return s.r.Delete(ctx, projectID, diskID)
 }
 
+func (s *diskService) Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error) {
+	return s.r.Get(ctx, diskID)
+}
+
 type ListDisksInput struct {
 	ProjectID uuid.UUID `json:"project_id"`
 	Limit     int       `json:"limit"`
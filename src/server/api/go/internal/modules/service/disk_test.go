@@ -27,6 +27,14 @@ func (m *MockDiskRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID u
 	return args.Error(0)
 }
 
+func (m *MockDiskRepo) Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
 func (m *MockDiskRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error) {
 	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
@@ -83,6 +91,10 @@ func (s *testDiskService) Delete(ctx context.Context, projectID uuid.UUID, diskI
 	return s.r.Delete(ctx, projectID, diskID)
 }
 
+func (s *testDiskService) Get(ctx context.Context, diskID uuid.UUID) (*model.Disk, error) {
+	return s.r.Get(ctx, diskID)
+}
+
 func (s *testDiskService) List(ctx context.Context, in ListDisksInput) (*ListDisksOutput, error) {
 	disks, err := s.r.ListWithCursor(ctx, in.ProjectID, time.Time{}, uuid.UUID{}, in.Limit, in.TimeDesc)
 	if err != nil {
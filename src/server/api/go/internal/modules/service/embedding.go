@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmbeddingJobInProgress  = errors.New("a re-embedding job is already in progress for this project")
+	ErrEmbeddingJobNotActive   = errors.New("embedding job is not pending or running")
+	ErrEmbeddingSourceNotFound = errors.New("embedding source not found")
+	ErrEmbeddingSourceNoText   = errors.New("embedding source has no text to embed")
+)
+
+type EmbeddingService interface {
+	GetConfig(ctx context.Context, project *model.Project) *model.EmbeddingConfig
+	UpdateConfig(ctx context.Context, in UpdateEmbeddingConfigInput) (*UpdateEmbeddingConfigOutput, error)
+	ListJobs(ctx context.Context, in ListEmbeddingJobsInput) (*ListEmbeddingJobsOutput, error)
+	GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error)
+	CancelJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error)
+	Lookup(ctx context.Context, project *model.Project, sources []EmbeddingSource) ([]EmbeddingLookup, error)
+}
+
+type embeddingService struct {
+	r           repo.EmbeddingRepo
+	sessionSvc  SessionService
+	artifactSvc ArtifactService
+	diskSvc     DiskService
+	publisher   *mq.Publisher
+	cfg         *config.Config
+	log         *zap.Logger
+}
+
+func NewEmbeddingService(r repo.EmbeddingRepo, sessionSvc SessionService, artifactSvc ArtifactService, diskSvc DiskService, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger) EmbeddingService {
+	return &embeddingService{
+		r:           r,
+		sessionSvc:  sessionSvc,
+		artifactSvc: artifactSvc,
+		diskSvc:     diskSvc,
+		publisher:   publisher,
+		cfg:         cfg,
+		log:         log,
+	}
+}
+
+// GetConfig returns the embedding config of a project, falling back to the server defaults for unset fields
+func (s *embeddingService) GetConfig(ctx context.Context, project *model.Project) *model.EmbeddingConfig {
+	out := &model.EmbeddingConfig{
+		Provider:   s.cfg.Embedding.Provider,
+		Model:      s.cfg.Embedding.Model,
+		Dimensions: s.cfg.Embedding.Dimensions,
+	}
+	if project == nil || project.Configs == nil {
+		return out
+	}
+
+	raw, ok := project.Configs[model.ProjectEmbeddingConfigKey].(map[string]interface{})
+	if !ok {
+		return out
+	}
+	if v, ok := raw["provider"].(string); ok && v != "" {
+		out.Provider = v
+	}
+	if v, ok := raw["model"].(string); ok && v != "" {
+		out.Model = v
+	}
+	// JSON numbers are decoded as float64
+	if v, ok := raw["dimensions"].(float64); ok && v > 0 {
+		out.Dimensions = int(v)
+	}
+	if v, ok := raw["dimensions"].(int); ok && v > 0 {
+		out.Dimensions = v
+	}
+	return out
+}
+
+type UpdateEmbeddingConfigInput struct {
+	Project *model.Project        `json:"-"`
+	Config  model.EmbeddingConfig `json:"config"`
+}
+
+type UpdateEmbeddingConfigOutput struct {
+	Config model.EmbeddingConfig `json:"config"`
+	Job    *model.EmbeddingJob   `json:"job,omitempty"`
+}
+
+// EmbeddingJobMQPublishJSON is published when a re-embedding job is created
+type EmbeddingJobMQPublishJSON struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	JobID     uuid.UUID `json:"job_id"`
+}
+
+func (s *embeddingService) UpdateConfig(ctx context.Context, in UpdateEmbeddingConfigInput) (*UpdateEmbeddingConfigOutput, error) {
+	if in.Project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	current := s.GetConfig(ctx, in.Project)
+	next := in.Config
+	if next.Provider == "" {
+		next.Provider = current.Provider
+	}
+
+	// Vectors only become stale when the model or the dimensions change
+	var job *model.EmbeddingJob
+	if next.Model != current.Model || next.Dimensions != current.Dimensions {
+		active, err := s.r.GetActiveJob(ctx, in.Project.ID)
+		if err != nil {
+			return nil, err
+		}
+		if active != nil {
+			return nil, ErrEmbeddingJobInProgress
+		}
+
+		total, err := s.r.CountProjectBlocks(ctx, in.Project.ID)
+		if err != nil {
+			return nil, err
+		}
+		job = &model.EmbeddingJob{
+			ProjectID:      in.Project.ID,
+			Provider:       next.Provider,
+			Model:          next.Model,
+			Dimensions:     next.Dimensions,
+			PrevModel:      current.Model,
+			PrevDimensions: current.Dimensions,
+			Status:         model.EmbeddingJobStatusPending,
+			Total:          int(total),
+		}
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range in.Project.Configs {
+		configs[k] = v
+	}
+	configs[model.ProjectEmbeddingConfigKey] = map[string]interface{}{
+		"provider":   next.Provider,
+		"model":      next.Model,
+		"dimensions": next.Dimensions,
+	}
+
+	// The check above can race with another update, the database keeps a single active job
+	if err := s.r.UpdateConfigWithJob(ctx, in.Project.ID, configs, job); err != nil {
+		if errors.Is(err, repo.ErrEmbeddingJobActive) {
+			return nil, ErrEmbeddingJobInProgress
+		}
+		return nil, err
+	}
+	in.Project.Configs = configs
+
+	if job != nil && s.publisher != nil {
+		if err := s.publisher.PublishJSON(ctx, s.cfg.RabbitMQ.ExchangeName.Embedding, s.cfg.RabbitMQ.RoutingKey.EmbeddingReEmbed, EmbeddingJobMQPublishJSON{
+			ProjectID: in.Project.ID,
+			JobID:     job.ID,
+		}); err != nil {
+			s.log.Error("publish re-embedding job", zap.Error(err))
+			// Don't leave an orphan pending job blocking further config updates
+			if uerr := s.r.UpdateJobStatus(ctx, in.Project.ID, job.ID, model.EmbeddingJobStatusFailed); uerr != nil {
+				s.log.Error("mark re-embedding job failed", zap.Error(uerr))
+			}
+			return nil, fmt.Errorf("failed to publish re-embedding job: %w", err)
+		}
+	}
+
+	return &UpdateEmbeddingConfigOutput{
+		Config: next,
+		Job:    job,
+	}, nil
+}
+
+type ListEmbeddingJobsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+type ListEmbeddingJobsOutput struct {
+	Items      []model.EmbeddingJob `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	HasMore    bool                 `json:"has_more"`
+}
+
+func (s *embeddingService) ListJobs(ctx context.Context, in ListEmbeddingJobsInput) (*ListEmbeddingJobsOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	jobs, err := s.r.ListJobsWithCursor(ctx, in.ProjectID, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListEmbeddingJobsOutput{
+		Items:   jobs,
+		HasMore: false,
+	}
+	if len(jobs) > in.Limit {
+		out.HasMore = true
+		out.Items = jobs[:in.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return out, nil
+}
+
+func (s *embeddingService) GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	return s.r.GetJob(ctx, projectID, jobID)
+}
+
+func (s *embeddingService) CancelJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	job, err := s.r.GetJob(ctx, projectID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if !job.IsActive() {
+		return nil, ErrEmbeddingJobNotActive
+	}
+	if err := s.r.UpdateJobStatus(ctx, projectID, jobID, model.EmbeddingJobStatusCancelled); err != nil {
+		return nil, err
+	}
+	job.Status = model.EmbeddingJobStatusCancelled
+	return job, nil
+}
+
+// Types of the content an embedding is looked up for
+const (
+	EmbeddingSourceBlock    = "block"
+	EmbeddingSourceMessage  = "message"
+	EmbeddingSourceArtifact = "artifact"
+)
+
+// EmbeddingSource is a block, a message or an artifact of the project to get the embedding of
+type EmbeddingSource struct {
+	Type string
+	// ID of the block or of the message
+	ID uuid.UUID
+	// SessionID of the message
+	SessionID uuid.UUID
+	// DiskID, Path and Filename of the artifact
+	DiskID   uuid.UUID
+	Path     string
+	Filename string
+}
+
+// EmbeddingLookup is the stored embedding of a source, or else the text to embed for it
+type EmbeddingLookup struct {
+	Embedding []float32
+	Text      string
+}
+
+// Lookup returns the stored embedding of each block and of each message embedded with the embedding model of the
+// project, and the text to embed of the other messages and of artifacts, in the order of sources. The text of a
+// message is the text of its parts, the one of an artifact its parsed content. A source missing from the project,
+// or a block that is not embedded yet, fails with ErrEmbeddingSourceNotFound; a source without text fails with
+// ErrEmbeddingSourceNoText.
+func (s *embeddingService) Lookup(ctx context.Context, project *model.Project, sources []EmbeddingSource) ([]EmbeddingLookup, error) {
+	projectID := project.ID
+	var blockIDs, messageIDs []uuid.UUID
+	for _, src := range sources {
+		switch src.Type {
+		case EmbeddingSourceBlock:
+			blockIDs = append(blockIDs, src.ID)
+		case EmbeddingSourceMessage:
+			messageIDs = append(messageIDs, src.ID)
+		}
+	}
+	var stored map[uuid.UUID][]float32
+	if len(blockIDs) > 0 {
+		var err error
+		if stored, err = s.r.ListBlockEmbeddings(ctx, projectID, blockIDs); err != nil {
+			return nil, err
+		}
+	}
+	var storedMessages map[uuid.UUID][]float32
+	if len(messageIDs) > 0 {
+		var err error
+		if storedMessages, err = s.r.ListMessageEmbeddings(ctx, messageIDs, s.GetConfig(ctx, project).Model); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]EmbeddingLookup, len(sources))
+	for i, src := range sources {
+		switch src.Type {
+		case EmbeddingSourceBlock:
+			v, ok := stored[src.ID]
+			if !ok {
+				return nil, fmt.Errorf("%w: input %d: block %s is not in the project or not embedded yet", ErrEmbeddingSourceNotFound, i, src.ID)
+			}
+			out[i].Embedding = v
+		case EmbeddingSourceMessage:
+			ss, err := s.sessionSvc.GetByID(ctx, &model.Session{ID: src.SessionID})
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if err != nil || ss.ProjectID != projectID {
+				return nil, fmt.Errorf("%w: input %d: session %s", ErrEmbeddingSourceNotFound, i, src.SessionID)
+			}
+			msg, err := s.sessionSvc.GetMessage(ctx, src.SessionID, src.ID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, fmt.Errorf("%w: input %d: message %s", ErrEmbeddingSourceNotFound, i, src.ID)
+				}
+				return nil, err
+			}
+			if v, ok := storedMessages[msg.ID]; ok {
+				out[i].Embedding = v
+				continue
+			}
+			out[i].Text = MessageEmbeddingText(msg.Parts)
+		case EmbeddingSourceArtifact:
+			disk, err := s.diskSvc.Get(ctx, src.DiskID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if err != nil || disk.ProjectID != projectID {
+				return nil, fmt.Errorf("%w: input %d: disk %s", ErrEmbeddingSourceNotFound, i, src.DiskID)
+			}
+			artifact, err := s.artifactSvc.GetByPath(ctx, src.DiskID, src.Path, src.Filename)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, fmt.Errorf("%w: input %d: artifact %s%s", ErrEmbeddingSourceNotFound, i, src.Path, src.Filename)
+				}
+				return nil, err
+			}
+			content, err := s.artifactSvc.GetFileContent(ctx, artifact)
+			if err != nil {
+				return nil, fmt.Errorf("%w: input %d: %v", ErrEmbeddingSourceNoText, i, err)
+			}
+			out[i].Text = content.Raw
+		default:
+			return nil, fmt.Errorf("unknown embedding source type %q", src.Type)
+		}
+		if out[i].Embedding == nil && strings.TrimSpace(out[i].Text) == "" {
+			return nil, fmt.Errorf("%w: input %d", ErrEmbeddingSourceNoText, i)
+		}
+	}
+	return out, nil
+}
+
+// MessageEmbeddingText returns the text of a message that is embedded, the text its parts render to in a page
+func MessageEmbeddingText(parts []model.Part) string {
+	return syncMessageText(parts)
+}
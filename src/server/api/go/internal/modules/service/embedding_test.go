@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// MockEmbeddingRepo is a mock implementation of EmbeddingRepo
+type MockEmbeddingRepo struct {
+	mock.Mock
+}
+
+func (m *MockEmbeddingRepo) UpdateConfigWithJob(ctx context.Context, projectID uuid.UUID, configs datatypes.JSONMap, job *model.EmbeddingJob) error {
+	args := m.Called(ctx, projectID, configs, job)
+	return args.Error(0)
+}
+
+func (m *MockEmbeddingRepo) CountProjectBlocks(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, projectID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEmbeddingRepo) GetActiveJob(ctx context.Context, projectID uuid.UUID) (*model.EmbeddingJob, error) {
+	args := m.Called(ctx, projectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.EmbeddingJob), args.Error(1)
+}
+
+func (m *MockEmbeddingRepo) GetJob(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID) (*model.EmbeddingJob, error) {
+	args := m.Called(ctx, projectID, jobID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.EmbeddingJob), args.Error(1)
+}
+
+func (m *MockEmbeddingRepo) ListJobsWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.EmbeddingJob, error) {
+	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.EmbeddingJob), args.Error(1)
+}
+
+func (m *MockEmbeddingRepo) UpdateJobStatus(ctx context.Context, projectID uuid.UUID, jobID uuid.UUID, status string) error {
+	args := m.Called(ctx, projectID, jobID, status)
+	return args.Error(0)
+}
+
+func (m *MockEmbeddingRepo) ListBlockEmbeddings(ctx context.Context, projectID uuid.UUID, blockIDs []uuid.UUID) (map[uuid.UUID][]float32, error) {
+	args := m.Called(ctx, projectID, blockIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uuid.UUID][]float32), args.Error(1)
+}
+
+func (m *MockEmbeddingRepo) SetMessageEmbedding(ctx context.Context, e *model.MessageEmbedding) error {
+	args := m.Called(ctx, e)
+	return args.Error(0)
+}
+
+func (m *MockEmbeddingRepo) ListMessageEmbeddings(ctx context.Context, messageIDs []uuid.UUID, embeddingModel string) (map[uuid.UUID][]float32, error) {
+	args := m.Called(ctx, messageIDs, embeddingModel)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uuid.UUID][]float32), args.Error(1)
+}
+
+func newTestEmbeddingConfig() *config.Config {
+	return &config.Config{
+		Embedding: config.EmbeddingCfg{
+			Provider:   "openai",
+			Model:      "text-embedding-3-small",
+			Dimensions: 1536,
+		},
+	}
+}
+
+func TestEmbeddingService_GetConfig(t *testing.T) {
+	ctx := context.Background()
+	svc := NewEmbeddingService(&MockEmbeddingRepo{}, nil, nil, nil, nil, newTestEmbeddingConfig(), zap.NewNop())
+
+	t.Run("defaults when unset", func(t *testing.T) {
+		cfg := svc.GetConfig(ctx, &model.Project{ID: uuid.New()})
+		assert.Equal(t, "openai", cfg.Provider)
+		assert.Equal(t, "text-embedding-3-small", cfg.Model)
+		assert.Equal(t, 1536, cfg.Dimensions)
+	})
+
+	t.Run("project override", func(t *testing.T) {
+		cfg := svc.GetConfig(ctx, &model.Project{
+			ID: uuid.New(),
+			Configs: datatypes.JSONMap{
+				model.ProjectEmbeddingConfigKey: map[string]interface{}{
+					"model":      "jina-embeddings-v3",
+					"dimensions": float64(1024),
+				},
+			},
+		})
+		assert.Equal(t, "openai", cfg.Provider)
+		assert.Equal(t, "jina-embeddings-v3", cfg.Model)
+		assert.Equal(t, 1024, cfg.Dimensions)
+	})
+}
+
+func TestEmbeddingService_UpdateConfig(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	tests := []struct {
+		name    string
+		config  model.EmbeddingConfig
+		setup   func(*MockEmbeddingRepo)
+		wantJob bool
+		wantErr error
+	}{
+		{
+			name:   "unchanged model creates no job",
+			config: model.EmbeddingConfig{Model: "text-embedding-3-small", Dimensions: 1536},
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("UpdateConfigWithJob", ctx, projectID, mock.Anything, (*model.EmbeddingJob)(nil)).Return(nil)
+			},
+			wantJob: false,
+		},
+		{
+			name:   "changed model creates job",
+			config: model.EmbeddingConfig{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("GetActiveJob", ctx, projectID).Return(nil, nil)
+				repo.On("CountProjectBlocks", ctx, projectID).Return(int64(42), nil)
+				repo.On("UpdateConfigWithJob", ctx, projectID, mock.Anything, mock.MatchedBy(func(j *model.EmbeddingJob) bool {
+					return j != nil &&
+						j.Model == "text-embedding-3-large" &&
+						j.PrevModel == "text-embedding-3-small" &&
+						j.Total == 42 &&
+						j.Status == model.EmbeddingJobStatusPending
+				})).Return(nil)
+			},
+			wantJob: true,
+		},
+		{
+			name:   "job already in progress",
+			config: model.EmbeddingConfig{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("GetActiveJob", ctx, projectID).Return(&model.EmbeddingJob{ID: uuid.New(), Status: model.EmbeddingJobStatusRunning}, nil)
+			},
+			wantErr: ErrEmbeddingJobInProgress,
+		},
+		{
+			name:   "job created concurrently",
+			config: model.EmbeddingConfig{Model: "text-embedding-3-large", Dimensions: 3072},
+			setup: func(r *MockEmbeddingRepo) {
+				r.On("GetActiveJob", ctx, projectID).Return(nil, nil)
+				r.On("CountProjectBlocks", ctx, projectID).Return(int64(42), nil)
+				r.On("UpdateConfigWithJob", ctx, projectID, mock.Anything, mock.Anything).Return(repo.ErrEmbeddingJobActive)
+			},
+			wantErr: ErrEmbeddingJobInProgress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockEmbeddingRepo{}
+			tt.setup(repo)
+
+			svc := NewEmbeddingService(repo, nil, nil, nil, nil, newTestEmbeddingConfig(), zap.NewNop())
+			out, err := svc.UpdateConfig(ctx, UpdateEmbeddingConfigInput{
+				Project: &model.Project{ID: projectID},
+				Config:  tt.config,
+			})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantJob, out.Job != nil)
+				assert.Equal(t, tt.config.Model, out.Config.Model)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmbeddingService_CancelJob(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	jobID := uuid.New()
+
+	tests := []struct {
+		name    string
+		setup   func(*MockEmbeddingRepo)
+		wantErr bool
+	}{
+		{
+			name: "cancel running job",
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("GetJob", ctx, projectID, jobID).Return(&model.EmbeddingJob{ID: jobID, Status: model.EmbeddingJobStatusRunning}, nil)
+				repo.On("UpdateJobStatus", ctx, projectID, jobID, model.EmbeddingJobStatusCancelled).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "finished job cannot be cancelled",
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("GetJob", ctx, projectID, jobID).Return(&model.EmbeddingJob{ID: jobID, Status: model.EmbeddingJobStatusSuccess}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "job not found",
+			setup: func(repo *MockEmbeddingRepo) {
+				repo.On("GetJob", ctx, projectID, jobID).Return(nil, errors.New("record not found"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockEmbeddingRepo{}
+			tt.setup(repo)
+
+			svc := NewEmbeddingService(repo, nil, nil, nil, nil, newTestEmbeddingConfig(), zap.NewNop())
+			job, err := svc.CancelJob(ctx, projectID, jobID)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.EmbeddingJobStatusCancelled, job.Status)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmbeddingService_Lookup(t *testing.T) {
+	ctx := context.Background()
+	project := &model.Project{ID: uuid.New()}
+	projectID := project.ID
+	sessionID := uuid.New()
+	blockID, messageID, embeddedID := uuid.New(), uuid.New(), uuid.New()
+	msg := &model.Message{ID: messageID, SessionID: sessionID, Role: "user", InlineParts: datatypes.JSONSlice[model.Part]{{Type: "text", Text: "hello"}}}
+	empty := &model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", InlineParts: datatypes.JSONSlice[model.Part]{{Type: "image"}}}
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	sessionRepo.On("GetMessage", ctx, sessionID, messageID).Return(msg, nil)
+	sessionRepo.On("GetMessage", ctx, sessionID, empty.ID).Return(empty, nil)
+	sessionRepo.On("GetMessage", ctx, sessionID, embeddedID).Return(&model.Message{ID: embeddedID, SessionID: sessionID, Role: "user"}, nil)
+	sessions := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	r := &MockEmbeddingRepo{}
+	r.On("ListBlockEmbeddings", ctx, projectID, []uuid.UUID{blockID}).Return(map[uuid.UUID][]float32{blockID: {1, 0}}, nil)
+	r.On("ListMessageEmbeddings", ctx, mock.Anything, "text-embedding-3-small").Return(map[uuid.UUID][]float32{embeddedID: {0, 1}}, nil)
+	foreignDiskID, missingDiskID := uuid.New(), uuid.New()
+	diskRepo := &MockDiskRepo{}
+	diskRepo.On("Get", ctx, foreignDiskID).Return(&model.Disk{ID: foreignDiskID, ProjectID: uuid.New()}, nil)
+	diskRepo.On("Get", ctx, missingDiskID).Return(nil, gorm.ErrRecordNotFound)
+	svc := NewEmbeddingService(r, sessions, nil, NewDiskService(diskRepo), nil, newTestEmbeddingConfig(), zap.NewNop())
+
+	out, err := svc.Lookup(ctx, project, []EmbeddingSource{
+		{Type: EmbeddingSourceMessage, ID: messageID, SessionID: sessionID},
+		{Type: EmbeddingSourceBlock, ID: blockID},
+		{Type: EmbeddingSourceMessage, ID: embeddedID, SessionID: sessionID},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []EmbeddingLookup{{Text: "hello"}, {Embedding: []float32{1, 0}}, {Embedding: []float32{0, 1}}}, out)
+	}
+
+	_, err = svc.Lookup(ctx, &model.Project{ID: uuid.New()}, []EmbeddingSource{{Type: EmbeddingSourceMessage, ID: messageID, SessionID: sessionID}})
+	assert.ErrorIs(t, err, ErrEmbeddingSourceNotFound)
+
+	_, err = svc.Lookup(ctx, project, []EmbeddingSource{{Type: EmbeddingSourceMessage, ID: empty.ID, SessionID: sessionID}})
+	assert.ErrorIs(t, err, ErrEmbeddingSourceNoText)
+
+	// Artifacts of the disks of other projects are not read
+	for _, diskID := range []uuid.UUID{foreignDiskID, missingDiskID} {
+		_, err = svc.Lookup(ctx, project, []EmbeddingSource{{Type: EmbeddingSourceArtifact, DiskID: diskID, Path: "/", Filename: "notes.md"}})
+		assert.ErrorIs(t, err, ErrEmbeddingSourceNotFound)
+	}
+}
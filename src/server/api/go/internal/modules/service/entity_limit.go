@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+)
+
+// Limits on the size of single entities
+const (
+	LimitMessagesPerSession = "messages_per_session"
+	LimitChildrenPerBlock   = "children_per_block"
+)
+
+// EntityLimit is the usage of an entity against one of its limits, a limit of 0 is disabled
+type EntityLimit struct {
+	Limit string `json:"limit" enums:"messages_per_session,children_per_block"`
+	Used  int64  `json:"used"`
+	Soft  int64  `json:"soft"`
+	Hard  int64  `json:"hard"`
+}
+
+// LimitExceededError reports a write refused because the entity is at its hard limit
+type LimitExceededError struct {
+	EntityLimit
+	// Requested is the number of items the refused write would have added
+	Requested int64 `json:"requested"`
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %d of %d used, %d requested", e.Limit, e.Used, e.Hard, e.Requested)
+}
+
+// EntityLimitService keeps single sessions and blocks from growing without bound.
+// A check returns the usage when the write reaches the soft limit, so clients can be warned before the hard limit
+// refuses writes with a *LimitExceededError.
+type EntityLimitService interface {
+	CheckSessionMessages(ctx context.Context, sessionID uuid.UUID, adding int64) (*EntityLimit, error)
+	CheckBlockChildren(ctx context.Context, parentID uuid.UUID, adding int64) (*EntityLimit, error)
+	// CheckNewBlockChildren checks the children of blocks whose children are all written by one request, e.g. the
+	// pages of an import, against the hard limit without counting them
+	CheckNewBlockChildren(children map[uuid.UUID]int64) error
+}
+
+type entityLimitService struct {
+	r   repo.EntityLimitRepo
+	cfg config.LimitsCfg
+}
+
+func NewEntityLimitService(r repo.EntityLimitRepo, cfg *config.Config) EntityLimitService {
+	s := &entityLimitService{r: r}
+	if cfg != nil {
+		s.cfg = cfg.Limits
+	}
+	return s
+}
+
+func (s *entityLimitService) CheckSessionMessages(ctx context.Context, sessionID uuid.UUID, adding int64) (*EntityLimit, error) {
+	return s.check(LimitMessagesPerSession, s.cfg.MessagesPerSessionSoft, s.cfg.MessagesPerSessionHard, adding, func() (int64, error) {
+		return s.r.CountSessionMessages(ctx, sessionID)
+	})
+}
+
+func (s *entityLimitService) CheckBlockChildren(ctx context.Context, parentID uuid.UUID, adding int64) (*EntityLimit, error) {
+	return s.check(LimitChildrenPerBlock, s.cfg.ChildrenPerBlockSoft, s.cfg.ChildrenPerBlockHard, adding, func() (int64, error) {
+		return s.r.CountBlockChildren(ctx, parentID)
+	})
+}
+
+func (s *entityLimitService) CheckNewBlockChildren(children map[uuid.UUID]int64) error {
+	hard := s.cfg.ChildrenPerBlockHard
+	if hard <= 0 {
+		return nil
+	}
+	for _, n := range children {
+		if n > hard {
+			return &LimitExceededError{EntityLimit: EntityLimit{Limit: LimitChildrenPerBlock, Soft: s.cfg.ChildrenPerBlockSoft, Hard: hard}, Requested: n}
+		}
+	}
+	return nil
+}
+
+// checkBlockWrite refuses a write of blocks that takes a block over its hard children limit, limits nil disables it.
+// The blocks written under parentID are added to its children, the others are all the children of their parent.
+func checkBlockWrite(ctx context.Context, limits EntityLimitService, parentID *uuid.UUID, blocks []model.Block) error {
+	if limits == nil {
+		return nil
+	}
+	var adding int64
+	children := map[uuid.UUID]int64{}
+	for _, b := range blocks {
+		switch {
+		case b.ParentID == nil:
+		case parentID != nil && *b.ParentID == *parentID:
+			adding++
+		default:
+			children[*b.ParentID]++
+		}
+	}
+	if adding > 0 {
+		if _, err := limits.CheckBlockChildren(ctx, *parentID, adding); err != nil {
+			return err
+		}
+	}
+	return limits.CheckNewBlockChildren(children)
+}
+
+func (s *entityLimitService) check(name string, soft, hard, adding int64, count func() (int64, error)) (*EntityLimit, error) {
+	if soft <= 0 && hard <= 0 {
+		return nil, nil
+	}
+	used, err := count()
+	if err != nil {
+		return nil, fmt.Errorf("count %s: %w", name, err)
+	}
+	usage := &EntityLimit{Limit: name, Used: used, Soft: soft, Hard: hard}
+	if hard > 0 && used+adding > hard {
+		return nil, &LimitExceededError{EntityLimit: *usage, Requested: adding}
+	}
+	if soft > 0 && used+adding >= soft {
+		return usage, nil
+	}
+	return nil, nil
+}
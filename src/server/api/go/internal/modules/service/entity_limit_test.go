@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEntityLimitRepo struct {
+	messages int64
+	children int64
+	err      error
+}
+
+func (r *fakeEntityLimitRepo) CountSessionMessages(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	return r.messages, r.err
+}
+
+func (r *fakeEntityLimitRepo) CountBlockChildren(ctx context.Context, parentID uuid.UUID) (int64, error) {
+	return r.children, r.err
+}
+
+func TestEntityLimitService_CheckSessionMessages(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Limits: config.LimitsCfg{MessagesPerSessionSoft: 8, MessagesPerSessionHard: 10}}
+
+	tests := []struct {
+		name     string
+		messages int64
+		adding   int64
+		warn     bool
+		exceeded bool
+	}{
+		{"under the soft limit", 5, 1, false, false},
+		{"reaches the soft limit", 7, 1, true, false},
+		{"reaches the hard limit", 9, 1, true, false},
+		{"over the hard limit", 10, 1, false, true},
+		{"turn over the hard limit", 8, 3, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewEntityLimitService(&fakeEntityLimitRepo{messages: tt.messages}, cfg)
+			usage, err := svc.CheckSessionMessages(ctx, uuid.New(), tt.adding)
+			if tt.exceeded {
+				var exceeded *LimitExceededError
+				require.ErrorAs(t, err, &exceeded)
+				assert.Equal(t, LimitMessagesPerSession, exceeded.Limit)
+				assert.Equal(t, int64(10), exceeded.Hard)
+				assert.Equal(t, tt.adding, exceeded.Requested)
+				return
+			}
+			require.NoError(t, err)
+			if tt.warn {
+				require.NotNil(t, usage)
+				assert.Equal(t, tt.messages, usage.Used)
+			} else {
+				assert.Nil(t, usage)
+			}
+		})
+	}
+}
+
+func TestEntityLimitService_CheckBlockChildren(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("disabled limits do not count", func(t *testing.T) {
+		svc := NewEntityLimitService(&fakeEntityLimitRepo{err: errors.New("unreachable")}, &config.Config{})
+		usage, err := svc.CheckBlockChildren(ctx, uuid.New(), 1)
+		assert.NoError(t, err)
+		assert.Nil(t, usage)
+	})
+
+	t.Run("hard limit only", func(t *testing.T) {
+		svc := NewEntityLimitService(&fakeEntityLimitRepo{children: 3}, &config.Config{Limits: config.LimitsCfg{ChildrenPerBlockHard: 3}})
+		_, err := svc.CheckBlockChildren(ctx, uuid.New(), 1)
+		var exceeded *LimitExceededError
+		require.ErrorAs(t, err, &exceeded)
+		assert.Equal(t, LimitChildrenPerBlock, exceeded.Limit)
+	})
+
+	t.Run("count failure", func(t *testing.T) {
+		svc := NewEntityLimitService(&fakeEntityLimitRepo{err: errors.New("db down")}, &config.Config{Limits: config.LimitsCfg{ChildrenPerBlockSoft: 1}})
+		_, err := svc.CheckBlockChildren(ctx, uuid.New(), 1)
+		assert.ErrorContains(t, err, "db down")
+	})
+}
+
+func TestCheckBlockWrite(t *testing.T) {
+	ctx := context.Background()
+	parentID := uuid.New()
+	copyID := uuid.New()
+	blocks := []model.Block{
+		{ID: copyID, ParentID: &parentID},
+		{ID: uuid.New(), ParentID: &copyID},
+		{ID: uuid.New(), ParentID: &copyID},
+		{ID: uuid.New(), ParentID: &copyID},
+	}
+	limits := func(children, hard int64) EntityLimitService {
+		return NewEntityLimitService(&fakeEntityLimitRepo{children: children}, &config.Config{Limits: config.LimitsCfg{ChildrenPerBlockHard: hard}})
+	}
+
+	assert.NoError(t, checkBlockWrite(ctx, nil, &parentID, blocks))
+	assert.NoError(t, checkBlockWrite(ctx, limits(2, 3), &parentID, blocks))
+
+	// the parent of the write counts its existing children
+	var exceeded *LimitExceededError
+	require.ErrorAs(t, checkBlockWrite(ctx, limits(3, 3), &parentID, blocks), &exceeded)
+	assert.Equal(t, int64(1), exceeded.Requested)
+
+	// the children of a written block are all written
+	require.ErrorAs(t, checkBlockWrite(ctx, limits(0, 2), &parentID, blocks), &exceeded)
+	assert.Equal(t, int64(3), exceeded.Requested)
+	assert.Equal(t, int64(0), exceeded.Used)
+}
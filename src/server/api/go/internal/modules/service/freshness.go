@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+// defaultStaleMaxAge is used when freshness.maxAgeDays is not configured
+const defaultStaleMaxAge = 90 * 24 * time.Hour
+
+type FreshnessService interface {
+	VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID) (*model.Block, error)
+	VerifyArtifact(ctx context.Context, in VerifyArtifactInput) (*model.Artifact, error)
+	Scan(ctx context.Context, in ScanStaleInput) (*ScanStaleOutput, error)
+	ListReviewQueue(ctx context.Context, in ListStaleItemsInput) (*ListStaleItemsOutput, error)
+}
+
+type freshnessService struct {
+	r   repo.FreshnessRepo
+	cfg *config.Config
+}
+
+func NewFreshnessService(r repo.FreshnessRepo, cfg *config.Config) FreshnessService {
+	return &freshnessService{
+		r:   r,
+		cfg: cfg,
+	}
+}
+
+func (s *freshnessService) VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID) (*model.Block, error) {
+	return s.r.VerifyBlock(ctx, projectID, spaceID, blockID, time.Now())
+}
+
+type VerifyArtifactInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	Path      string
+	Filename  string
+}
+
+func (s *freshnessService) VerifyArtifact(ctx context.Context, in VerifyArtifactInput) (*model.Artifact, error) {
+	return s.r.VerifyArtifact(ctx, in.ProjectID, in.DiskID, in.Path, in.Filename, time.Now())
+}
+
+type ScanStaleInput struct {
+	ProjectID *uuid.UUID    // [Optional] nil scans all projects
+	MaxAge    time.Duration // [Optional] overrides freshness.maxAgeDays
+}
+
+type ScanStaleOutput struct {
+	Flagged int64     `json:"flagged"`
+	Cutoff  time.Time `json:"cutoff"`
+}
+
+// Scan flags the items not verified or updated within the max age, see FreshnessRepo.FlagStale
+func (s *freshnessService) Scan(ctx context.Context, in ScanStaleInput) (*ScanStaleOutput, error) {
+	maxAge := in.MaxAge
+	if maxAge <= 0 {
+		maxAge = time.Duration(s.cfg.Freshness.MaxAgeDays) * 24 * time.Hour
+	}
+	if maxAge <= 0 {
+		maxAge = defaultStaleMaxAge
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	flagged, err := s.r.FlagStale(ctx, in.ProjectID, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return &ScanStaleOutput{Flagged: flagged, Cutoff: cutoff}, nil
+}
+
+type ListStaleItemsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	ItemType  string    `json:"item_type"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+type ListStaleItemsOutput struct {
+	Items      []model.StaleItem `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	HasMore    bool              `json:"has_more"`
+}
+
+func (s *freshnessService) ListReviewQueue(ctx context.Context, in ListStaleItemsInput) (*ListStaleItemsOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	items, err := s.r.ListStaleWithCursor(ctx, in.ProjectID, in.ItemType, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListStaleItemsOutput{
+		Items:   items,
+		HasMore: false,
+	}
+	if len(items) > in.Limit {
+		out.HasMore = true
+		out.Items = items[:in.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockFreshnessRepo is a mock implementation of FreshnessRepo
+type MockFreshnessRepo struct {
+	mock.Mock
+}
+
+func (m *MockFreshnessRepo) VerifyBlock(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, blockID uuid.UUID, at time.Time) (*model.Block, error) {
+	args := m.Called(ctx, projectID, spaceID, blockID, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockFreshnessRepo) VerifyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, at time.Time) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, path, filename, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockFreshnessRepo) FlagStale(ctx context.Context, projectID *uuid.UUID, cutoff time.Time) (int64, error) {
+	args := m.Called(ctx, projectID, cutoff)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockFreshnessRepo) ListStaleWithCursor(ctx context.Context, projectID uuid.UUID, itemType string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.StaleItem, error) {
+	args := m.Called(ctx, projectID, itemType, afterCreatedAt, afterID, limit, timeDesc)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.StaleItem), args.Error(1)
+}
+
+// cutoffAround matches a cutoff maxAge before now, within a minute
+func cutoffAround(maxAge time.Duration) interface{} {
+	return mock.MatchedBy(func(cutoff time.Time) bool {
+		d := time.Since(cutoff) - maxAge
+		return d >= 0 && d < time.Minute
+	})
+}
+
+func TestFreshnessService_Scan(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	tests := []struct {
+		name        string
+		cfgMaxAge   int
+		in          ScanStaleInput
+		setup       func(*MockFreshnessRepo)
+		wantFlagged int64
+		wantErr     bool
+	}{
+		{
+			name:      "configured max age",
+			cfgMaxAge: 30,
+			in:        ScanStaleInput{ProjectID: &projectID},
+			setup: func(r *MockFreshnessRepo) {
+				r.On("FlagStale", ctx, &projectID, cutoffAround(30*24*time.Hour)).Return(int64(2), nil)
+			},
+			wantFlagged: 2,
+		},
+		{
+			name:      "override max age",
+			cfgMaxAge: 30,
+			in:        ScanStaleInput{ProjectID: &projectID, MaxAge: 7 * 24 * time.Hour},
+			setup: func(r *MockFreshnessRepo) {
+				r.On("FlagStale", ctx, &projectID, cutoffAround(7*24*time.Hour)).Return(int64(5), nil)
+			},
+			wantFlagged: 5,
+		},
+		{
+			name: "all projects with default max age",
+			in:   ScanStaleInput{},
+			setup: func(r *MockFreshnessRepo) {
+				r.On("FlagStale", ctx, (*uuid.UUID)(nil), cutoffAround(defaultStaleMaxAge)).Return(int64(0), nil)
+			},
+		},
+		{
+			name: "repo error",
+			in:   ScanStaleInput{ProjectID: &projectID},
+			setup: func(r *MockFreshnessRepo) {
+				r.On("FlagStale", ctx, &projectID, mock.Anything).Return(int64(0), errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockFreshnessRepo{}
+			tt.setup(repo)
+
+			cfg := &config.Config{Freshness: config.FreshnessCfg{MaxAgeDays: tt.cfgMaxAge}}
+			out, err := NewFreshnessService(repo, cfg).Scan(ctx, tt.in)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantFlagged, out.Flagged)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFreshnessService_ListReviewQueue(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	items := []model.StaleItem{
+		{ID: uuid.New(), ProjectID: projectID, ItemType: model.StaleItemTypeBlock, CreatedAt: time.Now()},
+		{ID: uuid.New(), ProjectID: projectID, ItemType: model.StaleItemTypeBlock, CreatedAt: time.Now()},
+	}
+
+	repo := &MockFreshnessRepo{}
+	repo.On("ListStaleWithCursor", ctx, projectID, model.StaleItemTypeBlock, time.Time{}, uuid.Nil, 2, false).Return(items, nil)
+
+	out, err := NewFreshnessService(repo, &config.Config{}).ListReviewQueue(ctx, ListStaleItemsInput{
+		ProjectID: projectID,
+		ItemType:  model.StaleItemTypeBlock,
+		Limit:     1,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, out.Items, 1)
+	assert.True(t, out.HasMore)
+	assert.NotEmpty(t, out.NextCursor)
+	repo.AssertExpectations(t)
+}
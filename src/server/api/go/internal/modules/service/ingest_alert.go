@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+var ErrInvalidIngestAlertPolicy = errors.New("ingest alerts need positive window_minutes and baseline_windows, and a spike_factor above 1 or a drop_factor between 0 and 1")
+
+// defaultIngestRatePolicy shapes the ingest rate of projects without ingest alerts
+var defaultIngestRatePolicy = model.IngestAlertPolicy{WindowMinutes: 60, BaselineWindows: 24}
+
+type IngestAlertService interface {
+	Get(ctx context.Context, project *model.Project) *model.IngestAlertPolicy
+	Update(ctx context.Context, project *model.Project, policy *model.IngestAlertPolicy) (*model.IngestAlertPolicy, error)
+	Rate(ctx context.Context, project *model.Project, now time.Time) (*IngestRate, error)
+	Check(ctx context.Context, now time.Time) (*CheckIngestAlertsOutput, error)
+}
+
+type ingestAlertService struct {
+	projectRepo   repo.ProjectRepo
+	ingestRepo    repo.IngestRepo
+	notifications repo.NotificationRepo
+	notifier      NotificationService
+	log           *zap.Logger
+}
+
+func NewIngestAlertService(projectRepo repo.ProjectRepo, ingestRepo repo.IngestRepo, notifications repo.NotificationRepo, notifier NotificationService, log *zap.Logger) IngestAlertService {
+	return &ingestAlertService{
+		projectRepo:   projectRepo,
+		ingestRepo:    ingestRepo,
+		notifications: notifications,
+		notifier:      notifier,
+		log:           log,
+	}
+}
+
+// Get returns the ingest alerts of the project, nil when they are disabled
+func (s *ingestAlertService) Get(ctx context.Context, project *model.Project) *model.IngestAlertPolicy {
+	return project.IngestAlerts()
+}
+
+// Update replaces the ingest alerts of the project, a nil policy disables them
+func (s *ingestAlertService) Update(ctx context.Context, project *model.Project, policy *model.IngestAlertPolicy) (*model.IngestAlertPolicy, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if policy == nil {
+		delete(configs, model.ProjectIngestAlertsConfigKey)
+	} else {
+		spike := policy.SpikeFactor > 1
+		drop := policy.DropFactor > 0 && policy.DropFactor < 1
+		if policy.WindowMinutes <= 0 || policy.BaselineWindows <= 0 || policy.MinMessages < 0 ||
+			!spike && !drop || policy.SpikeFactor != 0 && !spike || policy.DropFactor != 0 && !drop {
+			return nil, ErrInvalidIngestAlertPolicy
+		}
+		configs[model.ProjectIngestAlertsConfigKey] = map[string]interface{}{
+			"window_minutes":   policy.WindowMinutes,
+			"baseline_windows": policy.BaselineWindows,
+			"spike_factor":     policy.SpikeFactor,
+			"drop_factor":      policy.DropFactor,
+			"min_messages":     policy.MinMessages,
+		}
+	}
+
+	if err := s.projectRepo.SetConfig(ctx, project.ID, model.ProjectIngestAlertsConfigKey, configs[model.ProjectIngestAlertsConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.IngestAlerts(), nil
+}
+
+type IngestRate struct {
+	WindowMinutes int `json:"window_minutes"`
+	// Windows holds the messages stored per window, the current window first, then the baseline windows
+	Windows []IngestWindow `json:"windows"`
+	// Baseline is the average of the baseline windows
+	Baseline float64 `json:"baseline"`
+}
+
+type IngestWindow struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Messages int64     `json:"messages"`
+}
+
+// Rate returns the messages stored in the project per window, shaped by its ingest alerts or hourly over a day without them
+func (s *ingestAlertService) Rate(ctx context.Context, project *model.Project, now time.Time) (*IngestRate, error) {
+	policy := project.IngestAlerts()
+	if policy == nil || policy.WindowMinutes <= 0 || policy.BaselineWindows <= 0 {
+		policy = &defaultIngestRatePolicy
+	}
+	window := time.Duration(policy.WindowMinutes) * time.Minute
+	counts, err := s.ingestRepo.WindowCounts(ctx, project.ID, now, window, policy.BaselineWindows+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &IngestRate{WindowMinutes: policy.WindowMinutes, Windows: make([]IngestWindow, len(counts)), Baseline: ingestBaseline(counts)}
+	for i, c := range counts {
+		end := now.Add(-time.Duration(i) * window)
+		out.Windows[i] = IngestWindow{Start: end.Add(-window), End: end, Messages: c}
+	}
+	return out, nil
+}
+
+// IngestAlertCheckLockKey is the advisory lock key that keeps Check to one instance at a time
+const IngestAlertCheckLockKey int64 = 0x61637478_616c7274
+
+type CheckIngestAlertsOutput struct {
+	Projects int `json:"projects"`
+	Alerts   int `json:"alerts"`
+}
+
+// Check compares the last window of every project with ingest alerts against its baseline and notifies spikes and drops.
+// A project is notified at most once per kind and window, the check runs more often than windows end.
+// A project that fails is logged and skipped until the next run.
+func (s *ingestAlertService) Check(ctx context.Context, now time.Time) (*CheckIngestAlertsOutput, error) {
+	projects, err := s.projectRepo.ListWithConfig(ctx, model.ProjectIngestAlertsConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("list projects with ingest alerts: %w", err)
+	}
+
+	out := &CheckIngestAlertsOutput{}
+	for i := range projects {
+		policy := projects[i].IngestAlerts()
+		if policy == nil || policy.WindowMinutes <= 0 || policy.BaselineWindows <= 0 {
+			continue
+		}
+		out.Projects++
+		alerted, err := s.checkProject(ctx, &projects[i], *policy, now)
+		if err != nil {
+			s.log.Warn("ingest alert check failed", zap.String("project_id", projects[i].ID.String()), zap.Error(err))
+			continue
+		}
+		if alerted {
+			out.Alerts++
+		}
+	}
+	return out, nil
+}
+
+func (s *ingestAlertService) checkProject(ctx context.Context, project *model.Project, policy model.IngestAlertPolicy, now time.Time) (bool, error) {
+	window := time.Duration(policy.WindowMinutes) * time.Minute
+	counts, err := s.ingestRepo.WindowCounts(ctx, project.ID, now, window, policy.BaselineWindows+1)
+	if err != nil {
+		return false, err
+	}
+	kind, baseline := detectIngestAnomaly(policy, counts)
+	if kind == "" {
+		return false, nil
+	}
+
+	last, err := s.notifications.LastOfKind(ctx, project.ID, kind)
+	if err != nil {
+		return false, err
+	}
+	if last != nil && last.CreatedAt.After(now.Add(-window)) {
+		return false, nil
+	}
+
+	title := fmt.Sprintf("Ingest spike: %d messages in the last %d minutes, baseline %.1f", counts[0], policy.WindowMinutes, baseline)
+	if kind == model.NotificationKindIngestDrop {
+		title = fmt.Sprintf("Ingest drop: %d messages in the last %d minutes, baseline %.1f", counts[0], policy.WindowMinutes, baseline)
+	}
+	err = s.notifier.Notify(ctx, project, &model.Notification{
+		Kind:  kind,
+		Title: title,
+		Data: datatypes.JSONMap{
+			"window_minutes":   policy.WindowMinutes,
+			"window_end":       now.UTC(),
+			"messages":         counts[0],
+			"baseline":         baseline,
+			"baseline_windows": policy.BaselineWindows,
+		},
+	})
+	return err == nil, err
+}
+
+// detectIngestAnomaly returns the kind of notification the current window counts[0] calls for against
+// the average of the baseline windows counts[1:], empty when it is normal.
+// Without any baseline traffic there is nothing to compare with, new projects are never alerted.
+func detectIngestAnomaly(policy model.IngestAlertPolicy, counts []int64) (string, float64) {
+	baseline := ingestBaseline(counts)
+	if len(counts) < 2 || baseline == 0 {
+		return "", baseline
+	}
+	current := float64(counts[0])
+	if policy.SpikeFactor > 0 && current >= float64(policy.MinMessages) && current > baseline*policy.SpikeFactor {
+		return model.NotificationKindIngestSpike, baseline
+	}
+	if policy.DropFactor > 0 && baseline >= float64(policy.MinMessages) && current < baseline*policy.DropFactor {
+		return model.NotificationKindIngestDrop, baseline
+	}
+	return "", baseline
+}
+
+// ingestBaseline returns the average of the baseline windows counts[1:]
+func ingestBaseline(counts []int64) float64 {
+	if len(counts) < 2 {
+		return 0
+	}
+	var sum int64
+	for _, c := range counts[1:] {
+		sum += c
+	}
+	return float64(sum) / float64(len(counts)-1)
+}
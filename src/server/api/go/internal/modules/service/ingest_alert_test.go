@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+type fakeIngestRepo struct {
+	counts map[uuid.UUID][]int64
+}
+
+func (r *fakeIngestRepo) WindowCounts(ctx context.Context, projectID uuid.UUID, end time.Time, window time.Duration, n int) ([]int64, error) {
+	counts := make([]int64, n)
+	copy(counts, r.counts[projectID])
+	return counts, nil
+}
+
+func TestDetectIngestAnomaly(t *testing.T) {
+	policy := model.IngestAlertPolicy{WindowMinutes: 60, BaselineWindows: 4, SpikeFactor: 3, DropFactor: 0.2, MinMessages: 50}
+
+	tests := []struct {
+		name   string
+		counts []int64
+		kind   string
+	}{
+		{"normal", []int64{110, 100, 90, 100, 110}, ""},
+		{"spike", []int64{400, 100, 90, 100, 110}, model.NotificationKindIngestSpike},
+		{"spike below min messages", []int64{40, 10, 10, 10, 10}, ""},
+		{"drop", []int64{10, 100, 90, 100, 110}, model.NotificationKindIngestDrop},
+		{"drop of a quiet project", []int64{0, 10, 10, 10, 10}, ""},
+		{"no baseline", []int64{500, 0, 0, 0, 0}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, _ := detectIngestAnomaly(policy, tt.counts)
+			assert.Equal(t, tt.kind, kind)
+		})
+	}
+}
+
+func TestIngestAlertService_Update(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewIngestAlertService(r, &fakeIngestRepo{}, &fakeNotificationRepo{}, nil, zap.NewNop())
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	policy := &model.IngestAlertPolicy{WindowMinutes: 60, BaselineWindows: 24, SpikeFactor: 3, MinMessages: 50}
+	out, err := svc.Update(ctx, project, policy)
+	require.NoError(t, err)
+	assert.Equal(t, policy, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	for _, invalid := range []model.IngestAlertPolicy{
+		{WindowMinutes: 60, BaselineWindows: 24},
+		{WindowMinutes: 0, BaselineWindows: 24, SpikeFactor: 3},
+		{WindowMinutes: 60, BaselineWindows: 24, SpikeFactor: 0.5},
+		{WindowMinutes: 60, BaselineWindows: 24, SpikeFactor: 3, DropFactor: 2},
+	} {
+		_, err = svc.Update(ctx, project, &invalid)
+		assert.ErrorIs(t, err, ErrInvalidIngestAlertPolicy)
+	}
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectIngestAlertsConfigKey)
+}
+
+func TestIngestAlertService_Check(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	alerts := datatypes.JSONMap{model.ProjectIngestAlertsConfigKey: map[string]interface{}{
+		"window_minutes": float64(60), "baseline_windows": float64(2), "spike_factor": float64(3), "drop_factor": 0.2, "min_messages": float64(10),
+	}}
+	spiking := model.Project{ID: uuid.New(), Configs: alerts}
+	steady := model.Project{ID: uuid.New(), Configs: alerts}
+
+	notifications := &fakeNotificationRepo{}
+	notifier := NewNotificationService(notifications, &fakeProjectRepo{}, &config.Config{}, zap.NewNop())
+	ingest := &fakeIngestRepo{counts: map[uuid.UUID][]int64{
+		spiking.ID: {100, 20, 20},
+		steady.ID:  {20, 20, 20},
+	}}
+	svc := NewIngestAlertService(&fakeProjectRepo{projects: []model.Project{spiking, steady}}, ingest, notifications, notifier, zap.NewNop())
+
+	out, err := svc.Check(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, &CheckIngestAlertsOutput{Projects: 2, Alerts: 1}, out)
+	require.Len(t, notifications.created, 1)
+	assert.Equal(t, spiking.ID, notifications.created[0].ProjectID)
+	assert.Equal(t, model.NotificationKindIngestSpike, notifications.created[0].Kind)
+	assert.EqualValues(t, 100, notifications.created[0].Data["messages"])
+
+	// the same window is not notified twice
+	out, err = svc.Check(ctx, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, out.Alerts)
+
+	// the spike goes on past the window
+	out, err = svc.Check(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, out.Alerts)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// messageHubBuffer is the number of pending events per subscriber before new events are dropped
+const messageHubBuffer = 64
+
+// MessageHub fans out session message insert events consumed from the MQ to in-process subscribers
+type MessageHub struct {
+	mu   sync.RWMutex
+	subs map[uuid.UUID]map[chan SendMQPublishJSON]struct{}
+	log  *zap.Logger
+}
+
+func NewMessageHub(log *zap.Logger) *MessageHub {
+	return &MessageHub{
+		subs: make(map[uuid.UUID]map[chan SendMQPublishJSON]struct{}),
+		log:  log,
+	}
+}
+
+// Subscribe registers a subscriber for the messages of a session.
+// The returned function must be called to unsubscribe, it closes the channel.
+func (h *MessageHub) Subscribe(sessionID uuid.UUID) (<-chan SendMQPublishJSON, func()) {
+	ch := make(chan SendMQPublishJSON, messageHubBuffer)
+
+	h.mu.Lock()
+	if h.subs[sessionID] == nil {
+		h.subs[sessionID] = make(map[chan SendMQPublishJSON]struct{})
+	}
+	h.subs[sessionID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[sessionID], ch)
+			if len(h.subs[sessionID]) == 0 {
+				delete(h.subs, sessionID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Dispatch delivers an event to the subscribers of its session without blocking
+func (h *MessageHub) Dispatch(ev SendMQPublishJSON) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subs[ev.SessionID] {
+		select {
+		case ch <- ev:
+		default:
+			h.log.Warn("message subscriber is lagging, dropping event", zap.String("session_id", ev.SessionID.String()), zap.String("message_id", ev.MessageID.String()))
+		}
+	}
+}
+
+// HandleDelivery is the MQ consumer handler. Malformed payloads are dropped rather than requeued.
+func (h *MessageHub) HandleDelivery(body []byte) error {
+	var ev SendMQPublishJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		h.log.Warn("invalid session message event", zap.Error(err))
+		return nil
+	}
+	h.Dispatch(ev)
+	return nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+)
+
+// Strata of SampleMessages
+const (
+	SampleStratifyNone = "none" // one stratum, a simple random sample
+	SampleStratifyTag  = "tag"  // the tags of the message meta, messages without tags are in the stratum "(none)"
+	SampleStratifyTool = "tool" // the names of the tools called by the message, only messages with a tool call are drawn
+	SampleStratifyTime = "time" // the time bucket of the creation of the message
+)
+
+// sampleNoStratum is the stratum of messages without a tag or tool
+const sampleNoStratum = "(none)"
+
+// samplePoolFactor is how many more messages than the sample size are drawn to build the strata,
+// capped by maxSamplePool so one request never loads a whole project
+const (
+	samplePoolFactor = 20
+	maxSamplePool    = 5000
+)
+
+var ErrInvalidSampleBucket = errors.New("bucket must be hour, day or week")
+
+var sampleBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+type SampleMessagesInput struct {
+	ProjectID uuid.UUID
+	Size      int
+	Stratify  string
+	Bucket    string // time bucket of SampleStratifyTime
+	Roles     []string
+	Since     time.Time
+	Until     time.Time
+}
+
+type MessageSample struct {
+	Stratify string           `json:"stratify"`
+	Pool     int              `json:"pool"` // messages the sample was drawn from
+	Strata   []SampleStratum  `json:"strata"`
+	Items    []SampledMessage `json:"items"`
+}
+
+type SampleStratum struct {
+	Key     string `json:"key"`
+	Pool    int    `json:"pool"`
+	Sampled int    `json:"sampled"`
+}
+
+type SampledMessage struct {
+	model.Message
+	Stratum string `json:"stratum"`
+}
+
+// SampleMessages draws a random pool of the messages of the project and samples it evenly across strata:
+// strata are visited in turn and each gives one message until Size messages are sampled or all strata are exhausted.
+// A message in several strata, e.g. with two tags, is sampled at most once.
+func (s *sessionService) SampleMessages(ctx context.Context, in SampleMessagesInput) (*MessageSample, error) {
+	bucket := sampleBuckets["day"]
+	if in.Stratify == SampleStratifyTime && in.Bucket != "" {
+		var ok bool
+		if bucket, ok = sampleBuckets[in.Bucket]; !ok {
+			return nil, ErrInvalidSampleBucket
+		}
+	}
+
+	pool, err := s.sessionRepo.SampleMessages(ctx, in.ProjectID, repo.MessageSampleFilter{
+		Roles:        in.Roles,
+		Since:        in.Since,
+		Until:        in.Until,
+		WithToolCall: in.Stratify == SampleStratifyTool,
+	}, min(in.Size*samplePoolFactor, maxSamplePool))
+	if err != nil {
+		return nil, err
+	}
+	// Tool names are only known from the parts
+	if in.Stratify == SampleStratifyTool {
+		if err := s.loadPartsForMessages(ctx, pool); err != nil {
+			return nil, err
+		}
+	}
+
+	strata := make(map[string][]int)
+	for i, m := range pool {
+		for _, key := range sampleStrata(m, in.Stratify, bucket) {
+			strata[key] = append(strata[key], i)
+		}
+	}
+	keys := make([]string, 0, len(strata))
+	for k := range strata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := &MessageSample{Stratify: in.Stratify, Pool: len(pool), Strata: make([]SampleStratum, len(keys)), Items: []SampledMessage{}}
+	for i, k := range keys {
+		out.Strata[i] = SampleStratum{Key: k, Pool: len(strata[k])}
+		// The pool is in random order already, shuffle again as a message is listed in several strata
+		rand.Shuffle(len(strata[k]), func(a, b int) { strata[k][a], strata[k][b] = strata[k][b], strata[k][a] })
+	}
+
+	picked := make(map[int]bool)
+	next := make([]int, len(keys))
+	for len(out.Items) < in.Size {
+		progress := false
+		for i, k := range keys {
+			if len(out.Items) == in.Size {
+				break
+			}
+			for next[i] < len(strata[k]) {
+				idx := strata[k][next[i]]
+				next[i]++
+				if picked[idx] {
+					continue
+				}
+				picked[idx] = true
+				out.Items = append(out.Items, SampledMessage{Message: pool[idx], Stratum: k})
+				out.Strata[i].Sampled++
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+
+	msgs := make([]model.Message, len(out.Items))
+	for i := range out.Items {
+		msgs[i] = out.Items[i].Message
+	}
+	if in.Stratify != SampleStratifyTool {
+		if err := s.loadPartsForMessages(ctx, msgs); err != nil {
+			return nil, err
+		}
+		for i := range out.Items {
+			out.Items[i].Parts = msgs[i].Parts
+		}
+	}
+	return out, nil
+}
+
+// sampleStrata returns the strata of m
+func sampleStrata(m model.Message, stratify string, bucket time.Duration) []string {
+	switch stratify {
+	case SampleStratifyTag:
+		if tags := model.MessageTags(m.Meta.Data()); len(tags) > 0 {
+			return tags
+		}
+		return []string{sampleNoStratum}
+	case SampleStratifyTool:
+		var tools []string
+		for _, p := range m.Parts {
+			if p.Type != "tool-call" {
+				continue
+			}
+			if name, _ := p.Meta["name"].(string); name != "" {
+				tools = append(tools, name)
+			}
+		}
+		if len(tools) == 0 {
+			return []string{sampleNoStratum}
+		}
+		return tools
+	case SampleStratifyTime:
+		return []string{m.CreatedAt.UTC().Truncate(bucket).Format(time.RFC3339)}
+	}
+	return []string{"all"}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+func sampleMessage(tags []any, tool string, createdAt time.Time) model.Message {
+	parts := []model.Part{{Type: "text", Text: "hi"}}
+	if tool != "" {
+		parts = append(parts, model.Part{Type: "tool-call", Meta: map[string]interface{}{"name": tool}})
+	}
+	meta := map[string]any{}
+	if tags != nil {
+		meta["tags"] = tags
+	}
+	return model.Message{
+		ID:          uuid.New(),
+		Role:        "assistant",
+		Meta:        datatypes.NewJSONType(meta),
+		InlineParts: datatypes.NewJSONSlice(parts),
+		CreatedAt:   createdAt,
+	}
+}
+
+func TestSessionService_SampleMessages(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	day := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// billing is over-represented, the sample still takes one of each tag first
+	pool := []model.Message{
+		sampleMessage([]any{"billing"}, "search", day),
+		sampleMessage([]any{"billing"}, "search", day),
+		sampleMessage([]any{"billing"}, "search", day),
+		sampleMessage([]any{"billing", "refund"}, "refund", day.Add(24*time.Hour)),
+		sampleMessage(nil, "", day.Add(48*time.Hour)),
+	}
+
+	t.Run("stratified by tag", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("SampleMessages", ctx, projectID, repo.MessageSampleFilter{Roles: []string{"assistant"}}, 60).Return(append([]model.Message(nil), pool...), nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		out, err := svc.SampleMessages(ctx, SampleMessagesInput{ProjectID: projectID, Size: 3, Stratify: SampleStratifyTag, Roles: []string{"assistant"}})
+		require.NoError(t, err)
+		assert.Equal(t, 5, out.Pool)
+		require.Len(t, out.Items, 3)
+		strata := map[string]SampleStratum{}
+		for _, st := range out.Strata {
+			strata[st.Key] = st
+		}
+		assert.Equal(t, 4, strata["billing"].Pool)
+		assert.Equal(t, 1, strata[sampleNoStratum].Sampled)
+		seen := map[uuid.UUID]bool{}
+		for _, it := range out.Items {
+			assert.False(t, seen[it.ID], "message sampled twice")
+			seen[it.ID] = true
+			assert.NotEmpty(t, it.Parts)
+		}
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("stratified by tool", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("SampleMessages", ctx, projectID, mock.MatchedBy(func(f repo.MessageSampleFilter) bool { return f.WithToolCall }), 200).Return(append([]model.Message(nil), pool[:4]...), nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		out, err := svc.SampleMessages(ctx, SampleMessagesInput{ProjectID: projectID, Size: 10, Stratify: SampleStratifyTool})
+		require.NoError(t, err)
+		assert.Len(t, out.Items, 4)
+		assert.Equal(t, []SampleStratum{{Key: "refund", Pool: 1, Sampled: 1}, {Key: "search", Pool: 3, Sampled: 3}}, out.Strata)
+	})
+
+	t.Run("stratified by time", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("SampleMessages", ctx, projectID, mock.Anything, 40).Return(append([]model.Message(nil), pool...), nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		out, err := svc.SampleMessages(ctx, SampleMessagesInput{ProjectID: projectID, Size: 2, Stratify: SampleStratifyTime, Bucket: "day"})
+		require.NoError(t, err)
+		assert.Len(t, out.Strata, 3)
+		assert.Len(t, out.Items, 2)
+		assert.NotEqual(t, out.Items[0].Stratum, out.Items[1].Stratum)
+
+		_, err = svc.SampleMessages(ctx, SampleMessagesInput{ProjectID: projectID, Size: 2, Stratify: SampleStratifyTime, Bucket: "month"})
+		assert.ErrorIs(t, err, ErrInvalidSampleBucket)
+	})
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrInvalidNetworkAccessPolicy  = errors.New("invalid network access rule")
+	ErrNetworkAccessLocksOutCaller = errors.New("network access rules would deny the IP of this request")
+)
+
+type NetworkAccessService interface {
+	Get(ctx context.Context, project *model.Project) *model.NetworkAccessPolicy
+	Update(ctx context.Context, project *model.Project, policy *model.NetworkAccessPolicy, callerIP net.IP) (*model.NetworkAccessPolicy, error)
+}
+
+type networkAccessService struct {
+	r repo.ProjectRepo
+}
+
+func NewNetworkAccessService(r repo.ProjectRepo) NetworkAccessService {
+	return &networkAccessService{r: r}
+}
+
+// Get returns the network access rules of the project, nil when every IP is allowed
+func (s *networkAccessService) Get(ctx context.Context, project *model.Project) *model.NetworkAccessPolicy {
+	return project.NetworkAccess()
+}
+
+// Update replaces the network access rules of the project, a nil policy allows every IP.
+// Rules denying callerIP are refused so a project cannot lock out the client changing them.
+func (s *networkAccessService) Update(ctx context.Context, project *model.Project, policy *model.NetworkAccessPolicy, callerIP net.IP) (*model.NetworkAccessPolicy, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if policy == nil {
+		delete(configs, model.ProjectNetworkAccessConfigKey)
+	} else {
+		allow, err := normalizeNetworkRules(policy.Allow)
+		if err != nil {
+			return nil, err
+		}
+		deny, err := normalizeNetworkRules(policy.Deny)
+		if err != nil {
+			return nil, err
+		}
+		normalized := &model.NetworkAccessPolicy{Allow: allow, Deny: deny, DefaultDeny: policy.DefaultDeny}
+		if !normalized.Allows(callerIP) {
+			return nil, ErrNetworkAccessLocksOutCaller
+		}
+		configs[model.ProjectNetworkAccessConfigKey] = map[string]interface{}{
+			"allow":        toInterfaces(allow),
+			"deny":         toInterfaces(deny),
+			"default_deny": policy.DefaultDeny,
+		}
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectNetworkAccessConfigKey, configs[model.ProjectNetworkAccessConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.NetworkAccess(), nil
+}
+
+// normalizeNetworkRules parses the rules and writes them back as CIDRs
+func normalizeNetworkRules(rules []string) ([]string, error) {
+	out := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		ipnet, err := model.ParseNetworkRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidNetworkAccessPolicy, rule)
+		}
+		out = append(out, ipnet.String())
+	}
+	return out, nil
+}
+
+func toInterfaces(items []string) []interface{} {
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		out[i] = item
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestNetworkAccessService(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewNetworkAccessService(r)
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+	caller := net.ParseIP("203.0.113.5")
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	out, err := svc.Update(ctx, project, &model.NetworkAccessPolicy{
+		Allow:       []string{"203.0.113.0/24", "2001:db8::1"},
+		Deny:        []string{"203.0.113.9"},
+		DefaultDeny: true,
+	}, caller)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.0/24", "2001:db8::1/128"}, out.Allow)
+	assert.Equal(t, []string{"203.0.113.9/32"}, out.Deny)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	assert.True(t, out.Allows(caller))
+	assert.False(t, out.Allows(net.ParseIP("203.0.113.9")))
+	assert.False(t, out.Allows(net.ParseIP("198.51.100.1")))
+	assert.True(t, out.Allows(net.ParseIP("2001:db8::1")))
+
+	// Rules read back from JSON hold []interface{}
+	project.Configs = datatypes.JSONMap{model.ProjectNetworkAccessConfigKey: map[string]interface{}{
+		"deny": []interface{}{"198.51.100.0/24"},
+	}}
+	policy := svc.Get(ctx, project)
+	assert.False(t, policy.Allows(net.ParseIP("198.51.100.1")))
+	assert.True(t, policy.Allows(caller))
+
+	_, err = svc.Update(ctx, project, &model.NetworkAccessPolicy{Allow: []string{"not-an-ip"}}, caller)
+	assert.ErrorIs(t, err, ErrInvalidNetworkAccessPolicy)
+	_, err = svc.Update(ctx, project, &model.NetworkAccessPolicy{Allow: []string{"198.51.100.0/24"}, DefaultDeny: true}, caller)
+	assert.ErrorIs(t, err, ErrNetworkAccessLocksOutCaller)
+
+	out, err = svc.Update(ctx, project, nil, caller)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectNetworkAccessConfigKey)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrInvalidNotificationWebhook = errors.New("webhook must be an absolute http or https url")
+	ErrWebhookAddressNotAllowed   = errors.New("webhook resolves to a loopback, private or link-local address")
+)
+
+// defaultWebhookTimeout is used when alert.webhookTimeoutSec is not configured
+const defaultWebhookTimeout = 10 * time.Second
+
+type NotificationService interface {
+	Notify(ctx context.Context, project *model.Project, n *model.Notification) error
+	List(ctx context.Context, in ListNotificationsInput) (*ListNotificationsOutput, error)
+	GetWebhook(ctx context.Context, project *model.Project) string
+	UpdateWebhook(ctx context.Context, project *model.Project, webhook string) (string, error)
+}
+
+type notificationService struct {
+	r           repo.NotificationRepo
+	projectRepo repo.ProjectRepo
+	client      *http.Client
+	log         *zap.Logger
+}
+
+func NewNotificationService(r repo.NotificationRepo, projectRepo repo.ProjectRepo, cfg *config.Config, log *zap.Logger) NotificationService {
+	return &notificationService{
+		r:           r,
+		projectRepo: projectRepo,
+		client:      newWebhookClient(cfg),
+		log:         log,
+	}
+}
+
+// newWebhookClient returns the client of the webhooks set by projects. Unless alert.webhookAllowPrivate is set, it
+// refuses to connect to loopback, private and link-local addresses. The address is checked once resolved, at dial
+// time, so neither a DNS name pointing inside nor a redirect reaches the internal network.
+func newWebhookClient(cfg *config.Config) *http.Client {
+	timeout := defaultWebhookTimeout
+	if cfg != nil && cfg.Alert.WebhookTimeoutSec > 0 {
+		timeout = time.Duration(cfg.Alert.WebhookTimeoutSec) * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if cfg == nil || !cfg.Alert.WebhookAllowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicWebhookIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		// no proxy, it would dial on behalf of the webhook and skip the check
+		Transport: &http.Transport{DialContext: dialer.DialContext, ForceAttemptHTTP2: true, TLSHandshakeTimeout: timeout},
+	}
+}
+
+// publicWebhookIP reports whether a webhook may connect to ip
+func publicWebhookIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// Notify stores a notification of the project and posts it as JSON to the webhook of the project, if any.
+// A failed delivery is recorded on the notification and does not fail Notify.
+func (s *notificationService) Notify(ctx context.Context, project *model.Project, n *model.Notification) error {
+	n.ProjectID = project.ID
+	if n.Data == nil {
+		n.Data = datatypes.JSONMap{}
+	}
+	if err := s.r.Create(ctx, n); err != nil {
+		return err
+	}
+
+	webhook := project.NotificationWebhook()
+	if webhook == "" {
+		return nil
+	}
+	if err := s.deliver(ctx, webhook, n); err != nil {
+		n.DeliveryError = err.Error()
+		s.log.Warn("notification delivery failed", zap.String("project_id", project.ID.String()), zap.String("notification_id", n.ID.String()), zap.Error(err))
+	} else {
+		now := time.Now()
+		n.DeliveredAt = &now
+	}
+	return s.r.UpdateDelivery(ctx, n)
+}
+
+func (s *notificationService) deliver(ctx context.Context, webhook string, n *model.Notification) error {
+	return postWebhookJSON(ctx, s.client, webhook, n)
+}
+
+// postWebhookJSON posts v as JSON to a webhook, a status other than 2xx is an error
+func postWebhookJSON(ctx context.Context, client *http.Client, webhook string, v any) error {
+	body, err := sonic.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type ListNotificationsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Kind      string    `json:"kind"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+type ListNotificationsOutput struct {
+	Items      []model.Notification `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	HasMore    bool                 `json:"has_more"`
+}
+
+func (s *notificationService) List(ctx context.Context, in ListNotificationsInput) (*ListNotificationsOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the beginning
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	items, err := s.r.ListWithCursor(ctx, in.ProjectID, in.Kind, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListNotificationsOutput{
+		Items:   items,
+		HasMore: false,
+	}
+	if len(items) > in.Limit {
+		out.HasMore = true
+		out.Items = items[:in.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return out, nil
+}
+
+// GetWebhook returns the URL the notifications of the project are posted to, empty when they are only listed
+func (s *notificationService) GetWebhook(ctx context.Context, project *model.Project) string {
+	return project.NotificationWebhook()
+}
+
+// UpdateWebhook replaces the notification webhook of the project, an empty URL removes it
+func (s *notificationService) UpdateWebhook(ctx context.Context, project *model.Project, webhook string) (string, error) {
+	if project == nil {
+		return "", errors.New("project is empty")
+	}
+	if webhook != "" && !validNotificationWebhook(webhook) {
+		return "", ErrInvalidNotificationWebhook
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if webhook == "" {
+		delete(configs, model.ProjectNotificationWebhookConfigKey)
+	} else {
+		configs[model.ProjectNotificationWebhookConfigKey] = webhook
+	}
+
+	if err := s.projectRepo.SetConfig(ctx, project.ID, model.ProjectNotificationWebhookConfigKey, configs[model.ProjectNotificationWebhookConfigKey]); err != nil {
+		return "", err
+	}
+	project.Configs = configs
+	return project.NotificationWebhook(), nil
+}
+
+// validNotificationWebhook reports whether webhook is an absolute http or https URL
+func validNotificationWebhook(webhook string) bool {
+	u, err := url.Parse(webhook)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
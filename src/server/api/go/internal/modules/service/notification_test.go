@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+type fakeNotificationRepo struct {
+	created   []*model.Notification
+	delivered []*model.Notification
+}
+
+func (r *fakeNotificationRepo) Create(ctx context.Context, n *model.Notification) error {
+	n.ID = uuid.New()
+	n.CreatedAt = time.Now()
+	r.created = append(r.created, n)
+	return nil
+}
+
+func (r *fakeNotificationRepo) UpdateDelivery(ctx context.Context, n *model.Notification) error {
+	r.delivered = append(r.delivered, n)
+	return nil
+}
+
+func (r *fakeNotificationRepo) LastOfKind(ctx context.Context, projectID uuid.UUID, kind string) (*model.Notification, error) {
+	for i := len(r.created) - 1; i >= 0; i-- {
+		if r.created[i].ProjectID == projectID && r.created[i].Kind == kind {
+			return r.created[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeNotificationRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Notification, error) {
+	return nil, nil
+}
+
+// localWebhookConfig lets webhooks reach the httptest servers, which listen on loopback
+var localWebhookConfig = &config.Config{Alert: config.AlertCfg{WebhookAllowPrivate: true}}
+
+func TestNotificationService_Notify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without webhook", func(t *testing.T) {
+		r := &fakeNotificationRepo{}
+		svc := NewNotificationService(r, &fakeProjectRepo{}, &config.Config{}, zap.NewNop())
+
+		require.NoError(t, svc.Notify(ctx, &model.Project{ID: uuid.New()}, &model.Notification{Kind: model.NotificationKindIngestSpike, Title: "spike"}))
+		assert.Len(t, r.created, 1)
+		assert.Empty(t, r.delivered)
+	})
+
+	t.Run("delivered to webhook", func(t *testing.T) {
+		var body string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			b, _ := io.ReadAll(req.Body)
+			body = string(b)
+		}))
+		defer srv.Close()
+
+		r := &fakeNotificationRepo{}
+		svc := NewNotificationService(r, &fakeProjectRepo{}, localWebhookConfig, zap.NewNop())
+		project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{model.ProjectNotificationWebhookConfigKey: srv.URL}}
+
+		require.NoError(t, svc.Notify(ctx, project, &model.Notification{Kind: model.NotificationKindIngestDrop, Title: "drop"}))
+		require.Len(t, r.delivered, 1)
+		assert.NotNil(t, r.delivered[0].DeliveredAt)
+		assert.Empty(t, r.delivered[0].DeliveryError)
+		assert.Contains(t, body, `"kind":"ingest_drop"`)
+	})
+
+	t.Run("failed delivery is recorded", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		r := &fakeNotificationRepo{}
+		svc := NewNotificationService(r, &fakeProjectRepo{}, localWebhookConfig, zap.NewNop())
+		project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{model.ProjectNotificationWebhookConfigKey: srv.URL}}
+
+		require.NoError(t, svc.Notify(ctx, project, &model.Notification{Kind: model.NotificationKindIngestDrop, Title: "drop"}))
+		require.Len(t, r.delivered, 1)
+		assert.Nil(t, r.delivered[0].DeliveredAt)
+		assert.Contains(t, r.delivered[0].DeliveryError, "502")
+	})
+}
+
+func TestWebhookClient_RefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	err := postWebhookJSON(context.Background(), newWebhookClient(&config.Config{}), srv.URL, map[string]string{"a": "b"})
+	assert.ErrorIs(t, err, ErrWebhookAddressNotAllowed)
+	assert.NoError(t, postWebhookJSON(context.Background(), newWebhookClient(localWebhookConfig), srv.URL, map[string]string{"a": "b"}))
+
+	for ip, public := range map[string]bool{
+		"8.8.8.8": true, "2606:4700::1111": true,
+		"127.0.0.1": false, "10.1.2.3": false, "192.168.0.1": false, "169.254.169.254": false, "::1": false, "fe80::1": false, "0.0.0.0": false,
+	} {
+		assert.Equal(t, public, publicWebhookIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestNotificationService_UpdateWebhook(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewNotificationService(&fakeNotificationRepo{}, r, &config.Config{}, zap.NewNop())
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	url, err := svc.UpdateWebhook(ctx, project, "https://hooks.example.com/acontext")
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/acontext", url)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	for _, invalid := range []string{"hooks.example.com", "ftp://hooks.example.com", "https://"} {
+		_, err = svc.UpdateWebhook(ctx, project, invalid)
+		assert.ErrorIs(t, err, ErrInvalidNotificationWebhook, invalid)
+	}
+
+	url, err = svc.UpdateWebhook(ctx, project, "")
+	require.NoError(t, err)
+	assert.Empty(t, url)
+	assert.NotContains(t, r.configs, model.ProjectNotificationWebhookConfigKey)
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrUnknownPartTransform = errors.New("unknown part transform")
+	ErrInvalidPartTransform = errors.New("max_bytes of a part transform must not be negative")
+)
+
+type PartTransformService interface {
+	GetPipeline(ctx context.Context, project *model.Project) []model.PartTransformConfig
+	UpdatePipeline(ctx context.Context, project *model.Project, pipeline []model.PartTransformConfig) ([]model.PartTransformConfig, error)
+}
+
+type partTransformService struct {
+	r   repo.ProjectRepo
+	cfg *config.Config
+}
+
+func NewPartTransformService(r repo.ProjectRepo, cfg *config.Config) PartTransformService {
+	return &partTransformService{r: r, cfg: cfg}
+}
+
+// GetPipeline returns the part transform pipeline of the project, the server one unless the project replaced it
+func (s *partTransformService) GetPipeline(ctx context.Context, project *model.Project) []model.PartTransformConfig {
+	return partTransformPipeline(s.cfg, project.PartTransforms())
+}
+
+// UpdatePipeline replaces the part transform pipeline of the project, a nil pipeline restores the server one
+func (s *partTransformService) UpdatePipeline(ctx context.Context, project *model.Project, pipeline []model.PartTransformConfig) ([]model.PartTransformConfig, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if pipeline == nil {
+		delete(configs, model.ProjectPartTransformsConfigKey)
+	} else {
+		steps := make([]interface{}, 0, len(pipeline))
+		for _, t := range pipeline {
+			if _, ok := partTransformers[t.Name]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownPartTransform, t.Name)
+			}
+			if t.MaxBytes < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidPartTransform, t.Name)
+			}
+			steps = append(steps, map[string]interface{}{
+				"name":      t.Name,
+				"enabled":   t.Enabled,
+				"max_bytes": t.MaxBytes,
+			})
+		}
+		configs[model.ProjectPartTransformsConfigKey] = steps
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectPartTransformsConfigKey, configs[model.ProjectPartTransformsConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return s.GetPipeline(ctx, project), nil
+}
+
+// partTransformPipeline returns the pipeline of a project, falling back to the server one when the project has none
+func partTransformPipeline(cfg *config.Config, project []model.PartTransformConfig) []model.PartTransformConfig {
+	if project != nil {
+		return project
+	}
+	out := []model.PartTransformConfig{}
+	if cfg == nil {
+		return out
+	}
+	for _, t := range cfg.Ingest.PartTransforms {
+		out = append(out, model.PartTransformConfig{Name: t.Name, Enabled: t.Enabled, MaxBytes: t.MaxBytes})
+	}
+	return out
+}
+
+// partStore keeps data as an asset of the project of the message being transformed
+type partStore func(ctx context.Context, data []byte, contentType string, ext string) (*model.Asset, error)
+
+// partTransformer rewrites a part of a new message according to the step t
+type partTransformer func(ctx context.Context, t model.PartTransformConfig, p model.Part, store partStore) (model.Part, error)
+
+var partTransformers = map[string]partTransformer{
+	model.PartTransformNormalizeWhitespace: normalizeWhitespace,
+	model.PartTransformStripBase64Images:   stripBase64Image,
+	model.PartTransformTruncateToolOutput:  truncateToolOutput,
+}
+
+// applyPartTransforms runs the enabled steps of pipeline over parts in order, steps with an unknown name are returned as skipped
+func applyPartTransforms(ctx context.Context, pipeline []model.PartTransformConfig, parts []model.Part, store partStore) (skipped []string, err error) {
+	for _, t := range pipeline {
+		if !t.Enabled {
+			continue
+		}
+		transform, ok := partTransformers[t.Name]
+		if !ok {
+			skipped = append(skipped, t.Name)
+			continue
+		}
+		for i := range parts {
+			p, err := transform(ctx, t, parts[i], store)
+			if err != nil {
+				return skipped, fmt.Errorf("part transform %s: %w", t.Name, err)
+			}
+			parts[i] = p
+		}
+	}
+	return skipped, nil
+}
+
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// normalizeWhitespace converts CRLF line endings, trims trailing spaces and collapses runs of blank lines of text parts
+func normalizeWhitespace(_ context.Context, _ model.PartTransformConfig, p model.Part, _ partStore) (model.Part, error) {
+	if p.Type != "text" {
+		return p, nil
+	}
+	lines := strings.Split(strings.ReplaceAll(p.Text, "\r\n", "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	text := strings.Trim(blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"), "\n")
+	if text != "" {
+		p.Text = text
+	}
+	return p, nil
+}
+
+// stripBase64Image drops the inline data of image parts larger than MaxBytes, the part keeps its media type
+func stripBase64Image(_ context.Context, t model.PartTransformConfig, p model.Part, _ partStore) (model.Part, error) {
+	if p.Type != "image" {
+		return p, nil
+	}
+	if sourceType, _ := p.Meta["type"].(string); sourceType != "base64" {
+		return p, nil
+	}
+	data, _ := p.Meta["data"].(string)
+	if len(data) <= t.MaxBytes {
+		return p, nil
+	}
+
+	p.Meta = maps.Clone(p.Meta)
+	delete(p.Meta, "data")
+	p.Meta["stripped"] = true
+	p.Meta["stripped_bytes"] = len(data)
+	return p, nil
+}
+
+// truncateToolOutput cuts tool results to a preview of MaxBytes, the full output is stored and becomes the asset of the part.
+// ExpandPart of the session service restores it.
+func truncateToolOutput(ctx context.Context, t model.PartTransformConfig, p model.Part, store partStore) (model.Part, error) {
+	if p.Type != "tool-result" || t.MaxBytes <= 0 || len(p.Text) <= t.MaxBytes || p.Asset != nil {
+		return p, nil
+	}
+
+	asset, err := store(ctx, []byte(p.Text), "text/plain; charset=utf-8", ".txt")
+	if err != nil {
+		return p, fmt.Errorf("store full output: %w", err)
+	}
+
+	cut := t.MaxBytes
+	for cut > 0 && !utf8.RuneStart(p.Text[cut]) {
+		cut--
+	}
+	meta := maps.Clone(p.Meta)
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	meta[model.PartMetaTruncated] = true
+	meta[model.PartMetaOriginalSize] = len(p.Text)
+
+	p.Meta = meta
+	p.Text = p.Text[:cut]
+	p.Asset = asset
+	return p, nil
+}
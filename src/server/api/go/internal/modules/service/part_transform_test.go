@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type fakeProjectRepo struct {
+	configs  datatypes.JSONMap
+	projects []model.Project
+	// spaces maps a space to the ID of its project
+	spaces map[uuid.UUID]uuid.UUID
+}
+
+func (r *fakeProjectRepo) SetConfig(ctx context.Context, projectID uuid.UUID, key string, value any) error {
+	if r.configs == nil {
+		r.configs = datatypes.JSONMap{}
+	}
+	if value == nil {
+		delete(r.configs, key)
+	} else {
+		r.configs[key] = value
+	}
+	return nil
+}
+
+func (r *fakeProjectRepo) ListWithConfig(ctx context.Context, key string) ([]model.Project, error) {
+	return r.projects, nil
+}
+
+func (r *fakeProjectRepo) RotateKey(ctx context.Context, projectID uuid.UUID, hmac, phc string, previousExpiresAt time.Time) (bool, error) {
+	for i := range r.projects {
+		p := &r.projects[i]
+		if p.ID != projectID || p.PreviousKeyValid(time.Now()) {
+			continue
+		}
+		previous := p.SecretKeyHMAC
+		p.PreviousSecretKeyHMAC, p.PreviousSecretKeyHashPHC, p.PreviousKeyExpiresAt = &previous, p.SecretKeyHashPHC, &previousExpiresAt
+		p.SecretKeyHMAC, p.SecretKeyHashPHC = hmac, phc
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeProjectRepo) FinalizeKeyRotation(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	for i := range r.projects {
+		p := &r.projects[i]
+		if p.ID != projectID || p.PreviousSecretKeyHMAC == nil {
+			continue
+		}
+		p.PreviousSecretKeyHMAC, p.PreviousSecretKeyHashPHC, p.PreviousKeyExpiresAt = nil, "", nil
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeProjectRepo) GetBySpace(ctx context.Context, spaceID uuid.UUID) (*model.Project, error) {
+	for i := range r.projects {
+		if id, ok := r.spaces[spaceID]; ok && r.projects[i].ID == id {
+			return &r.projects[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestApplyPartTransforms(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("normalize whitespace", func(t *testing.T) {
+		parts := []model.Part{{Type: "text", Text: "hello  \r\nworld\n\n\n\n\nbye\n"}, {Type: "text", Text: "   "}}
+		_, err := applyPartTransforms(ctx, []model.PartTransformConfig{{Name: model.PartTransformNormalizeWhitespace, Enabled: true}}, parts, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "hello\nworld\n\nbye", parts[0].Text)
+		assert.Equal(t, "   ", parts[1].Text)
+	})
+
+	t.Run("strip base64 images", func(t *testing.T) {
+		meta := map[string]any{"type": "base64", "media_type": "image/png", "data": strings.Repeat("A", 100)}
+		parts := []model.Part{{Type: "image", Meta: meta}, {Type: "image", Meta: map[string]any{"type": "base64", "data": "AAAA"}}}
+		_, err := applyPartTransforms(ctx, []model.PartTransformConfig{{Name: model.PartTransformStripBase64Images, Enabled: true, MaxBytes: 10}}, parts, nil)
+		require.NoError(t, err)
+
+		assert.NotContains(t, parts[0].Meta, "data")
+		assert.Equal(t, true, parts[0].Meta["stripped"])
+		assert.Equal(t, "image/png", parts[0].Meta["media_type"])
+		assert.Contains(t, meta, "data", "the input meta must not be modified")
+		assert.Equal(t, "AAAA", parts[1].Meta["data"])
+	})
+
+	t.Run("truncate tool output", func(t *testing.T) {
+		var stored []byte
+		store := func(ctx context.Context, data []byte, contentType string, ext string) (*model.Asset, error) {
+			stored = data
+			return &model.Asset{S3Key: "assets/full.txt", SHA256: "full"}, nil
+		}
+		output := strings.Repeat("é", 10) // 20 bytes
+		parts := []model.Part{{Type: "tool-result", Text: output, Meta: map[string]any{"tool_call_id": "call_1"}}, {Type: "tool-result", Text: "short"}}
+		_, err := applyPartTransforms(ctx, []model.PartTransformConfig{{Name: model.PartTransformTruncateToolOutput, Enabled: true, MaxBytes: 7}}, parts, store)
+		require.NoError(t, err)
+
+		assert.Equal(t, output, string(stored))
+		assert.Equal(t, strings.Repeat("é", 3), parts[0].Text)
+		assert.Equal(t, "assets/full.txt", parts[0].Asset.S3Key)
+		assert.Equal(t, true, parts[0].Meta["truncated"])
+		assert.Equal(t, "call_1", parts[0].Meta["tool_call_id"])
+		assert.Equal(t, "short", parts[1].Text)
+		assert.Nil(t, parts[1].Asset)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		store := func(ctx context.Context, data []byte, contentType string, ext string) (*model.Asset, error) {
+			return nil, errors.New("boom")
+		}
+		parts := []model.Part{{Type: "tool-result", Text: "a long output"}}
+		_, err := applyPartTransforms(ctx, []model.PartTransformConfig{{Name: model.PartTransformTruncateToolOutput, Enabled: true, MaxBytes: 4}}, parts, store)
+		assert.Error(t, err)
+	})
+
+	t.Run("disabled and unknown steps", func(t *testing.T) {
+		parts := []model.Part{{Type: "text", Text: "a  "}}
+		skipped, err := applyPartTransforms(ctx, []model.PartTransformConfig{
+			{Name: model.PartTransformNormalizeWhitespace, Enabled: false},
+			{Name: "shout", Enabled: true},
+		}, parts, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shout"}, skipped)
+		assert.Equal(t, "a  ", parts[0].Text)
+	})
+}
+
+func TestPartTransformService(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Ingest: config.IngestCfg{PartTransforms: []config.PartTransformCfg{
+		{Name: model.PartTransformTruncateToolOutput, Enabled: true, MaxBytes: 1024},
+	}}}
+	r := &fakeProjectRepo{}
+	svc := NewPartTransformService(r, cfg)
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Equal(t, []model.PartTransformConfig{{Name: model.PartTransformTruncateToolOutput, Enabled: true, MaxBytes: 1024}}, svc.GetPipeline(ctx, project))
+
+	pipeline := []model.PartTransformConfig{
+		{Name: model.PartTransformNormalizeWhitespace, Enabled: true},
+		{Name: model.PartTransformStripBase64Images, Enabled: false, MaxBytes: 2048},
+	}
+	out, err := svc.UpdatePipeline(ctx, project, pipeline)
+	require.NoError(t, err)
+	assert.Equal(t, pipeline, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	out, err = svc.UpdatePipeline(ctx, project, []model.PartTransformConfig{})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	out, err = svc.UpdatePipeline(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Equal(t, svc.GetPipeline(ctx, &model.Project{}), out)
+
+	_, err = svc.UpdatePipeline(ctx, project, []model.PartTransformConfig{{Name: "shout", Enabled: true}})
+	assert.ErrorIs(t, err, ErrUnknownPartTransform)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/infra/llm"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+// MessageProcessor is a side effect of a persisted message. Processors normally run in the MQ consumers,
+// SendMessage with sync=true runs them inline, so they must tolerate processing the same message twice.
+type MessageProcessor interface {
+	Name() string
+	Process(ctx context.Context, ev SendMQPublishJSON) (any, error)
+}
+
+// Processor names, they are also the names used to record the processing status of a message
+const (
+	ProcessorSpaceSync = "space_sync"
+	ProcessorSummary   = "summary"
+	ProcessorEmbedding = "embedding"
+	ProcessorClassify  = "classification"
+)
+
+const (
+	ProcessorStatusOK    = "ok"
+	ProcessorStatusError = "error"
+)
+
+// ProcessorResult is the outcome of a processor run inline
+type ProcessorResult struct {
+	Name   string `json:"name" example:"summary"`
+	Status string `json:"status" enums:"ok,error"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// MessageProcessing is the processing state of a message, Processors maps each processor to pending, done or failed
+type MessageProcessing struct {
+	MessageID  uuid.UUID         `json:"message_id"`
+	Processors map[string]string `json:"processors"`
+	Complete   bool              `json:"complete"` // every processor is done
+}
+
+type PostIngestService interface {
+	Run(ctx context.Context, ev SendMQPublishJSON) []ProcessorResult
+	HandleDelivery(ctx context.Context, processor string, body []byte) error
+	Status(ctx context.Context, messageIDs []uuid.UUID) ([]MessageProcessing, error)
+}
+
+type postIngestService struct {
+	r          repo.ProcessingStatusRepo
+	log        *zap.Logger
+	processors []MessageProcessor
+}
+
+func NewPostIngestService(r repo.ProcessingStatusRepo, log *zap.Logger, processors ...MessageProcessor) PostIngestService {
+	return &postIngestService{r: r, log: log, processors: processors}
+}
+
+// Run runs every processor in order. A failing processor does not stop the others, its error is reported in its result
+// and the MQ consumer retries it later.
+func (s *postIngestService) Run(ctx context.Context, ev SendMQPublishJSON) []ProcessorResult {
+	results := make([]ProcessorResult, 0, len(s.processors))
+	for _, p := range s.processors {
+		res := ProcessorResult{Name: p.Name(), Status: ProcessorStatusOK}
+		out, err := s.process(ctx, p, ev)
+		if err != nil {
+			res.Status, res.Error = ProcessorStatusError, err.Error()
+		} else {
+			res.Result = out
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// HandleDelivery is the session message MQ consumer handler of a processor, a failed run is requeued.
+// Malformed payloads and unknown processors are dropped rather than requeued.
+func (s *postIngestService) HandleDelivery(ctx context.Context, processor string, body []byte) error {
+	var ev SendMQPublishJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		s.log.Warn("invalid session message event", zap.Error(err))
+		return nil
+	}
+	for _, p := range s.processors {
+		if p.Name() == processor {
+			_, err := s.process(ctx, p, ev)
+			return err
+		}
+	}
+	s.log.Warn("unknown message processor", zap.String("processor", processor))
+	return nil
+}
+
+// process runs p and records its state for the message
+func (s *postIngestService) process(ctx context.Context, p MessageProcessor, ev SendMQPublishJSON) (any, error) {
+	out, err := p.Process(ctx, ev)
+	status := &model.MessageProcessingStatus{MessageID: ev.MessageID, Processor: p.Name(), Status: model.ProcessingStatusDone}
+	if err != nil {
+		status.Status, status.Error = model.ProcessingStatusFailed, err.Error()
+	}
+	if serr := s.r.Set(ctx, status); serr != nil {
+		s.log.Warn("failed to record message processing status", zap.String("processor", p.Name()), zap.String("message_id", ev.MessageID.String()), zap.Error(serr))
+	}
+	return out, err
+}
+
+// Status returns the processing state of the messages in the given order. Every configured processor is listed,
+// pending until it ran; states recorded by processors that are no longer configured are left out.
+func (s *postIngestService) Status(ctx context.Context, messageIDs []uuid.UUID) ([]MessageProcessing, error) {
+	rows, err := s.r.ListByMessageIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	byMessage := make(map[uuid.UUID]map[string]string, len(messageIDs))
+	for _, row := range rows {
+		if byMessage[row.MessageID] == nil {
+			byMessage[row.MessageID] = map[string]string{}
+		}
+		byMessage[row.MessageID][row.Processor] = row.Status
+	}
+
+	out := make([]MessageProcessing, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		m := MessageProcessing{MessageID: id, Processors: map[string]string{}, Complete: true}
+		for _, p := range s.processors {
+			m.Processors[p.Name()] = model.ProcessingStatusPending
+		}
+		for name, status := range byMessage[id] {
+			if _, ok := m.Processors[name]; ok {
+				m.Processors[name] = status
+			}
+		}
+		for _, status := range m.Processors {
+			if status != model.ProcessingStatusDone {
+				m.Complete = false
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+type syncRuleProcessor struct{ svc SyncRuleService }
+
+// NewSyncRuleProcessor copies the message into the pages of the matching sync rules, its result is the created block IDs
+func NewSyncRuleProcessor(svc SyncRuleService) MessageProcessor {
+	return &syncRuleProcessor{svc: svc}
+}
+
+func (p *syncRuleProcessor) Name() string { return ProcessorSpaceSync }
+
+func (p *syncRuleProcessor) Process(ctx context.Context, ev SendMQPublishJSON) (any, error) {
+	ids, err := p.svc.SyncMessage(ctx, ev)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]uuid.UUID{"block_ids": ids}, nil
+}
+
+type summaryProcessor struct {
+	summarySvc SummaryService
+	sessionSvc SessionService
+}
+
+// NewSummaryProcessor updates the rolling summary of the session, its result is the summary
+func NewSummaryProcessor(summarySvc SummaryService, sessionSvc SessionService) MessageProcessor {
+	return &summaryProcessor{summarySvc: summarySvc, sessionSvc: sessionSvc}
+}
+
+func (p *summaryProcessor) Name() string { return ProcessorSummary }
+
+func (p *summaryProcessor) Process(ctx context.Context, ev SendMQPublishJSON) (any, error) {
+	if err := p.summarySvc.Summarize(ctx, ev.SessionID); err != nil {
+		return nil, err
+	}
+	return p.sessionSvc.GetSummary(ctx, ev.ProjectID, ev.SessionID)
+}
+
+// messageEmbeddingMaxTokens bounds the text of a message sent to the embedding model
+const messageEmbeddingMaxTokens = 8000
+
+// TextEmbedder embeds texts with the embedding model of a project, the core client implements it
+type TextEmbedder interface {
+	Embed(ctx context.Context, projectID uuid.UUID, req httpclient.EmbedRequest) (*httpclient.EmbedResponse, error)
+}
+
+type embeddingProcessor struct {
+	r          repo.EmbeddingRepo
+	sessionSvc SessionService
+	embedder   TextEmbedder
+}
+
+// NewEmbeddingProcessor embeds the text of the message and stores it, its result is the model and the dimensions
+func NewEmbeddingProcessor(r repo.EmbeddingRepo, sessionSvc SessionService, embedder TextEmbedder) MessageProcessor {
+	return &embeddingProcessor{r: r, sessionSvc: sessionSvc, embedder: embedder}
+}
+
+func (p *embeddingProcessor) Name() string { return ProcessorEmbedding }
+
+func (p *embeddingProcessor) Process(ctx context.Context, ev SendMQPublishJSON) (any, error) {
+	msg, err := p.sessionSvc.GetMessage(ctx, ev.SessionID, ev.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	text := MessageEmbeddingText(msg.Parts)
+	if strings.TrimSpace(text) == "" {
+		return map[string]any{"embedded": false}, nil
+	}
+	if text, err = tokenizer.TruncateTokens(text, messageEmbeddingMaxTokens); err != nil {
+		return nil, err
+	}
+
+	out, err := p.embedder.Embed(ctx, ev.ProjectID, httpclient.EmbedRequest{Texts: []string{text}})
+	if err != nil {
+		return nil, fmt.Errorf("embed message: %w", err)
+	}
+	if len(out.Embeddings) != 1 {
+		return nil, fmt.Errorf("embed message: got %d embeddings for 1 text", len(out.Embeddings))
+	}
+	if err := p.r.SetMessageEmbedding(ctx, &model.MessageEmbedding{
+		MessageID: msg.ID,
+		Model:     out.Model,
+		Embedding: datatypes.NewJSONSlice(out.Embeddings[0]),
+	}); err != nil {
+		return nil, err
+	}
+	return map[string]any{"embedded": true, "model": out.Model, "dimensions": len(out.Embeddings[0])}, nil
+}
+
+// classifyMaxInputTokens bounds the text of a message sent to the LLM for classification
+const classifyMaxInputTokens = 4000
+
+const classifySystemPrompt = "You label the messages of a conversation between a user and an AI agent. " +
+	"Answer with a JSON array of the labels that apply to the message, chosen from the given labels only, " +
+	"or [] if none applies."
+
+type classifyProcessor struct {
+	sessionRepo repo.SessionRepo
+	sessionSvc  SessionService
+	llm         llm.Client
+	labels      []string
+}
+
+// NewClassifyProcessor asks the LLM which of the labels apply to the message and stores them in meta.labels,
+// its result is the labels
+func NewClassifyProcessor(sessionRepo repo.SessionRepo, sessionSvc SessionService, llmClient llm.Client, labels []string) MessageProcessor {
+	return &classifyProcessor{sessionRepo: sessionRepo, sessionSvc: sessionSvc, llm: llmClient, labels: labels}
+}
+
+func (p *classifyProcessor) Name() string { return ProcessorClassify }
+
+func (p *classifyProcessor) Process(ctx context.Context, ev SendMQPublishJSON) (any, error) {
+	msg, err := p.sessionSvc.GetMessage(ctx, ev.SessionID, ev.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []string{}
+	if text := syncMessageText(msg.Parts); strings.TrimSpace(text) != "" {
+		if text, err = tokenizer.TruncateTokens(text, classifyMaxInputTokens); err != nil {
+			return nil, err
+		}
+		prompt := fmt.Sprintf("Labels: %s\n\nMessage:\n%s: %s", strings.Join(p.labels, ", "), msg.Role, text)
+		answer, err := p.llm.Complete(ctx, classifySystemPrompt, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("classify message: %w", err)
+		}
+		labels = parseLabels(answer, p.labels)
+	}
+
+	if err := p.sessionRepo.MergeMessageMeta(ctx, ev.SessionID, msg.ID, map[string]any{"labels": labels}); err != nil {
+		return nil, err
+	}
+	return map[string][]string{"labels": labels}, nil
+}
+
+// parseLabels reads the JSON array of an LLM answer and keeps the allowed labels, in the case of allowed and
+// without duplicates. An answer without an array has no label.
+func parseLabels(answer string, allowed []string) []string {
+	labels := []string{}
+	start, end := strings.Index(answer, "["), strings.LastIndex(answer, "]")
+	if start < 0 || end < start {
+		return labels
+	}
+	var raw []string
+	if err := sonic.Unmarshal([]byte(answer[start:end+1]), &raw); err != nil {
+		return labels
+	}
+
+	seen := map[string]bool{}
+	for _, r := range raw {
+		for _, a := range allowed {
+			if strings.EqualFold(strings.TrimSpace(r), a) && !seen[a] {
+				seen[a] = true
+				labels = append(labels, a)
+			}
+		}
+	}
+	return labels
+}
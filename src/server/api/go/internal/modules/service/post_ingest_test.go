@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeProcessor struct {
+	name  string
+	out   any
+	err   error
+	calls int
+}
+
+func (p *fakeProcessor) Name() string { return p.name }
+
+func (p *fakeProcessor) Process(ctx context.Context, ev SendMQPublishJSON) (any, error) {
+	p.calls++
+	return p.out, p.err
+}
+
+type fakeProcessingStatusRepo struct {
+	rows []model.MessageProcessingStatus
+}
+
+func (r *fakeProcessingStatusRepo) Set(ctx context.Context, s *model.MessageProcessingStatus) error {
+	for i := range r.rows {
+		if r.rows[i].MessageID == s.MessageID && r.rows[i].Processor == s.Processor {
+			r.rows[i] = *s
+			return nil
+		}
+	}
+	r.rows = append(r.rows, *s)
+	return nil
+}
+
+func (r *fakeProcessingStatusRepo) ListByMessageIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.MessageProcessingStatus, error) {
+	out := []model.MessageProcessingStatus{}
+	for _, row := range r.rows {
+		for _, id := range messageIDs {
+			if row.MessageID == id {
+				out = append(out, row)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestPostIngestService_Run(t *testing.T) {
+	failing := &fakeProcessor{name: "space_sync", err: errors.New("db down")}
+	ok := &fakeProcessor{name: "summary", out: "a summary"}
+	statuses := &fakeProcessingStatusRepo{}
+	svc := NewPostIngestService(statuses, zap.NewNop(), failing, ok)
+	ev := SendMQPublishJSON{SessionID: uuid.New(), MessageID: uuid.New()}
+
+	results := svc.Run(context.Background(), ev)
+
+	assert.Equal(t, []ProcessorResult{
+		{Name: "space_sync", Status: ProcessorStatusError, Error: "db down"},
+		{Name: "summary", Status: ProcessorStatusOK, Result: "a summary"},
+	}, results)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 1, ok.calls)
+	require.Len(t, statuses.rows, 2)
+	assert.Equal(t, model.ProcessingStatusFailed, statuses.rows[0].Status)
+	assert.Equal(t, "db down", statuses.rows[0].Error)
+	assert.Equal(t, model.ProcessingStatusDone, statuses.rows[1].Status)
+}
+
+func TestPostIngestService_RunWithoutProcessors(t *testing.T) {
+	results := NewPostIngestService(&fakeProcessingStatusRepo{}, zap.NewNop()).Run(context.Background(), SendMQPublishJSON{})
+	assert.NotNil(t, results)
+	assert.Empty(t, results)
+}
+
+func TestPostIngestService_HandleDelivery(t *testing.T) {
+	sync := &fakeProcessor{name: "space_sync", err: errors.New("db down")}
+	summary := &fakeProcessor{name: "summary"}
+	statuses := &fakeProcessingStatusRepo{}
+	svc := NewPostIngestService(statuses, zap.NewNop(), sync, summary)
+	body := []byte(`{"project_id":"` + uuid.NewString() + `","session_id":"` + uuid.NewString() + `","message_id":"` + uuid.NewString() + `"}`)
+
+	// only the named processor runs, its error requeues the event
+	assert.Error(t, svc.HandleDelivery(context.Background(), "space_sync", body))
+	assert.Equal(t, 1, sync.calls)
+	assert.Equal(t, 0, summary.calls)
+
+	assert.NoError(t, svc.HandleDelivery(context.Background(), "summary", body))
+	assert.Equal(t, 1, summary.calls)
+
+	// malformed payloads and unknown processors are dropped
+	assert.NoError(t, svc.HandleDelivery(context.Background(), "summary", []byte("{")))
+	assert.NoError(t, svc.HandleDelivery(context.Background(), "unknown", body))
+	assert.Equal(t, 1, summary.calls)
+}
+
+func TestPostIngestService_Status(t *testing.T) {
+	done, failed, fresh := uuid.New(), uuid.New(), uuid.New()
+	statuses := &fakeProcessingStatusRepo{rows: []model.MessageProcessingStatus{
+		{MessageID: done, Processor: "space_sync", Status: model.ProcessingStatusDone},
+		{MessageID: done, Processor: "embedding", Status: model.ProcessingStatusFailed}, // no longer configured
+		{MessageID: failed, Processor: "space_sync", Status: model.ProcessingStatusFailed},
+	}}
+	svc := NewPostIngestService(statuses, zap.NewNop(), &fakeProcessor{name: "space_sync"})
+
+	out, err := svc.Status(context.Background(), []uuid.UUID{done, failed, fresh})
+	require.NoError(t, err)
+	assert.Equal(t, []MessageProcessing{
+		{MessageID: done, Processors: map[string]string{"space_sync": "done"}, Complete: true},
+		{MessageID: failed, Processors: map[string]string{"space_sync": "failed"}, Complete: false},
+		{MessageID: fresh, Processors: map[string]string{"space_sync": "pending"}, Complete: false},
+	}, out)
+}
+
+// messageSessionService serves GetMessage from memory
+type messageSessionService struct {
+	SessionService
+	msg model.Message
+}
+
+func (s *messageSessionService) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	return &s.msg, nil
+}
+
+type fakeEmbedder struct {
+	texts []string
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, projectID uuid.UUID, req httpclient.EmbedRequest) (*httpclient.EmbedResponse, error) {
+	f.texts = append(f.texts, req.Texts...)
+	return &httpclient.EmbedResponse{Embeddings: [][]float32{{0.6, 0.8}}, Model: "text-embedding-3-small"}, nil
+}
+
+type answerLLM struct {
+	answer string
+}
+
+func (f *answerLLM) Complete(ctx context.Context, system string, prompt string) (string, error) {
+	return f.answer, nil
+}
+
+func TestEmbeddingProcessor(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+	msg := textMessage("user", "hello")
+	ev := SendMQPublishJSON{ProjectID: uuid.New(), SessionID: msg.SessionID, MessageID: msg.ID}
+	r := &MockEmbeddingRepo{}
+	r.On("SetMessageEmbedding", mock.Anything, mock.MatchedBy(func(e *model.MessageEmbedding) bool {
+		return e.MessageID == msg.ID && e.Model == "text-embedding-3-small" && len(e.Embedding) == 2
+	})).Return(nil)
+	embedder := &fakeEmbedder{}
+
+	out, err := NewEmbeddingProcessor(r, &messageSessionService{msg: msg}, embedder).Process(context.Background(), ev)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"embedded": true, "model": "text-embedding-3-small", "dimensions": 2}, out)
+	assert.Equal(t, []string{"hello"}, embedder.texts)
+	r.AssertExpectations(t)
+
+	// a message without text is not embedded
+	empty := model.Message{ID: uuid.New(), Role: "user", Parts: []model.Part{{Type: "image"}}}
+	out, err = NewEmbeddingProcessor(r, &messageSessionService{msg: empty}, embedder).Process(context.Background(), ev)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"embedded": false}, out)
+	assert.Len(t, embedder.texts, 1)
+}
+
+func TestClassifyProcessor(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+	msg := textMessage("user", "the deploy failed again")
+	ev := SendMQPublishJSON{ProjectID: uuid.New(), SessionID: msg.SessionID, MessageID: msg.ID}
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("MergeMessageMeta", mock.Anything, msg.SessionID, msg.ID, map[string]any{"labels": []string{"bug"}}).Return(nil)
+	llmClient := &answerLLM{answer: `["Bug", "bug", "feature"]`}
+
+	out, err := NewClassifyProcessor(sessionRepo, &messageSessionService{msg: msg}, llmClient, []string{"bug", "question"}).Process(context.Background(), ev)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"labels": {"bug"}}, out)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestParseLabels(t *testing.T) {
+	allowed := []string{"bug", "question"}
+	assert.Equal(t, []string{"question", "bug"}, parseLabels("Labels: [\"Question\", \" bug \"]", allowed))
+	assert.Equal(t, []string{}, parseLabels("[]", allowed))
+	assert.Equal(t, []string{}, parseLabels("none of them", allowed))
+	assert.Equal(t, []string{}, parseLabels("[bug", allowed))
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// Redis key prefix for presigned asset URLs
+	redisKeyPrefixPresign = "presign:"
+	// maxLocalPresignEntries bounds the in-memory cache, expired windows are dropped when it is full
+	maxLocalPresignEntries = 10000
+)
+
+type localPresign struct {
+	url   PublicURL
+	until time.Time // end of the window
+}
+
+// presignCache reuses presigned asset URLs within fixed time windows, in memory and in Redis when available.
+// URLs are keyed by S3 key, expiry and window, so every instance hands out the same URL during a window,
+// and a window lasts at most half of the expiry so a cached URL is always valid for at least half of it.
+type presignCache struct {
+	ttl   time.Duration
+	redis *redis.Client
+	log   *zap.Logger
+
+	mu    sync.Mutex
+	local map[string]localPresign
+}
+
+func newPresignCache(ttl time.Duration, rdb *redis.Client, log *zap.Logger) *presignCache {
+	return &presignCache{ttl: ttl, redis: rdb, log: log, local: map[string]localPresign{}}
+}
+
+// get returns the cached URL of key for expire, presigning it when the current window has none
+func (c *presignCache) get(ctx context.Context, key string, expire time.Duration, presign func() (string, error)) (PublicURL, error) {
+	now := time.Now()
+	if c == nil || min(c.ttl, expire/2) <= 0 {
+		url, err := presign()
+		return PublicURL{URL: url, ExpireAt: now.Add(expire)}, err
+	}
+
+	ttl := min(c.ttl, expire/2)
+	window := now.UnixNano() / int64(ttl)
+	windowEnd := time.Unix(0, (window+1)*int64(ttl))
+	cacheKey := fmt.Sprintf("%s%s:%d:%d", redisKeyPrefixPresign, key, int64(expire/time.Second), window)
+
+	c.mu.Lock()
+	e, ok := c.local[cacheKey]
+	c.mu.Unlock()
+	if ok {
+		return e.url, nil
+	}
+
+	if c.redis != nil {
+		if val, err := c.redis.Get(ctx, cacheKey).Result(); err == nil {
+			var u PublicURL
+			if err := sonic.UnmarshalString(val, &u); err == nil {
+				c.store(cacheKey, u, windowEnd)
+				return u, nil
+			}
+		} else if err != redis.Nil {
+			c.log.Warn("failed to get presigned url from Redis", zap.String("key", key), zap.Error(err))
+		}
+	}
+
+	url, err := presign()
+	if err != nil {
+		return PublicURL{}, err
+	}
+	u := PublicURL{URL: url, ExpireAt: now.Add(expire)}
+	c.store(cacheKey, u, windowEnd)
+
+	if c.redis != nil {
+		if b, err := sonic.MarshalString(u); err == nil {
+			if err := c.redis.Set(ctx, cacheKey, b, windowEnd.Sub(now)).Err(); err != nil {
+				c.log.Warn("failed to cache presigned url in Redis", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+	return u, nil
+}
+
+func (c *presignCache) store(cacheKey string, u PublicURL, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.local) >= maxLocalPresignEntries {
+		now := time.Now()
+		for k, e := range c.local {
+			if !now.Before(e.until) {
+				delete(c.local, k)
+			}
+		}
+		if len(c.local) >= maxLocalPresignEntries {
+			c.local = map[string]localPresign{}
+		}
+	}
+	c.local[cacheKey] = localPresign{url: u, until: until}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func countingPresign(calls *int) func() (string, error) {
+	return func() (string, error) {
+		*calls++
+		return fmt.Sprintf("https://s3/url-%d", *calls), nil
+	}
+}
+
+func TestPresignCache_ReusesWithinWindow(t *testing.T) {
+	ctx := context.Background()
+	c := newPresignCache(time.Hour, nil, zap.NewNop())
+	calls := 0
+
+	first, err := c.get(ctx, "assets/a.png", 24*time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	second, err := c.get(ctx, "assets/a.png", 24*time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, first, second)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), first.ExpireAt, time.Minute)
+
+	// another key or expiry is presigned separately
+	_, err = c.get(ctx, "assets/b.png", 24*time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	_, err = c.get(ctx, "assets/a.png", time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestPresignCache_Disabled(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+
+	c := newPresignCache(0, nil, zap.NewNop())
+	for range 2 {
+		_, err := c.get(ctx, "assets/a.png", time.Hour, countingPresign(&calls))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+
+	var nilCache *presignCache
+	_, err := nilCache.get(ctx, "assets/a.png", time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestPresignCache_ErrorsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+	c := newPresignCache(time.Hour, nil, zap.NewNop())
+
+	_, err := c.get(ctx, "assets/a.png", time.Hour, func() (string, error) { return "", errors.New("signing failed") })
+	assert.Error(t, err)
+
+	calls := 0
+	_, err = c.get(ctx, "assets/a.png", time.Hour, countingPresign(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
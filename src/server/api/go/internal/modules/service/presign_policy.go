@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrInvalidPresignPolicy = errors.New("invalid presign policy")
+	ErrPresignExpireTooLong = errors.New("presigned url expiry is too long")
+)
+
+type PresignPolicyService interface {
+	Get(ctx context.Context, project *model.Project) *model.PresignPolicy
+	Update(ctx context.Context, project *model.Project, policy *model.PresignPolicy) (*model.PresignPolicy, error)
+}
+
+type presignPolicyService struct {
+	r repo.ProjectRepo
+}
+
+func NewPresignPolicyService(r repo.ProjectRepo) PresignPolicyService {
+	return &presignPolicyService{r: r}
+}
+
+// Get returns the presigned URL policy of the project, nil when the server defaults apply
+func (s *presignPolicyService) Get(ctx context.Context, project *model.Project) *model.PresignPolicy {
+	return project.PresignPolicy()
+}
+
+// Update replaces the presigned URL policy of the project, a nil policy restores the server defaults
+func (s *presignPolicyService) Update(ctx context.Context, project *model.Project, policy *model.PresignPolicy) (*model.PresignPolicy, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if policy == nil {
+		delete(configs, model.ProjectPresignPolicyKey)
+	} else {
+		maxSec := int(model.MaxPresignExpire / time.Second)
+		switch {
+		case policy.DefaultExpireSec < 0 || policy.MaxExpireSec < 0:
+			return nil, fmt.Errorf("%w: expiries must not be negative", ErrInvalidPresignPolicy)
+		case policy.MaxExpireSec > maxSec:
+			return nil, fmt.Errorf("%w: max_expire_sec must be at most %d", ErrInvalidPresignPolicy, maxSec)
+		case policy.DefaultExpireSec > maxSec:
+			return nil, fmt.Errorf("%w: default_expire_sec must be at most %d", ErrInvalidPresignPolicy, maxSec)
+		case policy.MaxExpireSec > 0 && policy.DefaultExpireSec > policy.MaxExpireSec:
+			return nil, fmt.Errorf("%w: default_expire_sec must not exceed max_expire_sec", ErrInvalidPresignPolicy)
+		}
+		configs[model.ProjectPresignPolicyKey] = map[string]interface{}{
+			"default_expire_sec": policy.DefaultExpireSec,
+			"max_expire_sec":     policy.MaxExpireSec,
+		}
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectPresignPolicyKey, configs[model.ProjectPresignPolicyKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.PresignPolicy(), nil
+}
+
+// PresignExpire resolves the expiry of a presigned URL of the project. requested is the expiry in seconds asked by
+// the request, 0 when it asks for none: the default of the project policy applies then, or else fallback, the
+// default of the endpoint, both capped at the maximum. A requested expiry beyond the maximum of the project, or
+// beyond 7 days without one, is refused with ErrPresignExpireTooLong.
+func PresignExpire(project *model.Project, requested int, fallback time.Duration) (time.Duration, error) {
+	limit, expire := model.MaxPresignExpire, fallback
+	if project != nil {
+		if policy := project.PresignPolicy(); policy != nil {
+			if policy.MaxExpireSec > 0 {
+				limit = min(limit, time.Duration(policy.MaxExpireSec)*time.Second)
+			}
+			if policy.DefaultExpireSec > 0 {
+				expire = time.Duration(policy.DefaultExpireSec) * time.Second
+			}
+		}
+	}
+
+	if requested > 0 {
+		if d := time.Duration(requested) * time.Second; d > limit {
+			return 0, fmt.Errorf("%w: expire must be at most %d seconds", ErrPresignExpireTooLong, int(limit/time.Second))
+		}
+		return time.Duration(requested) * time.Second, nil
+	}
+	return min(expire, limit), nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestPresignPolicyService_Update(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewPresignPolicyService(r)
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	policy := &model.PresignPolicy{DefaultExpireSec: 900, MaxExpireSec: 3600}
+	out, err := svc.Update(ctx, project, policy)
+	require.NoError(t, err)
+	assert.Equal(t, policy, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+	assert.Equal(t, policy, svc.Get(ctx, project))
+
+	for _, invalid := range []model.PresignPolicy{
+		{DefaultExpireSec: -1},
+		{MaxExpireSec: 604801},
+		{DefaultExpireSec: 604801},
+		{DefaultExpireSec: 7200, MaxExpireSec: 3600},
+	} {
+		_, err = svc.Update(ctx, project, &invalid)
+		assert.ErrorIs(t, err, ErrInvalidPresignPolicy)
+	}
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectPresignPolicyKey)
+}
+
+func TestPresignExpire(t *testing.T) {
+	policy := func(defaultSec, maxSec float64) *model.Project {
+		return &model.Project{Configs: datatypes.JSONMap{model.ProjectPresignPolicyKey: map[string]interface{}{
+			"default_expire_sec": defaultSec,
+			"max_expire_sec":     maxSec,
+		}}}
+	}
+
+	tests := []struct {
+		name      string
+		project   *model.Project
+		requested int
+		want      time.Duration
+		tooLong   bool
+	}{
+		{name: "endpoint default", project: &model.Project{}, want: time.Hour},
+		{name: "no project", want: time.Hour},
+		{name: "requested", project: &model.Project{}, requested: 60, want: time.Minute},
+		{name: "server maximum", project: &model.Project{}, requested: 604801, tooLong: true},
+		{name: "project default", project: policy(900, 0), want: 15 * time.Minute},
+		{name: "project maximum", project: policy(0, 600), requested: 601, tooLong: true},
+		{name: "endpoint default capped at the project maximum", project: policy(0, 600), want: 10 * time.Minute},
+		{name: "requested within the project maximum", project: policy(900, 1800), requested: 1800, want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PresignExpire(tt.project, tt.requested, time.Hour)
+			if tt.tooLong {
+				assert.ErrorIs(t, err, ErrPresignExpireTooLong)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
+)
+
+const (
+	DefaultKeyGracePeriod = 24 * time.Hour
+	MaxKeyGracePeriod     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrKeyRotationPending  = errors.New("the previous key of a rotation is still valid, finalize the rotation first")
+	ErrNoKeyRotation       = errors.New("no key rotation to finalize")
+	ErrInvalidGracePeriod  = errors.New("grace period must be between 1 second and 30 days")
+	ErrKeyRotationDisabled = errors.New("key rotation needs a secret pepper")
+)
+
+type ProjectKeyState struct {
+	// Rotating is true while the key replaced by a rotation is still accepted
+	Rotating             bool       `json:"rotating"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty"`
+}
+
+type RotatedProjectKey struct {
+	// Token is the new bearer token of the project, it is only returned once
+	Token                string    `json:"token"`
+	PreviousKeyExpiresAt time.Time `json:"previous_key_expires_at"`
+}
+
+type ProjectKeyService interface {
+	State(ctx context.Context, project *model.Project) *ProjectKeyState
+	Rotate(ctx context.Context, project *model.Project, grace time.Duration) (*RotatedProjectKey, error)
+	Finalize(ctx context.Context, project *model.Project) error
+}
+
+type projectKeyService struct {
+	r   repo.ProjectRepo
+	cfg *config.Config
+}
+
+func NewProjectKeyService(r repo.ProjectRepo, cfg *config.Config) ProjectKeyService {
+	return &projectKeyService{r: r, cfg: cfg}
+}
+
+func (s *projectKeyService) State(ctx context.Context, project *model.Project) *ProjectKeyState {
+	if !project.PreviousKeyValid(time.Now()) {
+		return &ProjectKeyState{}
+	}
+	return &ProjectKeyState{Rotating: true, PreviousKeyExpiresAt: project.PreviousKeyExpiresAt}
+}
+
+// Rotate issues a new key for the project. The current key stays valid for grace, so clients can switch
+// to the new one without downtime, and is revoked by Finalize or when grace ends.
+func (s *projectKeyService) Rotate(ctx context.Context, project *model.Project, grace time.Duration) (*RotatedProjectKey, error) {
+	if grace == 0 {
+		grace = DefaultKeyGracePeriod
+	}
+	if grace < time.Second || grace > MaxKeyGracePeriod {
+		return nil, ErrInvalidGracePeriod
+	}
+	pepper := s.cfg.Root.SecretPepper
+	if pepper == "" {
+		return nil, ErrKeyRotationDisabled
+	}
+
+	secret, err := secrets.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	phc, err := secrets.HashSecret(secret, pepper)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(grace)
+	rotated, err := s.r.RotateKey(ctx, project.ID, tokens.HMAC256Hex(pepper, secret), phc, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, ErrKeyRotationPending
+	}
+	return &RotatedProjectKey{Token: s.cfg.Root.ProjectBearerTokenPrefix + secret, PreviousKeyExpiresAt: expiresAt}, nil
+}
+
+// Finalize revokes the key replaced by the last rotation
+func (s *projectKeyService) Finalize(ctx context.Context, project *model.Project) error {
+	finalized, err := s.r.FinalizeKeyRotation(ctx, project.ID)
+	if err != nil {
+		return err
+	}
+	if !finalized {
+		return ErrNoKeyRotation
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectKeyService_Rotate(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Root: config.RootCfg{ProjectBearerTokenPrefix: "sk-ac-", SecretPepper: "pepper"}}
+	r := &fakeProjectRepo{projects: []model.Project{{ID: uuid.New(), SecretKeyHMAC: "old-hmac", SecretKeyHashPHC: "old-phc"}}}
+	svc := NewProjectKeyService(r, cfg)
+	project := &r.projects[0]
+
+	assert.False(t, svc.State(ctx, project).Rotating)
+
+	out, err := svc.Rotate(ctx, project, time.Hour)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out.Token, "sk-ac-"))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), out.PreviousKeyExpiresAt, time.Minute)
+
+	// the new token authenticates, the old key is kept until the grace period ends
+	secret := strings.TrimPrefix(out.Token, "sk-ac-")
+	assert.Equal(t, tokens.HMAC256Hex("pepper", secret), project.SecretKeyHMAC)
+	pass, err := secrets.VerifySecret(secret, "pepper", project.SecretKeyHashPHC)
+	require.NoError(t, err)
+	assert.True(t, pass)
+	require.NotNil(t, project.PreviousSecretKeyHMAC)
+	assert.Equal(t, "old-hmac", *project.PreviousSecretKeyHMAC)
+
+	state := svc.State(ctx, project)
+	assert.True(t, state.Rotating)
+
+	_, err = svc.Rotate(ctx, project, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyRotationPending)
+
+	require.NoError(t, svc.Finalize(ctx, project))
+	assert.Nil(t, project.PreviousSecretKeyHMAC)
+	assert.False(t, svc.State(ctx, project).Rotating)
+	assert.ErrorIs(t, svc.Finalize(ctx, project), ErrNoKeyRotation)
+
+	_, err = svc.Rotate(ctx, project, 31*24*time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidGracePeriod)
+}
+
+func TestProjectKeyService_RotateAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Root: config.RootCfg{ProjectBearerTokenPrefix: "sk-ac-", SecretPepper: "pepper"}}
+	previous, expired := "older-hmac", time.Now().Add(-time.Minute)
+	r := &fakeProjectRepo{projects: []model.Project{{ID: uuid.New(), SecretKeyHMAC: "old-hmac", PreviousSecretKeyHMAC: &previous, PreviousKeyExpiresAt: &expired}}}
+	svc := NewProjectKeyService(r, cfg)
+
+	assert.False(t, svc.State(ctx, &r.projects[0]).Rotating)
+	_, err := svc.Rotate(ctx, &r.projects[0], 0)
+	require.NoError(t, err)
+	assert.Equal(t, "old-hmac", *r.projects[0].PreviousSecretKeyHMAC)
+	assert.WithinDuration(t, time.Now().Add(DefaultKeyGracePeriod), *r.projects[0].PreviousKeyExpiresAt, time.Minute)
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+)
+
+// Quotas a project may exceed
+const (
+	QuotaMessages = "messages"
+	QuotaStorage  = "storage"
+)
+
+// QuotaExceededError reports a request refused because the project is over a quota
+type QuotaExceededError struct {
+	Quota string `json:"quota" enums:"messages,storage"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+	// Requested is the number of messages or the bytes the refused request would have stored
+	Requested int64 `json:"requested,omitempty"`
+	// ResetAt is when the quota is available again, null when usage must be reduced instead
+	ResetAt *time.Time `json:"reset_at"`
+	// RetryAfterSec is the number of seconds until ResetAt, null without it
+	RetryAfterSec *int64 `json:"retry_after_sec"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Quota == QuotaMessages {
+		return fmt.Sprintf("message quota exceeded: %d of %d messages stored today", e.Used, e.Limit)
+	}
+	return fmt.Sprintf("storage quota exceeded: %d of %d bytes used", e.Used, e.Limit)
+}
+
+type QuotaService interface {
+	State(ctx context.Context, project *model.Project, now time.Time) (*QuotaState, error)
+	CheckMessages(ctx context.Context, project *model.Project, now time.Time, adding int64) error
+	CheckStorage(ctx context.Context, project *model.Project, incomingBytes int64) error
+}
+
+type quotaService struct {
+	r   repo.QuotaRepo
+	cfg *config.Config
+}
+
+func NewQuotaService(r repo.QuotaRepo, cfg *config.Config) QuotaService {
+	return &quotaService{r: r, cfg: cfg}
+}
+
+type QuotaState struct {
+	Messages QuotaUsage `json:"messages"`
+	Storage  QuotaUsage `json:"storage"`
+}
+
+type QuotaUsage struct {
+	// Limit is 0 when the quota is disabled
+	Limit    int64 `json:"limit"`
+	Used     int64 `json:"used"`
+	Exceeded bool  `json:"exceeded"`
+	// ResetAt is when the usage of a periodic quota starts over
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+func (s *quotaService) limits(project *model.Project) model.QuotaLimits {
+	var defaults model.QuotaLimits
+	if s.cfg != nil {
+		defaults = model.QuotaLimits{MessagesPerDay: s.cfg.Quota.MessagesPerDay, StorageBytes: s.cfg.Quota.StorageBytes}
+	}
+	return project.Quota(defaults)
+}
+
+// quotaDay returns the start of the UTC day of now and the start of the next one
+func quotaDay(now time.Time) (time.Time, time.Time) {
+	start := now.UTC().Truncate(24 * time.Hour)
+	return start, start.Add(24 * time.Hour)
+}
+
+// State returns the usage of the project against each of its quotas
+func (s *quotaService) State(ctx context.Context, project *model.Project, now time.Time) (*QuotaState, error) {
+	limits := s.limits(project)
+	start, reset := quotaDay(now)
+
+	messages, err := s.r.CountMessagesSince(ctx, project.ID, start)
+	if err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+	storage, err := s.r.SumStorageBytes(ctx, project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("sum storage: %w", err)
+	}
+
+	return &QuotaState{
+		Messages: QuotaUsage{
+			Limit:    limits.MessagesPerDay,
+			Used:     messages,
+			Exceeded: limits.MessagesPerDay > 0 && messages >= limits.MessagesPerDay,
+			ResetAt:  &reset,
+		},
+		Storage: QuotaUsage{
+			Limit:    limits.StorageBytes,
+			Used:     storage,
+			Exceeded: limits.StorageBytes > 0 && storage >= limits.StorageBytes,
+		},
+	}, nil
+}
+
+// CheckMessages returns a *QuotaExceededError when the project stored its messages of the day or adding more
+// messages would not fit
+func (s *quotaService) CheckMessages(ctx context.Context, project *model.Project, now time.Time, adding int64) error {
+	limit := s.limits(project).MessagesPerDay
+	if limit <= 0 {
+		return nil
+	}
+	start, reset := quotaDay(now)
+	used, err := s.r.CountMessagesSince(ctx, project.ID, start)
+	if err != nil {
+		return fmt.Errorf("count messages: %w", err)
+	}
+	if used < limit && used+adding <= limit {
+		return nil
+	}
+	retryAfter := int64(reset.Sub(now).Round(time.Second) / time.Second)
+	return &QuotaExceededError{Quota: QuotaMessages, Limit: limit, Used: used, Requested: adding, ResetAt: &reset, RetryAfterSec: &retryAfter}
+}
+
+// CheckStorage returns a *QuotaExceededError when the project is out of storage or incomingBytes would not fit,
+// incomingBytes is ignored when unknown (negative)
+func (s *quotaService) CheckStorage(ctx context.Context, project *model.Project, incomingBytes int64) error {
+	limit := s.limits(project).StorageBytes
+	if limit <= 0 {
+		return nil
+	}
+	used, err := s.r.SumStorageBytes(ctx, project.ID)
+	if err != nil {
+		return fmt.Errorf("sum storage: %w", err)
+	}
+	if used < limit && (incomingBytes <= 0 || used+incomingBytes <= limit) {
+		return nil
+	}
+	return &QuotaExceededError{Quota: QuotaStorage, Limit: limit, Used: used, Requested: max(incomingBytes, 0)}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+type fakeQuotaRepo struct {
+	messages int64
+	storage  int64
+	since    time.Time
+}
+
+func (r *fakeQuotaRepo) CountMessagesSince(ctx context.Context, projectID uuid.UUID, since time.Time) (int64, error) {
+	r.since = since
+	return r.messages, nil
+}
+
+func (r *fakeQuotaRepo) SumStorageBytes(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	return r.storage, nil
+}
+
+func TestQuotaService_CheckMessages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	cfg := &config.Config{Quota: config.QuotaCfg{MessagesPerDay: 10}}
+	project := &model.Project{ID: uuid.New()}
+
+	r := &fakeQuotaRepo{messages: 9}
+	svc := NewQuotaService(r, cfg)
+	assert.NoError(t, svc.CheckMessages(ctx, project, now, 1))
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), r.since)
+
+	r.messages = 10
+	err := svc.CheckMessages(ctx, project, now, 1)
+	var exceeded *QuotaExceededError
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, QuotaMessages, exceeded.Quota)
+	assert.Equal(t, int64(10), exceeded.Limit)
+	assert.Equal(t, int64(30*60), *exceeded.RetryAfterSec)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), *exceeded.ResetAt)
+
+	// A turn must fit in the quota as a whole
+	r.messages = 8
+	assert.NoError(t, svc.CheckMessages(ctx, project, now, 2))
+	err = svc.CheckMessages(ctx, project, now, 3)
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, int64(3), exceeded.Requested)
+
+	// The project override disables the quota
+	project.Configs = datatypes.JSONMap{model.ProjectQuotaConfigKey: map[string]interface{}{"messages_per_day": float64(0)}}
+	assert.NoError(t, svc.CheckMessages(ctx, project, now, 1))
+}
+
+func TestQuotaService_CheckStorage(t *testing.T) {
+	ctx := context.Background()
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{
+		model.ProjectQuotaConfigKey: map[string]interface{}{"storage_bytes": float64(100)},
+	}}
+
+	r := &fakeQuotaRepo{storage: 60}
+	svc := NewQuotaService(r, &config.Config{})
+	assert.NoError(t, svc.CheckStorage(ctx, project, 40))
+	assert.NoError(t, svc.CheckStorage(ctx, project, -1))
+
+	err := svc.CheckStorage(ctx, project, 41)
+	var exceeded *QuotaExceededError
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, QuotaStorage, exceeded.Quota)
+	assert.Equal(t, int64(41), exceeded.Requested)
+	assert.Nil(t, exceeded.RetryAfterSec)
+
+	state, err := svc.State(ctx, project, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), state.Storage.Limit)
+	assert.False(t, state.Storage.Exceeded)
+	assert.Equal(t, int64(0), state.Messages.Limit)
+	assert.False(t, state.Messages.Exceeded)
+}
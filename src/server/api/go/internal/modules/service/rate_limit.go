@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// Redis key prefix of the message write token buckets of sessions
+	redisKeyPrefixMessageRate = "ratelimit:messages:"
+	// maxLocalRateBuckets bounds the in-memory buckets, full ones are dropped when it is full
+	maxLocalRateBuckets = 10000
+)
+
+// tokenBucketScript takes a token from the bucket at KEYS[1], refilled with ARGV[1] tokens per second up to ARGV[2].
+// ARGV[3] is the current time in milliseconds. Returns whether a token was taken and the milliseconds until the next one.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
+`)
+
+type RateLimitService interface {
+	// AllowMessageWrite takes a token from the message write bucket of the session,
+	// returning false and the time until the next token when the bucket is empty
+	AllowMessageWrite(ctx context.Context, projectID, sessionID uuid.UUID) (time.Duration, bool)
+}
+
+type rateLimitService struct {
+	redis *redis.Client
+	log   *zap.Logger
+	rate  float64
+	burst int
+
+	// buckets when Redis is unavailable, keyed like in Redis
+	mu    sync.Mutex
+	local map[string]*localRateBucket
+}
+
+type localRateBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func NewRateLimitService(rdb *redis.Client, cfg *config.Config, log *zap.Logger) RateLimitService {
+	s := &rateLimitService{redis: rdb, log: log, local: map[string]*localRateBucket{}}
+	if cfg != nil {
+		s.rate = cfg.RateLimit.MessagesPerSec
+		s.burst = max(cfg.RateLimit.MessageBurst, 1)
+	}
+	return s
+}
+
+func (s *rateLimitService) AllowMessageWrite(ctx context.Context, projectID, sessionID uuid.UUID) (time.Duration, bool) {
+	if s.rate <= 0 {
+		return 0, true
+	}
+	key := redisKeyPrefixMessageRate + projectID.String() + ":" + sessionID.String()
+	now := time.Now()
+
+	if s.redis != nil {
+		res, err := tokenBucketScript.Run(ctx, s.redis, []string{key}, s.rate, s.burst, now.UnixMilli()).Int64Slice()
+		if err == nil && len(res) == 2 {
+			return time.Duration(res[1]) * time.Millisecond, res[0] == 1
+		}
+		s.log.Warn("failed to take message rate token from Redis", zap.String("key", key), zap.Error(err))
+	}
+	return s.takeLocal(key, now)
+}
+
+func (s *rateLimitService) takeLocal(key string, now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.local[key]
+	if !ok {
+		if len(s.local) >= maxLocalRateBuckets {
+			s.sweep(now)
+		}
+		b = &localRateBucket{tokens: float64(s.burst), ts: now}
+		s.local[key] = b
+	}
+	b.tokens = math.Min(float64(s.burst), b.tokens+max(now.Sub(b.ts).Seconds(), 0)*s.rate)
+	b.ts = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration(math.Ceil((1-b.tokens)/s.rate*1000)) * time.Millisecond, false
+}
+
+// sweep drops the buckets refilled to the burst, they behave like missing ones. Called with mu held
+func (s *rateLimitService) sweep(now time.Time) {
+	for k, b := range s.local {
+		if b.tokens+now.Sub(b.ts).Seconds()*s.rate >= float64(s.burst) {
+			delete(s.local, k)
+		}
+	}
+	if len(s.local) >= maxLocalRateBuckets {
+		s.local = map[string]*localRateBucket{}
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRateLimitService_AllowMessageWrite(t *testing.T) {
+	ctx := context.Background()
+	projectID, sessionID := uuid.New(), uuid.New()
+
+	t.Run("burst then refill", func(t *testing.T) {
+		svc := NewRateLimitService(nil, &config.Config{RateLimit: config.RateLimitCfg{MessagesPerSec: 2, MessageBurst: 3}}, zap.NewNop()).(*rateLimitService)
+		now := time.Now()
+		key := redisKeyPrefixMessageRate + projectID.String() + ":" + sessionID.String()
+
+		for range 3 {
+			_, ok := svc.takeLocal(key, now)
+			assert.True(t, ok)
+		}
+		retryAfter, ok := svc.takeLocal(key, now)
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+		_, ok = svc.takeLocal(key, now.Add(500*time.Millisecond))
+		assert.True(t, ok)
+		_, ok = svc.takeLocal(key, now.Add(500*time.Millisecond))
+		assert.False(t, ok)
+	})
+
+	t.Run("sessions have their own buckets", func(t *testing.T) {
+		svc := NewRateLimitService(nil, &config.Config{RateLimit: config.RateLimitCfg{MessagesPerSec: 1, MessageBurst: 1}}, zap.NewNop())
+
+		_, ok := svc.AllowMessageWrite(ctx, projectID, sessionID)
+		assert.True(t, ok)
+		_, ok = svc.AllowMessageWrite(ctx, projectID, sessionID)
+		assert.False(t, ok)
+		_, ok = svc.AllowMessageWrite(ctx, projectID, uuid.New())
+		assert.True(t, ok)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		svc := NewRateLimitService(nil, &config.Config{}, zap.NewNop())
+		for range 100 {
+			_, ok := svc.AllowMessageWrite(ctx, projectID, sessionID)
+			assert.True(t, ok)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrInvalidRedactionPolicy = errors.New("invalid redaction policy")
+	ErrRedactionNERDisabled   = errors.New("the ner redaction detector is not configured on this server")
+)
+
+type RedactionService interface {
+	Get(ctx context.Context, project *model.Project) *model.RedactionPolicy
+	Update(ctx context.Context, project *model.Project, policy *model.RedactionPolicy) (*model.RedactionPolicy, error)
+}
+
+type redactionService struct {
+	r   repo.ProjectRepo
+	cfg *config.Config
+}
+
+func NewRedactionService(r repo.ProjectRepo, cfg *config.Config) RedactionService {
+	return &redactionService{r: r, cfg: cfg}
+}
+
+// Get returns the redaction policy of the project, nil when nothing is redacted
+func (s *redactionService) Get(ctx context.Context, project *model.Project) *model.RedactionPolicy {
+	return project.Redaction()
+}
+
+// Update replaces the redaction policy of the project, a nil policy stops redacting new messages
+func (s *redactionService) Update(ctx context.Context, project *model.Project, policy *model.RedactionPolicy) (*model.RedactionPolicy, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if policy == nil {
+		delete(configs, model.ProjectRedactionConfigKey)
+	} else {
+		detector := policy.Detector
+		if detector == "" {
+			detector = model.RedactionDetectorRegex
+		}
+		if err := s.validate(detector, policy); err != nil {
+			return nil, err
+		}
+		patterns := make([]interface{}, 0, len(policy.Patterns))
+		for _, p := range policy.Patterns {
+			patterns = append(patterns, map[string]interface{}{"name": p.Name, "regex": p.Regex})
+		}
+		configs[model.ProjectRedactionConfigKey] = map[string]interface{}{
+			"enabled":  policy.Enabled,
+			"detector": detector,
+			"kinds":    toInterfaces(policy.Kinds),
+			"patterns": patterns,
+		}
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectRedactionConfigKey, configs[model.ProjectRedactionConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.Redaction(), nil
+}
+
+var redactionNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// validate checks a policy before it is stored, so that new messages never fail on a broken policy
+func (s *redactionService) validate(detector string, policy *model.RedactionPolicy) error {
+	switch detector {
+	case model.RedactionDetectorRegex:
+	case model.RedactionDetectorNER:
+		if s.cfg == nil || s.cfg.Ingest.Redaction.NEREndpoint == "" {
+			return fmt.Errorf("%w: %w", ErrInvalidRedactionPolicy, ErrRedactionNERDisabled)
+		}
+	default:
+		return fmt.Errorf("%w: unknown detector %q", ErrInvalidRedactionPolicy, detector)
+	}
+
+	for _, kind := range policy.Kinds {
+		if _, ok := builtinPIIPatterns[kind]; ok {
+			continue
+		}
+		// The ner detector also masks the entities its service labels with kind, e.g. person
+		if detector != model.RedactionDetectorNER || !redactionNameRe.MatchString(kind) {
+			return fmt.Errorf("%w: unknown kind %q", ErrInvalidRedactionPolicy, kind)
+		}
+	}
+	for _, p := range policy.Patterns {
+		if !redactionNameRe.MatchString(p.Name) {
+			return fmt.Errorf("%w: pattern name %q must be lowercase letters, digits and underscores", ErrInvalidRedactionPolicy, p.Name)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("%w: pattern %s: %v", ErrInvalidRedactionPolicy, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// builtinPIIPatterns find the built-in kinds of PII
+var builtinPIIPatterns = map[string]*regexp.Regexp{
+	model.RedactionKindEmail: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	// Keys of common providers: OpenAI, Anthropic and Stripe style sk-/pk-/rk-, AWS access keys, GitHub, Slack and Google
+	model.RedactionKindAPIKey: regexp.MustCompile(`\b(?:(?:sk|pk|rk)[-_][A-Za-z0-9_\-]{16,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9\-]{10,}|AIza[0-9A-Za-z_\-]{35})\b`),
+	model.RedactionKindPhone:  regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)[\s.\-]?|\b\d{2,4}[\s.\-])\d{3,4}[\s.\-]?\d{3,4}\b`),
+}
+
+// piiMatch is a span of text to mask, offsets are in bytes
+type piiMatch struct {
+	Kind       string
+	Start, End int
+}
+
+// piiDetector finds the PII of a text
+type piiDetector interface {
+	Detect(ctx context.Context, text string) ([]piiMatch, error)
+}
+
+// regexDetector finds PII with regular expressions, keyed by kind
+type regexDetector map[string]*regexp.Regexp
+
+func (d regexDetector) Detect(_ context.Context, text string) ([]piiMatch, error) {
+	var out []piiMatch
+	for kind, re := range d {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if kind == model.RedactionKindPhone && !isPhoneNumber(text[loc[0]:loc[1]]) {
+				continue
+			}
+			out = append(out, piiMatch{Kind: kind, Start: loc[0], End: loc[1]})
+		}
+	}
+	return out, nil
+}
+
+// isPhoneNumber drops phone candidates too short to be one, e.g. IP addresses and versions
+func isPhoneNumber(s string) bool {
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 10 && digits <= 15
+}
+
+// nerDetector asks the named entity recognition service of the server for the entities of a text
+type nerDetector struct {
+	endpoint string
+	timeout  time.Duration
+	kinds    map[string]bool
+}
+
+var nerClient = &http.Client{}
+
+// nerLabels maps the labels of common NER models to the built-in kinds
+var nerLabels = map[string]string{
+	"email_address": model.RedactionKindEmail,
+	"phone_number":  model.RedactionKindPhone,
+	"secret":        model.RedactionKindAPIKey,
+	"credential":    model.RedactionKindAPIKey,
+}
+
+func (d *nerDetector) Detect(ctx context.Context, text string) ([]piiMatch, error) {
+	body, err := sonic.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, err
+	}
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := nerClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call ner service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ner service returned status %d", resp.StatusCode)
+	}
+
+	// Offsets of entities are in characters
+	var out struct {
+		Entities []struct {
+			Label string `json:"label"`
+			Start int    `json:"start"`
+			End   int    `json:"end"`
+		} `json:"entities"`
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read ner response: %w", err)
+	}
+	if err := sonic.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("decode ner response: %w", err)
+	}
+	offsets := runeOffsets(text)
+	var matches []piiMatch
+	for _, e := range out.Entities {
+		kind := strings.ToLower(e.Label)
+		if mapped, ok := nerLabels[kind]; ok {
+			kind = mapped
+		}
+		if !d.kinds[kind] || e.Start < 0 || e.End <= e.Start || e.End >= len(offsets) {
+			continue
+		}
+		matches = append(matches, piiMatch{Kind: kind, Start: offsets[e.Start], End: offsets[e.End]})
+	}
+	return matches, nil
+}
+
+// runeOffsets returns the byte offset of each character of text, followed by len(text)
+func runeOffsets(text string) []int {
+	offsets := make([]int, 0, utf8.RuneCountInString(text)+1)
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(text))
+}
+
+// multiDetector merges the matches of several detectors
+type multiDetector []piiDetector
+
+func (d multiDetector) Detect(ctx context.Context, text string) ([]piiMatch, error) {
+	var out []piiMatch
+	for _, detector := range d {
+		matches, err := detector.Detect(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, matches...)
+	}
+	return out, nil
+}
+
+// newPIIDetector returns the detector of a policy, the ner detector also runs the regex one
+func newPIIDetector(cfg *config.Config, policy *model.RedactionPolicy) (piiDetector, error) {
+	kinds := policy.Kinds
+	if len(kinds) == 0 {
+		kinds = []string{model.RedactionKindEmail, model.RedactionKindAPIKey, model.RedactionKindPhone}
+	}
+	regex := regexDetector{}
+	for _, kind := range kinds {
+		if re, ok := builtinPIIPatterns[kind]; ok {
+			regex[kind] = re
+		}
+	}
+	for _, p := range policy.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %s: %w", p.Name, err)
+		}
+		regex[p.Name] = re
+	}
+
+	switch policy.Detector {
+	case "", model.RedactionDetectorRegex:
+		return regex, nil
+	case model.RedactionDetectorNER:
+		if cfg == nil || cfg.Ingest.Redaction.NEREndpoint == "" {
+			return nil, ErrRedactionNERDisabled
+		}
+		ner := &nerDetector{
+			endpoint: cfg.Ingest.Redaction.NEREndpoint,
+			timeout:  time.Duration(cfg.Ingest.Redaction.NERTimeoutSec) * time.Second,
+			kinds:    map[string]bool{},
+		}
+		for _, kind := range kinds {
+			ner.kinds[kind] = true
+		}
+		return multiDetector{ner, regex}, nil
+	}
+	return nil, fmt.Errorf("unknown redaction detector %q", policy.Detector)
+}
+
+// redactParts masks the PII found by detector in the text parts, it returns nil when nothing was masked
+func redactParts(ctx context.Context, detector piiDetector, detectorName string, parts []model.Part) (*model.RedactionReport, error) {
+	if detectorName == "" {
+		detectorName = model.RedactionDetectorRegex
+	}
+	report := &model.RedactionReport{Detector: detectorName, Counts: map[string]int{}, Parts: []int{}}
+	for i := range parts {
+		if parts[i].Type != "text" || parts[i].Text == "" {
+			continue
+		}
+		matches, err := detector.Detect(ctx, parts[i].Text)
+		if err != nil {
+			return nil, err
+		}
+		text, counts := maskPII(parts[i].Text, matches)
+		if len(counts) == 0 {
+			continue
+		}
+		parts[i].Text = text
+		report.Parts = append(report.Parts, i)
+		for kind, n := range counts {
+			report.Counts[kind] += n
+		}
+	}
+	if len(report.Parts) == 0 {
+		return nil, nil
+	}
+	return report, nil
+}
+
+// maskPII replaces each match with [REDACTED:<kind>], of overlapping matches the one starting first, then the longest, wins
+func maskPII(text string, matches []piiMatch) (string, map[string]int) {
+	if len(matches) == 0 {
+		return text, nil
+	}
+	matches = slices.Clone(matches)
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End > matches[j].End
+	})
+
+	var b strings.Builder
+	counts := map[string]int{}
+	last := 0
+	for _, m := range matches {
+		if m.Start < last {
+			continue
+		}
+		b.WriteString(text[last:m.Start])
+		b.WriteString("[REDACTED:" + m.Kind + "]")
+		counts[m.Kind]++
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String(), counts
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestRedactParts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("masks the built-in kinds", func(t *testing.T) {
+		detector, err := newPIIDetector(nil, &model.RedactionPolicy{Enabled: true})
+		require.NoError(t, err)
+		parts := []model.Part{
+			{Type: "text", Text: "mail jane.doe@example.co.uk or call +1 415-555-0132, key sk-proj-abcdEFGH1234ijklMNOP"},
+			{Type: "tool-result", Text: "jane.doe@example.co.uk"},
+			{Type: "text", Text: "release 1.2.3 on 192.168.100.200, 2024-10-16"},
+		}
+
+		report, err := redactParts(ctx, detector, "", parts)
+		require.NoError(t, err)
+		assert.Equal(t, "mail [REDACTED:email] or call [REDACTED:phone], key [REDACTED:api_key]", parts[0].Text)
+		assert.Equal(t, "jane.doe@example.co.uk", parts[1].Text)
+		assert.Equal(t, "release 1.2.3 on 192.168.100.200, 2024-10-16", parts[2].Text)
+		assert.Equal(t, &model.RedactionReport{
+			Detector: model.RedactionDetectorRegex,
+			Counts:   map[string]int{"email": 1, "phone": 1, "api_key": 1},
+			Parts:    []int{0},
+		}, report)
+	})
+
+	t.Run("kinds and custom patterns", func(t *testing.T) {
+		detector, err := newPIIDetector(nil, &model.RedactionPolicy{
+			Enabled:  true,
+			Kinds:    []string{model.RedactionKindPhone},
+			Patterns: []model.RedactionPattern{{Name: "employee_id", Regex: `EMP-[0-9]{6}`}},
+		})
+		require.NoError(t, err)
+		parts := []model.Part{{Type: "text", Text: "EMP-123456 (415) 555-0132 jane@example.com EMP-123456"}}
+
+		report, err := redactParts(ctx, detector, model.RedactionDetectorRegex, parts)
+		require.NoError(t, err)
+		assert.Equal(t, "[REDACTED:employee_id] [REDACTED:phone] jane@example.com [REDACTED:employee_id]", parts[0].Text)
+		assert.Equal(t, map[string]int{"employee_id": 2, "phone": 1}, report.Counts)
+	})
+
+	t.Run("nothing to mask", func(t *testing.T) {
+		detector, err := newPIIDetector(nil, &model.RedactionPolicy{Enabled: true})
+		require.NoError(t, err)
+		parts := []model.Part{{Type: "text", Text: "hello"}}
+
+		report, err := redactParts(ctx, detector, "", parts)
+		require.NoError(t, err)
+		assert.Nil(t, report)
+		assert.Equal(t, "hello", parts[0].Text)
+	})
+}
+
+func TestMaskPII(t *testing.T) {
+	text, counts := maskPII("abcdefgh", []piiMatch{
+		{Kind: "b", Start: 4, End: 6},
+		{Kind: "a", Start: 1, End: 3},
+		{Kind: "long", Start: 4, End: 7},
+		{Kind: "inner", Start: 5, End: 6},
+	})
+	assert.Equal(t, "a[REDACTED:a]d[REDACTED:long]h", text)
+	assert.Equal(t, map[string]int{"a": 1, "long": 1}, counts)
+}
+
+func TestNERDetector(t *testing.T) {
+	ctx := context.Background()
+	text := "Zoë Smith, zoë@example.com"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		assert.Equal(t, text, in.Text)
+		// Offsets are in characters, ë is two bytes
+		_, _ = w.Write([]byte(`{"entities": [
+			{"label": "PERSON", "start": 0, "end": 9},
+			{"label": "EMAIL_ADDRESS", "start": 11, "end": 26},
+			{"label": "LOCATION", "start": 0, "end": 3},
+			{"label": "PERSON", "start": 20, "end": 99}
+		]}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Ingest: config.IngestCfg{Redaction: config.RedactionCfg{NEREndpoint: srv.URL}}}
+	detector, err := newPIIDetector(cfg, &model.RedactionPolicy{
+		Enabled:  true,
+		Detector: model.RedactionDetectorNER,
+		Kinds:    []string{model.RedactionKindEmail, "person"},
+	})
+	require.NoError(t, err)
+
+	parts := []model.Part{{Type: "text", Text: text}}
+	report, err := redactParts(ctx, detector, model.RedactionDetectorNER, parts)
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED:person], [REDACTED:email]", parts[0].Text)
+	assert.Equal(t, map[string]int{"person": 1, "email": 1}, report.Counts)
+
+	t.Run("service down", func(t *testing.T) {
+		srv.Close()
+		_, err := redactParts(ctx, detector, model.RedactionDetectorNER, []model.Part{{Type: "text", Text: text}})
+		assert.Error(t, err)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := newPIIDetector(&config.Config{}, &model.RedactionPolicy{Enabled: true, Detector: model.RedactionDetectorNER})
+		assert.ErrorIs(t, err, ErrRedactionNERDisabled)
+	})
+}
+
+func TestRedactionService(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewRedactionService(r, &config.Config{})
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	out, err := svc.Update(ctx, project, &model.RedactionPolicy{
+		Enabled:  true,
+		Kinds:    []string{model.RedactionKindEmail},
+		Patterns: []model.RedactionPattern{{Name: "employee_id", Regex: `EMP-\d+`}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &model.RedactionPolicy{
+		Enabled:  true,
+		Detector: model.RedactionDetectorRegex,
+		Kinds:    []string{model.RedactionKindEmail},
+		Patterns: []model.RedactionPattern{{Name: "employee_id", Regex: `EMP-\d+`}},
+	}, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	for _, policy := range []*model.RedactionPolicy{
+		{Enabled: true, Detector: "llm"},
+		{Enabled: true, Detector: model.RedactionDetectorNER},
+		{Enabled: true, Kinds: []string{"person"}},
+		{Enabled: true, Patterns: []model.RedactionPattern{{Name: "id", Regex: `(`}}},
+		{Enabled: true, Patterns: []model.RedactionPattern{{Name: "Bad Name", Regex: `x`}}},
+	} {
+		_, err := svc.Update(ctx, project, policy)
+		assert.ErrorIs(t, err, ErrInvalidRedactionPolicy)
+	}
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectRedactionConfigKey)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidRetentionPolicy = errors.New("retention policy needs an action of archive or delete and positive idle_days")
+
+// defaultRetentionBatchSize is used when retention.batchSize is not configured
+const defaultRetentionBatchSize = 100
+
+type RetentionService interface {
+	Get(ctx context.Context, project *model.Project) *model.RetentionPolicy
+	Update(ctx context.Context, project *model.Project, policy *model.RetentionPolicy) (*model.RetentionPolicy, error)
+	Reap(ctx context.Context, now time.Time) (*ReapRetentionOutput, error)
+}
+
+type retentionService struct {
+	projectRepo repo.ProjectRepo
+	sessionRepo repo.SessionRepo
+	cfg         *config.Config
+	log         *zap.Logger
+}
+
+func NewRetentionService(projectRepo repo.ProjectRepo, sessionRepo repo.SessionRepo, cfg *config.Config, log *zap.Logger) RetentionService {
+	return &retentionService{
+		projectRepo: projectRepo,
+		sessionRepo: sessionRepo,
+		cfg:         cfg,
+		log:         log,
+	}
+}
+
+// Get returns the retention policy of the project, nil when sessions are kept forever
+func (s *retentionService) Get(ctx context.Context, project *model.Project) *model.RetentionPolicy {
+	return project.Retention()
+}
+
+// Update replaces the retention policy of the project, a nil policy keeps sessions forever
+func (s *retentionService) Update(ctx context.Context, project *model.Project, policy *model.RetentionPolicy) (*model.RetentionPolicy, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if policy == nil {
+		delete(configs, model.ProjectRetentionConfigKey)
+	} else {
+		if policy.Action != model.RetentionActionArchive && policy.Action != model.RetentionActionDelete || policy.IdleDays <= 0 {
+			return nil, ErrInvalidRetentionPolicy
+		}
+		configs[model.ProjectRetentionConfigKey] = map[string]interface{}{
+			"action":    policy.Action,
+			"idle_days": policy.IdleDays,
+		}
+	}
+
+	if err := s.projectRepo.SetConfig(ctx, project.ID, model.ProjectRetentionConfigKey, configs[model.ProjectRetentionConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.Retention(), nil
+}
+
+// RetentionReapLockKey is the advisory lock key that keeps Reap to one instance at a time
+const RetentionReapLockKey int64 = 0x61637478_72657470
+
+type ReapRetentionOutput struct {
+	Projects int `json:"projects"`
+	Archived int `json:"archived"`
+	Deleted  int `json:"deleted"`
+	Failed   int `json:"failed"`
+}
+
+// Reap enforces the retention policies of all projects: sessions idle since before now minus IdleDays are archived or deleted.
+// Deletion goes through the session repository so the asset references of the messages are released.
+// A session that fails is logged and counted, the project is then retried on the next run.
+func (s *retentionService) Reap(ctx context.Context, now time.Time) (*ReapRetentionOutput, error) {
+	projects, err := s.projectRepo.ListWithConfig(ctx, model.ProjectRetentionConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("list projects with retention: %w", err)
+	}
+
+	batch := defaultRetentionBatchSize
+	if s.cfg != nil && s.cfg.Retention.BatchSize > 0 {
+		batch = s.cfg.Retention.BatchSize
+	}
+
+	out := &ReapRetentionOutput{}
+	for i := range projects {
+		policy := projects[i].Retention()
+		if policy == nil || policy.IdleDays <= 0 {
+			continue
+		}
+		out.Projects++
+		idleSince := now.Add(-time.Duration(policy.IdleDays) * 24 * time.Hour)
+		if err := s.reapProject(ctx, projects[i], *policy, idleSince, batch, out); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (s *retentionService) reapProject(ctx context.Context, project model.Project, policy model.RetentionPolicy, idleSince time.Time, batch int, out *ReapRetentionOutput) error {
+	remove := policy.Action == model.RetentionActionDelete
+	for {
+		// Archived sessions are idle too, but only deleting changes them
+		ids, err := s.sessionRepo.ListIdle(ctx, project.ID, idleSince, remove, batch)
+		if err != nil {
+			return fmt.Errorf("list idle sessions of project %s: %w", project.ID, err)
+		}
+
+		for _, id := range ids {
+			if remove {
+				err = s.sessionRepo.Delete(ctx, project.ID, id)
+			} else {
+				err = s.sessionRepo.SetArchived(ctx, id, true)
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// deleted meanwhile, e.g. through the API
+				continue
+			}
+			if err != nil {
+				out.Failed++
+				s.log.Warn("retention failed", zap.String("project_id", project.ID.String()), zap.String("session_id", id.String()), zap.String("action", policy.Action), zap.Error(err))
+				// The session would be listed again, leave the project to the next run
+				return nil
+			}
+			if remove {
+				out.Deleted++
+			} else {
+				out.Archived++
+			}
+		}
+
+		if len(ids) < batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func TestRetentionService_Update(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewRetentionService(r, &MockSessionRepo{}, &config.Config{}, zap.NewNop())
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	out, err := svc.Update(ctx, project, &model.RetentionPolicy{Action: model.RetentionActionArchive, IdleDays: 30})
+	require.NoError(t, err)
+	assert.Equal(t, &model.RetentionPolicy{Action: model.RetentionActionArchive, IdleDays: 30}, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	for _, invalid := range []model.RetentionPolicy{{Action: "shred", IdleDays: 30}, {Action: model.RetentionActionDelete}} {
+		_, err = svc.Update(ctx, project, &invalid)
+		assert.ErrorIs(t, err, ErrInvalidRetentionPolicy)
+	}
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectRetentionConfigKey)
+}
+
+func TestRetentionService_Reap(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	retention := func(action string, days float64) datatypes.JSONMap {
+		return datatypes.JSONMap{model.ProjectRetentionConfigKey: map[string]interface{}{"action": action, "idle_days": days}}
+	}
+	archiving := model.Project{ID: uuid.New(), Configs: retention(model.RetentionActionArchive, 7)}
+	deleting := model.Project{ID: uuid.New(), Configs: retention(model.RetentionActionDelete, 30)}
+	cfg := &config.Config{Retention: config.RetentionCfg{BatchSize: 2}}
+
+	t.Run("archive and delete in batches", func(t *testing.T) {
+		a1, a2, a3, d1 := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("ListIdle", ctx, archiving.ID, now.Add(-7*24*time.Hour), false, 2).Return([]uuid.UUID{a1, a2}, nil).Once()
+		sessionRepo.On("ListIdle", ctx, archiving.ID, now.Add(-7*24*time.Hour), false, 2).Return([]uuid.UUID{a3}, nil).Once()
+		sessionRepo.On("ListIdle", ctx, deleting.ID, now.Add(-30*24*time.Hour), true, 2).Return([]uuid.UUID{d1}, nil).Once()
+		for _, id := range []uuid.UUID{a1, a2, a3} {
+			sessionRepo.On("SetArchived", ctx, id, true).Return(nil).Once()
+		}
+		sessionRepo.On("Delete", ctx, deleting.ID, d1).Return(nil).Once()
+
+		svc := NewRetentionService(&fakeProjectRepo{projects: []model.Project{archiving, deleting}}, sessionRepo, cfg, zap.NewNop())
+		out, err := svc.Reap(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, &ReapRetentionOutput{Projects: 2, Archived: 3, Deleted: 1}, out)
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("failed session leaves the project to the next run", func(t *testing.T) {
+		d1, d2 := uuid.New(), uuid.New()
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("ListIdle", ctx, deleting.ID, now.Add(-30*24*time.Hour), true, 2).Return([]uuid.UUID{d1, d2}, nil).Once()
+		sessionRepo.On("Delete", ctx, deleting.ID, d1).Return(errors.New("s3 down")).Once()
+
+		svc := NewRetentionService(&fakeProjectRepo{projects: []model.Project{deleting}}, sessionRepo, cfg, zap.NewNop())
+		out, err := svc.Reap(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, &ReapRetentionOutput{Projects: 1, Failed: 1}, out)
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("session deleted meanwhile is skipped", func(t *testing.T) {
+		d1, d2 := uuid.New(), uuid.New()
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("ListIdle", ctx, deleting.ID, now.Add(-30*24*time.Hour), true, 2).Return([]uuid.UUID{d1, d2}, nil).Once()
+		sessionRepo.On("Delete", ctx, deleting.ID, d1).Return(gorm.ErrRecordNotFound).Once()
+		sessionRepo.On("Delete", ctx, deleting.ID, d2).Return(nil).Once()
+		sessionRepo.On("ListIdle", ctx, deleting.ID, now.Add(-30*24*time.Hour), true, 2).Return([]uuid.UUID{}, nil).Once()
+
+		svc := NewRetentionService(&fakeProjectRepo{projects: []model.Project{deleting}}, sessionRepo, cfg, zap.NewNop())
+		out, err := svc.Reap(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, &ReapRetentionOutput{Projects: 1, Deleted: 1}, out)
+		sessionRepo.AssertExpectations(t)
+	})
+}
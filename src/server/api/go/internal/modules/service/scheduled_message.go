@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// maxScheduleDelay bounds how far in the future a message can be scheduled
+const maxScheduleDelay = 90 * 24 * time.Hour
+
+// scheduleTolerance is how early a scheduled message is delivered rather than delayed again
+const scheduleTolerance = time.Second
+
+// ScheduledMessageJSON is a message waiting in the message queue for its delivery time.
+// Its assets are uploaded and referenced already, only the message row is missing.
+type ScheduledMessageJSON struct {
+	ProjectID    uuid.UUID        `json:"project_id"`
+	SessionID    uuid.UUID        `json:"session_id"`
+	MessageID    uuid.UUID        `json:"message_id"`
+	DeliverAt    time.Time        `json:"deliver_at"`
+	Role         string           `json:"role"`
+	Meta         map[string]any   `json:"meta"`
+	PartsAsset   model.Asset      `json:"parts_asset"`
+	InlineParts  []model.Part     `json:"inline_parts,omitempty"` // empty when PartsAsset holds the parts
+	PartTypes    []string         `json:"part_types"`
+	AssetSHA256s []string         `json:"asset_sha256s"`
+	ParentID     *uuid.UUID       `json:"parent_id,omitempty"`
+	Usage        model.TokenUsage `json:"usage"`
+	SizeB        int64            `json:"size_b"`
+	SearchText   string           `json:"search_text"`
+	ContentHash  string           `json:"content_hash"`
+}
+
+func newScheduledMessageJSON(projectID uuid.UUID, deliverAt time.Time, msg *model.Message) ScheduledMessageJSON {
+	return ScheduledMessageJSON{
+		ProjectID:    projectID,
+		SessionID:    msg.SessionID,
+		MessageID:    msg.ID,
+		DeliverAt:    deliverAt,
+		Role:         msg.Role,
+		Meta:         msg.Meta.Data(),
+		PartsAsset:   msg.PartsAssetMeta.Data(),
+		InlineParts:  msg.InlineParts,
+		PartTypes:    msg.PartTypes,
+		AssetSHA256s: msg.AssetSHA256s,
+		ParentID:     msg.ParentID,
+		Usage:        msg.Usage,
+		SizeB:        msg.SizeB,
+		SearchText:   msg.SearchText,
+		ContentHash:  msg.ContentHash,
+	}
+}
+
+func (ev *ScheduledMessageJSON) message() model.Message {
+	msg := model.Message{
+		ID:             ev.MessageID,
+		SessionID:      ev.SessionID,
+		Role:           ev.Role,
+		Meta:           datatypes.NewJSONType(ev.Meta),
+		PartsAssetMeta: datatypes.NewJSONType(ev.PartsAsset),
+		PartTypes:      datatypes.NewJSONSlice(ev.PartTypes),
+		AssetSHA256s:   datatypes.NewJSONSlice(ev.AssetSHA256s),
+		ParentID:       ev.ParentID,
+		Usage:          ev.Usage,
+		SizeB:          ev.SizeB,
+		SearchText:     ev.SearchText,
+		ContentHash:    ev.ContentHash,
+	}
+	if ev.InlineParts != nil {
+		msg.InlineParts = datatypes.NewJSONSlice(ev.InlineParts)
+		msg.Parts = ev.InlineParts
+		// Messages scheduled before these fields were carried
+		if ev.ContentHash == "" {
+			msg.SearchText = model.MessageSearchText(ev.InlineParts)
+			msg.ContentHash = model.MessageContentHash(ev.Role, ev.InlineParts)
+		}
+	}
+	return msg
+}
+
+// assets returns the assets referenced for the message when it was sent
+func (ev *ScheduledMessageJSON) assets() []model.Asset {
+	assets := make([]model.Asset, 0, len(ev.AssetSHA256s)+1)
+	if ev.PartsAsset.SHA256 != "" {
+		assets = append(assets, ev.PartsAsset)
+	}
+	for _, sha := range ev.AssetSHA256s {
+		assets = append(assets, model.Asset{SHA256: sha})
+	}
+	return assets
+}
+
+// HandleScheduledDelivery stores and publishes a scheduled message once its time has come, and delays it again before.
+// Deliveries are at least once: a message stored already is skipped. A message of a deleted session is dropped and
+// its assets released, as is a duplicate of the message it follows; when its parent was deleted meanwhile it is chained to the latest message of the session instead.
+func (s *sessionService) HandleScheduledDelivery(ctx context.Context, body []byte) error {
+	var ev ScheduledMessageJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		// Requeuing would never succeed
+		s.log.Error("drop invalid scheduled message", zap.Error(err))
+		return nil
+	}
+
+	if wait := time.Until(ev.DeliverAt); wait > scheduleTolerance {
+		if s.publisher == nil {
+			return ErrScheduleUnavailable
+		}
+		return s.publisher.PublishDelayedJSON(ctx, s.cfg.RabbitMQ.QueueName.ScheduledMessage, ev, wait)
+	}
+
+	if _, err := s.sessionRepo.Get(ctx, &model.Session{ID: ev.SessionID}); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		s.log.Info("drop scheduled message of deleted session", zap.String("session_id", ev.SessionID.String()), zap.String("message_id", ev.MessageID.String()))
+		return s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, ev.ProjectID, ev.assets())
+	}
+
+	exists, err := s.sessionRepo.MessageExists(ctx, ev.SessionID, ev.MessageID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if ev.ParentID != nil {
+		exists, err := s.sessionRepo.MessageExists(ctx, ev.SessionID, *ev.ParentID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			ev.ParentID = nil
+		}
+	}
+
+	msg := ev.message()
+	if err := s.persistMessage(ctx, ev.ProjectID, &msg); err != nil {
+		if !errors.Is(err, ErrDuplicateMessage) {
+			return err
+		}
+		// Requeuing would be refused again
+		s.log.Info("drop duplicate scheduled message", zap.String("session_id", ev.SessionID.String()), zap.String("message_id", ev.MessageID.String()))
+		return s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, ev.ProjectID, ev.assets())
+	}
+	return nil
+}
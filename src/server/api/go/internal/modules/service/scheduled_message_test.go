@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func TestSessionService_SendMessage_Scheduled(t *testing.T) {
+	ctx := context.Background()
+	in := SendMessageInput{SessionID: uuid.New(), Role: "user", Parts: []PartIn{{Type: "text", Text: "remind me"}}}
+
+	t.Run("without message queue", func(t *testing.T) {
+		svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		in := in
+		in.DeliverAt = time.Now().Add(time.Hour)
+		_, err := svc.SendMessage(ctx, in)
+		assert.ErrorIs(t, err, ErrScheduleUnavailable)
+	})
+
+	t.Run("too far", func(t *testing.T) {
+		svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, &mq.Publisher{}, &config.Config{}, nil)
+		in := in
+		in.DeliverAt = time.Now().Add(maxScheduleDelay + time.Hour)
+		_, err := svc.SendMessage(ctx, in)
+		assert.ErrorIs(t, err, ErrDeliverAtTooFar)
+	})
+}
+
+func TestSessionService_HandleScheduledDelivery(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	parentID := uuid.New()
+	ev := ScheduledMessageJSON{
+		ProjectID:    projectID,
+		SessionID:    sessionID,
+		MessageID:    uuid.New(),
+		DeliverAt:    time.Now().Add(-time.Second),
+		Role:         "user",
+		Meta:         map[string]any{},
+		InlineParts:  []model.Part{{Type: "text", Text: "remind me"}},
+		PartTypes:    []string{"text"},
+		AssetSHA256s: []string{"file-sha"},
+		ParentID:     &parentID,
+		SizeB:        42,
+		SearchText:   "remind me",
+		ContentHash:  "hash",
+	}
+	body, err := sonic.Marshal(ev)
+	require.NoError(t, err)
+
+	t.Run("stored when due", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, ev.MessageID).Return(false, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, parentID).Return(true, nil)
+		sessionRepo.On("CreateMessageWithAssets", ctx, mock.MatchedBy(func(m *model.Message) bool {
+			return m.ID == ev.MessageID && m.ParentID != nil && *m.ParentID == parentID && m.PartsInline() && m.InlineParts[0].Text == "remind me" &&
+				m.SizeB == 42 && m.SearchText == "remind me" && m.ContentHash == "hash"
+		})).Return(nil)
+		sessionRepo.On("SetTitleIfEmpty", ctx, sessionID, "remind me").Return(nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("delivered already", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, ev.MessageID).Return(true, nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		sessionRepo.AssertNotCalled(t, "CreateMessageWithAssets", mock.Anything, mock.Anything)
+	})
+
+	t.Run("deleted parent chains to latest", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, ev.MessageID).Return(false, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, parentID).Return(false, nil)
+		sessionRepo.On("CreateMessageWithAssets", ctx, mock.MatchedBy(func(m *model.Message) bool { return m.ParentID == nil })).Return(nil)
+		sessionRepo.On("SetTitleIfEmpty", ctx, sessionID, mock.Anything).Return(nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("scheduled by an older version", func(t *testing.T) {
+		legacy := ev
+		legacy.SearchText, legacy.ContentHash = "", ""
+		body, err := sonic.Marshal(legacy)
+		require.NoError(t, err)
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, mock.Anything).Return(false, nil).Once()
+		sessionRepo.On("MessageExists", ctx, sessionID, mock.Anything).Return(true, nil)
+		sessionRepo.On("CreateMessageWithAssets", ctx, mock.MatchedBy(func(m *model.Message) bool {
+			return m.SearchText == "remind me" && m.ContentHash == model.MessageContentHash("user", legacy.InlineParts)
+		})).Return(nil)
+		sessionRepo.On("SetTitleIfEmpty", ctx, sessionID, mock.Anything).Return(nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("duplicate releases assets", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, ev.MessageID).Return(false, nil)
+		sessionRepo.On("MessageExists", ctx, sessionID, parentID).Return(true, nil)
+		sessionRepo.On("CreateMessageWithAssets", ctx, mock.Anything).Return(ErrDuplicateMessage)
+		assetRepo := &MockAssetReferenceRepo{}
+		assetRepo.On("BatchDecrementAssetRefs", ctx, projectID, []model.Asset{{SHA256: "file-sha"}}).Return(nil)
+		svc := NewSessionService(sessionRepo, assetRepo, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		assetRepo.AssertExpectations(t)
+	})
+
+	t.Run("session deleted releases assets", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+		assetRepo := &MockAssetReferenceRepo{}
+		assetRepo.On("BatchDecrementAssetRefs", ctx, projectID, []model.Asset{{SHA256: "file-sha"}}).Return(nil)
+		svc := NewSessionService(sessionRepo, assetRepo, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		require.NoError(t, svc.HandleScheduledDelivery(ctx, body))
+		assetRepo.AssertExpectations(t)
+		sessionRepo.AssertNotCalled(t, "CreateMessageWithAssets", mock.Anything, mock.Anything)
+	})
+
+	t.Run("early delivery without message queue", func(t *testing.T) {
+		early := ev
+		early.DeliverAt = time.Now().Add(time.Hour)
+		body, err := sonic.Marshal(early)
+		require.NoError(t, err)
+		svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		assert.ErrorIs(t, svc.HandleScheduledDelivery(ctx, body), ErrScheduleUnavailable)
+	})
+}
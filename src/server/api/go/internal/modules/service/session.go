@@ -4,8 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"mime/multipart"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -17,22 +23,59 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type SessionService interface {
 	Create(ctx context.Context, ss *model.Session) error
 	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
+	BulkDelete(ctx context.Context, in BulkDeleteSessionsInput) (*BulkDeleteSessionsOutput, error)
 	UpdateByID(ctx context.Context, ss *model.Session) error
+	UpdateMetadata(ctx context.Context, in UpdateSessionMetadataInput) (*model.Session, error)
+	SetArchived(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, archived bool) (*model.Session, error)
 	GetByID(ctx context.Context, ss *model.Session) (*model.Session, error)
 	List(ctx context.Context, in ListSessionsInput) (*ListSessionsOutput, error)
 	SendMessage(ctx context.Context, in SendMessageInput) (*model.Message, error)
+	SendTurn(ctx context.Context, in SendTurnInput) (*SendTurnOutput, error)
 	GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error)
 	GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	GetMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error)
+	GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error)
+	ExpandPart(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, index int) (*ExpandedPart, error)
+	Supersede(ctx context.Context, in SupersedeMessageInput) (*model.Message, error)
+	GetMessageTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*MessageTree, error)
+	DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (*DeleteMessageOutput, error)
+	CheckMessageChains(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*MessageChainReport, error)
+	GetUsage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*SessionUsage, error)
+	GetContextWindow(ctx context.Context, in GetContextWindowInput) (*ContextWindow, error)
+	GetSummary(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*SessionSummary, error)
+	ListEvents(ctx context.Context, in ListSessionEventsInput) (*ListSessionEventsOutput, error)
+	Export(ctx context.Context, in ExportSessionInput, fn func(batch *SessionExport) error) (int, error)
+	Archive(ctx context.Context, in ArchiveSessionsInput, w io.Writer) (int, error)
+	SampleMessages(ctx context.Context, in SampleMessagesInput) (*MessageSample, error)
+	Fork(ctx context.Context, in ForkSessionInput) (*model.Session, error)
+	HandleScheduledDelivery(ctx context.Context, body []byte) error
 }
 
+var (
+	ErrParentMessageNotFound = errors.New("parent message not found in session")
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrForkMessageNotFound   = errors.New("fork message not found in session")
+	ErrContextBudgetTooSmall = errors.New("max_tokens is smaller than the system messages of the session")
+	ErrMessageNotFound       = errors.New("message not found in session")
+	ErrPartNotFound          = errors.New("part not found in message")
+	ErrScheduleUnavailable   = errors.New("scheduled messages need the message queue")
+	ErrDeliverAtTooFar       = errors.New("deliver_at is too far in the future")
+	ErrInvalidSupersession   = errors.New("invalid supersession")
+	ErrDuplicateMessage      = repo.ErrDuplicateMessage
+	ErrTurnTooLarge          = errors.New("too many messages in turn")
+	ErrExportCursorNotFound  = errors.New("after_message_id is not a message of the exported branch")
+)
+
 type sessionService struct {
 	sessionRepo        repo.SessionRepo
 	assetReferenceRepo repo.AssetReferenceRepo
@@ -41,6 +84,7 @@ type sessionService struct {
 	publisher          *mq.Publisher
 	cfg                *config.Config
 	redis              *redis.Client
+	presign            *presignCache
 }
 
 const (
@@ -48,9 +92,15 @@ const (
 	redisKeyPrefixParts = "message:parts:"
 	// Default TTL for message parts cache (1 hour)
 	defaultPartsCacheTTL = time.Hour
+	// Default number of parts downloaded concurrently by loadPartsForMessages
+	defaultPartsDownloadConcurrency = 16
 )
 
 func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.AssetReferenceRepo, log *zap.Logger, s3 *blob.S3Deps, publisher *mq.Publisher, cfg *config.Config, redis *redis.Client) SessionService {
+	var presignTTL time.Duration
+	if cfg != nil {
+		presignTTL = time.Duration(cfg.S3.PresignCacheTTLSec) * time.Second
+	}
 	return &sessionService{
 		sessionRepo:        sessionRepo,
 		assetReferenceRepo: assetReferenceRepo,
@@ -59,10 +109,12 @@ func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.Ass
 		publisher:          publisher,
 		cfg:                cfg,
 		redis:              redis,
+		presign:            newPresignCache(presignTTL, redis, log),
 	}
 }
 
 func (s *sessionService) Create(ctx context.Context, ss *model.Session) error {
+	ss.Tags = normalizeTags(ss.Tags)
 	return s.sessionRepo.Create(ctx, ss)
 }
 
@@ -78,10 +130,163 @@ func (s *sessionService) Delete(ctx context.Context, projectID uuid.UUID, sessio
 	return nil
 }
 
+// bulkDeleteBatchSize bounds the sessions deleted per transaction by BulkDelete
+const bulkDeleteBatchSize = 50
+
+type BulkDeleteSessionsInput struct {
+	ProjectID  uuid.UUID
+	SessionIDs []uuid.UUID
+	SpaceID    *uuid.UUID // [Optional] deletes the sessions of the space instead of SessionIDs
+	// OnProgress is called after each batch with the progress so far
+	OnProgress func(BulkDeleteSessionsOutput)
+}
+
+type BulkDeleteSessionsOutput struct {
+	Total    int         `json:"total"`
+	Deleted  int         `json:"deleted"`
+	Batches  int         `json:"batches"`
+	NotFound []uuid.UUID `json:"not_found"`
+	// Failed holds the sessions of the batches that could not be deleted, they are left untouched
+	Failed []uuid.UUID `json:"failed"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// BulkDelete deletes sessions in batches, each batch in one transaction releasing the assets of its messages.
+// A failed batch is reported and the next batches are still deleted.
+func (s *sessionService) BulkDelete(ctx context.Context, in BulkDeleteSessionsInput) (*BulkDeleteSessionsOutput, error) {
+	ids := in.SessionIDs
+	if in.SpaceID != nil {
+		var err error
+		if ids, err = s.sessionRepo.ListIDsBySpace(ctx, in.ProjectID, *in.SpaceID); err != nil {
+			return nil, fmt.Errorf("list sessions of space: %w", err)
+		}
+	}
+	ids = uniqueIDs(ids)
+
+	out := &BulkDeleteSessionsOutput{Total: len(ids), NotFound: []uuid.UUID{}, Failed: []uuid.UUID{}}
+	for start := 0; start < len(ids); start += bulkDeleteBatchSize {
+		if err := ctx.Err(); err != nil {
+			return out, err
+		}
+		batch := ids[start:min(start+bulkDeleteBatchSize, len(ids))]
+		out.Batches++
+
+		deleted, err := s.sessionRepo.DeleteMany(ctx, in.ProjectID, batch)
+		if err != nil {
+			s.log.Warn("bulk delete sessions batch failed", zap.String("project_id", in.ProjectID.String()), zap.Int("sessions", len(batch)), zap.Error(err))
+			out.Failed = append(out.Failed, batch...)
+			out.Error = err.Error()
+		} else {
+			out.Deleted += len(deleted)
+			found := make(map[uuid.UUID]bool, len(deleted))
+			for _, id := range deleted {
+				found[id] = true
+			}
+			for _, id := range batch {
+				if !found[id] {
+					out.NotFound = append(out.NotFound, id)
+				}
+			}
+		}
+
+		if in.OnProgress != nil {
+			in.OnProgress(*out)
+		}
+	}
+	return out, nil
+}
+
+// uniqueIDs drops the repeated IDs of ids, keeping their first position
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
 func (s *sessionService) UpdateByID(ctx context.Context, ss *model.Session) error {
 	return s.sessionRepo.Update(ctx, ss)
 }
 
+type UpdateSessionMetadataInput struct {
+	ProjectID   uuid.UUID
+	SessionID   uuid.UUID
+	Title       *string   // [Optional]
+	Description *string   // [Optional]
+	Tags        *[]string // [Optional] replaces all tags
+}
+
+func (s *sessionService) UpdateMetadata(ctx context.Context, in UpdateSessionMetadataInput) (*model.Session, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != in.ProjectID {
+		return nil, ErrSessionNotFound
+	}
+
+	if in.Title != nil {
+		ss.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Description != nil {
+		ss.Description = *in.Description
+	}
+	if in.Tags != nil {
+		ss.Tags = *in.Tags
+	}
+	ss.Tags = normalizeTags(ss.Tags)
+
+	if err := s.sessionRepo.UpdateMetadata(ctx, ss); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// SetArchived archives or restores a session of the project, archived sessions keep their messages
+func (s *sessionService) SetArchived(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, archived bool) (*model.Session, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	if ss.IsArchived != archived {
+		if err := s.sessionRepo.SetArchived(ctx, sessionID, archived); err != nil {
+			return nil, err
+		}
+		ss.IsArchived = archived
+	}
+	return ss, nil
+}
+
+// normalizeTags trims the tags and drops empty and duplicate ones, keeping their order
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
 func (s *sessionService) GetByID(ctx context.Context, ss *model.Session) (*model.Session, error) {
 	if len(ss.ID) == 0 {
 		return nil, errors.New("space id is empty")
@@ -90,12 +295,18 @@ func (s *sessionService) GetByID(ctx context.Context, ss *model.Session) (*model
 }
 
 type ListSessionsInput struct {
-	ProjectID    uuid.UUID  `json:"project_id"`
-	SpaceID      *uuid.UUID `json:"space_id,omitempty"`
-	NotConnected bool       `json:"not_connected"`
-	Limit        int        `json:"limit"`
-	Cursor       string     `json:"cursor"`
-	TimeDesc     bool       `json:"time_desc"`
+	ProjectID    uuid.UUID         `json:"project_id"`
+	SpaceID      *uuid.UUID        `json:"space_id,omitempty"`
+	NotConnected bool              `json:"not_connected"`
+	Tag          string            `json:"tag"`
+	Query        string            `json:"q"` // case-insensitive substring of the title
+	EndUserID    string            `json:"end_user_id"`
+	Configs      map[string]string `json:"configs,omitempty"` // config values by dotted path, e.g. flags.beta, all must match
+	Limit        int               `json:"limit"`
+	Cursor       string            `json:"cursor"`
+	TimeDesc     bool              `json:"time_desc"`
+
+	IncludeArchived bool `json:"include_archived"` // list archived sessions too
 }
 
 type ListSessionsOutput struct {
@@ -117,7 +328,7 @@ func (s *sessionService) List(ctx context.Context, in ListSessionsInput) (*ListS
 	}
 
 	// Query limit+1 is used to determine has_more
-	sessions, err := s.sessionRepo.ListWithCursor(ctx, in.ProjectID, in.SpaceID, in.NotConnected, afterT, afterID, in.Limit+1, in.TimeDesc)
+	sessions, err := s.sessionRepo.ListWithCursor(ctx, in.ProjectID, in.SpaceID, in.NotConnected, in.Tag, in.Query, in.EndUserID, in.Configs, in.IncludeArchived, afterT, afterID, in.Limit+1, in.TimeDesc)
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +354,16 @@ type SendMessageInput struct {
 	Parts       []PartIn
 	MessageMeta map[string]interface{} // Message-level metadata (e.g., name, source_format)
 	Files       map[string]*multipart.FileHeader
+	// ParentID branches the message from an earlier message, it defaults to the latest message of the session
+	ParentID *uuid.UUID
+	Usage    model.TokenUsage
+	// PartTransforms is the part transform pipeline of the project, nil uses the server one
+	PartTransforms []model.PartTransformConfig
+	// Redaction masks PII in text parts before the part transforms, nil redacts nothing
+	Redaction *model.RedactionPolicy
+	// DeliverAt schedules the message: it is stored and published at that time instead of now.
+	// Uploads and part transforms happen when it is sent, a past time sends it now.
+	DeliverAt time.Time
 }
 
 type SendMQPublishJSON struct {
@@ -206,7 +427,29 @@ func (p *PartIn) Validate() error {
 }
 
 func (s *sessionService) SendMessage(ctx context.Context, in SendMessageInput) (*model.Message, error) {
+	scheduled := time.Until(in.DeliverAt) > 0
+	if scheduled {
+		if s.publisher == nil {
+			return nil, ErrScheduleUnavailable
+		}
+		if time.Until(in.DeliverAt) > maxScheduleDelay {
+			return nil, ErrDeliverAtTooFar
+		}
+	}
+
+	if in.ParentID != nil {
+		exists, err := s.sessionRepo.MessageExists(ctx, in.SessionID, *in.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("check parent message: %w", err)
+		}
+		if !exists {
+			return nil, ErrParentMessageNotFound
+		}
+	}
+
 	parts := make([]model.Part, 0, len(in.Parts))
+	// uploaded holds the assets referenced by the message, released if it is refused as a duplicate
+	uploaded := []model.Asset{}
 
 	for idx, p := range in.Parts {
 		part := model.Part{
@@ -221,7 +464,7 @@ func (s *sessionService) SendMessage(ctx context.Context, in SendMessageInput) (
 			}
 
 			// upload asset to S3
-			asset, err := s.s3.UploadFormFile(ctx, "assets/"+in.ProjectID.String(), fh)
+			asset, err := s.s3.ForProject(in.ProjectID).UploadFormFile(ctx, "assets/"+in.ProjectID.String(), fh)
 			if err != nil {
 				return nil, fmt.Errorf("upload %s failed: %w", p.FileField, err)
 			}
@@ -232,6 +475,7 @@ func (s *sessionService) SendMessage(ctx context.Context, in SendMessageInput) (
 
 			part.Asset = asset
 			part.Filename = fh.Filename
+			uploaded = append(uploaded, *asset)
 		}
 
 		if p.Text != "" {
@@ -241,13 +485,120 @@ func (s *sessionService) SendMessage(ctx context.Context, in SendMessageInput) (
 		parts = append(parts, part)
 	}
 
-	// upload parts to S3 as JSON file
-	asset, err := s.s3.UploadJSON(ctx, "parts/"+in.ProjectID.String(), parts)
+	stored, err := s.storeParts(ctx, in.ProjectID, parts, uploaded, in.PartTransforms, in.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	msg := newMessage(in.SessionID, in.Role, in.MessageMeta, stored)
+	msg.ParentID = in.ParentID
+	msg.Usage = in.Usage
+	msg.ContentHash = model.MessageContentHash(msg.Role, stored.parts)
+
+	if scheduled {
+		// The id is known before the message is stored, so the client can look it up once delivered
+		msg.ID = uuid.New()
+		ev := newScheduledMessageJSON(in.ProjectID, in.DeliverAt, &msg)
+		if err := s.publisher.PublishDelayedJSON(ctx, s.cfg.RabbitMQ.QueueName.ScheduledMessage, ev, time.Until(in.DeliverAt)); err != nil {
+			return nil, fmt.Errorf("schedule message: %w", err)
+		}
+		return &msg, nil
+	}
+
+	if err := s.persistMessage(ctx, in.ProjectID, &msg); err != nil {
+		if errors.Is(err, ErrDuplicateMessage) && len(stored.uploaded) > 0 {
+			if err := s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, in.ProjectID, stored.uploaded); err != nil {
+				s.log.Warn("release assets of duplicate message", zap.String("session_id", in.SessionID.String()), zap.Error(err))
+			}
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// storedParts are the parts of a new message once transformed and stored
+type storedParts struct {
+	parts      []model.Part
+	inline     datatypes.JSONSlice[model.Part]
+	partsAsset model.Asset
+	// assetSHA256s lists the assets the parts reference, uploaded every asset stored for the message
+	assetSHA256s []string
+	uploaded     []model.Asset
+	// redaction reports the PII masked in the parts, nil when nothing was
+	redaction *model.RedactionReport
+	// inlineSizeB is the size of the parts kept in the message row
+	inlineSizeB int64
+}
+
+// sizeB is the size of the stored message, its inline parts and the assets uploaded for it
+func (p *storedParts) sizeB() int64 {
+	n := p.inlineSizeB
+	for _, a := range p.uploaded {
+		n += a.SizeB
+	}
+	return n
+}
+
+// storeParts masks PII in parts and applies the part transforms to them, then keeps small parts in the message row
+// and uploads larger ones to S3 as a JSON file. uploaded are the assets the parts already reference, e.g. uploaded files.
+func (s *sessionService) storeParts(ctx context.Context, projectID uuid.UUID, parts []model.Part, uploaded []model.Asset, transforms []model.PartTransformConfig, redaction *model.RedactionPolicy) (*storedParts, error) {
+	out := &storedParts{parts: parts, assetSHA256s: []string{}, uploaded: uploaded}
+	for _, a := range uploaded {
+		out.assetSHA256s = append(out.assetSHA256s, a.SHA256)
+	}
+
+	// Redaction runs first so that no transform keeps a copy of the PII, e.g. as an asset
+	if redaction != nil && redaction.Enabled {
+		detector, err := newPIIDetector(s.cfg, redaction)
+		if err != nil {
+			return nil, fmt.Errorf("redact parts: %w", err)
+		}
+		if out.redaction, err = redactParts(ctx, detector, redaction.Detector, parts); err != nil {
+			return nil, fmt.Errorf("redact parts: %w", err)
+		}
+	}
+
+	// Full copies kept by the transforms are assets of the message like uploaded files
+	store := func(ctx context.Context, data []byte, contentType string, ext string) (*model.Asset, error) {
+		if s.s3 == nil {
+			return nil, errors.New("s3 is not available")
+		}
+		asset, err := s.s3.ForProject(projectID).UploadBytes(ctx, "assets/"+projectID.String(), data, contentType, ext)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.assetReferenceRepo.IncrementAssetRef(ctx, projectID, *asset); err != nil {
+			return nil, fmt.Errorf("increment asset reference: %w", err)
+		}
+		out.assetSHA256s = append(out.assetSHA256s, asset.SHA256)
+		out.uploaded = append(out.uploaded, *asset)
+		return asset, nil
+	}
+	skipped, err := applyPartTransforms(ctx, partTransformPipeline(s.cfg, transforms), parts, store)
+	if len(skipped) > 0 {
+		s.log.Warn("unknown part transforms skipped", zap.Strings("names", skipped))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Small parts are stored in the message row, larger ones in S3 as a JSON file. With envelope encryption all parts
+	// stay in the row: core reads parts JSON from S3 and cannot open sealed objects, their files are still sealed.
+	partsJSON, err := sonic.Marshal(parts)
+	if err != nil {
+		return nil, fmt.Errorf("marshal parts: %w", err)
+	}
+	if s.s3.Sealing() || (s.cfg != nil && len(partsJSON) <= s.cfg.S3.InlinePartsMaxBytes) {
+		out.inline = datatypes.NewJSONSlice(parts)
+		out.inlineSizeB = int64(len(partsJSON))
+		return out, nil
+	}
+
+	asset, err := s.s3.UploadJSON(ctx, "parts/"+projectID.String(), parts)
 	if err != nil {
 		return nil, fmt.Errorf("upload parts to S3 failed: %w", err)
 	}
 
-	if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
+	if err := s.assetReferenceRepo.IncrementAssetRef(ctx, projectID, *asset); err != nil {
 		return nil, fmt.Errorf("increment asset reference: %w", err)
 	}
 
@@ -258,36 +609,191 @@ func (s *sessionService) SendMessage(ctx context.Context, in SendMessageInput) (
 			s.log.Warn("failed to cache parts in Redis", zap.String("sha256", asset.SHA256), zap.Error(err))
 		}
 	}
+	out.partsAsset = *asset
+	out.uploaded = append(out.uploaded, *asset)
+	return out, nil
+}
+
+// newMessage returns a new message of a session with stored parts
+func newMessage(sessionID uuid.UUID, role string, meta map[string]interface{}, stored *storedParts) model.Message {
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	if stored.redaction != nil {
+		meta = maps.Clone(meta)
+		meta[model.MessageMetaRedactionKey] = stored.redaction
+	}
+	return model.Message{
+		SessionID:      sessionID,
+		Role:           role,
+		Meta:           datatypes.NewJSONType(meta), // Store message-level metadata
+		PartsAssetMeta: datatypes.NewJSONType(stored.partsAsset),
+		InlineParts:    stored.inline,
+		Parts:          stored.parts,
+		PartTypes:      datatypes.NewJSONSlice(model.PartTypes(stored.parts)),
+		AssetSHA256s:   datatypes.NewJSONSlice(stored.assetSHA256s),
+		SizeB:          stored.sizeB(),
+		SearchText:     model.MessageSearchText(stored.parts),
+	}
+}
+
+// maxTurnMessages bounds the messages stored by one SendTurn
+const maxTurnMessages = 50
+
+type SendTurnInput struct {
+	ProjectID uuid.UUID
+	SessionID uuid.UUID
+	// Messages are the user message and the assistant messages and tool results it led to, in order
+	Messages []TurnMessageIn
+	// ParentID branches the turn from an earlier message, it defaults to the latest message of the session
+	ParentID *uuid.UUID
+	// PartTransforms is the part transform pipeline of the project, nil uses the server one
+	PartTransforms []model.PartTransformConfig
+	// Redaction masks PII in text parts before the part transforms, nil redacts nothing
+	Redaction *model.RedactionPolicy
+}
+
+// TurnMessageIn is a message of a turn, its parts cannot reference uploaded files
+type TurnMessageIn struct {
+	Role        string
+	Parts       []PartIn
+	MessageMeta map[string]interface{}
+	Usage       model.TokenUsage
+}
+
+type SendTurnOutput struct {
+	TurnID   uuid.UUID       `json:"turn_id"`
+	Messages []model.Message `json:"messages"`
+}
+
+// SendTurn stores the messages of a turn atomically under a shared turn id, so a client crashing mid-turn
+// never leaves a tool call without its result. Parts are stored before the transaction and released if it fails.
+func (s *sessionService) SendTurn(ctx context.Context, in SendTurnInput) (*SendTurnOutput, error) {
+	if len(in.Messages) == 0 || len(in.Messages) > maxTurnMessages {
+		return nil, fmt.Errorf("%w: a turn holds 1 to %d messages", ErrTurnTooLarge, maxTurnMessages)
+	}
+	if in.ParentID != nil {
+		exists, err := s.sessionRepo.MessageExists(ctx, in.SessionID, *in.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("check parent message: %w", err)
+		}
+		if !exists {
+			return nil, ErrParentMessageNotFound
+		}
+	}
 
-	// Prepare message metadata
-	messageMeta := in.MessageMeta
-	if messageMeta == nil {
-		messageMeta = make(map[string]interface{})
+	turnID := uuid.New()
+	msgs := make([]model.Message, len(in.Messages))
+	uploaded := []model.Asset{}
+	release := func() {
+		if len(uploaded) == 0 {
+			return
+		}
+		if err := s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, in.ProjectID, uploaded); err != nil {
+			s.log.Warn("release assets of failed turn", zap.String("session_id", in.SessionID.String()), zap.Error(err))
+		}
 	}
 
-	msg := model.Message{
-		SessionID:      in.SessionID,
-		Role:           in.Role,
-		Meta:           datatypes.NewJSONType(messageMeta), // Store message-level metadata
-		PartsAssetMeta: datatypes.NewJSONType(*asset),
-		Parts:          parts,
+	for i, m := range in.Messages {
+		parts := make([]model.Part, 0, len(m.Parts))
+		for idx, p := range m.Parts {
+			if p.FileField != "" {
+				release()
+				return nil, fmt.Errorf("messages[%d].parts[%d]: file uploads are not supported in turns", i, idx)
+			}
+			parts = append(parts, model.Part{Type: p.Type, Text: p.Text, Meta: p.Meta})
+		}
+
+		stored, err := s.storeParts(ctx, in.ProjectID, parts, nil, in.PartTransforms, in.Redaction)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		uploaded = append(uploaded, stored.uploaded...)
+
+		msg := newMessage(in.SessionID, m.Role, m.MessageMeta, stored)
+		msg.ID = uuid.New()
+		msg.TurnID = &turnID
+		msg.Usage = m.Usage
+		msg.ContentHash = model.MessageContentHash(msg.Role, stored.parts)
+		if i == 0 {
+			msg.ParentID = in.ParentID
+		}
+		msgs[i] = msg
 	}
 
-	if err := s.sessionRepo.CreateMessageWithAssets(ctx, &msg); err != nil {
+	ptrs := make([]*model.Message, len(msgs))
+	for i := range msgs {
+		ptrs[i] = &msgs[i]
+	}
+	if err := s.sessionRepo.CreateTurn(ctx, ptrs); err != nil {
+		release()
 		return nil, err
 	}
+	for i := range msgs {
+		s.afterPersist(ctx, in.ProjectID, &msgs[i])
+	}
+	return &SendTurnOutput{TurnID: turnID, Messages: msgs}, nil
+}
+
+// persistMessage stores a new message of a session and publishes it to the post-ingest consumers
+func (s *sessionService) persistMessage(ctx context.Context, projectID uuid.UUID, msg *model.Message) error {
+	if err := s.sessionRepo.CreateMessageWithAssets(ctx, msg); err != nil {
+		return err
+	}
+	s.afterPersist(ctx, projectID, msg)
+	return nil
+}
+
+// afterPersist names untitled sessions and publishes a stored message to the post-ingest consumers
+func (s *sessionService) afterPersist(ctx context.Context, projectID uuid.UUID, msg *model.Message) {
+	// Untitled sessions are named after their first user message
+	if msg.Role == "user" {
+		if title := autoSessionTitle(msg.Parts); title != "" {
+			if err := s.sessionRepo.SetTitleIfEmpty(ctx, msg.SessionID, title); err != nil {
+				s.log.Warn("set session title", zap.String("session_id", msg.SessionID.String()), zap.Error(err))
+			}
+		}
+	}
 
 	if s.publisher != nil {
 		if err := s.publisher.PublishJSON(ctx, s.cfg.RabbitMQ.ExchangeName.SessionMessage, s.cfg.RabbitMQ.RoutingKey.SessionMessageInsert, SendMQPublishJSON{
-			ProjectID: in.ProjectID,
-			SessionID: in.SessionID,
+			ProjectID: projectID,
+			SessionID: msg.SessionID,
 			MessageID: msg.ID,
 		}); err != nil {
 			s.log.Error("publish session message", zap.Error(err))
 		}
 	}
+}
 
-	return &msg, nil
+// maxAutoTitleRunes is the length of titles generated from the first user message
+const maxAutoTitleRunes = 80
+
+// autoSessionTitle returns the first line of the first text part, cut at a word boundary to maxAutoTitleRunes
+func autoSessionTitle(parts []model.Part) string {
+	for _, p := range parts {
+		if p.Type != "text" {
+			continue
+		}
+		text := strings.TrimSpace(p.Text)
+		if text == "" {
+			continue
+		}
+		line, _, _ := strings.Cut(text, "\n")
+		line = strings.Join(strings.Fields(line), " ")
+
+		runes := []rune(line)
+		if len(runes) <= maxAutoTitleRunes {
+			return line
+		}
+		cut := string(runes[:maxAutoTitleRunes])
+		if i := strings.LastIndex(cut, " "); i > 0 {
+			cut = cut[:i]
+		}
+		return cut + "…"
+	}
+	return ""
 }
 
 type GetMessagesInput struct {
@@ -297,6 +803,18 @@ type GetMessagesInput struct {
 	WithAssetPublicURL bool          `json:"with_public_url"`
 	AssetExpire        time.Duration `json:"asset_expire"`
 	TimeDesc           bool          `json:"time_desc"`
+	// Roles and PartTypes keep only messages with one of the roles and with a part of one of the types
+	Roles     []string `json:"roles"`
+	PartTypes []string `json:"part_types"`
+	// AsOf returns the session as it was at that time, zero reads the current session
+	AsOf time.Time `json:"as_of"`
+	// CollapseSuperseded leaves out superseded messages and the messages descending from them
+	CollapseSuperseded bool `json:"collapse_superseded"`
+	// AnchorMessageID returns the Before messages preceding the anchor, the anchor and the After messages following it,
+	// instead of a page from Cursor. The filters apply to the messages around the anchor, not to the anchor.
+	AnchorMessageID *uuid.UUID `json:"anchor_message_id"`
+	Before          int        `json:"before"`
+	After           int        `json:"after"`
 }
 
 type PublicURL struct {
@@ -309,9 +827,17 @@ type GetMessagesOutput struct {
 	NextCursor string               `json:"next_cursor,omitempty"`
 	HasMore    bool                 `json:"has_more"`
 	PublicURLs map[string]PublicURL `json:"public_urls,omitempty"` // file_name -> url
+	// PrevCursor and HasMoreBefore continue an anchored window backwards, with TimeDesc.
+	// NextCursor and HasMore then continue it forwards.
+	PrevCursor    string `json:"prev_cursor,omitempty"`
+	HasMoreBefore bool   `json:"has_more_before,omitempty"`
 }
 
 func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error) {
+	if in.AnchorMessageID != nil {
+		return s.getMessagesAround(ctx, in)
+	}
+
 	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
 	var afterT time.Time
 	var afterID uuid.UUID
@@ -324,18 +850,13 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 	}
 
 	// Query limit+1 is used to determine has_more
-	msgs, err := s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, afterT, afterID, in.Limit+1, in.TimeDesc)
+	msgs, err := s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, in.Roles, in.PartTypes, in.AsOf, in.CollapseSuperseded, afterT, afterID, in.Limit+1, in.TimeDesc)
 	if err != nil {
 		return nil, err
 	}
 
-	for i, m := range msgs {
-		meta := m.PartsAssetMeta.Data()
-		parts := s.loadPartsForMessage(ctx, meta)
-		if len(parts) == 0 {
-			continue // Skip messages with failed parts loading
-		}
-		msgs[i].Parts = parts
+	if err := s.loadPartsForMessages(ctx, msgs); err != nil {
+		return nil, err
 	}
 
 	// Always sort messages from old to new (ascending by created_at)
@@ -358,28 +879,124 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
 	}
 
+	// Messages stored without part types passed the repo filter, keep those that have a matching part.
+	// The page may then hold fewer than limit messages.
+	out.Items = keepPartTypes(out.Items, in.PartTypes, uuid.Nil)
+
 	if in.WithAssetPublicURL && s.s3 != nil {
-		out.PublicURLs = make(map[string]PublicURL)
-		for _, m := range out.Items {
-			for _, p := range m.Parts {
-				if p.Asset == nil {
-					continue
-				}
-				url, err := s.s3.PresignGet(ctx, p.Asset.S3Key, in.AssetExpire)
-				if err != nil {
-					return nil, fmt.Errorf("get presigned url for asset %s: %w", p.Asset.S3Key, err)
-				}
-				out.PublicURLs[p.Asset.SHA256] = PublicURL{
-					URL:      url,
-					ExpireAt: time.Now().Add(in.AssetExpire),
-				}
-			}
+		out.PublicURLs, err = s.presignPartAssets(ctx, out.Items, in.AssetExpire)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// getMessagesAround returns the messages around the anchor of in, oldest first
+func (s *sessionService) getMessagesAround(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error) {
+	anchor, err := s.sessionRepo.GetMessage(ctx, in.SessionID, *in.AnchorMessageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if !in.AsOf.IsZero() && anchor.CreatedAt.After(in.AsOf) {
+		return nil, ErrMessageNotFound
+	}
+
+	out := &GetMessagesOutput{}
+	before := []model.Message{}
+	if in.Before > 0 {
+		before, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, in.Roles, in.PartTypes, in.AsOf, in.CollapseSuperseded, anchor.CreatedAt, anchor.ID, in.Before+1, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(before) > in.Before {
+			before = before[:in.Before]
+			out.HasMoreBefore = true
+		}
+		slices.Reverse(before)
+	}
+	after := []model.Message{}
+	if in.After > 0 {
+		after, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, in.Roles, in.PartTypes, in.AsOf, in.CollapseSuperseded, anchor.CreatedAt, anchor.ID, in.After+1, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(after) > in.After {
+			after = after[:in.After]
+			out.HasMore = true
 		}
 	}
 
+	out.Items = make([]model.Message, 0, len(before)+1+len(after))
+	out.Items = append(append(append(out.Items, before...), *anchor), after...)
+	if err := s.loadPartsForMessages(ctx, out.Items); err != nil {
+		return nil, err
+	}
+
+	first, last := out.Items[0], out.Items[len(out.Items)-1]
+	out.Items = keepPartTypes(out.Items, in.PartTypes, anchor.ID)
+	if out.HasMoreBefore {
+		out.PrevCursor = paging.EncodeCursor(first.CreatedAt, first.ID)
+	}
+	if out.HasMore {
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if in.WithAssetPublicURL && s.s3 != nil {
+		out.PublicURLs, err = s.presignPartAssets(ctx, out.Items, in.AssetExpire)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return out, nil
 }
 
+// keepPartTypes drops the messages stored without part types that have no part of partTypes, keeping the message keep
+func keepPartTypes(msgs []model.Message, partTypes []string, keep uuid.UUID) []model.Message {
+	if len(partTypes) == 0 {
+		return msgs
+	}
+	kept := make([]model.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.ID == keep || len(m.PartTypes) > 0 || slices.ContainsFunc(model.PartTypes(m.Parts), func(t string) bool {
+			return slices.Contains(partTypes, t)
+		}) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// presignPartAssets returns presigned URLs for the assets of the parts of msgs, keyed by SHA256.
+// URLs are reused from the presign cache, see presignCache. Encrypted assets have no presigned URL,
+// their content is served by the API.
+func (s *sessionService) presignPartAssets(ctx context.Context, msgs []model.Message, expire time.Duration) (map[string]PublicURL, error) {
+	urls := make(map[string]PublicURL)
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if p.Asset == nil || p.Asset.Encrypted {
+				continue
+			}
+			if _, ok := urls[p.Asset.SHA256]; ok {
+				continue
+			}
+			key := p.Asset.S3Key
+			url, err := s.presign.get(ctx, key, expire, func() (string, error) {
+				return s.s3.PresignGet(ctx, key, expire)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("get presigned url for asset %s: %w", key, err)
+			}
+			urls[p.Asset.SHA256] = url
+		}
+	}
+	return urls, nil
+}
+
 // cachePartsInRedis stores message parts in Redis with a fixed TTL
 func (s *sessionService) cachePartsInRedis(ctx context.Context, sha256 string, parts []model.Part) error {
 	if s.redis == nil {
@@ -432,9 +1049,76 @@ func (s *sessionService) getPartsFromRedis(ctx context.Context, sha256 string) (
 	return parts, nil
 }
 
+// loadPartsForMessages loads the parts of msgs concurrently, with at most S3.PartsDownloadConcurrency downloads in flight.
+// Each download has a timeout of S3.PartsDownloadTimeoutSec, so bulk loads of long sessions are not cut short; an error
+// is returned when a download or ctx expires. Messages whose parts fail to load otherwise get empty parts, see
+// loadPartsForMessage. Inline parts are never downloaded.
+func (s *sessionService) loadPartsForMessages(ctx context.Context, msgs []model.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	concurrency := defaultPartsDownloadConcurrency
+	var timeout time.Duration
+	if s.cfg != nil {
+		if s.cfg.S3.PartsDownloadConcurrency > 0 {
+			concurrency = s.cfg.S3.PartsDownloadConcurrency
+		}
+		timeout = time.Duration(s.cfg.S3.PartsDownloadTimeoutSec) * time.Second
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var timedOut atomic.Bool
+	for i := range msgs {
+		if msgs[i].PartsInline() {
+			msgs[i].Parts = msgs[i].InlineParts
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			dctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				dctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			msgs[i].Parts = s.loadPartsForMessage(dctx, msgs[i])
+			if dctx.Err() != nil && ctx.Err() == nil {
+				timedOut.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("load message parts: %w", err)
+	}
+	if timedOut.Load() {
+		return fmt.Errorf("load message parts: %w", context.DeadlineExceeded)
+	}
+	return nil
+}
+
 // loadPartsForMessage loads parts for a message from cache or S3
 // Returns the loaded parts, or empty slice if loading fails
-func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Asset) []model.Part {
+func (s *sessionService) loadPartsForMessage(ctx context.Context, msg model.Message) []model.Part {
+	if msg.PartsInline() {
+		return msg.InlineParts
+	}
+
+	meta := msg.PartsAssetMeta.Data()
 	parts := []model.Part{}
 	cacheHit := false
 
@@ -467,6 +1151,22 @@ func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Ass
 	return parts
 }
 
+// GetMessagesByIDs retrieves the messages of messageIDs, of any session, and loads their parts. Missing messages
+// are left out and the order is not kept.
+func (s *sessionService) GetMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error) {
+	if len(messageIDs) == 0 {
+		return []model.Message{}, nil
+	}
+	msgs, err := s.sessionRepo.ListMessagesByIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	if err := s.loadPartsForMessages(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
 // GetAllMessages retrieves all messages for a session and loads their parts
 func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
 	// Get all messages from repository
@@ -475,10 +1175,8 @@ func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID
 		return nil, fmt.Errorf("failed to list messages: %w", err)
 	}
 
-	// Load parts for each message
-	for i, m := range msgs {
-		meta := m.PartsAssetMeta.Data()
-		msgs[i].Parts = s.loadPartsForMessage(ctx, meta)
+	if err := s.loadPartsForMessages(ctx, msgs); err != nil {
+		return nil, err
 	}
 
 	// Sort messages from old to new (ascending by created_at)
@@ -491,3 +1189,1093 @@ func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID
 
 	return msgs, nil
 }
+
+// GetMessage retrieves a single message of a session and loads its parts
+func (s *sessionService) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	msg, err := s.sessionRepo.GetMessage(ctx, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	msg.Parts = s.loadPartsForMessage(ctx, *msg)
+	return msg, nil
+}
+
+type SupersedeMessageInput struct {
+	ProjectID uuid.UUID
+	SessionID uuid.UUID
+	MessageID uuid.UUID
+	// By is the message regenerated in place of MessageID
+	By uuid.UUID
+}
+
+// Supersede marks an assistant message as superseded by another assistant message of the session, e.g. a regenerated turn.
+// The new message must not descend from the superseded one nor be superseded itself, so collapsing superseded branches keeps it.
+// Superseding a message again replaces the message it is superseded by.
+func (s *sessionService) Supersede(ctx context.Context, in SupersedeMessageInput) (*model.Message, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != in.ProjectID {
+		return nil, ErrSessionNotFound
+	}
+	if in.MessageID == in.By {
+		return nil, fmt.Errorf("%w: a message cannot supersede itself", ErrInvalidSupersession)
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	byID := make(map[uuid.UUID]*model.Message, len(msgs))
+	for i := range msgs {
+		byID[msgs[i].ID] = &msgs[i]
+	}
+	old, ok := byID[in.MessageID]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	by, ok := byID[in.By]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	if old.Role != "assistant" || by.Role != "assistant" {
+		return nil, fmt.Errorf("%w: only assistant messages can be superseded", ErrInvalidSupersession)
+	}
+	if by.SupersededBy != nil {
+		return nil, fmt.Errorf("%w: message %s is superseded itself", ErrInvalidSupersession, by.ID)
+	}
+	// parent links may loop in a corrupted session, no branch is longer than the session
+	for m, steps := by, 0; m.ParentID != nil; steps++ {
+		if steps == len(msgs) {
+			return nil, fmt.Errorf("parent links of message %s loop", by.ID)
+		}
+		if *m.ParentID == old.ID {
+			return nil, fmt.Errorf("%w: message %s descends from the superseded message", ErrInvalidSupersession, by.ID)
+		}
+		if m, ok = byID[*m.ParentID]; !ok {
+			break
+		}
+	}
+
+	now := time.Now()
+	if err := s.sessionRepo.SupersedeMessage(ctx, in.SessionID, in.MessageID, in.By, now); err != nil {
+		return nil, err
+	}
+	old.SupersededBy = &in.By
+	old.SupersededAt = &now
+	old.Parts = s.loadPartsForMessage(ctx, *old)
+	return old, nil
+}
+
+// ExpandedPart is the full text of a part, tool outputs archived on ingest are restored from their asset
+type ExpandedPart struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Index     int       `json:"index"`
+	Type      string    `json:"type" example:"tool-result"`
+	Text      string    `json:"text"`
+	Archived  bool      `json:"archived"` // the text was restored from the archived full output
+}
+
+// ExpandPart returns the full text of the part at index of a message of the project
+func (s *sessionService) ExpandPart(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID, index int) (*ExpandedPart, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	msg, err := s.GetMessage(ctx, sessionID, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if index < 0 || index >= len(msg.Parts) {
+		return nil, ErrPartNotFound
+	}
+
+	p := msg.Parts[index]
+	out := &ExpandedPart{MessageID: messageID, Index: index, Type: p.Type, Text: p.Text}
+	if out.Text, out.Archived, err = s.fullPartText(ctx, p); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fullPartText returns the text of a part, read from its asset when it was truncated on ingest, and whether it was
+func (s *sessionService) fullPartText(ctx context.Context, p model.Part) (string, bool, error) {
+	if truncated, _ := p.Meta[model.PartMetaTruncated].(bool); !truncated || p.Asset == nil {
+		return p.Text, false, nil
+	}
+	if s.s3 == nil {
+		return "", false, errors.New("s3 is not available")
+	}
+	data, err := s.s3.DownloadFile(ctx, p.Asset.S3Key)
+	if err != nil {
+		return "", false, fmt.Errorf("download archived output: %w", err)
+	}
+	return string(data), true, nil
+}
+
+// expandTruncatedParts replaces the preview of the parts truncated on ingest with their full text, the truncated
+// flag is dropped from their meta
+func (s *sessionService) expandTruncatedParts(ctx context.Context, msgs []model.Message) error {
+	for i := range msgs {
+		var parts []model.Part
+		for j, p := range msgs[i].Parts {
+			text, archived, err := s.fullPartText(ctx, p)
+			if err != nil {
+				return fmt.Errorf("message %s part %d: %w", msgs[i].ID, j, err)
+			}
+			if !archived {
+				continue
+			}
+			if parts == nil {
+				// the parts may be shared with the inline parts of the message
+				parts = slices.Clone(msgs[i].Parts)
+			}
+			meta := maps.Clone(p.Meta)
+			delete(meta, model.PartMetaTruncated)
+			parts[j].Text, parts[j].Meta = text, meta
+		}
+		if parts != nil {
+			msgs[i].Parts = parts
+		}
+	}
+	return nil
+}
+
+// MessageTreeNode is a message of a session without its parts, linked to its parent and children
+type MessageTreeNode struct {
+	ID           uuid.UUID   `json:"id"`
+	ParentID     *uuid.UUID  `json:"parent_id"`
+	Role         string      `json:"role"`
+	ChildIDs     []uuid.UUID `json:"child_ids"`
+	SupersededBy *uuid.UUID  `json:"superseded_by,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// MessageTree is the branch structure of a session, nodes are ordered from old to new
+type MessageTree struct {
+	Nodes []MessageTreeNode `json:"nodes"`
+	// RootIDs are the messages without parent
+	RootIDs []uuid.UUID `json:"root_ids"`
+	// LeafIDs are the messages without children, the head of every branch
+	LeafIDs []uuid.UUID `json:"leaf_ids"`
+}
+
+// GetMessageTree returns how the messages of a session branch from each other
+func (s *sessionService) GetMessageTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*MessageTree, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].ID.String() < msgs[j].ID.String()
+		}
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+
+	tree := &MessageTree{
+		Nodes:   make([]MessageTreeNode, 0, len(msgs)),
+		RootIDs: []uuid.UUID{},
+		LeafIDs: []uuid.UUID{},
+	}
+	index := make(map[uuid.UUID]int, len(msgs))
+	for i, m := range msgs {
+		index[m.ID] = i
+		tree.Nodes = append(tree.Nodes, MessageTreeNode{
+			ID:           m.ID,
+			ParentID:     m.ParentID,
+			Role:         m.Role,
+			ChildIDs:     []uuid.UUID{},
+			SupersededBy: m.SupersededBy,
+			CreatedAt:    m.CreatedAt,
+		})
+	}
+
+	for _, node := range tree.Nodes {
+		if node.ParentID == nil {
+			tree.RootIDs = append(tree.RootIDs, node.ID)
+			continue
+		}
+		if i, ok := index[*node.ParentID]; ok {
+			tree.Nodes[i].ChildIDs = append(tree.Nodes[i].ChildIDs, node.ID)
+		}
+	}
+	for _, node := range tree.Nodes {
+		if len(node.ChildIDs) == 0 {
+			tree.LeafIDs = append(tree.LeafIDs, node.ID)
+		}
+	}
+
+	return tree, nil
+}
+
+type DeleteMessageOutput struct {
+	// RelinkedChildren is the number of children of the message now following its parent
+	RelinkedChildren int64 `json:"relinked_children"`
+}
+
+// DeleteMessage deletes a message of a session, its children follow its parent instead so no branch is lost
+func (s *sessionService) DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (*DeleteMessageOutput, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	relinked, err := s.sessionRepo.DeleteMessage(ctx, projectID, sessionID, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &DeleteMessageOutput{RelinkedChildren: relinked}, nil
+}
+
+// MessageChainReport lists the messages of a session whose parent links break the reconstruction of its threads
+type MessageChainReport struct {
+	Messages int `json:"messages"`
+	// Roots are the messages without parent, the messages of a consistent session descend from a single root
+	Roots []uuid.UUID `json:"roots"`
+	// Orphans are the messages whose parent is not a message of the session
+	Orphans []uuid.UUID `json:"orphans"`
+	// Cycles are the messages whose chain of parents loops instead of reaching a root
+	Cycles []uuid.UUID `json:"cycles"`
+	// DanglingSupersessions are the messages superseded by a message that is not in the session
+	DanglingSupersessions []uuid.UUID `json:"dangling_supersessions"`
+	Consistent            bool        `json:"consistent"`
+}
+
+// CheckMessageChains checks that the messages of a session form a tree: a single root, every parent in the session
+// and no loop. Sessions whose first messages predate parent links have several roots.
+func (s *sessionService) CheckMessageChains(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*MessageChainReport, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	return checkMessageChains(msgs), nil
+}
+
+func checkMessageChains(msgs []model.Message) *MessageChainReport {
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].ID.String() < msgs[j].ID.String()
+		}
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+
+	report := &MessageChainReport{
+		Messages:              len(msgs),
+		Roots:                 []uuid.UUID{},
+		Orphans:               []uuid.UUID{},
+		Cycles:                []uuid.UUID{},
+		DanglingSupersessions: []uuid.UUID{},
+	}
+	parents := make(map[uuid.UUID]*uuid.UUID, len(msgs))
+	for _, m := range msgs {
+		parents[m.ID] = m.ParentID
+	}
+
+	// A message reaches a root, an orphan, or loops; the outcome of each chain is kept for the messages it goes through
+	const (
+		reachesEnd = iota + 1
+		loops
+	)
+	outcome := make(map[uuid.UUID]int, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case m.ParentID == nil:
+			report.Roots = append(report.Roots, m.ID)
+		case !hasMessage(parents, *m.ParentID):
+			report.Orphans = append(report.Orphans, m.ID)
+		}
+		if m.SupersededBy != nil && !hasMessage(parents, *m.SupersededBy) {
+			report.DanglingSupersessions = append(report.DanglingSupersessions, m.ID)
+		}
+
+		var chain []uuid.UUID
+		onChain := map[uuid.UUID]bool{}
+		result := reachesEnd
+		for id := m.ID; ; {
+			if o, ok := outcome[id]; ok {
+				result = o
+				break
+			}
+			if onChain[id] {
+				result = loops
+				break
+			}
+			onChain[id] = true
+			chain = append(chain, id)
+			parent := parents[id]
+			if parent == nil || !hasMessage(parents, *parent) {
+				break
+			}
+			id = *parent
+		}
+		for _, id := range chain {
+			outcome[id] = result
+		}
+		if result == loops {
+			report.Cycles = append(report.Cycles, m.ID)
+		}
+	}
+
+	report.Consistent = len(report.Roots) <= 1 && len(report.Orphans) == 0 && len(report.Cycles) == 0 && len(report.DanglingSupersessions) == 0
+	return report
+}
+
+func hasMessage(parents map[uuid.UUID]*uuid.UUID, id uuid.UUID) bool {
+	_, ok := parents[id]
+	return ok
+}
+
+// ModelUsage is the token usage of a session attributed to one model, Model is empty for usage reported without one
+type ModelUsage struct {
+	Model            string `json:"model"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	Messages         int64  `json:"messages"`
+}
+
+// SessionUsage is the token usage reported on the messages of a session
+type SessionUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	// Messages is how many messages reported usage
+	Messages int64        `json:"messages"`
+	ByModel  []ModelUsage `json:"by_model"`
+	// Feedback totals the annotations of the messages of the session
+	Feedback SessionFeedback `json:"feedback"`
+}
+
+type SessionFeedback struct {
+	Annotations int64            `json:"annotations"`
+	ThumbsUp    int64            `json:"thumbs_up"`
+	ThumbsDown  int64            `json:"thumbs_down"`
+	Labels      map[string]int64 `json:"labels"`
+	// AvgScore is the average score of the annotations with one, null without any
+	AvgScore *float64 `json:"avg_score"`
+}
+
+// GetUsage totals the token usage reported on the messages of a session, overall and per model
+func (s *sessionService) GetUsage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*SessionUsage, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	rows, err := s.sessionRepo.SumUsageByModel(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("sum message usage: %w", err)
+	}
+
+	usage := &SessionUsage{ByModel: make([]ModelUsage, 0, len(rows))}
+	for _, r := range rows {
+		usage.PromptTokens += r.PromptTokens
+		usage.CompletionTokens += r.CompletionTokens
+		usage.Messages += r.Messages
+		usage.ByModel = append(usage.ByModel, ModelUsage{
+			Model:            r.Model,
+			PromptTokens:     r.PromptTokens,
+			CompletionTokens: r.CompletionTokens,
+			TotalTokens:      r.PromptTokens + r.CompletionTokens,
+			Messages:         r.Messages,
+		})
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	counts, err := s.sessionRepo.SumAnnotations(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("sum message annotations: %w", err)
+	}
+	usage.Feedback = sessionFeedback(counts)
+	return usage, nil
+}
+
+func sessionFeedback(counts []repo.AnnotationCount) SessionFeedback {
+	fb := SessionFeedback{Labels: map[string]int64{}}
+	var scored int64
+	var scoreSum float64
+	for _, c := range counts {
+		fb.Annotations += c.Annotations
+		switch c.Reaction {
+		case model.AnnotationReactionUp:
+			fb.ThumbsUp += c.Annotations
+		case model.AnnotationReactionDown:
+			fb.ThumbsDown += c.Annotations
+		}
+		if c.Label != "" {
+			fb.Labels[c.Label] += c.Annotations
+		}
+		scored += c.Scored
+		scoreSum += c.ScoreSum
+	}
+	if scored > 0 {
+		avg := scoreSum / float64(scored)
+		fb.AvgScore = &avg
+	}
+	return fb
+}
+
+const (
+	// ContextStrategyRecent keeps the newest messages that fit the budget
+	ContextStrategyRecent = "recent"
+	// ContextStrategySummary also replaces the dropped messages with a summary message
+	ContextStrategySummary = "summary"
+
+	// contextSummaryShare is the part of the budget reserved for the summary of the dropped messages
+	contextSummaryShare = 4
+	// contextSummarySnippetRunes bounds how much of each dropped message the summary quotes
+	contextSummarySnippetRunes = 200
+)
+
+type GetContextWindowInput struct {
+	SessionID          uuid.UUID
+	MaxTokens          int
+	Strategy           string
+	WithAssetPublicURL bool
+	AssetExpire        time.Duration
+	// MaxTurns limits the window to the last turns of the branch, 0 keeps all
+	MaxTurns int
+	// KeepPinned keeps the messages with meta.pinned whatever their age, before filling the budget with the newest messages
+	KeepPinned bool
+}
+
+// ContextWindow is the tail of the current branch of a session that fits a token budget
+type ContextWindow struct {
+	Messages   []model.Message
+	PublicURLs map[string]PublicURL
+	// Tokens is the token count of the text and tool parts of Messages
+	Tokens int
+	// TotalMessages is how many messages the current branch has
+	TotalMessages int
+	// DroppedMessages is how many messages of the branch were left out
+	DroppedMessages int
+	// Truncated is set when the newest message was cut to fit
+	Truncated bool
+	// Summarized is set when a summary message stands in for the dropped messages
+	Summarized bool
+}
+
+// GetContextWindow returns the newest messages of the current branch that fit in MaxTokens, ordered from old to new.
+// Leading system messages are always kept, as are pinned messages with KeepPinned, and with the summary strategy
+// the dropped messages are replaced by a single user message quoting them.
+func (s *sessionService) GetContextWindow(ctx context.Context, in GetContextWindowInput) (*ContextWindow, error) {
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	window := &ContextWindow{Messages: []model.Message{}}
+	if len(msgs) == 0 {
+		return window, nil
+	}
+
+	branch := currentBranch(msgs)
+	window.TotalMessages = len(branch)
+
+	if err := s.loadPartsForMessages(ctx, branch); err != nil {
+		return nil, err
+	}
+	tokens := make([]int, len(branch))
+	for i := range branch {
+		if tokens[i], err = contextMessageTokens(branch[i].Parts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Leading system messages hold the instructions, they are never dropped
+	pinned := 0
+	budget := in.MaxTokens
+	for pinned < len(branch) && branch[pinned].Role == "system" {
+		budget -= tokens[pinned]
+		pinned++
+	}
+	if budget < 0 {
+		return nil, ErrContextBudgetTooSmall
+	}
+	rest, restTokens := branch[pinned:], tokens[pinned:]
+
+	// Messages pinned by the client come next, whatever their age
+	kept := make(map[int]bool)
+	if in.KeepPinned {
+		for i := range rest {
+			if messagePinned(rest[i]) {
+				kept[i] = true
+				budget -= restTokens[i]
+			}
+		}
+		if budget < 0 {
+			return nil, ErrContextBudgetTooSmall
+		}
+	}
+
+	// The other messages of the last MaxTurns turns are candidates for the tail, older ones are dropped
+	first := 0
+	if in.MaxTurns > 0 {
+		first = lastTurnsStart(rest, in.MaxTurns)
+	}
+	older := []model.Message{}
+	for i := 0; i < first; i++ {
+		if !kept[i] {
+			older = append(older, rest[i])
+		}
+	}
+	var candidates []model.Message
+	var candidateTokens, candidatePos []int
+	for i := first; i < len(rest); i++ {
+		if !kept[i] {
+			candidates = append(candidates, rest[i])
+			candidateTokens = append(candidateTokens, restTokens[i])
+			candidatePos = append(candidatePos, i)
+		}
+	}
+
+	start, used, truncated, err := fitContextTail(candidates, candidateTokens, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary *model.Message
+	summaryTokens := 0
+	if in.Strategy == ContextStrategySummary && len(older)+start > 0 {
+		// Make room for the summary, then summarize everything that no longer fits
+		reserve := budget / contextSummaryShare
+		if start, used, truncated, err = fitContextTail(candidates, candidateTokens, budget-reserve); err != nil {
+			return nil, err
+		}
+		dropped := append(append([]model.Message{}, older...), candidates[:start]...)
+		if summary, summaryTokens, err = summarizeDropped(dropped, reserve); err != nil {
+			return nil, err
+		}
+	}
+
+	// Pinned messages older than the tail precede the summary, newer ones keep their place in the tail
+	tailFrom := len(rest)
+	if start < len(candidates) {
+		tailFrom = candidatePos[start]
+	}
+	window.Messages = append(window.Messages, branch[:pinned]...)
+	window.Tokens = in.MaxTokens - budget
+	for i := 0; i < tailFrom; i++ {
+		if kept[i] {
+			window.Messages = append(window.Messages, rest[i])
+		}
+	}
+	if summary != nil {
+		window.Messages = append(window.Messages, *summary)
+		window.Tokens += summaryTokens
+		window.Summarized = true
+	}
+	tail := truncatedTail(candidates[start:], truncated)
+	for i, next := tailFrom, 0; i < len(rest); i++ {
+		if kept[i] {
+			window.Messages = append(window.Messages, rest[i])
+		} else {
+			window.Messages = append(window.Messages, tail[next])
+			next++
+		}
+	}
+	window.Tokens += used
+	window.DroppedMessages = len(older) + start
+	window.Truncated = truncated != nil
+
+	if in.WithAssetPublicURL && s.s3 != nil {
+		if window.PublicURLs, err = s.presignPartAssets(ctx, window.Messages, in.AssetExpire); err != nil {
+			return nil, err
+		}
+	}
+	return window, nil
+}
+
+// messagePinned reports whether the client pinned the message with meta.pinned
+func messagePinned(m model.Message) bool {
+	pinned, _ := m.Meta.Data()[model.MessageMetaPinned].(bool)
+	return pinned
+}
+
+// lastTurnsStart returns the index of the first message of the last n turns of msgs, or 0 when msgs has fewer turns.
+// A turn starts at a user message that is not only tool results.
+func lastTurnsStart(msgs []model.Message, n int) int {
+	turns := 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != "user" {
+			continue
+		}
+		for _, p := range msgs[i].Parts {
+			if p.Type != "tool-result" {
+				turns++
+				break
+			}
+		}
+		if turns == n {
+			return i
+		}
+	}
+	return 0
+}
+
+// contextMessageTokens counts the tokens of the text, tool-call and tool-result parts of a message
+func contextMessageTokens(parts []model.Part) (int, error) {
+	total := 0
+	for _, p := range parts {
+		n, err := contextPartTokens(p)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func contextPartTokens(p model.Part) (int, error) {
+	text := p.Text
+	if p.Type != "tool-result" {
+		// Same rendering as the session token counts
+		content, err := tokenizer.ExtractTextAndToolContent([]model.Part{p})
+		if err != nil {
+			return 0, err
+		}
+		text = content
+	}
+	if text == "" {
+		return 0, nil
+	}
+	return tokenizer.CountTokens(text)
+}
+
+// fitContextTail returns where the newest messages fitting in budget start and their token count.
+// If not even the newest message fits, it is cut to the budget and returned as truncated.
+// Tool results whose tool call was dropped are left out of the window as well.
+func fitContextTail(msgs []model.Message, tokens []int, budget int) (int, int, *model.Message, error) {
+	start, used := len(msgs), 0
+	for start > 0 && used+tokens[start-1] <= budget {
+		start--
+		used += tokens[start]
+	}
+
+	var truncated *model.Message
+	if start == len(msgs) && start > 0 && budget > 0 {
+		cut, n, err := truncateMessage(msgs[start-1], budget)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if len(cut.Parts) > 0 {
+			start--
+			truncated, used = &cut, n
+		}
+	}
+
+	for start < len(msgs) && isToolResultOnly(msgs[start]) && (truncated == nil || start < len(msgs)-1) {
+		used -= tokens[start]
+		start++
+	}
+	return start, used, truncated, nil
+}
+
+// truncateMessage keeps the parts of msg that fit in budget in order, cutting the first text part that doesn't
+func truncateMessage(msg model.Message, budget int) (model.Message, int, error) {
+	parts := []model.Part{}
+	used := 0
+	for _, p := range msg.Parts {
+		n, err := contextPartTokens(p)
+		if err != nil {
+			return msg, 0, err
+		}
+		if used+n <= budget {
+			parts = append(parts, p)
+			used += n
+			continue
+		}
+		if p.Type == "text" && used < budget {
+			text, err := tokenizer.TruncateTokens(p.Text, budget-used)
+			if err != nil {
+				return msg, 0, err
+			}
+			p.Text = text
+			parts = append(parts, p)
+			used = budget
+		}
+		break
+	}
+	msg.Parts = parts
+	return msg, used, nil
+}
+
+// truncatedTail replaces the newest message of tail with its truncated copy
+func truncatedTail(tail []model.Message, truncated *model.Message) []model.Message {
+	if truncated == nil || len(tail) == 0 {
+		return tail
+	}
+	out := append([]model.Message{}, tail...)
+	out[len(out)-1] = *truncated
+	return out
+}
+
+func isToolResultOnly(msg model.Message) bool {
+	if len(msg.Parts) == 0 {
+		return false
+	}
+	for _, p := range msg.Parts {
+		if p.Type != "tool-result" {
+			return false
+		}
+	}
+	return true
+}
+
+// summarizeDropped quotes the start of each dropped message, keeping the newest quotes that fit in budget
+func summarizeDropped(dropped []model.Message, budget int) (*model.Message, int, error) {
+	if len(dropped) == 0 {
+		return nil, 0, nil
+	}
+
+	header := fmt.Sprintf("Summary of %d earlier messages that are not included in full:", len(dropped))
+	used, err := tokenizer.CountTokens(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	if used > budget {
+		return nil, 0, nil
+	}
+
+	lines := []string{}
+	for i := len(dropped) - 1; i >= 0; i-- {
+		text := strings.Join(strings.Fields(syncMessageText(dropped[i].Parts)), " ")
+		if text == "" {
+			continue
+		}
+		if runes := []rune(text); len(runes) > contextSummarySnippetRunes {
+			text = string(runes[:contextSummarySnippetRunes]) + "..."
+		}
+		line := fmt.Sprintf("- %s: %s", dropped[i].Role, text)
+		n, err := tokenizer.CountTokens(line)
+		if err != nil {
+			return nil, 0, err
+		}
+		if used+n > budget {
+			break
+		}
+		lines = append(lines, line)
+		used += n
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return &model.Message{
+		SessionID: dropped[0].SessionID,
+		Role:      "user",
+		Meta:      datatypes.NewJSONType(map[string]any{"context_summary": true}),
+		Parts:     []model.Part{{Type: "text", Text: strings.Join(append([]string{header}, lines...), "\n")}},
+		CreatedAt: dropped[len(dropped)-1].CreatedAt,
+	}, used, nil
+}
+
+// SessionSummary is the rolling summary the summarization worker keeps for a session
+type SessionSummary struct {
+	SessionID uuid.UUID `json:"session_id"`
+	// Summary is empty until the session has enough messages to be summarized
+	Summary string `json:"summary"`
+	// MessageID is the last message covered by the summary
+	MessageID *uuid.UUID `json:"message_id"`
+	// SummarizedMessages is how many messages of the current branch the summary covers
+	SummarizedMessages int        `json:"summarized_messages"`
+	UpdatedAt          *time.Time `json:"updated_at"`
+}
+
+func (s *sessionService) GetSummary(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*SessionSummary, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != projectID {
+		return nil, ErrSessionNotFound
+	}
+
+	return &SessionSummary{
+		SessionID:          ss.ID,
+		Summary:            ss.Summary,
+		MessageID:          ss.SummaryMessageID,
+		SummarizedMessages: ss.SummaryMessages,
+		UpdatedAt:          ss.SummaryUpdatedAt,
+	}, nil
+}
+
+type ListSessionEventsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	Kind      string    `json:"kind"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+type ListSessionEventsOutput struct {
+	Items      []model.SessionEvent `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	HasMore    bool                 `json:"has_more"`
+}
+
+// ListEvents lists the lifecycle events of a session of the project
+func (s *sessionService) ListEvents(ctx context.Context, in ListSessionEventsInput) (*ListSessionEventsOutput, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if ss.ProjectID != in.ProjectID {
+		return nil, ErrSessionNotFound
+	}
+
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the beginning
+	var afterT time.Time
+	var afterID uuid.UUID
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	items, err := s.sessionRepo.ListEventsWithCursor(ctx, in.SessionID, in.Kind, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListSessionEventsOutput{Items: items}
+	if len(items) > in.Limit {
+		out.HasMore = true
+		out.Items = items[:in.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return out, nil
+}
+
+type ForkSessionInput struct {
+	ProjectID uuid.UUID
+	SessionID uuid.UUID
+	// WithMessages copies the messages of the session into the fork
+	WithMessages bool
+	// UpToMessageID limits the copied messages to the branch ending at this message
+	UpToMessageID *uuid.UUID
+}
+
+// Fork clones a session and optionally its messages into a new session of the same project.
+// The fork is not connected to a space, so its messages are not learned twice.
+func (s *sessionService) Fork(ctx context.Context, in ForkSessionInput) (*model.Session, error) {
+	src, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if src.ProjectID != in.ProjectID {
+		return nil, ErrSessionNotFound
+	}
+
+	var msgs []model.Message
+	if in.WithMessages {
+		msgs, err = s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list messages: %w", err)
+		}
+		sort.Slice(msgs, func(i, j int) bool {
+			if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+				return msgs[i].ID.String() < msgs[j].ID.String()
+			}
+			return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+		})
+
+		if in.UpToMessageID != nil {
+			msgs = messageBranch(msgs, *in.UpToMessageID)
+			if len(msgs) == 0 {
+				return nil, ErrForkMessageNotFound
+			}
+		}
+	}
+
+	fork := &model.Session{
+		ProjectID:   src.ProjectID,
+		Configs:     src.Configs,
+		Title:       src.Title,
+		Description: src.Description,
+		Tags:        src.Tags,
+		EndUserID:   src.EndUserID,
+	}
+	if err := s.sessionRepo.Fork(ctx, fork, msgs); err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+// exportBatchSize is the number of messages of an export whose parts are held in memory at once
+const exportBatchSize = 100
+
+type ExportSessionInput struct {
+	ProjectID          uuid.UUID
+	SessionID          uuid.UUID
+	WithAssetPublicURL bool
+	AssetExpire        time.Duration
+	// AfterMessageID resumes an interrupted export after that message of the branch
+	AfterMessageID *uuid.UUID
+}
+
+// SessionExport is a batch of the messages of an export with their parts
+type SessionExport struct {
+	Messages   []model.Message
+	PublicURLs map[string]PublicURL
+}
+
+// Export streams the current branch of a session to fn in batches of messages ordered from old to new, and returns
+// the number of exported messages. The parts of a batch are loaded right before fn is called and released after, so
+// the memory of an export does not grow with the session. Parts truncated on ingest are exported with their full text.
+// Errors found before the first batch are returned without calling fn.
+func (s *sessionService) Export(ctx context.Context, in ExportSessionInput, fn func(batch *SessionExport) error) (int, error) {
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrSessionNotFound
+		}
+		return 0, err
+	}
+	if ss.ProjectID != in.ProjectID {
+		return 0, ErrSessionNotFound
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list messages: %w", err)
+	}
+	var branch []model.Message
+	if len(msgs) > 0 {
+		branch = currentBranch(msgs)
+	}
+	if in.AfterMessageID != nil {
+		i := slices.IndexFunc(branch, func(m model.Message) bool { return m.ID == *in.AfterMessageID })
+		if i < 0 {
+			return 0, ErrExportCursorNotFound
+		}
+		branch = branch[i+1:]
+	}
+
+	for start := 0; start < len(branch); start += exportBatchSize {
+		batch := &SessionExport{Messages: branch[start:min(start+exportBatchSize, len(branch))]}
+		if err := s.loadPartsForMessages(ctx, batch.Messages); err != nil {
+			return start, err
+		}
+		// an export holds the full outputs, not the previews kept on ingest
+		if err := s.expandTruncatedParts(ctx, batch.Messages); err != nil {
+			return start, err
+		}
+		if in.WithAssetPublicURL && s.s3 != nil {
+			if batch.PublicURLs, err = s.presignPartAssets(ctx, batch.Messages, in.AssetExpire); err != nil {
+				return start, err
+			}
+		}
+		if err := fn(batch); err != nil {
+			return start, err
+		}
+		for i := range batch.Messages {
+			batch.Messages[i].Parts = nil
+		}
+	}
+	return len(branch), nil
+}
+
+// currentBranch returns the branch ending at the latest message of msgs, which new messages are chained to
+func currentBranch(msgs []model.Message) []model.Message {
+	latest := msgs[0]
+	for _, m := range msgs[1:] {
+		if m.CreatedAt.After(latest.CreatedAt) || (m.CreatedAt.Equal(latest.CreatedAt) && m.ID.String() > latest.ID.String()) {
+			latest = m
+		}
+	}
+	return messageBranch(msgs, latest.ID)
+}
+
+// messageBranch returns the messages from the root to leafID following parent links, ordered from old to new.
+// It returns nil if leafID is not among msgs.
+func messageBranch(msgs []model.Message, leafID uuid.UUID) []model.Message {
+	byID := make(map[uuid.UUID]model.Message, len(msgs))
+	for _, m := range msgs {
+		byID[m.ID] = m
+	}
+
+	branch := []model.Message{}
+	for id := &leafID; id != nil && len(branch) < len(msgs); {
+		m, ok := byID[*id]
+		if !ok {
+			break
+		}
+		branch = append(branch, m)
+		id = m.ParentID
+	}
+	if len(branch) == 0 {
+		return nil
+	}
+
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"html/template"
+	"io"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type ArchiveSessionsInput struct {
+	ProjectID  uuid.UUID
+	SessionIDs []uuid.UUID
+}
+
+// ArchiveManifest is the manifest.json of an archive, with the checksum of every other file of the archive
+type ArchiveManifest struct {
+	ProjectID  uuid.UUID                `json:"project_id"`
+	ExportedAt time.Time                `json:"exported_at"`
+	Sessions   []ArchiveManifestSession `json:"sessions"`
+	Files      []ArchiveManifestFile    `json:"files"`
+}
+
+type ArchiveManifestSession struct {
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Path     string    `json:"path"`
+	Messages int       `json:"messages"`
+}
+
+type ArchiveManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	SizeB  int64  `json:"size_b"`
+}
+
+// Archive writes a self-contained zip of the current branch of sessions for retention outside of Acontext: an
+// index.html linking to a transcript sessions/<id>.html per session, the assets of the messages under assets/ and a
+// manifest.json with the SHA-256 of every file. It returns the number of archived messages. The sessions are checked
+// before anything is written, so ErrSessionNotFound leaves w untouched; a later failure truncates the zip.
+func (s *sessionService) Archive(ctx context.Context, in ArchiveSessionsInput, w io.Writer) (int, error) {
+	sessions := make([]*model.Session, 0, len(in.SessionIDs))
+	for _, id := range in.SessionIDs {
+		ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: id})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+			}
+			return 0, err
+		}
+		if ss.ProjectID != in.ProjectID {
+			return 0, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+		}
+		sessions = append(sessions, ss)
+	}
+
+	a := &sessionArchive{
+		zw:     zip.NewWriter(w),
+		assets: make(map[string]bool),
+		manifest: ArchiveManifest{
+			ProjectID:  in.ProjectID,
+			ExportedAt: time.Now().UTC(),
+			Sessions:   []ArchiveManifestSession{},
+			Files:      []ArchiveManifestFile{},
+		},
+	}
+	total := 0
+	for _, ss := range sessions {
+		n, err := s.archiveSession(ctx, a, ss)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+
+	f, err := a.create("index.html")
+	if err != nil {
+		return total, err
+	}
+	if err := archiveTemplates.ExecuteTemplate(f, "index", a.manifest); err != nil {
+		return total, err
+	}
+	a.closeFile()
+
+	fw, err := a.zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: a.manifest.ExportedAt})
+	if err != nil {
+		return total, err
+	}
+	if err := sonic.ConfigDefault.NewEncoder(fw).Encode(a.manifest); err != nil {
+		return total, err
+	}
+	return total, a.zw.Close()
+}
+
+// archiveSession writes the transcript of a session, then the assets it links to that are not in the archive yet
+func (s *sessionService) archiveSession(ctx context.Context, a *sessionArchive, ss *model.Session) (int, error) {
+	name := "sessions/" + ss.ID.String() + ".html"
+	f, err := a.create(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := archiveTemplates.ExecuteTemplate(f, "session-head", map[string]any{"Session": ss, "ExportedAt": a.manifest.ExportedAt}); err != nil {
+		return 0, err
+	}
+
+	// Only one file of a zip is written at a time, so the assets wait for the end of the transcript
+	var pending []archiveAsset
+	n, err := s.Export(ctx, ExportSessionInput{ProjectID: ss.ProjectID, SessionID: ss.ID}, func(batch *SessionExport) error {
+		for _, m := range batch.Messages {
+			msg := archiveMessage{ID: m.ID, Role: m.Role, CreatedAt: m.CreatedAt}
+			for _, p := range m.Parts {
+				part := archivePart{Type: p.Type, Text: p.Text, Filename: p.Filename}
+				if len(p.Meta) > 0 {
+					meta, err := sonic.ConfigDefault.MarshalIndent(p.Meta, "", "  ")
+					if err != nil {
+						return err
+					}
+					part.Meta = string(meta)
+				}
+				if p.Asset != nil && s.s3 != nil {
+					part.MIME = p.Asset.MIME
+					part.AssetPath = archiveAssetPath(p)
+					if !a.assets[part.AssetPath] {
+						a.assets[part.AssetPath] = true
+						pending = append(pending, archiveAsset{path: part.AssetPath, key: p.Asset.S3Key})
+					}
+				}
+				msg.Parts = append(msg.Parts, part)
+			}
+			if err := archiveTemplates.ExecuteTemplate(f, "message", msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := archiveTemplates.ExecuteTemplate(f, "session-foot", nil); err != nil {
+		return n, err
+	}
+	a.closeFile()
+	a.manifest.Sessions = append(a.manifest.Sessions, ArchiveManifestSession{ID: ss.ID, Title: ss.Title, Path: name, Messages: n})
+
+	for _, asset := range pending {
+		if err := a.copyAsset(ctx, s, asset); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// archiveExt is an extension of an asset file name kept in the archive
+var archiveExt = regexp.MustCompile(`^\.[A-Za-z0-9]{1,10}$`)
+
+// archiveAssetPath names an asset by its content, with the extension of its file name so it opens in a browser
+func archiveAssetPath(p model.Part) string {
+	name := "assets/" + p.Asset.SHA256
+	if ext := path.Ext(p.Filename); archiveExt.MatchString(ext) {
+		name += ext
+	}
+	return name
+}
+
+type archiveAsset struct {
+	path string
+	key  string
+}
+
+type archiveMessage struct {
+	ID        uuid.UUID
+	Role      string
+	CreatedAt time.Time
+	Parts     []archivePart
+}
+
+type archivePart struct {
+	Type      string
+	Text      string
+	Filename  string
+	MIME      string
+	AssetPath string
+	Meta      string
+}
+
+// sessionArchive is the zip of an archive being written, with the checksums of the files written so far
+type sessionArchive struct {
+	zw       *zip.Writer
+	cur      *archiveFile
+	assets   map[string]bool
+	manifest ArchiveManifest
+}
+
+// archiveFile is a file of the zip that hashes what is written to it
+type archiveFile struct {
+	path string
+	w    io.Writer
+	h    hash.Hash
+	n    int64
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.h.Write(p[:n])
+	f.n += int64(n)
+	return n, err
+}
+
+func (a *sessionArchive) create(name string) (*archiveFile, error) {
+	a.closeFile()
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.manifest.ExportedAt})
+	if err != nil {
+		return nil, err
+	}
+	a.cur = &archiveFile{path: name, w: w, h: sha256.New()}
+	return a.cur, nil
+}
+
+// closeFile adds the file being written to the manifest
+func (a *sessionArchive) closeFile() {
+	if a.cur == nil {
+		return
+	}
+	a.manifest.Files = append(a.manifest.Files, ArchiveManifestFile{
+		Path:   a.cur.path,
+		SHA256: hex.EncodeToString(a.cur.h.Sum(nil)),
+		SizeB:  a.cur.n,
+	})
+	a.cur = nil
+}
+
+func (a *sessionArchive) copyAsset(ctx context.Context, s *sessionService, asset archiveAsset) error {
+	r, err := s.s3.OpenFile(ctx, asset.key)
+	if err != nil {
+		return fmt.Errorf("open asset %s: %w", asset.key, err)
+	}
+	defer r.Close()
+	f, err := a.create(asset.path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("copy asset %s: %w", asset.key, err)
+	}
+	a.closeFile()
+	return nil
+}
+
+var archiveTemplates = template.Must(template.New("archive").Parse(`
+{{- define "style"}}<style>
+body{font-family:system-ui,sans-serif;max-width:860px;margin:2em auto;padding:0 1em;color:#222}
+.message{border:1px solid #ddd;border-radius:6px;margin:1em 0;padding:.5em 1em}
+.role{font-weight:bold;text-transform:capitalize}.meta{color:#777;font-size:.85em}
+.user{background:#f5f9ff}.system{background:#f7f7f7}
+.text{white-space:pre-wrap}pre{background:#f4f4f4;padding:.5em;overflow-x:auto}
+img,video{max-width:100%}table{border-collapse:collapse}td,th{border:1px solid #ddd;padding:.3em .6em;text-align:left}
+</style>{{end}}
+
+{{- define "index"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Acontext archive</title>{{template "style"}}</head><body>
+<h1>Acontext archive</h1>
+<p class="meta">Project {{.ProjectID}}, exported at {{.ExportedAt.Format "2006-01-02T15:04:05Z07:00"}}. The checksums of the files are in manifest.json.</p>
+<table><tr><th>Session</th><th>ID</th><th>Messages</th></tr>
+{{- range .Sessions}}
+<tr><td><a href="{{.Path}}">{{if .Title}}{{.Title}}{{else}}(untitled){{end}}</a></td><td>{{.ID}}</td><td>{{.Messages}}</td></tr>
+{{- end}}
+</table>
+</body></html>
+{{end}}
+
+{{- define "session-head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{if .Session.Title}}{{.Session.Title}}{{else}}Session {{.Session.ID}}{{end}}</title>{{template "style"}}</head><body>
+<p><a href="../index.html">Archive</a></p>
+<h1>{{if .Session.Title}}{{.Session.Title}}{{else}}Session {{.Session.ID}}{{end}}</h1>
+<p class="meta">Session {{.Session.ID}}, created at {{.Session.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}, exported at {{.ExportedAt.Format "2006-01-02T15:04:05Z07:00"}}</p>
+{{- if .Session.Description}}
+<p>{{.Session.Description}}</p>
+{{- end}}
+{{end}}
+
+{{- define "message"}}
+<div class="message {{.Role}}" id="{{.ID}}">
+<div><span class="role">{{.Role}}</span> <span class="meta">{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}} · {{.ID}}</span></div>
+{{- range .Parts}}
+{{- if eq .Type "text"}}
+<div class="text">{{.Text}}</div>
+{{- else if .AssetPath}}
+{{- if eq .Type "image"}}
+<p><img src="../{{.AssetPath}}" alt="{{.Filename}}"></p>
+{{- else if eq .Type "audio"}}
+<p><audio controls src="../{{.AssetPath}}"></audio></p>
+{{- else if eq .Type "video"}}
+<p><video controls src="../{{.AssetPath}}"></video></p>
+{{- else}}
+<p><a href="../{{.AssetPath}}">{{if .Filename}}{{.Filename}}{{else}}{{.AssetPath}}{{end}}</a> <span class="meta">{{.MIME}}</span></p>
+{{- end}}
+{{- else}}
+<div class="meta">{{.Type}}{{if .Filename}} {{.Filename}}{{end}}</div>
+{{- end}}
+{{- if .Meta}}
+<pre>{{.Meta}}</pre>
+{{- end}}
+{{- end}}
+</div>
+{{end}}
+
+{{- define "session-foot"}}
+</body></html>
+{{end}}
+`))
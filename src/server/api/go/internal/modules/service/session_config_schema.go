@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrInvalidSessionConfigSchema = errors.New("invalid session config schema")
+	ErrInvalidSessionConfigs      = errors.New("invalid session configs")
+)
+
+type SessionConfigSchemaService interface {
+	Get(ctx context.Context, project *model.Project) *model.SessionConfigSchema
+	Update(ctx context.Context, project *model.Project, schema *model.SessionConfigSchema) (*model.SessionConfigSchema, error)
+}
+
+type sessionConfigSchemaService struct {
+	r repo.ProjectRepo
+}
+
+func NewSessionConfigSchemaService(r repo.ProjectRepo) SessionConfigSchemaService {
+	return &sessionConfigSchemaService{r: r}
+}
+
+// Get returns the schema of the session configs of the project, nil when configs are not validated
+func (s *sessionConfigSchemaService) Get(ctx context.Context, project *model.Project) *model.SessionConfigSchema {
+	return project.SessionConfigSchema()
+}
+
+// Update replaces the schema of the session configs of the project, a nil schema stops validating them.
+// The configs of existing sessions are not checked again.
+func (s *sessionConfigSchemaService) Update(ctx context.Context, project *model.Project, schema *model.SessionConfigSchema) (*model.SessionConfigSchema, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if schema == nil {
+		delete(configs, model.ProjectSessionConfigSchemaKey)
+	} else {
+		if schema.Schema == nil {
+			return nil, fmt.Errorf("%w: schema is required", ErrInvalidSessionConfigSchema)
+		}
+		if t, ok := schema.Schema["type"]; ok && t != "object" {
+			return nil, fmt.Errorf("%w: the type of the configs must be object", ErrInvalidSessionConfigSchema)
+		}
+		if _, err := compileConfigSchema(schema.Schema, schema.Strict); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSessionConfigSchema, err)
+		}
+		configs[model.ProjectSessionConfigSchemaKey] = map[string]interface{}{
+			"schema": schema.Schema,
+			"strict": schema.Strict,
+		}
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectSessionConfigSchemaKey, configs[model.ProjectSessionConfigSchemaKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return project.SessionConfigSchema(), nil
+}
+
+// ValidateSessionConfigs checks the configs of a session against the schema of the project, if it has one
+func ValidateSessionConfigs(project *model.Project, configs map[string]interface{}) error {
+	if project == nil {
+		return nil
+	}
+	schema := project.SessionConfigSchema()
+	if schema == nil {
+		return nil
+	}
+	if configs == nil {
+		configs = map[string]interface{}{}
+	}
+
+	compiled, err := compileConfigSchema(schema.Schema, schema.Strict)
+	if err != nil {
+		// Stored schemas were compiled when set
+		return fmt.Errorf("%w: %v", ErrInvalidSessionConfigSchema, err)
+	}
+	var verr *jsonschema.ValidationError
+	if err := compiled.Validate(configs); errors.As(err, &verr) {
+		var errs []string
+		for _, leaf := range validationLeaves(verr) {
+			errs = append(errs, describeConfigError(schema.Schema, configs, leaf))
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidSessionConfigs, strings.Join(errs, "; "))
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSessionConfigs, err)
+	}
+	return nil
+}
+
+// configSchemaURL names the schema being compiled, schemas cannot reference other documents
+const configSchemaURL = "urn:acontext:session-config-schema"
+
+var configErrorPrinter = message.NewPrinter(language.English)
+
+// noSchemaLoader refuses the $ref of a schema to another document, so that schemas never read files or URLs
+type noSchemaLoader struct{}
+
+func (noSchemaLoader) Load(url string) (any, error) {
+	return nil, fmt.Errorf("cannot load %s, session config schemas must be self-contained", url)
+}
+
+// compileConfigSchema compiles a JSON Schema of session configs. Strict schemas refuse the keys their
+// objects do not declare, see strictSchema.
+func compileConfigSchema(schema map[string]interface{}, strict bool) (*jsonschema.Schema, error) {
+	if strict {
+		schema = strictSchema(schema)
+	}
+	c := jsonschema.NewCompiler()
+	c.UseLoader(noSchemaLoader{})
+	if err := c.AddResource(configSchemaURL, schema); err != nil {
+		return nil, err
+	}
+	return c.Compile(configSchemaURL)
+}
+
+// strictSchema returns a copy of schema refusing additional properties in the objects that declare properties
+// without saying whether others are allowed. It follows properties and items, objects composed with allOf and
+// similar keywords are left as they are since an additionalProperties of their parts would refuse the others.
+func strictSchema(schema map[string]interface{}) map[string]interface{} {
+	out := maps.Clone(schema)
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		strictProps := make(map[string]interface{}, len(props))
+		for name, sub := range props {
+			if sub, ok := sub.(map[string]interface{}); ok {
+				strictProps[name] = strictSchema(sub)
+			} else {
+				strictProps[name] = props[name]
+			}
+		}
+		out["properties"] = strictProps
+		_, additional := schema["additionalProperties"]
+		_, unevaluated := schema["unevaluatedProperties"]
+		_, patterns := schema["patternProperties"]
+		if !additional && !unevaluated && !patterns {
+			out["additionalProperties"] = false
+		}
+	}
+	for _, k := range []string{"items", "additionalProperties"} {
+		if sub, ok := schema[k].(map[string]interface{}); ok {
+			out[k] = strictSchema(sub)
+		}
+	}
+	return out
+}
+
+// validationLeaves returns the errors of err that have no cause, the ones saying what is wrong
+func validationLeaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, validationLeaves(cause)...)
+	}
+	return leaves
+}
+
+// describeConfigError formats a violation at the path of the value in the configs, e.g. configs.tools[1].
+// Unknown keys suggest the declared key they are likely a typo of.
+func describeConfigError(schema map[string]interface{}, configs map[string]interface{}, err *jsonschema.ValidationError) string {
+	at := "configs"
+	var v interface{} = configs
+	for _, tok := range err.InstanceLocation {
+		if list, ok := v.([]interface{}); ok {
+			i, _ := strconv.Atoi(tok)
+			at += fmt.Sprintf("[%d]", i)
+			if i < len(list) {
+				v = list[i]
+			}
+			continue
+		}
+		at += "." + tok
+		if obj, ok := v.(map[string]interface{}); ok {
+			v = obj[tok]
+		}
+	}
+
+	if extra, ok := err.ErrorKind.(*kind.AdditionalProperties); ok {
+		props, _ := schemaAt(schema, err.InstanceLocation)["properties"].(map[string]interface{})
+		msgs := make([]string, 0, len(extra.Properties))
+		for _, key := range extra.Properties {
+			msgs = append(msgs, unknownKey(props, at, key))
+		}
+		return strings.Join(msgs, "; ")
+	}
+	return at + ": " + err.ErrorKind.LocalizedString(configErrorPrinter)
+}
+
+// schemaAt follows properties, items and additionalProperties to the schema of the value at loc, nil if there is none
+func schemaAt(schema map[string]interface{}, loc []string) map[string]interface{} {
+	for _, tok := range loc {
+		if props, ok := schema["properties"].(map[string]interface{}); ok {
+			if sub, ok := props[tok].(map[string]interface{}); ok {
+				schema = sub
+				continue
+			}
+		}
+		if sub, ok := schema["items"].(map[string]interface{}); ok {
+			schema = sub
+			continue
+		}
+		sub, _ := schema["additionalProperties"].(map[string]interface{})
+		schema = sub
+	}
+	return schema
+}
+
+// unknownKey describes a key the schema does not declare, suggesting the declared key it is likely a typo of
+func unknownKey(props map[string]interface{}, at string, key string) string {
+	best, bestDistance := "", 3
+	for _, name := range slices.Sorted(maps.Keys(props)) {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("%s.%s is not a known key, did you mean %s?", at, key, best)
+	}
+	return fmt.Sprintf("%s.%s is not a known key", at, key)
+}
+
+// editDistance is the Levenshtein distance between a and b, in characters
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestSessionConfigSchemaService_Update(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewSessionConfigSchemaService(r)
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Nil(t, svc.Get(ctx, project))
+
+	schema := &model.SessionConfigSchema{Schema: map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"mode"},
+		"properties": map[string]interface{}{
+			"mode":        map[string]interface{}{"enum": []interface{}{"chat", "agent"}},
+			"temperature": map[string]interface{}{"type": "number", "minimum": float64(0), "maximum": float64(2)},
+		},
+	}, Strict: true}
+	out, err := svc.Update(ctx, project, schema)
+	require.NoError(t, err)
+	assert.Equal(t, schema, out)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+	assert.Equal(t, schema, svc.Get(ctx, project))
+
+	for _, invalid := range []map[string]interface{}{
+		{"type": "array"},
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "float"}}},
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"oneOf": []interface{}{}}}},
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"pattern": "("}}},
+		{"type": "object", "required": "mode"},
+		{"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"$ref": "file:///etc/passwd"}}},
+	} {
+		_, err = svc.Update(ctx, project, &model.SessionConfigSchema{Schema: invalid})
+		assert.ErrorIs(t, err, ErrInvalidSessionConfigSchema)
+	}
+	_, err = svc.Update(ctx, project, &model.SessionConfigSchema{})
+	assert.ErrorIs(t, err, ErrInvalidSessionConfigSchema)
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	assert.NotContains(t, r.configs, model.ProjectSessionConfigSchemaKey)
+}
+
+func TestValidateSessionConfigs(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"mode"},
+		"properties": map[string]interface{}{
+			"mode":        map[string]interface{}{"type": "string", "enum": []interface{}{"chat", "agent"}},
+			"temperature": map[string]interface{}{"type": "number", "minimum": float64(0), "maximum": float64(2)},
+			"max_turns":   map[string]interface{}{"type": "integer", "exclusiveMinimum": float64(0)},
+			"tools": map[string]interface{}{
+				"type":     "array",
+				"maxItems": float64(2),
+				"items":    map[string]interface{}{"type": "string", "pattern": "^[a-z_]+$"},
+			},
+			"labels": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "string", "maxLength": float64(3)},
+			},
+		},
+	}
+	project := func(strict bool) *model.Project {
+		return &model.Project{Configs: datatypes.JSONMap{model.ProjectSessionConfigSchemaKey: map[string]interface{}{
+			"schema": schema,
+			"strict": strict,
+		}}}
+	}
+
+	assert.NoError(t, ValidateSessionConfigs(nil, map[string]interface{}{"anything": 1}))
+	assert.NoError(t, ValidateSessionConfigs(&model.Project{}, map[string]interface{}{"anything": 1}))
+
+	valid := map[string]interface{}{
+		"mode":        "agent",
+		"temperature": 0.7,
+		"max_turns":   float64(10),
+		"tools":       []interface{}{"search", "fetch_url"},
+		"labels":      map[string]interface{}{"env": "dev"},
+	}
+	assert.NoError(t, ValidateSessionConfigs(project(true), valid))
+
+	// Unknown keys are kept out of strict mode only
+	typo := map[string]interface{}{"mode": "chat", "temprature": 0.2}
+	assert.NoError(t, ValidateSessionConfigs(project(false), typo))
+	err := ValidateSessionConfigs(project(true), typo)
+	assert.ErrorIs(t, err, ErrInvalidSessionConfigs)
+	assert.ErrorContains(t, err, "configs.temprature is not a known key, did you mean temperature?")
+
+	err = ValidateSessionConfigs(project(false), map[string]interface{}{
+		"mode":        "voice",
+		"temperature": float64(3),
+		"max_turns":   1.5,
+		"tools":       []interface{}{"search", "Fetch", "x"},
+		"labels":      map[string]interface{}{"team": "billing"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidSessionConfigs)
+	for _, want := range []string{
+		"configs.mode: value must be one of 'chat', 'agent'",
+		"configs.temperature: maximum: got 3, want 2",
+		"configs.max_turns: got number, want integer",
+		"configs.tools: maxItems: got 3, want 2",
+		"configs.tools[1]: 'Fetch' does not match pattern '^[a-z_]+$'",
+		"configs.labels.team: maxLength: got 7, want 3",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+
+	assert.ErrorContains(t, ValidateSessionConfigs(project(false), nil), "configs: missing property 'mode'")
+}
+
+func TestValidateSessionConfigs_Composition(t *testing.T) {
+	// Keywords beyond the basic ones are supported, strict mode leaves composed objects as they are
+	schema := map[string]interface{}{
+		"type": "object",
+		"$defs": map[string]interface{}{
+			"model": map[string]interface{}{"type": "string", "minLength": float64(1)},
+		},
+		"properties": map[string]interface{}{
+			"model": map[string]interface{}{"$ref": "#/$defs/model"},
+			"retry": map[string]interface{}{"oneOf": []interface{}{
+				map[string]interface{}{"type": "boolean"},
+				map[string]interface{}{"type": "integer", "minimum": float64(1)},
+			}},
+		},
+		"if":   map[string]interface{}{"required": []interface{}{"retry"}},
+		"then": map[string]interface{}{"required": []interface{}{"model"}},
+	}
+	project := &model.Project{Configs: datatypes.JSONMap{model.ProjectSessionConfigSchemaKey: map[string]interface{}{
+		"schema": schema,
+		"strict": true,
+	}}}
+
+	assert.NoError(t, ValidateSessionConfigs(project, map[string]interface{}{"model": "gpt", "retry": float64(3)}))
+	assert.NoError(t, ValidateSessionConfigs(project, map[string]interface{}{"model": "gpt", "retry": true}))
+
+	err := ValidateSessionConfigs(project, map[string]interface{}{"retry": float64(0)})
+	assert.ErrorIs(t, err, ErrInvalidSessionConfigs)
+	assert.ErrorContains(t, err, "configs: missing property 'model'")
+	assert.ErrorContains(t, err, "configs.retry")
+
+	assert.ErrorContains(t, ValidateSessionConfigs(project, map[string]interface{}{"modle": "gpt"}), "configs.modle is not a known key, did you mean model?")
+}
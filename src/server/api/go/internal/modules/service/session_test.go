@@ -1,17 +1,33 @@
 package service
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/infra/envelope"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockSessionRepo is a mock implementation of SessionRepo
@@ -47,16 +63,21 @@ func (m *MockSessionRepo) CreateMessageWithAssets(ctx context.Context, msg *mode
 	return args.Error(0)
 }
 
-func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
-	args := m.Called(ctx, sessionID, afterT, afterID, limit, timeDesc)
+func (m *MockSessionRepo) CreateTurn(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, roles []string, partTypes []string, asOf time.Time, collapseSuperseded bool, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+	args := m.Called(ctx, sessionID, roles, partTypes, asOf, collapseSuperseded, afterT, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
-func (m *MockSessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
-	args := m.Called(ctx, projectID, spaceID, notConnected, afterCreatedAt, afterID, limit, timeDesc)
+func (m *MockSessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, tag string, titleQuery string, endUserID string, configFilters map[string]string, includeArchived bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
+	args := m.Called(ctx, projectID, spaceID, notConnected, tag, titleQuery, endUserID, configFilters, includeArchived, afterCreatedAt, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -71,6 +92,123 @@ func (m *MockSessionRepo) ListAllMessagesBySession(ctx context.Context, sessionI
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
+func (m *MockSessionRepo) ListMessagesByIDs(ctx context.Context, messageIDs []uuid.UUID) ([]model.Message, error) {
+	args := m.Called(ctx, messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	args := m.Called(ctx, sessionID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) DeleteMessage(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, messageID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, projectID, sessionID, messageID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepo) Fork(ctx context.Context, fork *model.Session, messages []model.Message) error {
+	args := m.Called(ctx, fork, messages)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) SumUsageByModel(ctx context.Context, sessionID uuid.UUID) ([]repo.ModelUsage, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.ModelUsage), args.Error(1)
+}
+
+func (m *MockSessionRepo) UpdateMetadata(ctx context.Context, s *model.Session) error {
+	args := m.Called(ctx, s)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) SetTitleIfEmpty(ctx context.Context, sessionID uuid.UUID, title string) error {
+	args := m.Called(ctx, sessionID, title)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) SetArchived(ctx context.Context, sessionID uuid.UUID, archived bool) error {
+	args := m.Called(ctx, sessionID, archived)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) DeleteMany(ctx context.Context, projectID uuid.UUID, sessionIDs []uuid.UUID) ([]uuid.UUID, error) {
+	args := m.Called(ctx, projectID, sessionIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListIDsBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]uuid.UUID, error) {
+	args := m.Called(ctx, projectID, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockSessionRepo) SumAnnotations(ctx context.Context, sessionID uuid.UUID) ([]repo.AnnotationCount, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.AnnotationCount), args.Error(1)
+}
+
+func (m *MockSessionRepo) SampleMessages(ctx context.Context, projectID uuid.UUID, f repo.MessageSampleFilter, limit int) ([]model.Message, error) {
+	args := m.Called(ctx, projectID, f, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListIdle(ctx context.Context, projectID uuid.UUID, idleSince time.Time, includeArchived bool, limit int) ([]uuid.UUID, error) {
+	args := m.Called(ctx, projectID, idleSince, includeArchived, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockSessionRepo) UpdateSummary(ctx context.Context, sessionID uuid.UUID, fromMessageID *uuid.UUID, summary repo.SessionSummaryUpdate) (bool, error) {
+	args := m.Called(ctx, sessionID, fromMessageID, summary)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListEventsWithCursor(ctx context.Context, sessionID uuid.UUID, kind string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.SessionEvent, error) {
+	args := m.Called(ctx, sessionID, kind, afterCreatedAt, afterID, limit, timeDesc)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SessionEvent), args.Error(1)
+}
+
+func (m *MockSessionRepo) MergeMessageMeta(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, meta map[string]any) error {
+	args := m.Called(ctx, sessionID, messageID, meta)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) SupersedeMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, byID uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, sessionID, messageID, byID, at)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) MessageExists(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, sessionID, messageID)
+	return args.Bool(0), args.Error(1)
+}
+
 // MockAssetReferenceRepo is a mock implementation of AssetReferenceRepo
 type MockAssetReferenceRepo struct {
 	mock.Mock
@@ -96,6 +234,43 @@ func (m *MockAssetReferenceRepo) BatchDecrementAssetRefs(ctx context.Context, pr
 	return args.Error(0)
 }
 
+func (m *MockAssetReferenceRepo) Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	args := m.Called(ctx, projectID, sha256)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error) {
+	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) ListSessionHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]repo.AssetHolder, error) {
+	args := m.Called(ctx, projectID, sha256s)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.AssetHolder), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) ListDiskHolders(ctx context.Context, projectID uuid.UUID, sha256s []string) ([]repo.AssetHolder, error) {
+	args := m.Called(ctx, projectID, sha256s)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.AssetHolder), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) DeleteIfUnreferenced(ctx context.Context, projectID uuid.UUID, sha256 string, referencedBefore time.Time) (bool, error) {
+	args := m.Called(ctx, projectID, sha256, referencedBefore)
+	return args.Bool(0), args.Error(1)
+}
+
 // MockBlobService is a mock implementation of blob service
 type MockBlobService struct {
 	mock.Mock
@@ -464,7 +639,7 @@ func TestSessionService_List(t *testing.T) {
 						ProjectID: projectID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -484,7 +659,7 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   &spaceID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, &spaceID, false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, &spaceID, false, "", "", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -504,7 +679,56 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   nil,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), true, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), true, "", "", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "successful sessions retrieval - filter by tag and title",
+			input: ListSessionsInput{
+				ProjectID: projectID,
+				Tag:       "support",
+				Query:     "refund",
+				Limit:     10,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "support", "refund", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "filter by end user",
+			input: ListSessionsInput{
+				ProjectID: projectID,
+				EndUserID: "user_123",
+				Limit:     10,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "user_123", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "filter by configs",
+			input: ListSessionsInput{
+				ProjectID: projectID,
+				Configs:   map[string]string{"model": "gpt-4o", "flags.beta": "true"},
+				Limit:     10,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "", map[string]string{"model": "gpt-4o", "flags.beta": "true"}, false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "including archived sessions",
+			input: ListSessionsInput{
+				ProjectID:       projectID,
+				IncludeArchived: true,
+				Limit:           10,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "", map[string]string(nil), true, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
 			},
 			wantErr: false,
 		},
@@ -517,7 +741,7 @@ func TestSessionService_List(t *testing.T) {
 				Limit:        10,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
 			},
 			wantErr: false,
 		},
@@ -530,7 +754,7 @@ func TestSessionService_List(t *testing.T) {
 				Limit:        10,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
+				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, "", "", "", map[string]string(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
 			},
 			wantErr: true,
 		},
@@ -722,7 +946,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				TimeDesc:  false,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
 			},
 			wantErr: true,
 		},
@@ -737,7 +961,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -752,7 +976,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -853,7 +1077,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -877,7 +1101,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -901,7 +1125,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -927,7 +1151,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -984,3 +1208,1207 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionService_GetMessages_Filters(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	withTypes := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", PartTypes: datatypes.NewJSONSlice([]string{"text", "tool-call"}), CreatedAt: now}
+	// stored before part types were recorded, its parts cannot be loaded here so it has no matching part
+	legacy := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(time.Second)}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string{"assistant"}, []string{"tool-call"}, time.Time{}, false, time.Time{}, uuid.UUID{}, 11, false).
+		Return([]model.Message{withTypes, legacy}, nil)
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	out, err := svc.GetMessages(ctx, GetMessagesInput{
+		SessionID: sessionID,
+		Limit:     10,
+		Roles:     []string{"assistant"},
+		PartTypes: []string{"tool-call"},
+	})
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	assert.Equal(t, withTypes.ID, out.Items[0].ID)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_GetMessages_Anchor(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	base := time.Now()
+	msgs := make([]model.Message, 6)
+	for i := range msgs {
+		msgs[i] = model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: base.Add(time.Duration(i) * time.Second)}
+	}
+	anchor := msgs[3]
+
+	repo := &MockSessionRepo{}
+	repo.On("GetMessage", ctx, sessionID, anchor.ID).Return(&anchor, nil)
+	// newest first when reading backwards
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, anchor.CreatedAt, anchor.ID, 3, true).
+		Return([]model.Message{msgs[2], msgs[1], msgs[0]}, nil)
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), time.Time{}, false, anchor.CreatedAt, anchor.ID, 3, false).
+		Return([]model.Message{msgs[4], msgs[5]}, nil)
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	out, err := svc.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, AnchorMessageID: &anchor.ID, Before: 2, After: 2})
+	require.NoError(t, err)
+	ids := make([]uuid.UUID, 0, len(out.Items))
+	for _, m := range out.Items {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []uuid.UUID{msgs[1].ID, msgs[2].ID, anchor.ID, msgs[4].ID, msgs[5].ID}, ids)
+	assert.True(t, out.HasMoreBefore)
+	assert.Equal(t, paging.EncodeCursor(msgs[1].CreatedAt, msgs[1].ID), out.PrevCursor)
+	assert.False(t, out.HasMore)
+	assert.Empty(t, out.NextCursor)
+	repo.AssertExpectations(t)
+
+	t.Run("unknown anchor", func(t *testing.T) {
+		missing := uuid.New()
+		repo := &MockSessionRepo{}
+		repo.On("GetMessage", ctx, sessionID, missing).Return(nil, gorm.ErrRecordNotFound)
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		_, err := svc.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, AnchorMessageID: &missing, Before: 2})
+		assert.ErrorIs(t, err, ErrMessageNotFound)
+	})
+
+	t.Run("anchor after as_of", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("GetMessage", ctx, sessionID, anchor.ID).Return(&anchor, nil)
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+		_, err := svc.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, AnchorMessageID: &anchor.ID, AsOf: base})
+		assert.ErrorIs(t, err, ErrMessageNotFound)
+	})
+}
+
+func TestSessionService_GetMessages_AsOf(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	asOf := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: asOf.Add(-time.Minute)}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), []string(nil), asOf, false, time.Time{}, uuid.UUID{}, 11, false).
+		Return([]model.Message{msg}, nil)
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	out, err := svc.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, Limit: 10, AsOf: asOf})
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_SendMessage_UnknownParent(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	parentID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	repo.On("MessageExists", ctx, sessionID, parentID).Return(false, nil)
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	_, err := service.SendMessage(ctx, SendMessageInput{
+		SessionID: sessionID,
+		Role:      "user",
+		Parts:     []PartIn{{Type: "text", Text: "hi"}},
+		ParentID:  &parentID,
+	})
+
+	assert.ErrorIs(t, err, ErrParentMessageNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_GetMessageTree(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// root -> a -> b, and c branches from root
+	root := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: base}
+	a := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(time.Second)}
+	b := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", ParentID: &a.ID, CreatedAt: base.Add(2 * time.Second)}
+	c := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(3 * time.Second)}
+
+	repo := &MockSessionRepo{}
+	repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{c, b, root, a}, nil)
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	tree, err := service.GetMessageTree(ctx, projectID, sessionID)
+	assert.NoError(t, err)
+
+	if assert.Len(t, tree.Nodes, 4) {
+		assert.Equal(t, root.ID, tree.Nodes[0].ID)
+		assert.Equal(t, []uuid.UUID{a.ID, c.ID}, tree.Nodes[0].ChildIDs)
+		assert.Empty(t, tree.Nodes[2].ChildIDs)
+	}
+	assert.Equal(t, []uuid.UUID{root.ID}, tree.RootIDs)
+	assert.Equal(t, []uuid.UUID{b.ID, c.ID}, tree.LeafIDs)
+
+	_, err = service.GetMessageTree(ctx, uuid.New(), sessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_DeleteMessage(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	repo.On("DeleteMessage", ctx, projectID, sessionID, messageID).Return(int64(2), nil).Once()
+	repo.On("DeleteMessage", ctx, projectID, sessionID, messageID).Return(int64(0), gorm.ErrRecordNotFound).Once()
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	out, err := svc.DeleteMessage(ctx, projectID, sessionID, messageID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), out.RelinkedChildren)
+
+	_, err = svc.DeleteMessage(ctx, projectID, sessionID, messageID)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	_, err = svc.DeleteMessage(ctx, uuid.New(), sessionID, messageID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestCheckMessageChains(t *testing.T) {
+	sessionID := uuid.New()
+	base := time.Now()
+	msg := func(offset int, parent *uuid.UUID) model.Message {
+		return model.Message{ID: uuid.New(), SessionID: sessionID, ParentID: parent, CreatedAt: base.Add(time.Duration(offset) * time.Second)}
+	}
+
+	t.Run("consistent", func(t *testing.T) {
+		root := msg(0, nil)
+		a := msg(1, &root.ID)
+		b := msg(2, &root.ID)
+		report := checkMessageChains([]model.Message{b, a, root})
+		assert.True(t, report.Consistent)
+		assert.Equal(t, 3, report.Messages)
+		assert.Equal(t, []uuid.UUID{root.ID}, report.Roots)
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		missing := uuid.New()
+		root := msg(0, nil)
+		orphan := msg(1, &missing)
+		child := msg(2, &orphan.ID)
+		// x and y are each other's parent, z descends from the loop
+		x, y := msg(3, nil), msg(4, nil)
+		x.ParentID, y.ParentID = &y.ID, &x.ID
+		z := msg(5, &y.ID)
+		superseded := msg(6, &root.ID)
+		superseded.SupersededBy = &missing
+
+		report := checkMessageChains([]model.Message{root, orphan, child, x, y, z, superseded})
+		assert.False(t, report.Consistent)
+		assert.Equal(t, []uuid.UUID{root.ID}, report.Roots)
+		assert.Equal(t, []uuid.UUID{orphan.ID}, report.Orphans)
+		assert.Equal(t, []uuid.UUID{x.ID, y.ID, z.ID}, report.Cycles)
+		assert.Equal(t, []uuid.UUID{superseded.ID}, report.DanglingSupersessions)
+	})
+}
+
+func TestSessionService_Supersede(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// root -> a -> b, and the regenerated c branches from root
+	root := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: base}
+	a := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(time.Second)}
+	b := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &a.ID, CreatedAt: base.Add(2 * time.Second)}
+	c := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(3 * time.Second)}
+
+	repo := &MockSessionRepo{}
+	repo.On("Get", ctx, mock.AnythingOfType("*model.Session")).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{root, a, b, c}, nil)
+	repo.On("SupersedeMessage", ctx, sessionID, a.ID, c.ID, mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	msg, err := service.Supersede(ctx, SupersedeMessageInput{ProjectID: projectID, SessionID: sessionID, MessageID: a.ID, By: c.ID})
+	require.NoError(t, err)
+	assert.Equal(t, c.ID, *msg.SupersededBy)
+	assert.NotNil(t, msg.SupersededAt)
+
+	for name, in := range map[string]SupersedeMessageInput{
+		"itself":        {MessageID: a.ID, By: a.ID},
+		"user message":  {MessageID: root.ID, By: c.ID},
+		"by descendant": {MessageID: a.ID, By: b.ID},
+	} {
+		in.ProjectID, in.SessionID = projectID, sessionID
+		_, err = service.Supersede(ctx, in)
+		assert.ErrorIs(t, err, ErrInvalidSupersession, name)
+	}
+	_, err = service.Supersede(ctx, SupersedeMessageInput{ProjectID: projectID, SessionID: sessionID, MessageID: a.ID, By: uuid.New()})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = service.Supersede(ctx, SupersedeMessageInput{ProjectID: uuid.New(), SessionID: sessionID, MessageID: a.ID, By: c.ID})
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_Supersede_ParentLoop(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	// a and b are each other's parent, old is on no branch of theirs
+	aID, bID := uuid.New(), uuid.New()
+	old := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant"}
+	a := model.Message{ID: aID, SessionID: sessionID, Role: "assistant", ParentID: &bID}
+	b := model.Message{ID: bID, SessionID: sessionID, Role: "assistant", ParentID: &aID}
+
+	repo := &MockSessionRepo{}
+	repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{old, a, b}, nil)
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	_, err := service.Supersede(ctx, SupersedeMessageInput{ProjectID: projectID, SessionID: sessionID, MessageID: old.ID, By: a.ID})
+	assert.ErrorContains(t, err, "loop")
+	repo.AssertNotCalled(t, "SupersedeMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSessionService_GetUsage(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	sessionRepo.On("SumUsageByModel", ctx, sessionID).Return([]repo.ModelUsage{
+		{Model: "", PromptTokens: 5, CompletionTokens: 0, Messages: 1},
+		{Model: "gpt-4.1", PromptTokens: 100, CompletionTokens: 40, Messages: 2},
+	}, nil)
+	sessionRepo.On("SumAnnotations", ctx, sessionID).Return([]repo.AnnotationCount{
+		{Reaction: "", Label: "hallucination", Annotations: 1, Scored: 1, ScoreSum: 0.2},
+		{Reaction: model.AnnotationReactionDown, Label: "hallucination", Annotations: 1},
+		{Reaction: model.AnnotationReactionUp, Label: "", Annotations: 3, Scored: 1, ScoreSum: 1},
+	}, nil)
+
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	usage, err := service.GetUsage(ctx, projectID, sessionID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(105), usage.PromptTokens)
+	assert.Equal(t, int64(40), usage.CompletionTokens)
+	assert.Equal(t, int64(145), usage.TotalTokens)
+	assert.Equal(t, int64(3), usage.Messages)
+	if assert.Len(t, usage.ByModel, 2) {
+		assert.Equal(t, "gpt-4.1", usage.ByModel[1].Model)
+		assert.Equal(t, int64(140), usage.ByModel[1].TotalTokens)
+	}
+	assert.Equal(t, int64(5), usage.Feedback.Annotations)
+	assert.Equal(t, int64(3), usage.Feedback.ThumbsUp)
+	assert.Equal(t, int64(1), usage.Feedback.ThumbsDown)
+	assert.Equal(t, map[string]int64{"hallucination": 2}, usage.Feedback.Labels)
+	if assert.NotNil(t, usage.Feedback.AvgScore) {
+		assert.InDelta(t, 0.6, *usage.Feedback.AvgScore, 1e-9)
+	}
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_GetUsage_Empty(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	sessionRepo.On("SumUsageByModel", ctx, sessionID).Return([]repo.ModelUsage{}, nil)
+	sessionRepo.On("SumAnnotations", ctx, sessionID).Return([]repo.AnnotationCount{}, nil)
+
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	usage, err := service.GetUsage(ctx, projectID, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), usage.TotalTokens)
+	assert.NotNil(t, usage.ByModel)
+	assert.Nil(t, usage.Feedback.AvgScore)
+}
+
+func TestSessionService_GetUsage_SessionOfAnotherProject(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	_, err := service.GetUsage(ctx, uuid.New(), sessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	sessionRepo.AssertNotCalled(t, "SumUsageByModel", mock.Anything, mock.Anything)
+}
+
+func TestSessionService_UpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	t.Run("updates given fields and normalizes tags", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID, Title: "old", Description: "kept"}, nil)
+		repo.On("UpdateMetadata", ctx, mock.MatchedBy(func(s *model.Session) bool {
+			return s.Title == "Refund request" && s.Description == "kept" && len(s.Tags) == 2 && s.Tags[0] == "support" && s.Tags[1] == "billing"
+		})).Return(nil)
+
+		title := "  Refund request "
+		tags := []string{"support", " billing", "", "support"}
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		ss, err := service.UpdateMetadata(ctx, UpdateSessionMetadataInput{ProjectID: projectID, SessionID: sessionID, Title: &title, Tags: &tags})
+		assert.NoError(t, err)
+		assert.Equal(t, "Refund request", ss.Title)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("session of another project", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		_, err := service.UpdateMetadata(ctx, UpdateSessionMetadataInput{ProjectID: projectID, SessionID: sessionID})
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		repo.AssertNotCalled(t, "UpdateMetadata", mock.Anything, mock.Anything)
+	})
+}
+
+func TestSessionService_SetArchived(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	t.Run("archives", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		repo.On("SetArchived", ctx, sessionID, true).Return(nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		ss, err := service.SetArchived(ctx, projectID, sessionID, true)
+		require.NoError(t, err)
+		assert.True(t, ss.IsArchived)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("already restored", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		ss, err := service.SetArchived(ctx, projectID, sessionID, false)
+		require.NoError(t, err)
+		assert.False(t, ss.IsArchived)
+		repo.AssertNotCalled(t, "SetArchived", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("session of another project", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		_, err := service.SetArchived(ctx, projectID, sessionID, true)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+}
+
+func TestSessionService_ListEvents(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	now := time.Now()
+	events := []model.SessionEvent{
+		{ID: uuid.New(), SessionID: sessionID, Kind: model.SessionEventCreated, CreatedAt: now},
+		{ID: uuid.New(), SessionID: sessionID, Kind: model.SessionEventConfigChanged, CreatedAt: now.Add(time.Second)},
+		{ID: uuid.New(), SessionID: sessionID, Kind: model.SessionEventArchived, CreatedAt: now.Add(2 * time.Second)},
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		repo.On("ListEventsWithCursor", ctx, sessionID, "", time.Time{}, uuid.Nil, 3, false).Return(events, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		out, err := service.ListEvents(ctx, ListSessionEventsInput{ProjectID: projectID, SessionID: sessionID, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, events[:2], out.Items)
+		assert.True(t, out.HasMore)
+		assert.Equal(t, paging.EncodeCursor(events[1].CreatedAt, events[1].ID), out.NextCursor)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("next page of a kind", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+		repo.On("ListEventsWithCursor", ctx, sessionID, model.SessionEventArchived, mock.Anything, events[1].ID, 3, true).Return(events[2:], nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		out, err := service.ListEvents(ctx, ListSessionEventsInput{
+			ProjectID: projectID,
+			SessionID: sessionID,
+			Kind:      model.SessionEventArchived,
+			Limit:     2,
+			Cursor:    paging.EncodeCursor(events[1].CreatedAt, events[1].ID),
+			TimeDesc:  true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, events[2:], out.Items)
+		assert.False(t, out.HasMore)
+		assert.Empty(t, out.NextCursor)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("session of another project", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		_, err := service.ListEvents(ctx, ListSessionEventsInput{ProjectID: projectID, SessionID: sessionID, Limit: 2})
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		repo.AssertNotCalled(t, "ListEventsWithCursor", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestSessionService_ExpandPart(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	parts := []model.Part{
+		{Type: "text", Text: "run it"},
+		{Type: "tool-result", Text: "preview", Meta: map[string]any{model.PartMetaTruncated: true}, Asset: &model.Asset{S3Key: "assets/full.txt"}},
+	}
+	repo := &MockSessionRepo{}
+	repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	repo.On("GetMessage", ctx, sessionID, messageID).Return(&model.Message{ID: messageID, InlineParts: datatypes.NewJSONSlice(parts)}, nil)
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	t.Run("part kept whole", func(t *testing.T) {
+		out, err := service.ExpandPart(ctx, projectID, sessionID, messageID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "run it", out.Text)
+		assert.False(t, out.Archived)
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		_, err := service.ExpandPart(ctx, projectID, sessionID, messageID, 2)
+		assert.ErrorIs(t, err, ErrPartNotFound)
+	})
+
+	t.Run("archived output needs s3", func(t *testing.T) {
+		_, err := service.ExpandPart(ctx, projectID, sessionID, messageID, 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("session of another project", func(t *testing.T) {
+		_, err := service.ExpandPart(ctx, uuid.New(), sessionID, messageID, 0)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+}
+
+func TestAutoSessionTitle(t *testing.T) {
+	assert.Equal(t, "", autoSessionTitle([]model.Part{{Type: "image", Filename: "a.png"}}))
+	assert.Equal(t, "How do I get a refund?", autoSessionTitle([]model.Part{
+		{Type: "image", Filename: "a.png"},
+		{Type: "text", Text: "  How do I   get a refund?\nOrder 1234"},
+	}))
+
+	title := autoSessionTitle([]model.Part{{Type: "text", Text: strings.Repeat("word ", 40)}})
+	assert.True(t, strings.HasSuffix(title, "…"))
+	assert.LessOrEqual(t, len([]rune(title)), maxAutoTitleRunes+1)
+	assert.NotContains(t, title, "wor…")
+}
+
+func textMessage(role, text string) model.Message {
+	return model.Message{ID: uuid.New(), Role: role, Parts: []model.Part{{Type: "text", Text: text}}}
+}
+
+func messageTokens(t *testing.T, msgs ...model.Message) []int {
+	tokens := make([]int, len(msgs))
+	for i, m := range msgs {
+		n, err := contextMessageTokens(m.Parts)
+		assert.NoError(t, err)
+		tokens[i] = n
+	}
+	return tokens
+}
+
+func TestFitContextTail(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+
+	old := textMessage("user", strings.Repeat("old history ", 50))
+	call := model.Message{ID: uuid.New(), Role: "assistant", Parts: []model.Part{{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "search", "arguments": "{}"}}}}
+	result := model.Message{ID: uuid.New(), Role: "user", Parts: []model.Part{{Type: "tool-result", Text: strings.Repeat("result ", 20), Meta: map[string]any{"tool_call_id": "call_1"}}}}
+	answer := textMessage("assistant", "The answer is 42.")
+	msgs := []model.Message{old, call, result, answer}
+	tokens := messageTokens(t, msgs...)
+
+	t.Run("everything fits", func(t *testing.T) {
+		start, used, truncated, err := fitContextTail(msgs, tokens, 10000)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, start)
+		assert.Equal(t, tokens[0]+tokens[1]+tokens[2]+tokens[3], used)
+		assert.Nil(t, truncated)
+	})
+
+	t.Run("orphan tool result is dropped with its call", func(t *testing.T) {
+		start, used, truncated, err := fitContextTail(msgs, tokens, tokens[2]+tokens[3])
+		assert.NoError(t, err)
+		assert.Equal(t, 3, start)
+		assert.Equal(t, tokens[3], used)
+		assert.Nil(t, truncated)
+	})
+
+	t.Run("newest message is truncated", func(t *testing.T) {
+		long := textMessage("user", strings.Repeat("word ", 500))
+		start, used, truncated, err := fitContextTail([]model.Message{old, long}, messageTokens(t, old, long), 20)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, start)
+		assert.LessOrEqual(t, used, 20)
+		if assert.NotNil(t, truncated) {
+			assert.Equal(t, long.ID, truncated.ID)
+			assert.Less(t, len(truncated.Parts[0].Text), len(long.Parts[0].Text))
+		}
+	})
+}
+
+func TestSummarizeDropped(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+
+	dropped := []model.Message{
+		textMessage("user", "first question"),
+		textMessage("assistant", strings.Repeat("long answer ", 100)),
+		textMessage("user", "second question"),
+	}
+
+	summary, used, err := summarizeDropped(dropped, 1000)
+	assert.NoError(t, err)
+	if assert.NotNil(t, summary) {
+		assert.Equal(t, "user", summary.Role)
+		assert.Equal(t, true, summary.Meta.Data()["context_summary"])
+		text := summary.Parts[0].Text
+		assert.True(t, strings.HasPrefix(text, "Summary of 3 earlier messages"))
+		assert.Contains(t, text, "- user: first question")
+		assert.Contains(t, text, "...")
+		assert.Less(t, strings.Index(text, "first question"), strings.Index(text, "second question"))
+	}
+	assert.LessOrEqual(t, used, 1000)
+
+	// Only the newest quotes are kept when the budget is tight
+	summary, _, err = summarizeDropped(dropped, 25)
+	assert.NoError(t, err)
+	if assert.NotNil(t, summary) {
+		assert.Contains(t, summary.Parts[0].Text, "second question")
+		assert.NotContains(t, summary.Parts[0].Text, "first question")
+	}
+}
+
+func TestSessionService_GetContextWindow_CurrentBranch(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+
+	ctx := context.Background()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// system -> a -> b, and c branches from a later, so the current branch is system -> a -> c
+	system := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "system", CreatedAt: base}
+	a := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", ParentID: &system.ID, CreatedAt: base.Add(time.Second)}
+	b := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &a.ID, CreatedAt: base.Add(2 * time.Second)}
+	c := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &a.ID, CreatedAt: base.Add(3 * time.Second)}
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{b, c, system, a}, nil)
+
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+	window, err := service.GetContextWindow(ctx, GetContextWindowInput{SessionID: sessionID, MaxTokens: 100, Strategy: ContextStrategyRecent})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, window.TotalMessages)
+	assert.Equal(t, 0, window.DroppedMessages)
+	if assert.Len(t, window.Messages, 3) {
+		assert.Equal(t, system.ID, window.Messages[0].ID)
+		assert.Equal(t, c.ID, window.Messages[2].ID)
+	}
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_GetContextWindow_TurnsAndPins(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+
+	ctx := context.Background()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// system, then three turns; the user message of the first turn is pinned and the second turn ends with a tool result
+	var msgs []model.Message
+	add := func(role string, part model.Part, meta map[string]interface{}) model.Message {
+		m := model.Message{ID: uuid.New(), SessionID: sessionID, Role: role, CreatedAt: base.Add(time.Duration(len(msgs)) * time.Second),
+			InlineParts: datatypes.NewJSONSlice([]model.Part{part}), Parts: []model.Part{part}, Meta: datatypes.NewJSONType(meta)}
+		if len(msgs) > 0 {
+			m.ParentID = &msgs[len(msgs)-1].ID
+		}
+		msgs = append(msgs, m)
+		return m
+	}
+	system := add("system", model.Part{Type: "text", Text: "be brief"}, nil)
+	pinned := add("user", model.Part{Type: "text", Text: "my name is Ada"}, map[string]interface{}{model.MessageMetaPinned: true})
+	add("assistant", model.Part{Type: "text", Text: "hello Ada"}, nil)
+	turn2 := add("user", model.Part{Type: "text", Text: "run the tool"}, nil)
+	add("assistant", model.Part{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "ls", "arguments": "{}"}}, nil)
+	add("user", model.Part{Type: "tool-result", Text: "a.txt", Meta: map[string]interface{}{"tool_call_id": "call_1"}}, nil)
+	add("assistant", model.Part{Type: "text", Text: "there is a.txt"}, nil)
+	turn3 := add("user", model.Part{Type: "text", Text: "thanks"}, nil)
+
+	assert.Equal(t, 2, lastTurnsStart(msgs[1:], 2))
+	assert.Equal(t, 0, lastTurnsStart(msgs[1:], 5))
+
+	tests := []struct {
+		name    string
+		in      GetContextWindowInput
+		wantIDs []uuid.UUID
+		dropped int
+	}{
+		{
+			name:    "last turn plus pins",
+			in:      GetContextWindowInput{SessionID: sessionID, MaxTokens: 1000, Strategy: ContextStrategyRecent, MaxTurns: 1, KeepPinned: true},
+			wantIDs: []uuid.UUID{system.ID, pinned.ID, turn3.ID},
+			dropped: 5,
+		},
+		{
+			name:    "last two turns",
+			in:      GetContextWindowInput{SessionID: sessionID, MaxTokens: 1000, Strategy: ContextStrategyRecent, MaxTurns: 2},
+			wantIDs: []uuid.UUID{system.ID, turn2.ID, msgs[4].ID, msgs[5].ID, msgs[6].ID, turn3.ID},
+			dropped: 2,
+		},
+		{
+			name:    "pinned message inside the tail keeps its place",
+			in:      GetContextWindowInput{SessionID: sessionID, MaxTokens: 1000, Strategy: ContextStrategyRecent, KeepPinned: true},
+			wantIDs: []uuid.UUID{system.ID, pinned.ID, msgs[2].ID, turn2.ID, msgs[4].ID, msgs[5].ID, msgs[6].ID, turn3.ID},
+			dropped: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionRepo := &MockSessionRepo{}
+			sessionRepo.On("ListAllMessagesBySession", ctx, sessionID).Return(append([]model.Message{}, msgs...), nil)
+
+			service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+			window, err := service.GetContextWindow(ctx, tt.in)
+			require.NoError(t, err)
+
+			ids := make([]uuid.UUID, 0, len(window.Messages))
+			for _, m := range window.Messages {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			assert.Equal(t, tt.dropped, window.DroppedMessages)
+		})
+	}
+
+	t.Run("summary of the older turns", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("ListAllMessagesBySession", ctx, sessionID).Return(append([]model.Message{}, msgs...), nil)
+
+		service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		window, err := service.GetContextWindow(ctx, GetContextWindowInput{SessionID: sessionID, MaxTokens: 1000, Strategy: ContextStrategySummary, MaxTurns: 1, KeepPinned: true})
+		require.NoError(t, err)
+
+		assert.True(t, window.Summarized)
+		if assert.Len(t, window.Messages, 4) {
+			assert.Equal(t, pinned.ID, window.Messages[1].ID)
+			assert.Equal(t, turn3.ID, window.Messages[3].ID)
+		}
+	})
+}
+
+func TestSessionService_BulkDelete(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	spaceID := uuid.New()
+
+	ids := make([]uuid.UUID, bulkDeleteBatchSize+2)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	first, second := ids[:bulkDeleteBatchSize], ids[bulkDeleteBatchSize:]
+
+	t.Run("batches with missing sessions and repeated ids", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("DeleteMany", ctx, projectID, first).Return(first[1:], nil).Once()
+		sessionRepo.On("DeleteMany", ctx, projectID, second).Return(second, nil).Once()
+
+		var progress []int
+		service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		out, err := service.BulkDelete(ctx, BulkDeleteSessionsInput{
+			ProjectID:  projectID,
+			SessionIDs: append(append([]uuid.UUID{}, ids...), ids[0]),
+			OnProgress: func(p BulkDeleteSessionsOutput) { progress = append(progress, p.Deleted) },
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, len(ids), out.Total)
+		assert.Equal(t, len(ids)-1, out.Deleted)
+		assert.Equal(t, 2, out.Batches)
+		assert.Equal(t, []uuid.UUID{ids[0]}, out.NotFound)
+		assert.Empty(t, out.Failed)
+		assert.Equal(t, []int{bulkDeleteBatchSize - 1, len(ids) - 1}, progress)
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("sessions of a space with a failed batch", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("ListIDsBySpace", ctx, projectID, spaceID).Return(ids, nil).Once()
+		sessionRepo.On("DeleteMany", ctx, projectID, first).Return(nil, errors.New("deadlock")).Once()
+		sessionRepo.On("DeleteMany", ctx, projectID, second).Return(second, nil).Once()
+
+		service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+		out, err := service.BulkDelete(ctx, BulkDeleteSessionsInput{ProjectID: projectID, SpaceID: &spaceID})
+		require.NoError(t, err)
+
+		assert.Equal(t, len(second), out.Deleted)
+		assert.Equal(t, first, out.Failed)
+		assert.Equal(t, "deadlock", out.Error)
+		sessionRepo.AssertExpectations(t)
+	})
+}
+
+func TestSessionService_Export(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// a -> b, and c branches from a later, so the export is a -> c
+	a := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: base}
+	b := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &a.ID, CreatedAt: base.Add(time.Second)}
+	c := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &a.ID, CreatedAt: base.Add(2 * time.Second)}
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	sessionRepo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{c, a, b}, nil).Times(3)
+	svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	var ids []uuid.UUID
+	collect := func(batch *SessionExport) error {
+		for _, m := range batch.Messages {
+			ids = append(ids, m.ID)
+		}
+		return nil
+	}
+
+	n, err := svc.Export(ctx, ExportSessionInput{ProjectID: projectID, SessionID: sessionID}, collect)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []uuid.UUID{a.ID, c.ID}, ids)
+
+	// Resuming after a leaves c
+	ids = nil
+	n, err = svc.Export(ctx, ExportSessionInput{ProjectID: projectID, SessionID: sessionID, AfterMessageID: &a.ID}, collect)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []uuid.UUID{c.ID}, ids)
+
+	// b is not on the exported branch
+	_, err = svc.Export(ctx, ExportSessionInput{ProjectID: projectID, SessionID: sessionID, AfterMessageID: &b.ID}, collect)
+	assert.ErrorIs(t, err, ErrExportCursorNotFound)
+
+	_, err = svc.Export(ctx, ExportSessionInput{ProjectID: uuid.New(), SessionID: sessionID}, collect)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_ExpandTruncatedParts(t *testing.T) {
+	ctx := context.Background()
+	whole := []model.Part{{Type: "text", Text: "run it", Meta: map[string]any{"source": "cli"}}}
+	truncated := []model.Part{{Type: "tool-result", Text: "preview", Meta: map[string]any{model.PartMetaTruncated: true}, Asset: &model.Asset{S3Key: "assets/full.txt"}}}
+	svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil).(*sessionService)
+
+	msgs := []model.Message{{ID: uuid.New(), Parts: whole}}
+	require.NoError(t, svc.expandTruncatedParts(ctx, msgs))
+	assert.Equal(t, whole, msgs[0].Parts)
+
+	// the full output is read from the asset, which needs s3
+	msgs = []model.Message{{ID: uuid.New(), Parts: truncated}}
+	assert.Error(t, svc.expandTruncatedParts(ctx, msgs))
+	assert.Equal(t, "preview", truncated[0].Text)
+}
+
+func TestSessionService_Archive(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	ss := &model.Session{ID: uuid.New(), ProjectID: projectID, Title: "Refund <request>"}
+	msgs := []model.Message{
+		{ID: uuid.New(), SessionID: ss.ID, Role: "user", CreatedAt: time.Now(), InlineParts: datatypes.NewJSONSlice([]model.Part{{Type: "text", Text: "<script>alert(1)</script>"}})},
+	}
+	msgs = append(msgs, model.Message{ID: uuid.New(), SessionID: ss.ID, Role: "assistant", ParentID: &msgs[0].ID, CreatedAt: msgs[0].CreatedAt.Add(time.Second),
+		InlineParts: datatypes.NewJSONSlice([]model.Part{{Type: "tool-call", Meta: map[string]any{"name": "refund"}}})})
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == ss.ID })).Return(ss, nil)
+	sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ProjectID: uuid.New()}, nil)
+	sessionRepo.On("ListAllMessagesBySession", ctx, ss.ID).Return(msgs, nil).Once()
+	svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+
+	var buf bytes.Buffer
+	n, err := svc.Archive(ctx, ArchiveSessionsInput{ProjectID: projectID, SessionIDs: []uuid.UUID{ss.ID}}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[f.Name] = string(b)
+	}
+	transcript := files["sessions/"+ss.ID.String()+".html"]
+	assert.Contains(t, transcript, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.Contains(t, transcript, "Refund &lt;request&gt;")
+	assert.Contains(t, transcript, "&#34;name&#34;: &#34;refund&#34;")
+	assert.Contains(t, files["index.html"], `href="sessions/`+ss.ID.String()+`.html"`)
+
+	var manifest ArchiveManifest
+	require.NoError(t, sonic.UnmarshalString(files["manifest.json"], &manifest))
+	assert.Equal(t, []ArchiveManifestSession{{ID: ss.ID, Title: ss.Title, Path: "sessions/" + ss.ID.String() + ".html", Messages: 2}}, manifest.Sessions)
+	require.Len(t, manifest.Files, 2)
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256([]byte(files[f.Path]))
+		assert.Equal(t, hex.EncodeToString(sum[:]), f.SHA256, f.Path)
+		assert.Equal(t, int64(len(files[f.Path])), f.SizeB, f.Path)
+	}
+
+	// Nothing is written when a session is not of the project
+	buf.Reset()
+	_, err = svc.Archive(ctx, ArchiveSessionsInput{ProjectID: projectID, SessionIDs: []uuid.UUID{ss.ID, uuid.New()}}, &buf)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.Zero(t, buf.Len())
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_Fork(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	base := time.Now()
+
+	// root -> a, and b branches from root
+	root := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: base}
+	a := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(time.Second)}
+	b := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ParentID: &root.ID, CreatedAt: base.Add(2 * time.Second)}
+	src := &model.Session{ID: sessionID, ProjectID: projectID, Configs: map[string]interface{}{"mode": "chat"}}
+	unknownID := uuid.New()
+
+	tests := []struct {
+		name    string
+		in      ForkSessionInput
+		setup   func(*MockSessionRepo)
+		wantErr error
+	}{
+		{
+			name: "fork whole session",
+			in:   ForkSessionInput{ProjectID: projectID, SessionID: sessionID, WithMessages: true},
+			setup: func(r *MockSessionRepo) {
+				r.On("Get", ctx, mock.Anything).Return(src, nil)
+				r.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{b, a, root}, nil)
+				r.On("Fork", ctx, mock.MatchedBy(func(s *model.Session) bool {
+					return s.ProjectID == projectID && s.Configs["mode"] == "chat"
+				}), []model.Message{root, a, b}).Return(nil)
+			},
+		},
+		{
+			name: "fork branch up to a message",
+			in:   ForkSessionInput{ProjectID: projectID, SessionID: sessionID, WithMessages: true, UpToMessageID: &b.ID},
+			setup: func(r *MockSessionRepo) {
+				r.On("Get", ctx, mock.Anything).Return(src, nil)
+				r.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{b, a, root}, nil)
+				r.On("Fork", ctx, mock.Anything, []model.Message{root, b}).Return(nil)
+			},
+		},
+		{
+			name: "fork configs only",
+			in:   ForkSessionInput{ProjectID: projectID, SessionID: sessionID},
+			setup: func(r *MockSessionRepo) {
+				r.On("Get", ctx, mock.Anything).Return(src, nil)
+				r.On("Fork", ctx, mock.Anything, []model.Message(nil)).Return(nil)
+			},
+		},
+		{
+			name: "message not in session",
+			in:   ForkSessionInput{ProjectID: projectID, SessionID: sessionID, WithMessages: true, UpToMessageID: &unknownID},
+			setup: func(r *MockSessionRepo) {
+				r.On("Get", ctx, mock.Anything).Return(src, nil)
+				r.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{root}, nil)
+			},
+			wantErr: ErrForkMessageNotFound,
+		},
+		{
+			name: "session of another project",
+			in:   ForkSessionInput{ProjectID: uuid.New(), SessionID: sessionID, WithMessages: true},
+			setup: func(r *MockSessionRepo) {
+				r.On("Get", ctx, mock.Anything).Return(src, nil)
+			},
+			wantErr: ErrSessionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil)
+			fork, err := service.Fork(ctx, tt.in)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, fork)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_LoadPartsForMessages(t *testing.T) {
+	cfg := &config.Config{S3: config.S3Cfg{PartsDownloadConcurrency: 4, PartsDownloadTimeoutSec: 5}}
+	svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil).(*sessionService)
+
+	t.Run("loads every message", func(t *testing.T) {
+		msgs := make([]model.Message, 200)
+		ids := make([]uuid.UUID, len(msgs))
+		for i := range msgs {
+			msgs[i].ID = uuid.New()
+			msgs[i].PartsAssetMeta = datatypes.NewJSONType(model.Asset{S3Key: "parts/" + msgs[i].ID.String() + ".json"})
+			ids[i] = msgs[i].ID
+		}
+
+		require.NoError(t, svc.loadPartsForMessages(context.Background(), msgs))
+		for i := range msgs {
+			assert.Equal(t, ids[i], msgs[i].ID)
+			assert.NotNil(t, msgs[i].Parts)
+		}
+	})
+
+	t.Run("expired request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		msgs := []model.Message{{PartsAssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "parts/a.json"})}}
+		err := svc.loadPartsForMessages(ctx, msgs)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("inline parts", func(t *testing.T) {
+		parts := []model.Part{{Type: "text", Text: "hi"}}
+		msgs := []model.Message{{InlineParts: datatypes.NewJSONSlice(parts)}}
+
+		require.NoError(t, svc.loadPartsForMessages(context.Background(), msgs))
+		assert.Equal(t, parts, msgs[0].Parts)
+	})
+}
+
+func TestSessionService_SendMessage_InlineParts(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
+
+	// s3 is nil, the parts must not be uploaded
+	cfg := &config.Config{S3: config.S3Cfg{InlinePartsMaxBytes: 1024}}
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+	msg, err := service.SendMessage(ctx, SendMessageInput{
+		SessionID: sessionID,
+		Role:      "assistant",
+		Parts:     []PartIn{{Type: "text", Text: "hi"}},
+	})
+
+	require.NoError(t, err)
+	assert.True(t, msg.PartsInline())
+	assert.Equal(t, []model.Part{{Type: "text", Text: "hi"}}, []model.Part(msg.InlineParts))
+	assert.Positive(t, msg.SizeB)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_SendMessage_SealedPartsStayInline(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &MockSessionRepo{}
+	repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
+
+	kms, err := envelope.NewLocalKMS(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	require.NoError(t, err)
+	// the S3 client is nil, with sealing on the parts must not be uploaded whatever their size
+	s3 := &blob.S3Deps{Sealer: envelope.NewSealerWithKMS(kms, nil, 0)}
+	cfg := &config.Config{S3: config.S3Cfg{InlinePartsMaxBytes: 0}}
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), s3, nil, cfg, nil)
+	msg, err := service.SendMessage(ctx, SendMessageInput{
+		SessionID: uuid.New(),
+		Role:      "assistant",
+		Parts:     []PartIn{{Type: "text", Text: strings.Repeat("x", 4096)}},
+	})
+
+	require.NoError(t, err)
+	assert.True(t, msg.PartsInline())
+	assert.Len(t, msg.InlineParts, 1)
+	repo.AssertExpectations(t)
+}
+
+func TestStoredParts_SizeB(t *testing.T) {
+	stored := &storedParts{inlineSizeB: 30}
+	assert.Equal(t, int64(30), stored.sizeB())
+
+	// parts uploaded to S3 count once, as one of the uploaded assets
+	stored = &storedParts{partsAsset: model.Asset{SizeB: 2048}, uploaded: []model.Asset{{SizeB: 100}, {SizeB: 2048}}}
+	assert.Equal(t, int64(2148), stored.sizeB())
+}
+
+func TestSessionService_SendMessage_Redaction(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &MockSessionRepo{}
+	repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
+	// the session is named after the redacted text
+	repo.On("SetTitleIfEmpty", ctx, mock.Anything, "reach me at [REDACTED:email]").Return(nil)
+
+	cfg := &config.Config{S3: config.S3Cfg{InlinePartsMaxBytes: 1024}}
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+	meta := map[string]interface{}{"source": "chat"}
+	msg, err := service.SendMessage(ctx, SendMessageInput{
+		SessionID:   uuid.New(),
+		Role:        "user",
+		Parts:       []PartIn{{Type: "text", Text: "reach me at jane@example.com"}},
+		MessageMeta: meta,
+		Redaction:   &model.RedactionPolicy{Enabled: true},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []model.Part{{Type: "text", Text: "reach me at [REDACTED:email]"}}, []model.Part(msg.InlineParts))
+	assert.Equal(t, model.MessageContentHash("user", msg.Parts), msg.ContentHash)
+	stored := msg.Meta.Data()
+	assert.Equal(t, "chat", stored["source"])
+	assert.Equal(t, &model.RedactionReport{
+		Detector: model.RedactionDetectorRegex,
+		Counts:   map[string]int{model.RedactionKindEmail: 1},
+		Parts:    []int{0},
+	}, stored[model.MessageMetaRedactionKey])
+	assert.NotContains(t, meta, model.MessageMetaRedactionKey, "the input meta must not be modified")
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_SendMessage_Duplicate(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	var hashes []string
+	repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Run(func(args mock.Arguments) {
+		hashes = append(hashes, args.Get(1).(*model.Message).ContentHash)
+	}).Return(nil).Once()
+	repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(ErrDuplicateMessage).Once()
+
+	cfg := &config.Config{S3: config.S3Cfg{InlinePartsMaxBytes: 1024}}
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+	in := SendMessageInput{
+		SessionID: sessionID,
+		Role:      "assistant",
+		Parts:     []PartIn{{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}}},
+	}
+
+	_, err := service.SendMessage(ctx, in)
+	require.NoError(t, err)
+	require.Len(t, hashes, 1)
+	assert.Equal(t, model.MessageContentHash("assistant", []model.Part{{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}}}), hashes[0])
+
+	_, err = service.SendMessage(ctx, in)
+	assert.ErrorIs(t, err, ErrDuplicateMessage)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_SendTurn(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	cfg := &config.Config{S3: config.S3Cfg{InlinePartsMaxBytes: 1024}}
+	turn := []TurnMessageIn{
+		{Role: "user", Parts: []PartIn{{Type: "text", Text: "what is 6*7?"}}},
+		{Role: "assistant", Parts: []PartIn{{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "calc", "arguments": "6*7"}}}},
+		{Role: "user", Parts: []PartIn{{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}}}},
+		{Role: "assistant", Parts: []PartIn{{Type: "text", Text: "42"}}, Usage: model.TokenUsage{PromptTokens: 10, CompletionTokens: 2}},
+	}
+
+	t.Run("stores the messages under one turn", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		var stored []*model.Message
+		repo.On("CreateTurn", ctx, mock.AnythingOfType("[]*model.Message")).Run(func(args mock.Arguments) {
+			stored = args.Get(1).([]*model.Message)
+		}).Return(nil).Once()
+		repo.On("SetTitleIfEmpty", ctx, sessionID, "what is 6*7?").Return(nil).Once()
+
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+		out, err := svc.SendTurn(ctx, SendTurnInput{SessionID: sessionID, Messages: turn})
+		require.NoError(t, err)
+
+		require.Len(t, stored, 4)
+		require.Len(t, out.Messages, 4)
+		for i, msg := range out.Messages {
+			assert.Equal(t, out.TurnID, *msg.TurnID)
+			assert.NotEqual(t, uuid.Nil, msg.ID)
+			assert.True(t, msg.PartsInline())
+			assert.NotEmpty(t, msg.ContentHash)
+			assert.Equal(t, turn[i].Role, msg.Role)
+		}
+		assert.Nil(t, out.Messages[0].ParentID)
+		assert.Equal(t, 10, out.Messages[3].Usage.PromptTokens)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown parent", func(t *testing.T) {
+		parentID := uuid.New()
+		repo := &MockSessionRepo{}
+		repo.On("MessageExists", ctx, sessionID, parentID).Return(false, nil)
+
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+		_, err := svc.SendTurn(ctx, SendTurnInput{SessionID: sessionID, Messages: turn, ParentID: &parentID})
+		assert.ErrorIs(t, err, ErrParentMessageNotFound)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("refuses files and oversized turns", func(t *testing.T) {
+		svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, cfg, nil)
+
+		_, err := svc.SendTurn(ctx, SendTurnInput{SessionID: sessionID, Messages: []TurnMessageIn{
+			{Role: "user", Parts: []PartIn{{Type: "image", FileField: "img"}}},
+		}})
+		assert.ErrorContains(t, err, "file uploads are not supported")
+
+		_, err = svc.SendTurn(ctx, SendTurnInput{SessionID: sessionID, Messages: make([]TurnMessageIn, maxTurnMessages+1)})
+		assert.ErrorIs(t, err, ErrTurnTooLarge)
+		_, err = svc.SendTurn(ctx, SendTurnInput{SessionID: sessionID})
+		assert.ErrorIs(t, err, ErrTurnTooLarge)
+	})
+}
+
+func TestMessageContentHash(t *testing.T) {
+	parts := []model.Part{{Type: "text", Text: "hi", Meta: map[string]interface{}{"a": 1, "b": 2}}}
+
+	assert.Equal(t, model.MessageContentHash("user", parts), model.MessageContentHash("user", []model.Part{{Type: "text", Text: "hi", Meta: map[string]interface{}{"b": 2, "a": 1}}}))
+	assert.NotEqual(t, model.MessageContentHash("user", parts), model.MessageContentHash("assistant", parts))
+	assert.NotEqual(t, model.MessageContentHash("user", parts), model.MessageContentHash("user", []model.Part{{Type: "text", Text: "hi!"}}))
+
+	// assets count by content, not by storage key
+	a := []model.Part{{Type: "image", Asset: &model.Asset{SHA256: "abc", S3Key: "assets/1.png"}}}
+	b := []model.Part{{Type: "image", Asset: &model.Asset{SHA256: "abc", S3Key: "assets/2.png"}}}
+	assert.Equal(t, model.MessageContentHash("user", a), model.MessageContentHash("user", b))
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,16 +15,30 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSpaceNotFound  = errors.New("space not found")
+	ErrMergeSameSpace = errors.New("cannot merge a space into itself")
 )
 
 type SpaceService interface {
 	Create(ctx context.Context, m *model.Space) error
 	Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) error
 	UpdateByID(ctx context.Context, m *model.Space) error
+	UpdateMetadata(ctx context.Context, in UpdateSpaceMetadataInput) (*model.Space, error)
 	GetByID(ctx context.Context, m *model.Space) (*model.Space, error)
 	List(ctx context.Context, in ListSpacesInput) (*ListSpacesOutput, error)
 	ListExperienceConfirmations(ctx context.Context, in ListExperienceConfirmationsInput) (*ListExperienceConfirmationsOutput, error)
 	ConfirmExperience(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID, save bool) (*model.ExperienceConfirmation, error)
+	SearchMessages(ctx context.Context, in SearchSpaceMessagesInput) (*SearchSpaceMessagesOutput, error)
+	SearchBlocks(ctx context.Context, in SearchSpaceBlocksInput) (*SearchSpaceBlocksOutput, error)
+	SemanticSearchBlocks(ctx context.Context, in SemanticSearchBlocksInput) (*SemanticSearchBlocksOutput, error)
+	Export(ctx context.Context, spaceID uuid.UUID) (*SpaceExport, error)
+	ExportMarkdownZip(ctx context.Context, spaceID uuid.UUID, w io.Writer) error
+	Import(ctx context.Context, in ImportSpaceInput) (*ImportSpaceOutput, error)
+	Merge(ctx context.Context, in MergeSpaceInput) (*MergeSpaceOutput, error)
 }
 
 type spaceService struct {
@@ -30,18 +46,23 @@ type spaceService struct {
 	publisher *mq.Publisher
 	cfg       *config.Config
 	log       *zap.Logger
+	// limits bounds the children of imported blocks, nil disables it
+	limits EntityLimitService
 }
 
-func NewSpaceService(r repo.SpaceRepo, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger) SpaceService {
+func NewSpaceService(r repo.SpaceRepo, publisher *mq.Publisher, cfg *config.Config, log *zap.Logger, limits EntityLimitService) SpaceService {
 	return &spaceService{
 		r:         r,
 		publisher: publisher,
 		cfg:       cfg,
 		log:       log,
+		limits:    limits,
 	}
 }
 
 func (s *spaceService) Create(ctx context.Context, m *model.Space) error {
+	m.Name = strings.TrimSpace(m.Name)
+	m.Tags = normalizeTags(m.Tags)
 	return s.r.Create(ctx, m)
 }
 
@@ -59,6 +80,91 @@ func (s *spaceService) UpdateByID(ctx context.Context, m *model.Space) error {
 	return s.r.Update(ctx, m)
 }
 
+type UpdateSpaceMetadataInput struct {
+	ProjectID   uuid.UUID
+	SpaceID     uuid.UUID
+	Name        *string   // [Optional]
+	Description *string   // [Optional]
+	Tags        *[]string // [Optional] replaces all tags
+}
+
+func (s *spaceService) UpdateMetadata(ctx context.Context, in UpdateSpaceMetadataInput) (*model.Space, error) {
+	sp, err := s.r.Get(ctx, &model.Space{ID: in.SpaceID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpaceNotFound
+		}
+		return nil, err
+	}
+	if sp.ProjectID != in.ProjectID {
+		return nil, ErrSpaceNotFound
+	}
+
+	if in.Name != nil {
+		sp.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Description != nil {
+		sp.Description = *in.Description
+	}
+	if in.Tags != nil {
+		sp.Tags = *in.Tags
+	}
+	sp.Tags = normalizeTags(sp.Tags)
+
+	if err := s.r.UpdateMetadata(ctx, sp); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+type MergeSpaceInput struct {
+	ProjectID uuid.UUID
+	// SpaceID is the space merged into
+	SpaceID uuid.UUID
+	// SourceSpaceID is the space merged and deleted
+	SourceSpaceID uuid.UUID
+}
+
+type MergeSpaceOutput struct {
+	Space *model.Space `json:"space"`
+	repo.SpaceMergeResult
+}
+
+// Merge moves the pages and other blocks, with their tool SOPs, and the connected sessions of a space into another
+// space of the project, then deletes it. The moved top-level blocks are sorted after those of the space merged into,
+// and moved pages whose slug is taken there get it suffixed with a number, see repo.SpaceMergeResult. The moved blocks keep their parents,
+// so a merge adds no children to a block and the children limits need no check.
+func (s *spaceService) Merge(ctx context.Context, in MergeSpaceInput) (*MergeSpaceOutput, error) {
+	if in.SpaceID == in.SourceSpaceID {
+		return nil, ErrMergeSameSpace
+	}
+	var dst *model.Space
+	for _, id := range []uuid.UUID{in.SpaceID, in.SourceSpaceID} {
+		sp, err := s.r.Get(ctx, &model.Space{ID: id})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrSpaceNotFound
+			}
+			return nil, err
+		}
+		if sp.ProjectID != in.ProjectID {
+			return nil, ErrSpaceNotFound
+		}
+		if dst == nil {
+			dst = sp
+		}
+	}
+
+	res, err := s.r.Merge(ctx, in.SpaceID, in.SourceSpaceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpaceNotFound
+		}
+		return nil, err
+	}
+	return &MergeSpaceOutput{Space: dst, SpaceMergeResult: *res}, nil
+}
+
 func (s *spaceService) GetByID(ctx context.Context, m *model.Space) (*model.Space, error) {
 	if len(m.ID) == 0 {
 		return nil, errors.New("space id is empty")
@@ -68,6 +174,8 @@ func (s *spaceService) GetByID(ctx context.Context, m *model.Space) (*model.Spac
 
 type ListSpacesInput struct {
 	ProjectID uuid.UUID `json:"project_id"`
+	Name      string    `json:"name"` // case-insensitive substring of the name
+	Tag       string    `json:"tag"`
 	Limit     int       `json:"limit"`
 	Cursor    string    `json:"cursor"`
 	TimeDesc  bool      `json:"time_desc"`
@@ -92,7 +200,7 @@ func (s *spaceService) List(ctx context.Context, in ListSpacesInput) (*ListSpace
 	}
 
 	// Query limit+1 is used to determine has_more
-	spaces, err := s.r.ListWithCursor(ctx, in.ProjectID, afterT, afterID, in.Limit+1, in.TimeDesc)
+	spaces, err := s.r.ListWithCursor(ctx, in.ProjectID, in.Name, in.Tag, afterT, afterID, in.Limit+1, in.TimeDesc)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+// SpaceExport is the page and block tree of a space
+type SpaceExport struct {
+	SpaceID    uuid.UUID          `json:"space_id"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Blocks     []*SpaceExportNode `json:"blocks"`
+}
+
+// SpaceExportNode is a block of the tree with its children, in sort order
+type SpaceExportNode struct {
+	*model.Block
+	ToolSOPs []SpaceExportToolSOP `json:"tool_sops,omitempty"`
+	Children []*SpaceExportNode   `json:"children,omitempty"`
+}
+
+// SpaceExportToolSOP is a step of a SOP block
+type SpaceExportToolSOP struct {
+	ToolName string `json:"tool_name"`
+	Action   string `json:"action"`
+}
+
+// Export returns the tree of the blocks of a space that are not archived, the blocks under an archived block are left out
+func (s *spaceService) Export(ctx context.Context, spaceID uuid.UUID) (*SpaceExport, error) {
+	blocks, err := s.r.ListBlocks(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	return &SpaceExport{
+		SpaceID:    spaceID,
+		ExportedAt: time.Now().UTC(),
+		Blocks:     buildExportTree(blocks),
+	}, nil
+}
+
+// buildExportTree nests blocks under their parent, keeping their order. Blocks whose parent is missing are dropped.
+func buildExportTree(blocks []model.Block) []*SpaceExportNode {
+	nodes := make(map[uuid.UUID]*SpaceExportNode, len(blocks))
+	for i := range blocks {
+		nodes[blocks[i].ID] = &SpaceExportNode{Block: &blocks[i], ToolSOPs: exportToolSOPs(&blocks[i])}
+	}
+
+	roots := []*SpaceExportNode{}
+	for i := range blocks {
+		n := nodes[blocks[i].ID]
+		if blocks[i].ParentID == nil {
+			roots = append(roots, n)
+		} else if parent, ok := nodes[*blocks[i].ParentID]; ok {
+			parent.Children = append(parent.Children, n)
+		}
+	}
+	return roots
+}
+
+// exportToolSOPs returns the tool steps of a SOP block
+func exportToolSOPs(b *model.Block) []SpaceExportToolSOP {
+	var steps []SpaceExportToolSOP
+	for _, sop := range b.ToolSOPs {
+		step := SpaceExportToolSOP{Action: sop.Action}
+		if sop.ToolReference != nil {
+			step.ToolName = sop.ToolReference.Name
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// ExportMarkdownZip writes the blocks of a space that are not archived as a zip of Markdown files: a folder is a
+// directory, a page is a .md file holding its text and SOP blocks, and the pages nested under a page are in a directory
+// named like the page. Only the folders and pages are loaded at once, the content of each page is loaded when it is
+// written. It returns before writing anything if the folders and pages cannot be listed.
+func (s *spaceService) ExportMarkdownZip(ctx context.Context, spaceID uuid.UUID, w io.Writer) error {
+	tree, err := s.r.ListTreeBlocks(ctx, spaceID)
+	if err != nil {
+		return err
+	}
+	content := func(page *model.Block) ([]*SpaceExportNode, error) {
+		blocks, err := s.r.ListContentBlocks(ctx, spaceID, page.ID)
+		if err != nil {
+			return nil, err
+		}
+		nodes := make([]*SpaceExportNode, len(blocks))
+		for i := range blocks {
+			nodes[i] = &SpaceExportNode{Block: &blocks[i], ToolSOPs: exportToolSOPs(&blocks[i])}
+		}
+		return nodes, nil
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeExportDir(zw, "", buildExportTree(tree), content); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeExportDir(zw *zip.Writer, dir string, nodes []*SpaceExportNode, content func(page *model.Block) ([]*SpaceExportNode, error)) error {
+	names := map[string]bool{}
+	for _, n := range nodes {
+		if n.Type != model.BlockTypePage && n.Type != model.BlockTypeFolder {
+			continue
+		}
+		name := uniqueExportName(names, exportFileName(n.Title))
+		sub := path.Join(dir, name)
+
+		if n.Type == model.BlockTypePage {
+			blocks, err := content(n.Block)
+			if err != nil {
+				return err
+			}
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: sub + ".md", Method: zip.Deflate, Modified: n.UpdatedAt})
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(f, renderExportPage(n.Title, blocks)); err != nil {
+				return err
+			}
+		} else if _, err := zw.CreateHeader(&zip.FileHeader{Name: sub + "/", Modified: n.UpdatedAt}); err != nil {
+			return err
+		}
+
+		if err := writeExportDir(zw, sub, n.Children, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderExportPage renders a page and its content blocks as Markdown, SOP blocks list their tool steps
+func renderExportPage(title string, content []*SpaceExportNode) string {
+	var sb strings.Builder
+	sb.WriteString("# ")
+	sb.WriteString(title)
+	sb.WriteString("\n\n")
+	for _, n := range content {
+		writeBlockSection(&sb, n.Block)
+		writeToolSteps(&sb, n.ToolSOPs)
+	}
+	return sb.String()
+}
+
+// writeToolSteps lists the tool steps of a SOP block as Markdown
+func writeToolSteps(sb *strings.Builder, steps []SpaceExportToolSOP) {
+	for _, step := range steps {
+		fmt.Fprintf(sb, "- `%s`: %s\n", step.ToolName, step.Action)
+	}
+	if len(steps) > 0 {
+		sb.WriteString("\n")
+	}
+}
+
+// exportFileName turns a block title into a file name that is valid on common file systems
+func exportFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, ". ")
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
+
+// uniqueExportName suffixes name with a number when a sibling already uses it, ignoring case
+func uniqueExportName(used map[string]bool, name string) string {
+	unique := name
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
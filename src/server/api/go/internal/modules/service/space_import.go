@@ -0,0 +1,351 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/datatypes"
+)
+
+// Limits of a space import
+const (
+	MaxSpaceImportBytes      = 64 << 20  // size of the uploaded zip
+	maxSpaceImportPageBytes  = 4 << 20   // uncompressed size of a single Markdown file
+	maxSpaceImportTotalBytes = 256 << 20 // uncompressed size of all Markdown files
+	maxSpaceImportEntries    = 20000     // files and directories of the zip
+	maxSpaceImportBlocks     = 10000
+)
+
+var ErrInvalidSpaceImport = errors.New("invalid space import")
+
+type ImportSpaceInput struct {
+	ProjectID uuid.UUID
+	// Name of the new space, it defaults to the top-level directory of the archive, or else to FileName
+	Name     string
+	FileName string
+	Archive  io.ReaderAt
+	Size     int64
+}
+
+type ImportSpaceOutput struct {
+	Space      *model.Space `json:"space"`
+	Folders    int          `json:"folders"`
+	Pages      int          `json:"pages"`
+	TextBlocks int          `json:"text_blocks"`
+	// Skipped are the files of the archive that are not Markdown, e.g. the images and CSV files of a Notion export
+	Skipped []string `json:"skipped"`
+}
+
+// importNode is a folder or a page of an archive, a page holds the sections of its Markdown file
+type importNode struct {
+	title    string
+	isPage   bool
+	sections []importSection
+	folders  map[string]*importNode
+	pages    []*importNode
+}
+
+// importSection is a text block of a page: a level 2 heading and the Markdown up to the next one
+type importSection struct {
+	title string
+	notes string
+}
+
+// Import creates a space from a zip of Markdown files, such as a space export or a Notion Markdown export.
+// Directories become folders and .md files become pages; the text of a page is split into a text block per
+// level 2 heading, the text before the first heading being a text block without title. Folders and pages are
+// sorted by title, text blocks keep the order of the file. Other files are skipped. A folder or page holding more
+// blocks than the hard children limit is refused with a *LimitExceededError. Archives with too many entries or too
+// much Markdown by their declared sizes are refused before any file is read.
+func (s *spaceService) Import(ctx context.Context, in ImportSpaceInput) (*ImportSpaceOutput, error) {
+	// Insecure paths are left out by importFiles
+	zr, err := zip.NewReader(in.Archive, in.Size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpaceImport, err)
+	}
+
+	// Archives are checked as a whole before any file is decompressed
+	if len(zr.File) > maxSpaceImportEntries {
+		return nil, fmt.Errorf("%w: the archive holds %d entries, at most %d are imported", ErrInvalidSpaceImport, len(zr.File), maxSpaceImportEntries)
+	}
+	files, root := importFiles(zr.File)
+	var total uint64
+	for _, f := range files {
+		if f.file == nil || !isImportPage(f.name) {
+			continue
+		}
+		if f.file.UncompressedSize64 > maxSpaceImportPageBytes {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidSpaceImport, f.file.Name, maxSpaceImportPageBytes)
+		}
+		if total += f.file.UncompressedSize64; total > maxSpaceImportTotalBytes {
+			return nil, fmt.Errorf("%w: the Markdown files are larger than %d bytes", ErrInvalidSpaceImport, maxSpaceImportTotalBytes)
+		}
+	}
+
+	out := &ImportSpaceOutput{Skipped: []string{}}
+	remaining := int64(maxSpaceImportTotalBytes)
+	tree := &importNode{folders: map[string]*importNode{}}
+	for _, f := range files {
+		dir, file := path.Split(f.name)
+		parent := tree
+		for _, segment := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+			if segment != "" {
+				parent = parent.folder(importTitle(segment))
+			}
+		}
+		if f.file == nil {
+			continue
+		}
+		if !isImportPage(file) {
+			out.Skipped = append(out.Skipped, f.name)
+			continue
+		}
+
+		content, err := readImportFile(f.file, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(content))
+		title, sections := parseImportPage(importTitle(strings.TrimSuffix(file, path.Ext(file))), content)
+		parent.pages = append(parent.pages, &importNode{title: title, isPage: true, sections: sections})
+	}
+
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = importTitle(root)
+	}
+	if name == "" && in.FileName != "" {
+		name = strings.TrimSuffix(path.Base(in.FileName), path.Ext(in.FileName))
+	}
+	space := &model.Space{ID: uuid.New(), ProjectID: in.ProjectID, Name: name, Tags: datatypes.JSONSlice[string]{}}
+	blocks := tree.blocks(space.ID, nil, "", out)
+	if len(blocks) > maxSpaceImportBlocks {
+		return nil, fmt.Errorf("%w: the archive holds %d blocks, at most %d are imported at once", ErrInvalidSpaceImport, len(blocks), maxSpaceImportBlocks)
+	}
+	if err := checkBlockWrite(ctx, s.limits, nil, blocks); err != nil {
+		return nil, err
+	}
+	if err := s.r.CreateWithBlocks(ctx, space, blocks); err != nil {
+		return nil, err
+	}
+	blockIDs := make([]uuid.UUID, len(blocks))
+	for i := range blocks {
+		blockIDs[i] = blocks[i].ID
+	}
+	publishBlockEmbeddings(ctx, s.publisher, s.cfg, s.log, space.ID, blockIDs)
+	out.Space = space
+	return out, nil
+}
+
+// importFile is an entry of an archive, file is nil for a directory
+type importFile struct {
+	name string
+	file *zip.File
+}
+
+// importFiles returns the entries of an archive that hold content, without the top-level directory shared by all
+// of them, which is returned as root. Hidden files, macOS metadata and paths escaping the archive are left out.
+func importFiles(entries []*zip.File) ([]importFile, string) {
+	files := make([]importFile, 0, len(entries))
+	for _, f := range entries {
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		isDir := strings.HasSuffix(name, "/")
+		name = path.Clean("/" + name)[1:]
+		if name == "" || name != strings.TrimSuffix(strings.ReplaceAll(f.Name, `\`, "/"), "/") {
+			continue
+		}
+		hidden := false
+		for _, segment := range strings.Split(name, "/") {
+			if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+				hidden = true
+			}
+		}
+		if hidden {
+			continue
+		}
+		if isDir {
+			files = append(files, importFile{name: name + "/"})
+		} else {
+			files = append(files, importFile{name: name, file: f})
+		}
+	}
+
+	// A zipped directory or a Notion export wraps everything in one directory
+	root := ""
+	for i, f := range files {
+		top, _, ok := strings.Cut(f.name, "/")
+		if !ok || (i > 0 && top != root) {
+			return files, ""
+		}
+		root = top
+	}
+	if root == "" {
+		return files, ""
+	}
+	for i := range files {
+		files[i].name = strings.TrimPrefix(files[i].name, root+"/")
+	}
+	return files, root
+}
+
+// isImportPage reports whether a file of an archive is a Markdown file, the only files that are read
+func isImportPage(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".md")
+}
+
+// readImportFile reads a Markdown file of an archive, failing once it is larger than its limit or than the
+// remaining bytes of the whole import
+func readImportFile(f *zip.File, remaining int64) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidSpaceImport, f.Name, err)
+	}
+	defer rc.Close()
+	// The declared size is not trusted
+	limit := min(int64(maxSpaceImportPageBytes), remaining)
+	raw, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidSpaceImport, f.Name, err)
+	}
+	if int64(len(raw)) > limit {
+		if limit < maxSpaceImportPageBytes {
+			return "", fmt.Errorf("%w: the Markdown files are larger than %d bytes", ErrInvalidSpaceImport, maxSpaceImportTotalBytes)
+		}
+		return "", fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidSpaceImport, f.Name, maxSpaceImportPageBytes)
+	}
+	return string(raw), nil
+}
+
+// notionIDSuffix is the id Notion appends to the names of exported pages and directories
+var notionIDSuffix = regexp.MustCompile(`\s+[0-9a-f]{32}$`)
+
+// importTitle turns a file or directory name into a block title
+func importTitle(name string) string {
+	return strings.TrimSpace(notionIDSuffix.ReplaceAllString(name, ""))
+}
+
+// parseImportPage splits a Markdown file into its title, taken from a leading level 1 heading or else from the
+// file name, and its sections. Headings within fenced code blocks are kept as text.
+func parseImportPage(fileTitle string, content string) (string, []importSection) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	title := fileTitle
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if h, ok := strings.CutPrefix(line, "# "); ok {
+			title = strings.TrimSpace(h)
+			lines = lines[i+1:]
+		}
+		break
+	}
+
+	sections := []importSection{}
+	current := importSection{}
+	var body []string
+	flush := func() {
+		current.notes = strings.TrimSpace(strings.Join(body, "\n"))
+		if current.title != "" || current.notes != "" {
+			sections = append(sections, current)
+		}
+	}
+	fence := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case strings.HasPrefix(line, "## "):
+			flush()
+			current, body = importSection{title: strings.TrimSpace(line[3:])}, nil
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return title, sections
+}
+
+// folder returns the folder of n with the title, adding it when missing
+func (n *importNode) folder(title string) *importNode {
+	if title == "" {
+		title = "untitled"
+	}
+	f, ok := n.folders[title]
+	if !ok {
+		f = &importNode{title: title, folders: map[string]*importNode{}}
+		n.folders[title] = f
+	}
+	return f
+}
+
+// blocks returns the blocks of the children of n, each parent before its children
+func (n *importNode) blocks(spaceID uuid.UUID, parentID *uuid.UUID, folderPath string, out *ImportSpaceOutput) []model.Block {
+	children := make([]*importNode, 0, len(n.folders)+len(n.pages))
+	for _, f := range n.folders {
+		children = append(children, f)
+	}
+	children = append(children, n.pages...)
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := strings.ToLower(children[i].title), strings.ToLower(children[j].title)
+		if a != b {
+			return a < b
+		}
+		return !children[i].isPage && children[j].isPage
+	})
+
+	var blocks []model.Block
+	for i, c := range children {
+		b := model.Block{
+			ID:       uuid.New(),
+			SpaceID:  spaceID,
+			ParentID: parentID,
+			Title:    c.title,
+			Props:    datatypes.NewJSONType(map[string]any{}),
+			Sort:     int64(i),
+		}
+		if !c.isPage {
+			b.Type = model.BlockTypeFolder
+			p := c.title
+			if folderPath != "" {
+				p = folderPath + "/" + c.title
+			}
+			b.SetFolderPath(p)
+			out.Folders++
+			blocks = append(blocks, b)
+			blocks = append(blocks, c.blocks(spaceID, &b.ID, p, out)...)
+			continue
+		}
+
+		b.Type = model.BlockTypePage
+		b.Slug = pageSlug(b.Title)
+		out.Pages++
+		blocks = append(blocks, b)
+		for j, section := range c.sections {
+			blocks = append(blocks, model.Block{
+				ID:       uuid.New(),
+				SpaceID:  spaceID,
+				ParentID: &b.ID,
+				Type:     model.BlockTypeText,
+				Title:    section.title,
+				Props:    datatypes.NewJSONType(map[string]any{"notes": section.notes}),
+				Sort:     int64(j),
+			})
+			out.TextBlocks++
+		}
+	}
+	return blocks
+}
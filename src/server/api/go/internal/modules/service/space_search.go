@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+// snippetContext is the number of characters kept around the first match of a search snippet
+const snippetContext = 80
+
+type SearchSpaceMessagesInput struct {
+	SpaceID uuid.UUID `json:"space_id"`
+	Query   string    `json:"q"`
+	Limit   int       `json:"limit"`
+	Cursor  string    `json:"cursor"`
+}
+
+// SnippetRange is a match of the query in a snippet, in characters from the start of the snippet
+type SnippetRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// MessageSearchHit is a message whose text contains the query
+type MessageSearchHit struct {
+	SessionID uuid.UUID `json:"session_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// Snippet is the text around the first match, Highlights the matches in it
+	Snippet    string         `json:"snippet"`
+	Highlights []SnippetRange `json:"highlights"`
+}
+
+type SearchSpaceMessagesOutput struct {
+	Items      []MessageSearchHit `json:"items"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	HasMore    bool               `json:"has_more"`
+}
+
+// SearchMessages searches the text parts of the messages of all the sessions connected to a space, latest first
+func (s *spaceService) SearchMessages(ctx context.Context, in SearchSpaceMessagesInput) (*SearchSpaceMessagesOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
+	var beforeT time.Time
+	var beforeID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		beforeT, beforeID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	msgs, err := s.r.SearchMessages(ctx, in.SpaceID, in.Query, beforeT, beforeID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &SearchSpaceMessagesOutput{Items: make([]MessageSearchHit, 0, min(len(msgs), in.Limit))}
+	if len(msgs) > in.Limit {
+		out.HasMore = true
+		msgs = msgs[:in.Limit]
+		last := msgs[len(msgs)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, m := range msgs {
+		snippet, highlights := searchSnippet(m.SearchText, in.Query, snippetContext)
+		out.Items = append(out.Items, MessageSearchHit{
+			SessionID:  m.SessionID,
+			MessageID:  m.ID,
+			Role:       m.Role,
+			CreatedAt:  m.CreatedAt,
+			Snippet:    snippet,
+			Highlights: highlights,
+		})
+	}
+	return out, nil
+}
+
+type SearchSpaceBlocksInput struct {
+	SpaceID uuid.UUID `json:"space_id"`
+	Query   string    `json:"q"`
+	Type    string    `json:"type"`
+	Limit   int       `json:"limit"`
+	Cursor  string    `json:"cursor"`
+}
+
+// BlockSearchHit is a block whose title or text matches the query
+type BlockSearchHit struct {
+	BlockID  uuid.UUID  `json:"block_id"`
+	ParentID *uuid.UUID `json:"parent_id"`
+	Type     string     `json:"type"`
+	Title    string     `json:"title"`
+	// Rank is the relevance of the block, higher first, a match in the title outweighs one in the text
+	Rank float32 `json:"rank"`
+	// Snippet is the text around the first match of a query term, Highlights the matches in it
+	Snippet    string         `json:"snippet"`
+	Highlights []SnippetRange `json:"highlights"`
+}
+
+type SearchSpaceBlocksOutput struct {
+	Items      []BlockSearchHit `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// SearchBlocks searches the title and text props of the blocks of a space by full-text search, best ranked first
+func (s *spaceService) SearchBlocks(ctx context.Context, in SearchSpaceBlocksInput) (*SearchSpaceBlocksOutput, error) {
+	// Parse cursor (rank, id); an empty cursor indicates starting from the best ranked
+	var afterRank float32
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterRank, afterID, err = paging.DecodeRankCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	blocks, err := s.r.SearchBlocks(ctx, in.SpaceID, in.Query, in.Type, afterRank, afterID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &SearchSpaceBlocksOutput{Items: make([]BlockSearchHit, 0, min(len(blocks), in.Limit))}
+	if len(blocks) > in.Limit {
+		out.HasMore = true
+		blocks = blocks[:in.Limit]
+		last := blocks[len(blocks)-1]
+		out.NextCursor = paging.EncodeRankCursor(last.Rank, last.ID)
+	}
+	terms := searchQueryTerms(in.Query)
+	for _, b := range blocks {
+		text := (&model.Block{Title: b.Title, Props: b.Props}).SearchText()
+		snippet, highlights := searchTermsSnippet(text, terms, snippetContext)
+		out.Items = append(out.Items, BlockSearchHit{
+			BlockID:    b.ID,
+			ParentID:   b.ParentID,
+			Type:       b.Type,
+			Title:      b.Title,
+			Rank:       b.Rank,
+			Snippet:    snippet,
+			Highlights: highlights,
+		})
+	}
+	return out, nil
+}
+
+type SemanticSearchBlocksInput struct {
+	SpaceID uuid.UUID `json:"space_id"`
+	// Embedding is the embedding of the query, with the model of the block embeddings
+	Embedding []float32 `json:"-"`
+	Type      string    `json:"type"`
+	TopK      int       `json:"top_k"`
+	// Threshold is the largest cosine distance of a hit, 0 for no limit
+	Threshold float64 `json:"threshold"`
+}
+
+// SemanticBlockHit is a block near the query by meaning
+type SemanticBlockHit struct {
+	BlockID  uuid.UUID      `json:"block_id"`
+	ParentID *uuid.UUID     `json:"parent_id"`
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Props    map[string]any `json:"props"`
+	// Distance is the cosine distance between the block and the query, from 0 (identical) to 2 (opposite)
+	Distance float64 `json:"distance"`
+}
+
+type SemanticSearchBlocksOutput struct {
+	Items []SemanticBlockHit `json:"items"`
+}
+
+// SemanticSearchBlocks returns the top_k blocks of a space nearest to a query embedding, nearest first
+func (s *spaceService) SemanticSearchBlocks(ctx context.Context, in SemanticSearchBlocksInput) (*SemanticSearchBlocksOutput, error) {
+	blocks, err := s.r.SemanticSearchBlocks(ctx, in.SpaceID, in.Embedding, in.Type, in.Threshold, in.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &SemanticSearchBlocksOutput{Items: make([]SemanticBlockHit, 0, len(blocks))}
+	for _, b := range blocks {
+		out.Items = append(out.Items, SemanticBlockHit{
+			BlockID:  b.ID,
+			ParentID: b.ParentID,
+			Type:     b.Type,
+			Title:    b.Title,
+			Props:    b.Props.Data(),
+			Distance: b.Distance,
+		})
+	}
+	return out, nil
+}
+
+// searchQueryTerms returns the words and quoted phrases of a web search query, without the excluded ones
+// (prefixed with -) and the or operator
+func searchQueryTerms(query string) []string {
+	terms := []string{}
+	parts := strings.Split(query, `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			// A quoted phrase, excluded when the quote follows a -
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" && !strings.HasSuffix(parts[i-1], "-") {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+				continue
+			}
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// searchSnippet cuts the text around the first case-insensitive match of query, keeping up to around characters
+// on each side, and returns the matches within the snippet. Line breaks are flattened to spaces.
+func searchSnippet(text string, query string, around int) (string, []SnippetRange) {
+	return searchTermsSnippet(text, []string{query}, around)
+}
+
+// searchTermsSnippet is searchSnippet matching any of terms, the longest one where several match at a position
+func searchTermsSnippet(text string, terms []string, around int) (string, []SnippetRange) {
+	runes := []rune(strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text))
+	needles := make([][]rune, 0, len(terms))
+	for _, t := range terms {
+		if t != "" {
+			needles = append(needles, []rune(t))
+		}
+	}
+	sort.SliceStable(needles, func(i, j int) bool { return len(needles[i]) > len(needles[j]) })
+
+	matches := []SnippetRange{}
+	for i := 0; i < len(runes); i++ {
+		for _, needle := range needles {
+			if i+len(needle) <= len(runes) && foldEqual(runes[i:i+len(needle)], needle) {
+				matches = append(matches, SnippetRange{Start: i, End: i + len(needle)})
+				i += len(needle) - 1
+				break
+			}
+		}
+	}
+
+	start, end := 0, min(len(runes), 2*around)
+	if len(matches) > 0 {
+		start = max(matches[0].Start-around, 0)
+		end = min(matches[0].End+around, len(runes))
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	offset := len([]rune(prefix)) - start
+	highlights := []SnippetRange{}
+	for _, m := range matches {
+		if m.Start >= start && m.End <= end {
+			highlights = append(highlights, SnippetRange{Start: m.Start + offset, End: m.End + offset})
+		}
+	}
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// foldEqual reports whether a and b are equal under simple case folding
+func foldEqual(a []rune, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] && unicode.ToLower(a[i]) != unicode.ToLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,17 +1,26 @@
 package service
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockSpaceRepo is a mock implementation of SpaceRepo
@@ -42,8 +51,13 @@ func (m *MockSpaceRepo) Get(ctx context.Context, s *model.Space) (*model.Space,
 	return args.Get(0).(*model.Space), args.Error(1)
 }
 
-func (m *MockSpaceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error) {
-	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
+func (m *MockSpaceRepo) UpdateMetadata(ctx context.Context, s *model.Space) error {
+	args := m.Called(ctx, s)
+	return args.Error(0)
+}
+
+func (m *MockSpaceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, nameQuery string, tag string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error) {
+	args := m.Called(ctx, projectID, nameQuery, tag, afterCreatedAt, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -71,6 +85,67 @@ func (m *MockSpaceRepo) DeleteExperienceConfirmation(ctx context.Context, spaceI
 	return args.Error(0)
 }
 
+func (m *MockSpaceRepo) SearchMessages(ctx context.Context, spaceID uuid.UUID, query string, beforeCreatedAt time.Time, beforeID uuid.UUID, limit int) ([]model.Message, error) {
+	args := m.Called(ctx, spaceID, query, beforeCreatedAt, beforeID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSpaceRepo) SearchBlocks(ctx context.Context, spaceID uuid.UUID, query string, blockType string, afterRank float32, afterID uuid.UUID, limit int) ([]repo.RankedBlock, error) {
+	args := m.Called(ctx, spaceID, query, blockType, afterRank, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.RankedBlock), args.Error(1)
+}
+
+func (m *MockSpaceRepo) SemanticSearchBlocks(ctx context.Context, spaceID uuid.UUID, embedding []float32, blockType string, maxDistance float64, limit int) ([]repo.NearBlock, error) {
+	args := m.Called(ctx, spaceID, embedding, blockType, maxDistance, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.NearBlock), args.Error(1)
+}
+
+func (m *MockSpaceRepo) ListBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockSpaceRepo) ListTreeBlocks(ctx context.Context, spaceID uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockSpaceRepo) ListContentBlocks(ctx context.Context, spaceID uuid.UUID, pageID uuid.UUID) ([]model.Block, error) {
+	args := m.Called(ctx, spaceID, pageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Block), args.Error(1)
+}
+
+func (m *MockSpaceRepo) CreateWithBlocks(ctx context.Context, s *model.Space, blocks []model.Block) error {
+	args := m.Called(ctx, s, blocks)
+	return args.Error(0)
+}
+
+func (m *MockSpaceRepo) Merge(ctx context.Context, dstID uuid.UUID, srcID uuid.UUID) (*repo.SpaceMergeResult, error) {
+	args := m.Called(ctx, dstID, srcID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.SpaceMergeResult), args.Error(1)
+}
+
 func TestSpaceService_Create(t *testing.T) {
 	ctx := context.Background()
 	projectID := uuid.New()
@@ -111,7 +186,7 @@ func TestSpaceService_Create(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
 			err := service.Create(ctx, tt.space)
 
 			if tt.wantErr {
@@ -178,7 +253,7 @@ func TestSpaceService_Delete(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
 			err := service.Delete(ctx, tt.projectID, tt.spaceID)
 
 			if tt.wantErr {
@@ -246,7 +321,7 @@ func TestSpaceService_UpdateByID(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
 			err := service.UpdateByID(ctx, tt.space)
 
 			if tt.wantErr {
@@ -318,7 +393,7 @@ func TestSpaceService_GetByID(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
 			result, err := service.GetByID(ctx, tt.space)
 
 			if tt.wantErr {
@@ -365,7 +440,7 @@ func TestSpaceService_List(t *testing.T) {
 						ProjectID: projectID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSpaces, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", "", time.Time{}, uuid.UUID{}, 11, false).Return(expectedSpaces, nil)
 			},
 			wantErr: false,
 		},
@@ -376,7 +451,7 @@ func TestSpaceService_List(t *testing.T) {
 				Limit:     10,
 			},
 			setup: func(repo *MockSpaceRepo) {
-				repo.On("ListWithCursor", ctx, projectID, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Space{}, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", "", time.Time{}, uuid.UUID{}, 11, false).Return([]model.Space{}, nil)
 			},
 			wantErr: false,
 		},
@@ -387,10 +462,24 @@ func TestSpaceService_List(t *testing.T) {
 				Limit:     10,
 			},
 			setup: func(repo *MockSpaceRepo) {
-				repo.On("ListWithCursor", ctx, projectID, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
+				repo.On("ListWithCursor", ctx, projectID, "", "", time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
 			},
 			wantErr: true,
 		},
+		{
+			name: "filtered by name and tag",
+			input: ListSpacesInput{
+				ProjectID: projectID,
+				Name:      "support",
+				Tag:       "production",
+				Limit:     10,
+				TimeDesc:  true,
+			},
+			setup: func(repo *MockSpaceRepo) {
+				repo.On("ListWithCursor", ctx, projectID, "support", "production", time.Time{}, uuid.UUID{}, 11, true).Return([]model.Space{}, nil)
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -398,7 +487,7 @@ func TestSpaceService_List(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
 			result, err := service.List(ctx, tt.input)
 
 			if tt.wantErr {
@@ -416,3 +505,371 @@ func TestSpaceService_List(t *testing.T) {
 		})
 	}
 }
+
+func TestSpaceService_SearchMessages(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	sessionID := uuid.New()
+	now := time.Now()
+	msgs := []model.Message{
+		{ID: uuid.New(), SessionID: sessionID, Role: "user", SearchText: "What is the Refund policy?", CreatedAt: now},
+		{ID: uuid.New(), SessionID: sessionID, Role: "assistant", SearchText: "refunds within 30 days", CreatedAt: now.Add(-time.Second)},
+	}
+
+	repo := &MockSpaceRepo{}
+	repo.On("SearchMessages", ctx, spaceID, "refund", time.Time{}, uuid.Nil, 2).Return(msgs, nil)
+
+	svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+	out, err := svc.SearchMessages(ctx, SearchSpaceMessagesInput{SpaceID: spaceID, Query: "refund", Limit: 1})
+	assert.NoError(t, err)
+	assert.True(t, out.HasMore)
+	assert.Equal(t, paging.EncodeCursor(msgs[0].CreatedAt, msgs[0].ID), out.NextCursor)
+	assert.Equal(t, []MessageSearchHit{{
+		SessionID:  sessionID,
+		MessageID:  msgs[0].ID,
+		Role:       "user",
+		CreatedAt:  now,
+		Snippet:    "What is the Refund policy?",
+		Highlights: []SnippetRange{{Start: 12, End: 18}},
+	}}, out.Items)
+	repo.AssertExpectations(t)
+}
+
+func TestSpaceService_SearchBlocks(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	blocks := []repo.RankedBlock{
+		{ID: uuid.New(), ParentID: &pageID, Type: model.BlockTypeText, Title: "Deploy", Props: datatypes.NewJSONType(map[string]any{"notes": "Roll back with helm rollback"}), Rank: 0.6},
+		{ID: uuid.New(), ParentID: &pageID, Type: model.BlockTypeCode, Title: "Rollback", Props: datatypes.NewJSONType(map[string]any{"language": "sh"}), Rank: 0.3},
+	}
+
+	repo := &MockSpaceRepo{}
+	repo.On("SearchBlocks", ctx, spaceID, "helm rollback -staging", "", float32(0), uuid.Nil, 2).Return(blocks, nil)
+	repo.On("SearchBlocks", ctx, spaceID, "helm", model.BlockTypeText, float32(0.6), blocks[0].ID, 2).Return(blocks[1:], nil)
+
+	svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+	out, err := svc.SearchBlocks(ctx, SearchSpaceBlocksInput{SpaceID: spaceID, Query: "helm rollback -staging", Limit: 1})
+	assert.NoError(t, err)
+	assert.True(t, out.HasMore)
+	assert.Equal(t, paging.EncodeRankCursor(0.6, blocks[0].ID), out.NextCursor)
+	assert.Equal(t, []BlockSearchHit{{
+		BlockID:    blocks[0].ID,
+		ParentID:   &pageID,
+		Type:       model.BlockTypeText,
+		Title:      "Deploy",
+		Rank:       0.6,
+		Snippet:    "Deploy Roll back with helm rollback",
+		Highlights: []SnippetRange{{Start: 22, End: 26}, {Start: 27, End: 35}},
+	}}, out.Items)
+
+	out, err = svc.SearchBlocks(ctx, SearchSpaceBlocksInput{SpaceID: spaceID, Query: "helm", Type: model.BlockTypeText, Limit: 1, Cursor: out.NextCursor})
+	assert.NoError(t, err)
+	assert.False(t, out.HasMore)
+	assert.Empty(t, out.NextCursor)
+	assert.Len(t, out.Items, 1)
+	repo.AssertExpectations(t)
+}
+
+func TestSpaceService_SemanticSearchBlocks(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+	embedding := []float32{0.6, 0.8}
+	near := repo.NearBlock{ID: uuid.New(), ParentID: &pageID, Type: model.BlockTypeMarkdown, Title: "Rollback", Props: datatypes.NewJSONType(map[string]any{"content": "helm rollback"}), Distance: 0.2}
+
+	r := &MockSpaceRepo{}
+	r.On("SemanticSearchBlocks", ctx, spaceID, embedding, model.BlockTypeMarkdown, 0.5, 3).Return([]repo.NearBlock{near}, nil)
+
+	svc := NewSpaceService(r, nil, &config.Config{}, zap.NewNop(), nil)
+	out, err := svc.SemanticSearchBlocks(ctx, SemanticSearchBlocksInput{SpaceID: spaceID, Embedding: embedding, Type: model.BlockTypeMarkdown, TopK: 3, Threshold: 0.5})
+	assert.NoError(t, err)
+	assert.Equal(t, []SemanticBlockHit{{
+		BlockID:  near.ID,
+		ParentID: &pageID,
+		Type:     model.BlockTypeMarkdown,
+		Title:    "Rollback",
+		Props:    map[string]any{"content": "helm rollback"},
+		Distance: 0.2,
+	}}, out.Items)
+	r.AssertExpectations(t)
+}
+
+func TestSearchQueryTerms(t *testing.T) {
+	assert.Equal(t, []string{"helm", "blue green", "deploy"}, searchQueryTerms(`helm "blue   green" or deploy -staging -"canary release"`))
+	assert.Equal(t, []string{}, searchQueryTerms("  "))
+}
+
+func TestSearchSnippet(t *testing.T) {
+	t.Run("matches the longest term", func(t *testing.T) {
+		snippet, highlights := searchTermsSnippet("a rollback, then roll", []string{"roll", "rollback"}, 80)
+		assert.Equal(t, "a rollback, then roll", snippet)
+		assert.Equal(t, []SnippetRange{{Start: 2, End: 10}, {Start: 17, End: 21}}, highlights)
+	})
+
+	t.Run("cuts around the first match", func(t *testing.T) {
+		snippet, highlights := searchSnippet("aaaa bbbb Zoë cccc zoë dddd eeee", "ZOË", 6)
+		assert.Equal(t, "… bbbb Zoë cccc …", snippet)
+		assert.Equal(t, []SnippetRange{{Start: 7, End: 10}}, highlights)
+	})
+
+	t.Run("flattens lines and keeps the matches in the snippet", func(t *testing.T) {
+		snippet, highlights := searchSnippet("ab\nab\r\nab", "ab", 80)
+		assert.Equal(t, "ab ab ab", snippet)
+		assert.Equal(t, []SnippetRange{{Start: 0, End: 2}, {Start: 3, End: 5}, {Start: 6, End: 8}}, highlights)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		snippet, highlights := searchSnippet("abcdef", "xyz", 2)
+		assert.Equal(t, "abcd…", snippet)
+		assert.Empty(t, highlights)
+	})
+}
+
+func TestSpaceService_UpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	name := "  Support agent "
+	tags := []string{"support", " support", "", "production"}
+
+	t.Run("updates the given fields", func(t *testing.T) {
+		repo := &MockSpaceRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: projectID, Description: "kept"}, nil)
+		repo.On("UpdateMetadata", ctx, mock.MatchedBy(func(s *model.Space) bool {
+			return s.Name == "Support agent" && s.Description == "kept" && len(s.Tags) == 2
+		})).Return(nil)
+
+		svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+		sp, err := svc.UpdateMetadata(ctx, UpdateSpaceMetadataInput{ProjectID: projectID, SpaceID: spaceID, Name: &name, Tags: &tags})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"support", "production"}, []string(sp.Tags))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("space of another project", func(t *testing.T) {
+		repo := &MockSpaceRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: uuid.New()}, nil)
+
+		svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+		_, err := svc.UpdateMetadata(ctx, UpdateSpaceMetadataInput{ProjectID: projectID, SpaceID: spaceID, Name: &name})
+
+		assert.ErrorIs(t, err, ErrSpaceNotFound)
+		repo.AssertNotCalled(t, "UpdateMetadata", mock.Anything, mock.Anything)
+	})
+}
+
+func TestSpaceService_Merge(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	dst := &model.Space{ID: uuid.New(), ProjectID: projectID, Name: "support"}
+	src := &model.Space{ID: uuid.New(), ProjectID: projectID, Name: "support (old)"}
+	foreign := &model.Space{ID: uuid.New(), ProjectID: uuid.New()}
+
+	newRepo := func() *MockSpaceRepo {
+		repo := &MockSpaceRepo{}
+		for _, sp := range []*model.Space{dst, src, foreign} {
+			repo.On("Get", ctx, mock.MatchedBy(func(m *model.Space) bool { return m.ID == sp.ID })).Return(sp, nil)
+		}
+		repo.On("Get", ctx, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+		return repo
+	}
+
+	t.Run("merges", func(t *testing.T) {
+		r := newRepo()
+		r.On("Merge", ctx, dst.ID, src.ID).Return(&repo.SpaceMergeResult{Blocks: 12, Sessions: 3, ToolSOPs: 2, SlugsRenamed: 1}, nil)
+
+		svc := NewSpaceService(r, nil, &config.Config{}, zap.NewNop(), nil)
+		out, err := svc.Merge(ctx, MergeSpaceInput{ProjectID: projectID, SpaceID: dst.ID, SourceSpaceID: src.ID})
+
+		assert.NoError(t, err)
+		assert.Equal(t, dst, out.Space)
+		assert.Equal(t, int64(12), out.Blocks)
+		assert.Equal(t, int64(3), out.Sessions)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		r := newRepo()
+		svc := NewSpaceService(r, nil, &config.Config{}, zap.NewNop(), nil)
+
+		_, err := svc.Merge(ctx, MergeSpaceInput{ProjectID: projectID, SpaceID: dst.ID, SourceSpaceID: dst.ID})
+		assert.ErrorIs(t, err, ErrMergeSameSpace)
+		_, err = svc.Merge(ctx, MergeSpaceInput{ProjectID: projectID, SpaceID: dst.ID, SourceSpaceID: foreign.ID})
+		assert.ErrorIs(t, err, ErrSpaceNotFound)
+		_, err = svc.Merge(ctx, MergeSpaceInput{ProjectID: projectID, SpaceID: uuid.New(), SourceSpaceID: src.ID})
+		assert.ErrorIs(t, err, ErrSpaceNotFound)
+		r.AssertNotCalled(t, "Merge", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestSpaceService_Export(t *testing.T) {
+	ctx := context.Background()
+	spaceID := uuid.New()
+	folderID, pageID, subID, orphanParentID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	blocks := []model.Block{
+		{ID: folderID, SpaceID: spaceID, Type: model.BlockTypeFolder, Title: "Ops"},
+		{ID: pageID, SpaceID: spaceID, Type: model.BlockTypePage, Title: "Runbook", ParentID: &folderID},
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeText, Title: "Rollback", ParentID: &pageID,
+			Props: datatypes.NewJSONType(map[string]any{"notes": "revert the last release"})},
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypeSOP, Title: "deploy", ParentID: &pageID,
+			ToolSOPs: []model.ToolSOP{{Action: "apply the manifests", ToolReference: &model.ToolReference{Name: "kubectl"}}}},
+		{ID: subID, SpaceID: spaceID, Type: model.BlockTypePage, Title: "On call", ParentID: &pageID},
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "runbook", ParentID: &folderID},
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "a/b: c?"},
+		// under an archived page
+		{ID: uuid.New(), SpaceID: spaceID, Type: model.BlockTypePage, Title: "hidden", ParentID: &orphanParentID},
+	}
+	repo := &MockSpaceRepo{}
+	repo.On("ListBlocks", ctx, spaceID).Return(blocks, nil)
+
+	svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+	export, err := svc.Export(ctx, spaceID)
+	assert.NoError(t, err)
+	assert.Len(t, export.Blocks, 2)
+	assert.Len(t, export.Blocks[0].Children, 2)
+	assert.Len(t, export.Blocks[0].Children[0].Children, 3)
+
+	// The zip loads the folders and pages, then the content of each page as it is written
+	var tree, content []model.Block
+	for _, b := range blocks {
+		switch {
+		case b.Type == model.BlockTypeFolder || b.Type == model.BlockTypePage:
+			tree = append(tree, b)
+		case b.ParentID != nil && *b.ParentID == pageID:
+			content = append(content, b)
+		}
+	}
+	repo.On("ListTreeBlocks", ctx, spaceID).Return(tree, nil)
+	repo.On("ListContentBlocks", ctx, spaceID, pageID).Return(content, nil).Once()
+	repo.On("ListContentBlocks", ctx, spaceID, mock.Anything).Return([]model.Block{}, nil).Times(3)
+
+	var buf bytes.Buffer
+	assert.NoError(t, svc.ExportMarkdownZip(ctx, spaceID, &buf))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(rc)
+		files[f.Name] = string(content)
+	}
+	assert.Equal(t, map[string]string{
+		"Ops/":                   "",
+		"Ops/Runbook.md":         "# Runbook\n\n## Rollback\n\nrevert the last release\n\n## deploy\n\n- `kubectl`: apply the manifests\n\n",
+		"Ops/Runbook/On call.md": "# On call\n\n",
+		"Ops/runbook (2).md":     "# runbook\n\n",
+		"a-b- c-.md":             "# a/b: c?\n\n",
+	}, files)
+	repo.AssertExpectations(t)
+}
+
+func TestSpaceService_Import(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"Export-1/Ops 0123456789abcdef0123456789abcdef/Runbook 0123456789abcdef0123456789abcdef.md": "# Runbook\n\nRead first.\n\n## Rollback\n\nrevert the last release\n\n```sh\n## not a heading\n```\n\n## Deploy\n",
+		"Export-1/Ops 0123456789abcdef0123456789abcdef/diagram.png":                                 "png",
+		"Export-1/Ops 0123456789abcdef0123456789abcdef/Alerts.md":                                   "pager rules",
+		"Export-1/Empty/":             "",
+		"Export-1/.DS_Store":          "",
+		"Export-1/__MACOSX/Alerts.md": "",
+		"Export-1/../escape.md":       "# escape",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	repo := &MockSpaceRepo{}
+	var created []model.Block
+	repo.On("CreateWithBlocks", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(2).([]model.Block)
+	}).Return(nil)
+
+	svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop(), nil)
+	out, err := svc.Import(ctx, ImportSpaceInput{ProjectID: projectID, Archive: bytes.NewReader(buf.Bytes()), Size: int64(buf.Len())})
+	require.NoError(t, err)
+	assert.Equal(t, "Export-1", out.Space.Name)
+	assert.Equal(t, projectID, out.Space.ProjectID)
+	assert.Equal(t, 2, out.Folders)
+	assert.Equal(t, 2, out.Pages)
+	assert.Equal(t, 4, out.TextBlocks)
+	assert.Equal(t, []string{"Ops 0123456789abcdef0123456789abcdef/diagram.png"}, out.Skipped)
+
+	type row struct {
+		Type, Title, Notes, Parent string
+		Sort                       int64
+	}
+	titles := map[uuid.UUID]string{}
+	rows := make([]row, 0, len(created))
+	for _, b := range created {
+		titles[b.ID] = b.Title
+		r := row{Type: b.Type, Title: b.Title, Sort: b.Sort}
+		if b.ParentID != nil {
+			parent, ok := titles[*b.ParentID]
+			require.True(t, ok, "parent of %s is created after it", b.Title)
+			r.Parent = parent
+		}
+		r.Notes, _ = b.Props.Data()["notes"].(string)
+		rows = append(rows, r)
+	}
+	assert.Equal(t, []row{
+		{Type: model.BlockTypeFolder, Title: "Empty"},
+		{Type: model.BlockTypeFolder, Title: "Ops", Sort: 1},
+		{Type: model.BlockTypePage, Title: "Alerts", Parent: "Ops"},
+		{Type: model.BlockTypeText, Notes: "pager rules", Parent: "Alerts"},
+		{Type: model.BlockTypePage, Title: "Runbook", Parent: "Ops", Sort: 1},
+		{Type: model.BlockTypeText, Notes: "Read first.", Parent: "Runbook"},
+		{Type: model.BlockTypeText, Title: "Rollback", Notes: "revert the last release\n\n```sh\n## not a heading\n```", Parent: "Runbook", Sort: 1},
+		{Type: model.BlockTypeText, Title: "Deploy", Parent: "Runbook", Sort: 2},
+	}, rows)
+	assert.Equal(t, "Ops", created[1].GetFolderPath())
+	if assert.NotNil(t, created[4].Slug) {
+		assert.Equal(t, "runbook", *created[4].Slug)
+	}
+	assert.Nil(t, created[1].Slug)
+
+	_, err = svc.Import(ctx, ImportSpaceInput{ProjectID: projectID, Archive: bytes.NewReader([]byte("not a zip")), Size: 9})
+	assert.ErrorIs(t, err, ErrInvalidSpaceImport)
+	repo.AssertExpectations(t)
+}
+
+func TestSpaceService_Import_Limits(t *testing.T) {
+	ctx := context.Background()
+	archive := func(entries int, declared uint64) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i := 0; i < entries; i++ {
+			// The sizes in the headers are what the archive claims, nothing is decompressed to check them
+			_, err := zw.CreateRaw(&zip.FileHeader{Name: fmt.Sprintf("page-%d.md", i), Method: zip.Store, UncompressedSize64: declared, CompressedSize64: 0})
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	svc := NewSpaceService(&MockSpaceRepo{}, nil, &config.Config{}, zap.NewNop(), nil)
+	for name, tc := range map[string]struct {
+		zip  []byte
+		want string
+	}{
+		"too many entries": {archive(maxSpaceImportEntries+1, 0), "entries"},
+		"page too large":   {archive(1, maxSpaceImportPageBytes+1), "page-0.md is larger"},
+		"too much text":    {archive(maxSpaceImportTotalBytes/maxSpaceImportPageBytes+1, maxSpaceImportPageBytes), "Markdown files are larger"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Import(ctx, ImportSpaceInput{ProjectID: uuid.New(), Archive: bytes.NewReader(tc.zip), Size: int64(len(tc.zip))})
+			assert.ErrorIs(t, err, ErrInvalidSpaceImport)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/llm"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const summarySystemPrompt = "You maintain a rolling summary of a conversation between a user and an AI agent. " +
+	"Update the previous summary with the new messages. Keep the user's goals, decisions, facts, open questions " +
+	"and the results of tool calls; drop small talk. Answer with the updated summary only, in plain text."
+
+type SummaryService interface {
+	Summarize(ctx context.Context, sessionID uuid.UUID) error
+	HandleDelivery(ctx context.Context, body []byte) error
+}
+
+type summaryService struct {
+	sessionRepo repo.SessionRepo
+	sessionSvc  SessionService
+	llm         llm.Client
+	cfg         *config.Config
+	log         *zap.Logger
+}
+
+// NewSummaryService returns a summary service; with a nil llm client summarization is disabled
+func NewSummaryService(sessionRepo repo.SessionRepo, sessionSvc SessionService, llmClient llm.Client, cfg *config.Config, log *zap.Logger) SummaryService {
+	return &summaryService{
+		sessionRepo: sessionRepo,
+		sessionSvc:  sessionSvc,
+		llm:         llmClient,
+		cfg:         cfg,
+		log:         log,
+	}
+}
+
+// HandleDelivery is the session message MQ consumer handler, see Summarize.
+// Malformed payloads are dropped rather than requeued.
+func (s *summaryService) HandleDelivery(ctx context.Context, body []byte) error {
+	var ev SendMQPublishJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		s.log.Warn("invalid session message event", zap.Error(err))
+		return nil
+	}
+	return s.Summarize(ctx, ev.SessionID)
+}
+
+// Summarize folds the messages of the current branch added since the last summary into the rolling summary
+// of the session, once at least Summary.EveryMessages of them are pending. The messages are sent oldest first
+// in chunks of at most Summary.MaxInputTokens, each call updating the summary of the previous one.
+// Errors are returned only when the event should be retried.
+func (s *summaryService) Summarize(ctx context.Context, sessionID uuid.UUID) error {
+	if s.llm == nil {
+		return nil
+	}
+
+	ss, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// The session holds at least as many messages as the current branch, so fewer new messages than
+	// the threshold since the summary means there is nothing to do yet, without loading the parts
+	every := max(s.cfg.Summary.EveryMessages, 1)
+	if ss.MessageCount-int64(ss.SummaryMessages) < int64(every) {
+		return nil
+	}
+
+	msgs, err := s.sessionSvc.GetAllMessages(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	// Messages are ordered from old to new, the current branch ends at the latest one
+	branch := messageBranch(msgs, msgs[len(msgs)-1].ID)
+
+	summary, pending := ss.Summary, branch
+	if ss.SummaryMessageID != nil {
+		found := false
+		for i, m := range branch {
+			if m.ID == *ss.SummaryMessageID {
+				pending, found = branch[i+1:], true
+				break
+			}
+		}
+		// The summarized messages are no longer on the current branch, start over
+		if !found {
+			summary = ""
+		}
+	}
+
+	if len(pending) < every {
+		return nil
+	}
+
+	for len(pending) > 0 {
+		chunk, n, err := s.summaryChunk(pending)
+		if err != nil {
+			return err
+		}
+		pending = pending[n:]
+		if chunk == "" {
+			continue
+		}
+
+		prompt := fmt.Sprintf("Previous summary:\n%s\n\nNew messages:\n%s", summaryOrNone(summary), chunk)
+		summary, err = s.llm.Complete(ctx, summarySystemPrompt, prompt)
+		if err != nil {
+			return fmt.Errorf("summarize session: %w", err)
+		}
+		summary = strings.TrimSpace(summary)
+	}
+
+	stored, err := s.sessionRepo.UpdateSummary(ctx, sessionID, ss.SummaryMessageID, repo.SessionSummaryUpdate{
+		Summary:   summary,
+		MessageID: branch[len(branch)-1].ID,
+		Messages:  len(branch),
+	})
+	if err != nil {
+		return err
+	}
+	if !stored {
+		s.log.Debug("session summary was updated concurrently", zap.String("session_id", sessionID.String()))
+	}
+	return nil
+}
+
+// summaryChunk renders the leading messages that fit in the input budget as "role: text" lines and returns
+// how many messages it consumed. A single message over the budget is truncated.
+func (s *summaryService) summaryChunk(msgs []model.Message) (string, int, error) {
+	budget := max(s.cfg.Summary.MaxInputTokens, 1)
+
+	lines := []string{}
+	used, n := 0, 0
+	for _, m := range msgs {
+		text := syncMessageText(m.Parts)
+		if text == "" {
+			n++
+			continue
+		}
+		line := fmt.Sprintf("%s: %s", m.Role, text)
+		tokens, err := tokenizer.CountTokens(line)
+		if err != nil {
+			return "", 0, err
+		}
+		if used+tokens > budget {
+			if len(lines) > 0 {
+				break
+			}
+			if line, err = tokenizer.TruncateTokens(line, budget); err != nil {
+				return "", 0, err
+			}
+			tokens = budget
+		}
+		lines = append(lines, line)
+		used += tokens
+		n++
+	}
+	return strings.Join(lines, "\n"), n, nil
+}
+
+func summaryOrNone(summary string) string {
+	if summary == "" {
+		return "(none)"
+	}
+	return summary
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+type fakeLLM struct {
+	prompts []string
+}
+
+func (f *fakeLLM) Complete(ctx context.Context, system string, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	return fmt.Sprintf("summary %d", len(f.prompts)), nil
+}
+
+// messagesSessionService serves GetAllMessages from memory
+type messagesSessionService struct {
+	SessionService
+	msgs  []model.Message
+	loads int
+}
+
+func (s *messagesSessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
+	s.loads++
+	return s.msgs, nil
+}
+
+func chainedMessages(sessionID uuid.UUID, n int) []model.Message {
+	base := time.Now()
+	msgs := make([]model.Message, n)
+	for i := range msgs {
+		msgs[i] = textMessage("user", fmt.Sprintf("message %d", i))
+		msgs[i].SessionID = sessionID
+		msgs[i].CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if i > 0 {
+			msgs[i].ParentID = &msgs[i-1].ID
+		}
+	}
+	return msgs
+}
+
+func newTestSummaryService(sessionRepo repo.SessionRepo, msgs []model.Message, llmClient *fakeLLM, every int) SummaryService {
+	cfg := &config.Config{Summary: config.SummaryCfg{EveryMessages: every, MaxInputTokens: 8000}}
+	return NewSummaryService(sessionRepo, &messagesSessionService{msgs: msgs}, llmClient, cfg, zap.NewNop())
+}
+
+func TestSummaryService_Summarize(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+	ctx := context.Background()
+	sessionID := uuid.New()
+	msgs := chainedMessages(sessionID, 5)
+
+	t.Run("waits for enough new messages", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, MessageCount: 5, Summary: "earlier", SummaryMessageID: &msgs[2].ID, SummaryMessages: 3}, nil)
+		llmClient := &fakeLLM{}
+
+		err := newTestSummaryService(sessionRepo, msgs, llmClient, 3).Summarize(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Empty(t, llmClient.prompts)
+		sessionRepo.AssertNotCalled(t, "UpdateSummary", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("does not load the messages below the threshold", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, MessageCount: 5, Summary: "earlier", SummaryMessageID: &msgs[2].ID, SummaryMessages: 3}, nil)
+		sessionSvc := &messagesSessionService{msgs: msgs}
+		cfg := &config.Config{Summary: config.SummaryCfg{EveryMessages: 3, MaxInputTokens: 8000}}
+
+		err := NewSummaryService(sessionRepo, sessionSvc, &fakeLLM{}, cfg, zap.NewNop()).Summarize(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Zero(t, sessionSvc.loads)
+	})
+
+	t.Run("folds new messages into the previous summary", func(t *testing.T) {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, MessageCount: 5, Summary: "earlier", SummaryMessageID: &msgs[2].ID, SummaryMessages: 3}, nil)
+		sessionRepo.On("UpdateSummary", ctx, sessionID, &msgs[2].ID, repo.SessionSummaryUpdate{Summary: "summary 1", MessageID: msgs[4].ID, Messages: 5}).Return(true, nil)
+		llmClient := &fakeLLM{}
+
+		err := newTestSummaryService(sessionRepo, msgs, llmClient, 2).Summarize(ctx, sessionID)
+		assert.NoError(t, err)
+		if assert.Len(t, llmClient.prompts, 1) {
+			prompt := llmClient.prompts[0]
+			assert.Contains(t, prompt, "earlier")
+			assert.Contains(t, prompt, "user: message 3")
+			assert.NotContains(t, prompt, "message 2")
+		}
+		sessionRepo.AssertExpectations(t)
+	})
+
+	t.Run("starts over when the summarized message left the branch", func(t *testing.T) {
+		gone := uuid.New()
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, MessageCount: 5, Summary: "stale", SummaryMessageID: &gone, SummaryMessages: 3}, nil)
+		sessionRepo.On("UpdateSummary", ctx, sessionID, &gone, mock.Anything).Return(true, nil)
+		llmClient := &fakeLLM{}
+
+		err := newTestSummaryService(sessionRepo, msgs, llmClient, 2).Summarize(ctx, sessionID)
+		assert.NoError(t, err)
+		if assert.Len(t, llmClient.prompts, 1) {
+			assert.NotContains(t, llmClient.prompts[0], "stale")
+			assert.Contains(t, llmClient.prompts[0], "user: message 0")
+		}
+		sessionRepo.AssertExpectations(t)
+	})
+}
+
+func TestSummaryChunk(t *testing.T) {
+	_ = tokenizer.Init(zap.NewNop())
+	s := &summaryService{cfg: &config.Config{Summary: config.SummaryCfg{MaxInputTokens: 30}}}
+
+	short := textMessage("user", "hello")
+	long := textMessage("assistant", strings.Repeat("word ", 200))
+
+	chunk, n, err := s.summaryChunk([]model.Message{short, long})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "user: hello", chunk)
+
+	// A single message over the budget is truncated rather than skipped
+	chunk, n, err = s.summaryChunk([]model.Message{long})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Less(t, len(chunk), len(long.Parts[0].Text))
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+var (
+	ErrSyncRuleTargetNotFound = errors.New("target page not found in space")
+	ErrSyncRuleEmptyMatch     = errors.New("match requires at least one of tags, roles or contains")
+)
+
+type SyncRuleService interface {
+	Create(ctx context.Context, in CreateSyncRuleInput) (*model.SyncRule, error)
+	List(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error)
+	Update(ctx context.Context, in UpdateSyncRuleInput) (*model.SyncRule, error)
+	Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, ruleID uuid.UUID) error
+	HandleDelivery(ctx context.Context, body []byte) error
+	SyncMessage(ctx context.Context, ev SendMQPublishJSON) ([]uuid.UUID, error)
+}
+
+type syncRuleService struct {
+	r          repo.SyncRuleRepo
+	sessionSvc SessionService
+	log        *zap.Logger
+	// limits bounds the children of the target pages, nil disables it
+	limits EntityLimitService
+}
+
+func NewSyncRuleService(r repo.SyncRuleRepo, sessionSvc SessionService, log *zap.Logger, limits EntityLimitService) SyncRuleService {
+	return &syncRuleService{
+		r:          r,
+		sessionSvc: sessionSvc,
+		log:        log,
+		limits:     limits,
+	}
+}
+
+type CreateSyncRuleInput struct {
+	ProjectID    uuid.UUID
+	SpaceID      uuid.UUID
+	Name         string
+	Match        model.SyncRuleMatch
+	TargetPageID uuid.UUID
+	Enabled      bool
+}
+
+func (s *syncRuleService) Create(ctx context.Context, in CreateSyncRuleInput) (*model.SyncRule, error) {
+	if in.Match.IsEmpty() {
+		return nil, ErrSyncRuleEmptyMatch
+	}
+
+	page, err := s.r.GetPage(ctx, in.ProjectID, in.SpaceID, in.TargetPageID)
+	if err != nil {
+		return nil, err
+	}
+	if page == nil {
+		return nil, ErrSyncRuleTargetNotFound
+	}
+
+	rule := &model.SyncRule{
+		SpaceID:      in.SpaceID,
+		Name:         in.Name,
+		Match:        datatypes.NewJSONType(in.Match),
+		TargetPageID: in.TargetPageID,
+		Enabled:      in.Enabled,
+	}
+	if err := s.r.Create(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *syncRuleService) List(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error) {
+	return s.r.ListBySpace(ctx, projectID, spaceID)
+}
+
+type UpdateSyncRuleInput struct {
+	ProjectID uuid.UUID
+	SpaceID   uuid.UUID
+	RuleID    uuid.UUID
+	Name      *string              // [Optional]
+	Match     *model.SyncRuleMatch // [Optional]
+	Enabled   *bool                // [Optional]
+}
+
+func (s *syncRuleService) Update(ctx context.Context, in UpdateSyncRuleInput) (*model.SyncRule, error) {
+	if in.Match != nil && in.Match.IsEmpty() {
+		return nil, ErrSyncRuleEmptyMatch
+	}
+
+	rule, err := s.r.Get(ctx, in.ProjectID, in.SpaceID, in.RuleID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Name != nil {
+		rule.Name = *in.Name
+	}
+	if in.Match != nil {
+		rule.Match = datatypes.NewJSONType(*in.Match)
+	}
+	if in.Enabled != nil {
+		rule.Enabled = *in.Enabled
+	}
+
+	if err := s.r.Update(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *syncRuleService) Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, ruleID uuid.UUID) error {
+	return s.r.Delete(ctx, projectID, spaceID, ruleID)
+}
+
+// HandleDelivery is the session message MQ consumer handler, see SyncMessage.
+// Malformed payloads are dropped rather than requeued.
+func (s *syncRuleService) HandleDelivery(ctx context.Context, body []byte) error {
+	var ev SendMQPublishJSON
+	if err := sonic.Unmarshal(body, &ev); err != nil {
+		s.log.Warn("invalid session message event", zap.Error(err))
+		return nil
+	}
+	_, err := s.SyncMessage(ctx, ev)
+	return err
+}
+
+// SyncMessage copies a newly persisted message into the target page of every matching rule of the
+// space its session is connected to and returns the IDs of the created blocks, a message is copied once per rule.
+// A target page at its hard children limit is skipped. Errors are returned only when the event should be retried.
+func (s *syncRuleService) SyncMessage(ctx context.Context, ev SendMQPublishJSON) ([]uuid.UUID, error) {
+	created := []uuid.UUID{}
+	rules, err := s.r.ListEnabledForSession(ctx, ev.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return created, nil
+	}
+
+	msg, err := s.sessionSvc.GetMessage(ctx, ev.SessionID, ev.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	text := syncMessageText(msg.Parts)
+	if text == "" {
+		return created, nil
+	}
+
+	for _, rule := range rules {
+		if !rule.Match.Data().Matches(msg.Role, msg.Meta.Data(), text) {
+			continue
+		}
+		if s.limits != nil {
+			if _, err := s.limits.CheckBlockChildren(ctx, rule.TargetPageID, 1); err != nil {
+				var exceeded *LimitExceededError
+				if !errors.As(err, &exceeded) {
+					return nil, err
+				}
+				// A full page is not retried
+				s.log.Warn("sync rule target page is full", zap.String("rule_id", rule.ID.String()), zap.Error(err))
+				continue
+			}
+		}
+
+		b := &model.Block{
+			SpaceID:  rule.SpaceID,
+			Type:     model.BlockTypeText,
+			ParentID: &rule.TargetPageID,
+			Title:    fmt.Sprintf("%s · %s", msg.Role, msg.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC")),
+			Props: datatypes.NewJSONType(map[string]any{
+				"notes":             text,
+				"sync_rule_id":      rule.ID.String(),
+				"source_session_id": ev.SessionID.String(),
+				"source_message_id": msg.ID.String(),
+			}),
+		}
+		ok, err := s.r.AppendBlock(ctx, rule.ID, msg.ID, b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			created = append(created, b.ID)
+			s.log.Debug("synced message to page", zap.String("rule_id", rule.ID.String()), zap.String("message_id", msg.ID.String()), zap.String("block_id", b.ID.String()))
+		}
+	}
+	return created, nil
+}
+
+// syncMessageText renders the parts of a message as the text of a block
+func syncMessageText(parts []model.Part) string {
+	lines := make([]string, 0, len(parts))
+	for _, p := range parts {
+		switch p.Type {
+		case "text", "tool-result":
+			if t := strings.TrimSpace(p.Text); t != "" {
+				lines = append(lines, t)
+			}
+		case "tool-call":
+			name, _ := p.Meta["name"].(string)
+			args, _ := p.Meta["arguments"].(string)
+			if name != "" {
+				lines = append(lines, fmt.Sprintf("%s(%s)", name, args))
+			}
+		default:
+			if p.Filename != "" {
+				lines = append(lines, fmt.Sprintf("[%s: %s]", p.Type, p.Filename))
+			}
+		}
+	}
+	return strings.Join(lines, "\n\n")
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+// MockSyncRuleRepo is a mock implementation of SyncRuleRepo
+type MockSyncRuleRepo struct {
+	mock.Mock
+}
+
+func (m *MockSyncRuleRepo) Create(ctx context.Context, r *model.SyncRule) error {
+	args := m.Called(ctx, r)
+	return args.Error(0)
+}
+
+func (m *MockSyncRuleRepo) Get(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) (*model.SyncRule, error) {
+	args := m.Called(ctx, projectID, spaceID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleRepo) Update(ctx context.Context, r *model.SyncRule) error {
+	args := m.Called(ctx, r)
+	return args.Error(0)
+}
+
+func (m *MockSyncRuleRepo) Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, id uuid.UUID) error {
+	args := m.Called(ctx, projectID, spaceID, id)
+	return args.Error(0)
+}
+
+func (m *MockSyncRuleRepo) ListBySpace(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) ([]model.SyncRule, error) {
+	args := m.Called(ctx, projectID, spaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleRepo) ListEnabledForSession(ctx context.Context, sessionID uuid.UUID) ([]model.SyncRule, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SyncRule), args.Error(1)
+}
+
+func (m *MockSyncRuleRepo) GetPage(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, pageID uuid.UUID) (*model.Block, error) {
+	args := m.Called(ctx, projectID, spaceID, pageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Block), args.Error(1)
+}
+
+func (m *MockSyncRuleRepo) AppendBlock(ctx context.Context, ruleID uuid.UUID, messageID uuid.UUID, b *model.Block) (bool, error) {
+	args := m.Called(ctx, ruleID, messageID, b)
+	return args.Bool(0), args.Error(1)
+}
+
+// stubMessageSessionService serves a single message, the other methods are not used by the sync rules
+type stubMessageSessionService struct {
+	SessionService
+	msg *model.Message
+	err error
+}
+
+func (s *stubMessageSessionService) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	return s.msg, s.err
+}
+
+func TestSyncRuleService_Create(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	pageID := uuid.New()
+
+	tests := []struct {
+		name    string
+		match   model.SyncRuleMatch
+		setup   func(*MockSyncRuleRepo)
+		wantErr error
+	}{
+		{
+			name:  "success",
+			match: model.SyncRuleMatch{Tags: []string{"decision"}},
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("GetPage", ctx, projectID, spaceID, pageID).Return(&model.Block{ID: pageID, Type: model.BlockTypePage}, nil)
+				r.On("Create", ctx, mock.MatchedBy(func(rule *model.SyncRule) bool {
+					return rule.SpaceID == spaceID && rule.TargetPageID == pageID && rule.Enabled
+				})).Return(nil)
+			},
+		},
+		{
+			name:    "empty match",
+			setup:   func(r *MockSyncRuleRepo) {},
+			wantErr: ErrSyncRuleEmptyMatch,
+		},
+		{
+			name:  "target is not a page of the space",
+			match: model.SyncRuleMatch{Roles: []string{"assistant"}},
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("GetPage", ctx, projectID, spaceID, pageID).Return(nil, nil)
+			},
+			wantErr: ErrSyncRuleTargetNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSyncRuleRepo{}
+			tt.setup(repo)
+
+			rule, err := NewSyncRuleService(repo, nil, zap.NewNop(), nil).Create(ctx, CreateSyncRuleInput{
+				ProjectID:    projectID,
+				SpaceID:      spaceID,
+				Match:        tt.match,
+				TargetPageID: pageID,
+				Enabled:      true,
+			})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.match, rule.Match.Data())
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSyncRuleService_HandleDelivery(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	pageID := uuid.New()
+	rule := model.SyncRule{
+		ID:           uuid.New(),
+		SpaceID:      uuid.New(),
+		TargetPageID: pageID,
+		Enabled:      true,
+		Match:        datatypes.NewJSONType(model.SyncRuleMatch{Tags: []string{"decision"}}),
+	}
+	body, _ := sonic.Marshal(SendMQPublishJSON{ProjectID: uuid.New(), SessionID: sessionID, MessageID: messageID})
+
+	message := func(meta map[string]any, parts ...model.Part) *model.Message {
+		return &model.Message{
+			ID:        messageID,
+			SessionID: sessionID,
+			Role:      "assistant",
+			Meta:      datatypes.NewJSONType(meta),
+			Parts:     parts,
+			CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		msg     *model.Message
+		setup   func(*MockSyncRuleRepo)
+		wantErr bool
+	}{
+		{
+			name: "matching message is appended to the page",
+			body: body,
+			msg: message(map[string]any{"tags": []any{"decision"}},
+				model.Part{Type: "text", Text: "We go with Postgres."},
+				model.Part{Type: "tool-call", Meta: map[string]any{"name": "record", "arguments": `{"db":"pg"}`}},
+			),
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("ListEnabledForSession", ctx, sessionID).Return([]model.SyncRule{rule}, nil)
+				r.On("AppendBlock", ctx, rule.ID, messageID, mock.MatchedBy(func(b *model.Block) bool {
+					props := b.Props.Data()
+					return b.Type == model.BlockTypeText &&
+						*b.ParentID == pageID &&
+						b.Title == "assistant · 2025-01-02 03:04:05 UTC" &&
+						props["notes"] == "We go with Postgres.\n\nrecord({\"db\":\"pg\"})" &&
+						props["source_message_id"] == messageID.String()
+				})).Return(true, nil)
+			},
+		},
+		{
+			name: "message without the tag is skipped",
+			body: body,
+			msg:  message(map[string]any{"tags": []any{"chitchat"}}, model.Part{Type: "text", Text: "Hi"}),
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("ListEnabledForSession", ctx, sessionID).Return([]model.SyncRule{rule}, nil)
+			},
+		},
+		{
+			name: "no rules for the session",
+			body: body,
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("ListEnabledForSession", ctx, sessionID).Return([]model.SyncRule{}, nil)
+			},
+		},
+		{
+			name:  "malformed payload is dropped",
+			body:  []byte("not json"),
+			setup: func(r *MockSyncRuleRepo) {},
+		},
+		{
+			name: "append error is retried",
+			body: body,
+			msg:  message(map[string]any{"tags": "decision"}, model.Part{Type: "text", Text: "Ship it."}),
+			setup: func(r *MockSyncRuleRepo) {
+				r.On("ListEnabledForSession", ctx, sessionID).Return([]model.SyncRule{rule}, nil)
+				r.On("AppendBlock", ctx, rule.ID, messageID, mock.Anything).Return(false, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSyncRuleRepo{}
+			tt.setup(repo)
+
+			svc := NewSyncRuleService(repo, &stubMessageSessionService{msg: tt.msg}, zap.NewNop(), nil)
+			err := svc.HandleDelivery(ctx, tt.body)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
@@ -9,10 +9,15 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
 )
 
 type TaskService interface {
 	GetTasks(ctx context.Context, in GetTasksInput) (*GetTasksOutput, error)
+	GetJobTasks(ctx context.Context, in GetJobTasksInput) (*GetTasksOutput, error)
+	StartJob(ctx context.Context, projectID uuid.UUID, kind string, data map[string]interface{}) *model.Task
+	UpdateJob(ctx context.Context, task *model.Task, status string, data map[string]interface{})
+	FinishJob(ctx context.Context, task *model.Task, err error, data map[string]interface{})
 }
 
 type taskService struct {
@@ -71,3 +76,82 @@ func (s *taskService) GetTasks(ctx context.Context, in GetTasksInput) (*GetTasks
 
 	return out, nil
 }
+
+type GetJobTasksInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Kind      string    `json:"kind"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+// GetJobTasks lists the tasks tracking the long-running jobs of the server for a project
+func (s *taskService) GetJobTasks(ctx context.Context, in GetJobTasksInput) (*GetTasksOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	tasks, err := s.r.ListJobsWithCursor(ctx, in.ProjectID, in.Kind, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &GetTasksOutput{
+		Items:   tasks,
+		HasMore: false,
+	}
+	if len(tasks) > in.Limit {
+		out.HasMore = true
+		out.Items = tasks[:in.Limit]
+		last := out.Items[len(out.Items)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return out, nil
+}
+
+// StartJob creates a running task for a job of the server. Tracking never fails the job, the error is only
+// logged and a nil task returned, which UpdateJob and FinishJob ignore.
+func (s *taskService) StartJob(ctx context.Context, projectID uuid.UUID, kind string, data map[string]interface{}) *model.Task {
+	task, err := s.r.CreateJob(ctx, projectID, kind, data)
+	if err != nil {
+		s.log.Warn("create job task", zap.String("kind", kind), zap.Error(err))
+		return nil
+	}
+	return task
+}
+
+// UpdateJob sets the status of a job task and merges data into its data, typically its progress
+func (s *taskService) UpdateJob(ctx context.Context, task *model.Task, status string, data map[string]interface{}) {
+	if task == nil {
+		return
+	}
+	// the job may outlive the request that started it
+	ctx = context.WithoutCancel(ctx)
+	if err := s.r.UpdateJob(ctx, task.ID, status, datatypes.JSONMap(data)); err != nil {
+		s.log.Warn("update job task", zap.String("task_id", task.ID.String()), zap.Error(err))
+		return
+	}
+	task.Status = status
+}
+
+// FinishJob marks a job task successful, or failed with the message of err when err is not nil
+func (s *taskService) FinishJob(ctx context.Context, task *model.Task, err error, data map[string]interface{}) {
+	status := model.TaskStatusSuccess
+	if err != nil {
+		status = model.TaskStatusFailed
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data["error"] = err.Error()
+	}
+	s.UpdateJob(ctx, task, status, data)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+type ToolCallService interface {
+	List(ctx context.Context, in ListToolCallsInput) (*ListToolCallsOutput, error)
+}
+
+type toolCallService struct {
+	r repo.ToolCallRepo
+}
+
+func NewToolCallService(r repo.ToolCallRepo) ToolCallService {
+	return &toolCallService{r: r}
+}
+
+type ListToolCallsInput struct {
+	SessionID uuid.UUID
+	Name      string // keeps the calls of one tool
+	Pending   bool   // keeps the calls without result
+	Limit     int
+	Cursor    string
+}
+
+// ToolCallRecord is a tool call of a session paired with its result
+type ToolCallRecord struct {
+	ToolCallID      string     `json:"tool_call_id"`
+	Name            string     `json:"name"`
+	CallMessageID   *uuid.UUID `json:"call_message_id"`
+	CalledAt        *time.Time `json:"called_at"`
+	ResultMessageID *uuid.UUID `json:"result_message_id"`
+	ResultAt        *time.Time `json:"result_at"`
+	// LatencyMs is the time between the messages of the call and of the result, null until both are stored
+	LatencyMs *int64 `json:"latency_ms"`
+}
+
+type ListToolCallsOutput struct {
+	Items      []ToolCallRecord `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	HasMore    bool             `json:"has_more"`
+}
+
+func (s *toolCallService) List(ctx context.Context, in ListToolCallsInput) (*ListToolCallsOutput, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		if afterT, afterID, err = paging.DecodeCursor(in.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	links, err := s.r.ListBySession(ctx, in.SessionID, in.Name, in.Pending, afterT, afterID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListToolCallsOutput{Items: make([]ToolCallRecord, 0, len(links))}
+	if len(links) > in.Limit {
+		out.HasMore = true
+		links = links[:in.Limit]
+		last := links[len(links)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, l := range links {
+		rec := ToolCallRecord{
+			ToolCallID:      l.ToolCallID,
+			Name:            l.Name,
+			CallMessageID:   l.CallMessageID,
+			CalledAt:        l.CalledAt,
+			ResultMessageID: l.ResultMessageID,
+			ResultAt:        l.ResultAt,
+		}
+		if l.CalledAt != nil && l.ResultAt != nil {
+			latency := l.ResultAt.Sub(*l.CalledAt).Milliseconds()
+			rec.LatencyMs = &latency
+		}
+		out.Items = append(out.Items, rec)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeToolCallRepo struct {
+	links []model.ToolCallLink
+}
+
+func (r *fakeToolCallRepo) ListBySession(ctx context.Context, sessionID uuid.UUID, name string, pendingOnly bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.ToolCallLink, error) {
+	out := []model.ToolCallLink{}
+	for _, l := range r.links {
+		if l.SessionID != sessionID || (name != "" && l.Name != name) || (pendingOnly && l.ResultMessageID != nil) {
+			continue
+		}
+		if !afterCreatedAt.IsZero() && !l.CreatedAt.After(afterCreatedAt) {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out[:min(limit, len(out))], nil
+}
+
+func TestToolCallLinks(t *testing.T) {
+	msg := &model.Message{ID: uuid.New(), SessionID: uuid.New(), CreatedAt: time.Now(), Parts: []model.Part{
+		{Type: "text", Text: "checking"},
+		{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "get_weather"}},
+		{Type: "tool-call", Meta: map[string]any{"name": "legacy_function_call"}},
+		{Type: "tool-result", Meta: map[string]any{"tool_call_id": "call_0"}},
+		{Type: "tool-result", Meta: map[string]any{"tool_call_id": "call_0", "name": "search"}},
+		{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "get_forecast"}},
+	}}
+
+	calls, results := model.ToolCallLinks(msg)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "call_1", calls[0].ToolCallID)
+	assert.Equal(t, "get_weather", calls[0].Name)
+	assert.Equal(t, msg.ID, *calls[0].CallMessageID)
+	require.Len(t, results, 1)
+	assert.Equal(t, "call_0", results[0].ToolCallID)
+	assert.Equal(t, "search", results[0].Name)
+	assert.Equal(t, msg.ID, *results[0].ResultMessageID)
+}
+
+func TestToolCallService_List(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	start := time.Now().Add(-time.Hour)
+	result := start.Add(1500 * time.Millisecond)
+	callMsg, resultMsg := uuid.New(), uuid.New()
+
+	r := &fakeToolCallRepo{links: []model.ToolCallLink{
+		{ID: uuid.New(), SessionID: sessionID, ToolCallID: "call_1", Name: "search", CallMessageID: &callMsg, CalledAt: &start, ResultMessageID: &resultMsg, ResultAt: &result, CreatedAt: start},
+		{ID: uuid.New(), SessionID: sessionID, ToolCallID: "call_2", Name: "search", CallMessageID: &callMsg, CalledAt: &start, CreatedAt: start.Add(time.Second)},
+		{ID: uuid.New(), SessionID: sessionID, ToolCallID: "call_3", Name: "fetch", CallMessageID: &callMsg, CalledAt: &start, CreatedAt: start.Add(2 * time.Second)},
+	}}
+	svc := NewToolCallService(r)
+
+	out, err := svc.List(ctx, ListToolCallsInput{SessionID: sessionID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, out.Items, 2)
+	assert.True(t, out.HasMore)
+	require.NotNil(t, out.Items[0].LatencyMs)
+	assert.Equal(t, int64(1500), *out.Items[0].LatencyMs)
+	assert.Nil(t, out.Items[1].LatencyMs)
+
+	out, err = svc.List(ctx, ListToolCallsInput{SessionID: sessionID, Limit: 2, Cursor: out.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	assert.Equal(t, "call_3", out.Items[0].ToolCallID)
+	assert.False(t, out.HasMore)
+
+	out, err = svc.List(ctx, ListToolCallsInput{SessionID: sessionID, Name: "search", Pending: true, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	assert.Equal(t, "call_2", out.Items[0].ToolCallID)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"gorm.io/datatypes"
+)
+
+var ErrInvalidWindowPreset = errors.New("invalid window preset")
+
+// builtinWindowPresets are available to every project, a project preset with the same name replaces them
+var builtinWindowPresets = []model.WindowPreset{
+	{Name: "recent", Strategy: ContextStrategyRecent, MaxTokens: 8000, Format: string(model.FormatOpenAI)},
+	{Name: "summary+recent", Strategy: ContextStrategySummary, MaxTokens: 8000, Format: string(model.FormatOpenAI)},
+	{Name: "last-10-turns-plus-pins", Strategy: ContextStrategyRecent, MaxTokens: 8000, MaxTurns: 10, KeepPinned: true, Format: string(model.FormatOpenAI)},
+}
+
+type WindowPresetService interface {
+	List(ctx context.Context, project *model.Project) []model.WindowPreset
+	Update(ctx context.Context, project *model.Project, presets []model.WindowPreset) ([]model.WindowPreset, error)
+}
+
+type windowPresetService struct {
+	r repo.ProjectRepo
+}
+
+func NewWindowPresetService(r repo.ProjectRepo) WindowPresetService {
+	return &windowPresetService{r: r}
+}
+
+// List returns the built-in presets followed by the presets of the project, project presets replace built-ins of the same name
+func (s *windowPresetService) List(ctx context.Context, project *model.Project) []model.WindowPreset {
+	own := project.WindowPresets()
+	out := make([]model.WindowPreset, 0, len(builtinWindowPresets)+len(own))
+	for _, b := range builtinWindowPresets {
+		if _, ok := findWindowPreset(own, b.Name); !ok {
+			out = append(out, b)
+		}
+	}
+	return append(out, own...)
+}
+
+// Update replaces the presets of the project, built-in presets stay available
+func (s *windowPresetService) Update(ctx context.Context, project *model.Project, presets []model.WindowPreset) ([]model.WindowPreset, error) {
+	if project == nil {
+		return nil, errors.New("project is empty")
+	}
+
+	seen := make(map[string]bool, len(presets))
+	items := make([]interface{}, 0, len(presets))
+	for _, p := range presets {
+		if err := validateWindowPreset(p); err != nil {
+			return nil, err
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("%w: duplicate name %s", ErrInvalidWindowPreset, p.Name)
+		}
+		seen[p.Name] = true
+		items = append(items, map[string]interface{}{
+			"name":        p.Name,
+			"strategy":    p.Strategy,
+			"max_tokens":  p.MaxTokens,
+			"max_turns":   p.MaxTurns,
+			"keep_pinned": p.KeepPinned,
+			"format":      p.Format,
+		})
+	}
+
+	configs := datatypes.JSONMap{}
+	for k, v := range project.Configs {
+		configs[k] = v
+	}
+	if len(items) == 0 {
+		delete(configs, model.ProjectWindowPresetsConfigKey)
+	} else {
+		configs[model.ProjectWindowPresetsConfigKey] = items
+	}
+
+	if err := s.r.SetConfig(ctx, project.ID, model.ProjectWindowPresetsConfigKey, configs[model.ProjectWindowPresetsConfigKey]); err != nil {
+		return nil, err
+	}
+	project.Configs = configs
+	return s.List(ctx, project), nil
+}
+
+// ResolveWindowPreset finds the preset name of the project, falling back to the built-in presets
+func ResolveWindowPreset(project *model.Project, name string) (model.WindowPreset, bool) {
+	if p, ok := findWindowPreset(project.WindowPresets(), name); ok {
+		return p, true
+	}
+	return findWindowPreset(builtinWindowPresets, name)
+}
+
+func findWindowPreset(presets []model.WindowPreset, name string) (model.WindowPreset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return model.WindowPreset{}, false
+}
+
+func validateWindowPreset(p model.WindowPreset) error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidWindowPreset)
+	case p.Strategy != ContextStrategyRecent && p.Strategy != ContextStrategySummary:
+		return fmt.Errorf("%w: unknown strategy %q of %s", ErrInvalidWindowPreset, p.Strategy, p.Name)
+	case p.MaxTokens <= 0:
+		return fmt.Errorf("%w: max_tokens of %s must be positive", ErrInvalidWindowPreset, p.Name)
+	case p.MaxTurns < 0:
+		return fmt.Errorf("%w: max_turns of %s must not be negative", ErrInvalidWindowPreset, p.Name)
+	}
+	switch model.MessageFormat(p.Format) {
+	case model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini, model.FormatAISDK:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown format %q of %s", ErrInvalidWindowPreset, p.Format, p.Name)
+}
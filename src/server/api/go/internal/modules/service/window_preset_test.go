@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestWindowPresetService(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeProjectRepo{}
+	svc := NewWindowPresetService(r)
+	project := &model.Project{ID: uuid.New(), Configs: datatypes.JSONMap{"debug_timings": true}}
+
+	assert.Equal(t, builtinWindowPresets, svc.List(ctx, project))
+	preset, ok := ResolveWindowPreset(project, "last-10-turns-plus-pins")
+	require.True(t, ok)
+	assert.Equal(t, 10, preset.MaxTurns)
+	assert.True(t, preset.KeepPinned)
+
+	presets := []model.WindowPreset{
+		{Name: "recent", Strategy: ContextStrategyRecent, MaxTokens: 2000, Format: "anthropic"},
+		{Name: "last-3-turns", Strategy: ContextStrategySummary, MaxTokens: 4000, MaxTurns: 3, Format: "gemini"},
+	}
+	out, err := svc.Update(ctx, project, presets)
+	require.NoError(t, err)
+	assert.Len(t, out, 4)
+	assert.Equal(t, true, project.Configs["debug_timings"])
+
+	// The project preset replaces the built-in one, and presets read back from JSON hold float64 numbers
+	project.Configs = datatypes.JSONMap{model.ProjectWindowPresetsConfigKey: []interface{}{
+		map[string]interface{}{"name": "recent", "strategy": "recent", "max_tokens": float64(2000), "format": "anthropic"},
+	}}
+	preset, ok = ResolveWindowPreset(project, "recent")
+	require.True(t, ok)
+	assert.Equal(t, presets[0], preset)
+	_, ok = ResolveWindowPreset(project, "missing")
+	assert.False(t, ok)
+
+	for _, invalid := range []model.WindowPreset{
+		{Strategy: ContextStrategyRecent, MaxTokens: 100, Format: "openai"},
+		{Name: "a", Strategy: "oldest", MaxTokens: 100, Format: "openai"},
+		{Name: "a", Strategy: ContextStrategyRecent, Format: "openai"},
+		{Name: "a", Strategy: ContextStrategyRecent, MaxTokens: 100, Format: "xml"},
+	} {
+		_, err = svc.Update(ctx, project, []model.WindowPreset{invalid})
+		assert.ErrorIs(t, err, ErrInvalidWindowPreset)
+	}
+	_, err = svc.Update(ctx, project, []model.WindowPreset{presets[0], presets[0]})
+	assert.ErrorIs(t, err, ErrInvalidWindowPreset)
+
+	out, err = svc.Update(ctx, project, nil)
+	require.NoError(t, err)
+	assert.Equal(t, builtinWindowPresets, out)
+	assert.NotContains(t, r.configs, model.ProjectWindowPresetsConfigKey)
+}
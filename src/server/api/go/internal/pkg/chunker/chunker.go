@@ -0,0 +1,246 @@
+package chunker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+)
+
+const (
+	StrategyTokens   = "tokens"
+	StrategyHeadings = "headings"
+)
+
+// Config controls how text is split into chunks
+type Config struct {
+	Strategy      string `json:"strategy"`
+	MaxTokens     int    `json:"max_tokens"`
+	OverlapTokens int    `json:"overlap_tokens"`
+}
+
+// Validate checks that the config can be used to split text
+func (c Config) Validate() error {
+	if c.Strategy != StrategyTokens && c.Strategy != StrategyHeadings {
+		return fmt.Errorf("invalid chunk strategy: %s", c.Strategy)
+	}
+	if c.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive")
+	}
+	if c.OverlapTokens < 0 || c.OverlapTokens >= c.MaxTokens {
+		return fmt.Errorf("overlap_tokens must be in [0, max_tokens)")
+	}
+	return nil
+}
+
+// Chunk is a retrievable piece of a longer text
+type Chunk struct {
+	Index   int    `json:"index"`
+	Heading string `json:"heading,omitempty"`
+	Text    string `json:"text"`
+	Tokens  int    `json:"tokens"`
+}
+
+// CountFunc counts the tokens of a text
+type CountFunc func(text string) (int, error)
+
+type Chunker struct {
+	cfg   Config
+	count CountFunc
+}
+
+// New creates a Chunker counting tokens with the global tokenizer
+func New(cfg Config) (*Chunker, error) {
+	return NewWithCounter(cfg, tokenizer.CountTokens)
+}
+
+// NewWithCounter creates a Chunker with a custom token counter
+func NewWithCounter(cfg Config, count CountFunc) (*Chunker, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Chunker{cfg: cfg, count: count}, nil
+}
+
+// section is a run of paragraphs under the same heading
+type section struct {
+	heading    string
+	paragraphs []string
+}
+
+// Split splits text into chunks according to the configured strategy
+func (c *Chunker) Split(text string) ([]Chunk, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	var sections []section
+	if c.cfg.Strategy == StrategyHeadings {
+		sections = splitHeadings(text)
+	} else {
+		sections = []section{{paragraphs: splitParagraphs(text)}}
+	}
+
+	var chunks []Chunk
+	for _, sec := range sections {
+		packed, err := c.pack(sec)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range packed {
+			ch.Index = len(chunks)
+			chunks = append(chunks, ch)
+		}
+	}
+	return chunks, nil
+}
+
+// piece is an indivisible unit of text (a paragraph, or a word run of an oversized paragraph)
+type piece struct {
+	text   string
+	tokens int
+}
+
+// pack greedily packs paragraphs of a section into chunks of at most MaxTokens,
+// repeating trailing pieces of up to OverlapTokens at the start of the next chunk
+func (c *Chunker) pack(sec section) ([]Chunk, error) {
+	var pieces []piece
+	for _, p := range sec.paragraphs {
+		n, err := c.count(p)
+		if err != nil {
+			return nil, err
+		}
+		if n <= c.cfg.MaxTokens {
+			pieces = append(pieces, piece{text: p, tokens: n})
+			continue
+		}
+		// Oversized paragraph, fall back to splitting on words
+		words, err := c.splitWords(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			wn, err := c.count(w)
+			if err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, piece{text: w, tokens: wn})
+		}
+	}
+
+	var chunks []Chunk
+	start := 0
+	for start < len(pieces) {
+		end := start
+		tokens := 0
+		for end < len(pieces) && (end == start || tokens+pieces[end].tokens <= c.cfg.MaxTokens) {
+			tokens += pieces[end].tokens
+			end++
+		}
+
+		texts := make([]string, 0, end-start)
+		for _, p := range pieces[start:end] {
+			texts = append(texts, p.text)
+		}
+		chunks = append(chunks, Chunk{
+			Heading: sec.heading,
+			Text:    strings.Join(texts, "\n\n"),
+			Tokens:  tokens,
+		})
+		if end >= len(pieces) {
+			break
+		}
+
+		// Step back for the overlap, always making progress and leaving room for the next piece
+		next := end
+		overlap := 0
+		for next-1 > start && overlap+pieces[next-1].tokens <= c.cfg.OverlapTokens {
+			next--
+			overlap += pieces[next].tokens
+		}
+		for next < end && overlap+pieces[end].tokens > c.cfg.MaxTokens {
+			overlap -= pieces[next].tokens
+			next++
+		}
+		start = next
+	}
+	return chunks, nil
+}
+
+// splitWords splits an oversized paragraph into pieces of at most MaxTokens on word boundaries
+func (c *Chunker) splitWords(p string) ([]string, error) {
+	var out []string
+	var b strings.Builder
+	for _, w := range strings.Fields(p) {
+		candidate := w
+		if b.Len() > 0 {
+			candidate = b.String() + " " + w
+		}
+		n, err := c.count(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if n > c.cfg.MaxTokens && b.Len() > 0 {
+			out = append(out, b.String())
+			b.Reset()
+			candidate = w
+		}
+		b.Reset()
+		b.WriteString(candidate)
+	}
+	if b.Len() > 0 {
+		out = append(out, b.String())
+	}
+	return out, nil
+}
+
+func splitParagraphs(text string) []string {
+	var out []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// splitHeadings splits markdown text into sections at ATX headings (`#` .. `######`)
+func splitHeadings(text string) []section {
+	var sections []section
+	current := section{}
+	var body strings.Builder
+	inFence := false
+
+	closeSection := func() {
+		current.paragraphs = splitParagraphs(body.String())
+		if current.heading != "" || len(current.paragraphs) > 0 {
+			sections = append(sections, current)
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if !inFence && isHeading(trimmed) {
+			closeSection()
+			current = section{heading: strings.TrimSpace(strings.TrimLeft(trimmed, "#"))}
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	closeSection()
+	return sections
+}
+
+func isHeading(line string) bool {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	return level >= 1 && level <= 6 && (len(line) == level || line[level] == ' ')
+}
@@ -0,0 +1,100 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countWords is a deterministic token counter for tests
+func countWords(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "tokens", cfg: Config{Strategy: StrategyTokens, MaxTokens: 100, OverlapTokens: 10}},
+		{name: "headings", cfg: Config{Strategy: StrategyHeadings, MaxTokens: 100}},
+		{name: "unknown strategy", cfg: Config{Strategy: "lines", MaxTokens: 100}, wantErr: true},
+		{name: "zero max tokens", cfg: Config{Strategy: StrategyTokens}, wantErr: true},
+		{name: "overlap too large", cfg: Config{Strategy: StrategyTokens, MaxTokens: 10, OverlapTokens: 10}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestChunker_SplitTokens(t *testing.T) {
+	c, err := NewWithCounter(Config{Strategy: StrategyTokens, MaxTokens: 4}, countWords)
+	require.NoError(t, err)
+
+	chunks, err := c.Split("one two\n\nthree four\n\nfive six")
+	require.NoError(t, err)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "one two\n\nthree four", chunks[0].Text)
+	assert.Equal(t, 4, chunks[0].Tokens)
+	assert.Equal(t, "five six", chunks[1].Text)
+	assert.Equal(t, 1, chunks[1].Index)
+}
+
+func TestChunker_SplitOverlap(t *testing.T) {
+	c, err := NewWithCounter(Config{Strategy: StrategyTokens, MaxTokens: 4, OverlapTokens: 2}, countWords)
+	require.NoError(t, err)
+
+	chunks, err := c.Split("a b\n\nc d\n\ne f")
+	require.NoError(t, err)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "a b\n\nc d", chunks[0].Text)
+	assert.Equal(t, "c d\n\ne f", chunks[1].Text)
+}
+
+func TestChunker_SplitOversizedParagraph(t *testing.T) {
+	c, err := NewWithCounter(Config{Strategy: StrategyTokens, MaxTokens: 3}, countWords)
+	require.NoError(t, err)
+
+	chunks, err := c.Split("a b c d e f g")
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	for _, ch := range chunks {
+		assert.LessOrEqual(t, ch.Tokens, 3)
+	}
+	assert.Equal(t, "g", chunks[2].Text)
+}
+
+func TestChunker_SplitHeadings(t *testing.T) {
+	c, err := NewWithCounter(Config{Strategy: StrategyHeadings, MaxTokens: 100}, countWords)
+	require.NoError(t, err)
+
+	text := "intro text\n\n# Setup\n\ninstall it\n\n## Usage\n\n```\n# not a heading\n```\n\nrun it"
+	chunks, err := c.Split(text)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "", chunks[0].Heading)
+	assert.Equal(t, "intro text", chunks[0].Text)
+	assert.Equal(t, "Setup", chunks[1].Heading)
+	assert.Equal(t, "Usage", chunks[2].Heading)
+	assert.Contains(t, chunks[2].Text, "# not a heading")
+}
+
+func TestChunker_SplitEmpty(t *testing.T) {
+	c, err := NewWithCounter(Config{Strategy: StrategyTokens, MaxTokens: 10}, countWords)
+	require.NoError(t, err)
+
+	chunks, err := c.Split("  \n\n ")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+)
+
+// AISDKConverter converts messages to Vercel AI SDK `UIMessage` format
+type AISDKConverter struct{}
+
+// aisdkToolResult is a tool result waiting to be merged into the invocation of its call
+type aisdkToolResult struct {
+	text    string
+	isError bool
+}
+
+func (c *AISDKConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
+	result := make([]normalizer.AISDKUIMessage, 0, len(messages))
+
+	// The AI SDK keeps tool results in the invocation of the call, collect them first
+	// so that results stored in a later message (e.g. from openai format) are merged too
+	toolResults := map[string]aisdkToolResult{}
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if part.Type != "tool-result" || part.Meta == nil {
+				continue
+			}
+			id, _ := part.Meta["tool_call_id"].(string)
+			if id == "" {
+				continue
+			}
+			isError, _ := part.Meta["is_error"].(bool)
+			toolResults[id] = aisdkToolResult{text: part.Text, isError: isError}
+		}
+	}
+
+	for _, msg := range messages {
+		parts := c.convertParts(msg.Parts, publicURLs, toolResults)
+		// Messages only made of merged tool results have nothing left to show
+		if len(parts) == 0 {
+			continue
+		}
+
+		id, _ := msg.Meta.Data()["ui_message_id"].(string)
+		if id == "" {
+			id = msg.ID.String()
+		}
+
+		result = append(result, normalizer.AISDKUIMessage{
+			ID:        id,
+			Role:      msg.Role,
+			Content:   c.textContent(parts),
+			Parts:     parts,
+			CreatedAt: msg.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	return result, nil
+}
+
+// textContent builds the v4 `content` string from the text parts
+func (c *AISDKConverter) textContent(parts []normalizer.AISDKUIPart) string {
+	texts := []string{}
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (c *AISDKConverter) convertParts(parts []model.Part, publicURLs map[string]service.PublicURL, toolResults map[string]aisdkToolResult) []normalizer.AISDKUIPart {
+	result := make([]normalizer.AISDKUIPart, 0, len(parts))
+
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				result = append(result, normalizer.AISDKUIPart{Type: "text", Text: part.Text})
+			}
+
+		case "data":
+			// Only reasoning is shown by the AI SDK
+			if dataType, _ := part.Meta["data_type"].(string); dataType == "reasoning" && part.Text != "" {
+				result = append(result, normalizer.AISDKUIPart{Type: "reasoning", Reasoning: part.Text})
+			}
+
+		case "image", "audio", "video", "file":
+			if p := c.convertMediaPart(part, publicURLs); p != nil {
+				result = append(result, *p)
+			}
+
+		case "tool-call":
+			if p := c.convertToolCallPart(part, toolResults); p != nil {
+				result = append(result, *p)
+			}
+
+			// tool-result parts are merged into the invocation of their call
+		}
+	}
+
+	return result
+}
+
+func (c *AISDKConverter) convertMediaPart(part model.Part, publicURLs map[string]service.PublicURL) *normalizer.AISDKUIPart {
+	mediaType, _ := part.Meta["media_type"].(string)
+	if mediaType == "" && part.Asset != nil {
+		mediaType = part.Asset.MIME
+	}
+	filename := part.Filename
+	if filename == "" {
+		filename, _ = part.Meta["filename"].(string)
+	}
+
+	// Inline base64 data is sent back as is
+	if sourceType, _ := part.Meta["type"].(string); sourceType == "base64" {
+		if data, _ := part.Meta["data"].(string); data != "" {
+			return &normalizer.AISDKUIPart{Type: "file", MimeType: mediaType, Data: data, Filename: filename}
+		}
+	}
+
+	// Uploaded assets and URLs are referenced by url
+	url := assetURL(part.Asset, publicURLs)
+	if url == "" {
+		url, _ = part.Meta["url"].(string)
+	}
+	if url == "" {
+		return nil
+	}
+
+	return &normalizer.AISDKUIPart{Type: "file", MimeType: mediaType, URL: url, Filename: filename}
+}
+
+func (c *AISDKConverter) convertToolCallPart(part model.Part, toolResults map[string]aisdkToolResult) *normalizer.AISDKUIPart {
+	if part.Meta == nil {
+		return nil
+	}
+
+	// UNIFIED FORMAT: Extract from unified field names
+	id, _ := part.Meta["id"].(string)
+	name, _ := part.Meta["name"].(string)
+	if id == "" || name == "" {
+		return nil
+	}
+
+	// Parse arguments, fall back to the raw string
+	var args interface{} = map[string]interface{}{}
+	switch a := part.Meta["arguments"].(type) {
+	case string:
+		if err := json.Unmarshal([]byte(a), &args); err != nil {
+			args = a
+		}
+	case map[string]interface{}:
+		args = a
+	}
+
+	invocation := &normalizer.AISDKToolInvocation{
+		State:      "call",
+		ToolCallID: id,
+		ToolName:   name,
+		Args:       args,
+	}
+	if res, ok := toolResults[id]; ok {
+		invocation.State = "result"
+		invocation.Result = c.parseToolResult(res)
+	}
+
+	return &normalizer.AISDKUIPart{Type: "tool-invocation", ToolInvocation: invocation}
+}
+
+// parseToolResult returns JSON results as values and anything else as text
+func (c *AISDKConverter) parseToolResult(res aisdkToolResult) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(res.text), &value); err != nil || value == nil {
+		if res.isError {
+			// v4 has no error state, errors are reported as {"error": ...} by convention
+			return map[string]interface{}{"error": res.text}
+		}
+		return res.text
+	}
+	return value
+}
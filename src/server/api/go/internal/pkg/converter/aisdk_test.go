@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAISDKConverter_Convert_TextAndReasoning(t *testing.T) {
+	converter := &AISDKConverter{}
+
+	user := createTestMessage("user", []model.Part{{Type: "text", Text: "Hello"}}, map[string]any{"ui_message_id": "msg_1"})
+	assistant := createTestMessage("assistant", []model.Part{
+		{Type: "data", Text: "The user greets me.", Meta: map[string]any{"data_type": "reasoning"}},
+		{Type: "data", Meta: map[string]any{"data_type": "embedding"}},
+		{Type: "text", Text: "Hi!"},
+	}, nil)
+
+	result, err := converter.Convert([]model.Message{user, assistant}, nil)
+	require.NoError(t, err)
+
+	messages, ok := result.([]normalizer.AISDKUIMessage)
+	require.True(t, ok)
+	require.Len(t, messages, 2)
+
+	// The client id is kept, messages without one use the stored id
+	assert.Equal(t, "msg_1", messages[0].ID)
+	assert.Equal(t, "user", messages[0].Role)
+	assert.Equal(t, "Hello", messages[0].Content)
+	assert.Equal(t, assistant.ID.String(), messages[1].ID)
+
+	require.Len(t, messages[1].Parts, 2)
+	assert.Equal(t, "reasoning", messages[1].Parts[0].Type)
+	assert.Equal(t, "The user greets me.", messages[1].Parts[0].Reasoning)
+	assert.Equal(t, "Hi!", messages[1].Content)
+}
+
+func TestAISDKConverter_Convert_ToolInvocations(t *testing.T) {
+	converter := &AISDKConverter{}
+
+	// Results stored in a later user message (openai format) are merged into the call
+	messages := []model.Message{
+		createTestMessage("assistant", []model.Part{
+			{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "get_weather", "arguments": `{"location": "Paris"}`}},
+			{Type: "tool-call", Meta: map[string]any{"id": "call_2", "name": "get_time", "arguments": `{}`}},
+			{Type: "tool-call", Meta: map[string]any{"id": "call_3", "name": "search", "arguments": `{"q": "x"}`}},
+		}, nil),
+		createTestMessage("user", []model.Part{
+			{Type: "tool-result", Text: `{"temperature": 21}`, Meta: map[string]any{"tool_call_id": "call_1"}},
+			{Type: "tool-result", Text: "timeout", Meta: map[string]any{"tool_call_id": "call_2", "is_error": true}},
+		}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+
+	uiMessages := result.([]normalizer.AISDKUIMessage)
+	require.Len(t, uiMessages, 1)
+	require.Len(t, uiMessages[0].Parts, 3)
+
+	inv := uiMessages[0].Parts[0].ToolInvocation
+	require.NotNil(t, inv)
+	assert.Equal(t, "tool-invocation", uiMessages[0].Parts[0].Type)
+	assert.Equal(t, "result", inv.State)
+	assert.Equal(t, "get_weather", inv.ToolName)
+	assert.Equal(t, map[string]interface{}{"location": "Paris"}, inv.Args)
+	assert.Equal(t, map[string]interface{}{"temperature": float64(21)}, inv.Result)
+
+	inv = uiMessages[0].Parts[1].ToolInvocation
+	assert.Equal(t, "result", inv.State)
+	assert.Equal(t, map[string]interface{}{"error": "timeout"}, inv.Result)
+
+	// No result yet
+	inv = uiMessages[0].Parts[2].ToolInvocation
+	assert.Equal(t, "call", inv.State)
+	assert.Nil(t, inv.Result)
+}
+
+func TestAISDKConverter_Convert_Files(t *testing.T) {
+	converter := &AISDKConverter{}
+
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{
+			{Type: "image", Meta: map[string]any{"type": "base64", "media_type": "image/png", "data": "iVBORw0KG..."}},
+			{Type: "file", Filename: "report.pdf", Asset: &model.Asset{S3Key: "assets/report.pdf", SHA256: "sha-report", MIME: "application/pdf"}},
+			{Type: "audio"},
+		}, nil),
+	}
+	publicURLs := map[string]service.PublicURL{
+		"sha-report": {URL: "https://cdn.example.com/report.pdf"},
+	}
+
+	result, err := converter.Convert(messages, publicURLs)
+	require.NoError(t, err)
+
+	parts := result.([]normalizer.AISDKUIMessage)[0].Parts
+	require.Len(t, parts, 2)
+	assert.Equal(t, normalizer.AISDKUIPart{Type: "file", MimeType: "image/png", Data: "iVBORw0KG..."}, parts[0])
+	assert.Equal(t, normalizer.AISDKUIPart{
+		Type:     "file",
+		MimeType: "application/pdf",
+		URL:      "https://cdn.example.com/report.pdf",
+		Filename: "report.pdf",
+	}, parts[1])
+}
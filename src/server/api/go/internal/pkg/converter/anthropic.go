@@ -1,10 +1,7 @@
 package converter
 
 import (
-	"encoding/base64"
 	"encoding/json"
-	"io"
-	"net/http"
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -103,11 +100,9 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 
 		case "file":
 			// Convert file to document block
-			if part.Meta != nil {
-				docBlock := c.convertDocumentPart(part, publicURLs)
-				if docBlock != nil {
-					contentBlocks = append(contentBlocks, *docBlock)
-				}
+			docBlock := c.convertDocumentPart(part, publicURLs)
+			if docBlock != nil {
+				contentBlocks = append(contentBlocks, *docBlock)
 			}
 		}
 	}
@@ -117,7 +112,7 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 
 func (c *AnthropicConverter) convertImagePart(part model.Part, publicURLs map[string]service.PublicURL) *anthropic.ContentBlockParamUnion {
 	// Try to get image URL from asset
-	imageURL := c.getAssetURL(part.Asset, publicURLs)
+	imageURL := assetURL(part.Asset, publicURLs)
 	if imageURL == "" && part.Meta != nil {
 		if url, ok := part.Meta["url"].(string); ok {
 			imageURL = url
@@ -147,15 +142,9 @@ func (c *AnthropicConverter) convertImagePart(part model.Part, publicURLs map[st
 		return &block
 	}
 
-	// Try to download and convert to base64
-	if base64Data, mediaType := c.downloadImageAsBase64(imageURL); base64Data != "" {
-		block := anthropic.NewImageBlockBase64(mediaType, base64Data)
-		return &block
-	}
-
-	// Fall back to URL if available (note: Anthropic might not support URL directly for images in some contexts)
-	// In practice, we convert to base64
-	return nil
+	// Presigned and other URLs are passed as is, so the output can be sent straight to the Messages API
+	block := anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: imageURL})
+	return &block
 }
 
 func (c *AnthropicConverter) convertToolCallPart(part model.Part) *anthropic.ContentBlockParamUnion {
@@ -210,6 +199,14 @@ func (c *AnthropicConverter) convertToolResultPart(part model.Part) *anthropic.C
 }
 
 func (c *AnthropicConverter) convertDocumentPart(part model.Part, publicURLs map[string]service.PublicURL) *anthropic.ContentBlockParamUnion {
+	// Uploaded PDFs are referenced by their presigned URL
+	if part.Asset != nil && part.Asset.MIME == "application/pdf" {
+		if url := assetURL(part.Asset, publicURLs); url != "" {
+			block := anthropic.NewDocumentBlock(anthropic.URLPDFSourceParam{URL: url})
+			return &block
+		}
+	}
+
 	// Try to get document URL or base64 data from meta
 	if part.Meta == nil {
 		return nil
@@ -243,42 +240,3 @@ func (c *AnthropicConverter) convertDocumentPart(part model.Part, publicURLs map
 
 	return nil
 }
-
-func (c *AnthropicConverter) downloadImageAsBase64(imageURL string) (string, string) {
-	resp, err := http.Get(imageURL)
-	if err != nil {
-		return "", ""
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", ""
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", ""
-	}
-
-	// Determine media type
-	mediaType := resp.Header.Get("Content-Type")
-	if mediaType == "" {
-		mediaType = "image/png" // default
-	}
-
-	// Encode to base64
-	base64Data := base64.StdEncoding.EncodeToString(data)
-
-	return base64Data, mediaType
-}
-
-func (c *AnthropicConverter) getAssetURL(asset *model.Asset, publicURLs map[string]service.PublicURL) string {
-	if asset == nil {
-		return ""
-	}
-	assetKey := asset.S3Key
-	if publicURL, ok := publicURLs[assetKey]; ok {
-		return publicURL.URL
-	}
-	return ""
-}
@@ -3,6 +3,8 @@ package converter
 import (
 	"testing"
 
+	"github.com/anthropics/anthropic-sdk-go"
+
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/stretchr/testify/assert"
@@ -101,19 +103,35 @@ func TestAnthropicConverter_Convert_Image(t *testing.T) {
 				Type:     "image",
 				Filename: "image.jpg",
 				Asset: &model.Asset{
-					S3Key: "assets/image.jpg",
-					MIME:  "image/jpeg",
-					SizeB: 2048,
+					S3Key:  "assets/image.jpg",
+					SHA256: "sha-image",
+					MIME:   "image/jpeg",
+					SizeB:  2048,
 				},
 			},
+			{
+				Type:     "file",
+				Filename: "report.pdf",
+				Asset:    &model.Asset{S3Key: "assets/report.pdf", SHA256: "sha-report", MIME: "application/pdf"},
+			},
 		}, nil),
 	}
 
 	publicURLs := map[string]service.PublicURL{
-		"assets/image.jpg": {URL: "https://example.com/image.jpg"},
+		"sha-image":  {URL: "https://example.com/image.jpg"},
+		"sha-report": {URL: "https://example.com/report.pdf"},
 	}
 
 	result, err := converter.Convert(messages, publicURLs)
 	require.NoError(t, err)
-	assert.NotNil(t, result)
+
+	// The presigned urls are the sources of the blocks
+	content := result.([]anthropic.MessageParam)[0].Content
+	require.Len(t, content, 2)
+	require.NotNil(t, content[0].OfImage)
+	require.NotNil(t, content[0].OfImage.Source.OfURL)
+	assert.Equal(t, "https://example.com/image.jpg", content[0].OfImage.Source.OfURL.URL)
+	require.NotNil(t, content[1].OfDocument)
+	require.NotNil(t, content[1].OfDocument.Source.OfURL)
+	assert.Equal(t, "https://example.com/report.pdf", content[1].OfDocument.Source.OfURL.URL)
 }
@@ -36,6 +36,10 @@ func ConvertMessages(input ConvertMessagesInput) (interface{}, error) {
 		converter = &OpenAIConverter{}
 	case model.FormatAnthropic:
 		converter = &AnthropicConverter{}
+	case model.FormatGemini:
+		converter = &GeminiConverter{}
+	case model.FormatAISDK:
+		converter = &AISDKConverter{}
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -43,14 +47,26 @@ func ConvertMessages(input ConvertMessagesInput) (interface{}, error) {
 	return converter.Convert(input.Messages, input.PublicURLs)
 }
 
+// assetURL returns the presigned URL of an asset, public URLs are keyed by the SHA256 of the asset.
+// Assets without one, e.g. encrypted assets, have no URL.
+func assetURL(asset *model.Asset, publicURLs map[string]service.PublicURL) string {
+	if asset == nil {
+		return ""
+	}
+	if publicURL, ok := publicURLs[asset.SHA256]; ok {
+		return publicURL.URL
+	}
+	return ""
+}
+
 // ValidateFormat checks if the format is valid
 func ValidateFormat(format string) (model.MessageFormat, error) {
 	mf := model.MessageFormat(format)
 	switch mf {
-	case model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic:
+	case model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini, model.FormatAISDK:
 		return mf, nil
 	default:
-		return "", fmt.Errorf("invalid format: %s, supported formats: acontext, openai, anthropic", format)
+		return "", fmt.Errorf("invalid format: %s, supported formats: acontext, openai, anthropic, gemini, ai-sdk", format)
 	}
 }
 
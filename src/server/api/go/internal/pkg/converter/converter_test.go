@@ -78,6 +78,8 @@ func TestConvertMessages_AllFormats(t *testing.T) {
 		model.FormatAcontext,
 		model.FormatOpenAI,
 		model.FormatAnthropic,
+		model.FormatGemini,
+		model.FormatAISDK,
 	}
 
 	for _, format := range formats {
@@ -119,6 +121,18 @@ func TestValidateFormat(t *testing.T) {
 			want:    model.FormatAnthropic,
 			wantErr: false,
 		},
+		{
+			name:    "valid gemini",
+			format:  "gemini",
+			want:    model.FormatGemini,
+			wantErr: false,
+		},
+		{
+			name:    "valid ai-sdk",
+			format:  "ai-sdk",
+			want:    model.FormatAISDK,
+			wantErr: false,
+		},
 		{
 			name:    "invalid format",
 			format:  "invalid",
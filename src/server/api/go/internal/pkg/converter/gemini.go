@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"encoding/json"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+)
+
+// GeminiConverter converts messages to Gemini `contents` format
+type GeminiConverter struct{}
+
+func (c *GeminiConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
+	result := make([]normalizer.GeminiContent, 0, len(messages))
+
+	// Gemini matches function responses to calls by name, remember the name of every call
+	toolNames := map[string]string{}
+
+	for _, msg := range messages {
+		// Skip system messages - they should be handled separately via systemInstruction
+		if msg.Role == "system" {
+			continue
+		}
+
+		parts := c.convertParts(msg.Parts, publicURLs, toolNames)
+		// Gemini rejects contents without parts
+		if len(parts) == 0 {
+			continue
+		}
+
+		result = append(result, normalizer.GeminiContent{
+			Role:  c.convertRole(msg.Role),
+			Parts: parts,
+		})
+	}
+
+	return result, nil
+}
+
+func (c *GeminiConverter) convertRole(role string) string {
+	// Gemini roles: "user", "model"
+	// Note: "system" messages should be passed via the top-level systemInstruction
+	switch role {
+	case "assistant":
+		return "model"
+	default:
+		return "user"
+	}
+}
+
+func (c *GeminiConverter) convertParts(parts []model.Part, publicURLs map[string]service.PublicURL, toolNames map[string]string) []normalizer.GeminiPart {
+	result := make([]normalizer.GeminiPart, 0, len(parts))
+
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				result = append(result, normalizer.GeminiPart{Text: part.Text})
+			}
+
+		case "image", "audio", "video", "file":
+			if p := c.convertMediaPart(part, publicURLs); p != nil {
+				result = append(result, *p)
+			}
+
+		case "tool-call":
+			if p := c.convertToolCallPart(part, toolNames); p != nil {
+				result = append(result, *p)
+			}
+
+		case "tool-result":
+			if p := c.convertToolResultPart(part, toolNames); p != nil {
+				result = append(result, *p)
+			}
+		}
+	}
+
+	return result
+}
+
+func (c *GeminiConverter) convertMediaPart(part model.Part, publicURLs map[string]service.PublicURL) *normalizer.GeminiPart {
+	mediaType, _ := part.Meta["media_type"].(string)
+	if mediaType == "" && part.Asset != nil {
+		mediaType = part.Asset.MIME
+	}
+
+	// Inline base64 data is sent back as is
+	if sourceType, _ := part.Meta["type"].(string); sourceType == "base64" {
+		if data, _ := part.Meta["data"].(string); data != "" {
+			return &normalizer.GeminiPart{
+				InlineData: &normalizer.GeminiBlob{MimeType: mediaType, Data: data},
+			}
+		}
+	}
+
+	// Uploaded assets and URLs are referenced as file data
+	fileURI := assetURL(part.Asset, publicURLs)
+	if fileURI == "" {
+		fileURI, _ = part.Meta["url"].(string)
+	}
+	if fileURI == "" {
+		return nil
+	}
+
+	return &normalizer.GeminiPart{
+		FileData: &normalizer.GeminiFileData{MimeType: mediaType, FileURI: fileURI},
+	}
+}
+
+func (c *GeminiConverter) convertToolCallPart(part model.Part, toolNames map[string]string) *normalizer.GeminiPart {
+	if part.Meta == nil {
+		return nil
+	}
+
+	// UNIFIED FORMAT: Extract from unified field names
+	id, _ := part.Meta["id"].(string)
+	name, _ := part.Meta["name"].(string)
+	if name == "" {
+		return nil
+	}
+	if id != "" {
+		toolNames[id] = name
+	}
+
+	// Parse arguments, Gemini expects an object
+	args := map[string]interface{}{}
+	switch a := part.Meta["arguments"].(type) {
+	case string:
+		if err := json.Unmarshal([]byte(a), &args); err != nil {
+			args = map[string]interface{}{}
+		}
+	case map[string]interface{}:
+		args = a
+	}
+
+	call := &normalizer.GeminiFunctionCall{Name: name, Args: args}
+	// Ids defaulted to the function name by the normalizer are not real Gemini ids
+	if id != name {
+		call.ID = id
+	}
+
+	return &normalizer.GeminiPart{FunctionCall: call}
+}
+
+func (c *GeminiConverter) convertToolResultPart(part model.Part, toolNames map[string]string) *normalizer.GeminiPart {
+	if part.Meta == nil {
+		return nil
+	}
+
+	// UNIFIED FORMAT: Use tool_call_id (unified field name)
+	id, _ := part.Meta["tool_call_id"].(string)
+	if id == "" {
+		return nil
+	}
+	isError, _ := part.Meta["is_error"].(bool)
+
+	// Resolve the function name: stored by the Gemini normalizer, or from the matching call
+	name, _ := part.Meta["name"].(string)
+	if name == "" {
+		name = toolNames[id]
+	}
+	if name == "" {
+		name = id
+	}
+
+	// Gemini expects an object response, wrap plain text results
+	response := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(part.Text), &response); err != nil || response == nil {
+		key := "output"
+		if isError {
+			key = "error"
+		}
+		response = map[string]interface{}{key: part.Text}
+	}
+
+	resp := &normalizer.GeminiFunctionResponse{Name: name, Response: response}
+	if id != name {
+		resp.ID = id
+	}
+
+	return &normalizer.GeminiPart{FunctionResponse: resp}
+}
@@ -0,0 +1,127 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiConverter_Convert_Roles(t *testing.T) {
+	converter := &GeminiConverter{}
+
+	messages := []model.Message{
+		createTestMessage("system", []model.Part{{Type: "text", Text: "Be brief."}}, nil),
+		createTestMessage("user", []model.Part{{Type: "text", Text: "Hello"}}, nil),
+		createTestMessage("assistant", []model.Part{{Type: "text", Text: "Hi!"}}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+
+	contents, ok := result.([]normalizer.GeminiContent)
+	require.True(t, ok)
+	require.Len(t, contents, 2)
+	assert.Equal(t, "user", contents[0].Role)
+	assert.Equal(t, "Hello", contents[0].Parts[0].Text)
+	assert.Equal(t, "model", contents[1].Role)
+}
+
+func TestGeminiConverter_Convert_FunctionCalling(t *testing.T) {
+	converter := &GeminiConverter{}
+
+	// Tool calls stored from another format carry no function name on the result
+	messages := []model.Message{
+		createTestMessage("assistant", []model.Part{
+			{
+				Type: "tool-call",
+				Meta: map[string]any{
+					"id":        "call_123",
+					"name":      "get_weather",
+					"arguments": `{"location": "Paris"}`,
+				},
+			},
+		}, nil),
+		createTestMessage("user", []model.Part{
+			{
+				Type: "tool-result",
+				Text: "Sunny, 21C",
+				Meta: map[string]any{"tool_call_id": "call_123"},
+			},
+			{
+				Type: "tool-result",
+				Text: `{"temperature": 21}`,
+				Meta: map[string]any{"tool_call_id": "get_forecast", "name": "get_forecast"},
+			},
+		}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+
+	contents := result.([]normalizer.GeminiContent)
+	require.Len(t, contents, 2)
+
+	call := contents[0].Parts[0].FunctionCall
+	require.NotNil(t, call)
+	assert.Equal(t, "call_123", call.ID)
+	assert.Equal(t, "get_weather", call.Name)
+	assert.Equal(t, map[string]interface{}{"location": "Paris"}, call.Args)
+
+	resp := contents[1].Parts[0].FunctionResponse
+	require.NotNil(t, resp)
+	assert.Equal(t, "call_123", resp.ID)
+	assert.Equal(t, "get_weather", resp.Name)
+	assert.Equal(t, map[string]interface{}{"output": "Sunny, 21C"}, resp.Response)
+
+	// Ids defaulted to the function name are not sent back
+	resp = contents[1].Parts[1].FunctionResponse
+	require.NotNil(t, resp)
+	assert.Empty(t, resp.ID)
+	assert.Equal(t, "get_forecast", resp.Name)
+	assert.Equal(t, map[string]interface{}{"temperature": float64(21)}, resp.Response)
+}
+
+func TestGeminiConverter_Convert_Media(t *testing.T) {
+	converter := &GeminiConverter{}
+
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{
+			{
+				Type: "image",
+				Meta: map[string]any{"type": "base64", "media_type": "image/png", "data": "iVBORw0KG..."},
+			},
+			{
+				Type:  "file",
+				Asset: &model.Asset{S3Key: "assets/report.pdf", SHA256: "sha-report", MIME: "application/pdf"},
+			},
+			{
+				// No source available, dropped
+				Type: "audio",
+			},
+		}, nil),
+	}
+	publicURLs := map[string]service.PublicURL{
+		"sha-report": {URL: "https://cdn.example.com/report.pdf"},
+	}
+
+	result, err := converter.Convert(messages, publicURLs)
+	require.NoError(t, err)
+
+	contents := result.([]normalizer.GeminiContent)
+	require.Len(t, contents, 1)
+	require.Len(t, contents[0].Parts, 2)
+
+	inline := contents[0].Parts[0].InlineData
+	require.NotNil(t, inline)
+	assert.Equal(t, "image/png", inline.MimeType)
+	assert.Equal(t, "iVBORw0KG...", inline.Data)
+
+	file := contents[0].Parts[1].FileData
+	require.NotNil(t, file)
+	assert.Equal(t, "application/pdf", file.MimeType)
+	assert.Equal(t, "https://cdn.example.com/report.pdf", file.FileURI)
+}
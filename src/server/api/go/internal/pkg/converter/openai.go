@@ -74,7 +74,7 @@ func (c *OpenAIConverter) convertToUserMessage(msg model.Message, publicURLs map
 		case "text":
 			contentParts = append(contentParts, openai.TextContentPart(part.Text))
 		case "image":
-			imageURL := c.getAssetURL(part.Asset, publicURLs)
+			imageURL := assetURL(part.Asset, publicURLs)
 			if imageURL != "" {
 				detail := ""
 				if part.Meta != nil {
@@ -308,14 +308,3 @@ func (c *OpenAIConverter) extractToolResultContent(parts []model.Part) string {
 	}
 	return content
 }
-
-func (c *OpenAIConverter) getAssetURL(asset *model.Asset, publicURLs map[string]service.PublicURL) string {
-	if asset == nil {
-		return ""
-	}
-	assetKey := asset.S3Key
-	if publicURL, ok := publicURLs[assetKey]; ok {
-		return publicURL.URL
-	}
-	return ""
-}
@@ -3,7 +3,10 @@ package converter
 import (
 	"testing"
 
+	openai "github.com/openai/openai-go/v3"
+
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -67,3 +70,28 @@ func TestOpenAIConverter_Convert_ToolResult(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, result)
 }
+
+func TestOpenAIConverter_Convert_ImageURL(t *testing.T) {
+	converter := &OpenAIConverter{}
+
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{
+			{Type: "text", Text: "What is in this image?"},
+			{Type: "image", Asset: &model.Asset{S3Key: "assets/image.jpg", SHA256: "sha-image", MIME: "image/jpeg"}, Meta: map[string]any{"detail": "low"}},
+			{Type: "image", Asset: &model.Asset{S3Key: "assets/sealed.jpg", SHA256: "sha-sealed", Encrypted: true}},
+		}, nil),
+	}
+	publicURLs := map[string]service.PublicURL{
+		"sha-image": {URL: "https://example.com/image.jpg"},
+	}
+
+	result, err := converter.Convert(messages, publicURLs)
+	require.NoError(t, err)
+
+	// The presigned url is the image_url of the part, images without one are dropped
+	content := result.([]openai.ChatCompletionMessageParamUnion)[0].OfUser.Content.OfArrayOfContentParts
+	require.Len(t, content, 2)
+	require.NotNil(t, content[1].OfImageURL)
+	assert.Equal(t, "https://example.com/image.jpg", content[1].OfImageURL.ImageURL.URL)
+	assert.Equal(t, "low", content[1].OfImageURL.ImageURL.Detail)
+}
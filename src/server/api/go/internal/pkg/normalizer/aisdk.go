@@ -0,0 +1,266 @@
+package normalizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// AISDKUIMessage is a Vercel AI SDK `UIMessage` ({id, role, parts}).
+// The TypeScript types are mirrored here and shared with the converter.
+type AISDKUIMessage struct {
+	ID        string        `json:"id,omitempty"`
+	Role      string        `json:"role"`
+	Content   string        `json:"content,omitempty"`
+	Parts     []AISDKUIPart `json:"parts"`
+	CreatedAt string        `json:"createdAt,omitempty"`
+}
+
+// AISDKUIPart is a UIMessage part, the fields used depend on Type.
+// Both the v4 parts (tool-invocation, file with mimeType/data) and the v5 parts
+// (tool-<name>, dynamic-tool, file with mediaType/url) are accepted.
+type AISDKUIPart struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// reasoning
+	Reasoning string `json:"reasoning,omitempty"`
+
+	// file
+	MimeType  string `json:"mimeType,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+	Data      string `json:"data,omitempty"` // base64
+	URL       string `json:"url,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+
+	// tool-invocation
+	ToolInvocation *AISDKToolInvocation `json:"toolInvocation,omitempty"`
+
+	// tool-<name> and dynamic-tool
+	ToolCallID string      `json:"toolCallId,omitempty"`
+	ToolName   string      `json:"toolName,omitempty"`
+	State      string      `json:"state,omitempty"`
+	Input      interface{} `json:"input,omitempty"`
+	Output     interface{} `json:"output,omitempty"`
+	ErrorText  string      `json:"errorText,omitempty"`
+}
+
+// AISDKToolInvocation is the tool call of a v4 `tool-invocation` part, with its result once available
+type AISDKToolInvocation struct {
+	State      string      `json:"state"` // "partial-call" | "call" | "result"
+	ToolCallID string      `json:"toolCallId"`
+	ToolName   string      `json:"toolName"`
+	Args       interface{} `json:"args"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// AISDKNormalizer normalizes Vercel AI SDK format to internal format
+type AISDKNormalizer struct{}
+
+// NormalizeFromAISDKMessage converts a Vercel AI SDK UIMessage to internal format
+// Returns: role, parts, messageMeta, error
+func (n *AISDKNormalizer) NormalizeFromAISDKMessage(messageJSON json.RawMessage) (string, []service.PartIn, map[string]interface{}, error) {
+	var msg AISDKUIMessage
+	if err := json.Unmarshal(messageJSON, &msg); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to unmarshal AI SDK message: %w", err)
+	}
+
+	switch msg.Role {
+	case "user", "assistant", "system":
+	default:
+		return "", nil, nil, fmt.Errorf("invalid AI SDK role: %s (only 'user', 'assistant' and 'system' are supported)", msg.Role)
+	}
+
+	// v4 messages may only carry the legacy content string
+	if len(msg.Parts) == 0 && msg.Content != "" {
+		msg.Parts = []AISDKUIPart{{Type: "text", Text: msg.Content}}
+	}
+
+	parts := []service.PartIn{}
+	for i, p := range msg.Parts {
+		normalized, err := normalizeAISDKPart(p)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("parts[%d]: %w", i, err)
+		}
+		parts = append(parts, normalized...)
+	}
+
+	messageMeta := map[string]interface{}{
+		"source_format": "ai-sdk",
+	}
+	if msg.ID != "" {
+		messageMeta["ui_message_id"] = msg.ID
+	}
+
+	return msg.Role, parts, messageMeta, nil
+}
+
+// normalizeAISDKPart returns no part for the UI-only parts, and two parts for a tool invocation with its result
+func normalizeAISDKPart(p AISDKUIPart) ([]service.PartIn, error) {
+	switch {
+	case p.Type == "text":
+		if p.Text == "" {
+			return nil, nil
+		}
+		return []service.PartIn{{Type: "text", Text: p.Text}}, nil
+
+	case p.Type == "reasoning":
+		// v4 uses "reasoning", v5 uses "text"
+		text := firstNonEmpty(p.Reasoning, p.Text)
+		if text == "" {
+			return nil, nil
+		}
+		// Stored as a data part, so that the other formats leave it out
+		return []service.PartIn{{
+			Type: "data",
+			Text: text,
+			Meta: map[string]interface{}{"data_type": "reasoning"},
+		}}, nil
+
+	case p.Type == "file":
+		part, err := normalizeAISDKFilePart(p)
+		if err != nil {
+			return nil, err
+		}
+		return []service.PartIn{part}, nil
+
+	case p.Type == "tool-invocation":
+		if p.ToolInvocation == nil {
+			return nil, fmt.Errorf("tool-invocation requires toolInvocation")
+		}
+		inv := p.ToolInvocation
+		var result interface{}
+		hasResult := inv.State == "result"
+		if hasResult {
+			result = inv.Result
+		}
+		return normalizeAISDKToolPart(inv.ToolCallID, inv.ToolName, inv.Args, hasResult, result, false)
+
+	case p.Type == "dynamic-tool" || strings.HasPrefix(p.Type, "tool-"):
+		name := p.ToolName
+		if name == "" {
+			name = strings.TrimPrefix(p.Type, "tool-")
+		}
+		switch p.State {
+		case "output-available":
+			return normalizeAISDKToolPart(p.ToolCallID, name, p.Input, true, p.Output, false)
+		case "output-error":
+			return normalizeAISDKToolPart(p.ToolCallID, name, p.Input, true, p.ErrorText, true)
+		default:
+			return normalizeAISDKToolPart(p.ToolCallID, name, p.Input, false, nil, false)
+		}
+
+	case p.Type == "step-start" || p.Type == "source" || strings.HasPrefix(p.Type, "source-") || strings.HasPrefix(p.Type, "data-"):
+		// UI-only parts, nothing to keep
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported AI SDK part type: %s", p.Type)
+}
+
+func normalizeAISDKFilePart(p AISDKUIPart) (service.PartIn, error) {
+	mediaType := firstNonEmpty(p.MediaType, p.MimeType)
+
+	var meta map[string]interface{}
+	switch {
+	case p.Data != "":
+		meta = map[string]interface{}{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       p.Data,
+		}
+	case strings.HasPrefix(p.URL, "data:"):
+		// data:[<media type>][;base64],<data>
+		header, data, ok := strings.Cut(strings.TrimPrefix(p.URL, "data:"), ",")
+		if !ok {
+			return service.PartIn{}, fmt.Errorf("file has a malformed data url")
+		}
+		dataType, isBase64 := strings.CutSuffix(header, ";base64")
+		if !isBase64 {
+			data = base64.StdEncoding.EncodeToString([]byte(data))
+		}
+		if mediaType == "" {
+			mediaType = dataType
+		}
+		meta = map[string]interface{}{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       data,
+		}
+	case p.URL != "":
+		meta = map[string]interface{}{
+			"type": "url",
+			"url":  p.URL,
+		}
+		if mediaType != "" {
+			meta["media_type"] = mediaType
+		}
+	default:
+		return service.PartIn{}, fmt.Errorf("file requires data or url")
+	}
+
+	if p.Filename != "" {
+		meta["filename"] = p.Filename
+	}
+
+	return service.PartIn{
+		Type: mediaPartType(mediaType),
+		Meta: meta,
+	}, nil
+}
+
+// normalizeAISDKToolPart splits a tool invocation into a tool-call part and, once it has completed, a tool-result part
+func normalizeAISDKToolPart(id, name string, args interface{}, hasResult bool, result interface{}, isError bool) ([]service.PartIn, error) {
+	if id == "" || name == "" {
+		return nil, fmt.Errorf("tool invocation requires toolCallId and toolName")
+	}
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	argsBytes, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool invocation args: %w", err)
+	}
+
+	// UNIFIED FORMAT: tool-call with unified field names
+	parts := []service.PartIn{{
+		Type: "tool-call",
+		Meta: map[string]interface{}{
+			"id":        id,
+			"name":      name,
+			"arguments": string(argsBytes),
+			"type":      "tool-invocation", // Store original AI SDK type for reference
+		},
+	}}
+	if !hasResult {
+		return parts, nil
+	}
+
+	// Text results are kept as is, anything else as JSON
+	text, ok := result.(string)
+	if !ok {
+		resultBytes, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tool invocation result: %w", err)
+		}
+		text = string(resultBytes)
+	}
+
+	// UNIFIED FORMAT: tool_call_id, the result stays in the assistant message as in the AI SDK
+	parts = append(parts, service.PartIn{
+		Type: "tool-result",
+		Text: text,
+		Meta: map[string]interface{}{
+			"tool_call_id": id,
+			"name":         name,
+			"is_error":     isError,
+		},
+	})
+	return parts, nil
+}
@@ -0,0 +1,158 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAISDKNormalizer_NormalizeFromAISDKMessage(t *testing.T) {
+	normalizer := &AISDKNormalizer{}
+
+	tests := []struct {
+		name        string
+		input       string
+		wantRole    string
+		wantPartCnt int
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:        "user message with text",
+			input:       `{"id": "msg_1", "role": "user", "parts": [{"type": "text", "text": "Hello"}]}`,
+			wantRole:    "user",
+			wantPartCnt: 1,
+		},
+		{
+			name:        "legacy content without parts",
+			input:       `{"role": "user", "content": "Hello"}`,
+			wantRole:    "user",
+			wantPartCnt: 1,
+		},
+		{
+			name: "assistant message with reasoning and step start",
+			input: `{"role": "assistant", "parts": [
+				{"type": "step-start"},
+				{"type": "reasoning", "reasoning": "Thinking..."},
+				{"type": "text", "text": "Done."}
+			]}`,
+			wantRole:    "assistant",
+			wantPartCnt: 2,
+		},
+		{
+			name: "tool invocation with result",
+			input: `{"role": "assistant", "parts": [
+				{"type": "tool-invocation", "toolInvocation": {"state": "result", "toolCallId": "call_1", "toolName": "get_weather", "args": {"city": "Paris"}, "result": {"temp": 21}}}
+			]}`,
+			wantRole:    "assistant",
+			wantPartCnt: 2,
+		},
+		{
+			name: "v5 tool part waiting for its output",
+			input: `{"role": "assistant", "parts": [
+				{"type": "tool-get_weather", "toolCallId": "call_1", "state": "input-available", "input": {"city": "Paris"}}
+			]}`,
+			wantRole:    "assistant",
+			wantPartCnt: 1,
+		},
+		{
+			name: "files from data and urls",
+			input: `{"role": "user", "parts": [
+				{"type": "file", "mimeType": "image/png", "data": "iVBORw0KG..."},
+				{"type": "file", "mediaType": "application/pdf", "url": "https://example.com/a.pdf", "filename": "a.pdf"}
+			]}`,
+			wantRole:    "user",
+			wantPartCnt: 2,
+		},
+		{
+			name:        "invalid role",
+			input:       `{"role": "tool", "parts": [{"type": "text", "text": "Hello"}]}`,
+			wantErr:     true,
+			errContains: "invalid AI SDK role",
+		},
+		{
+			name:        "tool invocation without id",
+			input:       `{"role": "assistant", "parts": [{"type": "tool-invocation", "toolInvocation": {"state": "call", "toolName": "x"}}]}`,
+			wantErr:     true,
+			errContains: "toolCallId",
+		},
+		{
+			name:        "unsupported part type",
+			input:       `{"role": "user", "parts": [{"type": "unknown"}]}`,
+			wantErr:     true,
+			errContains: "unsupported AI SDK part type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, parts, meta, err := normalizer.NormalizeFromAISDKMessage(json.RawMessage(tt.input))
+
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRole, role)
+			assert.Len(t, parts, tt.wantPartCnt)
+			assert.Equal(t, "ai-sdk", meta["source_format"])
+		})
+	}
+}
+
+func TestAISDKNormalizer_ToolInvocation(t *testing.T) {
+	normalizer := &AISDKNormalizer{}
+
+	input := `{"id": "msg_1", "role": "assistant", "parts": [
+		{"type": "tool-invocation", "toolInvocation": {"state": "result", "toolCallId": "call_1", "toolName": "get_weather", "args": {"city": "Paris"}, "result": "Sunny"}},
+		{"type": "tool-search", "toolCallId": "call_2", "state": "output-error", "input": {"q": "x"}, "errorText": "timeout"}
+	]}`
+
+	_, parts, meta, err := normalizer.NormalizeFromAISDKMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	assert.Equal(t, "msg_1", meta["ui_message_id"])
+
+	assert.Equal(t, "tool-call", parts[0].Type)
+	assert.Equal(t, "call_1", parts[0].Meta["id"])
+	assert.Equal(t, "get_weather", parts[0].Meta["name"])
+	assert.Equal(t, `{"city":"Paris"}`, parts[0].Meta["arguments"])
+
+	assert.Equal(t, "tool-result", parts[1].Type)
+	assert.Equal(t, "Sunny", parts[1].Text)
+	assert.Equal(t, "call_1", parts[1].Meta["tool_call_id"])
+	assert.Equal(t, false, parts[1].Meta["is_error"])
+
+	assert.Equal(t, "search", parts[2].Meta["name"])
+	assert.Equal(t, "timeout", parts[3].Text)
+	assert.Equal(t, true, parts[3].Meta["is_error"])
+}
+
+func TestAISDKNormalizer_Files(t *testing.T) {
+	normalizer := &AISDKNormalizer{}
+
+	input := `{"role": "user", "parts": [
+		{"type": "file", "mediaType": "image/png", "url": "data:image/png;base64,iVBORw0KG..."},
+		{"type": "file", "mediaType": "application/pdf", "url": "https://example.com/a.pdf", "filename": "a.pdf"}
+	]}`
+
+	_, parts, _, err := normalizer.NormalizeFromAISDKMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+
+	// Data urls are stored inline
+	assert.Equal(t, "image", parts[0].Type)
+	assert.Equal(t, map[string]interface{}{"type": "base64", "media_type": "image/png", "data": "iVBORw0KG..."}, parts[0].Meta)
+
+	assert.Equal(t, "file", parts[1].Type)
+	assert.Equal(t, map[string]interface{}{
+		"type":       "url",
+		"url":        "https://example.com/a.pdf",
+		"media_type": "application/pdf",
+		"filename":   "a.pdf",
+	}, parts[1].Meta)
+}
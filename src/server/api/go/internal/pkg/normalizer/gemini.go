@@ -0,0 +1,255 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// GeminiContent is a Gemini `Content` object ({role, parts}).
+// There is no official Go SDK in use, so the wire format is mirrored here and shared with the converter.
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart is a Gemini `Part`. Exactly one of the fields is expected to be set.
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type GeminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type GeminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// UnmarshalJSON accepts both the camelCase (REST) and snake_case (Python SDK) field names
+func (p *GeminiPart) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Text                  string                  `json:"text"`
+		InlineData            *GeminiBlob             `json:"inlineData"`
+		InlineDataSnake       *GeminiBlob             `json:"inline_data"`
+		FileData              *GeminiFileData         `json:"fileData"`
+		FileDataSnake         *GeminiFileData         `json:"file_data"`
+		FunctionCall          *GeminiFunctionCall     `json:"functionCall"`
+		FunctionCallSnake     *GeminiFunctionCall     `json:"function_call"`
+		FunctionResponse      *GeminiFunctionResponse `json:"functionResponse"`
+		FunctionResponseSnake *GeminiFunctionResponse `json:"function_response"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.Text = raw.Text
+	p.InlineData = firstNonNil(raw.InlineData, raw.InlineDataSnake)
+	p.FileData = firstNonNil(raw.FileData, raw.FileDataSnake)
+	p.FunctionCall = firstNonNil(raw.FunctionCall, raw.FunctionCallSnake)
+	p.FunctionResponse = firstNonNil(raw.FunctionResponse, raw.FunctionResponseSnake)
+	return nil
+}
+
+func (b *GeminiBlob) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MimeType      string `json:"mimeType"`
+		MimeTypeSnake string `json:"mime_type"`
+		Data          string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	b.MimeType = firstNonEmpty(raw.MimeType, raw.MimeTypeSnake)
+	b.Data = raw.Data
+	return nil
+}
+
+func (f *GeminiFileData) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MimeType      string `json:"mimeType"`
+		MimeTypeSnake string `json:"mime_type"`
+		FileURI       string `json:"fileUri"`
+		FileURISnake  string `json:"file_uri"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.MimeType = firstNonEmpty(raw.MimeType, raw.MimeTypeSnake)
+	f.FileURI = firstNonEmpty(raw.FileURI, raw.FileURISnake)
+	return nil
+}
+
+func firstNonNil[T any](a, b *T) *T {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// GeminiNormalizer normalizes Gemini format to internal format
+type GeminiNormalizer struct{}
+
+// NormalizeFromGeminiMessage converts a Gemini Content to internal format
+// Returns: role, parts, messageMeta, error
+func (n *GeminiNormalizer) NormalizeFromGeminiMessage(messageJSON json.RawMessage) (string, []service.PartIn, map[string]interface{}, error) {
+	var content GeminiContent
+	if err := json.Unmarshal(messageJSON, &content); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to unmarshal Gemini message: %w", err)
+	}
+
+	// Gemini roles: "user" and "model"; "function" is accepted for older function response turns
+	var role string
+	switch content.Role {
+	case "user", "function", "":
+		role = "user"
+	case "model":
+		role = "assistant"
+	default:
+		return "", nil, nil, fmt.Errorf("invalid Gemini role: %s (only 'user' and 'model' are supported)", content.Role)
+	}
+
+	parts := []service.PartIn{}
+	for i, p := range content.Parts {
+		part, err := normalizeGeminiPart(p)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("parts[%d]: %w", i, err)
+		}
+		parts = append(parts, part)
+	}
+
+	messageMeta := map[string]interface{}{
+		"source_format": "gemini",
+	}
+
+	return role, parts, messageMeta, nil
+}
+
+func normalizeGeminiPart(p GeminiPart) (service.PartIn, error) {
+	switch {
+	case p.FunctionCall != nil:
+		if p.FunctionCall.Name == "" {
+			return service.PartIn{}, fmt.Errorf("functionCall requires name")
+		}
+		args := p.FunctionCall.Args
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		argsBytes, err := json.Marshal(args)
+		if err != nil {
+			return service.PartIn{}, fmt.Errorf("failed to marshal function call args: %w", err)
+		}
+
+		// Gemini function call ids are optional, calls are matched by name then
+		id := p.FunctionCall.ID
+		if id == "" {
+			id = p.FunctionCall.Name
+		}
+
+		// UNIFIED FORMAT: tool-call with unified field names
+		return service.PartIn{
+			Type: "tool-call",
+			Meta: map[string]interface{}{
+				"id":        id,
+				"name":      p.FunctionCall.Name,
+				"arguments": string(argsBytes),
+				"type":      "function_call", // Store original Gemini type for reference
+			},
+		}, nil
+
+	case p.FunctionResponse != nil:
+		if p.FunctionResponse.Name == "" {
+			return service.PartIn{}, fmt.Errorf("functionResponse requires name")
+		}
+		response := p.FunctionResponse.Response
+		if response == nil {
+			response = map[string]interface{}{}
+		}
+		responseBytes, err := json.Marshal(response)
+		if err != nil {
+			return service.PartIn{}, fmt.Errorf("failed to marshal function response: %w", err)
+		}
+
+		id := p.FunctionResponse.ID
+		if id == "" {
+			id = p.FunctionResponse.Name
+		}
+
+		// Gemini has no error flag, errors are reported as {"error": ...} by convention
+		_, isError := response["error"]
+
+		// UNIFIED FORMAT: tool_call_id, the function name is kept to rebuild the response
+		return service.PartIn{
+			Type: "tool-result",
+			Text: string(responseBytes),
+			Meta: map[string]interface{}{
+				"tool_call_id": id,
+				"name":         p.FunctionResponse.Name,
+				"is_error":     isError,
+			},
+		}, nil
+
+	case p.InlineData != nil:
+		if p.InlineData.Data == "" {
+			return service.PartIn{}, fmt.Errorf("inlineData requires data")
+		}
+		return service.PartIn{
+			Type: mediaPartType(p.InlineData.MimeType),
+			Meta: map[string]interface{}{
+				"type":       "base64",
+				"media_type": p.InlineData.MimeType,
+				"data":       p.InlineData.Data,
+			},
+		}, nil
+
+	case p.FileData != nil:
+		if p.FileData.FileURI == "" {
+			return service.PartIn{}, fmt.Errorf("fileData requires fileUri")
+		}
+		meta := map[string]interface{}{
+			"type": "url",
+			"url":  p.FileData.FileURI,
+		}
+		if p.FileData.MimeType != "" {
+			meta["media_type"] = p.FileData.MimeType
+		}
+		return service.PartIn{
+			Type: mediaPartType(p.FileData.MimeType),
+			Meta: meta,
+		}, nil
+
+	case p.Text != "":
+		return service.PartIn{
+			Type: "text",
+			Text: p.Text,
+		}, nil
+	}
+
+	return service.PartIn{}, fmt.Errorf("unsupported Gemini part")
+}
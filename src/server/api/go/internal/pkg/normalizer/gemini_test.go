@@ -0,0 +1,198 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiNormalizer_NormalizeFromGeminiMessage(t *testing.T) {
+	normalizer := &GeminiNormalizer{}
+
+	tests := []struct {
+		name        string
+		input       string
+		wantRole    string
+		wantPartCnt int
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:        "user message with text",
+			input:       `{"role": "user", "parts": [{"text": "Hello, how are you?"}]}`,
+			wantRole:    "user",
+			wantPartCnt: 1,
+		},
+		{
+			name:        "model message maps to assistant",
+			input:       `{"role": "model", "parts": [{"text": "Fine, thanks."}]}`,
+			wantRole:    "assistant",
+			wantPartCnt: 1,
+		},
+		{
+			name: "user message with inline image",
+			input: `{
+				"role": "user",
+				"parts": [
+					{"text": "What's in this image?"},
+					{"inlineData": {"mimeType": "image/png", "data": "iVBORw0KG..."}}
+				]
+			}`,
+			wantRole:    "user",
+			wantPartCnt: 2,
+		},
+		{
+			name: "model message with function call",
+			input: `{
+				"role": "model",
+				"parts": [{"functionCall": {"name": "get_weather", "args": {"location": "Paris"}}}]
+			}`,
+			wantRole:    "assistant",
+			wantPartCnt: 1,
+		},
+		{
+			name: "function role with function response",
+			input: `{
+				"role": "function",
+				"parts": [{"functionResponse": {"name": "get_weather", "response": {"temperature": 21}}}]
+			}`,
+			wantRole:    "user",
+			wantPartCnt: 1,
+		},
+		{
+			name:        "invalid role",
+			input:       `{"role": "system", "parts": [{"text": "System message"}]}`,
+			wantErr:     true,
+			errContains: "invalid Gemini role",
+		},
+		{
+			name:        "empty part",
+			input:       `{"role": "user", "parts": [{}]}`,
+			wantErr:     true,
+			errContains: "unsupported Gemini part",
+		},
+		{
+			name:        "function call without name",
+			input:       `{"role": "model", "parts": [{"functionCall": {"args": {}}}]}`,
+			wantErr:     true,
+			errContains: "functionCall requires name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, parts, messageMeta, err := normalizer.NormalizeFromGeminiMessage(json.RawMessage(tt.input))
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.errContains != "" {
+					assert.Contains(t, err.Error(), tt.errContains)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantRole, role)
+				assert.Len(t, parts, tt.wantPartCnt)
+				assert.Equal(t, "gemini", messageMeta["source_format"])
+			}
+		})
+	}
+}
+
+func TestGeminiNormalizer_PartTypes(t *testing.T) {
+	normalizer := &GeminiNormalizer{}
+
+	tests := []struct {
+		name         string
+		input        string
+		wantPartType string
+		wantText     string
+		checkMeta    func(t *testing.T, meta map[string]interface{})
+	}{
+		{
+			name:         "inline audio",
+			input:        `{"role": "user", "parts": [{"inlineData": {"mimeType": "audio/wav", "data": "UklGR..."}}]}`,
+			wantPartType: "audio",
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "base64", meta["type"])
+				assert.Equal(t, "audio/wav", meta["media_type"])
+				assert.Equal(t, "UklGR...", meta["data"])
+			},
+		},
+		{
+			name:         "snake case inline pdf",
+			input:        `{"role": "user", "parts": [{"inline_data": {"mime_type": "application/pdf", "data": "JVBERi..."}}]}`,
+			wantPartType: "file",
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "application/pdf", meta["media_type"])
+			},
+		},
+		{
+			name:         "file data",
+			input:        `{"role": "user", "parts": [{"fileData": {"mimeType": "image/jpeg", "fileUri": "gs://bucket/cat.jpg"}}]}`,
+			wantPartType: "image",
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "url", meta["type"])
+				assert.Equal(t, "gs://bucket/cat.jpg", meta["url"])
+			},
+		},
+		{
+			name:         "function call with id",
+			input:        `{"role": "model", "parts": [{"functionCall": {"id": "call_1", "name": "get_weather", "args": {"location": "Paris"}}}]}`,
+			wantPartType: "tool-call",
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "call_1", meta["id"])
+				assert.Equal(t, "get_weather", meta["name"])
+				assert.JSONEq(t, `{"location": "Paris"}`, meta["arguments"].(string))
+				assert.Equal(t, "function_call", meta["type"])
+			},
+		},
+		{
+			name:         "function call without id falls back to name",
+			input:        `{"role": "model", "parts": [{"function_call": {"name": "get_weather"}}]}`,
+			wantPartType: "tool-call",
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "get_weather", meta["id"])
+				assert.Equal(t, "{}", meta["arguments"])
+			},
+		},
+		{
+			name:         "function response",
+			input:        `{"role": "user", "parts": [{"functionResponse": {"id": "call_1", "name": "get_weather", "response": {"temperature": 21}}}]}`,
+			wantPartType: "tool-result",
+			wantText:     `{"temperature":21}`,
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, "call_1", meta["tool_call_id"])
+				assert.Equal(t, "get_weather", meta["name"])
+				assert.Equal(t, false, meta["is_error"])
+			},
+		},
+		{
+			name:         "function response with error",
+			input:        `{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"error": "unavailable"}}}]}`,
+			wantPartType: "tool-result",
+			wantText:     `{"error":"unavailable"}`,
+			checkMeta: func(t *testing.T, meta map[string]interface{}) {
+				assert.Equal(t, true, meta["is_error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, parts, _, err := normalizer.NormalizeFromGeminiMessage(json.RawMessage(tt.input))
+			require.NoError(t, err)
+			require.Len(t, parts, 1)
+
+			assert.Equal(t, tt.wantPartType, parts[0].Type)
+			if tt.wantText != "" {
+				assert.Equal(t, tt.wantText, parts[0].Text)
+			}
+			if tt.checkMeta != nil {
+				tt.checkMeta(t, parts[0].Meta)
+			}
+			assert.NoError(t, parts[0].Validate())
+		})
+	}
+}
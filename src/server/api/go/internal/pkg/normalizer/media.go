@@ -0,0 +1,17 @@
+package normalizer
+
+import "strings"
+
+// mediaPartType maps a mime type to the internal part type
+func mediaPartType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	default:
+		return "file"
+	}
+}
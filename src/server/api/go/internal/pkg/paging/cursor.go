@@ -38,3 +38,32 @@ func DecodeCursor(s string) (time.Time, uuid.UUID, error) {
 	}
 	return time.Unix(0, ns).UTC(), id, nil
 }
+
+// EncodeRankCursor encodes the position after a hit of a ranked search, the rank of the hit and its id
+func EncodeRankCursor(rank float32, id uuid.UUID) string {
+	raw := fmt.Sprintf("%s|%s", strconv.FormatFloat(float64(rank), 'g', -1, 32), id.String())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeRankCursor(s string) (float32, uuid.UUID, error) {
+	if s == "" {
+		return 0, uuid.Nil, errors.New("empty cursor")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 2 {
+		return 0, uuid.Nil, errors.New("bad cursor")
+	}
+	rank, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	return float32(rank), id, nil
+}
@@ -236,3 +236,18 @@ func TestCursor_URLSafe(t *testing.T) {
 		assert.NotContains(t, cursor, "=") // RawURLEncoding does not include padding characters
 	})
 }
+
+func TestRankCursor_Roundtrip(t *testing.T) {
+	id := uuid.New()
+	for _, rank := range []float32{0, 0.0607927, 1e-20, 0.1 + 0.2} {
+		rankOut, idOut, err := DecodeRankCursor(EncodeRankCursor(rank, id))
+		assert.NoError(t, err)
+		assert.Equal(t, rank, rankOut)
+		assert.Equal(t, id, idOut)
+	}
+
+	_, _, err := DecodeRankCursor("not-a-cursor")
+	assert.Error(t, err)
+	_, _, err = DecodeRankCursor("")
+	assert.Error(t, err)
+}
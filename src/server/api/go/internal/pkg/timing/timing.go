@@ -0,0 +1,75 @@
+// Package timing accumulates the time a request spends in its dependencies, for the debug timing breakdown.
+package timing
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Categories of the breakdown
+const (
+	DB      = "db"
+	S3      = "s3"
+	MQ      = "mq"
+	Convert = "convert"
+)
+
+// Recorder sums durations per category. Work done concurrently is summed too, so categories may add up to more than the request.
+type Recorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	totals map[string]time.Duration
+}
+
+type ctxKey struct{}
+
+// NewContext returns a context carrying a new recorder
+func NewContext(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{start: time.Now(), totals: map[string]time.Duration{}}
+	return context.WithValue(ctx, ctxKey{}, r), r
+}
+
+// FromContext returns the recorder of ctx, or nil when the request is not timed
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(ctxKey{}).(*Recorder)
+	return r
+}
+
+// Track starts timing category and returns the function stopping it, use as defer timing.Track(ctx, timing.S3)()
+func Track(ctx context.Context, category string) func() {
+	r := FromContext(ctx)
+	if r == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { r.Add(category, time.Since(start)) }
+}
+
+func (r *Recorder) Add(category string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals[category] += d
+}
+
+// Breakdown returns "<category>_ms" for every category and "total_ms" for the request so far, in milliseconds.
+// The standard categories are always present.
+func (r *Recorder) Breakdown() map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[string]float64{DB + "_ms": 0, S3 + "_ms": 0, MQ + "_ms": 0, Convert + "_ms": 0}
+	for category, d := range r.totals {
+		out[category+"_ms"] = millis(d)
+	}
+	out["total_ms"] = millis(time.Since(r.start))
+	return out
+}
+
+// millis rounds d to hundredths of a millisecond
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
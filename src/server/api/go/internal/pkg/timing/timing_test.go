@@ -0,0 +1,51 @@
+package timing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackWithoutRecorder(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+	// must not panic
+	Track(context.Background(), DB)()
+}
+
+func TestRecorder(t *testing.T) {
+	ctx, r := NewContext(context.Background())
+	require.Same(t, r, FromContext(ctx))
+
+	r.Add(DB, 1500*time.Microsecond)
+	r.Add(DB, 500*time.Microsecond)
+	r.Add(S3, 3*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Add(MQ, time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	b := r.Breakdown()
+	assert.Equal(t, 2.0, b["db_ms"])
+	assert.Equal(t, 3.0, b["s3_ms"])
+	assert.Equal(t, 10.0, b["mq_ms"])
+	assert.Equal(t, 0.0, b["convert_ms"])
+	assert.GreaterOrEqual(t, b["total_ms"], 0.0)
+}
+
+func TestTrack(t *testing.T) {
+	ctx, r := NewContext(context.Background())
+	stop := Track(ctx, Convert)
+	time.Sleep(2 * time.Millisecond)
+	stop()
+	assert.GreaterOrEqual(t, r.Breakdown()["convert_ms"], 2.0)
+}
@@ -52,6 +52,31 @@ func CountTokens(text string) (int, error) {
 	return count, nil
 }
 
+// TruncateTokens cuts text to its first maxTokens tokens
+func TruncateTokens(text string, maxTokens int) (string, error) {
+	if codec == nil {
+		return "", fmt.Errorf("tokenizer not initialized, call Init() first")
+	}
+	if maxTokens <= 0 {
+		return "", nil
+	}
+
+	ids, _, err := codec.Encode(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode text: %w", err)
+	}
+	if len(ids) <= maxTokens {
+		return text, nil
+	}
+
+	truncated, err := codec.Decode(ids[:maxTokens])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode tokens: %w", err)
+	}
+	// The cut may split a multi-byte character
+	return strings.ToValidUTF8(truncated, ""), nil
+}
+
 // ExtractTextAndToolContent extracts text and tool-call content from message parts
 func ExtractTextAndToolContent(parts []model.Part) (string, error) {
 	var content strings.Builder
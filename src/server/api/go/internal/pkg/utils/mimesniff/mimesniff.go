@@ -0,0 +1,113 @@
+package mimesniff
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// octetStream is what Detect returns when the content matches no known signature
+const octetStream = "application/octet-stream"
+
+// zipContainers are formats stored as zip archives, which the magic bytes report as application/zip
+var zipContainers = []string{
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.oasis.opendocument.",
+	"application/epub+zip",
+	"application/java-archive",
+	"application/vnd.android.package-archive",
+	"application/x-zip-compressed",
+}
+
+// preferredExts overrides the system MIME table, which may list several extensions in any order
+var preferredExts = map[string]string{
+	"text/plain":         ".txt",
+	"text/html":          ".html",
+	"text/xml":           ".xml",
+	"image/png":          ".png",
+	"image/jpeg":         ".jpg",
+	"image/gif":          ".gif",
+	"image/webp":         ".webp",
+	"image/bmp":          ".bmp",
+	"image/x-icon":       ".ico",
+	"application/pdf":    ".pdf",
+	"application/zip":    ".zip",
+	"application/x-gzip": ".gz",
+	"application/ogg":    ".ogg",
+	"audio/mpeg":         ".mp3",
+	"audio/wave":         ".wav",
+	"audio/aiff":         ".aiff",
+	"audio/midi":         ".mid",
+	"video/mp4":          ".mp4",
+	"video/webm":         ".webm",
+	"video/avi":          ".avi",
+	"font/woff":          ".woff",
+	"font/woff2":         ".woff2",
+	"font/ttf":           ".ttf",
+	"font/otf":           ".otf",
+}
+
+// BaseType returns the lowercased media type without parameters, e.g. "text/plain" for "text/plain; charset=utf-8"
+func BaseType(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// Detect returns the media type of content from its magic bytes, only the first 512 bytes are considered
+func Detect(content []byte) string {
+	return BaseType(http.DetectContentType(content))
+}
+
+// IsText reports whether a media type holds text that can be read as is
+func IsText(mimeType string) bool {
+	t := BaseType(mimeType)
+	if strings.HasPrefix(t, "text/") {
+		return true
+	}
+	if strings.HasSuffix(t, "+json") || strings.HasSuffix(t, "+xml") {
+		return true
+	}
+	switch t {
+	case "application/json", "application/xml", "application/javascript", "application/x-javascript",
+		"application/typescript", "application/x-yaml", "application/yaml", "application/x-ndjson",
+		"application/jsonl", "application/csv", "application/sql", "application/graphql",
+		"application/x-sh", "application/x-httpd-php", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// Compatible reports whether content detected as detected can be what the client declared.
+// The magic bytes only know a few formats, so only contradictions count as a mismatch.
+func Compatible(declared, detected string) bool {
+	declared, detected = BaseType(declared), BaseType(detected)
+	switch {
+	case declared == "" || declared == octetStream || declared == detected:
+		return true
+	case detected == octetStream:
+		// Binary in a format the magic bytes don't know
+		return !IsText(declared)
+	case detected == "text/plain", detected == "text/html", detected == "text/xml":
+		// Textual formats are told apart by their name, not their bytes
+		return IsText(declared)
+	case detected == "application/zip":
+		for _, prefix := range zipContainers {
+			if strings.HasPrefix(declared, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Extension returns the usual file extension for a media type, with the leading dot, or "" if unknown
+func Extension(mimeType string) string {
+	t := BaseType(mimeType)
+	if ext, ok := preferredExts[t]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(t); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
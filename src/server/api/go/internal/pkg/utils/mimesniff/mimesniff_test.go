@@ -0,0 +1,59 @@
+package mimesniff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, "image/png", Detect(pngHeader))
+	assert.Equal(t, "application/pdf", Detect([]byte("%PDF-1.7\n")))
+	assert.Equal(t, "text/plain", Detect([]byte(`{"a": 1}`)))
+	assert.Equal(t, "application/octet-stream", Detect([]byte{0x00, 0x01, 0x02, 0xff}))
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		detected string
+		want     bool
+	}{
+		{"same type", "image/png", "image/png", true},
+		{"parameters ignored", "text/plain; charset=utf-8", "text/plain", true},
+		{"nothing declared", "", "image/png", true},
+		{"generic binary declared", "application/octet-stream", "application/pdf", true},
+		{"json is plain text", "application/json", "text/plain", true},
+		{"csv is plain text", "text/csv", "text/plain", true},
+		{"docx is a zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", true},
+		{"unknown binary format", "application/vnd.apache.parquet", "application/octet-stream", true},
+		{"text that is binary", "text/plain", "application/octet-stream", false},
+		{"image that is text", "image/png", "text/plain", false},
+		{"png declared as jpeg", "image/jpeg", "image/png", false},
+		{"pdf declared as text", "text/markdown", "application/pdf", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Compatible(tt.declared, tt.detected))
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	assert.True(t, IsText("text/csv"))
+	assert.True(t, IsText("application/ld+json"))
+	assert.True(t, IsText("application/json; charset=utf-8"))
+	assert.False(t, IsText("image/png"))
+	assert.False(t, IsText("application/octet-stream"))
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, ".png", Extension("image/png"))
+	assert.Equal(t, ".jpg", Extension("image/jpeg"))
+	assert.Equal(t, ".txt", Extension("text/plain; charset=utf-8"))
+	assert.Equal(t, "", Extension("application/x-unknown-acontext"))
+}
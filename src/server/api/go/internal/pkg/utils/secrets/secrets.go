@@ -16,8 +16,19 @@ const (
 	Threads   = 4
 	KeyLen    = 32
 	SaltBytes = 16
+
+	SecretBytes = 32
 )
 
+// GenerateSecret returns a random URL-safe secret of SecretBytes bytes
+func GenerateSecret() (string, error) {
+	b := make([]byte, SecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func HashSecret(secret, pepper string) (string, error) {
 	if secret == "" {
 		return "", errors.New("empty secret")
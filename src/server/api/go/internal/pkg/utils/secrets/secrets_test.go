@@ -324,3 +324,15 @@ func base64DecodeString(s string) ([]byte, error) {
 	// Simplified handling here, should use base64.RawStdEncoding in practice
 	return []byte(s), nil // Simplified implementation, only for testing structure
 }
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	assert.NoError(t, err)
+	b, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Len(t, a, 43) // 32 bytes in unpadded base64
+	assert.NotContains(t, a, "+")
+	assert.NotContains(t, a, "/")
+}
@@ -0,0 +1,562 @@
+package tabular
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// Format is the layout of a tabular file, only row oriented text formats are streamed
+type Format string
+
+const (
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl"
+)
+
+var (
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrLimitExceeded = errors.New("query limit exceeded")
+	ErrInvalidData   = errors.New("file content does not match its format")
+)
+
+// Filter keeps the rows whose column compares to Value with Op.
+// Op is one of eq, ne, gt, gte, lt, lte, contains, in; for in, Value is a list.
+type Filter struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value"`
+}
+
+// Aggregate computes Func (count, sum, avg, min, max) over Column for each group.
+// count without column counts rows.
+type Aggregate struct {
+	Func   string `json:"func"`
+	Column string `json:"column,omitempty"`
+	As     string `json:"as,omitempty"`
+}
+
+type Order struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// Query selects, filters and aggregates the rows of a file.
+// Columns of JSONL rows are dotted paths into the objects, e.g. "user.name" or "items.0.price".
+type Query struct {
+	Select     []string    `json:"select,omitempty"`
+	Where      []Filter    `json:"where,omitempty"`
+	GroupBy    []string    `json:"group_by,omitempty"`
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+	OrderBy    []Order     `json:"order_by,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+}
+
+// Limits bound the work of a query
+type Limits struct {
+	MaxScanRows   int // rows read from the file
+	MaxResultRows int // rows returned, also the default limit
+	MaxSortRows   int // matching rows kept in memory to sort
+	MaxGroups     int // distinct groups of an aggregation
+}
+
+var DefaultLimits = Limits{
+	MaxScanRows:   5_000_000,
+	MaxResultRows: 1000,
+	MaxSortRows:   100_000,
+	MaxGroups:     10_000,
+}
+
+type Result struct {
+	// Columns of the rows, empty when whole JSONL objects are returned
+	Columns     []string                 `json:"columns"`
+	Rows        []map[string]interface{} `json:"rows"`
+	ScannedRows int                      `json:"scanned_rows"`
+	// Truncated is set when more rows matched than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// record is a row of the file
+type record interface {
+	get(column string) (interface{}, bool)
+}
+
+type csvRecord struct {
+	header map[string]int
+	values []string
+}
+
+func (r csvRecord) get(column string) (interface{}, bool) {
+	i, ok := r.header[column]
+	if !ok || i >= len(r.values) {
+		return nil, false
+	}
+	return r.values[i], true
+}
+
+type mapRecord map[string]interface{}
+
+func (r mapRecord) get(column string) (interface{}, bool) {
+	if v, ok := r[column]; ok {
+		return v, true
+	}
+	var cur interface{} = map[string]interface{}(r)
+	for _, key := range strings.Split(column, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func (q *Query) validate(lim Limits) error {
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+	if q.Limit == 0 || q.Limit > lim.MaxResultRows {
+		q.Limit = lim.MaxResultRows
+	}
+	if len(q.GroupBy) > 0 && len(q.Aggregates) == 0 {
+		return fmt.Errorf("%w: group_by requires aggregates", ErrInvalidQuery)
+	}
+	if len(q.Aggregates) > 0 && len(q.Select) > 0 {
+		return fmt.Errorf("%w: select can not be combined with aggregates, use group_by", ErrInvalidQuery)
+	}
+	for _, f := range q.Where {
+		switch f.Op {
+		case "eq", "ne", "gt", "gte", "lt", "lte", "contains":
+		case "in":
+			if _, ok := f.Value.([]interface{}); !ok {
+				return fmt.Errorf("%w: value of %s in filter must be a list", ErrInvalidQuery, f.Column)
+			}
+		default:
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, f.Op)
+		}
+	}
+	for _, a := range q.Aggregates {
+		switch a.Func {
+		case "count":
+		case "sum", "avg", "min", "max":
+			if a.Column == "" {
+				return fmt.Errorf("%w: %s requires a column", ErrInvalidQuery, a.Func)
+			}
+		default:
+			return fmt.Errorf("%w: unknown aggregate %q", ErrInvalidQuery, a.Func)
+		}
+	}
+	return nil
+}
+
+// Run executes q over the rows read from r
+func Run(ctx context.Context, r io.Reader, format Format, q Query, lim Limits) (*Result, error) {
+	if err := q.validate(lim); err != nil {
+		return nil, err
+	}
+
+	var next func() (record, error)
+	var header []string
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = false
+		first, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return &Result{Columns: []string{}, Rows: []map[string]interface{}{}}, nil
+			}
+			return nil, csvError(err)
+		}
+		header = first
+		index := make(map[string]int, len(header))
+		for i, name := range header {
+			index[name] = i
+		}
+		next = func() (record, error) {
+			values, err := reader.Read()
+			if err != nil {
+				return nil, csvError(err)
+			}
+			return csvRecord{header: index, values: values}, nil
+		}
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+		next = func() (record, error) {
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				row := map[string]interface{}{}
+				if err := sonic.UnmarshalString(line, &row); err != nil {
+					return nil, fmt.Errorf("%w: line is not a JSON object: %v", ErrInvalidData, err)
+				}
+				return mapRecord(row), nil
+			}
+			if err := scanner.Err(); err != nil {
+				if errors.Is(err, bufio.ErrTooLong) {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+				}
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidQuery, format)
+	}
+
+	columns := q.Select
+	if len(columns) == 0 && len(q.Aggregates) == 0 {
+		columns = header
+	}
+
+	res := &Result{}
+	var matched []record
+	var groups *aggregation
+	if len(q.Aggregates) > 0 {
+		groups = newAggregation(q.GroupBy, q.Aggregates)
+	}
+
+	for {
+		if res.ScannedRows%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		rec, err := next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		res.ScannedRows++
+		if res.ScannedRows > lim.MaxScanRows {
+			return nil, fmt.Errorf("%w: more than %d rows to scan", ErrLimitExceeded, lim.MaxScanRows)
+		}
+		if !matches(rec, q.Where) {
+			continue
+		}
+
+		if groups != nil {
+			if err := groups.add(rec, lim.MaxGroups); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		matched = append(matched, rec)
+		if len(q.OrderBy) == 0 {
+			// Without ordering, the first rows are the answer
+			if len(matched) > q.Limit {
+				break
+			}
+			continue
+		}
+		if len(matched) > lim.MaxSortRows {
+			return nil, fmt.Errorf("%w: more than %d matching rows to sort, narrow the filters", ErrLimitExceeded, lim.MaxSortRows)
+		}
+	}
+
+	if groups != nil {
+		matched = groups.rows()
+		columns = groups.columns()
+	}
+
+	if len(q.OrderBy) > 0 {
+		sortRecords(matched, q.OrderBy)
+	}
+	if len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		res.Truncated = true
+	}
+
+	res.Columns = columns
+	if res.Columns == nil {
+		res.Columns = []string{}
+	}
+	res.Rows = make([]map[string]interface{}, 0, len(matched))
+	for _, rec := range matched {
+		res.Rows = append(res.Rows, project(rec, columns))
+	}
+	return res, nil
+}
+
+// csvError flags malformed CSV as invalid data and passes read errors through
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	return err
+}
+
+// project returns the columns of rec, or the whole object of a JSONL row when no column is selected
+func project(rec record, columns []string) map[string]interface{} {
+	if len(columns) == 0 {
+		if m, ok := rec.(mapRecord); ok {
+			return m
+		}
+	}
+	row := make(map[string]interface{}, len(columns))
+	for _, col := range columns {
+		v, _ := rec.get(col)
+		row[col] = v
+	}
+	return row
+}
+
+func matches(rec record, filters []Filter) bool {
+	for _, f := range filters {
+		v, ok := rec.get(f.Column)
+		if !ok {
+			if f.Op == "ne" {
+				continue
+			}
+			return false
+		}
+		if !match(v, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func match(v interface{}, f Filter) bool {
+	switch f.Op {
+	case "contains":
+		return strings.Contains(toString(v), toString(f.Value))
+	case "in":
+		for _, candidate := range f.Value.([]interface{}) {
+			if compare(v, candidate) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := compare(v, f.Value)
+	switch f.Op {
+	case "eq":
+		return c == 0
+	case "ne":
+		return c != 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	}
+	return false
+}
+
+// compare orders values numerically when both are numbers, CSV cells included, and as strings otherwise
+func compare(a, b interface{}) int {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortRecords(recs []record, orders []Order) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		for _, o := range orders {
+			a, _ := recs[i].get(o.Column)
+			b, _ := recs[j].get(o.Column)
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if o.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// aggregation accumulates the aggregates of each group, in the order groups are first seen
+type aggregation struct {
+	groupBy    []string
+	aggregates []Aggregate
+	keys       []string
+	groups     map[string]*group
+}
+
+type group struct {
+	values []interface{}
+	states []aggState
+}
+
+type aggState struct {
+	count int
+	sum   float64
+	min   interface{}
+	max   interface{}
+}
+
+func newAggregation(groupBy []string, aggregates []Aggregate) *aggregation {
+	return &aggregation{groupBy: groupBy, aggregates: aggregates, groups: map[string]*group{}}
+}
+
+func (a *aggregation) add(rec record, maxGroups int) error {
+	values := make([]interface{}, len(a.groupBy))
+	keyParts := make([]string, len(a.groupBy))
+	for i, col := range a.groupBy {
+		v, _ := rec.get(col)
+		values[i] = v
+		keyParts[i] = toString(v)
+	}
+	key := strings.Join(keyParts, "\x00")
+
+	g, ok := a.groups[key]
+	if !ok {
+		if len(a.groups) >= maxGroups {
+			return fmt.Errorf("%w: more than %d groups", ErrLimitExceeded, maxGroups)
+		}
+		g = &group{values: values, states: make([]aggState, len(a.aggregates))}
+		a.groups[key] = g
+		a.keys = append(a.keys, key)
+	}
+
+	for i, agg := range a.aggregates {
+		st := &g.states[i]
+		if agg.Column == "" {
+			st.count++
+			continue
+		}
+		v, ok := rec.get(agg.Column)
+		if !ok || v == nil || toString(v) == "" {
+			continue
+		}
+		switch agg.Func {
+		case "count":
+			st.count++
+		case "sum", "avg":
+			if f, ok := toFloat(v); ok {
+				st.count++
+				st.sum += f
+			}
+		case "min":
+			if st.min == nil || compare(v, st.min) < 0 {
+				st.min = v
+			}
+		case "max":
+			if st.max == nil || compare(v, st.max) > 0 {
+				st.max = v
+			}
+		}
+	}
+	return nil
+}
+
+func (a *aggregation) columns() []string {
+	cols := append([]string{}, a.groupBy...)
+	for _, agg := range a.aggregates {
+		cols = append(cols, aggregateName(agg))
+	}
+	return cols
+}
+
+func (a *aggregation) rows() []record {
+	recs := make([]record, 0, len(a.keys))
+	for _, key := range a.keys {
+		g := a.groups[key]
+		row := mapRecord{}
+		for i, col := range a.groupBy {
+			row[col] = g.values[i]
+		}
+		for i, agg := range a.aggregates {
+			st := g.states[i]
+			var v interface{}
+			switch agg.Func {
+			case "count":
+				v = st.count
+			case "sum":
+				v = st.sum
+			case "avg":
+				if st.count > 0 {
+					v = st.sum / float64(st.count)
+				}
+			case "min":
+				v = st.min
+			case "max":
+				v = st.max
+			}
+			row[aggregateName(agg)] = v
+		}
+		recs = append(recs, row)
+	}
+	return recs
+}
+
+func aggregateName(agg Aggregate) string {
+	if agg.As != "" {
+		return agg.As
+	}
+	if agg.Column == "" {
+		return agg.Func
+	}
+	return agg.Func + "(" + agg.Column + ")"
+}
@@ -0,0 +1,111 @@
+package tabular
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ordersCSV = `id,customer,amount,status
+1,alice,10.5,paid
+2,bob,20,paid
+3,alice,5,refunded
+4,carol,100,paid
+5,bob,7.5,pending
+`
+
+const eventsJSONL = `{"type": "click", "user": {"name": "alice"}, "ms": 120}
+{"type": "view", "user": {"name": "bob"}, "ms": 40}
+
+{"type": "click", "user": {"name": "bob"}, "ms": 80}
+`
+
+func TestRun_CSVFilterSortLimit(t *testing.T) {
+	res, err := Run(context.Background(), strings.NewReader(ordersCSV), FormatCSV, Query{
+		Select:  []string{"id", "amount"},
+		Where:   []Filter{{Column: "status", Op: "eq", Value: "paid"}},
+		OrderBy: []Order{{Column: "amount", Desc: true}},
+		Limit:   2,
+	}, DefaultLimits)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"id", "amount"}, res.Columns)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": "4", "amount": "100"},
+		{"id": "2", "amount": "20"},
+	}, res.Rows)
+	assert.Equal(t, 5, res.ScannedRows)
+	assert.True(t, res.Truncated)
+}
+
+func TestRun_CSVGroupBy(t *testing.T) {
+	res, err := Run(context.Background(), strings.NewReader(ordersCSV), FormatCSV, Query{
+		Where:   []Filter{{Column: "status", Op: "in", Value: []interface{}{"paid", "pending"}}},
+		GroupBy: []string{"customer"},
+		Aggregates: []Aggregate{
+			{Func: "count"},
+			{Func: "sum", Column: "amount", As: "total"},
+		},
+		OrderBy: []Order{{Column: "total"}},
+	}, DefaultLimits)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"customer", "count", "total"}, res.Columns)
+	assert.Equal(t, []map[string]interface{}{
+		{"customer": "alice", "count": 1, "total": 10.5},
+		{"customer": "bob", "count": 2, "total": 27.5},
+		{"customer": "carol", "count": 1, "total": 100.0},
+	}, res.Rows)
+	assert.False(t, res.Truncated)
+}
+
+func TestRun_JSONLPaths(t *testing.T) {
+	res, err := Run(context.Background(), strings.NewReader(eventsJSONL), FormatJSONL, Query{
+		Where:   []Filter{{Column: "type", Op: "eq", Value: "click"}},
+		GroupBy: []string{"user.name"},
+		Aggregates: []Aggregate{
+			{Func: "avg", Column: "ms"},
+			{Func: "max", Column: "ms"},
+		},
+	}, DefaultLimits)
+	require.NoError(t, err)
+
+	assert.Equal(t, []map[string]interface{}{
+		{"user.name": "alice", "avg(ms)": 120.0, "max(ms)": 120.0},
+		{"user.name": "bob", "avg(ms)": 80.0, "max(ms)": 80.0},
+	}, res.Rows)
+	assert.Equal(t, 3, res.ScannedRows)
+}
+
+func TestRun_JSONLWholeRows(t *testing.T) {
+	res, err := Run(context.Background(), strings.NewReader(eventsJSONL), FormatJSONL, Query{
+		Where: []Filter{{Column: "ms", Op: "lt", Value: 100}},
+	}, DefaultLimits)
+	require.NoError(t, err)
+
+	assert.Empty(t, res.Columns)
+	require.Len(t, res.Rows, 2)
+	assert.Equal(t, "view", res.Rows[0]["type"])
+}
+
+func TestRun_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Run(ctx, strings.NewReader(ordersCSV), FormatCSV, Query{GroupBy: []string{"customer"}}, DefaultLimits)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	_, err = Run(ctx, strings.NewReader(ordersCSV), FormatCSV, Query{Where: []Filter{{Column: "id", Op: "like", Value: "1"}}}, DefaultLimits)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	_, err = Run(ctx, strings.NewReader(ordersCSV), FormatCSV, Query{OrderBy: []Order{{Column: "id"}}}, Limits{MaxScanRows: 3, MaxResultRows: 10, MaxSortRows: 10, MaxGroups: 10})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	_, err = Run(ctx, strings.NewReader(ordersCSV), FormatCSV, Query{GroupBy: []string{"id"}, Aggregates: []Aggregate{{Func: "count"}}}, Limits{MaxScanRows: 10, MaxResultRows: 10, MaxSortRows: 10, MaxGroups: 2})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	_, err = Run(ctx, strings.NewReader("{\"a\": 1}\nnot json\n"), FormatJSONL, Query{}, DefaultLimits)
+	assert.ErrorIs(t, err, ErrInvalidData)
+}
@@ -1,20 +1,34 @@
 package router
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	_ "github.com/memodb-io/Acontext/docs"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/incident"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/timing"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/secrets"
 	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
 	"github.com/memodb-io/Acontext/internal/telemetry"
@@ -38,37 +52,64 @@ func zapLoggerMiddleware(log *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-// projectAuthMiddleware
-func projectAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+// projectAuthMiddleware authenticates the project of a request by its bearer token.
+// IPs and tokens failing verification too often are locked out and refused with 429 until the lockout ends.
+func projectAuthMiddleware(cfg *config.Config, db *gorm.DB, guard service.AuthGuardService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ip := c.ClientIP()
 		auth := c.GetHeader("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") {
+		raw := strings.TrimPrefix(auth, "Bearer ")
+		token := ""
+		if raw != auth {
+			token = raw
+		}
+
+		if retryAfter, locked := guard.Locked(ctx, ip, token); locked {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, serializer.Err(http.StatusTooManyRequests, "too many failed authentications, try again later", nil))
+			return
+		}
+		unauthorized := func(reason string) {
+			guard.RecordFailure(ctx, ip, token, reason)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+		}
+
+		if token == "" {
+			unauthorized("missing bearer token")
 			return
 		}
-		raw := strings.TrimPrefix(auth, "Bearer ")
 
 		secret, ok := tokens.ParseToken(raw, cfg.Root.ProjectBearerTokenPrefix)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+			unauthorized("malformed token")
 			return
 		}
 
 		lookup := tokens.HMAC256Hex(cfg.Root.SecretPepper, secret)
 
+		// The previous key of a rotation is accepted until it expires
+		now := time.Now()
 		var project model.Project
-		if err := db.WithContext(c.Request.Context()).Where(&model.Project{SecretKeyHMAC: lookup}).First(&project).Error; err != nil {
+		if err := db.WithContext(ctx).Where("secret_key_hmac = ?", lookup).
+			Or("previous_secret_key_hmac = ? AND previous_key_expires_at > ?", lookup, now).
+			First(&project).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+				unauthorized("unknown token")
 				return
 			}
 			c.AbortWithStatusJSON(http.StatusInternalServerError, serializer.DBErr("", err))
 			return
 		}
 
-		pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, project.SecretKeyHashPHC)
+		phc := project.SecretKeyHashPHC
+		if project.SecretKeyHMAC != lookup {
+			phc = project.PreviousSecretKeyHashPHC
+			c.Header("X-Acontext-Key-Expires-At", project.PreviousKeyExpiresAt.UTC().Format(time.RFC3339))
+		}
+		pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, phc)
 		if err != nil || !pass {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+			unauthorized("secret mismatch")
 			return
 		}
 
@@ -77,17 +118,264 @@ func projectAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// networkAccessMiddleware refuses requests from client IPs the network access rules of the project deny.
+// A valid key used from a denied IP is recorded as a misuse of the key.
+func networkAccessMiddleware(guard service.AuthGuardService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := c.Get("project")
+		if !ok {
+			c.Next()
+			return
+		}
+		p := project.(*model.Project)
+		if !p.NetworkAccess().Allows(net.ParseIP(c.ClientIP())) {
+			// only the first misuse of a window is recorded, a client hanging up must not cancel it
+			ctx := context.WithoutCancel(c.Request.Context())
+			tokenPrefix := service.AuthTokenPrefix(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+			guard.RecordMisuse(ctx, p, c.ClientIP(), tokenPrefix, "client IP denied by network access rules")
+
+			c.AbortWithStatusJSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "client IP is not allowed for this project", nil))
+			return
+		}
+		c.Next()
+	}
+}
+
+// problemWriter holds back error bodies so they can be rewritten as problem details
+type problemWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *problemWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// problemJSONMiddleware sends error responses as RFC 9457 problem details to clients accepting application/problem+json.
+// Other clients keep receiving serializer.Response.
+func problemJSONMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !serializer.AcceptsProblem(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		w := &problemWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.body.Len() == 0 {
+			return
+		}
+		status := w.Status()
+		res := serializer.Response{}
+		if err := sonic.Unmarshal(w.body.Bytes(), &res); err != nil || res.Msg == "" && res.ErrorCode == "" {
+			// not a serializer.Response, pass it through unchanged
+			_, _ = w.ResponseWriter.Write(w.body.Bytes())
+			return
+		}
+		problem := serializer.NewProblem(status, res)
+		if id := w.Header().Get(serializer.IncidentIDHeader); id != "" {
+			problem.Instance = serializer.IncidentInstancePrefix + id
+		}
+		body, err := sonic.Marshal(problem)
+		if err != nil {
+			_, _ = w.ResponseWriter.Write(w.body.Bytes())
+			return
+		}
+		w.Header().Set("Content-Type", serializer.ProblemContentType)
+		_, _ = w.ResponseWriter.Write(body)
+	}
+}
+
+// panicsRecovered counts the panics recovered by recoveryMiddleware, served with the other expvars at /debug/vars
+var panicsRecovered = expvar.NewInt("panics_recovered_total")
+
+// IncidentResp is the data of the 500 response to a recovered panic
+type IncidentResp struct {
+	IncidentID string `json:"incident_id"`
+}
+
+// recoveryMiddleware recovers panics of handlers: the panic and its stack are logged and reported under an incident id,
+// which is returned to the client in a 500 response and the X-Acontext-Incident-Id header.
+// It is the first middleware, so it also recovers panics of the others and answers problem details itself.
+func recoveryMiddleware(log *zap.Logger, reporter *incident.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// middlewares holding back bodies swap the writer, a panic leaves their writer in place
+		writer := c.Writer
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// the handler gave up on the response on purpose
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			inc := incident.Incident{
+				ID:      uuid.NewString(),
+				Panic:   fmt.Sprint(rec),
+				Stack:   string(debug.Stack()),
+				Method:  c.Request.Method,
+				Path:    c.FullPath(),
+				TraceID: c.Writer.Header().Get("X-Trace-Id"),
+				At:      time.Now(),
+			}
+			if inc.Path == "" {
+				inc.Path = c.Request.URL.Path
+			}
+			panicsRecovered.Add(1)
+			log.Error("panic recovered",
+				zap.String("incident_id", inc.ID),
+				zap.String("panic", inc.Panic),
+				zap.String("method", inc.Method),
+				zap.String("path", inc.Path),
+				zap.String("stack", inc.Stack),
+			)
+			reporter.Report(inc)
+
+			c.Writer = writer
+			// the status and part of the body may already be sent, the client then sees a broken response
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.Header(serializer.IncidentIDHeader, inc.ID)
+			res := serializer.Err(http.StatusInternalServerError, "internal server error, incident "+inc.ID, nil)
+			res.Data = IncidentResp{IncidentID: inc.ID}
+			if serializer.AcceptsProblem(c.GetHeader("Accept")) {
+				problem := serializer.NewProblem(http.StatusInternalServerError, res)
+				problem.Instance = serializer.IncidentInstancePrefix + inc.ID
+				c.Header("Content-Type", serializer.ProblemContentType)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, problem)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, res)
+		}()
+		c.Next()
+	}
+}
+
+// DebugHeader asks for the timing breakdown of a request, projects enable it with the debug_timings config
+const DebugHeader = "X-Acontext-Debug"
+
+// debugWriter holds back JSON bodies so the timing breakdown can be added to them, other bodies such as streams pass through
+type debugWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *debugWriter) Write(b []byte) (int, error) {
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *debugWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// debugTimingMiddleware adds a "debug" object with the db_ms, s3_ms, mq_ms, convert_ms and total_ms of the request
+// to JSON responses, when the request sends X-Acontext-Debug and its project enabled debug timings
+func debugTimingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enabled, _ := strconv.ParseBool(c.GetHeader(DebugHeader))
+		project, ok := c.Get("project")
+		if !enabled || !ok || !project.(*model.Project).DebugTimingsEnabled() {
+			c.Next()
+			return
+		}
+
+		ctx, rec := timing.NewContext(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		w := &debugWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.body.Len() == 0 {
+			return
+		}
+		body := bytes.TrimRight(w.body.Bytes(), " \t\r\n")
+		debug, err := sonic.Marshal(rec.Breakdown())
+		if err != nil || len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' {
+			_, _ = w.ResponseWriter.Write(w.body.Bytes())
+			return
+		}
+		out := append([]byte{}, body[:len(body)-1]...)
+		if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, `"debug":`...)
+		out = append(out, debug...)
+		out = append(out, '}')
+		_, _ = w.ResponseWriter.Write(out)
+	}
+}
+
+// adminAuthMiddleware authorizes the admin endpoints with the root admin token, they are disabled when no token is configured
+func adminAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		token := cfg.Root.AdminBearerToken
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+			return
+		}
+		c.Next()
+	}
+}
+
 type RouterDeps struct {
-	Config          *config.Config
-	DB              *gorm.DB
-	Log             *zap.Logger
-	SpaceHandler    *handler.SpaceHandler
-	BlockHandler    *handler.BlockHandler
-	SessionHandler  *handler.SessionHandler
-	DiskHandler     *handler.DiskHandler
-	ArtifactHandler *handler.ArtifactHandler
-	TaskHandler     *handler.TaskHandler
-	ToolHandler     *handler.ToolHandler
+	Config                     *config.Config
+	DB                         *gorm.DB
+	Log                        *zap.Logger
+	IncidentReporter           *incident.Reporter // nil disables reporting
+	AuthGuard                  service.AuthGuardService
+	SpaceHandler               *handler.SpaceHandler
+	BlockHandler               *handler.BlockHandler
+	SessionHandler             *handler.SessionHandler
+	DiskHandler                *handler.DiskHandler
+	ArtifactHandler            *handler.ArtifactHandler
+	TaskHandler                *handler.TaskHandler
+	ToolHandler                *handler.ToolHandler
+	ToolCallHandler            *handler.ToolCallHandler
+	EmbeddingHandler           *handler.EmbeddingHandler
+	ChunkHandler               *handler.ChunkHandler
+	SubscriptionHandler        *handler.SubscriptionHandler
+	FreshnessHandler           *handler.FreshnessHandler
+	SyncRuleHandler            *handler.SyncRuleHandler
+	AssetHandler               *handler.AssetHandler
+	PartTransformHandler       *handler.PartTransformHandler
+	WindowPresetHandler        *handler.WindowPresetHandler
+	RetentionHandler           *handler.RetentionHandler
+	NotificationHandler        *handler.NotificationHandler
+	BlockEventHandler          *handler.BlockEventHandler
+	IngestAlertHandler         *handler.IngestAlertHandler
+	AnnotationHandler          *handler.AnnotationHandler
+	QuotaHandler               *handler.QuotaHandler
+	RateLimitHandler           *handler.RateLimitHandler
+	EntityLimitHandler         *handler.EntityLimitHandler
+	NetworkAccessHandler       *handler.NetworkAccessHandler
+	RedactionHandler           *handler.RedactionHandler
+	SessionConfigSchemaHandler *handler.SessionConfigSchemaHandler
+	PresignPolicyHandler       *handler.PresignPolicyHandler
+	ApplyHandler               *handler.ApplyHandler
+	ProjectKeyHandler          *handler.ProjectKeyHandler
+	AdminHandler               *handler.AdminHandler
+	DeprecationHandler         *handler.DeprecationHandler
+	DebugHandler               *handler.DebugHandler
 }
 
 func NewRouter(d RouterDeps) *gin.Engine {
@@ -95,7 +383,13 @@ func NewRouter(d RouterDeps) *gin.Engine {
 	serializer.SetLogger(d.Log)
 
 	r := gin.New()
-	r.Use(gin.Recovery())
+	// The client IP decides network access and auth lockouts, so forwarded headers count only from known proxies
+	if err := r.SetTrustedProxies(d.Config.App.TrustedProxies); err != nil {
+		d.Log.Sugar().Warnw("invalid app.trustedProxies, no proxy is trusted", "err", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+
+	r.Use(recoveryMiddleware(d.Log, d.IncidentReporter))
 
 	// Add OpenTelemetry middleware if enabled (using configuration system)
 	if d.Config.Telemetry.Enabled && d.Config.Telemetry.OtlpEndpoint != "" {
@@ -105,9 +399,27 @@ func NewRouter(d RouterDeps) *gin.Engine {
 	}
 
 	r.Use(zapLoggerMiddleware(d.Log))
+	r.Use(problemJSONMiddleware())
 
 	// health
 	r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, serializer.Response{Msg: "ok"}) })
+	// readiness, unlike health the API is only ready once it reaches its database
+	r.GET("/readyz", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+		sqlDB, err := d.DB.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "database is not reachable", err))
+			return
+		}
+		c.JSON(http.StatusOK, serializer.Response{Msg: "ok"})
+	})
+
+	// error codes catalog, public so SDKs can fetch it without a key
+	r.GET("/api/v1/errors", handler.ListErrorCodes)
 
 	// swagger
 	r.GET("/swagger", func(c *gin.Context) {
@@ -117,7 +429,10 @@ func NewRouter(d RouterDeps) *gin.Engine {
 
 	v1 := r.Group("/api/v1")
 	{
-		v1.Use(projectAuthMiddleware(d.Config, d.DB))
+		v1.Use(projectAuthMiddleware(d.Config, d.DB, d.AuthGuard))
+		v1.Use(networkAccessMiddleware(d.AuthGuard))
+		v1.Use(debugTimingMiddleware())
+		v1.Use(d.DeprecationHandler.Announce())
 
 		// ping endpoint
 		v1.GET("/ping", func(c *gin.Context) { c.JSON(http.StatusOK, serializer.Response{Msg: "pong"}) })
@@ -128,28 +443,54 @@ func NewRouter(d RouterDeps) *gin.Engine {
 
 			space.GET("", d.SpaceHandler.GetSpaces)
 			space.POST("", d.SpaceHandler.CreateSpace)
+			space.POST("/import", d.SpaceHandler.ImportSpace)
 			space.DELETE("/:space_id", d.SpaceHandler.DeleteSpace)
 
 			space.PUT("/:space_id/configs", d.SpaceHandler.UpdateConfigs)
 			space.GET("/:space_id/configs", d.SpaceHandler.GetConfigs)
+			space.PUT("/:space_id/metadata", d.SpaceHandler.UpdateMetadata)
+			space.POST("/:space_id/merge_from/:source_space_id", d.SpaceHandler.MergeSpace)
 
 			space.GET("/:space_id/experience_search", d.SpaceHandler.GetExperienceSearch)
+			space.GET("/:space_id/search", d.SpaceHandler.SearchSpaceMessages)
+			space.GET("/:space_id/blocks/search", d.SpaceHandler.SearchSpaceBlocks)
+			space.POST("/:space_id/blocks/semantic_search", d.SpaceHandler.SemanticSearchSpaceBlocks)
+			space.GET("/:space_id/export", d.SpaceHandler.ExportSpace)
 
 			space.GET("/:space_id/experience_confirmations", d.SpaceHandler.ListExperienceConfirmations)
 			space.PATCH("/:space_id/experience_confirmations/:experience_id", d.SpaceHandler.ConfirmExperience)
 
+			space.GET("/:space_id/sync_rules", d.SyncRuleHandler.ListSyncRules)
+			space.POST("/:space_id/sync_rules", d.SyncRuleHandler.CreateSyncRule)
+			space.PATCH("/:space_id/sync_rules/:rule_id", d.SyncRuleHandler.UpdateSyncRule)
+			space.DELETE("/:space_id/sync_rules/:rule_id", d.SyncRuleHandler.DeleteSyncRule)
+
 			block := space.Group("/:space_id/block")
 			{
 				block.GET("", d.BlockHandler.ListBlocks)
 				block.POST("", d.BlockHandler.CreateBlock)
+				block.POST("/bulk_get", d.BlockHandler.BulkGetBlocks)
 				block.DELETE("/:block_id", d.BlockHandler.DeleteBlock)
 
 				block.GET("/:block_id/properties", d.BlockHandler.GetBlockProperties)
 				block.PUT("/:block_id/properties", d.BlockHandler.UpdateBlockProperties)
+				block.GET("/:block_id/backlinks", d.BlockHandler.GetBlockBacklinks)
 
 				block.PUT("/:block_id/move", d.BlockHandler.MoveBlock)
 				block.PUT("/:block_id/sort", d.BlockHandler.UpdateBlockSort)
+				block.POST("/:block_id/duplicate", d.BlockHandler.DuplicateBlock)
+				block.POST("/:block_id/copy_to", d.BlockHandler.CopyBlockTo)
+
+				block.POST("/:block_id/chunks", d.ChunkHandler.ChunkBlock)
+				block.GET("/:block_id/chunks", d.ChunkHandler.ListBlockChunks)
+
+				block.POST("/:block_id/verify", d.FreshnessHandler.VerifyBlock)
 			}
+
+			space.GET("/:space_id/page/:page_id/tree", d.BlockHandler.GetPageTree)
+			space.PUT("/:space_id/page/:page_id/children/order", d.BlockHandler.ReorderChildren)
+			space.GET("/:space_id/page/:page_id/render", d.BlockHandler.RenderPage)
+			space.GET("/:space_id/page/by-slug/:slug", d.BlockHandler.GetPageBySlug)
 		}
 
 		session := v1.Group("/session")
@@ -157,19 +498,44 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			session.GET("", d.SessionHandler.GetSessions)
 			session.POST("", d.SessionHandler.CreateSession)
 			session.DELETE("/:session_id", d.SessionHandler.DeleteSession)
+			session.POST("/bulk_delete", d.SessionHandler.BulkDeleteSessions)
+			session.GET("/archive", d.SessionHandler.ArchiveSessions)
+			session.POST("/:session_id/fork", d.SessionHandler.ForkSession)
 
 			session.PUT("/:session_id/configs", d.SessionHandler.UpdateConfigs)
 			session.GET("/:session_id/configs", d.SessionHandler.GetConfigs)
+			session.PUT("/:session_id/metadata", d.SessionHandler.UpdateMetadata)
+			session.POST("/:session_id/archive", d.SessionHandler.ArchiveSession)
+			session.POST("/:session_id/unarchive", d.SessionHandler.UnarchiveSession)
 
 			session.POST("/:session_id/connect_to_space", d.SessionHandler.ConnectToSpace)
 
-			session.POST("/:session_id/messages", d.SessionHandler.SendMessage)
+			session.POST("/:session_id/messages", d.RateLimitHandler.LimitMessageWrites(), d.EntityLimitHandler.EnforceSessionMessages(), d.QuotaHandler.EnforceMessages(), d.QuotaHandler.EnforceStorage(), d.SessionHandler.SendMessage)
+			session.POST("/:session_id/turns", d.RateLimitHandler.LimitMessageWrites(), d.SessionHandler.SendTurn)
 			session.GET("/:session_id/messages", d.SessionHandler.GetMessages)
+			session.GET("/:session_id/messages/tree", d.SessionHandler.GetMessageTree)
+			session.GET("/:session_id/messages/consistency", d.SessionHandler.CheckMessageChains)
+			session.DELETE("/:session_id/messages/:message_id", d.SessionHandler.DeleteMessage)
+			session.GET("/:session_id/messages/:message_id/parts/:index/expand", d.SessionHandler.ExpandMessagePart)
+			session.POST("/:session_id/messages/:message_id/supersede", d.SessionHandler.SupersedeMessage)
+			session.POST("/:session_id/messages/:message_id/annotations", d.AnnotationHandler.AnnotateMessage)
+			session.GET("/:session_id/messages/:message_id/annotations", d.AnnotationHandler.ListMessageAnnotations)
+			session.DELETE("/:session_id/messages/:message_id/annotations", d.AnnotationHandler.DeleteMessageAnnotation)
+			session.GET("/:session_id/context", d.SessionHandler.GetContextWindow)
+			session.GET("/:session_id/window/:preset", d.SessionHandler.GetSessionWindow)
+			session.GET("/:session_id/export", d.SessionHandler.ExportSession)
+			session.POST("/:session_id/messages/stream", d.RateLimitHandler.LimitMessageWrites(), d.EntityLimitHandler.EnforceSessionMessages(), d.QuotaHandler.EnforceMessages(), d.QuotaHandler.EnforceStorage(), d.SessionHandler.StreamMessage)
+			session.GET("/:session_id/messages/subscribe", d.SubscriptionHandler.SubscribeMessages)
+			session.GET("/:session_id/messages/poll", d.SubscriptionHandler.PollMessages)
 
 			session.POST("/:session_id/flush", d.SessionHandler.SessionFlush)
 			session.GET("/:session_id/get_learning_status", d.SessionHandler.GetLearningStatus)
 
 			session.GET("/:session_id/token_counts", d.SessionHandler.GetTokenCounts)
+			session.GET("/:session_id/usage", d.SessionHandler.GetSessionUsage)
+			session.GET("/:session_id/tool_calls", d.ToolCallHandler.ListToolCalls)
+			session.GET("/:session_id/summary", d.SessionHandler.GetSessionSummary)
+			session.GET("/:session_id/events", d.SessionHandler.GetSessionEvents)
 
 			task := session.Group("/:session_id/task")
 			{
@@ -182,14 +548,33 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			disk.GET("", d.DiskHandler.ListDisks)
 			disk.POST("", d.DiskHandler.CreateDisk)
 			disk.DELETE("/:disk_id", d.DiskHandler.DeleteDisk)
+			disk.POST("/:disk_id/dir/move", d.ArtifactHandler.MoveDirectory)
+			disk.DELETE("/:disk_id/dir", d.ArtifactHandler.DeleteDirectory)
 
 			artifact := disk.Group("/:disk_id/artifact")
 			{
-				artifact.POST("", d.ArtifactHandler.UpsertArtifact)
+				artifact.POST("", d.QuotaHandler.EnforceStorage(), d.ArtifactHandler.UpsertArtifact)
+				artifact.POST("/presign_upload", d.ArtifactHandler.PresignArtifactUpload)
+				artifact.POST("/presign_upload/:upload_id/finalize", d.ArtifactHandler.FinalizeArtifactUpload)
+				artifact.POST("/uploads", d.ArtifactHandler.CreateUploadSession)
+				artifact.GET("/uploads/:upload_id", d.ArtifactHandler.GetUploadSession)
+				artifact.PUT("/uploads/:upload_id/parts/:part_number", d.ArtifactHandler.UploadArtifactPart)
+				artifact.POST("/uploads/:upload_id/complete", d.ArtifactHandler.CompleteUploadSession)
+				artifact.DELETE("/uploads/:upload_id", d.ArtifactHandler.AbortUploadSession)
 				artifact.GET("", d.ArtifactHandler.GetArtifact)
 				artifact.PUT("", d.ArtifactHandler.UpdateArtifact)
 				artifact.DELETE("", d.ArtifactHandler.DeleteArtifact)
 				artifact.GET("/ls", d.ArtifactHandler.ListArtifacts)
+				artifact.GET("/trash", d.ArtifactHandler.ListTrash)
+				artifact.POST("/trash/:artifact_id/restore", d.ArtifactHandler.RestoreArtifact)
+				artifact.POST("/lock", d.ArtifactHandler.AcquireArtifactLease)
+				artifact.DELETE("/lock", d.ArtifactHandler.ReleaseArtifactLease)
+				artifact.POST("/query", d.ArtifactHandler.QueryArtifact)
+
+				artifact.POST("/chunks", d.ChunkHandler.ChunkArtifact)
+				artifact.GET("/chunks", d.ChunkHandler.ListArtifactChunks)
+
+				artifact.POST("/verify", d.FreshnessHandler.VerifyArtifact)
 			}
 		}
 
@@ -198,6 +583,88 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			tool.PUT("/name", d.ToolHandler.RenameToolName)
 			tool.GET("/name", d.ToolHandler.GetToolName)
 		}
+
+		embedding := v1.Group("/embedding")
+		{
+			embedding.GET("/config", d.EmbeddingHandler.GetEmbeddingConfig)
+			embedding.PUT("/config", d.EmbeddingHandler.UpdateEmbeddingConfig)
+
+			embedding.GET("/jobs", d.EmbeddingHandler.ListEmbeddingJobs)
+			embedding.GET("/jobs/:job_id", d.EmbeddingHandler.GetEmbeddingJob)
+			embedding.POST("/jobs/:job_id/cancel", d.EmbeddingHandler.CancelEmbeddingJob)
+		}
+		v1.POST("/embeddings", d.EmbeddingHandler.CreateEmbeddings)
+
+		freshness := v1.Group("/freshness")
+		{
+			freshness.POST("/scan", d.FreshnessHandler.ScanStale)
+			freshness.GET("/review", d.FreshnessHandler.ListReviewQueue)
+		}
+
+		project := v1.Group("/project")
+		{
+			project.GET("/assets", d.AssetHandler.ListAssets)
+			project.GET("/assets/:sha256", d.AssetHandler.GetAsset)
+			project.GET("/assets/:sha256/content", d.AssetHandler.GetAssetContent)
+			project.DELETE("/assets/:sha256", d.AssetHandler.DeleteAsset)
+
+			project.GET("/part_transforms", d.PartTransformHandler.GetPartTransforms)
+			project.PUT("/part_transforms", d.PartTransformHandler.UpdatePartTransforms)
+			project.GET("/window_presets", d.WindowPresetHandler.GetWindowPresets)
+			project.PUT("/window_presets", d.WindowPresetHandler.UpdateWindowPresets)
+			project.GET("/retention", d.RetentionHandler.GetRetention)
+			project.PUT("/retention", d.RetentionHandler.UpdateRetention)
+			project.GET("/messages/sample", d.SessionHandler.SampleMessages)
+			project.GET("/tasks", d.TaskHandler.GetJobTasks)
+			project.GET("/notifications", d.NotificationHandler.ListNotifications)
+			project.GET("/notification_webhook", d.NotificationHandler.GetNotificationWebhook)
+			project.PUT("/notification_webhook", d.NotificationHandler.UpdateNotificationWebhook)
+			project.GET("/block_webhook", d.BlockEventHandler.GetBlockWebhook)
+			project.PUT("/block_webhook", d.BlockEventHandler.UpdateBlockWebhook)
+			project.GET("/ingest_alerts", d.IngestAlertHandler.GetIngestAlerts)
+			project.PUT("/ingest_alerts", d.IngestAlertHandler.UpdateIngestAlerts)
+			project.GET("/ingest_rate", d.IngestAlertHandler.GetIngestRate)
+			project.GET("/quota", d.QuotaHandler.GetQuota)
+			project.GET("/network_access", d.NetworkAccessHandler.GetNetworkAccess)
+			project.PUT("/network_access", d.NetworkAccessHandler.UpdateNetworkAccess)
+			project.GET("/redaction", d.RedactionHandler.GetRedaction)
+			project.PUT("/redaction", d.RedactionHandler.UpdateRedaction)
+			project.GET("/session_config_schema", d.SessionConfigSchemaHandler.GetSessionConfigSchema)
+			project.PUT("/session_config_schema", d.SessionConfigSchemaHandler.UpdateSessionConfigSchema)
+			project.GET("/presign_policy", d.PresignPolicyHandler.GetPresignPolicy)
+			project.PUT("/presign_policy", d.PresignPolicyHandler.UpdatePresignPolicy)
+			project.POST("/apply", d.ApplyHandler.ApplyManifest)
+			project.GET("/key", d.ProjectKeyHandler.GetProjectKey)
+			project.POST("/key/rotate", d.ProjectKeyHandler.RotateProjectKey)
+			project.POST("/key/finalize", d.ProjectKeyHandler.FinalizeProjectKeyRotation)
+		}
+
+		annotation := v1.Group("/annotation")
+		{
+			annotation.GET("/export", d.AnnotationHandler.ExportAnnotations)
+			annotation.POST("/import", d.AnnotationHandler.ImportAnnotations)
+		}
+	}
+
+	// cross-project operations, outside of the project key auth of v1
+	admin := r.Group("/api/v1/admin")
+	{
+		admin.Use(adminAuthMiddleware(d.Config))
+
+		admin.POST("/space/:space_id/clone", d.AdminHandler.CloneSpace)
+		admin.POST("/session/:session_id/clone", d.AdminHandler.CloneSession)
+		admin.GET("/deprecations", d.DeprecationHandler.GetDeprecationReport)
+	}
+
+	// runtime diagnostics and Go profiles, e.g. go tool pprof -H 'Authorization: Bearer <admin token>' <host>/debug/pprof/heap
+	debug := r.Group("/debug")
+	{
+		debug.Use(adminAuthMiddleware(d.Config))
+
+		debug.GET("/runtime", d.DebugHandler.Runtime)
+		debug.GET("/vars", gin.WrapH(expvar.Handler()))
+		debug.GET("/pprof/*profile", d.DebugHandler.Pprof)
+		debug.POST("/pprof/*profile", d.DebugHandler.Pprof)
 	}
 	return r
 }
@@ -20,3 +20,10 @@ class InsertBlockRequest(BaseModel):
     props: dict[str, Any] = Field(..., description="Block properties")
     title: str = Field(..., description="Block title")
     type: str = Field(..., description="Block type")
+
+
+class EmbedRequest(BaseModel):
+    texts: list[str] = Field(..., description="Texts to embed")
+    phase: Literal["query", "document"] = Field(
+        "document", description="Embed as search queries or as documents"
+    )
@@ -40,3 +40,12 @@ class LearningStatusResponse(BaseModel):
     not_space_digested_count: int = Field(
         ..., description="Number of tasks that are not space digested"
     )
+
+
+class EmbedResponse(BaseModel):
+    embeddings: list[list[float]] = Field(
+        ..., description="Embedding of each text, in the order of the request"
+    )
+    model: str = Field(..., description="Embedding model")
+    prompt_tokens: int = Field(..., description="Tokens of the texts")
+    total_tokens: int = Field(..., description="Tokens billed by the provider")
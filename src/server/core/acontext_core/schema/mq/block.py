@@ -0,0 +1,13 @@
+from pydantic import BaseModel
+from typing import List
+from ..utils import asUUID
+
+
+class BlockEmbeddingUpsert(BaseModel):
+    space_id: asUUID
+    block_ids: List[asUUID]
+
+
+class EmbeddingReEmbed(BaseModel):
+    project_id: asUUID
+    job_id: asUUID
@@ -11,6 +11,7 @@ from .tool_reference import ToolReference
 from .tool_sop import ToolSOP
 from .experience_confirmation import ExperienceConfirmation
 from .metric import Metric
+from .embedding_job import EmbeddingJob
 
 __all__ = [
     "ORM_BASE",
@@ -30,4 +31,5 @@ __all__ = [
     "ToolSOP",
     "ExperienceConfirmation",
     "Metric",
+    "EmbeddingJob",
 ]
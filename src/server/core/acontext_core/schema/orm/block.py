@@ -50,6 +50,49 @@ BLOCK_TYPES = {
             "preferences": str,
         },
     },
+    "reference": {
+        "name": "reference",
+        "allow_children": False,
+        "require_parent": True,
+        "props_schema": {
+            "reference_block_id": str,
+        },
+    },
+    "code": {
+        "name": "code",
+        "allow_children": False,
+        "require_parent": True,
+        "props_schema": {
+            "language": str,
+            "code": str,
+        },
+    },
+    "table": {
+        "name": "table",
+        "allow_children": False,
+        "require_parent": True,
+        "props_schema": {
+            "columns": list,
+            "rows": list,
+        },
+    },
+    "todo": {
+        "name": "todo",
+        "allow_children": False,
+        "require_parent": True,
+        "props_schema": {
+            "checked": bool,
+            "text": str,
+        },
+    },
+    "markdown": {
+        "name": "markdown",
+        "allow_children": False,
+        "require_parent": True,
+        "props_schema": {
+            "content": str,
+        },
+    },
 }
 
 # Block type constants matching Go version
@@ -59,15 +102,31 @@ BLOCK_TYPE_PAGE = "page"
 BLOCK_TYPE_TEXT = "text"
 BLOCK_TYPE_SOP = "sop"
 BLOCK_TYPE_REFERENCE = "reference"
+BLOCK_TYPE_CODE = "code"
+BLOCK_TYPE_TABLE = "table"
+BLOCK_TYPE_TODO = "todo"
+BLOCK_TYPE_MARKDOWN = "markdown"
 
 PATH_BLOCK = {BLOCK_TYPE_FOLDER, BLOCK_TYPE_PAGE}
 CONTENT_BLOCK = {BLOCK_TYPE_TEXT, BLOCK_TYPE_SOP}
+# Blocks authored through the API, their props are validated by the Go API
+DOC_BLOCK = {
+    BLOCK_TYPE_REFERENCE,
+    BLOCK_TYPE_CODE,
+    BLOCK_TYPE_TABLE,
+    BLOCK_TYPE_TODO,
+    BLOCK_TYPE_MARKDOWN,
+}
 BLOCK_PARENT_ALLOW = {
     BLOCK_TYPE_FOLDER: {BLOCK_TYPE_FOLDER, BLOCK_TYPE_ROOT},
     BLOCK_TYPE_PAGE: {BLOCK_TYPE_FOLDER, BLOCK_TYPE_ROOT},
     BLOCK_TYPE_SOP: {BLOCK_TYPE_PAGE},
     BLOCK_TYPE_TEXT: {BLOCK_TYPE_PAGE},
     BLOCK_TYPE_REFERENCE: {BLOCK_TYPE_PAGE},
+    BLOCK_TYPE_CODE: {BLOCK_TYPE_PAGE},
+    BLOCK_TYPE_TABLE: {BLOCK_TYPE_PAGE},
+    BLOCK_TYPE_TODO: {BLOCK_TYPE_PAGE},
+    BLOCK_TYPE_MARKDOWN: {BLOCK_TYPE_PAGE},
 }
 
 
@@ -103,9 +162,11 @@ class Block(CommonMixin):
         Index(
             "ux_blocks_space_parent_sort", "space_id", "parent_id", "sort", unique=True
         ),
+        # Unique constraint for the slugs of the pages of a space
+        Index("ux_blocks_space_slug", "space_id", "slug", unique=True),
         # Check constraints matching Go version
         CheckConstraint(
-            "type IN ('folder', 'page', 'text', 'sop', 'reference')",
+            "type IN ('folder', 'page', 'text', 'sop', 'reference', 'code', 'table', 'todo', 'markdown')",
             name="ck_block_type",
         ),
     )
@@ -162,6 +223,17 @@ class Block(CommonMixin):
         },
     )
 
+    # Permalink of a page, unique in its space and kept when the page is renamed
+    slug: Optional[str] = field(
+        default=None,
+        metadata={
+            "db": Column(
+                String,
+                nullable=True,
+            )
+        },
+    )
+
     sort: int = field(
         default=0,
         metadata={
@@ -0,0 +1,74 @@
+from dataclasses import dataclass, field
+from sqlalchemy import (
+    CheckConstraint,
+    Column,
+    ForeignKey,
+    Index,
+    Integer,
+    String,
+    text,
+)
+from sqlalchemy.dialects.postgresql import UUID
+from typing import Optional
+from .base import ORM_BASE, CommonMixin
+from ..utils import asUUID
+
+
+@ORM_BASE.mapped
+@dataclass
+class EmbeddingJob(CommonMixin):
+    """
+    Re-embedding of the blocks of a project after its embedding model changed,
+    created by the API and run by core.
+    """
+
+    __tablename__ = "embedding_jobs"
+
+    __table_args__ = (
+        CheckConstraint(
+            "status IN ('pending', 'running', 'success', 'failed', 'cancelled')",
+            name="chk_embedding_jobs_status",
+        ),
+        Index("ix_embedding_job_project_id_status", "project_id", "status"),
+        # A project runs one job at a time
+        Index(
+            "ux_embedding_job_project_active",
+            "project_id",
+            unique=True,
+            postgresql_where=text("status IN ('pending', 'running')"),
+        ),
+    )
+
+    project_id: asUUID = field(
+        metadata={
+            "db": Column(
+                UUID(as_uuid=True),
+                ForeignKey("projects.id", ondelete="CASCADE", onupdate="CASCADE"),
+                nullable=False,
+            )
+        }
+    )
+
+    provider: str = field(metadata={"db": Column(String, nullable=False)})
+    model: str = field(metadata={"db": Column(String, nullable=False)})
+    dimensions: int = field(metadata={"db": Column(Integer, nullable=False)})
+    prev_model: Optional[str] = field(
+        default=None, metadata={"db": Column(String, nullable=True)}
+    )
+    prev_dimensions: Optional[int] = field(
+        default=None, metadata={"db": Column(Integer, nullable=True)}
+    )
+
+    status: str = field(
+        default="pending",
+        metadata={"db": Column(String, nullable=False, server_default="pending")},
+    )
+    total: int = field(
+        default=0, metadata={"db": Column(Integer, nullable=False, server_default="0")}
+    )
+    processed: int = field(
+        default=0, metadata={"db": Column(Integer, nullable=False, server_default="0")}
+    )
+    error: Optional[str] = field(
+        default=None, metadata={"db": Column(String, nullable=True)}
+    )
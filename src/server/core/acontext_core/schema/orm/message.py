@@ -85,6 +85,11 @@ class Message(CommonMixin):
     # Store Asset data as JSONB (matches Go's PartsAssetMeta field)
     parts_asset_meta: dict = field(metadata={"db": Column(JSONB, nullable=False)})
 
+    # Parts of small messages stored in the row (matches Go's InlineParts field), parts_asset_meta is then empty
+    inline_parts: Optional[list] = field(
+        default=None, metadata={"db": Column(JSONB, nullable=True)}
+    )
+
     parts: Optional[List[Part]] = field(default=None)
 
     parent_id: Optional[asUUID] = field(
@@ -11,7 +11,7 @@ from sqlalchemy import (
 )
 from sqlalchemy.orm import relationship
 from sqlalchemy.dialects.postgresql import JSONB, UUID
-from typing import TYPE_CHECKING, List
+from typing import TYPE_CHECKING, List, Optional
 from .base import ORM_BASE, CommonMixin
 from ..utils import asUUID
 
@@ -22,6 +22,9 @@ if TYPE_CHECKING:
 
 # TaskStatusEnum = Enum(TaskStatus, name="task_status_enum", create_type=True)
 
+TASK_KIND_AGENT = "agent"
+TASK_KIND_RE_EMBED = "re_embed"
+
 
 @ORM_BASE.mapped
 @dataclass
@@ -42,14 +45,16 @@ class Task(CommonMixin):
         Index("ix_task_session_id_task_id", "session_id", "id"),
         Index("ix_task_session_id_status", "session_id", "status"),
         Index("ix_task_project_id", "project_id"),
+        Index("ix_task_project_id_kind", "project_id", "kind"),
     )
 
-    session_id: asUUID = field(
+    # None for the jobs the API tracks for a project, e.g. exports and re-embeddings
+    session_id: Optional[asUUID] = field(
         metadata={
             "db": Column(
                 UUID(as_uuid=True),
                 ForeignKey("sessions.id", ondelete="CASCADE"),
-                nullable=False,
+                nullable=True,
             )
         }
     )
@@ -68,6 +73,19 @@ class Task(CommonMixin):
 
     data: dict = field(metadata={"db": Column(JSONB, nullable=False)})
 
+    # "agent" for the tasks planned by core, the API tracks its jobs with other kinds
+    kind: str = field(
+        default=TASK_KIND_AGENT,
+        metadata={
+            "db": Column(
+                String,
+                nullable=False,
+                default=TASK_KIND_AGENT,
+                server_default=TASK_KIND_AGENT,
+            )
+        },
+    )
+
     status: str = field(
         default="pending",
         metadata={
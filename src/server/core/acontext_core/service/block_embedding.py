@@ -0,0 +1,95 @@
+from ..env import LOG, DEFAULT_CORE_CONFIG
+from ..infra.db import DB_CLIENT
+from ..infra.async_mq import register_consumer, MQ_CLIENT, Message, ConsumerConfigData
+from ..schema.mq.block import BlockEmbeddingUpsert, EmbeddingReEmbed
+from ..schema.orm import Block
+from .constants import EX, RK
+from .data import block as BB
+from .data import embedding_job as EJ
+
+# Blocks re-embedded between two checks for the cancellation of a job
+REEMBED_BATCH_SIZE = 50
+
+
+@register_consumer(
+    mq_client=MQ_CLIENT,
+    config=ConsumerConfigData(
+        exchange_name=EX.embedding,
+        routing_key=RK.embedding_block_upsert,
+        queue_name=RK.embedding_block_upsert,
+    ),
+)
+async def upsert_block_embeddings(body: BlockEmbeddingUpsert, message: Message):
+    """Re-embed the blocks created or changed by the API, deleted blocks are skipped"""
+    for block_id in body.block_ids:
+        async with DB_CLIENT.get_session_context() as db_session:
+            block = await db_session.get(Block, block_id)
+            if block is None or block.space_id != body.space_id:
+                LOG.info(f"Block {block_id} not found in space {body.space_id}, skip")
+                continue
+            r = await BB.replace_block_embedding(db_session, block)
+            if not r.ok():
+                LOG.error(f"Failed to embed block {block_id}: {r.error}")
+
+
+@register_consumer(
+    mq_client=MQ_CLIENT,
+    config=ConsumerConfigData(
+        exchange_name=EX.embedding,
+        routing_key=RK.embedding_reembed,
+        queue_name=RK.embedding_reembed,
+    ),
+)
+async def reembed_project_blocks(body: EmbeddingReEmbed, message: Message):
+    """
+    Run a re-embedding job of the API: re-embed every block of the project with the
+    model of the job, in batches, stopping when the job is cancelled.
+    """
+    async with DB_CLIENT.get_session_context() as db_session:
+        r = await EJ.start_embedding_job(db_session, body.project_id, body.job_id)
+        if not r.ok():
+            LOG.error(f"Failed to start re-embedding job {body.job_id}: {r.error}")
+            return
+        job = r.data
+        if job is None:
+            LOG.info(f"Re-embedding job {body.job_id} is not pending, skip")
+            return
+        model, dimensions, provider = job.model, job.dimensions, job.provider
+
+    # The vectors are stored in a column of the configured dimension, by the configured provider
+    error = None
+    if provider != DEFAULT_CORE_CONFIG.block_embedding_provider:
+        error = f"provider {provider} is not the one of the server ({DEFAULT_CORE_CONFIG.block_embedding_provider})"
+    elif dimensions != DEFAULT_CORE_CONFIG.block_embedding_dim:
+        error = f"dimensions {dimensions} do not match the stored vectors ({DEFAULT_CORE_CONFIG.block_embedding_dim})"
+
+    after_id, processed = None, 0
+    while error is None:
+        async with DB_CLIENT.get_session_context() as db_session:
+            if not await EJ.embedding_job_running(db_session, body.job_id):
+                LOG.info(f"Re-embedding job {body.job_id} was cancelled")
+                return
+            r = await EJ.list_project_blocks_after(
+                db_session, body.project_id, after_id, REEMBED_BATCH_SIZE
+            )
+            if not r.ok():
+                error = r.error
+                break
+            blocks = r.data
+            if not blocks:
+                break
+            for block in blocks:
+                r = await BB.replace_block_embedding(db_session, block, model=model)
+                if not r.ok():
+                    error = f"embed block {block.id}: {r.error}"
+                    break
+            if error is not None:
+                break
+            processed += len(blocks)
+            after_id = blocks[-1].id
+            await EJ.update_embedding_job_progress(db_session, body.job_id, processed)
+
+    if error is not None:
+        LOG.error(f"Re-embedding job {body.job_id} failed: {error}")
+    async with DB_CLIENT.get_session_context() as db_session:
+        await EJ.finish_embedding_job(db_session, body.project_id, body.job_id, error)
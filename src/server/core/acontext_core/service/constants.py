@@ -1,6 +1,7 @@
 class EX:
     session_message = "session.message"
     space_task = "space.task"
+    embedding = "embedding"
 
 
 class RK:
@@ -11,3 +12,6 @@ class RK:
     session_message_insert = "session.message.insert"
     session_message_insert_retry = "session.message.insert.retry"
     session_message_buffer_process = "session.message.buffer.process"
+
+    embedding_block_upsert = "embedding.block.upsert"
+    embedding_reembed = "embedding.reembed"
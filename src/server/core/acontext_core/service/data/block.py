@@ -1,5 +1,5 @@
 from typing import List, Optional
-from sqlalchemy import select, update, func
+from sqlalchemy import select, update, delete, func, or_
 from sqlalchemy.orm import selectinload
 from sqlalchemy.orm.attributes import flag_modified
 from sqlalchemy.ext.asyncio import AsyncSession
@@ -8,9 +8,13 @@ from ...schema.orm.block import (
     BLOCK_TYPE_FOLDER,
     BLOCK_TYPE_ROOT,
     BLOCK_TYPE_PAGE,
+    BLOCK_TYPE_MARKDOWN,
+    BLOCK_TYPE_SOP,
+    BLOCK_TYPE_REFERENCE,
     BLOCK_PARENT_ALLOW,
+    PATH_BLOCK,
 )
-from ...schema.orm import Block, BlockEmbedding
+from ...schema.orm import Block, BlockEmbedding, BlockReference, Space
 from ...schema.utils import asUUID
 from ...schema.result import Result
 from .block_nav import assert_block_type, _normalize_path_block_title
@@ -68,6 +72,24 @@ async def update_block_children_sort_by_delta(
     return Result.resolve(None)
 
 
+def block_embedding_content(block: Block) -> str:
+    """
+    The text a block is embedded from: the title of a SOP (its use_when), the title of a
+    path block with its view_when, or else the title with the text of the props.
+    """
+    props = block.props or {}
+    content = block.title or ""
+    if block.type == BLOCK_TYPE_SOP:
+        return content.strip()
+    keys = ("notes", "text", "content", "code")
+    if block.type in PATH_BLOCK:
+        keys = ("view_when",)
+    for key in keys:
+        if isinstance(props.get(key), str):
+            content += " " + props[key]
+    return content.strip()
+
+
 async def create_new_block_embedding(
     db_session: AsyncSession,
     block: Block,
@@ -91,6 +113,92 @@ async def create_new_block_embedding(
     return Result.resolve(new_embedding)
 
 
+async def replace_block_embedding(
+    db_session: AsyncSession, block: Block, model: Optional[str] = None
+) -> Result[Optional[BlockEmbedding]]:
+    """
+    Re-embed a block after its title or props changed, dropping its previous embeddings.
+    A block without text is left without embedding. model defaults to the configured one.
+    """
+    content = block_embedding_content(block)
+    embedding = None
+    if content:
+        r = await get_embedding([content], model=model)
+        if not r.ok():
+            return r
+        embedding = r.data.embedding[0]
+
+    await db_session.execute(
+        delete(BlockEmbedding).where(BlockEmbedding.block_id == block.id)
+    )
+    if embedding is None:
+        await db_session.flush()
+        return Result.resolve(None)
+    # added to the session rather than to block.embeddings, which are not loaded
+    new_embedding = BlockEmbedding(
+        block_id=block.id,
+        space_id=block.space_id,
+        block_type=block.type,
+        embedding=embedding,
+    )
+    db_session.add(new_embedding)
+    await db_session.flush()
+    return Result.resolve(new_embedding)
+
+
+MAX_PAGE_SLUG_LEN = 64
+
+
+def page_slug(title: str) -> str:
+    """
+    Make the slug of a page from its title as the Go API does: lowercase letters and
+    digits, with a single dash for anything in between, e.g. "Getting Started (v2)" is
+    getting-started-v2. A title without letters or digits gives "page".
+    """
+    chars: List[str] = []
+    dash = False
+    for ch in title.lower():
+        if len(chars) == MAX_PAGE_SLUG_LEN:
+            break
+        if not (ch.isalpha() or ch.isdecimal()):
+            dash = len(chars) > 0
+            continue
+        if dash:
+            chars.append("-")
+            dash = False
+            if len(chars) == MAX_PAGE_SLUG_LEN:
+                break
+        chars.append(ch)
+    return "".join(chars).removesuffix("-") or BLOCK_TYPE_PAGE
+
+
+async def _free_page_slug(
+    db_session: AsyncSession, space_id: asUUID, title: str
+) -> str:
+    """
+    Return the slug of a new page of the space, suffixed with -2, -3... when another page
+    has it. The space row stays locked until the end of the transaction, so concurrent
+    writers of the space, core or the Go API, do not pick the same slug.
+    """
+    base = page_slug(title)
+    await db_session.execute(
+        select(Space.id).where(Space.id == space_id).with_for_update()
+    )
+    # Slugs have no LIKE wildcards, see page_slug
+    result = await db_session.execute(
+        select(Block.slug)
+        .where(Block.space_id == space_id)
+        .where(or_(Block.slug == base, Block.slug.like(f"{base}-%")))
+    )
+    taken = set(result.scalars().all())
+    slug = base
+    i = 2
+    while slug in taken:
+        slug = f"{base}-{i}"
+        i += 1
+    return slug
+
+
 async def create_new_path_block(
     db_session: AsyncSession,
     space_id: asUUID,
@@ -113,6 +221,8 @@ async def create_new_path_block(
         props=props,
         sort=next_sort,
     )
+    if type == BLOCK_TYPE_PAGE:
+        new_block.slug = await _free_page_slug(db_session, space_id, title)
     r = new_block.validate_for_creation()
     if not r.ok():
         return r
@@ -120,15 +230,72 @@ async def create_new_path_block(
     await db_session.flush()
 
     # add embedding for path block
-    index_content = title
-    if "view_when" in props:
-        index_content += " " + props["view_when"]
-    r = await create_new_block_embedding(db_session, new_block, index_content.strip())
+    r = await create_new_block_embedding(
+        db_session, new_block, block_embedding_content(new_block)
+    )
+    if not r.ok():
+        return r
+    return Result.resolve(new_block)
+
+
+async def create_new_doc_block(
+    db_session: AsyncSession,
+    space_id: asUUID,
+    title: str,
+    props: dict | None = None,
+    par_block_id: Optional[asUUID] = None,
+    type: str = BLOCK_TYPE_MARKDOWN,
+) -> Result[Block]:
+    props = props or {}
+    r = await _find_block_sort(db_session, space_id, par_block_id, block_type=type)
+    if not r.ok():
+        return r
+    next_sort = r.unpack()[0]
+    new_block = Block(
+        space_id=space_id,
+        type=type,
+        parent_id=par_block_id,
+        title=title,
+        props=props,
+        sort=next_sort,
+    )
+    r = new_block.validate_for_creation()
+    if not r.ok():
+        return r
+    db_session.add(new_block)
+    await db_session.flush()
+
+    if type == BLOCK_TYPE_REFERENCE:
+        r = await _add_block_reference(db_session, new_block)
+        if not r.ok():
+            return r
+
+    # add embedding for the title and the text of the block
+    r = await create_new_block_embedding(
+        db_session, new_block, block_embedding_content(new_block)
+    )
     if not r.ok():
         return r
     return Result.resolve(new_block)
 
 
+async def _add_block_reference(db_session: AsyncSession, block: Block) -> Result[None]:
+    """
+    Index the target of a reference block in block_references, so the Go API lists
+    the backlinks of the target. The target must be a block of the same space.
+    """
+    try:
+        target_id = asUUID(str(block.props.get("reference_block_id")))
+    except ValueError:
+        return Result.reject("reference_block_id must be a block ID")
+    target = await db_session.get(Block, target_id)
+    if target is None or target.space_id != block.space_id:
+        return Result.reject(f"Referenced block {target_id} not found")
+    db_session.add(BlockReference(block_id=block.id, reference_block_id=target.id))
+    await db_session.flush()
+    return Result.resolve(None)
+
+
 async def find_all_parent_ids(
     db_session: AsyncSession, space_id: asUUID, block_id: asUUID | None
 ) -> Result[List[asUUID]]:
@@ -0,0 +1,124 @@
+from typing import List, Optional
+from sqlalchemy import select, update
+from sqlalchemy.ext.asyncio import AsyncSession
+from ...schema.orm import Block, EmbeddingJob, Space, Task
+from ...schema.orm.task import TASK_KIND_RE_EMBED
+from ...schema.result import Result
+from ...schema.utils import asUUID
+
+EMBEDDING_JOB_PENDING = "pending"
+EMBEDDING_JOB_RUNNING = "running"
+EMBEDDING_JOB_SUCCESS = "success"
+EMBEDDING_JOB_FAILED = "failed"
+EMBEDDING_JOB_CANCELLED = "cancelled"
+
+
+async def _set_job_task_status(
+    db_session: AsyncSession,
+    job: EmbeddingJob,
+    status: str,
+    data: Optional[dict] = None,
+) -> None:
+    # The re_embed task tracking the job mirrors its status, as in the API
+    values = {"status": status}
+    if data:
+        values["data"] = Task.data.op("||")(data)
+    await db_session.execute(
+        update(Task)
+        .where(Task.project_id == job.project_id)
+        .where(Task.kind == TASK_KIND_RE_EMBED)
+        .where(Task.data["embedding_job_id"].astext == str(job.id))
+        .values(**values)
+    )
+
+
+async def start_embedding_job(
+    db_session: AsyncSession, project_id: asUUID, job_id: asUUID
+) -> Result[Optional[EmbeddingJob]]:
+    """
+    Mark a pending job as running. Returns None when the job is gone or no longer
+    pending, e.g. cancelled before it started or already taken by another consumer.
+    """
+    job = (
+        await db_session.execute(
+            select(EmbeddingJob)
+            .where(EmbeddingJob.id == job_id)
+            .where(EmbeddingJob.project_id == project_id)
+            .with_for_update()
+        )
+    ).scalar_one_or_none()
+    if job is None or job.status != EMBEDDING_JOB_PENDING:
+        return Result.resolve(None)
+    job.status = EMBEDDING_JOB_RUNNING
+    await _set_job_task_status(db_session, job, EMBEDDING_JOB_RUNNING)
+    await db_session.flush()
+    return Result.resolve(job)
+
+
+async def embedding_job_running(db_session: AsyncSession, job_id: asUUID) -> bool:
+    status = (
+        await db_session.execute(
+            select(EmbeddingJob.status).where(EmbeddingJob.id == job_id)
+        )
+    ).scalar_one_or_none()
+    return status == EMBEDDING_JOB_RUNNING
+
+
+async def list_project_blocks_after(
+    db_session: AsyncSession,
+    project_id: asUUID,
+    after_id: Optional[asUUID],
+    limit: int,
+) -> Result[List[Block]]:
+    """Page through the blocks of a project in the order of their ids"""
+    query = (
+        select(Block)
+        .join(Space, Space.id == Block.space_id)
+        .where(Space.project_id == project_id)
+        .order_by(Block.id.asc())
+        .limit(limit)
+    )
+    if after_id is not None:
+        query = query.where(Block.id > after_id)
+    blocks = list((await db_session.execute(query)).scalars().all())
+    return Result.resolve(blocks)
+
+
+async def update_embedding_job_progress(
+    db_session: AsyncSession, job_id: asUUID, processed: int
+) -> Result[None]:
+    await db_session.execute(
+        update(EmbeddingJob)
+        .where(EmbeddingJob.id == job_id)
+        .values(processed=processed)
+    )
+    return Result.resolve(None)
+
+
+async def finish_embedding_job(
+    db_session: AsyncSession,
+    project_id: asUUID,
+    job_id: asUUID,
+    error: Optional[str] = None,
+) -> Result[None]:
+    """
+    Mark a running job as succeeded, or as failed with error. A job cancelled
+    meanwhile keeps its status.
+    """
+    job = (
+        await db_session.execute(
+            select(EmbeddingJob)
+            .where(EmbeddingJob.id == job_id)
+            .where(EmbeddingJob.project_id == project_id)
+            .with_for_update()
+        )
+    ).scalar_one_or_none()
+    if job is None or job.status != EMBEDDING_JOB_RUNNING:
+        return Result.resolve(None)
+    job.status = EMBEDDING_JOB_FAILED if error else EMBEDDING_JOB_SUCCESS
+    job.error = error
+    await _set_job_task_status(
+        db_session, job, job.status, {"error": error} if error else None
+    )
+    await db_session.flush()
+    return Result.resolve(None)
@@ -1,6 +1,6 @@
 import asyncio
 import json
-from typing import List
+from typing import List, Optional
 from sqlalchemy import select, func
 from sqlalchemy.ext.asyncio import AsyncSession
 from pydantic import ValidationError
@@ -13,27 +13,43 @@ from ...schema.utils import asUUID
 from ...infra.s3 import S3_CLIENT
 from ...env import LOG
 
+# Suffix of the S3 keys of objects sealed by the API with envelope encryption (blob.SealedSuffix).
+# The API keeps message parts in the database when sealing, only parts sealed by older versions end with it.
+SEALED_S3_KEY_SUFFIX = ".sealed"
 
-async def _fetch_message_parts(parts_meta: dict) -> Result[List[Part]]:
+
+async def _fetch_message_parts(
+    parts_meta: dict, inline_parts: Optional[list] = None
+) -> Result[List[Part]]:
     """
     Helper function to fetch parts for a single message from S3.
 
     Args:
-        message: Message object with parts_meta containing S3 information
+        parts_meta: Asset of the parts JSON stored in S3, empty when the parts are inline
+        inline_parts: Parts stored in the message row, used instead of S3 when set
 
     Returns:
         List of Part objects
     """
     try:
-        # Extract S3 key from parts_meta
-        try:
-            asset = Asset(**parts_meta)
-        except ValidationError as e:
-            return Result.reject(f"Failed to validate parts asset {parts_meta}: {e}")
-        s3_key = asset.s3_key
-        # Download parts JSON from S3
-        parts_json_bytes = await S3_CLIENT.download_object(s3_key)
-        parts_json = json.loads(parts_json_bytes.decode("utf-8"))
+        if inline_parts is not None and not parts_meta.get("s3_key"):
+            parts_json = inline_parts
+        else:
+            # Extract S3 key from parts_meta
+            try:
+                asset = Asset(**parts_meta)
+            except ValidationError as e:
+                return Result.reject(
+                    f"Failed to validate parts asset {parts_meta}: {e}"
+                )
+            s3_key = asset.s3_key
+            if s3_key.endswith(SEALED_S3_KEY_SUFFIX):
+                return Result.reject(
+                    f"Parts {s3_key} are sealed with envelope encryption, which core cannot open"
+                )
+            # Download parts JSON from S3
+            parts_json_bytes = await S3_CLIENT.download_object(s3_key)
+            parts_json = json.loads(parts_json_bytes.decode("utf-8"))
         assert isinstance(parts_json, list), "Parts Json must be a list"
         try:
             parts = [Part(**pj) for pj in parts_json]
@@ -108,7 +124,7 @@ async def fetch_messages_data_by_ids(
 
         # Fetch parts concurrently for all messages
         parts_tasks = [
-            _fetch_message_parts(message.parts_asset_meta)
+            _fetch_message_parts(message.parts_asset_meta, message.inline_parts)
             for message in ordered_messages
         ]
         parts_results = await asyncio.gather(*parts_tasks)
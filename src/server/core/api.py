@@ -14,6 +14,7 @@ from acontext_core.schema.api.request import (
     SearchMode,
     ToolRenameRequest,
     InsertBlockRequest,
+    EmbedRequest,
 )
 from acontext_core.schema.api.response import (
     SearchResultBlockItem,
@@ -21,12 +22,14 @@ from acontext_core.schema.api.response import (
     InsertBlockResponse,
     Flag,
     LearningStatusResponse,
+    EmbedResponse,
 )
 from acontext_core.schema.tool.tool_reference import ToolReferenceData
 from acontext_core.schema.utils import asUUID
-from acontext_core.schema.orm.block import PATH_BLOCK
+from acontext_core.schema.orm.block import PATH_BLOCK, DOC_BLOCK
 from acontext_core.env import DEFAULT_CORE_CONFIG
 from acontext_core.llm.agent import space_search as SS
+from acontext_core.llm.embeddings import get_embedding
 from acontext_core.service.data import block as BB
 from acontext_core.service.data import block_write as BW
 from acontext_core.service.data import block_search as BS
@@ -249,12 +252,51 @@ async def insert_new_block(
             if not r.ok():
                 raise HTTPException(status_code=500, detail=str(r.error))
             return InsertBlockResponse(id=r.data.id)
+    elif request.type in DOC_BLOCK:
+        async with DB_CLIENT.get_session_context() as db_session:
+            r = await BB.create_new_doc_block(
+                db_session,
+                space_id,
+                request.title,
+                request.props,
+                request.parent_id,
+                request.type,
+            )
+            if not r.ok():
+                raise HTTPException(status_code=500, detail=str(r.error))
+            return InsertBlockResponse(id=r.data.id)
     else:
         raise HTTPException(
             status_code=500, detail=f"Invalid block type: {request.type}"
         )
 
 
+@app.post("/api/v1/project/{project_id}/embed")
+async def embed_texts(
+    project_id: asUUID = Path(..., description="Project ID to embed for"),
+    request: EmbedRequest = Body(..., description="Texts to embed"),
+) -> EmbedResponse:
+    """
+    Embed texts with the block embedding model, so they compare with the stored block embeddings.
+    """
+    if not request.texts:
+        return EmbedResponse(
+            embeddings=[],
+            model=DEFAULT_CORE_CONFIG.block_embedding_model,
+            prompt_tokens=0,
+            total_tokens=0,
+        )
+    r = await get_embedding(request.texts, phase=request.phase)
+    if not r.ok():
+        raise HTTPException(status_code=500, detail=str(r.error))
+    return EmbedResponse(
+        embeddings=r.data.embedding.tolist(),
+        model=DEFAULT_CORE_CONFIG.block_embedding_model,
+        prompt_tokens=r.data.prompt_tokens or 0,
+        total_tokens=r.data.total_tokens or 0,
+    )
+
+
 @app.post("/api/v1/project/{project_id}/session/{session_id}/flush")
 async def session_flush(
     project_id: asUUID = Path(..., description="Project ID to search within"),
@@ -0,0 +1,24 @@
+-- Migration: Track server jobs in the tasks table
+-- Date: 2026-10-16
+-- Description: Add tasks.kind and make tasks.session_id nullable, so the API can record exports, bulk deletes
+-- and re-embeddings as tasks of a project next to the agent tasks of sessions
+
+BEGIN;
+
+-- Existing tasks are the agent tasks planned by core
+ALTER TABLE tasks
+ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'agent';
+
+-- Jobs of the server belong to a project, not to a session
+ALTER TABLE tasks
+ALTER COLUMN session_id DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS ix_task_project_id_kind ON tasks (project_id, kind);
+
+COMMIT;
+
+-- Verify the change
+-- SELECT column_name, is_nullable, column_default
+-- FROM information_schema.columns
+-- WHERE table_name = 'tasks' AND column_name IN ('session_id', 'kind');
+-- Expected: session_id is_nullable = 'YES', kind column_default = 'agent'::text
@@ -0,0 +1,21 @@
+-- Migration: Allow the code, table, todo and markdown block types
+-- Date: 2026-10-16
+-- Description: Recreate the ck_block_type check constraint of blocks, so databases created before these
+-- block types existed accept them
+
+BEGIN;
+
+ALTER TABLE blocks
+DROP CONSTRAINT IF EXISTS ck_block_type;
+
+ALTER TABLE blocks
+ADD CONSTRAINT ck_block_type
+CHECK (type IN ('folder', 'page', 'text', 'sop', 'reference', 'code', 'table', 'todo', 'markdown'));
+
+COMMIT;
+
+-- Verify the change
+-- SELECT pg_get_constraintdef(oid)
+-- FROM pg_constraint
+-- WHERE conname = 'ck_block_type';
+-- Expected: the check lists code, table, todo and markdown
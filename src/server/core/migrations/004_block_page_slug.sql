@@ -0,0 +1,49 @@
+-- Migration: Give every page a slug
+-- Date: 2026-10-16
+-- Description: Add blocks.slug with its unique index when missing, and backfill the slug of the pages written before
+-- slugs existed, made from their title as the API and core make it
+
+BEGIN;
+
+ALTER TABLE blocks
+ADD COLUMN IF NOT EXISTS slug TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_blocks_space_slug ON blocks (space_id, slug);
+
+-- No page is written meanwhile, so the backfilled slugs do not collide with new ones
+LOCK TABLE blocks IN SHARE ROW EXCLUSIVE MODE;
+
+-- Oldest pages first, so they keep the slug without a -2, -3... suffix
+DO $$
+DECLARE
+    pg RECORD;
+    base TEXT;
+    candidate TEXT;
+    n INT;
+BEGIN
+    FOR pg IN
+        SELECT id, space_id, title FROM blocks
+        WHERE type = 'page' AND slug IS NULL
+        ORDER BY space_id, created_at, id
+    LOOP
+        base := rtrim(left(btrim(regexp_replace(lower(pg.title), '[^[:alnum:]]+', '-', 'g'), '-'), 64), '-');
+        IF base = '' THEN
+            base := 'page';
+        END IF;
+
+        candidate := base;
+        n := 2;
+        WHILE EXISTS (SELECT 1 FROM blocks WHERE space_id = pg.space_id AND slug = candidate) LOOP
+            candidate := base || '-' || n;
+            n := n + 1;
+        END LOOP;
+
+        UPDATE blocks SET slug = candidate WHERE id = pg.id;
+    END LOOP;
+END $$;
+
+COMMIT;
+
+-- Verify the change
+-- SELECT COUNT(*) FROM blocks WHERE type = 'page' AND slug IS NULL;
+-- Expected: 0
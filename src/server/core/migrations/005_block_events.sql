@@ -0,0 +1,40 @@
+-- Migration: Record the changes of blocks for the block events
+-- Date: 2026-10-16
+-- Description: Add the block_events outbox and a trigger on blocks that records every change of a row in it, so the
+-- API publishes block events for the changes made by the core and by cascaded deletes as well
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS block_events (
+    id BIGSERIAL PRIMARY KEY,
+    tx_id BIGINT NOT NULL,
+    block_id UUID NOT NULL,
+    old_row JSONB,
+    new_row JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_block_events_tx_id ON block_events (tx_id);
+
+CREATE OR REPLACE FUNCTION record_block_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), NEW.id, NULL, to_jsonb(NEW));
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), NEW.id, to_jsonb(OLD), to_jsonb(NEW));
+    ELSE
+        INSERT INTO block_events (tx_id, block_id, old_row, new_row) VALUES (txid_current(), OLD.id, to_jsonb(OLD), NULL);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS blocks_record_event ON blocks;
+CREATE TRIGGER blocks_record_event AFTER INSERT OR UPDATE OR DELETE ON blocks
+    FOR EACH ROW EXECUTE FUNCTION record_block_event();
+
+COMMIT;
+
+-- Verify the change
+-- SELECT tgname FROM pg_trigger WHERE tgrelid = 'blocks'::regclass AND tgname = 'blocks_record_event';
+-- Expected: one row
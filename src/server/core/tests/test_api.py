@@ -406,3 +406,52 @@ class TestGetLearningStatusEndpoint:
             project = await session.get(Project, project_id)
             await session.delete(project)
             await session.commit()
+
+
+class TestEmbedEndpoint:
+    """Test the /api/v1/project/{project_id}/embed endpoint"""
+
+    @pytest.mark.asyncio
+    async def test_embed_texts(self):
+        """Texts are embedded in order with the block embedding model"""
+
+        async def get_mock_embedding(texts, phase="document"):
+            return Result.resolve(
+                EmbeddingReturn(
+                    embedding=np.array([[float(i), 1.0] for i in range(len(texts))]),
+                    prompt_tokens=4,
+                    total_tokens=4,
+                )
+            )
+
+        with patch("api.get_embedding", side_effect=get_mock_embedding):
+            async with AsyncClient(
+                transport=ASGITransport(app=app), base_url="http://test"
+            ) as client:
+                response = await client.post(
+                    f"/api/v1/project/{uuid4()}/embed",
+                    json={"texts": ["hello", "world"]},
+                )
+
+        assert response.status_code == 200
+        data = response.json()
+        assert data["embeddings"] == [[0.0, 1.0], [1.0, 1.0]]
+        assert data["model"] == DEFAULT_CORE_CONFIG.block_embedding_model
+        assert data["prompt_tokens"] == 4
+
+    @pytest.mark.asyncio
+    async def test_embed_failure(self):
+        """A failing embedding provider is reported as 500"""
+
+        async def get_mock_embedding(texts, phase="document"):
+            return Result.reject("provider down")
+
+        with patch("api.get_embedding", side_effect=get_mock_embedding):
+            async with AsyncClient(
+                transport=ASGITransport(app=app), base_url="http://test"
+            ) as client:
+                response = await client.post(
+                    f"/api/v1/project/{uuid4()}/embed", json={"texts": ["hello"]}
+                )
+
+        assert response.status_code == 500